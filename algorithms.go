@@ -0,0 +1,55 @@
+package ghaauth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultAlgorithm is the signing algorithm GitHub uses, and the only one
+// accepted unless WithAllowedAlgorithms says otherwise
+const DefaultAlgorithm = "RS256"
+
+// rsaAlgorithms are the algorithms that can be verified with the RSA keys
+// published in a JWKS
+var rsaAlgorithms = []string{"RS256", "RS384", "RS512"}
+
+// WithAllowedAlgorithms sets the signing algorithms tokens may use,
+// replacing the default of RS256 only. Only RSA PKCS#1 v1.5 algorithms
+// (RS256, RS384, RS512) can be allowed, so that a token can never
+// downgrade verification to a symmetric or unsigned algorithm. The list is
+// enforced both by the parser and when selecting the key.
+func WithAllowedAlgorithms(algs ...string) Option {
+	return func(v *Verifier) {
+		if len(algs) == 0 {
+			v.optionErrs = append(v.optionErrs, fmt.Errorf("at least one algorithm must be allowed"))
+			return
+		}
+		for _, alg := range algs {
+			if !slices.Contains(rsaAlgorithms, alg) {
+				v.optionErrs = append(v.optionErrs, fmt.Errorf("unsupported algorithm %q: must be one of %s",
+					alg, strings.Join(rsaAlgorithms, ", ")))
+				return
+			}
+		}
+		v.allowedAlgs = algs
+	}
+}
+
+// WithFetcherAllowedAlgorithms sets the signing algorithms Keyfunc
+// accepts, replacing the default of RS256 only (see WithAllowedAlgorithms)
+func WithFetcherAllowedAlgorithms(algs ...string) FetcherOption {
+	return func(f *JWKSFetcher) {
+		f.allowedAlgs = algs
+	}
+}
+
+// checkAlgorithm rejects tokens signed with an algorithm outside allowed
+func checkAlgorithm(token *jwt.Token, allowed []string) error {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok || !slices.Contains(allowed, token.Method.Alg()) {
+		return NewValidationError(ErrInvalidSignature, fmt.Sprintf("unexpected signing method: %v", token.Header["alg"]))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestWithAllowedAlgorithms(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	claims := testutil.DefaultClaims().ToJWT()
+	sign := func(method jwt.SigningMethod) string {
+		token, err := gen.GenerateTokenWithMethod(method, claims)
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		return token
+	}
+
+	// HS256 signed with the public key, the classic algorithm confusion attack
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmacToken.Header["kid"] = gen.KeyID()
+	publicKey, err := x509.MarshalPKIXPublicKey(gen.PublicKey())
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	hs256, err := hmacToken.SignedString(publicKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	noneToken := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	noneToken.Header["kid"] = gen.KeyID()
+	none, err := noneToken.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		token   string
+		wantErr bool
+	}{
+		{name: "RS256 by default", token: sign(jwt.SigningMethodRS256)},
+		{name: "RS384 rejected by default", token: sign(jwt.SigningMethodRS384), wantErr: true},
+		{name: "HS256 rejected", token: hs256, wantErr: true},
+		{name: "none rejected", token: none, wantErr: true},
+		{
+			name:  "RS384 allowed",
+			opts:  []Option{WithAllowedAlgorithms("RS256", "RS384")},
+			token: sign(jwt.SigningMethodRS384),
+		},
+		{
+			name:    "parser options cannot widen the list",
+			opts:    []Option{WithParserOptions(jwt.WithValidMethods([]string{"RS256", "RS512"}))},
+			token:   sign(jwt.SigningMethodRS512),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := New(append([]Option{WithJWKSURL(server.URL() + "/.well-known/jwks")}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			_, err = jwt.Parse(tt.token, verifier.Keyfunc(context.Background()), jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "HS256", "none"}))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Keyfunc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithAllowedAlgorithms_Invalid(t *testing.T) {
+	for _, algs := range [][]string{nil, {"HS256"}, {"RS256", "none"}, {"PS256"}} {
+		if _, err := New(WithAllowedAlgorithms(algs...)); err == nil {
+			t.Errorf("New(WithAllowedAlgorithms(%q)) error = nil, want error", algs)
+		}
+	}
+}
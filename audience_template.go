@@ -0,0 +1,91 @@
+package ghaauth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// audienceTemplate is an expected audience with {claim} placeholders
+type audienceTemplate struct {
+	// literals has one more element than claims: the text before, between
+	// and after the placeholders
+	literals []string
+	claims   []string
+}
+
+// parseAudienceTemplate splits a template into literals and placeholders
+func parseAudienceTemplate(template string) (*audienceTemplate, error) {
+	t := &audienceTemplate{}
+	rest := template
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid audience template %q: unclosed {", template)
+		}
+		name := rest[open+1 : open+end]
+		if !validClaimName(name) {
+			return nil, fmt.Errorf("invalid audience template %q: invalid claim name %q", template, name)
+		}
+
+		t.literals = append(t.literals, rest[:open])
+		t.claims = append(t.claims, name)
+		rest = rest[open+end+1:]
+	}
+	if strings.IndexByte(rest, '}') >= 0 {
+		return nil, fmt.Errorf("invalid audience template %q: unexpected }", template)
+	}
+	t.literals = append(t.literals, rest)
+
+	return t, nil
+}
+
+// validClaimName reports whether name is a non-empty claim name of
+// lowercase letters, digits and underscores
+func validClaimName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// render returns the audience expected for the claims. Every placeholder
+// must name a string or numeric claim that is present.
+func (t *audienceTemplate) render(claims *GitHubActionsClaims) (string, error) {
+	var b strings.Builder
+	for i, name := range t.claims {
+		value := claimString(claims, name)
+		if value == "" {
+			return "", NewValidationError(ErrInvalidAudience, fmt.Sprintf("audience template needs the %s claim", name))
+		}
+		b.WriteString(t.literals[i])
+		b.WriteString(value)
+	}
+	b.WriteString(t.literals[len(t.literals)-1])
+	return b.String(), nil
+}
+
+// WithAudienceTemplate expects an audience rendered from the token's
+// claims, e.g. "https://api.example.com/{repository_owner}" for per-org
+// audiences without listing every org. Placeholders name string or numeric
+// claims, including Extra claims; tokens lacking one fail with
+// ErrInvalidAudience. It cannot be combined with WithAudience, and
+// WithExpectedAudience overrides it for a single call.
+func WithAudienceTemplate(template string) Option {
+	return func(v *Verifier) {
+		t, err := parseAudienceTemplate(template)
+		if err != nil {
+			v.optionErrs = append(v.optionErrs, err)
+			return
+		}
+		v.audienceTemplate = t
+	}
+}
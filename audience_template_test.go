@@ -0,0 +1,111 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestParseAudienceTemplate(t *testing.T) {
+	claims := &GitHubActionsClaims{RepositoryOwner: "myorg", Repository: "myorg/myrepo", Extra: map[string]any{"tenant_id": float64(42)}}
+
+	tests := []struct {
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{template: "https://api.example.com", want: "https://api.example.com"},
+		{template: "https://api.example.com/{repository_owner}", want: "https://api.example.com/myorg"},
+		{template: "{repository}#{tenant_id}", want: "myorg/myrepo#42"},
+		{template: "https://api.example.com/{repository_owner", wantErr: true},
+		{template: "https://api.example.com/repository_owner}", wantErr: true},
+		{template: "https://api.example.com/{}", wantErr: true},
+		{template: "https://api.example.com/{Repository Owner}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			template, err := parseAudienceTemplate(tt.template)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseAudienceTemplate() error = nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAudienceTemplate() error = %v", err)
+			}
+			got, err := template.render(claims)
+			if err != nil || got != tt.want {
+				t.Errorf("render() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	template, err := parseAudienceTemplate("https://api.example.com/{environment}")
+	if err != nil {
+		t.Fatalf("parseAudienceTemplate() error = %v", err)
+	}
+	if _, err := template.render(claims); !errors.Is(err, ErrInvalidAudience) {
+		t.Errorf("render() error = %v, want ErrInvalidAudience for a missing claim", err)
+	}
+}
+
+func TestWithAudienceTemplate(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithJWKSURL(server.JWKSURL()),
+		WithAudienceTemplate("https://api.example.com/{repository_owner}"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tokenFor := func(owner, audience string) string {
+		t.Helper()
+		claims := testutil.DefaultClaims()
+		claims.Repository = owner + "/myrepo"
+		claims.RepositoryOwner = owner
+		claims.Audience = []string{audience}
+		token, err := gen.GenerateToken(claims.ToJWT())
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		return token
+	}
+
+	ctx := context.Background()
+	if _, err := verifier.Verify(ctx, tokenFor("myorg", "https://api.example.com/myorg")); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if _, err := verifier.Verify(ctx, tokenFor("otherorg", "https://api.example.com/otherorg")); err != nil {
+		t.Errorf("Verify() error = %v for another org", err)
+	}
+
+	// A token minted for one org's audience is refused for another org
+	if _, err := verifier.Verify(ctx, tokenFor("otherorg", "https://api.example.com/myorg")); !errors.Is(err, ErrInvalidAudience) {
+		t.Errorf("Verify() error = %v, want ErrInvalidAudience", err)
+	}
+
+	// WithExpectedAudience replaces the template for a call
+	token := tokenFor("myorg", "https://admin.example.com")
+	if _, err := verifier.VerifyWith(ctx, token, WithExpectedAudience("https://admin.example.com")); err != nil {
+		t.Errorf("VerifyWith() error = %v", err)
+	}
+
+	if _, err := New(WithAudienceTemplate("https://api.example.com/{")); err == nil {
+		t.Error("New() error = nil for an invalid template")
+	}
+	if _, err := New(WithAudience("https://api.example.com"), WithAudienceTemplate("https://api.example.com/{repository_owner}")); err == nil {
+		t.Error("New() error = nil for WithAudience and WithAudienceTemplate")
+	}
+}
@@ -0,0 +1,61 @@
+package ghaauth
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// BatchResult is the outcome of verifying one token of a batch
+type BatchResult struct {
+	// Result is set when the token was verified
+	Result *VerificationResult
+
+	// Err is set when verification failed
+	Err error
+}
+
+// WithBatchConcurrency sets how many tokens VerifyBatch verifies in
+// parallel. Defaults to GOMAXPROCS.
+func WithBatchConcurrency(n int) Option {
+	return func(v *Verifier) {
+		v.batchConcurrency = n
+	}
+}
+
+// VerifyBatch verifies many tokens in parallel on a bounded pool of
+// workers and returns one result per token, in the same order. Tokens not
+// yet verified when ctx is done fail with the context's error.
+func (v *Verifier) VerifyBatch(ctx context.Context, tokens []string) []BatchResult {
+	results := make([]BatchResult, len(tokens))
+
+	workers := v.batchConcurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(tokens))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				results[i].Result, results[i].Err = v.Verify(ctx, tokens[i])
+			}
+		}()
+	}
+
+	for i := range tokens {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
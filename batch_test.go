@@ -0,0 +1,92 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestVerifier_VerifyBatch(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	policy := &Policy{
+		Rules: []Rule{
+			{Name: "allow-myorg", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow},
+		},
+		DefaultDeny: true,
+	}
+
+	verifier, err := New(
+		WithPolicy(policy),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithBatchConcurrency(3),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	var tokens []string
+	var wantErrs []error
+	for i := 0; i < 20; i++ {
+		claims := testutil.DefaultClaims()
+		var wantErr error
+		if i%4 == 3 {
+			claims.RepositoryOwner = "otherorg"
+			wantErr = ErrAccessDenied
+		}
+		token, err := gen.GenerateToken(claims.ToJWT())
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		tokens = append(tokens, token)
+		wantErrs = append(wantErrs, wantErr)
+	}
+	tokens = append(tokens, "not-a-token")
+	wantErrs = append(wantErrs, ErrInvalidToken)
+
+	results := verifier.VerifyBatch(context.Background(), tokens)
+	if len(results) != len(tokens) {
+		t.Fatalf("VerifyBatch() returned %d results, want %d", len(results), len(tokens))
+	}
+
+	for i, result := range results {
+		if wantErrs[i] == nil {
+			if result.Err != nil || result.Result == nil {
+				t.Errorf("result %d = %+v, want success", i, result)
+			}
+			continue
+		}
+		if !errors.Is(result.Err, wantErrs[i]) || result.Result != nil {
+			t.Errorf("result %d = %+v, want error %v", i, result, wantErrs[i])
+		}
+	}
+}
+
+func TestVerifier_VerifyBatch_Canceled(t *testing.T) {
+	verifier, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := verifier.VerifyBatch(ctx, []string{"a", "b", "c"})
+	for i, result := range results {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("result %d error = %v, want context.Canceled", i, result.Err)
+		}
+	}
+
+	if results := verifier.VerifyBatch(context.Background(), nil); len(results) != 0 {
+		t.Errorf("VerifyBatch(nil) = %v, want no results", results)
+	}
+}
@@ -0,0 +1,304 @@
+// Package broker exchanges verified GitHub Actions OIDC tokens for GitHub
+// App installation tokens scoped to the calling repository, so workflows
+// get short-lived credentials without storing a personal access token.
+package broker
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// DefaultBaseURL is the GitHub.com REST API
+const DefaultBaseURL = "https://api.github.com"
+
+// ErrNotInstalled is returned when the GitHub App is not installed on the
+// calling repository
+var ErrNotInstalled = errors.New("github app is not installed on the repository")
+
+// Permissions maps GitHub App permission names to access levels, e.g.
+// {"contents": "read", "pull_requests": "write"}
+type Permissions map[string]string
+
+// Token is an installation access token
+type Token struct {
+	// Token is the installation access token
+	Token string `json:"token"`
+
+	// ExpiresAt is when GitHub expires the token, one hour after issue
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Permissions are the permissions granted to the token
+	Permissions Permissions `json:"permissions,omitempty"`
+
+	// Repository is the repository the token is restricted to
+	Repository string `json:"repository"`
+}
+
+// APIError is an unexpected response from the GitHub API
+type APIError struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+
+	// Message is GitHub's error message
+	Message string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github api: %d %s", e.StatusCode, e.Message)
+}
+
+// Broker mints installation tokens for callers the verifier accepts
+type Broker struct {
+	verifier    ghaauth.TokenVerifier
+	appID       string
+	key         *rsa.PrivateKey
+	baseURL     string
+	httpClient  *http.Client
+	clock       ghaauth.Clock
+	permissions func(*ghaauth.VerificationResult) (Permissions, error)
+}
+
+// Option configures a Broker
+type Option func(*Broker)
+
+// WithBaseURL sets the REST API URL, e.g.
+// "https://ghes.example.com/api/v3" for GitHub Enterprise Server
+func WithBaseURL(url string) Option {
+	return func(b *Broker) {
+		b.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client for GitHub API requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(b *Broker) {
+		b.httpClient = client
+	}
+}
+
+// WithClock sets the clock for App JWTs (mainly for testing)
+func WithClock(clock ghaauth.Clock) Option {
+	return func(b *Broker) {
+		b.clock = clock
+	}
+}
+
+// WithPermissions requests the same permissions for every token. Without
+// it, tokens get all permissions of the installation.
+func WithPermissions(permissions Permissions) Option {
+	return func(b *Broker) {
+		b.permissions = func(*ghaauth.VerificationResult) (Permissions, error) {
+			return permissions, nil
+		}
+	}
+}
+
+// WithPermissionsFunc chooses the permissions per caller, e.g. write
+// access for the main branch only. An error refuses the exchange; wrap
+// ghaauth.ErrAccessDenied for Handler to answer 403 Forbidden.
+func WithPermissionsFunc(fn func(*ghaauth.VerificationResult) (Permissions, error)) Option {
+	return func(b *Broker) {
+		b.permissions = fn
+	}
+}
+
+// New creates a broker for the GitHub App with the given ID (or client ID)
+// and private key, e.g. from jwt.ParseRSAPrivateKeyFromPEM
+func New(verifier ghaauth.TokenVerifier, appID string, key *rsa.PrivateKey, opts ...Option) (*Broker, error) {
+	if verifier == nil {
+		return nil, fmt.Errorf("verifier is required")
+	}
+	if appID == "" || key == nil {
+		return nil, fmt.Errorf("app ID and private key are required")
+	}
+
+	b := &Broker{
+		verifier:   verifier,
+		appID:      appID,
+		key:        key,
+		baseURL:    DefaultBaseURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		clock:      ghaauth.DefaultClock{},
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b, nil
+}
+
+// Exchange verifies the OIDC token and mints an installation token
+// restricted to the repository it was issued for
+func (b *Broker) Exchange(ctx context.Context, oidcToken string) (*Token, error) {
+	result, err := b.verifier.Verify(ctx, oidcToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var permissions Permissions
+	if b.permissions != nil {
+		if permissions, err = b.permissions(result); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.mint(ctx, result.Claims, permissions)
+}
+
+// mint creates an installation token for the claims' repository. Tokens
+// of other CI providers are refused: their repositories only share names
+// with GitHub's.
+func (b *Broker) mint(ctx context.Context, claims *ghaauth.GitHubActionsClaims, permissions Permissions) (*Token, error) {
+	if claims.Mapped() {
+		return nil, ghaauth.NewValidationError(ghaauth.ErrAccessDenied, "installation tokens are only issued for GitHub Actions tokens")
+	}
+
+	appJWT, err := b.appJWT()
+	if err != nil {
+		return nil, err
+	}
+
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := b.do(ctx, http.MethodGet, "/repos/"+claims.Repository+"/installation", appJWT, nil, &installation); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrNotInstalled, claims.Repository)
+		}
+		return nil, err
+	}
+
+	// Restrict by ID where possible, which survives repository renames
+	request := map[string]any{}
+	if id, err := strconv.ParseInt(claims.RepositoryID, 10, 64); err == nil {
+		request["repository_ids"] = []int64{id}
+	} else {
+		_, name, _ := strings.Cut(claims.Repository, "/")
+		request["repositories"] = []string{name}
+	}
+	if len(permissions) > 0 {
+		request["permissions"] = permissions
+	}
+
+	var token Token
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", installation.ID)
+	if err := b.do(ctx, http.MethodPost, path, appJWT, request, &token); err != nil {
+		return nil, err
+	}
+
+	token.Repository = claims.Repository
+	return &token, nil
+}
+
+// appJWT signs the short-lived JWT that authenticates as the App. It is
+// backdated to allow for clock drift, as GitHub recommends.
+func (b *Broker) appJWT() (string, error) {
+	now := b.clock.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    b.appID,
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+	})
+
+	signed, err := token.SignedString(b.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app JWT: %w", err)
+	}
+	return signed, nil
+}
+
+// do sends an authenticated API request and decodes the JSON response
+func (b *Broker) do(ctx context.Context, method, path, appJWT string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+appJWT)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("github api request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&apiErr)
+		return &APIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode github api response: %w", err)
+	}
+	return nil
+}
+
+// Handler serves token exchanges: it reads the OIDC token from the
+// Authorization header and responds with the Token as JSON. Verification
+// failures get the status from ghaauth.HTTPStatus and GitHub API failures
+// 502 Bad Gateway, without details.
+func (b *Broker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		oidcToken, err := ghaauth.ParseBearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			ghaauth.DefaultErrorHandler(w, r, err)
+			return
+		}
+
+		token, err := b.Exchange(r.Context(), oidcToken)
+		if err != nil {
+			if ghaauth.ErrorCodeOf(err) != "" {
+				ghaauth.DefaultErrorHandler(w, r, err)
+				return
+			}
+			status := http.StatusBadGateway
+			if errors.Is(err, ErrNotInstalled) {
+				status = http.StatusForbidden
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(token)
+	})
+}
@@ -0,0 +1,261 @@
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+	"github.com/dev-shimada/gha-auth/ghaauthtest"
+)
+
+// fakeGitHub serves the installation endpoints of the GitHub API
+type fakeGitHub struct {
+	*httptest.Server
+	t        *testing.T
+	appKey   *rsa.PublicKey
+	requests []map[string]any
+}
+
+func newFakeGitHub(t *testing.T, appKey *rsa.PublicKey) *fakeGitHub {
+	f := &fakeGitHub{t: t, appKey: appKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/{owner}/{repo}/installation", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(r) {
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.PathValue("owner") != "myorg" {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"id": 42}`)
+	})
+	mux.HandleFunc("POST /app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(r) {
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, `{"message": "Problems parsing JSON"}`, http.StatusBadRequest)
+			return
+		}
+		f.requests = append(f.requests, body)
+
+		permissions := body["permissions"]
+		if permissions == nil {
+			permissions = map[string]string{"contents": "write", "metadata": "read"}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"token":       "ghs_test",
+			"expires_at":  "2030-01-01T00:00:00Z",
+			"permissions": permissions,
+		})
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// authorized checks the App JWT
+func (f *fakeGitHub) authorized(r *http.Request) bool {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (any, error) { return f.appKey, nil },
+		jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer("12345"))
+	if err != nil {
+		f.t.Errorf("invalid app JWT: %v", err)
+		return false
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime > 10*time.Minute {
+		f.t.Errorf("app JWT lifetime = %v, GitHub allows at most 10m", lifetime)
+	}
+	return true
+}
+
+func newTestBroker(t *testing.T, opts ...Option) (*Broker, *fakeGitHub, *ghaauthtest.TokenGenerator) {
+	t.Helper()
+
+	gen, err := ghaauthtest.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	jwks := ghaauthtest.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	t.Cleanup(jwks.Close)
+
+	verifier, err := ghaauth.New(
+		ghaauth.WithAudience("https://api.example.com"),
+		ghaauth.WithJWKSURL(jwks.URL()+"/.well-known/jwks"),
+	)
+	if err != nil {
+		t.Fatalf("ghaauth.New() error = %v", err)
+	}
+
+	appKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	github := newFakeGitHub(t, &appKey.PublicKey)
+
+	b, err := New(verifier, "12345", appKey, append([]Option{WithBaseURL(github.URL + "/")}, opts...)...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return b, github, gen
+}
+
+func oidcToken(t *testing.T, gen *ghaauthtest.TokenGenerator, owner string) string {
+	t.Helper()
+
+	claims := ghaauthtest.DefaultClaims()
+	claims.RepositoryOwner = owner
+	claims.Repository = owner + "/myrepo"
+	token, err := gen.GenerateToken(claims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	return token
+}
+
+func TestBroker_Exchange(t *testing.T) {
+	b, github, gen := newTestBroker(t, WithPermissions(Permissions{"contents": "read"}))
+
+	token, err := b.Exchange(context.Background(), oidcToken(t, gen, "myorg"))
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	if token.Token != "ghs_test" || token.Repository != "myorg/myrepo" || token.ExpiresAt.IsZero() {
+		t.Errorf("Exchange() = %+v", token)
+	}
+	if token.Permissions["contents"] != "read" {
+		t.Errorf("Permissions = %v, want contents: read", token.Permissions)
+	}
+
+	// DefaultClaims carry repository_id 67890
+	request := github.requests[0]
+	if ids, _ := request["repository_ids"].([]any); len(ids) != 1 || ids[0] != float64(67890) {
+		t.Errorf("repository_ids = %v, want [67890]", request["repository_ids"])
+	}
+}
+
+func TestBroker_ExchangeErrors(t *testing.T) {
+	refuse := WithPermissionsFunc(func(result *ghaauth.VerificationResult) (Permissions, error) {
+		if result.Claims.Ref != "refs/heads/release" {
+			return nil, fmt.Errorf("%w: only release branches", ghaauth.ErrAccessDenied)
+		}
+		return Permissions{"contents": "write"}, nil
+	})
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		owner   string
+		token   string
+		wantErr error
+	}{
+		{name: "invalid OIDC token", owner: "myorg", token: "not-a-token", wantErr: ghaauth.ErrInvalidToken},
+		{name: "app not installed", owner: "otherorg", wantErr: ErrNotInstalled},
+		{name: "refused by permissions func", opts: []Option{refuse}, owner: "myorg", wantErr: ghaauth.ErrAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, github, gen := newTestBroker(t, tt.opts...)
+			token := tt.token
+			if token == "" {
+				token = oidcToken(t, gen, tt.owner)
+			}
+
+			if _, err := b.Exchange(context.Background(), token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exchange() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(github.requests) != 0 {
+				t.Errorf("a token was minted: %v", github.requests)
+			}
+		})
+	}
+}
+
+func TestBroker_Handler(t *testing.T) {
+	b, _, gen := newTestBroker(t)
+	handler := b.Handler()
+
+	tests := []struct {
+		name       string
+		method     string
+		owner      string
+		header     string
+		wantStatus int
+	}{
+		{name: "exchange", method: http.MethodPost, owner: "myorg", wantStatus: http.StatusOK},
+		{name: "missing token", method: http.MethodPost, header: "-", wantStatus: http.StatusUnauthorized},
+		{name: "app not installed", method: http.MethodPost, owner: "otherorg", wantStatus: http.StatusForbidden},
+		{name: "wrong method", method: http.MethodGet, owner: "myorg", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/token", nil)
+			if tt.header == "" {
+				req.Header.Set("Authorization", "Bearer "+oidcToken(t, gen, tt.owner))
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var token Token
+			if err := json.NewDecoder(rec.Body).Decode(&token); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if token.Token != "ghs_test" || rec.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("response = %+v, headers = %v", token, rec.Header())
+			}
+		})
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	verifier, err := ghaauth.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(nil, "1", key); err == nil {
+		t.Error("New() without verifier error = nil")
+	}
+	if _, err := New(verifier, "", key); err == nil {
+		t.Error("New() without app ID error = nil")
+	}
+	if _, err := New(verifier, "1", nil); err == nil {
+		t.Error("New() without key error = nil")
+	}
+}
@@ -0,0 +1,286 @@
+package ghaauth
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Issuer URLs of other CI providers' OIDC tokens
+const (
+	GitLabIssuerURL    = "https://gitlab.com"
+	BuildkiteIssuerURL = "https://agent.buildkite.com"
+	CircleCIIssuerURL  = "https://oidc.circleci.com/org/"
+
+	// AzureDevOpsIssuerURL is followed by the organization ID
+	AzureDevOpsIssuerURL = "https://vstoken.dev.azure.com/"
+
+	// BitbucketIssuerURL is followed by the workspace and
+	// "/pipelines-config/identity/oidc"
+	BitbucketIssuerURL = "https://api.bitbucket.org/2.0/workspaces/"
+)
+
+// ClaimSet gives access to the claims of a token by name
+type ClaimSet interface {
+	// Claim returns the value of a claim and whether it is present
+	Claim(name string) (any, bool)
+}
+
+// Claim returns a claim from the dedicated fields or Extra
+func (c *GitHubActionsClaims) Claim(name string) (any, bool) {
+	if index, ok := claimFields[name]; ok {
+		field := reflect.ValueOf(c).Elem().FieldByIndex(index)
+		return field.Interface(), !field.IsZero()
+	}
+
+	value, ok := c.Extra[name]
+	return value, ok && value != nil
+}
+
+// ClaimMapper converts the claims of another CI provider's token to
+// GitHubActionsClaims, so that policies, workflow pins and identities work
+// the same for every provider. The issuer's registered claims (iss, aud,
+// exp, ...) and the token's Extra claims are carried over by the verifier;
+// mappers return an ErrInvalidToken ValidationError for tokens lacking the
+// claims they need.
+type ClaimMapper func(claims ClaimSet) (*GitHubActionsClaims, error)
+
+// providerIssuer returns the issuer for a provider name in configuration
+// files, with the provider's claim mapper and JWKS location
+func providerIssuer(provider, url string) (Issuer, bool) {
+	switch provider {
+	case "", "github":
+		return Issuer{URL: url}, true
+	case "gitlab":
+		return GitLabIssuer(url), true
+	case "buildkite":
+		return Issuer{URL: url, ClaimMapper: MapBuildkiteClaims}, true
+	case "circleci":
+		jwksURL := strings.TrimSuffix(url, "/") + "/.well-known/jwks-pub.json"
+		return Issuer{URL: url, JWKSURL: jwksURL, ClaimMapper: MapCircleCIClaims}, true
+	case "azuredevops":
+		return Issuer{URL: url, ClaimMapper: MapAzureDevOpsClaims}, true
+	case "bitbucket":
+		return Issuer{URL: url, JWKSURL: strings.TrimSuffix(url, "/") + "/keys.json", ClaimMapper: MapBitbucketClaims}, true
+	}
+	return Issuer{}, false
+}
+
+// GitLabIssuer trusts GitLab CI ID tokens of a GitLab instance, e.g.
+// GitLabIssuerURL. Its keys are read from the instance's OAuth discovery
+// endpoint.
+func GitLabIssuer(url string) Issuer {
+	return Issuer{
+		URL:         url,
+		JWKSURL:     strings.TrimSuffix(url, "/") + "/oauth/discovery/keys",
+		ClaimMapper: MapGitLabClaims,
+	}
+}
+
+// BuildkiteIssuer trusts Buildkite agent OIDC tokens
+func BuildkiteIssuer() Issuer {
+	return Issuer{URL: BuildkiteIssuerURL, ClaimMapper: MapBuildkiteClaims}
+}
+
+// CircleCIIssuer trusts the CircleCI OIDC tokens of an organization, which
+// has its own issuer URL
+func CircleCIIssuer(orgID string) Issuer {
+	url := CircleCIIssuerURL + orgID
+	return Issuer{URL: url, JWKSURL: url + "/.well-known/jwks-pub.json", ClaimMapper: MapCircleCIClaims}
+}
+
+// AzureDevOpsIssuer trusts the Azure Pipelines OIDC tokens of an Azure
+// DevOps organization, identified by its ID
+func AzureDevOpsIssuer(orgID string) Issuer {
+	return Issuer{URL: AzureDevOpsIssuerURL + orgID, ClaimMapper: MapAzureDevOpsClaims}
+}
+
+// BitbucketIssuer trusts the Bitbucket Pipelines OIDC tokens of a
+// workspace
+func BitbucketIssuer(workspace string) Issuer {
+	url := BitbucketIssuerURL + workspace + "/pipelines-config/identity/oidc"
+	return Issuer{URL: url, JWKSURL: url + "/keys.json", ClaimMapper: MapBitbucketClaims}
+}
+
+// MapGitLabClaims maps GitLab CI ID token claims: the project becomes the
+// repository, its namespace the owner, the pipeline source the event and
+// the CI configuration file the workflow
+func MapGitLabClaims(claims ClaimSet) (*GitHubActionsClaims, error) {
+	c := &GitHubActionsClaims{
+		Repository:           claimString(claims, "project_path"),
+		RepositoryID:         claimString(claims, "project_id"),
+		RepositoryOwner:      claimString(claims, "namespace_path"),
+		RepositoryOwnerID:    claimString(claims, "namespace_id"),
+		RepositoryVisibility: claimString(claims, "project_visibility"),
+		Ref:                  claimString(claims, "ref_path"),
+		RefType:              claimString(claims, "ref_type"),
+		SHA:                  claimString(claims, "sha"),
+		WorkflowSHA:          claimString(claims, "ci_config_sha"),
+		EventName:            claimString(claims, "pipeline_source"),
+		RunID:                claimString(claims, "pipeline_id"),
+		RunnerEnvironment:    claimString(claims, "runner_environment"),
+		Actor:                claimString(claims, "user_login"),
+		ActorID:              claimString(claims, "user_id"),
+		Environment:          claimString(claims, "environment"),
+	}
+
+	// ci_config_ref_uri is "gitlab.com/group/project//.gitlab-ci.yml@refs/heads/main"
+	if uri := claimString(claims, "ci_config_ref_uri"); uri != "" {
+		_, path, _ := strings.Cut(uri, "/")
+		c.WorkflowRef = strings.Replace(path, "//", "/", 1)
+		c.JobWorkflowRef = c.WorkflowRef
+		c.JobWorkflowSHA = c.WorkflowSHA
+
+		_, file, _ := strings.Cut(uri, "//")
+		c.Workflow, _, _ = strings.Cut(file, "@")
+	}
+
+	if c.Ref == "" {
+		switch ref := claimString(claims, "ref"); c.RefType {
+		case "branch":
+			c.Ref = "refs/heads/" + ref
+		case "tag":
+			c.Ref = "refs/tags/" + ref
+		}
+	}
+
+	return c, requireMapped(c, "GitLab", "project_path", "namespace_path", "ref_path")
+}
+
+// MapBuildkiteClaims maps Buildkite agent OIDC token claims: the pipeline
+// becomes the repository, the organization the owner, the build source the
+// event and the build number the run number
+func MapBuildkiteClaims(claims ClaimSet) (*GitHubActionsClaims, error) {
+	org, pipeline := claimString(claims, "organization_slug"), claimString(claims, "pipeline_slug")
+
+	c := &GitHubActionsClaims{
+		RepositoryOwner:   org,
+		RepositoryOwnerID: claimString(claims, "organization_id"),
+		RepositoryID:      claimString(claims, "pipeline_id"),
+		SHA:               claimString(claims, "build_commit"),
+		Workflow:          pipeline,
+		EventName:         claimString(claims, "build_source"),
+		RunID:             claimString(claims, "job_id"),
+		RunNumber:         claimString(claims, "build_number"),
+		RunnerEnvironment: claimString(claims, "runner_environment"),
+	}
+	if org != "" && pipeline != "" {
+		c.Repository = org + "/" + pipeline
+	}
+
+	if tag := claimString(claims, "build_tag"); tag != "" {
+		c.Ref, c.RefType = "refs/tags/"+tag, "tag"
+	} else if branch := claimString(claims, "build_branch"); branch != "" {
+		c.Ref, c.RefType = "refs/heads/"+branch, "branch"
+	}
+
+	return c, requireMapped(c, "Buildkite", "organization_slug", "pipeline_slug", "build_branch or build_tag")
+}
+
+// MapCircleCIClaims maps CircleCI OIDC token claims: the VCS origin
+// becomes the repository, the VCS ref the ref and the user from the
+// subject the actor
+func MapCircleCIClaims(claims ClaimSet) (*GitHubActionsClaims, error) {
+	c := &GitHubActionsClaims{
+		RepositoryID: claimString(claims, "oidc.circleci.com/project-id"),
+		Ref:          claimString(claims, "oidc.circleci.com/vcs-ref"),
+	}
+
+	// vcs-origin is "github.com/myorg/myrepo"
+	if _, repo, ok := strings.Cut(claimString(claims, "oidc.circleci.com/vcs-origin"), "/"); ok {
+		c.Repository = repo
+		c.RepositoryOwner, _, _ = strings.Cut(repo, "/")
+	}
+
+	// sub is "org/<org-id>/project/<project-id>/user/<user-id>"
+	parts := strings.Split(claimString(claims, "sub"), "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		switch parts[i] {
+		case "org":
+			c.RepositoryOwnerID = parts[i+1]
+		case "user":
+			c.Actor, c.ActorID = parts[i+1], parts[i+1]
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(c.Ref, "refs/heads/"):
+		c.RefType = "branch"
+	case strings.HasPrefix(c.Ref, "refs/tags/"):
+		c.RefType = "tag"
+	}
+
+	return c, requireMapped(c, "CircleCI", "oidc.circleci.com/vcs-origin", "oidc.circleci.com/vcs-ref")
+}
+
+// MapAzureDevOpsClaims maps Azure Pipelines OIDC token claims, which only
+// identify the service connection in the subject
+// "sc://<organization>/<project>/<service-connection>": the project becomes
+// the repository, the organization the owner and the service connection
+// the workflow. The tokens have no ref, so ref conditions never match them.
+func MapAzureDevOpsClaims(claims ClaimSet) (*GitHubActionsClaims, error) {
+	sub, ok := strings.CutPrefix(claimString(claims, "sub"), "sc://")
+	parts := strings.SplitN(sub, "/", 3)
+	if !ok || len(parts) != 3 || slices.Contains(parts, "") {
+		return nil, NewValidationError(ErrInvalidToken, "Azure DevOps token must have a sub claim of the form sc://<organization>/<project>/<service-connection>")
+	}
+
+	return &GitHubActionsClaims{
+		Repository:      parts[0] + "/" + parts[1],
+		RepositoryOwner: parts[0],
+		Workflow:        parts[2],
+	}, nil
+}
+
+// MapBitbucketClaims maps Bitbucket Pipelines OIDC token claims. The
+// tokens carry UUIDs rather than names: the repository becomes
+// "<workspace>/<repositoryUuid>" with the workspace from the issuer URL,
+// the deployment environment UUID the environment and the pipeline UUID
+// the run ID.
+func MapBitbucketClaims(claims ClaimSet) (*GitHubActionsClaims, error) {
+	// iss is ".../workspaces/<workspace>/pipelines-config/identity/oidc"
+	_, rest, _ := strings.Cut(claimString(claims, "iss"), "/workspaces/")
+	workspace, _, _ := strings.Cut(rest, "/")
+
+	c := &GitHubActionsClaims{
+		RepositoryOwner:   workspace,
+		RepositoryOwnerID: claimString(claims, "workspaceUuid"),
+		RepositoryID:      claimString(claims, "repositoryUuid"),
+		Environment:       claimString(claims, "deploymentEnvironmentUuid"),
+		RunID:             claimString(claims, "pipelineUuid"),
+	}
+	if workspace != "" && c.RepositoryID != "" {
+		c.Repository = workspace + "/" + c.RepositoryID
+	}
+	if branch := claimString(claims, "branchName"); branch != "" {
+		c.Ref, c.RefType = "refs/heads/"+branch, "branch"
+	}
+
+	return c, requireMapped(c, "Bitbucket", "iss", "repositoryUuid", "branchName")
+}
+
+// requireMapped checks that a mapped token names a repository and ref,
+// which policies rely on
+func requireMapped(c *GitHubActionsClaims, provider string, claims ...string) error {
+	if c.Repository == "" || c.RepositoryOwner == "" || c.Ref == "" {
+		return NewValidationError(ErrInvalidToken, fmt.Sprintf("%s token must have the %s claims", provider, strings.Join(claims, ", ")))
+	}
+	return nil
+}
+
+// claimString returns a string or numeric claim as a string, or "" if it
+// is missing
+func claimString(claims ClaimSet, name string) string {
+	value, _ := claims.Claim(name)
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
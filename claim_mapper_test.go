@@ -0,0 +1,351 @@
+package ghaauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+// gitLabPayload is the payload of a GitLab CI ID token for a push to main
+const gitLabPayload = `{
+	"iss": "https://gitlab.com",
+	"sub": "project_path:mygroup/myproject:ref_type:branch:ref:main",
+	"namespace_id": "72",
+	"namespace_path": "mygroup",
+	"project_id": "20",
+	"project_path": "mygroup/myproject",
+	"project_visibility": "private",
+	"user_id": "1",
+	"user_login": "alice",
+	"pipeline_id": "574",
+	"pipeline_source": "push",
+	"job_id": "302",
+	"ref": "main",
+	"ref_type": "branch",
+	"ref_path": "refs/heads/main",
+	"ref_protected": "true",
+	"environment": "production",
+	"runner_environment": "gitlab-hosted",
+	"sha": "714a629c0b401fdce83e847fc9589983fc6f46bc",
+	"ci_config_ref_uri": "gitlab.com/mygroup/myproject//.gitlab-ci.yml@refs/heads/main",
+	"ci_config_sha": "714a629c0b401fdce83e847fc9589983fc6f46bc"
+}`
+
+func TestClaimMappers(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapper  ClaimMapper
+		payload string
+		want    GitHubActionsClaims
+	}{
+		{
+			name:    "gitlab",
+			mapper:  MapGitLabClaims,
+			payload: gitLabPayload,
+			want: GitHubActionsClaims{
+				Repository:           "mygroup/myproject",
+				RepositoryOwner:      "mygroup",
+				RepositoryOwnerID:    "72",
+				RepositoryVisibility: "private",
+				RepositoryID:         "20",
+				Ref:                  "refs/heads/main",
+				RefType:              "branch",
+				SHA:                  "714a629c0b401fdce83e847fc9589983fc6f46bc",
+				Workflow:             ".gitlab-ci.yml",
+				WorkflowRef:          "mygroup/myproject/.gitlab-ci.yml@refs/heads/main",
+				WorkflowSHA:          "714a629c0b401fdce83e847fc9589983fc6f46bc",
+				JobWorkflowRef:       "mygroup/myproject/.gitlab-ci.yml@refs/heads/main",
+				JobWorkflowSHA:       "714a629c0b401fdce83e847fc9589983fc6f46bc",
+				EventName:            "push",
+				RunID:                "574",
+				RunnerEnvironment:    "gitlab-hosted",
+				Actor:                "alice",
+				ActorID:              "1",
+				Environment:          "production",
+			},
+		},
+		{
+			name:   "gitlab without ref_path",
+			mapper: MapGitLabClaims,
+			payload: `{"project_path": "mygroup/myproject", "namespace_path": "mygroup",
+				"ref": "v1.0.0", "ref_type": "tag"}`,
+			want: GitHubActionsClaims{
+				Repository:      "mygroup/myproject",
+				RepositoryOwner: "mygroup",
+				Ref:             "refs/tags/v1.0.0",
+				RefType:         "tag",
+			},
+		},
+		{
+			name:   "buildkite",
+			mapper: MapBuildkiteClaims,
+			payload: `{
+				"iss": "https://agent.buildkite.com",
+				"sub": "organization:myorg:pipeline:deploy:ref:refs/heads/main:commit:abc123:step:build",
+				"organization_slug": "myorg",
+				"organization_id": "0190a8a0",
+				"pipeline_slug": "deploy",
+				"pipeline_id": "0190a8b1",
+				"build_number": 42,
+				"build_branch": "main",
+				"build_commit": "abc123",
+				"build_source": "webhook",
+				"job_id": "0190a8c2",
+				"runner_environment": "buildkite-hosted"
+			}`,
+			want: GitHubActionsClaims{
+				Repository:        "myorg/deploy",
+				RepositoryOwner:   "myorg",
+				RepositoryOwnerID: "0190a8a0",
+				RepositoryID:      "0190a8b1",
+				Ref:               "refs/heads/main",
+				RefType:           "branch",
+				SHA:               "abc123",
+				Workflow:          "deploy",
+				EventName:         "webhook",
+				RunID:             "0190a8c2",
+				RunNumber:         "42",
+				RunnerEnvironment: "buildkite-hosted",
+			},
+		},
+		{
+			name:   "circleci",
+			mapper: MapCircleCIClaims,
+			payload: `{
+				"iss": "https://oidc.circleci.com/org/org-1",
+				"sub": "org/org-1/project/project-2/user/user-3",
+				"oidc.circleci.com/project-id": "project-2",
+				"oidc.circleci.com/vcs-origin": "github.com/myorg/myrepo",
+				"oidc.circleci.com/vcs-ref": "refs/tags/v2.0.0"
+			}`,
+			want: GitHubActionsClaims{
+				Repository:        "myorg/myrepo",
+				RepositoryOwner:   "myorg",
+				RepositoryOwnerID: "org-1",
+				RepositoryID:      "project-2",
+				Ref:               "refs/tags/v2.0.0",
+				RefType:           "tag",
+				Actor:             "user-3",
+				ActorID:           "user-3",
+			},
+		},
+		{
+			name:   "azure devops",
+			mapper: MapAzureDevOpsClaims,
+			payload: `{
+				"iss": "https://vstoken.dev.azure.com/4f1d6b5e-0000-4000-8000-000000000001",
+				"sub": "sc://myorg/myproject/prod-connection",
+				"aud": "api://AzureADTokenExchange"
+			}`,
+			want: GitHubActionsClaims{
+				Repository:      "myorg/myproject",
+				RepositoryOwner: "myorg",
+				Workflow:        "prod-connection",
+			},
+		},
+		{
+			name:   "bitbucket",
+			mapper: MapBitbucketClaims,
+			payload: `{
+				"iss": "https://api.bitbucket.org/2.0/workspaces/myworkspace/pipelines-config/identity/oidc",
+				"sub": "{repo-uuid}{env-uuid}:{step-uuid}",
+				"workspaceUuid": "{workspace-uuid}",
+				"repositoryUuid": "{repo-uuid}",
+				"pipelineUuid": "{pipeline-uuid}",
+				"stepUuid": "{step-uuid}",
+				"deploymentEnvironmentUuid": "{env-uuid}",
+				"branchName": "main"
+			}`,
+			want: GitHubActionsClaims{
+				Repository:        "myworkspace/{repo-uuid}",
+				RepositoryOwner:   "myworkspace",
+				RepositoryOwnerID: "{workspace-uuid}",
+				RepositoryID:      "{repo-uuid}",
+				Ref:               "refs/heads/main",
+				RefType:           "branch",
+				Environment:       "{env-uuid}",
+				RunID:             "{pipeline-uuid}",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw GitHubActionsClaims
+			if err := json.Unmarshal([]byte(tt.payload), &raw); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := tt.mapper(&raw)
+			if err != nil {
+				t.Fatalf("mapper error = %v", err)
+			}
+			if got.Extra != nil || got.Issuer != "" {
+				t.Errorf("mapper set registered or extra claims: %+v", got)
+			}
+			got.Extra = nil
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("mapper = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimMappers_MissingClaims(t *testing.T) {
+	for name, mapper := range map[string]ClaimMapper{
+		"gitlab":      MapGitLabClaims,
+		"buildkite":   MapBuildkiteClaims,
+		"circleci":    MapCircleCIClaims,
+		"azuredevops": MapAzureDevOpsClaims,
+		"bitbucket":   MapBitbucketClaims,
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := &GitHubActionsClaims{Extra: map[string]any{"project_path": "mygroup/myproject"}}
+			if _, err := mapper(raw); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("mapper error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifier_GitLabIssuer(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	issuer := GitLabIssuer(GitLabIssuerURL)
+	issuer.JWKSURL = server.URL() + "/.well-known/jwks"
+	issuer.Policy = &Policy{
+		DefaultDeny: true,
+		Rules: []Rule{{
+			Name:       "deploy",
+			Conditions: Conditions{Repository: []string{"mygroup/*"}, Ref: []string{"refs/heads/main"}, Environment: []string{"production"}},
+			Effect:     EffectAllow,
+		}},
+	}
+
+	verifier, err := New(
+		WithIssuer(Issuer{URL: DefaultIssuer, JWKSURL: server.URL() + "/.well-known/jwks"}),
+		WithIssuer(issuer),
+		WithAudience("https://api.example.com"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	newToken := func(modify func(jwt.MapClaims)) string {
+		claims := jwt.MapClaims{}
+		if err := json.Unmarshal([]byte(gitLabPayload), &claims); err != nil {
+			t.Fatal(err)
+		}
+		claims["aud"] = "https://api.example.com"
+		claims["iat"] = time.Now().Unix()
+		claims["exp"] = time.Now().Add(5 * time.Minute).Unix()
+		modify(claims)
+
+		token, err := gen.GenerateToken(claims)
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		return token
+	}
+
+	result, err := verifier.Verify(context.Background(), newToken(func(jwt.MapClaims) {}))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if result.Claims.Repository != "mygroup/myproject" || result.Claims.Issuer != GitLabIssuerURL || result.Identity.Org != "mygroup" {
+		t.Errorf("Verify() claims = %+v", result.Claims)
+	}
+	if jobID, _ := result.Claims.ExtraString("job_id"); jobID != "302" {
+		t.Errorf("Extra[job_id] = %q, want 302", jobID)
+	}
+	if !result.Claims.Mapped() {
+		t.Error("Mapped() = false, want true")
+	}
+	if want := GitLabIssuerURL + "#mygroup/myproject@refs/heads/main#.gitlab-ci.yml"; result.Identity.String() != want {
+		t.Errorf("Identity.String() = %q, want %q", result.Identity.String(), want)
+	}
+	if user := DefaultTokenReviewUser(result); user.Groups[0] != GitLabIssuerURL+"#org:mygroup" {
+		t.Errorf("DefaultTokenReviewUser() groups = %v", user.Groups)
+	}
+	if err := (&GitHubAppRepositories{}).Check(context.Background(), result.Claims); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("GitHubAppRepositories.Check() error = %v, want ErrAccessDenied", err)
+	}
+
+	_, err = verifier.Verify(context.Background(), newToken(func(c jwt.MapClaims) { c["environment"] = "staging" }))
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Verify() error = %v, want ErrAccessDenied", err)
+	}
+
+	// A policy override for GitHub repositories does not bypass the
+	// issuer's policy
+	override := (&Policy{Rules: []Rule{{
+		Conditions: Conditions{Repository: []string{"mygroup/myproject"}},
+		Effect:     EffectAllow,
+	}}}).Compile()
+	_, err = verifier.VerifyWith(context.Background(), newToken(func(c jwt.MapClaims) { c["environment"] = "staging" }), WithPolicyOverride(override))
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("VerifyWith(WithPolicyOverride) error = %v, want ErrAccessDenied", err)
+	}
+
+	_, err = verifier.Verify(context.Background(), newToken(func(c jwt.MapClaims) { delete(c, "project_path") }))
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifier_ClaimMapperRequiresPolicy(t *testing.T) {
+	_, err := New(
+		WithIssuer(Issuer{URL: DefaultIssuer}),
+		WithIssuer(GitLabIssuer(GitLabIssuerURL)),
+		WithPolicy(&Policy{Rules: []Rule{{Conditions: Conditions{RepositoryOwner: []string{"mygroup"}}, Effect: EffectAllow}}}),
+	)
+	if err == nil {
+		t.Error("New() error = nil for a claim mapper without a policy")
+	}
+}
+
+func TestProviderIssuer(t *testing.T) {
+	tests := []struct {
+		provider    string
+		url         string
+		wantJWKSURL string
+		wantMapper  bool
+		wantOK      bool
+	}{
+		{provider: "", url: DefaultIssuer, wantOK: true},
+		{provider: "gitlab", url: "https://gitlab.example.com", wantJWKSURL: "https://gitlab.example.com/oauth/discovery/keys", wantMapper: true, wantOK: true},
+		{provider: "buildkite", url: BuildkiteIssuerURL, wantMapper: true, wantOK: true},
+		{provider: "circleci", url: CircleCIIssuerURL + "org-1", wantJWKSURL: CircleCIIssuerURL + "org-1/.well-known/jwks-pub.json", wantMapper: true, wantOK: true},
+		{provider: "azuredevops", url: AzureDevOpsIssuerURL + "org-1", wantMapper: true, wantOK: true},
+		{provider: "bitbucket", url: BitbucketIssuerURL + "ws/pipelines-config/identity/oidc", wantJWKSURL: BitbucketIssuerURL + "ws/pipelines-config/identity/oidc/keys.json", wantMapper: true, wantOK: true},
+		{provider: "jenkins", url: "https://jenkins.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			issuer, ok := providerIssuer(tt.provider, tt.url)
+			if ok != tt.wantOK {
+				t.Fatalf("providerIssuer() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if issuer.URL != tt.url || issuer.JWKSURL != tt.wantJWKSURL || (issuer.ClaimMapper != nil) != tt.wantMapper {
+				t.Errorf("providerIssuer() = %+v", issuer)
+			}
+		})
+	}
+}
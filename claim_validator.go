@@ -0,0 +1,29 @@
+package ghaauth
+
+import "context"
+
+// ClaimValidator is a custom check of verified claims, e.g. looking up the
+// run_id with the GitHub API or the actor in an internal directory. It
+// should return errors wrapping ErrAccessDenied, which HTTPStatus maps to
+// 403, or ErrInvalidToken; other errors are returned as they are and map
+// to 401.
+type ClaimValidator func(ctx context.Context, claims *GitHubActionsClaims) error
+
+// WithClaimValidator adds a validator that runs after the claims have been
+// validated and before the policy is evaluated. Validators run in the order
+// they were added, and the first error fails the verification.
+func WithClaimValidator(validator ClaimValidator) Option {
+	return func(v *Verifier) {
+		v.claimValidators = append(v.claimValidators, validator)
+	}
+}
+
+// runClaimValidators runs the WithClaimValidator validators
+func (v *Verifier) runClaimValidators(ctx context.Context, claims *GitHubActionsClaims) error {
+	for _, validate := range v.claimValidators {
+		if err := validate(ctx, claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
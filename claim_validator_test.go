@@ -0,0 +1,90 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+type validatorCtxKey struct{}
+
+func TestWithClaimValidator(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	denyAll := &Policy{
+		Rules:       []Rule{{Name: "deny-all", Conditions: Conditions{RepositoryOwner: []string{"*"}}, Effect: EffectDeny}},
+		DefaultDeny: true,
+	}
+	unknownActor := fmt.Errorf("%w: actor is not in the directory", ErrAccessDenied)
+
+	tests := []struct {
+		name       string
+		policy     *Policy
+		validators []error
+		wantCalls  int
+		wantErr    error
+		wantStatus int
+	}{
+		{name: "validators pass", validators: []error{nil, nil}, wantCalls: 2},
+		{name: "first error stops", validators: []error{unknownActor, nil}, wantCalls: 1, wantErr: unknownActor, wantStatus: http.StatusForbidden},
+		{name: "other errors are unauthorized", validators: []error{nil, errors.New("lookup failed")}, wantCalls: 2, wantStatus: http.StatusUnauthorized},
+		{name: "validators run before the policy", policy: denyAll, validators: []error{unknownActor}, wantCalls: 1, wantErr: unknownActor, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			opts := []Option{WithJWKSURL(server.JWKSURL()), WithPolicy(tt.policy)}
+			for _, result := range tt.validators {
+				opts = append(opts, WithClaimValidator(func(ctx context.Context, claims *GitHubActionsClaims) error {
+					calls++
+					if ctx.Value(validatorCtxKey{}) != "request" {
+						t.Error("validator did not get the caller's context")
+					}
+					if claims.Repository != "myorg/myrepo" {
+						t.Errorf("validator got repository %q", claims.Repository)
+					}
+					return result
+				}))
+			}
+
+			verifier, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			ctx := context.WithValue(context.Background(), validatorCtxKey{}, "request")
+			_, err = verifier.Verify(ctx, token)
+			if calls != tt.wantCalls {
+				t.Errorf("validator calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Errorf("Verify() error = %v", err)
+				}
+				return
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if status := HTTPStatus(err); status != tt.wantStatus {
+				t.Errorf("HTTPStatus() = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package ghaauth
 
 import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -20,21 +26,25 @@ type GitHubActionsClaims struct {
 	RefType string `json:"ref_type"`
 	SHA     string `json:"sha"`
 
+	// Pull request information (only set for pull_request style events)
+	HeadRef string `json:"head_ref,omitempty"`
+	BaseRef string `json:"base_ref,omitempty"`
+
 	// Workflow information
-	Workflow            string `json:"workflow"`
-	WorkflowRef         string `json:"workflow_ref"`
-	WorkflowSHA         string `json:"workflow_sha"`
-	JobWorkflowRef      string `json:"job_workflow_ref"`
-	JobWorkflowSHA      string `json:"job_workflow_sha"`
-	EventName           string `json:"event_name"`
-	RunID               string `json:"run_id"`
-	RunNumber           string `json:"run_number"`
-	RunAttempt          string `json:"run_attempt"`
-	RunnerEnvironment   string `json:"runner_environment"`
+	Workflow          string `json:"workflow"`
+	WorkflowRef       string `json:"workflow_ref"`
+	WorkflowSHA       string `json:"workflow_sha"`
+	JobWorkflowRef    string `json:"job_workflow_ref"`
+	JobWorkflowSHA    string `json:"job_workflow_sha"`
+	EventName         string `json:"event_name"`
+	RunID             string `json:"run_id"`
+	RunNumber         string `json:"run_number"`
+	RunAttempt        string `json:"run_attempt"`
+	RunnerEnvironment string `json:"runner_environment"`
 
 	// Actor information
-	Actor         string `json:"actor"`
-	ActorID       string `json:"actor_id"`
+	Actor           string `json:"actor"`
+	ActorID         string `json:"actor_id"`
 	TriggeringActor string `json:"triggering_actor,omitempty"`
 
 	// Environment information
@@ -43,38 +53,410 @@ type GitHubActionsClaims struct {
 	// Enterprise information
 	EnterpriseID   string `json:"enterprise_id,omitempty"`
 	EnterpriseSlug string `json:"enterprise_slug,omitempty"`
+
+	// Inputs of a workflow_dispatch run, if the token carries them
+	Inputs WorkflowInputs `json:"inputs,omitempty"`
+
+	// RepositoryTopics and RepositoryProperties are not in the token: they
+	// are looked up by a GitHubEnricher for the repository_topic and
+	// custom_properties conditions. Properties map each custom property to
+	// its values; single-valued properties have one.
+	RepositoryTopics     []string            `json:"-"`
+	RepositoryProperties map[string][]string `json:"-"`
+
+	// HeadRepository is not in the token either: it is the head repository
+	// of a pull request, "owner/name", looked up by a GitHubEnricher for
+	// tokens of pull request refs (see IsFork)
+	HeadRepository string `json:"-"`
+
+	// Extra holds claims that have no dedicated field (e.g. custom
+	// organization claims), keyed by their JWT claim name
+	Extra map[string]any `json:"-"`
+
+	// mapped is set for claims converted from another CI provider's token
+	mapped bool
+}
+
+// Mapped reports whether the claims were converted from another CI
+// provider's token by the issuer's ClaimMapper. Such claims can name the
+// same repositories and owners as GitHub Actions tokens, so they must not
+// be trusted as GitHub's.
+func (c *GitHubActionsClaims) Mapped() bool {
+	return c.mapped
+}
+
+// knownClaims is the set of claim names decoded into dedicated fields
+var knownClaims = claimNames(reflect.TypeOf(GitHubActionsClaims{}))
+
+// claimNames collects the JSON names of all fields, including embedded ones
+func claimNames(t reflect.Type) map[string]struct{} {
+	names := make(map[string]struct{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			for name := range claimNames(field.Type) {
+				names[name] = struct{}{}
+			}
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		names[name] = struct{}{}
+	}
+	return names
 }
 
-// Validate performs basic validation on the claims
+// UnmarshalJSON decodes the known claims into their fields and keeps
+// everything else in Extra
+func (c *GitHubActionsClaims) UnmarshalJSON(data []byte) error {
+	type plain GitHubActionsClaims
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	// Most tokens only carry known claims, which saves decoding them twice
+	if onlyKnownClaims(data) {
+		*c = GitHubActionsClaims(decoded)
+		return nil
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	for name := range knownClaims {
+		delete(all, name)
+	}
+	if len(all) > 0 {
+		decoded.Extra = all
+	}
+
+	*c = GitHubActionsClaims(decoded)
+	return nil
+}
+
+// onlyKnownClaims reports whether every top-level member of the JSON
+// object data is a known claim, without allocating. It errs on the side of
+// false for anything it does not fully understand, such as escaped names.
+func onlyKnownClaims(data []byte) bool {
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return false
+	}
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return true
+	}
+
+	for i < len(data) && data[i] == '"' {
+		end := i + 1
+		for end < len(data) && data[end] != '"' && data[end] != '\\' {
+			end++
+		}
+		if end >= len(data) || data[end] != '"' {
+			return false
+		}
+		if _, ok := knownClaims[string(data[i+1:end])]; !ok {
+			return false
+		}
+
+		i = skipSpace(data, end+1)
+		if i >= len(data) || data[i] != ':' {
+			return false
+		}
+		if i = skipValue(data, skipSpace(data, i+1)); i < 0 {
+			return false
+		}
+
+		i = skipSpace(data, i)
+		if i < len(data) && data[i] == '}' {
+			return true
+		}
+		if i >= len(data) || data[i] != ',' {
+			return false
+		}
+		i = skipSpace(data, i+1)
+	}
+	return false
+}
+
+// skipSpace returns the index of the first non-whitespace byte from i
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// skipValue returns the index after the JSON value starting at i, or -1.
+// It only tracks strings and nesting; the value was already validated by
+// json.Unmarshal.
+func skipValue(data []byte, i int) int {
+	depth := 0
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case '"':
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(data) {
+				return -1
+			}
+		case '{', '[':
+			depth++
+			continue
+		case '}', ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return i
+			}
+			continue
+		default:
+			continue
+		}
+		if depth == 0 {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// MarshalJSON encodes the claims including any Extra claims. Known claims
+// take precedence over Extra entries with the same name.
+func (c GitHubActionsClaims) MarshalJSON() ([]byte, error) {
+	type plain GitHubActionsClaims
+	data, err := json.Marshal(plain(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for name, value := range c.Extra {
+		if _, ok := all[name]; !ok {
+			all[name] = value
+		}
+	}
+	return json.Marshal(all)
+}
+
+// claimFields maps claim names to the index of their field
+var claimFields = func() map[string][]int {
+	fields := make(map[string][]int)
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(GitHubActionsClaims{})) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous || name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field.Index
+	}
+	return fields
+}()
+
+// HasClaim reports whether the named claim is present with a non-empty
+// value, looking at both the dedicated fields and Extra
+func (c *GitHubActionsClaims) HasClaim(name string) bool {
+	if index, ok := claimFields[name]; ok {
+		return !reflect.ValueOf(c).Elem().FieldByIndex(index).IsZero()
+	}
+
+	value, ok := c.Extra[name]
+	return ok && value != nil && value != ""
+}
+
+// claimValue returns the value of a non-empty string claim field
+func claimValue(c *GitHubActionsClaims, name string) (string, bool) {
+	index, ok := claimFields[name]
+	if !ok {
+		return "", false
+	}
+
+	field := reflect.ValueOf(c).Elem().FieldByIndex(index)
+	if field.Kind() != reflect.String || field.String() == "" {
+		return "", false
+	}
+	return field.String(), true
+}
+
+// ToMap returns the claims as a flat map keyed by their JWT claim names,
+// including the Extra claims, for expression engines, logs and templates.
+// Empty claims are left out. Audiences are joined with ",", times are Unix
+// seconds, and inputs and Extra claims that are not strings, numbers or
+// booleans are JSON-encoded.
+func (c *GitHubActionsClaims) ToMap() map[string]string {
+	m := make(map[string]string, len(claimFields)+len(c.Extra))
+	for name, value := range c.Extra {
+		if s := flatClaim(value); s != "" {
+			m[name] = s
+		}
+	}
+
+	fields := reflect.ValueOf(c).Elem()
+	for name, index := range claimFields {
+		field := fields.FieldByIndex(index)
+		if field.IsZero() {
+			continue
+		}
+		switch value := field.Interface().(type) {
+		case string:
+			m[name] = value
+		case jwt.ClaimStrings:
+			m[name] = strings.Join(value, ",")
+		case *jwt.NumericDate:
+			m[name] = strconv.FormatInt(value.Unix(), 10)
+		case WorkflowInputs:
+			m[name] = flatClaim(map[string]string(value))
+		}
+	}
+	return m
+}
+
+// flatClaim formats an Extra claim for ToMap
+func flatClaim(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// ExtraString returns an Extra claim as a string. The second return value
+// reports whether the claim is present and is a string.
+func (c *GitHubActionsClaims) ExtraString(name string) (string, bool) {
+	value, ok := c.Extra[name].(string)
+	return value, ok
+}
+
+// ParseUnverified decodes the claims of a token WITHOUT verifying its
+// signature. Only use it for tooling and debugging, never for access control.
+func ParseUnverified(tokenString string) (*GitHubActionsClaims, error) {
+	var claims GitHubActionsClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims); err != nil {
+		return nil, NewValidationError(ErrInvalidToken, err.Error())
+	}
+	return &claims, nil
+}
+
+// defaultRequiredClaims are the claims Validate requires
+var defaultRequiredClaims = []string{"repository", "repository_owner", "ref", "workflow", "event_name", "actor"}
+
+// DefaultRequiredClaims returns the claims Validate requires, which every
+// GitHub Actions token carries. WithClaimRequirements replaces them for a
+// Verifier.
+func DefaultRequiredClaims() []string {
+	return slices.Clone(defaultRequiredClaims)
+}
+
+// Validate performs basic validation on the claims of a GitHub.com token
 func (c *GitHubActionsClaims) Validate() error {
-	// Check required fields
-	if c.Issuer != "https://token.actions.githubusercontent.com" {
-		return NewValidationError(ErrInvalidIssuer, "expected https://token.actions.githubusercontent.com")
+	if c.Issuer != DefaultIssuer {
+		return newClaimError(ErrInvalidIssuer, "expected "+DefaultIssuer, map[string]any{"iss": c.Issuer})
 	}
 
-	if c.Repository == "" {
-		return NewValidationError(ErrInvalidToken, "repository claim is required")
+	if err := c.ValidateRequired(defaultRequiredClaims...); err != nil {
+		return err
 	}
+	return c.ValidateConsistency()
+}
 
-	if c.RepositoryOwner == "" {
-		return NewValidationError(ErrInvalidToken, "repository_owner claim is required")
+// ValidateRequired checks that the named claims are present and non-empty,
+// independent of the issuer. Custom claims in Extra can be named too.
+func (c *GitHubActionsClaims) ValidateRequired(names ...string) error {
+	for _, name := range names {
+		if !c.HasClaim(name) {
+			return NewValidationError(ErrInvalidToken, name+" claim is required")
+		}
 	}
+	return nil
+}
 
-	if c.Ref == "" {
-		return NewValidationError(ErrInvalidToken, "ref claim is required")
+// ValidateConsistency checks that the claims agree with each other, as
+// they do in every token GitHub issues: repository starts with
+// repository_owner, ref_type matches the ref, a sub claim in one of
+// GitHub's default formats (see ParseSubject) names the same repository,
+// ref and environment, and runner_environment is RunnerGitHubHosted or
+// RunnerSelfHosted. Empty claims are not checked. Validate runs it;
+// verifiers do with WithClaimConsistency.
+func (c *GitHubActionsClaims) ValidateConsistency() error {
+	if c.Repository != "" && c.RepositoryOwner != "" {
+		owner, _, _ := strings.Cut(c.Repository, "/")
+		if !strings.EqualFold(owner, c.RepositoryOwner) {
+			return newClaimError(ErrInvalidToken, "repository does not belong to repository_owner",
+				map[string]any{"repository": c.Repository, "repository_owner": c.RepositoryOwner})
+		}
 	}
 
-	if c.Workflow == "" {
-		return NewValidationError(ErrInvalidToken, "workflow claim is required")
+	if c.RefType != "" && c.Ref != "" {
+		tag := strings.HasPrefix(c.Ref, "refs/tags/")
+		switch {
+		case c.RefType != "branch" && c.RefType != "tag":
+			return newClaimError(ErrInvalidToken, "unknown ref_type", map[string]any{"ref_type": c.RefType})
+		case tag != (c.RefType == "tag"):
+			return newClaimError(ErrInvalidToken, "ref_type does not match ref",
+				map[string]any{"ref": c.Ref, "ref_type": c.RefType})
+		}
 	}
 
-	if c.EventName == "" {
-		return NewValidationError(ErrInvalidToken, "event_name claim is required")
+	if err := c.validateSubject(); err != nil {
+		return err
 	}
 
-	if c.Actor == "" {
-		return NewValidationError(ErrInvalidToken, "actor claim is required")
+	if c.RunnerEnvironment != "" && c.RunnerEnvironment != RunnerGitHubHosted && c.RunnerEnvironment != RunnerSelfHosted {
+		return newClaimError(ErrInvalidToken, "unknown runner_environment",
+			map[string]any{"runner_environment": c.RunnerEnvironment})
+	}
+
+	return nil
+}
+
+// validateSubject checks a sub claim starting with "repo:" against the
+// repository and, for GitHub's default formats, the ref and environment.
+// Customized subject templates are only checked for the repository.
+func (c *GitHubActionsClaims) validateSubject() error {
+	rest, ok := strings.CutPrefix(c.Subject, "repo:")
+	if !ok || c.Repository == "" {
+		return nil
+	}
+	details := map[string]any{"sub": c.Subject}
+	if !strings.HasPrefix(strings.ToLower(rest), strings.ToLower(c.Repository)+":") {
+		details["repository"] = c.Repository
+		return newClaimError(ErrInvalidToken, "sub does not match repository", details)
 	}
 
+	sub, err := ParseSubject(c.Subject)
+	if err != nil || sub.String() != c.Subject {
+		return nil
+	}
+	switch {
+	case sub.Environment != "" && sub.Environment != c.Environment:
+		details["environment"] = c.Environment
+		return newClaimError(ErrInvalidToken, "sub does not match environment", details)
+	case sub.Ref != "" && c.Ref != "" && sub.Ref != c.Ref:
+		details["ref"] = c.Ref
+		return newClaimError(ErrInvalidToken, "sub does not match ref", details)
+	}
 	return nil
 }
@@ -1,7 +1,9 @@
 package ghaauth
 
 import (
+	"encoding/json"
 	"errors"
+	"maps"
 	"testing"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -174,3 +176,302 @@ func TestGitHubActionsClaims_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestGitHubActionsClaims_ValidateConsistency(t *testing.T) {
+	base := func() *GitHubActionsClaims {
+		return &GitHubActionsClaims{
+			RegisteredClaims:  jwt.RegisteredClaims{Subject: "repo:myorg/myrepo:ref:refs/heads/main"},
+			Repository:        "myorg/myrepo",
+			RepositoryOwner:   "myorg",
+			Ref:               "refs/heads/main",
+			RefType:           "branch",
+			RunnerEnvironment: RunnerGitHubHosted,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(c *GitHubActionsClaims)
+		wantReason string
+	}{
+		{name: "consistent", modify: func(c *GitHubActionsClaims) {}},
+		{name: "owner differs in case", modify: func(c *GitHubActionsClaims) { c.RepositoryOwner = "MyOrg" }},
+		{
+			name:       "repository of another owner",
+			modify:     func(c *GitHubActionsClaims) { c.RepositoryOwner = "otherorg" },
+			wantReason: "repository does not belong to repository_owner",
+		},
+		{
+			name: "tag",
+			modify: func(c *GitHubActionsClaims) {
+				c.Ref, c.RefType, c.Subject = "refs/tags/v1", "tag", "repo:myorg/myrepo:ref:refs/tags/v1"
+			},
+		},
+		{
+			name:       "tag ref typed as branch",
+			modify:     func(c *GitHubActionsClaims) { c.Ref, c.Subject = "refs/tags/v1", "repo:myorg/myrepo:ref:refs/tags/v1" },
+			wantReason: "ref_type does not match ref",
+		},
+		{
+			name:       "unknown ref_type",
+			modify:     func(c *GitHubActionsClaims) { c.RefType = "commit" },
+			wantReason: "unknown ref_type",
+		},
+		{
+			name:       "sub of another repository",
+			modify:     func(c *GitHubActionsClaims) { c.Subject = "repo:myorg/other:ref:refs/heads/main" },
+			wantReason: "sub does not match repository",
+		},
+		{
+			name:       "sub of another ref",
+			modify:     func(c *GitHubActionsClaims) { c.Subject = "repo:myorg/myrepo:ref:refs/heads/dev" },
+			wantReason: "sub does not match ref",
+		},
+		{
+			name: "environment",
+			modify: func(c *GitHubActionsClaims) {
+				c.Environment, c.Subject = "production", "repo:myorg/myrepo:environment:production"
+			},
+		},
+		{
+			name:       "sub of another environment",
+			modify:     func(c *GitHubActionsClaims) { c.Subject = "repo:myorg/myrepo:environment:production" },
+			wantReason: "sub does not match environment",
+		},
+		{
+			name: "pull request",
+			modify: func(c *GitHubActionsClaims) {
+				c.Ref, c.Subject = "refs/pull/1/merge", "repo:myorg/myrepo:pull_request"
+			},
+		},
+		{
+			name:   "customized subject",
+			modify: func(c *GitHubActionsClaims) { c.Subject = "repo:myorg/myrepo:job_workflow_ref:myorg/myrepo/.github/workflows/ci.yml@refs/heads/main" },
+		},
+		{
+			name:   "subject without repo",
+			modify: func(c *GitHubActionsClaims) { c.Subject = "repository_owner_id:12345" },
+		},
+		{
+			name:       "unknown runner environment",
+			modify:     func(c *GitHubActionsClaims) { c.RunnerEnvironment = "cloud" },
+			wantReason: "unknown runner_environment",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := base()
+			tt.modify(claims)
+
+			err := claims.ValidateConsistency()
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Errorf("ValidateConsistency() error = %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) || !errors.Is(err, ErrInvalidToken) || verr.Reason != tt.wantReason {
+				t.Errorf("ValidateConsistency() error = %v, want %q", err, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestGitHubActionsClaims_Extra(t *testing.T) {
+	data := []byte(`{
+		"iss": "https://token.actions.githubusercontent.com",
+		"aud": "https://api.example.com",
+		"repository": "myorg/myrepo",
+		"custom_region": "eu",
+		"custom_team": "platform",
+		"custom_level": 3
+	}`)
+
+	var claims GitHubActionsClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if claims.Repository != "myorg/myrepo" {
+		t.Errorf("Repository = %q, want %q", claims.Repository, "myorg/myrepo")
+	}
+	if claims.Issuer != "https://token.actions.githubusercontent.com" {
+		t.Errorf("Issuer = %q, want GitHub issuer", claims.Issuer)
+	}
+
+	if len(claims.Extra) != 3 {
+		t.Fatalf("len(Extra) = %d, want 3: %v", len(claims.Extra), claims.Extra)
+	}
+	if _, ok := claims.Extra["repository"]; ok {
+		t.Error("Extra should not contain known claim repository")
+	}
+	if _, ok := claims.Extra["aud"]; ok {
+		t.Error("Extra should not contain registered claim aud")
+	}
+
+	if got, ok := claims.ExtraString("custom_team"); !ok || got != "platform" {
+		t.Errorf("ExtraString(custom_team) = %q, %v, want %q, true", got, ok, "platform")
+	}
+	if _, ok := claims.ExtraString("custom_level"); ok {
+		t.Error("ExtraString(custom_level) should report false for non-string claim")
+	}
+
+	// Round trip keeps the extra claims
+	out, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var roundTrip map[string]any
+	if err := json.Unmarshal(out, &roundTrip); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if roundTrip["custom_team"] != "platform" {
+		t.Errorf("custom_team = %v, want platform", roundTrip["custom_team"])
+	}
+	if roundTrip["repository"] != "myorg/myrepo" {
+		t.Errorf("repository = %v, want myorg/myrepo", roundTrip["repository"])
+	}
+}
+
+func TestGitHubActionsClaims_ToMap(t *testing.T) {
+	data := []byte(`{
+		"iss": "https://token.actions.githubusercontent.com",
+		"aud": ["https://api.example.com", "https://other.example.com"],
+		"exp": 1700000000,
+		"repository": "myorg/myrepo",
+		"ref": "refs/heads/main",
+		"environment": "",
+		"custom_team": "platform",
+		"custom_level": 3,
+		"custom_admin": true,
+		"custom_groups": ["a", "b"],
+		"custom_none": null
+	}`)
+
+	var claims GitHubActionsClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := map[string]string{
+		"iss":           "https://token.actions.githubusercontent.com",
+		"aud":           "https://api.example.com,https://other.example.com",
+		"exp":           "1700000000",
+		"repository":    "myorg/myrepo",
+		"ref":           "refs/heads/main",
+		"custom_team":   "platform",
+		"custom_level":  "3",
+		"custom_admin":  "true",
+		"custom_groups": `["a","b"]`,
+	}
+	if got := claims.ToMap(); !maps.Equal(got, want) {
+		t.Errorf("ToMap() = %v, want %v", got, want)
+	}
+}
+
+func TestGitHubActionsClaims_NoExtra(t *testing.T) {
+	var claims GitHubActionsClaims
+	if err := json.Unmarshal([]byte(`{"repository": "myorg/myrepo"}`), &claims); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if claims.Extra != nil {
+		t.Errorf("Extra = %v, want nil", claims.Extra)
+	}
+}
+
+func TestParseUnverified(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":        "https://token.actions.githubusercontent.com",
+		"repository": "myorg/myrepo",
+		"custom":     "value",
+	})
+	tokenString, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	claims, err := ParseUnverified(tokenString)
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	if claims.Repository != "myorg/myrepo" {
+		t.Errorf("Repository = %q, want %q", claims.Repository, "myorg/myrepo")
+	}
+	if claims.Extra["custom"] != "value" {
+		t.Errorf("Extra[custom] = %v, want value", claims.Extra["custom"])
+	}
+
+	if _, err := ParseUnverified("not-a-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ParseUnverified() error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestGitHubActionsClaims_HasClaim(t *testing.T) {
+	claims := &GitHubActionsClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   "https://token.actions.githubusercontent.com",
+			Audience: jwt.ClaimStrings{"sts.amazonaws.com"},
+		},
+		Repository:  "myorg/myrepo",
+		Environment: "production",
+		Extra: map[string]any{
+			"custom_region": "eu-west-1",
+			"empty_custom":  "",
+		},
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "environment", want: true},
+		{name: "repository", want: true},
+		{name: "iss", want: true},
+		{name: "aud", want: true},
+		{name: "job_workflow_ref", want: false},
+		{name: "head_ref", want: false},
+		{name: "exp", want: false},
+		{name: "custom_region", want: true},
+		{name: "empty_custom", want: false},
+		{name: "unknown", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claims.HasClaim(tt.name); got != tt.want {
+				t.Errorf("HasClaim(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyKnownClaims(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{name: "empty object", data: `{}`, want: true},
+		{name: "known claims", data: `{"sub":"repo:a/b","aud":["x","y"],"exp":1700000000,"repository":"a/b"}`, want: true},
+		{name: "whitespace", data: " {\n \"sub\" : \"x\" ,\t\"iat\": 1 }\n", want: true},
+		{name: "escaped quote in value", data: `{"workflow":"say \"hi\"","ref":"refs/heads/main"}`, want: true},
+		{name: "nested values", data: `{"aud":[{"a":[1,2]},"}"],"sub":"x"}`, want: true},
+		{name: "unknown claim", data: `{"sub":"x","check_run_id":"1"}`, want: false},
+		{name: "unknown claim first", data: `{"custom":{"sub":"x"},"sub":"x"}`, want: false},
+		{name: "escaped name", data: `{"\u0073ub":"x"}`, want: false},
+		{name: "not an object", data: `["sub"]`, want: false},
+		{name: "truncated", data: `{"sub":"x"`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onlyKnownClaims([]byte(tt.data)); got != tt.want {
+				t.Errorf("onlyKnownClaims(%s) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
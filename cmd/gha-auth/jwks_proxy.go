@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// maxJWKSSize limits the size of the upstream JWKS
+const maxJWKSSize = 1 << 20
+
+// runJWKSProxy implements "gha-auth jwks-proxy"
+func runJWKSProxy(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("jwks-proxy", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: gha-auth jwks-proxy [flags]\n\n"+
+			"Serves a locally cached copy of GitHub's JWKS, so that verifiers without\n"+
+			"internet access can use one internal endpoint (--jwks-url, WithJWKSURL):\n"+
+			"  /.well-known/jwks  the cached JWKS, refreshed in the background and\n"+
+			"                     served stale while the upstream is unavailable\n"+
+			"  /healthz           200 while the JWKS is served, 503 otherwise\n\n"+
+			"Flags:\n")
+		fs.PrintDefaults()
+	}
+
+	addr := fs.String("addr", ":8080", "listen `address`")
+	upstream := fs.String("upstream", ghaauth.DefaultJWKSURL, "JWKS `url` to cache")
+	refresh := fs.Duration("refresh", 15*time.Minute, "how often the JWKS is refreshed")
+	retry := fs.Duration("retry", 30*time.Second, "how soon a failed refresh is retried")
+	maxStale := fs.Duration("max-stale", 24*time.Hour, "how long a JWKS that could not be refreshed is served (0 for ever)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 10*time.Second, "how long to wait for requests in flight on shutdown")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 || *refresh <= 0 || *retry <= 0 || *maxStale < 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	logger := slog.New(slog.NewJSONHandler(stderr, nil))
+	proxy := newJWKSProxy(*upstream, *refresh, *maxStale, logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth jwks-proxy: %v\n", err)
+		return exitUsage
+	}
+
+	go proxy.run(ctx, *retry)
+
+	if err := serve(ctx, listener, proxy.handler(), *shutdownTimeout, logger); err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth jwks-proxy: %v\n", err)
+		return exitDenied
+	}
+	return exitOK
+}
+
+// jwksProxy caches an upstream JWKS and serves it
+type jwksProxy struct {
+	upstream string
+	client   *http.Client
+	refresh  time.Duration
+	maxStale time.Duration
+	logger   *slog.Logger
+
+	mu           sync.RWMutex
+	body         []byte
+	etag         string // of body, as served
+	upstreamETag string // for conditional upstream requests
+	fetchedAt    time.Time
+}
+
+// newJWKSProxy creates a proxy for the JWKS at upstream, refreshed every
+// refresh and served for up to maxStale after the last successful refresh
+// (0 for ever)
+func newJWKSProxy(upstream string, refresh, maxStale time.Duration, logger *slog.Logger) *jwksProxy {
+	return &jwksProxy{
+		upstream: upstream,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		refresh:  refresh,
+		maxStale: maxStale,
+		logger:   logger,
+	}
+}
+
+// run refreshes the JWKS until ctx is done, retrying failures sooner
+func (p *jwksProxy) run(ctx context.Context, retry time.Duration) {
+	for {
+		wait := p.refresh
+		if err := p.fetch(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.logger.Warn("jwks refresh failed", slog.String("url", p.upstream), slog.String("error", err.Error()))
+			wait = min(retry, p.refresh)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// fetch refreshes the cached JWKS from the upstream. A JWKS without keys
+// is rejected, so that a broken upstream cannot replace a working copy.
+func (p *jwksProxy) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.upstream, nil)
+	if err != nil {
+		return err
+	}
+	p.mu.RLock()
+	if p.upstreamETag != "" {
+		req.Header.Set("If-None-Match", p.upstreamETag)
+	}
+	p.mu.RUnlock()
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "" {
+		p.mu.Lock()
+		p.fetchedAt = time.Now()
+		p.mu.Unlock()
+		p.logger.Debug("jwks not modified", slog.String("url", p.upstream))
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxJWKSSize {
+		return errors.New("JWKS too large")
+	}
+	var jwks ghaauth.JWKS
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+	if len(jwks.Keys) == 0 {
+		return errors.New("invalid JWKS: no keys")
+	}
+
+	sum := sha256.Sum256(body)
+	p.mu.Lock()
+	changed := !bytes.Equal(body, p.body)
+	p.body = body
+	p.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	p.upstreamETag = resp.Header.Get("ETag")
+	p.fetchedAt = time.Now()
+	p.mu.Unlock()
+
+	if changed {
+		p.logger.Info("jwks refreshed", slog.String("url", p.upstream), slog.Int("keys", len(jwks.Keys)))
+	}
+	return nil
+}
+
+// current returns the JWKS to serve and its age, or nil if there is none
+// or it is older than maxStale
+func (p *jwksProxy) current() (body []byte, etag string, age time.Duration) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.body == nil {
+		return nil, "", 0
+	}
+	age = time.Since(p.fetchedAt)
+	if p.maxStale > 0 && age > p.maxStale {
+		return nil, "", 0
+	}
+	return p.body, p.etag, age
+}
+
+// handler routes the endpoints of the jwks-proxy command
+func (p *jwksProxy) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/jwks", p.serveJWKS)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		if body, _, _ := p.current(); body == nil {
+			http.Error(w, "jwks unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	return mux
+}
+
+// serveJWKS serves the cached JWKS. Clients may cache it until the next
+// refresh; conditional requests are answered with 304 Not Modified.
+func (p *jwksProxy) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	body, etag, age := p.current()
+	if body == nil {
+		http.Error(w, "jwks unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(max(p.refresh-age, 0)/time.Second)))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+	"github.com/dev-shimada/gha-auth/ghaauthtest"
+)
+
+func TestJWKSProxy(t *testing.T) {
+	gen, err := ghaauthtest.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	upstream := ghaauthtest.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer upstream.Close()
+
+	proxy := newJWKSProxy(upstream.URL()+"/.well-known/jwks", 15*time.Minute, time.Hour, slog.New(slog.DiscardHandler))
+	server := httptest.NewServer(proxy.handler())
+	defer server.Close()
+
+	get := func(path, etag string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	if resp := get("/.well-known/jwks", ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status before the first refresh = %d, want 503", resp.StatusCode)
+	}
+	if resp := get("/healthz", ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("/healthz before the first refresh = %d, want 503", resp.StatusCode)
+	}
+
+	if err := proxy.fetch(context.Background()); err != nil {
+		t.Fatalf("fetch() error = %v", err)
+	}
+
+	resp := get("/.well-known/jwks", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" {
+		t.Fatalf("status = %d, ETag = %q, want 200 with an ETag", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc == "" {
+		t.Error("Cache-Control not set")
+	}
+	if resp := get("/.well-known/jwks", resp.Header.Get("ETag")); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional status = %d, want 304", resp.StatusCode)
+	}
+
+	// Verifiers accept tokens with the proxied keys
+	verifier, err := ghaauth.New(ghaauth.WithAudience("https://api.example.com"), ghaauth.WithJWKSURL(server.URL+"/.well-known/jwks"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	token, err := gen.GenerateToken(ghaauthtest.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Errorf("Verify() error = %v with the proxied JWKS", err)
+	}
+
+	// The cached copy is served stale while the upstream is down, up to
+	// max-stale
+	upstream.Close()
+	if err := proxy.fetch(context.Background()); err == nil {
+		t.Error("fetch() error = nil with the upstream down")
+	}
+	if resp := get("/.well-known/jwks", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("stale status = %d, want 200", resp.StatusCode)
+	}
+
+	proxy.mu.Lock()
+	proxy.fetchedAt = time.Now().Add(-2 * time.Hour)
+	proxy.mu.Unlock()
+	if resp := get("/.well-known/jwks", ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status beyond max-stale = %d, want 503", resp.StatusCode)
+	}
+	if resp := get("/healthz", ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("/healthz beyond max-stale = %d, want 503", resp.StatusCode)
+	}
+}
+
+func TestJWKSProxy_InvalidUpstream(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "error status", status: http.StatusBadGateway, body: `{"keys": [{"kid": "a"}]}`},
+		{name: "not json", status: http.StatusOK, body: `<html>`},
+		{name: "no keys", status: http.StatusOK, body: `{"keys": []}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer upstream.Close()
+
+			proxy := newJWKSProxy(upstream.URL, time.Minute, 0, slog.New(slog.DiscardHandler))
+			proxy.body = []byte(`{"keys": [{"kid": "cached"}]}`)
+			if err := proxy.fetch(context.Background()); err == nil {
+				t.Fatal("fetch() error = nil")
+			}
+			if body, _, _ := proxy.current(); !bytes.Contains(body, []byte("cached")) {
+				t.Errorf("cached JWKS replaced by %s", body)
+			}
+		})
+	}
+}
+
+func TestRunJWKSProxy_Usage(t *testing.T) {
+	var stderr bytes.Buffer
+	for _, args := range [][]string{
+		{"jwks-proxy", "unexpected"},
+		{"jwks-proxy", "--refresh", "0"},
+		{"jwks-proxy", "--max-stale", "-1s"},
+	} {
+		if code := run(args, nil, io.Discard, &stderr); code != exitUsage {
+			t.Errorf("exit code = %d for %q, want %d", code, args, exitUsage)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Command gha-auth verifies GitHub Actions OIDC tokens, works with ghaauth
+// policy files from the command line and serves verification and GitHub's
+// JWKS over HTTP.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Exit codes
+const (
+	exitOK     = 0
+	exitDenied = 1
+	exitUsage  = 2
+)
+
+const usage = `Usage: gha-auth <command> [flags]
+
+Commands:
+  verify      Verify a token and print the policy decision and claims
+  policy      Generate, lint and test policy files
+  serve       Serve token verification over HTTP, e.g. as a sidecar
+  jwks-proxy  Serve a cached copy of GitHub's JWKS to internal verifiers
+
+Run "gha-auth <command> -h" for command flags.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run dispatches to the requested subcommand and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "verify":
+		return runVerify(args[1:], stdin, stdout, stderr)
+	case "policy":
+		return runPolicy(args[1:], stdin, stdout, stderr)
+	case "serve":
+		return runServe(args[1:], stderr)
+	case "jwks-proxy":
+		return runJWKSProxy(args[1:], stderr)
+	case "help", "-h", "--help":
+		_, _ = fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		_, _ = fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+}
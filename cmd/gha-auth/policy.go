@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+	"github.com/dev-shimada/gha-auth/internal/yamlutil"
+	"github.com/dev-shimada/gha-auth/policytest"
+)
+
+const policyUsage = `Usage: gha-auth policy <command> [flags]
+
+Commands:
+  init       Generate a starter policy from a token
+  lint       Check that policy files are valid and every rule can take effect
+  test       Evaluate a policy against claim fixtures
+  export     Convert a policy to an AWS trust policy, GCP attribute condition or Vault roles
+  import     Convert an AWS trust policy to a policy
+  recommend  Propose a tightened policy from recorded decisions
+  schema     Print the JSON Schema of policy documents
+`
+
+// runPolicy dispatches the "gha-auth policy" subcommands
+func runPolicy(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(stderr, policyUsage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "init":
+		return runPolicyInit(args[1:], stdin, stdout, stderr)
+	case "lint":
+		return runPolicyLint(args[1:], stdout, stderr)
+	case "test":
+		return runPolicyTest(args[1:], stdout, stderr)
+	case "export":
+		return runPolicyExport(args[1:], stdout, stderr)
+	case "import":
+		return runPolicyImport(args[1:], stdout, stderr)
+	case "recommend":
+		return runPolicyRecommend(args[1:], stdin, stdout, stderr)
+	case "schema":
+		_, _ = stdout.Write(ghaauth.PolicySchema())
+		return exitOK
+	default:
+		_, _ = fmt.Fprintf(stderr, "unknown policy command %q\n\n%s", args[0], policyUsage)
+		return exitUsage
+	}
+}
+
+// runPolicyInit implements "gha-auth policy init"
+func runPolicyInit(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("policy init", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: gha-auth policy init --from-token <token | - | @file> [flags]\n\n"+
+			"Decodes the token WITHOUT verifying it and prints a default-deny policy\n"+
+			"pinned to its repository, ref, workflow_ref and environment.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	fromToken := fs.String("from-token", "", "token to derive the policy from; \"-\" reads stdin, \"@path\" reads a file")
+	format := fs.String("format", "json", "output format: json or yaml")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if *fromToken == "" || fs.NArg() > 0 || (*format != "json" && *format != "yaml") {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var token string
+	var err error
+	if file, ok := strings.CutPrefix(*fromToken, "@"); ok {
+		token, err = readToken("", file, stdin)
+	} else {
+		token, err = readToken(*fromToken, "", stdin)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy init: %v\n", err)
+		return exitUsage
+	}
+
+	claims, err := ghaauth.ParseUnverified(token)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy init: %v\n", err)
+		return exitUsage
+	}
+
+	policy := ghaauth.NewPolicyFromClaims(claims)
+	if err := policy.Validate(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy init: %v\n", err)
+		return exitUsage
+	}
+	if err := writePolicy(stdout, policy, *format); err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy init: %v\n", err)
+		return exitDenied
+	}
+	return exitOK
+}
+
+// writePolicy prints the policy as JSON or YAML
+func writePolicy(w io.Writer, policy *ghaauth.Policy, format string) error {
+	if format != "yaml" {
+		return writeJSON(w, policy)
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if data, err = yamlutil.FromJSON(data); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// runPolicyLint implements "gha-auth policy lint"
+func runPolicyLint(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("policy lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: gha-auth policy lint [flags] <policy-file>...\n\n"+
+			"Validates each policy and reports rules that can never take effect\n"+
+			"(errors) or are broader than they should be (warnings).\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	strict := fs.Bool("strict", false, "fail on warnings too")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, path := range fs.Args() {
+		policy, err := ghaauth.LoadPolicyFile(path)
+		if err != nil {
+			_, _ = fmt.Fprintf(stdout, "%s: %v\n", path, err)
+			code = exitDenied
+			continue
+		}
+
+		failed := false
+		for _, finding := range policy.Analyze() {
+			_, _ = fmt.Fprintf(stdout, "%s: %s\n", path, finding)
+			if finding.Severity == ghaauth.SeverityError || *strict {
+				failed = true
+			}
+		}
+		if failed {
+			code = exitDenied
+			continue
+		}
+		_, _ = fmt.Fprintf(stdout, "%s: ok\n", path)
+	}
+	return code
+}
+
+// runPolicyTest implements "gha-auth policy test"
+func runPolicyTest(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: gha-auth policy test --policy <policy-file> <fixture-file>...\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	policyFile := fs.String("policy", "", "policy file to test (required)")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if *policyFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	policy, err := ghaauth.LoadPolicyFile(*policyFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy test: %v\n", err)
+		return exitUsage
+	}
+
+	passed, failed := 0, 0
+	for _, path := range fs.Args() {
+		cases, err := policytest.LoadCases(path)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "gha-auth policy test: %s: %v\n", path, err)
+			return exitUsage
+		}
+
+		for _, result := range policytest.Run(policy, cases) {
+			if result.Failure != nil {
+				failed++
+				_, _ = fmt.Fprintf(stdout, "FAIL %s: %v\n", path, result.Failure)
+				continue
+			}
+			passed++
+			_, _ = fmt.Fprintf(stdout, "PASS %s: %s\n", path, result.Case.Name)
+		}
+	}
+
+	_, _ = fmt.Fprintf(stdout, "\n%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return exitDenied
+	}
+	return exitOK
+}
+
+// runPolicyExport implements "gha-auth policy export"
+func runPolicyExport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("policy export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: gha-auth policy export --format <aws | gcp | vault> [flags] <policy-file>\n\n"+
+			"Prints an IAM role trust policy (aws), a Workload Identity attribute\n"+
+			"condition (gcp) or jwt auth roles (vault) equivalent to the policy.\n"+
+			"Warnings go to stderr.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	format := fs.String("format", "", "output format: aws, gcp or vault (required)")
+	providerARN := fs.String("provider-arn", "", "ARN of the IAM OIDC identity provider (aws)")
+	audience := fs.String("audience", "", "expected audience (aws: default "+ghaauth.DefaultAWSAudience+", vault: required)")
+	userClaim := fs.String("user-claim", "", "claim naming Vault entity aliases (vault, default repository)")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if fs.NArg() != 1 || (*format != "aws" && *format != "gcp" && *format != "vault") {
+		fs.Usage()
+		return exitUsage
+	}
+
+	policy, err := ghaauth.LoadPolicyFile(fs.Arg(0))
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy export: %v\n", err)
+		return exitUsage
+	}
+
+	var warnings []string
+	switch *format {
+	case "aws":
+		var doc *ghaauth.AWSTrustPolicy
+		doc, warnings, err = policy.ExportAWSTrustPolicy(ghaauth.AWSExportOptions{
+			ProviderARN: *providerARN,
+			Audience:    *audience,
+		})
+		if err == nil {
+			err = writeJSON(stdout, doc)
+		}
+	case "vault":
+		var roles map[string]*ghaauth.VaultRole
+		roles, warnings, err = policy.ExportVaultRoles(ghaauth.VaultExportOptions{
+			Audience:  *audience,
+			UserClaim: *userClaim,
+		})
+		if err == nil {
+			err = writeJSON(stdout, roles)
+		}
+	default:
+		var condition string
+		condition, warnings, err = policy.ExportGCPAttributeCondition()
+		if err == nil {
+			_, err = fmt.Fprintln(stdout, condition)
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy export: %v\n", err)
+		return exitDenied
+	}
+
+	for _, warning := range warnings {
+		_, _ = fmt.Fprintf(stderr, "warning: %s\n", warning)
+	}
+	return exitOK
+}
+
+// runPolicyImport implements "gha-auth policy import"
+func runPolicyImport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("policy import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: gha-auth policy import --from aws [flags] <trust-policy-file>\n\n"+
+			"Prints a policy equivalent to an IAM role trust policy. The audiences to\n"+
+			"configure and any warnings go to stderr.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	from := fs.String("from", "", "input format: aws (required)")
+	format := fs.String("format", "json", "output format: json or yaml")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if fs.NArg() != 1 || *from != "aws" || (*format != "json" && *format != "yaml") {
+		fs.Usage()
+		return exitUsage
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy import: %v\n", err)
+		return exitUsage
+	}
+
+	imported, err := ghaauth.ImportAWSTrustPolicy(data)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy import: %v\n", err)
+		return exitDenied
+	}
+
+	if err := writePolicy(stdout, imported.Policy, *format); err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy import: %v\n", err)
+		return exitDenied
+	}
+
+	if len(imported.Audiences) > 0 {
+		_, _ = fmt.Fprintf(stderr, "audiences: %s\n", strings.Join(imported.Audiences, ", "))
+	}
+	for _, warning := range imported.Warnings {
+		_, _ = fmt.Fprintf(stderr, "warning: %s\n", warning)
+	}
+	return exitOK
+}
+
+// runPolicyRecommend implements "gha-auth policy recommend"
+func runPolicyRecommend(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("policy recommend", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: gha-auth policy recommend --decisions <file | -> [flags] <policy-file>\n\n"+
+			"Prints a tightened policy that still allows every allowed decision\n"+
+			"recorded by \"gha-auth serve --decision-log\": unused allow rules and\n"+
+			"patterns are removed and wildcards narrowed to the values seen. The\n"+
+			"recommendations go to stderr.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	decisions := fs.String("decisions", "", "JSON Lines decision records; \"-\" reads stdin (required)")
+	maxValues := fs.Int("max-values", ghaauth.DefaultRecommendMaxValues, "most distinct values a wildcard pattern is narrowed to")
+	format := fs.String("format", "json", "output format: json or yaml")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if fs.NArg() != 1 || *decisions == "" || (*format != "json" && *format != "yaml") {
+		fs.Usage()
+		return exitUsage
+	}
+
+	policy, err := ghaauth.LoadPolicyFile(fs.Arg(0))
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy recommend: %v\n", err)
+		return exitUsage
+	}
+
+	in := stdin
+	if *decisions != "-" {
+		f, err := os.Open(*decisions)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "gha-auth policy recommend: %v\n", err)
+			return exitUsage
+		}
+		defer f.Close()
+		in = f
+	}
+	records, err := ghaauth.ReadDecisionRecords(in)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy recommend: %v\n", err)
+		return exitUsage
+	}
+
+	tightened, recommendations := policy.Recommend(records, ghaauth.RecommendOptions{MaxValues: *maxValues})
+	if err := writePolicy(stdout, tightened, *format); err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth policy recommend: %v\n", err)
+		return exitDenied
+	}
+
+	for _, recommendation := range recommendations {
+		_, _ = fmt.Fprintf(stderr, "recommendation: %s\n", recommendation)
+	}
+	return exitOK
+}
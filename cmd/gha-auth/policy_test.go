@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+	"github.com/dev-shimada/gha-auth/ghaauthtest"
+)
+
+// writeFile writes content to name inside dir and returns the path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestRunPolicyLint(t *testing.T) {
+	dir := t.TempDir()
+	valid := writeFile(t, dir, "valid.json", testPolicy)
+	invalid := writeFile(t, dir, "invalid.json", `{"rules": []}`)
+	shadowed := writeFile(t, dir, "shadowed.json", `{"rules": [
+		{"name": "allow-myorg", "conditions": {"repository_owner": ["myorg"]}, "effect": "allow"},
+		{"name": "deny-myorg-forks", "conditions": {"repository_owner": ["myorg"], "head_ref": ["**"]}, "effect": "deny"}
+	], "default_deny": true}`)
+	misspelled := writeFile(t, dir, "misspelled.json", `{"rules": [{"effect": "allow", "conditions": {"respository": ["myorg/*"]}}]}`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  []string
+	}{
+		{
+			name:     "valid policy",
+			args:     []string{valid},
+			wantCode: exitOK,
+			wantOut:  []string{"valid.json: ok"},
+		},
+		{
+			name:     "warnings fail in strict mode",
+			args:     []string{"--strict", valid},
+			wantCode: exitDenied,
+			wantOut:  []string{"valid.json: warning: allow-myorg: allow rule constrains neither ref nor environment"},
+		},
+		{
+			name:     "invalid policy",
+			args:     []string{valid, invalid},
+			wantCode: exitDenied,
+			wantOut:  []string{"valid.json: ok", "invalid.json: policy error"},
+		},
+		{
+			name:     "shadowed rule",
+			args:     []string{shadowed},
+			wantCode: exitDenied,
+			wantOut:  []string{`shadowed.json: error: deny-myorg-forks: rule "allow-myorg" matches every token this rule matches and takes precedence (shadowed-rule)`},
+		},
+		{
+			name:     "misspelled condition",
+			args:     []string{misspelled},
+			wantCode: exitDenied,
+			wantOut:  []string{`/rules/0/conditions/respository: unknown field "respository" (did you mean "repository"?)`},
+		},
+		{
+			name:     "no files",
+			args:     nil,
+			wantCode: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"policy", "lint"}, tt.args...), strings.NewReader(""), &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Errorf("run() = %d, want %d", code, tt.wantCode)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunPolicySchema(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"policy", "schema"}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("run() = %d, want %d", code, exitOK)
+	}
+	if !bytes.Equal(stdout.Bytes(), ghaauth.PolicySchema()) {
+		t.Errorf("output = %q, want PolicySchema()", stdout.String())
+	}
+}
+
+func TestRunPolicyTest(t *testing.T) {
+	dir := t.TempDir()
+	policy := writeFile(t, dir, "policy.json", testPolicy)
+
+	passing := writeFile(t, dir, "passing.yaml", `
+cases:
+  - name: org repository is allowed
+    claims:
+      repository: myorg/myrepo
+      repository_owner: myorg
+    expect: allow
+    rule: allow-myorg
+  - name: other org is denied
+    claims:
+      repository: otherorg/repo
+      repository_owner: otherorg
+    expect: deny
+`)
+
+	failing := writeFile(t, dir, "failing.json", `{
+		"cases": [
+			{
+				"name": "other org expected to be allowed",
+				"claims": {"repository_owner": "otherorg"},
+				"expect": "allow"
+			},
+			{
+				"name": "wrong rule",
+				"claims": {"repository_owner": "myorg"},
+				"expect": "allow",
+				"rule": "some-other-rule"
+			}
+		]
+	}`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  []string
+	}{
+		{
+			name:     "passing fixtures",
+			args:     []string{"--policy", policy, passing},
+			wantCode: exitOK,
+			wantOut:  []string{"PASS", "2 passed, 0 failed"},
+		},
+		{
+			name:     "failing fixtures",
+			args:     []string{"--policy", policy, passing, failing},
+			wantCode: exitDenied,
+			wantOut: []string{
+				"FAIL " + failing + ": other org expected to be allowed: got deny",
+				`matched rule "allow-myorg", want "some-other-rule"`,
+				"2 passed, 2 failed",
+			},
+		},
+		{
+			name:     "missing policy flag",
+			args:     []string{passing},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "missing fixture file",
+			args:     []string{"--policy", policy, filepath.Join(dir, "missing.yaml")},
+			wantCode: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"policy", "test"}, tt.args...), strings.NewReader(""), &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Errorf("run() = %d, want %d (stderr: %s)", code, tt.wantCode, stderr.String())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunPolicyInit(t *testing.T) {
+	gen, err := ghaauthtest.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	claims := ghaauthtest.DefaultClaims()
+	claims.Environment = "production"
+	token, err := gen.GenerateToken(claims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tokenPath := writeFile(t, t.TempDir(), "token", token)
+
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		wantCode int
+		wantOut  []string
+	}{
+		{
+			name:     "json from argument",
+			args:     []string{"--from-token", token},
+			wantCode: exitOK,
+			wantOut: []string{
+				`"name": "allow-myorg/myrepo"`,
+				`"myorg/myrepo/.github/workflows/ci.yml@refs/heads/main"`,
+				`"production"`,
+				`"default_deny": true`,
+			},
+		},
+		{
+			name:     "yaml from stdin",
+			args:     []string{"--from-token", "-", "--format", "yaml"},
+			stdin:    token,
+			wantCode: exitOK,
+			wantOut:  []string{"default_deny: true", "- refs/heads/main"},
+		},
+		{
+			name:     "from file",
+			args:     []string{"--from-token", "@" + tokenPath},
+			wantCode: exitOK,
+			wantOut:  []string{`"refs/heads/main"`},
+		},
+		{
+			name:     "invalid token",
+			args:     []string{"--from-token", "not-a-token"},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "unknown format",
+			args:     []string{"--from-token", token, "--format", "xml"},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "missing token",
+			wantCode: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"policy", "init"}, tt.args...), strings.NewReader(tt.stdin), &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Fatalf("run() = %d, want %d (stderr: %s)", code, tt.wantCode, stderr.String())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+		})
+	}
+
+	t.Run("output is a valid policy", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if code := run([]string{"policy", "init", "--from-token", token}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+			t.Fatalf("run() = %d (stderr: %s)", code, stderr.String())
+		}
+		if _, err := ghaauth.ParsePolicy(stdout.Bytes()); err != nil {
+			t.Errorf("ParsePolicy() error = %v", err)
+		}
+	})
+}
+
+func TestRunPolicyExport(t *testing.T) {
+	dir := t.TempDir()
+	policyFile := writeFile(t, dir, "policy.yaml", `
+default_deny: true
+rules:
+  - name: deploy
+    conditions:
+      repository: [myorg/api]
+      environment: [production]
+    effect: allow
+`)
+	actorFile := writeFile(t, dir, "actor.yaml", `
+default_deny: true
+rules:
+  - conditions:
+      actor: [johndoe]
+    effect: allow
+`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  []string
+	}{
+		{
+			name:     "aws",
+			args:     []string{"--format", "aws", "--provider-arn", "arn:aws:iam::123456789012:oidc-provider/token.actions.githubusercontent.com", policyFile},
+			wantCode: exitOK,
+			wantOut: []string{
+				`"arn:aws:iam::123456789012:oidc-provider/token.actions.githubusercontent.com"`,
+				`"repo:myorg/api:environment:production"`,
+				`"sts.amazonaws.com"`,
+			},
+		},
+		{
+			name:     "gcp",
+			args:     []string{"--format", "gcp", policyFile},
+			wantCode: exitOK,
+			wantOut:  []string{`assertion.repository == "myorg/api"`},
+		},
+		{
+			name:     "vault",
+			args:     []string{"--format", "vault", "--audience", "https://vault.example.com", policyFile},
+			wantCode: exitOK,
+			wantOut:  []string{`"deploy": {`, `"bound_audiences": [`, `"environment": [`},
+		},
+		{
+			name:     "vault without audience",
+			args:     []string{"--format", "vault", policyFile},
+			wantCode: exitDenied,
+		},
+		{
+			name:     "not expressible",
+			args:     []string{"--format", "aws", actorFile},
+			wantCode: exitDenied,
+		},
+		{
+			name:     "unknown format",
+			args:     []string{"--format", "azure", policyFile},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "missing policy file",
+			args:     []string{"--format", "gcp"},
+			wantCode: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"policy", "export"}, tt.args...), strings.NewReader(""), &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Fatalf("run() = %d, want %d (stderr: %s)", code, tt.wantCode, stderr.String())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunPolicyImport(t *testing.T) {
+	dir := t.TempDir()
+	trustPolicy := writeFile(t, dir, "trust-policy.json", `{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Principal": {"Federated": "arn:aws:iam::123456789012:oidc-provider/token.actions.githubusercontent.com"},
+    "Action": "sts:AssumeRoleWithWebIdentity",
+    "Condition": {
+      "StringEquals": {"token.actions.githubusercontent.com:aud": "sts.amazonaws.com"},
+      "StringLike": {"token.actions.githubusercontent.com:sub": "repo:myorg/api:ref:refs/heads/main"}
+    }
+  }]
+}`)
+	invalid := writeFile(t, dir, "invalid.json", `{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+  "Principal": {"Federated": "arn:aws:iam::1:oidc-provider/token.actions.githubusercontent.com"},
+  "Condition": {"StringNotLike": {"token.actions.githubusercontent.com:sub": "repo:x/y:*"}}}}`)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantOut    []string
+		wantStderr string
+	}{
+		{
+			name:       "json",
+			args:       []string{"--from", "aws", trustPolicy},
+			wantCode:   exitOK,
+			wantOut:    []string{`"myorg/api"`, `"refs/heads/main"`, `"evaluation_mode": "deny-overrides"`},
+			wantStderr: "audiences: sts.amazonaws.com",
+		},
+		{
+			name:     "yaml",
+			args:     []string{"--from", "aws", "--format", "yaml", trustPolicy},
+			wantCode: exitOK,
+			wantOut:  []string{"default_deny: true"},
+		},
+		{
+			name:     "not importable",
+			args:     []string{"--from", "aws", invalid},
+			wantCode: exitDenied,
+		},
+		{
+			name:     "missing from",
+			args:     []string{trustPolicy},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "missing file",
+			args:     []string{"--from", "aws", filepath.Join(dir, "missing.json")},
+			wantCode: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"policy", "import"}, tt.args...), strings.NewReader(""), &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Fatalf("run() = %d, want %d (stderr: %s)", code, tt.wantCode, stderr.String())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestRunPolicyRecommend(t *testing.T) {
+	dir := t.TempDir()
+	policy := writeFile(t, dir, "policy.yaml", `
+default_deny: true
+rules:
+  - name: deploy
+    conditions:
+      repository: ["myorg/*"]
+      event_name: [push, schedule]
+    effect: allow
+`)
+	decisions := `{"time":"2026-10-01T00:00:00Z","allowed":true,"claims":{"repository":"myorg/api","ref":"refs/heads/main","event_name":"push"}}
+{"time":"2026-10-01T00:01:00Z","allowed":false,"claims":{"repository":"other/api","event_name":"push"}}
+`
+	decisionsFile := writeFile(t, dir, "decisions.jsonl", decisions)
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantCode   int
+		wantOut    []string
+		wantStderr string
+	}{
+		{
+			name:       "file",
+			args:       []string{"--decisions", decisionsFile, policy},
+			wantCode:   exitOK,
+			wantOut:    []string{`"myorg/api"`, `"push"`},
+			wantStderr: `recommendation: deploy: event_name: pattern "schedule" matched no recorded token`,
+		},
+		{
+			name:     "stdin as yaml",
+			args:     []string{"--decisions", "-", "--format", "yaml", policy},
+			stdin:    decisions,
+			wantCode: exitOK,
+			wantOut:  []string{"- myorg/api"},
+		},
+		{
+			name:     "invalid records",
+			args:     []string{"--decisions", "-", policy},
+			stdin:    "not json",
+			wantCode: exitUsage,
+		},
+		{
+			name:     "missing decisions",
+			args:     []string{policy},
+			wantCode: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"policy", "recommend"}, tt.args...), strings.NewReader(tt.stdin), &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Fatalf("run() = %d, want %d (stderr: %s)", code, tt.wantCode, stderr.String())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
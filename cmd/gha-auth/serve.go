@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// runServe implements "gha-auth serve"
+func runServe(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: gha-auth serve [flags]\n\n"+
+			"Serves token verification over HTTP, e.g. as a sidecar, Envoy ext_authz\n"+
+			"service or forward authentication endpoint of Traefik, Caddy or nginx:\n"+
+			"  /verify      verifies the request's bearer token: 200 with X-GHA-*\n"+
+			"               headers, 401 or 403 with problem details\n"+
+			"  /introspect  RFC 7662 token introspection\n"+
+			"  /tokenreview Kubernetes webhook token authentication\n"+
+			"  /healthz     200 once signing keys are available, 503 before\n\n"+
+			"Flags:\n")
+		fs.PrintDefaults()
+	}
+
+	addr := fs.String("addr", ":8080", "listen `address`")
+	configFile := fs.String("config", "", "verifier configuration file (JSON or YAML)")
+	policyFile := fs.String("policy", "", "policy file, reloaded when it changes")
+	audience := fs.String("audience", "", "expected audience claim")
+	jwksURL := fs.String("jwks-url", "", "JWKS endpoint used to verify signatures (default GitHub's)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 10*time.Second, "how long to wait for requests in flight on shutdown")
+	decisionLog := fs.String("decision-log", "", "`file` to append verification decisions to, for \"gha-auth policy recommend\"")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	logger := slog.New(slog.NewJSONHandler(stderr, nil))
+
+	var extra []ghaauth.Option
+	if *decisionLog != "" {
+		f, err := os.OpenFile(*decisionLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "gha-auth serve: %v\n", err)
+			return exitUsage
+		}
+		// Records are written by the request handlers, which have finished
+		// when serve returns, unless the shutdown timed out
+		defer f.Close()
+		extra = append(extra, ghaauth.WithDecisionLog(f))
+	}
+
+	verifier, closePolicy, err := newServeVerifier(*configFile, *policyFile, *audience, *jwksURL, logger, extra...)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth serve: %v\n", err)
+		return exitUsage
+	}
+	defer closePolicy()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := verifier.Prime(ctx); err != nil {
+		logger.Warn("signing keys not available yet", slog.String("error", err.Error()))
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth serve: %v\n", err)
+		return exitUsage
+	}
+
+	if err := serve(ctx, listener, newServeHandler(verifier), *shutdownTimeout, logger); err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth serve: %v\n", err)
+		return exitDenied
+	}
+	return exitOK
+}
+
+// newServeVerifier builds the verifier from the configuration file and
+// flags. Flags take precedence over the file; a policy file given with
+// --policy is watched and reloaded, and must be signed if the file sets
+// policy_signature_key; extra options are applied last. The returned
+// function stops watching.
+func newServeVerifier(configFile, policyFile, audience, jwksURL string, logger *slog.Logger, extra ...ghaauth.Option) (*ghaauth.Verifier, func(), error) {
+	cfg := &ghaauth.Config{}
+	if configFile != "" {
+		var err error
+		if cfg, err = ghaauth.LoadConfigFile(configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	if audience != "" {
+		cfg.Audience = audience
+		cfg.AudienceTemplate = ""
+	}
+	if jwksURL != "" {
+		cfg.JWKSURL = jwksURL
+	}
+
+	opts := []ghaauth.Option{ghaauth.WithLogger(logger), ghaauth.WithRequirePolicy()}
+	closePolicy := func() {}
+	if policyFile != "" {
+		if cfg.Policy != nil || cfg.PolicyFile != "" {
+			return nil, nil, errors.New("--policy cannot be combined with a policy in the configuration file")
+		}
+		fileOpts := []ghaauth.FilePolicyOption{ghaauth.WithReloadLogger(logger)}
+		verify, err := cfg.PolicySignatureVerifier()
+		if err != nil {
+			return nil, nil, err
+		}
+		if verify != nil {
+			fileOpts = append(fileOpts, ghaauth.WithPolicySignature(verify))
+		}
+		provider, err := ghaauth.NewFilePolicyProvider(policyFile, fileOpts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, ghaauth.WithPolicyProvider(provider))
+		closePolicy = func() { _ = provider.Close() }
+	}
+
+	verifier, err := ghaauth.NewFromConfig(cfg, append(opts, extra...)...)
+	if err != nil {
+		closePolicy()
+		return nil, nil, err
+	}
+	return verifier, closePolicy, nil
+}
+
+// newServeHandler routes the endpoints of the serve command
+func newServeHandler(verifier *ghaauth.Verifier) http.Handler {
+	verify := ghaauth.ForwardAuthHandler(verifier, ghaauth.WithErrorHandler(ghaauth.ProblemErrorHandler))
+
+	mux := http.NewServeMux()
+	// Envoy's ext_authz appends the original path to its path prefix
+	mux.Handle("/verify", verify)
+	mux.Handle("/verify/", verify)
+	mux.Handle("/introspect", ghaauth.IntrospectionHandler(verifier))
+	mux.Handle("/tokenreview", ghaauth.TokenReviewHandler(verifier))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		if !verifier.Healthy() {
+			http.Error(w, "signing keys unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	return mux
+}
+
+// serve runs the server until ctx is done, then shuts it down gracefully
+func serve(ctx context.Context, listener net.Listener, handler http.Handler, shutdownTimeout time.Duration, logger *slog.Logger) error {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve(listener)
+	}()
+	logger.Info("serving", slog.String("addr", listener.Addr().String()))
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+	"github.com/dev-shimada/gha-auth/ghaauthtest"
+)
+
+func TestServeHandler(t *testing.T) {
+	gen, err := ghaauthtest.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := ghaauthtest.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policyPath, []byte(testPolicy), 0o600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+
+	verifier, closePolicy, err := newServeVerifier("", policyPath, "https://api.example.com", server.URL()+"/.well-known/jwks", slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("newServeVerifier() error = %v", err)
+	}
+	defer closePolicy()
+	handler := newServeHandler(verifier)
+
+	token, err := gen.GenerateToken(ghaauthtest.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	deniedClaims := ghaauthtest.DefaultClaims()
+	deniedClaims.RepositoryOwner = "otherorg"
+	deniedToken, err := gen.GenerateToken(deniedClaims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	verifyRequest := func(path, token string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req
+	}
+
+	if rec := do(httptest.NewRequest(http.MethodGet, "/healthz", nil)); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/healthz before priming = %d, want 503", rec.Code)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "allowed", path: "/verify", token: token, wantStatus: http.StatusOK},
+		{name: "ext_authz path prefix", path: "/verify/api/deploy", token: token, wantStatus: http.StatusOK},
+		{name: "denied", path: "/verify", token: deniedToken, wantStatus: http.StatusForbidden},
+		{name: "missing token", path: "/verify", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(verifyRequest(tt.path, tt.token))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				if got := rec.Header().Get(ghaauth.HeaderRepository); got != "myorg/myrepo" {
+					t.Errorf("%s = %q, want myorg/myrepo", ghaauth.HeaderRepository, got)
+				}
+				if got := rec.Header().Get(ghaauth.HeaderMatchedRule); got != "allow-myorg" {
+					t.Errorf("%s = %q, want allow-myorg", ghaauth.HeaderMatchedRule, got)
+				}
+			} else if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want problem details", ct)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := do(req)
+	var introspection struct {
+		Active bool `json:"active"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &introspection); err != nil || !introspection.Active {
+		t.Errorf("/introspect = %d %s, want active token", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/tokenreview", strings.NewReader(`{"kind": "TokenReview", "spec": {"token": "`+token+`"}}`))
+	rec = do(req)
+	var tokenReview struct {
+		Status struct {
+			Authenticated bool `json:"authenticated"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokenReview); err != nil || !tokenReview.Status.Authenticated {
+		t.Errorf("/tokenreview = %d %s, want authenticated token", rec.Code, rec.Body)
+	}
+
+	if rec := do(httptest.NewRequest(http.MethodGet, "/healthz", nil)); rec.Code != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", rec.Code)
+	}
+}
+
+func TestNewServeVerifier(t *testing.T) {
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(policyPath, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte("audience: https://api.example.com\npolicy_file: "+policyPath+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	if _, closePolicy, err := newServeVerifier(configPath, "", "", "", logger); err != nil {
+		t.Errorf("newServeVerifier() error = %v with a configuration file", err)
+	} else {
+		closePolicy()
+	}
+
+	for name, args := range map[string][]string{
+		"no policy":      {"", "", "", ""},
+		"two policies":   {configPath, policyPath, "", ""},
+		"missing config": {filepath.Join(dir, "missing.yaml"), "", "", ""},
+		"missing policy": {"", filepath.Join(dir, "missing.json"), "", ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := newServeVerifier(args[0], args[1], args[2], args[3], logger); err == nil {
+				t.Error("newServeVerifier() error = nil")
+			}
+		})
+	}
+}
+
+func TestNewServeVerifier_PolicySignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	keyPath := writeFile(t, dir, "policy.pub", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	configPath := writeFile(t, dir, "config.yaml", "audience: https://api.example.com\npolicy_signature_key: "+keyPath+"\n")
+	policyPath := writeFile(t, dir, "policy.json", testPolicy)
+
+	logger := slog.New(slog.DiscardHandler)
+	if _, _, err := newServeVerifier(configPath, policyPath, "", "", logger); !errors.Is(err, ghaauth.ErrPolicySignature) {
+		t.Fatalf("newServeVerifier() error = %v, want ErrPolicySignature for an unsigned --policy", err)
+	}
+
+	writeFile(t, dir, "policy.json"+ghaauth.PolicySignatureSuffix, string(ed25519.Sign(priv, []byte(testPolicy))))
+	_, closePolicy, err := newServeVerifier(configPath, policyPath, "", "", logger)
+	if err != nil {
+		t.Fatalf("newServeVerifier() error = %v for a signed --policy", err)
+	}
+	closePolicy()
+}
+
+func TestServe_Shutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = io.WriteString(w, "ok") })
+	go func() {
+		done <- serve(ctx, listener, handler, time.Second, slog.New(slog.DiscardHandler))
+	}()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve() did not return after cancellation")
+	}
+}
+
+func TestRunServe_Usage(t *testing.T) {
+	var stderr bytes.Buffer
+	if code := run([]string{"serve", "unexpected"}, nil, io.Discard, &stderr); code != exitUsage {
+		t.Errorf("exit code = %d, want %d", code, exitUsage)
+	}
+	if code := run([]string{"serve", "--policy", filepath.Join(t.TempDir(), "missing.json")}, nil, io.Discard, &stderr); code != exitUsage {
+		t.Errorf("exit code = %d, want %d for a missing policy", code, exitUsage)
+	}
+}
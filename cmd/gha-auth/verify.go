@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// verifyOutput is the JSON document printed by the verify command
+type verifyOutput struct {
+	Allowed       bool                         `json:"allowed"`
+	MatchedRule   string                       `json:"matched_rule,omitempty"`
+	Reason        string                       `json:"reason,omitempty"`
+	PolicyVersion string                       `json:"policy_version,omitempty"`
+	Error         string                       `json:"error,omitempty"`
+	Claims        *ghaauth.GitHubActionsClaims `json:"claims,omitempty"`
+}
+
+// runVerify implements "gha-auth verify"
+func runVerify(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(stderr, "Usage: gha-auth verify [flags] [token | -]\n\n"+
+			"Reads the token from the argument, --token-file, or stdin.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	tokenFile := fs.String("token-file", "", "read the token from `path`")
+	policyFile := fs.String("policy", "", "policy file to evaluate the token against")
+	audience := fs.String("audience", "", "expected audience claim")
+	jwksURL := fs.String("jwks-url", ghaauth.DefaultJWKSURL, "JWKS endpoint used to verify the signature")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for fetching the JWKS")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	token, err := readToken(fs.Arg(0), *tokenFile, stdin)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth verify: %v\n", err)
+		return exitUsage
+	}
+
+	var policy *ghaauth.Policy
+	if *policyFile != "" {
+		policy, err = ghaauth.LoadPolicyFile(*policyFile)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "gha-auth verify: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	// Verify without a policy so that the claims are available even when the
+	// policy denies access, then evaluate the policy separately
+	opts := []ghaauth.Option{ghaauth.WithJWKSURL(*jwksURL)}
+	if *audience != "" {
+		opts = append(opts, ghaauth.WithAudience(*audience))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var out verifyOutput
+	result, err := ghaauth.VerifyToken(ctx, token, opts...)
+	if err != nil {
+		out.Error = err.Error()
+	} else {
+		decision := policy.Evaluate(result.Claims)
+		out.Allowed = decision.Allowed
+		out.MatchedRule = decision.MatchedRule
+		out.Reason = decision.Reason
+		out.PolicyVersion = decision.PolicyVersion
+		out.Claims = result.Claims
+	}
+
+	if err := writeJSON(stdout, out); err != nil {
+		_, _ = fmt.Fprintf(stderr, "gha-auth verify: %v\n", err)
+		return exitDenied
+	}
+
+	if !out.Allowed {
+		return exitDenied
+	}
+	return exitOK
+}
+
+// readToken returns the token from the argument, file, or stdin, in that
+// order of preference
+func readToken(arg, file string, stdin io.Reader) (string, error) {
+	if arg != "" && file != "" {
+		return "", errors.New("pass the token either as an argument or with --token-file, not both")
+	}
+
+	var data []byte
+	var err error
+	switch {
+	case arg != "" && arg != "-":
+		data = []byte(arg)
+	case file != "":
+		data, err = os.ReadFile(file)
+	default:
+		data, err = io.ReadAll(stdin)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("no token provided")
+	}
+	return token, nil
+}
+
+// writeJSON prints v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
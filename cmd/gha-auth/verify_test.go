@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/ghaauthtest"
+)
+
+const testPolicy = `{
+	"rules": [
+		{
+			"name": "allow-myorg",
+			"conditions": {"repository_owner": ["myorg"]},
+			"effect": "allow"
+		}
+	],
+	"default_deny": true
+}`
+
+func TestRunVerify(t *testing.T) {
+	gen, err := ghaauthtest.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := ghaauthtest.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	jwksURL := server.URL() + "/.well-known/jwks"
+
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(policyPath, []byte(testPolicy), 0o600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+
+	token, err := gen.GenerateToken(ghaauthtest.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	deniedClaims := ghaauthtest.DefaultClaims()
+	deniedClaims.RepositoryOwner = "otherorg"
+	deniedToken, err := gen.GenerateToken(deniedClaims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte(token+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write token: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		stdin       string
+		wantCode    int
+		wantAllowed bool
+		wantRule    string
+		wantError   bool
+	}{
+		{
+			name:        "token argument allowed",
+			args:        []string{"--policy", policyPath, "--jwks-url", jwksURL, token},
+			wantCode:    exitOK,
+			wantAllowed: true,
+			wantRule:    "allow-myorg",
+		},
+		{
+			name:        "token from file",
+			args:        []string{"--policy", policyPath, "--jwks-url", jwksURL, "--token-file", tokenPath},
+			wantCode:    exitOK,
+			wantAllowed: true,
+			wantRule:    "allow-myorg",
+		},
+		{
+			name:        "token from stdin",
+			args:        []string{"--policy", policyPath, "--jwks-url", jwksURL},
+			stdin:       token,
+			wantCode:    exitOK,
+			wantAllowed: true,
+			wantRule:    "allow-myorg",
+		},
+		{
+			name:     "denied by policy",
+			args:     []string{"--policy", policyPath, "--jwks-url", jwksURL, deniedToken},
+			wantCode: exitDenied,
+		},
+		{
+			name:      "audience mismatch",
+			args:      []string{"--audience", "https://other.example.com", "--jwks-url", jwksURL, token},
+			wantCode:  exitDenied,
+			wantError: true,
+		},
+		{
+			name:        "no policy",
+			args:        []string{"--jwks-url", jwksURL, token},
+			wantCode:    exitOK,
+			wantAllowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := runVerify(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("runVerify() = %d, want %d (stderr: %s)", code, tt.wantCode, stderr.String())
+			}
+
+			var out verifyOutput
+			if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+				t.Fatalf("failed to decode output %q: %v", stdout.String(), err)
+			}
+
+			if out.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %v, want %v", out.Allowed, tt.wantAllowed)
+			}
+			if out.MatchedRule != tt.wantRule {
+				t.Errorf("matched_rule = %q, want %q", out.MatchedRule, tt.wantRule)
+			}
+			if (out.Error != "") != tt.wantError {
+				t.Errorf("error = %q, wantError %v", out.Error, tt.wantError)
+			}
+			if !tt.wantError && out.Claims == nil {
+				t.Error("claims missing from output")
+			}
+		})
+	}
+}
+
+func TestRunVerify_Usage(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+	}{
+		{name: "empty stdin", args: nil},
+		{name: "argument and file", args: []string{"--token-file", "token", "abc"}},
+		{name: "missing policy file", args: []string{"--policy", "missing.json", "abc"}},
+		{name: "unknown flag", args: []string{"--nope"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runVerify(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr); code != exitUsage {
+				t.Errorf("runVerify() = %d, want %d", code, exitUsage)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package ghaauth
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// CompiledPolicy is a Policy with its patterns pre-parsed for fast
+// evaluation. It gives the same results as Policy.Evaluate. The Verifier
+// compiles its policies automatically.
+type CompiledPolicy struct {
+	policy *Policy
+	source *Policy // the policy Compile was called on, before WithRuleTags
+	rules  []compiledRule
+	order  []int
+}
+
+// CompileOption configures Policy.Compile
+type CompileOption func(*compileConfig)
+
+// compileConfig holds the settings of one Compile call
+type compileConfig struct {
+	matchCacheSize int
+	tags           []string
+}
+
+// WithMatchCache memoizes the results of the policy's wildcard and regular
+// expression patterns in an LRU cache of up to size pattern and value
+// pairs. Literal and prefix patterns are cheaper to match than to look up
+// and are never cached. It pays off for services evaluating a few complex
+// patterns against the same claims over and over; see
+// BenchmarkCompiledPolicy_MatchCache.
+func WithMatchCache(size int) CompileOption {
+	return func(c *compileConfig) {
+		c.matchCacheSize = size
+	}
+}
+
+// compiledRule holds the compiled conditions of a rule
+type compiledRule struct {
+	rule       Rule
+	reason     string // the result reason, built once
+	conditions []compiledCondition
+	numeric    bool // whether the rule has numeric bounds
+	lists      bool // whether the rule has list conditions
+	window     bool // whether the rule has a validity window
+	plugins    bool // whether the rule has plugin conditions
+}
+
+// compiledCondition matches one claim against compiled patterns
+type compiledCondition struct {
+	claim    func(*GitHubActionsClaims) string
+	optional bool
+	patterns patternSet
+}
+
+// conditionClaims maps each condition to the claim it matches. Optional
+// claims are only present for some events, so an empty value never matches.
+var conditionClaims = []struct {
+	name     string
+	patterns func(*Conditions) []string
+	claim    func(*GitHubActionsClaims) string
+	optional bool
+}{
+	{"repository", func(c *Conditions) []string { return c.Repository }, func(c *GitHubActionsClaims) string { return c.Repository }, false},
+	{"repository_owner", func(c *Conditions) []string { return c.RepositoryOwner }, func(c *GitHubActionsClaims) string { return c.RepositoryOwner }, false},
+	{"repository_visibility", func(c *Conditions) []string { return c.RepositoryVisibility }, func(c *GitHubActionsClaims) string { return c.RepositoryVisibility }, false},
+	{"ref", func(c *Conditions) []string { return c.Ref }, func(c *GitHubActionsClaims) string { return c.Ref }, false},
+	{"ref_type", func(c *Conditions) []string { return c.RefType }, func(c *GitHubActionsClaims) string { return c.RefType }, false},
+	{"head_ref", func(c *Conditions) []string { return c.HeadRef }, func(c *GitHubActionsClaims) string { return c.HeadRef }, true},
+	{"base_ref", func(c *Conditions) []string { return c.BaseRef }, func(c *GitHubActionsClaims) string { return c.BaseRef }, true},
+	{"workflow", func(c *Conditions) []string { return c.Workflow }, func(c *GitHubActionsClaims) string { return c.Workflow }, false},
+	{"workflow_ref", func(c *Conditions) []string { return c.WorkflowRef }, func(c *GitHubActionsClaims) string { return c.WorkflowRef }, false},
+	{"job_workflow_ref", func(c *Conditions) []string { return c.JobWorkflowRef }, func(c *GitHubActionsClaims) string { return c.JobWorkflowRef }, false},
+	{"job_workflow_sha", func(c *Conditions) []string { return c.JobWorkflowSHA }, func(c *GitHubActionsClaims) string { return c.JobWorkflowSHA }, false},
+	{"event_name", func(c *Conditions) []string { return c.EventName }, func(c *GitHubActionsClaims) string { return c.EventName }, false},
+	{"actor", func(c *Conditions) []string { return c.Actor }, func(c *GitHubActionsClaims) string { return c.Actor }, false},
+	{"environment", func(c *Conditions) []string { return c.Environment }, func(c *GitHubActionsClaims) string { return c.Environment }, true},
+	{"runner_environment", func(c *Conditions) []string { return c.RunnerEnvironment }, func(c *GitHubActionsClaims) string { return c.RunnerEnvironment }, false},
+}
+
+// conditionLists maps each condition on a list of values looked up by a
+// GitHubEnricher to those values. The condition matches if any value
+// matches one of its patterns.
+var conditionLists = []struct {
+	name     string
+	patterns func(*Conditions) []string
+	values   func(*GitHubActionsClaims) []string
+}{
+	{"repository_topic", func(c *Conditions) []string { return c.RepositoryTopic }, func(c *GitHubActionsClaims) []string { return c.RepositoryTopics }},
+}
+
+// conditionPatterns returns the patterns of every condition, with those of
+// the custom properties in sorted name order
+func conditionPatterns(cond *Conditions) [][]string {
+	var all [][]string
+	for _, cc := range conditionClaims {
+		all = append(all, cc.patterns(cond))
+	}
+	for _, cl := range conditionLists {
+		all = append(all, cl.patterns(cond))
+	}
+	for _, name := range slices.Sorted(maps.Keys(cond.CustomProperties)) {
+		all = append(all, cond.CustomProperties[name])
+	}
+	for _, name := range slices.Sorted(maps.Keys(cond.Inputs)) {
+		all = append(all, cond.Inputs[name])
+	}
+	return all
+}
+
+// hasLists reports whether any condition on enriched values or inputs is
+// set
+func hasLists(cond Conditions) bool {
+	return len(cond.RepositoryTopic) > 0 || len(cond.CustomProperties) > 0 || len(cond.Inputs) > 0
+}
+
+// listMismatch returns the name of the first condition on enriched values
+// or inputs that the claims do not satisfy, or "" if all are satisfied
+func listMismatch(cond Conditions, claims *GitHubActionsClaims) string {
+	for _, cl := range conditionLists {
+		patterns := cl.patterns(&cond)
+		if len(patterns) > 0 && !anyValueMatches(patterns, cl.values(claims)) {
+			return cl.name
+		}
+	}
+	for name, patterns := range cond.CustomProperties {
+		if !anyValueMatches(patterns, claims.RepositoryProperties[name]) {
+			return "custom_properties"
+		}
+	}
+	if inputsMismatch(cond.Inputs, claims.Inputs) {
+		return "inputs"
+	}
+	return ""
+}
+
+// anyValueMatches reports whether any value matches one of the patterns
+func anyValueMatches(patterns, values []string) bool {
+	return slices.ContainsFunc(values, func(v string) bool { return MatchAny(patterns, v) })
+}
+
+// Compile pre-parses the policy's patterns. The policy must not be modified
+// afterwards. A nil policy compiles to one that allows everything.
+func (p *Policy) Compile(opts ...CompileOption) *CompiledPolicy {
+	var cfg compileConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	compiled := &CompiledPolicy{policy: p, source: p}
+	if p == nil {
+		return compiled
+	}
+	if len(cfg.tags) > 0 {
+		p = p.Filter(cfg.tags...)
+		compiled.policy = p
+	}
+	var cache *matchCache
+	if cfg.matchCacheSize > 0 {
+		cache = newMatchCache(cfg.matchCacheSize)
+	}
+
+	compiled.rules = make([]compiledRule, 0, len(p.Rules))
+	for _, rule := range p.Rules {
+		cr := compiledRule{rule: rule, reason: ruleReason(rule), numeric: hasBounds(rule.Conditions), lists: hasLists(rule.Conditions), window: rule.hasWindow(), plugins: len(rule.Conditions.Plugin) > 0}
+		for _, cc := range conditionClaims {
+			patterns := cc.patterns(&rule.Conditions)
+			if len(patterns) == 0 {
+				continue
+			}
+			cr.conditions = append(cr.conditions, compiledCondition{
+				claim:    cc.claim,
+				optional: cc.optional,
+				patterns: compilePatterns(patterns).withCache(cache),
+			})
+		}
+		compiled.rules = append(compiled.rules, cr)
+	}
+	compiled.order = p.ruleOrder()
+
+	return compiled
+}
+
+// hasBounds reports whether any numeric bound is set
+func hasBounds(cond Conditions) bool {
+	return cond.RunAttemptMin != 0 || cond.RunAttemptMax != 0 ||
+		cond.RunNumberMin != 0 || cond.RunNumberMax != 0
+}
+
+// Policy returns the policy that was compiled
+func (c *CompiledPolicy) Policy() *Policy {
+	return c.policy
+}
+
+// Evaluate evaluates the policy against the given claims at the current
+// time
+func (c *CompiledPolicy) Evaluate(claims *GitHubActionsClaims) *EvaluationResult {
+	return c.EvaluateAt(claims, time.Now())
+}
+
+// EvaluateAt evaluates the policy against the given claims as of now (see
+// Policy.EvaluateAt)
+func (c *CompiledPolicy) EvaluateAt(claims *GitHubActionsClaims, now time.Time) *EvaluationResult {
+	result := c.evaluate(claims, now)
+	result.PolicyVersion = c.policy.Version()
+	return result
+}
+
+// evaluate is EvaluateAt without the policy version
+func (c *CompiledPolicy) evaluate(claims *GitHubActionsClaims, now time.Time) *EvaluationResult {
+	if c.policy == nil {
+		return c.policy.evaluate(claims, now)
+	}
+
+	if c.policy.deniesFork(claims) {
+		return forkResult()
+	}
+	if c.policy.deniesUnscoped(claims) {
+		return environmentScopeResult()
+	}
+
+	i := c.policy.decide(c.order, func(i int) bool {
+		return c.rules[i].matches(claims, now)
+	})
+	if i < 0 {
+		return c.policy.defaultResult()
+	}
+
+	return ruleResultWithReason(c.rules[i].rule, i, c.rules[i].reason)
+}
+
+// EvaluateAll returns every rule matching the claims at the current time,
+// in evaluation order (see Policy.EvaluateAll)
+func (c *CompiledPolicy) EvaluateAll(claims *GitHubActionsClaims) []Rule {
+	return c.EvaluateAllAt(claims, time.Now())
+}
+
+// EvaluateAllAt is EvaluateAll as of now (see Policy.EvaluateAllAt)
+func (c *CompiledPolicy) EvaluateAllAt(claims *GitHubActionsClaims, now time.Time) []Rule {
+	if c.policy == nil {
+		return nil
+	}
+
+	var matched []Rule
+	for _, i := range c.order {
+		if c.rules[i].matches(claims, now) {
+			matched = append(matched, c.rules[i].rule)
+		}
+	}
+	return matched
+}
+
+// matches checks if the rule is active at now and claims match all of its
+// conditions
+func (r *compiledRule) matches(claims *GitHubActionsClaims, now time.Time) bool {
+	if r.window && !r.rule.ActiveAt(now) {
+		return false
+	}
+	for i := range r.conditions {
+		cond := &r.conditions[i]
+		value := cond.claim(claims)
+		if cond.optional && value == "" {
+			return false
+		}
+		if !cond.patterns.match(value) {
+			return false
+		}
+	}
+	return (!r.numeric || numericMismatch(r.rule.Conditions, claims) == "") &&
+		(!r.lists || listMismatch(r.rule.Conditions, claims) == "") &&
+		(!r.plugins || pluginMismatch(r.rule, claims) == "")
+}
@@ -0,0 +1,226 @@
+package ghaauth
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCompilePattern(t *testing.T) {
+	patterns := []string{
+		"*", "**", "myorg/*", "myorg/**", "refs/heads/*", "refs/heads/**",
+		"release-*", "*-bot", "myorg/*/sub", "**/main", "refs/**/v*", "a*b*c", "v?.*", "env-[a-c]", `x\*`,
+		`re:refs/tags/v\d+(\.\d+)*`, "re:myorg", "re:(",
+	}
+	values := []string{
+		"", "myorg", "myorg/", "myorg/repo", "myorg/repo/sub", "refs/heads/main",
+		"refs/heads/feature/login", "refs/tags/v1.0.0", "release-1", "release-1/hotfix",
+		"dependabot-bot", "abc", "a/b/c", "main",
+	}
+
+	for _, pattern := range patterns {
+		compiled := compilePattern(pattern)
+		for _, value := range values {
+			if got, want := compiled.match(value), Match(pattern, value); got != want {
+				t.Errorf("compiled %q (kind %d) match(%q) = %v, Match() = %v", pattern, compiled.kind, value, got, want)
+			}
+		}
+	}
+
+	// Sets also handle literals, braces and values equal to the pattern
+	setPatterns := append([]string{
+		"myorg/exact", "main", "refs/heads/{main,dev*}", "release-[0-9]", "a{b}c",
+		"dependabot[bot]", "myorg/{app,lib}/**", `re:v\d+`,
+	}, patterns...)
+	setValues := append([]string{"refs/heads/devel", "release-1", "a{b}c", "dependabot[bot]", "myorg/lib/x/y"}, values...)
+	for _, pattern := range setPatterns {
+		set := compilePatterns([]string{pattern})
+		for _, value := range setValues {
+			if got, want := set.match(value), Match(pattern, value); got != want {
+				t.Errorf("patternSet(%q).match(%q) = %v, Match() = %v", pattern, value, got, want)
+			}
+		}
+	}
+}
+
+func TestCompilePatterns_ManyLiterals(t *testing.T) {
+	var patterns []string
+	for i := 0; i < 2*exactSetThreshold; i++ {
+		patterns = append(patterns, fmt.Sprintf("myorg/repo-%d", i))
+	}
+	patterns = append(patterns, "other/*")
+
+	set := compilePatterns(patterns)
+	if set.exact == nil {
+		t.Fatal("expected literals to be stored in a set")
+	}
+
+	for _, value := range []string{"myorg/repo-3", "myorg/repo-15", "myorg/repo-16", "other/x", "other/x/y"} {
+		if got, want := set.match(value), MatchAny(patterns, value); got != want {
+			t.Errorf("patternSet.match(%q) = %v, MatchAny() = %v", value, got, want)
+		}
+	}
+}
+
+func TestCompiledPolicy_Evaluate(t *testing.T) {
+	policies := map[string]*Policy{
+		"nil": nil,
+		"default deny": {
+			Rules: []Rule{
+				{Name: "deny-bots", Conditions: Conditions{Actor: []string{"*[bot]"}}, Effect: EffectDeny},
+				{Name: "allow-main", Conditions: Conditions{Repository: []string{"myorg/*"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow},
+				{Conditions: Conditions{Environment: []string{"prod*"}}, Effect: EffectAllow},
+				{Name: "allow-prs", Conditions: Conditions{BaseRef: []string{"main"}, HeadRef: []string{"**"}}, Effect: EffectAllow},
+			},
+			DefaultDeny: true,
+		},
+		"deny overrides with priority": {
+			Rules: []Rule{
+				{Name: "allow-main", Conditions: Conditions{Ref: []string{"refs/heads/main"}}, Effect: EffectAllow},
+				{Name: "deny-bots", Conditions: Conditions{Actor: []string{"*[bot]"}}, Effect: EffectDeny},
+				{Name: "allow-forks", Conditions: Conditions{RepositoryOwner: []string{"fork*"}}, Effect: EffectAllow, Priority: 5},
+			},
+			DefaultDeny:    true,
+			EvaluationMode: EvaluationDenyOverrides,
+		},
+		"numeric bounds": {
+			Rules: []Rule{
+				{Name: "allow-first-attempt", Conditions: Conditions{RepositoryOwner: []string{"myorg"}, RunAttemptMax: 1}, Effect: EffectAllow},
+			},
+			DefaultDeny: true,
+		},
+		"allow overrides": {
+			Rules: []Rule{
+				{Name: "deny-org", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectDeny},
+				{Name: "allow-prod", Conditions: Conditions{Environment: []string{"production"}}, Effect: EffectAllow},
+			},
+			EvaluationMode: EvaluationAllowOverrides,
+		},
+		"default allow": {
+			Rules: []Rule{
+				{Name: "deny-forks", Conditions: Conditions{RepositoryOwner: []string{"fork*"}}, Effect: EffectDeny},
+			},
+		},
+	}
+
+	claims := []*GitHubActionsClaims{
+		{Repository: "myorg/app", RepositoryOwner: "myorg", Ref: "refs/heads/main", Actor: "alice", RunAttempt: "1"},
+		{Repository: "myorg/app", RepositoryOwner: "myorg", Ref: "refs/heads/main", Actor: "alice", RunAttempt: "2"},
+		{Repository: "myorg/app", RepositoryOwner: "myorg", Ref: "refs/heads/main", Actor: "dependabot[bot]"},
+		{Repository: "myorg/app", RepositoryOwner: "myorg", Ref: "refs/heads/dev", Environment: "production"},
+		{Repository: "myorg/app", RepositoryOwner: "myorg", Ref: "refs/pull/1/merge", BaseRef: "main", HeadRef: "feature/x"},
+		{Repository: "myorg/app", RepositoryOwner: "myorg", Ref: "refs/pull/1/merge", BaseRef: "main"},
+		{Repository: "forker/app", RepositoryOwner: "forker", Ref: "refs/heads/main"},
+	}
+
+	for name, policy := range policies {
+		compiled := policy.Compile()
+		if compiled.Policy() != policy {
+			t.Errorf("%s: Policy() did not return the compiled policy", name)
+		}
+		cached := policy.Compile(WithMatchCache(4))
+
+		// Twice, so that the cached policy answers from its cache
+		for range 2 {
+			for i, c := range claims {
+				want := policy.Evaluate(c)
+				if got := compiled.Evaluate(c); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: claims %d: compiled Evaluate() = %+v, want %+v", name, i, got, want)
+				}
+				if got := cached.Evaluate(c); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: claims %d: cached Evaluate() = %+v, want %+v", name, i, got, want)
+				}
+			}
+		}
+	}
+}
+
+// largePolicy builds a policy whose matching rule is last
+func largePolicy(n int) *Policy {
+	policy := &Policy{DefaultDeny: true}
+	for i := 0; i < n; i++ {
+		policy.Rules = append(policy.Rules, Rule{
+			Name: fmt.Sprintf("rule-%d", i),
+			Conditions: Conditions{
+				Repository: []string{fmt.Sprintf("org-%d/*", i), fmt.Sprintf("other-%d/service", i)},
+				Ref:        []string{"refs/heads/main", "refs/tags/**"},
+			},
+			Effect: EffectAllow,
+		})
+	}
+	return policy
+}
+
+func benchmarkClaims(n int) *GitHubActionsClaims {
+	return &GitHubActionsClaims{
+		Repository:      fmt.Sprintf("org-%d/app", n-1),
+		RepositoryOwner: fmt.Sprintf("org-%d", n-1),
+		Ref:             "refs/tags/v1.2.3",
+	}
+}
+
+func BenchmarkPolicy_Evaluate(b *testing.B) {
+	policy := largePolicy(500)
+	claims := benchmarkClaims(500)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		policy.Evaluate(claims)
+	}
+}
+
+func BenchmarkCompiledPolicy_Evaluate(b *testing.B) {
+	compiled := largePolicy(500).Compile()
+	claims := benchmarkClaims(500)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compiled.Evaluate(claims)
+	}
+}
+
+// complexPolicy builds a policy of wildcard and regular expression patterns
+// whose matching rule is last
+func complexPolicy(n int) *Policy {
+	policy := &Policy{DefaultDeny: true}
+	for i := 0; i < n; i++ {
+		policy.Rules = append(policy.Rules, Rule{
+			Name: fmt.Sprintf("rule-%d", i),
+			Conditions: Conditions{
+				Repository:     []string{fmt.Sprintf("*/service-%d-*", i)},
+				Ref:            []string{"refs/heads/**/release-[0-9]*.[0-9]*", `re:refs/tags/v\d+\.\d+\.\d+`},
+				JobWorkflowRef: []string{"*/*/.github/workflows/**/deploy-*.yml@refs/{heads,tags}/**"},
+			},
+			Effect: EffectAllow,
+		})
+	}
+	return policy
+}
+
+func BenchmarkCompiledPolicy_MatchCache(b *testing.B) {
+	const n = 50
+	claims := &GitHubActionsClaims{
+		Repository:     fmt.Sprintf("myorg/service-%d-api", n-1),
+		Ref:            "refs/tags/v1.2.3",
+		JobWorkflowRef: "myorg/workflows/.github/workflows/prod/deploy-api.yml@refs/tags/v1",
+	}
+
+	for _, bm := range []struct {
+		name string
+		opts []CompileOption
+	}{
+		{name: "uncached"},
+		{name: "cached", opts: []CompileOption{WithMatchCache(1024)}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			compiled := complexPolicy(n).Compile(bm.opts...)
+			if !compiled.Evaluate(claims).Allowed {
+				b.Fatal("expected the last rule to allow")
+			}
+
+			for b.Loop() {
+				compiled.Evaluate(claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package ghaauth
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// ExpandConditionSets merges the condition sets referenced by each rule's
+// Use into its conditions and clears Use. A condition the rule gives
+// replaces the set's, so that a rule can narrow a set but never widen it;
+// of several sets giving the same condition, the first one used applies.
+// Plugins are the exception: all of them must accept the claims. Policy
+// files are expanded when they are parsed; policies built in code that use
+// condition sets must call this before use.
+func (p *Policy) ExpandConditionSets() error {
+	if p == nil {
+		return nil
+	}
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		for _, name := range rule.Use {
+			set, ok := p.ConditionSets[name]
+			if !ok {
+				return NewPolicyError(rule.Name, fmt.Sprintf("unknown condition set %q", name))
+			}
+			rule.Conditions = mergeConditions(rule.Conditions, set)
+		}
+		rule.Use = nil
+	}
+
+	return nil
+}
+
+// mergeConditions fills the conditions a leaves unset with those of b.
+// Custom properties and inputs are filled per name; plugins are combined.
+func mergeConditions(a, b Conditions) Conditions {
+	merged := reflect.ValueOf(&a).Elem()
+	add := reflect.ValueOf(b)
+
+	for i := 0; i < merged.NumField(); i++ {
+		if add.Field(i).IsZero() {
+			continue
+		}
+		field := merged.Field(i)
+
+		// Custom properties and inputs set by the rule take precedence per name
+		if field.Kind() == reflect.Map {
+			patterns := make(map[string][]string)
+			for name, values := range add.Field(i).Interface().(map[string][]string) {
+				patterns[name] = append([]string(nil), values...)
+			}
+			for name, values := range field.Interface().(map[string][]string) {
+				patterns[name] = values
+			}
+			field.Set(reflect.ValueOf(patterns))
+			continue
+		}
+
+		// Every plugin must accept the claims, so they narrow when combined
+		if merged.Type().Field(i).Name == "Plugin" {
+			plugins := append([]string(nil), field.Interface().([]string)...)
+			field.Set(reflect.ValueOf(append(plugins, add.Field(i).Interface().([]string)...)))
+			continue
+		}
+
+		// Other conditions and numeric bounds set by the rule take precedence
+		if !field.IsZero() {
+			continue
+		}
+		if field.Kind() == reflect.Int {
+			field.Set(add.Field(i))
+		} else {
+			field.Set(reflect.ValueOf(slices.Clone(add.Field(i).Interface().([]string))))
+		}
+	}
+
+	return a
+}
@@ -0,0 +1,175 @@
+package ghaauth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPolicy_ExpandConditionSets(t *testing.T) {
+	sets := map[string]Conditions{
+		"prod-branches": {Ref: []string{"refs/heads/main", "refs/tags/v*"}},
+		"org":           {RepositoryOwner: []string{"myorg"}},
+		"platform": {
+			CustomProperties: map[string][]string{"team": {"platform"}, "tier": {"**"}},
+			Plugin:           []string{"approved"},
+			RunAttemptMax:    3,
+		},
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		want    Conditions
+		wantErr bool
+	}{
+		{
+			name: "single set",
+			rule: Rule{Use: []string{"prod-branches"}, Conditions: Conditions{Environment: []string{"production"}}},
+			want: Conditions{Ref: []string{"refs/heads/main", "refs/tags/v*"}, Environment: []string{"production"}},
+		},
+		{
+			name: "multiple sets",
+			rule: Rule{Use: []string{"org", "prod-branches"}},
+			want: Conditions{RepositoryOwner: []string{"myorg"}, Ref: []string{"refs/heads/main", "refs/tags/v*"}},
+		},
+		{
+			name: "rule narrows a condition of the set",
+			rule: Rule{Use: []string{"prod-branches"}, Conditions: Conditions{Ref: []string{"refs/heads/main"}}},
+			want: Conditions{Ref: []string{"refs/heads/main"}},
+		},
+		{
+			name: "first set wins",
+			rule: Rule{Use: []string{"prod-branches", "org"}, Conditions: Conditions{RepositoryOwner: []string{"otherorg"}}},
+			want: Conditions{RepositoryOwner: []string{"otherorg"}, Ref: []string{"refs/heads/main", "refs/tags/v*"}},
+		},
+		{
+			name: "properties are replaced per name and plugins combined",
+			rule: Rule{Use: []string{"platform"}, Conditions: Conditions{
+				CustomProperties: map[string][]string{"tier": {"prod"}},
+				Plugin:           []string{"business-hours"},
+				RunAttemptMax:    1,
+			}},
+			want: Conditions{
+				CustomProperties: map[string][]string{"team": {"platform"}, "tier": {"prod"}},
+				Plugin:           []string{"business-hours", "approved"},
+				RunAttemptMax:    1,
+			},
+		},
+		{
+			name:    "unknown set",
+			rule:    Rule{Name: "deploy", Use: []string{"staging-branches"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &Policy{Rules: []Rule{tt.rule}, ConditionSets: sets}
+
+			err := policy.ExpandConditionSets()
+			if tt.wantErr {
+				var policyErr *PolicyError
+				if !errors.As(err, &policyErr) {
+					t.Fatalf("ExpandConditionSets() error = %v, want PolicyError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandConditionSets() error = %v", err)
+			}
+
+			if got := policy.Rules[0].Conditions; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Conditions = %+v, want %+v", got, tt.want)
+			}
+			if policy.Rules[0].Use != nil {
+				t.Errorf("Use = %v, want cleared", policy.Rules[0].Use)
+			}
+		})
+	}
+
+	t.Run("sets are not modified", func(t *testing.T) {
+		policy := &Policy{
+			Rules: []Rule{
+				{Use: []string{"prod-branches"}, Conditions: Conditions{Ref: []string{"refs/heads/a"}}},
+				{Use: []string{"prod-branches"}, Conditions: Conditions{Ref: []string{"refs/heads/b"}}},
+			},
+			ConditionSets: map[string]Conditions{"prod-branches": {Ref: []string{"refs/heads/main"}}},
+		}
+		if err := policy.ExpandConditionSets(); err != nil {
+			t.Fatalf("ExpandConditionSets() error = %v", err)
+		}
+		if got := policy.ConditionSets["prod-branches"].Ref; len(got) != 1 {
+			t.Errorf("condition set modified: %v", got)
+		}
+		if got := policy.Rules[1].Conditions.Ref; !reflect.DeepEqual(got, []string{"refs/heads/b"}) {
+			t.Errorf("second rule Ref = %v", got)
+		}
+	})
+
+	t.Run("unexpanded references fail validation", func(t *testing.T) {
+		policy := &Policy{
+			Rules:         []Rule{{Use: []string{"org"}, Effect: EffectAllow}},
+			ConditionSets: sets,
+		}
+		if err := policy.Validate(); err == nil {
+			t.Error("Validate() error = nil, want error for unexpanded Use")
+		}
+	})
+}
+
+func TestParsePolicyYAML_ConditionSets(t *testing.T) {
+	policy, err := ParsePolicyYAML([]byte(`
+condition_sets:
+  prod-branches:
+    ref: [refs/heads/main, "refs/tags/v*"]
+rules:
+  - name: deploy-api
+    use: [prod-branches]
+    conditions:
+      repository: [myorg/api]
+    effect: allow
+default_deny: true
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	claims := &GitHubActionsClaims{Repository: "myorg/api", Ref: "refs/tags/v1.0"}
+	if result := policy.Evaluate(claims); !result.Allowed {
+		t.Errorf("Evaluate() = %+v, want allowed via condition set", result)
+	}
+}
+
+func TestParsePolicyYAML_ConditionSetNarrowed(t *testing.T) {
+	policy, err := ParsePolicyYAML([]byte(`
+condition_sets:
+  branches:
+    ref: ["refs/heads/**"]
+rules:
+  - name: deploy-api
+    use: [branches]
+    conditions:
+      repository: [myorg/api]
+      ref: [refs/heads/main]
+    effect: allow
+default_deny: true
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{ref: "refs/heads/main", want: true},
+		{ref: "refs/heads/dev", want: false},
+	}
+	for _, tt := range tests {
+		claims := &GitHubActionsClaims{Repository: "myorg/api", Ref: tt.ref}
+		if result := policy.Evaluate(claims); result.Allowed != tt.want {
+			t.Errorf("Evaluate(%s) allowed = %v, want %v", tt.ref, result.Allowed, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+const testConfigYAML = `
+audience: https://api.example.com
+jwks_cache_duration: 30m
+http_timeout: 5s
+verify_timeout: 3s
+max_token_age: 2m
+max_token_lifetime: 1h
+required_claims: [job_workflow_ref]
+runner_environments: [github-hosted]
+denial_detail: full
+strict_policies: true
+policy_tags: [deploy]
+policy:
+  mode: enforce-default-deny
+  condition_sets:
+    org:
+      repository_owner: [myorg]
+  rules:
+    - name: allow-org
+      use: [org]
+      effect: allow
+`
+
+func TestParseConfigYAML(t *testing.T) {
+	cfg, err := ParseConfigYAML([]byte(testConfigYAML))
+	if err != nil {
+		t.Fatalf("ParseConfigYAML() error = %v", err)
+	}
+
+	if cfg.Audience != "https://api.example.com" {
+		t.Errorf("Audience = %q", cfg.Audience)
+	}
+	if time.Duration(cfg.JWKSCacheDuration) != 30*time.Minute {
+		t.Errorf("JWKSCacheDuration = %v, want 30m", time.Duration(cfg.JWKSCacheDuration))
+	}
+	if time.Duration(cfg.MaxTokenAge) != 2*time.Minute {
+		t.Errorf("MaxTokenAge = %v, want 2m", time.Duration(cfg.MaxTokenAge))
+	}
+	if cfg.Policy == nil || len(cfg.Policy.Rules) != 1 {
+		t.Fatalf("Policy = %+v, want one rule", cfg.Policy)
+	}
+
+	verifier, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewFromConfig() error = %v", err)
+	}
+	if verifier.audience != cfg.Audience || verifier.maxTokenAge != 2*time.Minute || verifier.maxTokenLifetime != time.Hour ||
+		verifier.jwksCacheDuration != 30*time.Minute || verifier.denialDetail != DenialDetailFull {
+		t.Errorf("NewFromConfig() did not apply the configuration")
+	}
+	if verifier.httpClient.Timeout != 5*time.Second {
+		t.Errorf("HTTP timeout = %v, want 5s", verifier.httpClient.Timeout)
+	}
+	if !verifier.strictPolicies {
+		t.Error("strict policies were not enabled")
+	}
+	if len(verifier.compileOpts) != 1 {
+		t.Error("policy tags were not applied")
+	}
+	if verifier.verifyTimeout != 3*time.Second {
+		t.Errorf("verify timeout = %v, want 3s", verifier.verifyTimeout)
+	}
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "malformed JSON", data: `{"audience": `},
+		{name: "unknown field", data: `{"audiences": ["a"]}`},
+		{name: "invalid duration", data: `{"max_token_age": "two minutes"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseConfig([]byte(tt.data)); err == nil {
+				t.Fatal("ParseConfig() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNewFromConfig_Errors(t *testing.T) {
+	dir := t.TempDir()
+	policyFile := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(policyFile, []byte(testPolicyJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &Policy{Rules: []Rule{{Conditions: Conditions{Repository: []string{"myorg/*"}}, Effect: EffectAllow}}}
+
+	tests := []struct {
+		name          string
+		cfg           *Config
+		wantPolicyErr bool
+	}{
+		{name: "policy and policy_file", cfg: &Config{Policy: policy, PolicyFile: policyFile}, wantPolicyErr: true},
+		{name: "missing policy file", cfg: &Config{PolicyFile: filepath.Join(dir, "missing.json")}},
+		{name: "unknown denial detail", cfg: &Config{DenialDetail: "verbose"}},
+		{name: "unknown runner environment", cfg: &Config{RunnerEnvironments: []string{"on-prem"}}},
+		{name: "missing client certificate", cfg: &Config{ClientCertFile: filepath.Join(dir, "client.pem"), ClientKeyFile: filepath.Join(dir, "client-key.pem")}},
+		{name: "invalid proxy URL", cfg: &Config{ProxyURL: "proxy.internal:3128"}},
+		{name: "strict policies with default allow policy", cfg: &Config{Policy: policy, StrictPolicies: true}, wantPolicyErr: true},
+		{name: "required policy missing", cfg: &Config{RequirePolicy: true}, wantPolicyErr: true},
+		{name: "missing denylist file", cfg: &Config{DenylistFile: filepath.Join(dir, "denylist.yaml")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFromConfig(tt.cfg)
+			if err == nil {
+				t.Fatal("NewFromConfig() error = nil, want error")
+			}
+			var policyErr *PolicyError
+			if tt.wantPolicyErr && !errors.As(err, &policyErr) {
+				t.Errorf("NewFromConfig() error = %T, want *PolicyError", err)
+			}
+		})
+	}
+}
+
+func TestNewFromConfig_Verify(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "gha-auth.json")
+	policyFile := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(policyFile, []byte(testPolicyJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := `{
+		"audience": "https://api.example.com",
+		"issuers": [
+			{"url": "https://token.actions.githubusercontent.com", "jwks_url": "` + server.URL() + `/.well-known/jwks", "policy_file": "` + policyFile + `"}
+		]
+	}`
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigFile(configFile)
+	if err != nil {
+		t.Fatalf("LoadConfigFile() error = %v", err)
+	}
+
+	verifier, err := NewFromConfig(cfg, WithKeyCache(NewMemoryKeyCache()))
+	if err != nil {
+		t.Fatalf("NewFromConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		owner   string
+		wantErr error
+	}{
+		{name: "allowed by issuer policy", owner: "myorg"},
+		{name: "denied by issuer policy", owner: "otherorg", wantErr: ErrAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testutil.DefaultClaims()
+			claims.RepositoryOwner = tt.owner
+			claims.Repository = tt.owner + "/repo"
+
+			tokenString, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tokenString)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package ghaauth
+
+import "context"
+
+// resultContextKey is the context key for the verification result
+type resultContextKey struct{}
+
+// NewContext returns a copy of ctx carrying the verification result. The
+// middleware and framework adapters use it, so handlers and the code they
+// call can retrieve the verified identity with FromContext.
+func NewContext(ctx context.Context, result *VerificationResult) context.Context {
+	return context.WithValue(ctx, resultContextKey{}, result)
+}
+
+// FromContext returns the verification result stored by NewContext
+func FromContext(ctx context.Context) (*VerificationResult, bool) {
+	result, ok := ctx.Value(resultContextKey{}).(*VerificationResult)
+	return result, ok && result != nil
+}
+
+// ClaimsFromContext returns the verified claims stored by NewContext
+func ClaimsFromContext(ctx context.Context) (*GitHubActionsClaims, bool) {
+	result, ok := FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return result.Claims, true
+}
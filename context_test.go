@@ -0,0 +1,40 @@
+package ghaauth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewContext(t *testing.T) {
+	result := &VerificationResult{Claims: &GitHubActionsClaims{Repository: "myorg/myrepo"}}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		wantResult *VerificationResult
+	}{
+		{name: "empty context", ctx: context.Background()},
+		{name: "nil result", ctx: NewContext(context.Background(), nil)},
+		{name: "stored result", ctx: NewContext(context.Background(), result), wantResult: result},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := FromContext(tt.ctx)
+			if ok != (tt.wantResult != nil) || got != tt.wantResult {
+				t.Errorf("FromContext() = %v, %v, want %v", got, ok, tt.wantResult)
+			}
+
+			claims, ok := ClaimsFromContext(tt.ctx)
+			if tt.wantResult == nil {
+				if ok {
+					t.Errorf("ClaimsFromContext() ok = true, want false")
+				}
+				return
+			}
+			if !ok || claims != tt.wantResult.Claims {
+				t.Errorf("ClaimsFromContext() = %v, %v, want %v", claims, ok, tt.wantResult.Claims)
+			}
+		})
+	}
+}
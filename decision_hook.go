@@ -0,0 +1,282 @@
+package ghaauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDecisionHookConcurrency is how many hook notifications may run
+	// at once; further notifications are dropped and logged until one ends
+	DefaultDecisionHookConcurrency = 32
+
+	// maxSeenIdentities bounds the identities remembered for
+	// DecisionFirstSeen
+	maxSeenIdentities = 10000
+)
+
+// DecisionEvent selects the decisions a DecisionHook is notified of
+type DecisionEvent uint8
+
+const (
+	// DecisionDenied is a token with a valid signature that failed
+	// verification, whether by the policy or any other check
+	DecisionDenied DecisionEvent = 1 << iota
+
+	// DecisionAllowed is a token that passed verification
+	DecisionAllowed
+
+	// DecisionFirstSeen is the first decision, allowed or denied, for an
+	// identity (see Identity.String)
+	DecisionFirstSeen
+)
+
+// Decision is the outcome of verifying a token with a valid signature
+type Decision struct {
+	// Time is when the decision was made
+	Time time.Time
+
+	// Allowed reports whether the token passed verification
+	Allowed bool
+
+	// FirstSeen reports whether the identity had not been seen before
+	FirstSeen bool
+
+	// Identity is the caller
+	Identity Identity
+
+	// Claims are the verified claims
+	Claims *GitHubActionsClaims
+
+	// Err is the verification error of a denied token
+	Err error
+
+	// PolicyVersion is the Metadata.Version of the policy that allowed or
+	// denied the token, empty if it was denied before policy evaluation
+	PolicyVersion string
+}
+
+// DecisionHook is notified of verification decisions, e.g. to alert on
+// unknown repositories attempting access. It runs on its own goroutine,
+// after the verification has returned, with a context that is not
+// canceled with the request's; errors are logged at warn level to the
+// logger set with WithLogger.
+type DecisionHook func(ctx context.Context, decision Decision) error
+
+// decisionHook is a DecisionHook with the events it is notified of
+type decisionHook struct {
+	hook   DecisionHook
+	events DecisionEvent
+}
+
+// wants reports whether the hook is notified of the decision
+func (h decisionHook) wants(d Decision) bool {
+	return h.events&DecisionDenied != 0 && !d.Allowed ||
+		h.events&DecisionAllowed != 0 && d.Allowed ||
+		h.events&DecisionFirstSeen != 0 && d.FirstSeen
+}
+
+// WithDecisionHook notifies hook of the decisions selected by events, e.g.
+// DecisionDenied|DecisionFirstSeen. Hooks never delay or change the
+// outcome of a verification. Up to DefaultDecisionHookConcurrency
+// notifications run at once, and further ones are dropped.
+//
+// First-seen identities are remembered in memory, up to 10000 of them;
+// beyond that they are all forgotten and may be reported again.
+func WithDecisionHook(hook DecisionHook, events DecisionEvent) Option {
+	return func(v *Verifier) {
+		v.decisionHooks = append(v.decisionHooks, decisionHook{hook: hook, events: events})
+		if events&DecisionFirstSeen != 0 && v.seenIdentities == nil {
+			v.seenIdentities = &identitySet{}
+		}
+		if v.hookSlots == nil {
+			v.hookSlots = make(chan struct{}, DefaultDecisionHookConcurrency)
+		}
+	}
+}
+
+// notifyDecision records a verification outcome in the decision log and
+// notifies the decision hooks of it: the result of an allowed token, or the
+// error of a denied one
+func (v *Verifier) notifyDecision(ctx context.Context, claims *GitHubActionsClaims, result *VerificationResult, err error) {
+	if len(v.decisionHooks) == 0 && v.decisionLog == nil {
+		return
+	}
+
+	d := Decision{
+		Time:          v.clock.Now(),
+		Allowed:       err == nil,
+		Identity:      claims.Identity(),
+		Claims:        claims,
+		Err:           err,
+		PolicyVersion: deniedPolicyVersion(err),
+	}
+	if result != nil && result.PolicyResult != nil {
+		d.PolicyVersion = result.PolicyResult.PolicyVersion
+	}
+	if v.seenIdentities != nil {
+		d.FirstSeen = v.seenIdentities.add(d.Identity.String())
+	}
+
+	if v.decisionLog != nil {
+		if err := v.decisionLog.write(d); err != nil {
+			v.logger.WarnContext(ctx, "decision log write failed", slog.String("error", err.Error()), claimsAttr(claims))
+		}
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	for _, h := range v.decisionHooks {
+		if !h.wants(d) {
+			continue
+		}
+
+		select {
+		case v.hookSlots <- struct{}{}:
+		default:
+			v.logger.WarnContext(ctx, "decision hook notification dropped", claimsAttr(claims))
+			continue
+		}
+		go func() {
+			defer func() { <-v.hookSlots }()
+			if err := h.hook(ctx, d); err != nil {
+				v.logger.WarnContext(ctx, "decision hook failed", slog.String("error", err.Error()), claimsAttr(claims))
+			}
+		}()
+	}
+}
+
+// identitySet remembers identities for DecisionFirstSeen
+type identitySet struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// add records an identity, reporting whether it is new
+func (s *identitySet) add(identity string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.seen[identity]; ok {
+		return false
+	}
+	if s.seen == nil || len(s.seen) >= maxSeenIdentities {
+		s.seen = make(map[string]struct{})
+	}
+	s.seen[identity] = struct{}{}
+	return true
+}
+
+// ChannelHook returns a DecisionHook that sends decisions to ch, dropping
+// them when ch is full
+func ChannelHook(ch chan<- Decision) DecisionHook {
+	return func(_ context.Context, d Decision) error {
+		select {
+		case ch <- d:
+			return nil
+		default:
+			return fmt.Errorf("decision channel is full")
+		}
+	}
+}
+
+// WithDecisionLog appends every decision, allowed or denied, to w as a
+// line of JSON (see DecisionRecord), e.g. for Policy.Recommend or
+// "gha-auth policy recommend". The records hold all verified claims.
+// Unlike decision hooks, records are written before the verification
+// returns, so that none are dropped under load; failed writes are logged
+// at warn level to the logger set with WithLogger.
+func WithDecisionLog(w io.Writer) Option {
+	return func(v *Verifier) {
+		v.decisionLog = &decisionLog{w: w}
+	}
+}
+
+// decisionLog writes decision records, one write per record
+type decisionLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// write appends the record of a decision
+func (l *decisionLog) write(d Decision) error {
+	line, err := json.Marshal(DecisionRecord{Time: d.Time, Allowed: d.Allowed, Claims: d.Claims})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// webhookPayload is the JSON body posted by WebhookHook
+type webhookPayload struct {
+	Time          time.Time `json:"time"`
+	Allowed       bool      `json:"allowed"`
+	FirstSeen     bool      `json:"first_seen"`
+	Identity      string    `json:"identity"`
+	Repository    string    `json:"repository"`
+	Ref           string    `json:"ref"`
+	Workflow      string    `json:"workflow,omitempty"`
+	Actor         string    `json:"actor,omitempty"`
+	Code          ErrorCode `json:"code,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	PolicyVersion string    `json:"policy_version,omitempty"`
+}
+
+// WebhookHook returns a DecisionHook that posts each decision as JSON to
+// url, e.g. a chat or incident webhook. The body carries the identity, the
+// repository, ref, workflow and actor, the policy version, and for denials
+// the error code and message. A nil client uses one with DefaultHTTPTimeout.
+func WebhookHook(url string, client *http.Client) DecisionHook {
+	if client == nil {
+		client = newHTTPClient()
+	}
+
+	return func(ctx context.Context, d Decision) error {
+		payload := webhookPayload{
+			Time:          d.Time,
+			Allowed:       d.Allowed,
+			FirstSeen:     d.FirstSeen,
+			Identity:      d.Identity.String(),
+			Repository:    d.Claims.Repository,
+			Ref:           d.Claims.Ref,
+			Workflow:      d.Claims.Workflow,
+			Actor:         d.Claims.Actor,
+			PolicyVersion: d.PolicyVersion,
+		}
+		if d.Err != nil {
+			payload.Code = ErrorCodeOf(d.Err)
+			payload.Error = d.Err.Error()
+		}
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
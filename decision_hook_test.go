@@ -0,0 +1,165 @@
+package ghaauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+// receiveDecision waits for a decision sent by a ChannelHook
+func receiveDecision(t *testing.T, ch <-chan Decision) Decision {
+	t.Helper()
+
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no decision received")
+		return Decision{}
+	}
+}
+
+func TestWithDecisionHook(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	policy := &Policy{
+		Metadata:    &PolicyMetadata{Version: "v7"},
+		Rules:       []Rule{{Name: "allow-myorg", Conditions: Conditions{Repository: []string{"myorg/myrepo"}}, Effect: EffectAllow}},
+		DefaultDeny: true,
+	}
+
+	allowed, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	denied, err := gen.GenerateToken(testutil.DefaultClaims().WithRepository("otherorg/unknown").ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	ctx := context.Background()
+
+	t.Run("denials", func(t *testing.T) {
+		ch := make(chan Decision, 10)
+		verifier, err := New(
+			WithJWKSURL(server.JWKSURL()),
+			WithPolicy(policy),
+			WithDecisionHook(ChannelHook(ch), DecisionDenied),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if _, err := verifier.Verify(ctx, allowed); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if _, err := verifier.Verify(ctx, denied); !errors.Is(err, ErrAccessDenied) {
+			t.Fatalf("Verify() error = %v, want ErrAccessDenied", err)
+		}
+
+		d := receiveDecision(t, ch)
+		if d.Allowed || !errors.Is(d.Err, ErrAccessDenied) || d.Identity.Org != "otherorg" {
+			t.Errorf("decision = %+v, want denial of otherorg", d)
+		}
+		if d.PolicyVersion != "v7" {
+			t.Errorf("PolicyVersion = %q, want v7", d.PolicyVersion)
+		}
+		select {
+		case d := <-ch:
+			t.Errorf("unexpected decision %+v", d)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("first-seen identities", func(t *testing.T) {
+		ch := make(chan Decision, 10)
+		verifier, err := New(
+			WithJWKSURL(server.JWKSURL()),
+			WithPolicy(policy),
+			WithDecisionHook(ChannelHook(ch), DecisionFirstSeen),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		for _, token := range []string{allowed, allowed, denied, denied} {
+			_, _ = verifier.Verify(ctx, token)
+		}
+
+		first, second := receiveDecision(t, ch), receiveDecision(t, ch)
+		if !first.FirstSeen || !second.FirstSeen || first.Identity == second.Identity {
+			t.Errorf("decisions = %+v, %+v, want two first-seen identities", first, second)
+		}
+		select {
+		case d := <-ch:
+			t.Errorf("unexpected decision %+v", d)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+func TestWebhookHook(t *testing.T) {
+	bodies := make(chan webhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		bodies <- payload
+	}))
+	defer server.Close()
+
+	claims := &GitHubActionsClaims{Repository: "otherorg/unknown", RepositoryOwner: "otherorg", Ref: "refs/heads/main", Workflow: "CI"}
+	decision := Decision{
+		Time:      time.Unix(1700000000, 0).UTC(),
+		FirstSeen: true,
+		Identity:  claims.Identity(),
+		Claims:    claims,
+		Err:       NewValidationError(ErrAccessDenied, "default deny policy"),
+
+		PolicyVersion: "2026.10.1",
+	}
+
+	if err := WebhookHook(server.URL, nil)(context.Background(), decision); err != nil {
+		t.Fatalf("hook error = %v", err)
+	}
+
+	got := <-bodies
+	want := webhookPayload{
+		Time:       decision.Time,
+		FirstSeen:  true,
+		Identity:   "otherorg/unknown@refs/heads/main#CI",
+		Repository: "otherorg/unknown",
+		Ref:        "refs/heads/main",
+		Workflow:   "CI",
+		Code:       CodePolicyDenied,
+		Error:      "access denied by policy: default deny policy",
+
+		PolicyVersion: "2026.10.1",
+	}
+	if got != want {
+		t.Errorf("payload = %+v, want %+v", got, want)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	if err := WebhookHook(failing.URL, nil)(context.Background(), decision); err == nil {
+		t.Error("hook error = nil for a failing webhook, want error")
+	}
+}
@@ -0,0 +1,150 @@
+package ghaauth
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DenialInfo explains a policy denial. Rule, Conditions and Reason are
+// internal details meant for logs; Message is what callers are shown.
+type DenialInfo struct {
+	// Rule is the deny rule that matched, empty for a default deny
+	Rule string
+
+	// Conditions lists the conditions of the matched deny rule, or for a
+	// default deny the first unmet condition of each rule ("rule: condition"),
+	// which is only worked out at DenialDetailFull
+	Conditions []string
+
+	// Reason is the full internal explanation
+	Reason string
+
+	// Message is the external message, according to the DenialDetailLevel
+	Message string
+
+	// PolicyVersion is the Metadata.Version of the denying policy
+	PolicyVersion string
+}
+
+// DenialDetailLevel controls how much of a policy denial is exposed to
+// callers through the error returned by Verify
+type DenialDetailLevel int
+
+const (
+	// DenialDetailNone exposes only that access was denied
+	DenialDetailNone DenialDetailLevel = iota
+
+	// DenialDetailRule exposes the name of the deciding rule (default)
+	DenialDetailRule
+
+	// DenialDetailFull exposes the internal reason, including conditions
+	DenialDetailFull
+)
+
+// WithDenialDetailLevel sets how much of a policy denial is surfaced in the
+// error message. The DenialInfo on the ValidationError always names the
+// deciding rule or setting for logging; the unmet conditions of a default
+// deny are only listed at DenialDetailFull, which evaluates the rules,
+// including plugins, once more for every such denial.
+func WithDenialDetailLevel(level DenialDetailLevel) Option {
+	return func(v *Verifier) {
+		v.denialDetail = level
+	}
+}
+
+// explainDenial builds the DenialInfo for a denied evaluation at now. The
+// deciding rule or setting is taken from the result; only a default deny at
+// DenialDetailFull evaluates the rules again, to list their unmet
+// conditions.
+func (p *Policy) explainDenial(claims *GitHubActionsClaims, now time.Time, result *EvaluationResult, level DenialDetailLevel) *DenialInfo {
+	info := &DenialInfo{PolicyVersion: p.Version()}
+
+	if result.precondition != "" {
+		info.Conditions = []string{result.precondition}
+		info.Reason = result.Reason
+		info.Message = result.Reason
+		if level == DenialDetailNone {
+			info.Message = ErrAccessDenied.Error()
+		}
+		return info
+	}
+
+	switch {
+	case result.decidedBy > 0:
+		i := result.decidedBy - 1
+		rule := p.Rules[i]
+		info.Rule = ruleLabel(rule, i)
+		info.Conditions = conditionNames(rule.Conditions)
+		info.Reason = fmt.Sprintf("denied by rule %q matching %s", info.Rule, strings.Join(info.Conditions, ", "))
+	case level == DenialDetailFull:
+		for _, i := range p.ruleOrder() {
+			cond := p.Rules[i].inactive(now)
+			if cond == "" {
+				cond = p.mismatch(p.Rules[i], claims)
+			}
+			if cond != "" {
+				info.Conditions = append(info.Conditions, ruleLabel(p.Rules[i], i)+": "+cond)
+			}
+		}
+		info.Reason = fmt.Sprintf("no rule matched (%s)", strings.Join(info.Conditions, "; "))
+	default:
+		info.Reason = "no rule matched"
+	}
+
+	switch level {
+	case DenialDetailNone:
+		info.Message = ErrAccessDenied.Error()
+	case DenialDetailFull:
+		info.Message = info.Reason
+	default:
+		info.Message = result.Reason
+	}
+
+	return info
+}
+
+// ruleLabel names a rule for explanations, falling back to its position
+func ruleLabel(rule Rule, i int) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return "rule " + strconv.Itoa(i+1)
+}
+
+// denialError returns the ErrAccessDenied error for an evaluation denied
+// at now
+func (v *Verifier) denialError(policy *Policy, claims *GitHubActionsClaims, now time.Time, result *EvaluationResult) error {
+	info := policy.explainDenial(claims, now, result, v.denialDetail)
+
+	reason := info.Message
+	if v.denialDetail == DenialDetailNone {
+		reason = ""
+	}
+
+	return &ValidationError{
+		Err:    ErrAccessDenied,
+		Reason: reason,
+		Code:   CodePolicyDenied,
+		Denial: info,
+	}
+}
+
+// conditionNames returns the JSON names of the conditions that are set
+func conditionNames(cond Conditions) []string {
+	var names []string
+
+	v := reflect.ValueOf(cond)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			continue
+		}
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+
+	return names
+}
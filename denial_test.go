@@ -0,0 +1,210 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestPolicy_ExplainDenial(t *testing.T) {
+	claims := &GitHubActionsClaims{
+		Repository:      "myorg/myrepo",
+		RepositoryOwner: "myorg",
+		Ref:             "refs/heads/feature",
+		EventName:       "push",
+		Actor:           "johndoe",
+	}
+
+	policy := &Policy{
+		Rules: []Rule{
+			{
+				Name:       "allow-main",
+				Conditions: Conditions{Repository: []string{"myorg/*"}, Ref: []string{"refs/heads/main"}},
+				Effect:     EffectAllow,
+			},
+			{
+				Conditions: Conditions{Actor: []string{"mallory"}},
+				Effect:     EffectDeny,
+			},
+		},
+		DefaultDeny: true,
+	}
+
+	denyPolicy := &Policy{
+		Rules: []Rule{
+			{
+				Name:       "deny-push",
+				Conditions: Conditions{RepositoryOwner: []string{"myorg"}, EventName: []string{"push"}},
+				Effect:     EffectDeny,
+			},
+		},
+	}
+
+	overridePolicy := &Policy{
+		Rules: []Rule{
+			{Name: "allow-org", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow},
+			{Name: "deny-actor", Conditions: Conditions{Actor: []string{"johndoe"}}, Effect: EffectDeny},
+		},
+		EvaluationMode: EvaluationDenyOverrides,
+	}
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Hour)
+	expiredPolicy := &Policy{
+		Rules: []Rule{
+			{Name: "break-glass", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow, ValidUntil: &expired},
+		},
+		DefaultDeny: true,
+	}
+
+	tests := []struct {
+		name           string
+		policy         *Policy
+		level          DenialDetailLevel
+		wantRule       string
+		wantConditions []string
+		wantMessage    string
+	}{
+		{
+			name:           "default deny lists unmet conditions",
+			policy:         policy,
+			level:          DenialDetailFull,
+			wantConditions: []string{"allow-main: ref", "rule 2: actor"},
+			wantMessage:    "no rule matched (allow-main: ref; rule 2: actor)",
+		},
+		{
+			name:           "deny rule lists its conditions",
+			policy:         denyPolicy,
+			level:          DenialDetailFull,
+			wantRule:       "deny-push",
+			wantConditions: []string{"repository_owner", "event_name"},
+			wantMessage:    `denied by rule "deny-push" matching repository_owner, event_name`,
+		},
+		{
+			name:           "deny-overrides names the overriding rule",
+			policy:         overridePolicy,
+			level:          DenialDetailFull,
+			wantRule:       "deny-actor",
+			wantConditions: []string{"actor"},
+			wantMessage:    `denied by rule "deny-actor" matching actor`,
+		},
+		{
+			name:           "expired rule names its window",
+			policy:         expiredPolicy,
+			level:          DenialDetailFull,
+			wantConditions: []string{"break-glass: valid_until"},
+			wantMessage:    "no rule matched (break-glass: valid_until)",
+		},
+		{
+			name:           "rule level keeps the evaluation reason",
+			policy:         denyPolicy,
+			level:          DenialDetailRule,
+			wantRule:       "deny-push",
+			wantConditions: []string{"repository_owner", "event_name"},
+			wantMessage:    "rule: deny-push",
+		},
+		{
+			name:           "none level hides everything",
+			policy:         denyPolicy,
+			level:          DenialDetailNone,
+			wantRule:       "deny-push",
+			wantConditions: []string{"repository_owner", "event_name"},
+			wantMessage:    "access denied by policy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.policy.EvaluateAt(claims, now)
+			if result.Allowed {
+				t.Fatal("EvaluateAt() allowed, want denied")
+			}
+
+			info := tt.policy.explainDenial(claims, now, result, tt.level)
+
+			if info.Rule != tt.wantRule {
+				t.Errorf("Rule = %q, want %q", info.Rule, tt.wantRule)
+			}
+			if !reflect.DeepEqual(info.Conditions, tt.wantConditions) {
+				t.Errorf("Conditions = %v, want %v", info.Conditions, tt.wantConditions)
+			}
+			if info.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", info.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestWithDenialDetailLevel(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	tokenString, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	policy := &Policy{
+		Rules: []Rule{
+			{
+				Name:       "allow-secret-repo",
+				Conditions: Conditions{Repository: []string{"myorg/secret"}},
+				Effect:     EffectAllow,
+			},
+		},
+		DefaultDeny: true,
+	}
+
+	verifier, err := New(
+		WithPolicy(policy),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithDenialDetailLevel(DenialDetailNone),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = verifier.Verify(context.Background(), tokenString)
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("Verify() error = %v, want ErrAccessDenied", err)
+	}
+
+	if strings.Contains(err.Error(), "allow-secret-repo") {
+		t.Errorf("Error() = %q leaks the rule name", err.Error())
+	}
+	if p := NewProblem(err); strings.Contains(p.Detail, "allow-secret-repo") {
+		t.Errorf("problem detail = %q leaks the rule name", p.Detail)
+	}
+
+	var valErr *ValidationError
+	if !errors.As(err, &valErr) || valErr.Denial == nil {
+		t.Fatalf("Verify() error = %v, want DenialInfo", err)
+	}
+	// Unmet conditions are only worked out at DenialDetailFull
+	if valErr.Denial.Reason != "no rule matched" || valErr.Denial.Conditions != nil {
+		t.Errorf("Denial = %+v, want no unmet conditions below DenialDetailFull", valErr.Denial)
+	}
+
+	verifier, err = New(
+		WithPolicy(policy),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithDenialDetailLevel(DenialDetailFull),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	_, err = verifier.Verify(context.Background(), tokenString)
+	if !errors.As(err, &valErr) || valErr.Denial == nil || !strings.Contains(valErr.Denial.Reason, "allow-secret-repo: repository") {
+		t.Errorf("Verify() error = %v, want internal detail", err)
+	}
+}
@@ -0,0 +1,369 @@
+package ghaauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/yamlutil"
+)
+
+const (
+	// DefaultDenylistRefreshInterval is how long a Denylist uses the
+	// entries of its sources before loading them again
+	DefaultDenylistRefreshInterval = 30 * time.Second
+
+	// maxDenylistSize bounds a denylist document fetched by DenylistURL
+	maxDenylistSize = 1 << 20
+)
+
+// DenylistEntry blocks the tokens of a repository, an actor, a workflow run
+// or a single token. Exactly one of Repository, Actor, RunID and JTI must
+// be set.
+type DenylistEntry struct {
+	// Repository is an owner/name, compared case-insensitively
+	Repository string `json:"repository,omitempty"`
+
+	// Actor is a GitHub login, compared case-insensitively with both the
+	// actor and the triggering_actor claim
+	Actor string `json:"actor,omitempty"`
+
+	// RunID is a workflow run ID
+	RunID string `json:"run_id,omitempty"`
+
+	// JTI is the ID of a single token
+	JTI string `json:"jti,omitempty"`
+
+	// Reason is reported in the denial, e.g. an incident reference
+	Reason string `json:"reason,omitempty"`
+}
+
+// key returns the lookup key of the entry, or an error unless exactly one
+// of its keys is set
+func (e DenylistEntry) key() (denylistKey, error) {
+	var keys []denylistKey
+	if e.Repository != "" {
+		keys = append(keys, denylistKey{"repository", strings.ToLower(e.Repository)})
+	}
+	if e.Actor != "" {
+		keys = append(keys, denylistKey{"actor", strings.ToLower(e.Actor)})
+	}
+	if e.RunID != "" {
+		keys = append(keys, denylistKey{"run_id", e.RunID})
+	}
+	if e.JTI != "" {
+		keys = append(keys, denylistKey{"jti", e.JTI})
+	}
+	if len(keys) != 1 {
+		return denylistKey{}, fmt.Errorf("denylist entry must set exactly one of repository, actor, run_id and jti")
+	}
+	return keys[0], nil
+}
+
+// denylistKey is a claim name and the value it is denied for
+type denylistKey struct {
+	claim string
+	value string
+}
+
+// denylistDocument is the file and remote format of a denylist
+type denylistDocument struct {
+	Entries []DenylistEntry `json:"entries"`
+}
+
+// ParseDenylist decodes a JSON or YAML denylist document:
+//
+//	entries:
+//	  - repository: myorg/compromised
+//	    reason: INC-1234
+//	  - actor: mallory
+func ParseDenylist(data []byte) ([]DenylistEntry, error) {
+	jsonData, err := yamlutil.ToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode denylist: %w", err)
+	}
+
+	var doc denylistDocument
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode denylist: %w", err)
+	}
+
+	for i, entry := range doc.Entries {
+		if _, err := entry.key(); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+	}
+	return doc.Entries, nil
+}
+
+// DenylistSource loads denylist entries, e.g. from a file or a URL
+type DenylistSource func(ctx context.Context) ([]DenylistEntry, error)
+
+// DenylistFile returns a DenylistSource that reads a denylist document
+// from a file
+func DenylistFile(path string) DenylistSource {
+	return func(context.Context) ([]DenylistEntry, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read denylist file: %w", err)
+		}
+		return ParseDenylist(data)
+	}
+}
+
+// DenylistURL returns a DenylistSource that fetches a denylist document
+// from url. A nil client uses one with DefaultHTTPTimeout.
+func DenylistURL(url string, client *http.Client) DenylistSource {
+	if client == nil {
+		client = newHTTPClient()
+	}
+
+	return func(ctx context.Context) ([]DenylistEntry, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch denylist: %w", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch denylist: status %d", resp.StatusCode)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxDenylistSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch denylist: %w", err)
+		}
+		return ParseDenylist(data)
+	}
+}
+
+// DenylistOption configures a Denylist
+type DenylistOption func(*Denylist)
+
+// WithDenylistSource adds a source of entries. Sources are loaded by
+// NewDenylist and again once they are older than the refresh interval.
+func WithDenylistSource(source DenylistSource) DenylistOption {
+	return func(d *Denylist) {
+		d.sources = append(d.sources, source)
+	}
+}
+
+// WithDenylistRefreshInterval sets how often the sources are loaded again
+func WithDenylistRefreshInterval(interval time.Duration) DenylistOption {
+	return func(d *Denylist) {
+		d.refreshInterval = interval
+	}
+}
+
+// Denylist blocks tokens by repository, actor, run ID or token ID, so that
+// operators can shut out a compromised repository or workflow without
+// editing the policy. Add it to a verifier with WithDenylist.
+//
+// Entries come from the sources, which are reloaded during a verification
+// once they are stale, and from Add. Verifications running meanwhile use
+// the previous entries, which are also kept if reloading fails.
+type Denylist struct {
+	sources         []DenylistSource
+	refreshInterval time.Duration
+	clock           Clock
+
+	refreshMu sync.Mutex // serializes reloads
+
+	mu        sync.RWMutex
+	local     map[denylistKey]DenylistEntry // added with Add
+	loaded    map[denylistKey]DenylistEntry // loaded from the sources
+	refreshed time.Time
+}
+
+// NewDenylist creates a denylist and loads its sources, failing if any of
+// them cannot be loaded
+func NewDenylist(ctx context.Context, opts ...DenylistOption) (*Denylist, error) {
+	d := &Denylist{
+		refreshInterval: DefaultDenylistRefreshInterval,
+		clock:           DefaultClock{},
+		local:           make(map[denylistKey]DenylistEntry),
+		loaded:          make(map[denylistKey]DenylistEntry),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	if err := d.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// WithDenylist denies tokens matching an entry of the denylist with
+// ErrAccessDenied. The denylist is checked right after the claims have
+// been validated, before any other check and the policy.
+func WithDenylist(denylist *Denylist) Option {
+	return func(v *Verifier) {
+		v.denylist = denylist
+	}
+}
+
+// Add denies the entry's tokens until it is removed
+func (d *Denylist) Add(entry DenylistEntry) error {
+	key, err := entry.key()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.local[key] = entry
+	return nil
+}
+
+// Remove removes an entry added with Add; the reason is ignored
+func (d *Denylist) Remove(entry DenylistEntry) {
+	key, err := entry.key()
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.local, key)
+}
+
+// Entries returns the entries added with Add and loaded from the sources
+func (d *Denylist) Entries() []DenylistEntry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	entries := make([]DenylistEntry, 0, len(d.local)+len(d.loaded))
+	for _, entry := range d.local {
+		entries = append(entries, entry)
+	}
+	for key, entry := range d.loaded {
+		if _, ok := d.local[key]; !ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Match returns the entry denying the claims, if any
+func (d *Denylist) Match(claims *GitHubActionsClaims) (DenylistEntry, bool) {
+	keys := []denylistKey{
+		{"repository", strings.ToLower(claims.Repository)},
+		{"actor", strings.ToLower(claims.Actor)},
+		{"actor", strings.ToLower(claims.TriggeringActor)},
+		{"run_id", claims.RunID},
+		{"jti", claims.ID},
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, key := range keys {
+		if key.value == "" {
+			continue
+		}
+		if entry, ok := d.local[key]; ok {
+			return entry, true
+		}
+		if entry, ok := d.loaded[key]; ok {
+			return entry, true
+		}
+	}
+	return DenylistEntry{}, false
+}
+
+// Refresh loads the sources now and replaces their entries. If any source
+// fails, the previous entries are kept.
+func (d *Denylist) Refresh(ctx context.Context) error {
+	d.refreshMu.Lock()
+	defer d.refreshMu.Unlock()
+
+	return d.refresh(ctx)
+}
+
+// refresh loads the sources
+func (d *Denylist) refresh(ctx context.Context) error {
+	loaded := make(map[denylistKey]DenylistEntry)
+	var errs []error
+	for _, source := range d.sources {
+		entries, err := source(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, entry := range entries {
+			key, err := entry.key()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			loaded[key] = entry
+		}
+	}
+
+	now := d.clock.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Retry failed sources on the next interval rather than on every
+	// verification
+	d.refreshed = now
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	d.loaded = loaded
+	return nil
+}
+
+// check denies claims matching an entry, reloading stale sources first.
+// Only one verification reloads them; the others check the current
+// entries rather than wait for it.
+func (d *Denylist) check(ctx context.Context, claims *GitHubActionsClaims) error {
+	if len(d.sources) > 0 && d.stale() && d.refreshMu.TryLock() {
+		if d.stale() {
+			// Keep the previous entries on failure
+			_ = d.refresh(ctx)
+		}
+		d.refreshMu.Unlock()
+	}
+
+	entry, ok := d.Match(claims)
+	if !ok {
+		return nil
+	}
+
+	reason := "denylisted"
+	if entry.Reason != "" {
+		reason += ": " + entry.Reason
+	}
+	return newClaimError(ErrAccessDenied, reason, map[string]any{
+		"repository": claims.Repository,
+		"actor":      claims.Actor,
+		"run_id":     claims.RunID,
+	})
+}
+
+// stale reports whether the sources are older than the refresh interval
+func (d *Denylist) stale() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.clock.Now().Sub(d.refreshed) >= d.refreshInterval
+}
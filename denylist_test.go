@@ -0,0 +1,263 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestParseDenylist(t *testing.T) {
+	entries, err := ParseDenylist([]byte(`
+entries:
+  - repository: MyOrg/Compromised
+    reason: INC-1234
+  - actor: mallory
+  - run_id: "987654321"
+  - jti: token-1
+`))
+	if err != nil {
+		t.Fatalf("ParseDenylist() error = %v", err)
+	}
+	if len(entries) != 4 || entries[0].Reason != "INC-1234" {
+		t.Errorf("ParseDenylist() = %+v", entries)
+	}
+
+	invalid := []string{
+		`{"entries": [{"reason": "no key"}]}`,
+		`{"entries": [{"repository": "myorg/a", "actor": "mallory"}]}`,
+		`{"entries": [{"workflow": "CI"}]}`,
+		`entries: [`,
+	}
+	for _, doc := range invalid {
+		if _, err := ParseDenylist([]byte(doc)); err == nil {
+			t.Errorf("ParseDenylist(%s) error = nil, want error", doc)
+		}
+	}
+}
+
+func TestDenylist_Match(t *testing.T) {
+	denylist, err := NewDenylist(context.Background())
+	if err != nil {
+		t.Fatalf("NewDenylist() error = %v", err)
+	}
+	for _, entry := range []DenylistEntry{
+		{Repository: "MyOrg/Compromised", Reason: "INC-1234"},
+		{Actor: "Mallory"},
+		{RunID: "987654321"},
+		{JTI: "token-1"},
+	} {
+		if err := denylist.Add(entry); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	if err := denylist.Add(DenylistEntry{Reason: "no key"}); err == nil {
+		t.Error("Add() error = nil for an entry without a key")
+	}
+
+	tests := []struct {
+		name   string
+		claims GitHubActionsClaims
+		want   bool
+	}{
+		{name: "repository", claims: GitHubActionsClaims{Repository: "myorg/compromised"}, want: true},
+		{name: "actor", claims: GitHubActionsClaims{Repository: "myorg/myrepo", Actor: "mallory"}, want: true},
+		{name: "triggering actor", claims: GitHubActionsClaims{Repository: "myorg/myrepo", Actor: "johndoe", TriggeringActor: "mallory"}, want: true},
+		{name: "run", claims: GitHubActionsClaims{Repository: "myorg/myrepo", RunID: "987654321"}, want: true},
+		{name: "other repository", claims: GitHubActionsClaims{Repository: "myorg/myrepo", Actor: "johndoe", RunID: "1"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := denylist.Match(&tt.claims); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	denylist.Remove(DenylistEntry{Actor: "mallory"})
+	if _, ok := denylist.Match(&GitHubActionsClaims{Actor: "mallory"}); ok {
+		t.Error("Match() = true after Remove")
+	}
+	if got := len(denylist.Entries()); got != 3 {
+		t.Errorf("len(Entries()) = %d, want 3", got)
+	}
+}
+
+func TestDenylist_Sources(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "denylist.yaml")
+	if err := os.WriteFile(file, []byte("entries:\n  - repository: myorg/a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var remote atomic.Value
+	remote.Store(`{"entries": [{"actor": "mallory"}]}`)
+	var status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if s := status.Load(); s != 0 {
+			w.WriteHeader(int(s))
+			return
+		}
+		_, _ = w.Write([]byte(remote.Load().(string)))
+	}))
+	defer server.Close()
+
+	clock := &manualClock{now: time.Now()}
+	denylist, err := NewDenylist(ctx,
+		WithDenylistSource(DenylistFile(file)),
+		WithDenylistSource(DenylistURL(server.URL, nil)),
+		WithDenylistRefreshInterval(time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("NewDenylist() error = %v", err)
+	}
+	denylist.clock = clock
+
+	denied := func(claims *GitHubActionsClaims) bool {
+		return errors.Is(denylist.check(ctx, claims), ErrAccessDenied)
+	}
+	if !denied(&GitHubActionsClaims{Repository: "myorg/a"}) || !denied(&GitHubActionsClaims{Actor: "mallory"}) {
+		t.Fatal("entries of the sources are not denied")
+	}
+
+	// Changes are picked up once the sources are stale
+	if err := os.WriteFile(file, []byte("entries:\n  - repository: myorg/b\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	remote.Store(`{"entries": []}`)
+	if !denied(&GitHubActionsClaims{Repository: "myorg/a"}) {
+		t.Error("sources reloaded before the refresh interval")
+	}
+	clock.now = clock.now.Add(2 * time.Minute)
+	if denied(&GitHubActionsClaims{Repository: "myorg/a"}) || !denied(&GitHubActionsClaims{Repository: "myorg/b"}) {
+		t.Error("file changes not picked up")
+	}
+	if denied(&GitHubActionsClaims{Actor: "mallory"}) {
+		t.Error("remote changes not picked up")
+	}
+
+	// A failing source keeps the previous entries
+	status.Store(http.StatusBadGateway)
+	clock.now = clock.now.Add(2 * time.Minute)
+	if !denied(&GitHubActionsClaims{Repository: "myorg/b"}) {
+		t.Error("entries dropped after a failed reload")
+	}
+	if err := denylist.Refresh(ctx); err == nil {
+		t.Error("Refresh() error = nil with a failing source")
+	}
+
+	if _, err := NewDenylist(ctx, WithDenylistSource(DenylistURL(server.URL, nil))); err == nil {
+		t.Error("NewDenylist() error = nil with a failing source")
+	}
+}
+
+func TestDenylist_CheckDuringRefresh(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	source := func(ctx context.Context) ([]DenylistEntry, error) {
+		if calls.Add(1) > 1 {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return []DenylistEntry{{Repository: "myorg/a"}}, nil
+	}
+
+	clock := &manualClock{now: time.Now()}
+	denylist, err := NewDenylist(ctx, WithDenylistSource(source), WithDenylistRefreshInterval(time.Minute))
+	if err != nil {
+		t.Fatalf("NewDenylist() error = %v", err)
+	}
+	denylist.clock = clock
+	clock.now = clock.now.Add(2 * time.Minute)
+
+	// One verification reloads the stale source and blocks on it
+	refreshing := make(chan error)
+	go func() { refreshing <- denylist.check(ctx, &GitHubActionsClaims{Repository: "myorg/a"}) }()
+	for calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Others check the current entries without waiting
+	done := make(chan error)
+	go func() { done <- denylist.check(ctx, &GitHubActionsClaims{Repository: "myorg/a"}) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("check() error = %v, want ErrAccessDenied from the current entries", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("check() waited for the reload")
+	}
+
+	close(release)
+	if err := <-refreshing; !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("check() error = %v, want ErrAccessDenied", err)
+	}
+}
+
+func TestWithDenylist(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	denylist, err := NewDenylist(context.Background())
+	if err != nil {
+		t.Fatalf("NewDenylist() error = %v", err)
+	}
+
+	// The denylist is checked before validators and the policy
+	validated := false
+	verifier, err := New(
+		WithJWKSURL(server.JWKSURL()),
+		WithPolicy(&Policy{Rules: []Rule{{Conditions: Conditions{Repository: []string{"myorg/*"}}, Effect: EffectAllow}}, DefaultDeny: true}),
+		WithDenylist(denylist),
+		WithClaimValidator(func(context.Context, *GitHubActionsClaims) error {
+			validated = true
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	claims := testutil.DefaultClaims().ToJWT()
+	claims["jti"] = "token-1"
+	token, err := gen.GenerateToken(claims)
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := verifier.Verify(ctx, token); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	if err := denylist.Add(DenylistEntry{JTI: "token-1", Reason: "INC-1234"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	validated = false
+	_, err = verifier.Verify(ctx, token)
+	if !errors.Is(err, ErrAccessDenied) || !strings.Contains(err.Error(), "INC-1234") {
+		t.Errorf("Verify() error = %v, want denylisted ErrAccessDenied", err)
+	}
+	if validated {
+		t.Error("claim validator ran for a denylisted token")
+	}
+}
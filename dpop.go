@@ -0,0 +1,278 @@
+package ghaauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DPoPHeader is the request header carrying a DPoP proof
+	DPoPHeader = "DPoP"
+
+	// DefaultDPoPProofMaxAge is how far the iat of a DPoP proof may be
+	// from the current time
+	DefaultDPoPProofMaxAge = time.Minute
+)
+
+// dpopAlgorithms are the signing algorithms accepted for DPoP proofs, with
+// the curve required of EC keys
+var dpopAlgorithms = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"RS256": nil,
+	"PS256": nil,
+}
+
+// WithDPoP requires every token to be accompanied by a DPoP proof (RFC
+// 9449) given with WithDPoPProof or WithDPoPRequest, so that only the
+// workflow holding the proof's private key can use the token. Each proof
+// must be signed by the key in its jwk header, be bound to the token with
+// the ath claim and to the request with htm and htu, be issued within
+// DefaultDPoPProofMaxAge and not have been used before. The key's
+// thumbprint is returned in VerificationResult.DPoPThumbprint, for binding
+// the session tokens or credentials issued in exchange to the same key.
+//
+// Without WithDPoP, proofs are verified when given but not required.
+func WithDPoP() Option {
+	return func(v *Verifier) {
+		v.dpopRequired = true
+	}
+}
+
+// dpopProof is a DPoP proof and the request it was sent with
+type dpopProof struct {
+	proof  string
+	method string
+	url    string
+}
+
+// WithDPoPProof verifies a DPoP proof sent with the token in a request
+// with the given method and URL
+func WithDPoPProof(proof, method, url string) VerifyOption {
+	return func(c *verifyConfig) {
+		c.dpop = &dpopProof{proof: proof, method: method, url: url}
+	}
+}
+
+// WithDPoPRequest verifies the DPoP proof in the DPoP header of r, if any.
+// The request URL is taken to be https://<Host><Path>, as seen by the
+// client in front of any TLS-terminating proxy; use WithDPoPProof when it
+// differs.
+func WithDPoPRequest(r *http.Request) VerifyOption {
+	return func(c *verifyConfig) {
+		proofs := r.Header.Values(DPoPHeader)
+		switch len(proofs) {
+		case 0:
+		case 1:
+			c.dpop = &dpopProof{proof: proofs[0], method: r.Method, url: "https://" + r.Host + r.URL.Path}
+		default:
+			c.dpopErr = NewValidationError(ErrInvalidDPoPProof, "more than one DPoP proof")
+		}
+	}
+}
+
+// dpopClaims are the claims of a DPoP proof
+type dpopClaims struct {
+	jwt.RegisteredClaims
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath"`
+}
+
+// dpopJWK is the public key in the jwk header of a DPoP proof
+type dpopJWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	D   string `json:"d"`
+}
+
+// checkDPoP verifies the DPoP proof of a verification, if any or required,
+// and returns the thumbprint of its key
+func (v *Verifier) checkDPoP(cfg verifyConfig, tokenString string) (string, error) {
+	if cfg.dpopErr != nil {
+		return "", cfg.dpopErr
+	}
+	if cfg.dpop == nil {
+		if v.dpopRequired {
+			return "", NewValidationError(ErrInvalidDPoPProof, "DPoP proof required")
+		}
+		return "", nil
+	}
+
+	var thumbprint string
+	claims := &dpopClaims{}
+	_, err := jwt.ParseWithClaims(cfg.dpop.proof, claims, func(proof *jwt.Token) (any, error) {
+		if typ, _ := proof.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, fmt.Errorf("typ must be dpop+jwt")
+		}
+		key, tp, err := parseDPoPKey(proof.Header["jwk"], proof.Method.Alg())
+		thumbprint = tp
+		return key, err
+	}, jwt.WithValidMethods(slices.Sorted(maps.Keys(dpopAlgorithms))), jwt.WithTimeFunc(v.clock.Now))
+	if err != nil {
+		return "", NewValidationError(ErrInvalidDPoPProof, err.Error())
+	}
+
+	if err := v.checkDPoPClaims(claims, cfg.dpop, tokenString); err != nil {
+		return "", NewValidationError(ErrInvalidDPoPProof, err.Error())
+	}
+
+	// Proofs are single-use, per key
+	if !v.dpopReplay.add(thumbprint+"."+claims.ID, claims.IssuedAt.Add(DefaultDPoPProofMaxAge), v.clock.Now()) {
+		return "", NewValidationError(ErrInvalidDPoPProof, "proof has already been used")
+	}
+	return thumbprint, nil
+}
+
+// checkDPoPClaims checks that a proof is fresh and bound to the token and
+// the request
+func (v *Verifier) checkDPoPClaims(claims *dpopClaims, req *dpopProof, tokenString string) error {
+	if claims.ID == "" {
+		return fmt.Errorf("jti claim is required")
+	}
+	if claims.IssuedAt == nil {
+		return fmt.Errorf("iat claim is required")
+	}
+	if age := v.clock.Now().Sub(claims.IssuedAt.Time); age > DefaultDPoPProofMaxAge || age < -DefaultDPoPProofMaxAge {
+		return fmt.Errorf("proof was issued %s from now, more than %s", age.Round(time.Second), DefaultDPoPProofMaxAge)
+	}
+
+	if claims.HTM != req.method {
+		return fmt.Errorf("htm %q does not match the request method %q", claims.HTM, req.method)
+	}
+	htu, ok := normalizeHTU(claims.HTU)
+	if want, _ := normalizeHTU(req.url); !ok || htu != want {
+		return fmt.Errorf("htu %q does not match the request URL %q", claims.HTU, req.url)
+	}
+
+	sum := sha256.Sum256([]byte(tokenString))
+	ath := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(claims.ATH), []byte(ath)) != 1 {
+		return fmt.Errorf("ath does not match the token")
+	}
+	return nil
+}
+
+// normalizeHTU reduces a URL to the parts compared for htu: the scheme and
+// host, case-insensitively, and the path, without query and fragment
+func normalizeHTU(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", false
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + u.EscapedPath(), true
+}
+
+// parseDPoPKey returns the public key in the jwk header of a proof and its
+// RFC 7638 thumbprint, checking that it suits the algorithm
+func parseDPoPKey(header any, alg string) (crypto.PublicKey, string, error) {
+	raw, err := json.Marshal(header)
+	if err != nil || header == nil {
+		return nil, "", fmt.Errorf("jwk header is required")
+	}
+	var jwk dpopJWK
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return nil, "", fmt.Errorf("invalid jwk header: %v", err)
+	}
+	if jwk.D != "" {
+		return nil, "", fmt.Errorf("jwk header must not contain a private key")
+	}
+
+	switch curve := dpopAlgorithms[alg]; {
+	case curve != nil && jwk.Kty == "EC" && jwk.Crv == curve.Params().Name:
+		key, err := ecKey(curve, jwk.X, jwk.Y)
+		if err != nil {
+			return nil, "", err
+		}
+		return key, ecThumbprint(key), nil
+	case curve == nil && jwk.Kty == "RSA":
+		key, err := jwkToPublicKey(JWK{N: jwk.N, E: jwk.E})
+		if err != nil {
+			return nil, "", err
+		}
+		return key, Thumbprint(key), nil
+	default:
+		return nil, "", fmt.Errorf("jwk of type %q does not suit algorithm %s", jwk.Kty, alg)
+	}
+}
+
+// ecKey decodes the coordinates of an EC public key
+func ecKey(curve elliptic.Curve, x, y string) (*ecdsa.PublicKey, error) {
+	size := (curve.Params().BitSize + 7) / 8
+	xBytes, errX := base64.RawURLEncoding.DecodeString(x)
+	yBytes, errY := base64.RawURLEncoding.DecodeString(y)
+	if errX != nil || errY != nil || len(xBytes) != size || len(yBytes) != size {
+		return nil, fmt.Errorf("invalid EC coordinates")
+	}
+
+	point := append([]byte{4}, append(xBytes, yBytes...)...)
+	key, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EC key: %v", err)
+	}
+	return key, nil
+}
+
+// ecThumbprint returns the RFC 7638 JWK thumbprint of an EC public key
+func ecThumbprint(key *ecdsa.PublicKey) string {
+	point, _ := key.Bytes()
+	size := (len(point) - 1) / 2
+	x := base64.RawURLEncoding.EncodeToString(point[1 : 1+size])
+	y := base64.RawURLEncoding.EncodeToString(point[1+size:])
+
+	// Required members in lexicographic order, without whitespace
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, key.Curve.Params().Name, x, y)
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// replayCache remembers single-use identifiers until they expire
+type replayCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextPrune time.Time
+}
+
+// add records id until expiry, reporting false if it is already recorded
+func (c *replayCache) add(id string, expiry, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+	if now.After(c.nextPrune) {
+		for seenID, seenExpiry := range c.seen {
+			if now.After(seenExpiry) {
+				delete(c.seen, seenID)
+			}
+		}
+		c.nextPrune = now.Add(DefaultDPoPProofMaxAge)
+	}
+
+	if seenExpiry, ok := c.seen[id]; ok && !now.After(seenExpiry) {
+		return false
+	}
+	c.seen[id] = expiry
+	return true
+}
@@ -0,0 +1,192 @@
+package ghaauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestVerifier_DPoP(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	key, err := testutil.NewDPoPKey()
+	if err != nil {
+		t.Fatalf("failed to create DPoP key: %v", err)
+	}
+	_, thumbprint, err := parseDPoPKey(key.JWK(), "ES256")
+	if err != nil {
+		t.Fatalf("parseDPoPKey() error = %v", err)
+	}
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	const endpoint = "https://api.example.com/exchange"
+
+	tests := []struct {
+		name     string
+		required bool
+		method   string
+		url      string
+		token    string
+		extra    jwt.MapClaims
+		noProof  bool
+		wantCode ErrorCode
+	}{
+		{name: "valid proof", required: true},
+		{name: "query and case ignored", required: true, url: "HTTPS://API.example.com/exchange?x=1"},
+		{name: "optional proof", noProof: true},
+		{name: "optional proof given", extra: jwt.MapClaims{"htm": "GET"}, wantCode: CodeInvalidDPoPProof},
+		{name: "missing proof", required: true, noProof: true, wantCode: CodeInvalidDPoPProof},
+		{name: "wrong method", required: true, method: "GET", wantCode: CodeInvalidDPoPProof},
+		{name: "wrong url", required: true, url: "https://api.example.com/other", wantCode: CodeInvalidDPoPProof},
+		{name: "bound to another token", required: true, token: "other", wantCode: CodeInvalidDPoPProof},
+		{name: "stale proof", required: true, extra: jwt.MapClaims{"iat": time.Now().Add(-5 * time.Minute).Unix()}, wantCode: CodeInvalidDPoPProof},
+		{name: "missing jti", required: true, extra: jwt.MapClaims{"jti": ""}, wantCode: CodeInvalidDPoPProof},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithJWKSURL(server.URL() + "/.well-known/jwks")}
+			if tt.required {
+				opts = append(opts, WithDPoP())
+			}
+			verifier, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			var verifyOpts []VerifyOption
+			if !tt.noProof {
+				url, bound := endpoint, token
+				if tt.url != "" {
+					url = tt.url
+				}
+				if tt.token != "" {
+					bound = tt.token
+				}
+				proof, err := key.Proof(http.MethodPost, url, bound, tt.extra)
+				if err != nil {
+					t.Fatalf("failed to create proof: %v", err)
+				}
+				method := http.MethodPost
+				if tt.method != "" {
+					method = tt.method
+				}
+				verifyOpts = append(verifyOpts, WithDPoPProof(proof, method, endpoint))
+			}
+
+			result, err := verifier.VerifyWith(context.Background(), token, verifyOpts...)
+			if code := ErrorCodeOf(err); code != tt.wantCode {
+				t.Fatalf("VerifyWith() error code = %q, want %q (error: %v)", code, tt.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+
+			want := thumbprint
+			if tt.noProof {
+				want = ""
+			}
+			if result.DPoPThumbprint != want {
+				t.Errorf("DPoPThumbprint = %q, want %q", result.DPoPThumbprint, want)
+			}
+		})
+	}
+
+	t.Run("replayed proof", func(t *testing.T) {
+		verifier, err := New(WithDPoP(), WithJWKSURL(server.URL()+"/.well-known/jwks"))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		proof, err := key.Proof(http.MethodPost, endpoint, token, nil)
+		if err != nil {
+			t.Fatalf("failed to create proof: %v", err)
+		}
+
+		if _, err := verifier.VerifyWith(context.Background(), token, WithDPoPProof(proof, http.MethodPost, endpoint)); err != nil {
+			t.Fatalf("VerifyWith() error = %v", err)
+		}
+		_, err = verifier.VerifyWith(context.Background(), token, WithDPoPProof(proof, http.MethodPost, endpoint))
+		if code := ErrorCodeOf(err); code != CodeInvalidDPoPProof {
+			t.Errorf("VerifyWith() error code = %q, want %q for a replayed proof", code, CodeInvalidDPoPProof)
+		}
+	})
+}
+
+func TestMiddleware_DPoP(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(WithDPoP(), WithJWKSURL(server.URL()+"/.well-known/jwks"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	key, err := testutil.NewDPoPKey()
+	if err != nil {
+		t.Fatalf("failed to create DPoP key: %v", err)
+	}
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	var got string
+	handler := Middleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, _ := FromContext(r.Context())
+		got = result.DPoPThumbprint
+	}))
+
+	tests := []struct {
+		name       string
+		proofs     int
+		wantStatus int
+	}{
+		{name: "proof sent", proofs: 1, wantStatus: http.StatusOK},
+		{name: "no proof", wantStatus: http.StatusUnauthorized},
+		{name: "two proofs", proofs: 2, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			req := httptest.NewRequest(http.MethodPost, "https://api.example.com/deploy", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			for range tt.proofs {
+				proof, err := key.Proof(http.MethodPost, "https://api.example.com/deploy", token, nil)
+				if err != nil {
+					t.Fatalf("failed to create proof: %v", err)
+				}
+				req.Header.Add(DPoPHeader, proof)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && got == "" {
+				t.Error("DPoPThumbprint is empty")
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Package echoghaauth provides Echo middleware for verifying GitHub Actions
+// OIDC tokens with ghaauth.
+package echoghaauth
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// resultKey is the echo.Context key for the verification result
+const resultKey = "ghaauth.result"
+
+// Option configures the middleware
+type Option func(*config)
+
+// config holds the middleware settings
+type config struct {
+	errorHandler func(echo.Context, error) error
+}
+
+// WithErrorHandler sets how verification failures are turned into the error
+// returned from the middleware
+func WithErrorHandler(handler func(echo.Context, error) error) Option {
+	return func(c *config) {
+		c.errorHandler = handler
+	}
+}
+
+// Middleware returns an echo.MiddlewareFunc that verifies the bearer token
+// and its DPoP proof, if any, and stores the VerificationResult in the
+// echo.Context and, for ghaauth.FromContext, in the request context
+func Middleware(verifier ghaauth.TokenVerifier, opts ...Option) echo.MiddlewareFunc {
+	cfg := &config{
+		errorHandler: defaultErrorHandler,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			token, err := ghaauth.ParseBearerToken(req.Header.Get("Authorization"))
+			if err != nil {
+				return cfg.errorHandler(c, err)
+			}
+
+			result, err := verifier.VerifyWith(req.Context(), token, ghaauth.WithDPoPRequest(req))
+			if err != nil {
+				return cfg.errorHandler(c, err)
+			}
+
+			c.Set(resultKey, result)
+			c.SetRequest(req.WithContext(ghaauth.NewContext(req.Context(), result)))
+			return next(c)
+		}
+	}
+}
+
+// ResultFromContext returns the VerificationResult stored by Middleware
+func ResultFromContext(c echo.Context) (*ghaauth.VerificationResult, bool) {
+	result, ok := c.Get(resultKey).(*ghaauth.VerificationResult)
+	return result, ok
+}
+
+// ClaimsFromContext returns the verified claims stored by Middleware
+func ClaimsFromContext(c echo.Context) (*ghaauth.GitHubActionsClaims, bool) {
+	result, ok := ResultFromContext(c)
+	if !ok {
+		return nil, false
+	}
+	return result.Claims, true
+}
+
+// defaultErrorHandler returns an *echo.HTTPError with the status from
+// ghaauth.HTTPStatus, keeping the verification error as the internal cause
+func defaultErrorHandler(c echo.Context, err error) error {
+	status := ghaauth.HTTPStatus(err)
+	if status == http.StatusUnauthorized {
+		c.Response().Header().Set("WWW-Authenticate", "Bearer")
+	}
+	return echo.NewHTTPError(status, http.StatusText(status)).SetInternal(err)
+}
@@ -0,0 +1,107 @@
+package echoghaauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+	"github.com/dev-shimada/gha-auth/ghaauthtest"
+)
+
+func TestMiddleware(t *testing.T) {
+	gen, err := ghaauthtest.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := ghaauthtest.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := ghaauth.New(
+		ghaauth.WithPolicy(&ghaauth.Policy{
+			Rules: []ghaauth.Rule{
+				{
+					Name:       "allow-myorg",
+					Conditions: ghaauth.Conditions{RepositoryOwner: []string{"myorg"}},
+					Effect:     ghaauth.EffectAllow,
+				},
+			},
+			DefaultDeny: true,
+		}),
+		ghaauth.WithAudience("https://api.example.com"),
+		ghaauth.WithJWKSURL(server.URL()+"/.well-known/jwks"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	validToken, err := gen.GenerateToken(ghaauthtest.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	deniedClaims := ghaauthtest.DefaultClaims()
+	deniedClaims.RepositoryOwner = "otherorg"
+	deniedToken, err := gen.GenerateToken(deniedClaims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	router := echo.New()
+	router.Use(Middleware(verifier))
+	router.GET("/", func(c echo.Context) error {
+		claims, ok := ClaimsFromContext(c)
+		if !ok {
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		if _, ok := ghaauth.FromContext(c.Request().Context()); !ok {
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		return c.String(http.StatusOK, claims.Repository)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantBody      string
+	}{
+		{
+			name:          "valid token",
+			authorization: "Bearer " + validToken,
+			wantStatus:    http.StatusOK,
+			wantBody:      "myorg/myrepo",
+		},
+		{
+			name:       "missing token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "denied by policy",
+			authorization: "Bearer " + deniedToken,
+			wantStatus:    http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package ghaauth
+
+import "strings"
+
+// IsEnvironmentScoped reports whether the token was issued for a job
+// running in a deployment environment, whose sub is in GitHub's default
+// format for environments (e.g. "repo:myorg/myrepo:environment:production")
+// and names the token's repository and environment, instead of the branch,
+// tag or pull request. Tokens with customized subject templates are never
+// environment-scoped. Such a job only ran after the environment's
+// protection rules, like required reviewers, passed if the environment has
+// protection rules configured; for environments without them,
+// environment-scoped tokens prove nothing more than the environment name.
+func (c *GitHubActionsClaims) IsEnvironmentScoped() bool {
+	if c.Environment == "" {
+		return false
+	}
+	sub, err := ParseSubject(c.Subject)
+	return err == nil && sub.Environment == c.Environment && strings.EqualFold(sub.Repository, c.Repository)
+}
+
+// environmentScopeResult is the evaluation result when
+// RequireEnvironmentScopedToken applies
+func environmentScopeResult() *EvaluationResult {
+	return &EvaluationResult{
+		Allowed: false,
+		Reason:  "token is not environment-scoped",
+
+		precondition: "require_environment_scoped_token",
+	}
+}
+
+// deniesUnscoped reports whether RequireEnvironmentScopedToken rejects the
+// claims
+func (p *Policy) deniesUnscoped(claims *GitHubActionsClaims) bool {
+	return p.RequireEnvironmentScopedToken && !claims.IsEnvironmentScoped()
+}
@@ -0,0 +1,77 @@
+package ghaauth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestGitHubActionsClaims_IsEnvironmentScoped(t *testing.T) {
+	claims := func(sub, environment string) GitHubActionsClaims {
+		return GitHubActionsClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: sub}, Repository: "myorg/myrepo", Environment: environment}
+	}
+
+	tests := []struct {
+		name   string
+		claims GitHubActionsClaims
+		want   bool
+	}{
+		{name: "environment subject", claims: claims("repo:myorg/myrepo:environment:production", "production"), want: true},
+		{name: "repository in another case", claims: claims("repo:MyOrg/MyRepo:environment:production", "production"), want: true},
+		{name: "customized subject with environment", claims: claims("repo:myorg/myrepo:environment:production:ref:refs/heads/main", "production")},
+		{name: "subject of an environment with the claim as prefix", claims: claims("repo:myorg/myrepo:environment:production-eu", "production")},
+		{name: "subject of another repository", claims: claims("repo:myorg/other:environment:production", "production")},
+		{name: "branch subject", claims: claims("repo:myorg/myrepo:ref:refs/heads/main", "")},
+		{name: "environment claim with branch subject", claims: claims("repo:myorg/myrepo:ref:refs/heads/main", "production")},
+		{name: "environment subject without claim", claims: claims("repo:myorg/myrepo:environment:production", "")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.claims.IsEnvironmentScoped(); got != tt.want {
+				t.Errorf("IsEnvironmentScoped() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_RequireEnvironmentScopedToken(t *testing.T) {
+	policy := &Policy{
+		Rules: []Rule{
+			{
+				Name:       "allow-org",
+				Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+				Effect:     EffectAllow,
+			},
+		},
+		DefaultDeny:                   true,
+		RequireEnvironmentScopedToken: true,
+	}
+
+	environment := &GitHubActionsClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "repo:myorg/myrepo:environment:production"}, Repository: "myorg/myrepo", RepositoryOwner: "myorg", Environment: "production"}
+	branch := &GitHubActionsClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "repo:myorg/myrepo:ref:refs/heads/main"}, RepositoryOwner: "myorg", Ref: "refs/heads/main"}
+
+	for name, evaluate := range map[string]func(*GitHubActionsClaims) *EvaluationResult{
+		"Policy":         policy.Evaluate,
+		"CompiledPolicy": policy.Compile().Evaluate,
+	} {
+		if result := evaluate(environment); !result.Allowed {
+			t.Errorf("%s.Evaluate() = %+v for an environment-scoped token", name, result)
+		}
+		if result := evaluate(branch); result.Allowed {
+			t.Errorf("%s.Evaluate() = %+v for a branch-scoped token", name, result)
+		}
+	}
+
+	info := policy.explainDenial(branch, time.Now(), policy.Evaluate(branch), DenialDetailRule)
+	if len(info.Conditions) != 1 || info.Conditions[0] != "require_environment_scoped_token" {
+		t.Errorf("explainDenial() conditions = %v, want [require_environment_scoped_token]", info.Conditions)
+	}
+
+	expr, _, err := policy.ExportGCPAttributeCondition()
+	if err != nil || !strings.Contains(expr, celEnvironmentScoped) {
+		t.Errorf("ExportGCPAttributeCondition() = %q, %v, want the environment scope check", expr, err)
+	}
+}
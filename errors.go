@@ -29,12 +29,107 @@ var (
 
 	// ErrKeyNotFound is returned when the signing key is not found in JWKS
 	ErrKeyNotFound = errors.New("signing key not found")
+
+	// ErrUntrustedKey is returned when a fetched signing key is not pinned
+	ErrUntrustedKey = errors.New("untrusted signing key")
+
+	// ErrMissingToken is returned when a request carries no bearer token
+	ErrMissingToken = errors.New("missing bearer token")
+
+	// ErrRateLimited is returned when a RateLimiter throttles the caller
+	ErrRateLimited = errors.New("rate limit exceeded")
+
+	// ErrUnknownTenant is returned when a Registry has no verifier for a
+	// tenant or audience
+	ErrUnknownTenant = errors.New("unknown tenant")
+
+	// ErrNonceMismatch is returned when a token is not bound to the nonce
+	// of the request
+	ErrNonceMismatch = errors.New("nonce mismatch")
+
+	// ErrInvalidDPoPProof is returned when a required DPoP proof is
+	// missing or invalid
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+	// ErrGitHubAPI is returned when a GitHubEnricher cannot reach the
+	// GitHub API
+	ErrGitHubAPI = errors.New("GitHub API request failed")
 )
 
+// ErrorCode is a stable, machine-readable identifier for a verification
+// failure, suitable for API responses
+type ErrorCode string
+
+const (
+	CodeInvalidToken         ErrorCode = "invalid_token"
+	CodeTokenExpired         ErrorCode = "token_expired"
+	CodeInvalidSignature     ErrorCode = "invalid_signature"
+	CodeAudienceMismatch     ErrorCode = "audience_mismatch"
+	CodeInvalidIssuer        ErrorCode = "invalid_issuer"
+	CodePolicyDenied         ErrorCode = "policy_denied"
+	CodeJWKSUnavailable      ErrorCode = "jwks_unavailable"
+	CodeKeyNotFound          ErrorCode = "key_not_found"
+	CodeUntrustedKey         ErrorCode = "untrusted_key"
+	CodeMissingToken         ErrorCode = "missing_token"
+	CodeRateLimited          ErrorCode = "rate_limited"
+	CodeUnknownTenant        ErrorCode = "unknown_tenant"
+	CodeNonceMismatch        ErrorCode = "nonce_mismatch"
+	CodeInvalidDPoPProof     ErrorCode = "invalid_dpop_proof"
+	CodeGitHubAPIUnavailable ErrorCode = "github_api_unavailable"
+)
+
+// errorCodes maps the sentinel errors to their codes
+var errorCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{ErrInvalidToken, CodeInvalidToken},
+	{ErrTokenExpired, CodeTokenExpired},
+	{ErrInvalidSignature, CodeInvalidSignature},
+	{ErrInvalidAudience, CodeAudienceMismatch},
+	{ErrInvalidIssuer, CodeInvalidIssuer},
+	{ErrAccessDenied, CodePolicyDenied},
+	{ErrJWKSFetch, CodeJWKSUnavailable},
+	{ErrKeyNotFound, CodeKeyNotFound},
+	{ErrUntrustedKey, CodeUntrustedKey},
+	{ErrMissingToken, CodeMissingToken},
+	{ErrRateLimited, CodeRateLimited},
+	{ErrUnknownTenant, CodeUnknownTenant},
+	{ErrNonceMismatch, CodeNonceMismatch},
+	{ErrInvalidDPoPProof, CodeInvalidDPoPProof},
+	{ErrGitHubAPI, CodeGitHubAPIUnavailable},
+}
+
+// ErrorCodeOf returns the code of an error returned by this package, or an
+// empty code for other errors
+func ErrorCodeOf(err error) ErrorCode {
+	var valErr *ValidationError
+	if errors.As(err, &valErr) && valErr.Code != "" {
+		return valErr.Code
+	}
+
+	for _, ec := range errorCodes {
+		if errors.Is(err, ec.err) {
+			return ec.code
+		}
+	}
+	return ""
+}
+
 // ValidationError wraps an error with additional context
 type ValidationError struct {
 	Err    error
 	Reason string
+
+	// Code identifies the failure; it is derived from Err
+	Code ErrorCode
+
+	// Claims holds the offending claim values, if any (e.g. "aud" for an
+	// audience mismatch)
+	Claims map[string]any
+
+	// Denial explains a policy denial (ErrAccessDenied only)
+	Denial *DenialInfo
 }
 
 func (e *ValidationError) Error() string {
@@ -53,6 +148,17 @@ func NewValidationError(err error, reason string) error {
 	return &ValidationError{
 		Err:    err,
 		Reason: reason,
+		Code:   ErrorCodeOf(err),
+	}
+}
+
+// newClaimError creates a ValidationError carrying the offending claims
+func newClaimError(err error, reason string, claims map[string]any) error {
+	return &ValidationError{
+		Err:    err,
+		Reason: reason,
+		Code:   ErrorCodeOf(err),
+		Claims: claims,
 	}
 }
 
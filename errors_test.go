@@ -2,6 +2,7 @@ package ghaauth
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -87,6 +88,8 @@ func TestSentinelErrors(t *testing.T) {
 		ErrAccessDenied,
 		ErrJWKSFetch,
 		ErrKeyNotFound,
+		ErrNonceMismatch,
+		ErrInvalidDPoPProof,
 	}
 
 	for i, err1 := range sentinels {
@@ -97,3 +100,29 @@ func TestSentinelErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{name: "validation error", err: NewValidationError(ErrTokenExpired, "token has expired"), want: CodeTokenExpired},
+		{name: "audience", err: NewValidationError(ErrInvalidAudience, ""), want: CodeAudienceMismatch},
+		{name: "policy denial", err: NewValidationError(ErrAccessDenied, "no rule matched"), want: CodePolicyDenied},
+		{name: "bare sentinel", err: ErrMissingToken, want: CodeMissingToken},
+		{name: "rate limited", err: NewValidationError(ErrRateLimited, "too many requests"), want: CodeRateLimited},
+		{name: "unknown tenant", err: NewValidationError(ErrUnknownTenant, "no verifier"), want: CodeUnknownTenant},
+		{name: "wrapped", err: fmt.Errorf("verify: %w", NewValidationError(ErrJWKSFetch, "HTTP 503")), want: CodeJWKSUnavailable},
+		{name: "foreign error", err: errors.New("boom"), want: ""},
+		{name: "nil", err: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorCodeOf(tt.err); got != tt.want {
+				t.Errorf("ErrorCodeOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
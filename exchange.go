@@ -0,0 +1,148 @@
+package ghaauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxExchangeRequestSize limits the size of exchange request bodies
+const maxExchangeRequestSize = 64 << 10
+
+// ExchangeRequest is the JSON body of a credential exchange request. All
+// fields are optional; the token may instead be sent as a bearer token.
+type ExchangeRequest struct {
+	// Token is the GitHub Actions OIDC token
+	Token string `json:"token,omitempty"`
+
+	// Target names the credentials wanted, e.g. an IAM role ARN or a Vault
+	// role, for issuers that serve more than one
+	Target string `json:"target,omitempty"`
+
+	// DurationSeconds is the requested lifetime of the credentials
+	DurationSeconds int `json:"duration_seconds,omitempty"`
+}
+
+// CredentialRequest is a verified exchange request passed to a
+// CredentialIssuer
+type CredentialRequest struct {
+	// Token is the raw OIDC token, for issuers that exchange it again, such
+	// as AWS STS AssumeRoleWithWebIdentity
+	Token string
+
+	// Result is the verification result of the token
+	Result *VerificationResult
+
+	// Target is the requested target, if any
+	Target string
+
+	// Duration is the requested lifetime, or 0 for the issuer's default
+	Duration time.Duration
+}
+
+// Credentials are short-lived credentials returned by an exchange
+type Credentials struct {
+	// Type identifies the kind of credentials, e.g. "aws" or "vault"
+	Type string `json:"type"`
+
+	// Values are the credentials themselves, e.g. "access_key_id",
+	// "secret_access_key" and "session_token" for AWS
+	Values map[string]string `json:"credentials"`
+
+	// ExpiresAt is when the credentials expire
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CredentialIssuer produces credentials for verified callers, such as an
+// AWS STS, Vault or custom backend. Returning an error wrapping
+// ErrAccessDenied refuses the caller; other errors are reported as
+// upstream failures.
+type CredentialIssuer interface {
+	IssueCredentials(ctx context.Context, req *CredentialRequest) (*Credentials, error)
+}
+
+// CredentialIssuerFunc adapts a function to the CredentialIssuer interface
+type CredentialIssuerFunc func(ctx context.Context, req *CredentialRequest) (*Credentials, error)
+
+// IssueCredentials calls f(ctx, req)
+func (f CredentialIssuerFunc) IssueCredentials(ctx context.Context, req *CredentialRequest) (*Credentials, error) {
+	return f(ctx, req)
+}
+
+// ExchangeHandler returns an http.Handler that exchanges GitHub Actions
+// OIDC tokens for credentials from issuer. It accepts POST requests with an
+// optional ExchangeRequest body; a token in the body takes precedence over
+// the one found by the token extractor. The token is verified and its
+// policy evaluated like in Middleware, whose options apply here too, and
+// the Credentials are returned as JSON. Issuer failures other than access
+// denials are answered with 502 Bad Gateway without details.
+func ExchangeHandler(verifier TokenVerifier, issuer CredentialIssuer, opts ...MiddlewareOption) http.Handler {
+	cfg := newMiddlewareConfig(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		req, err := decodeExchangeRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token := req.Token
+		if token == "" {
+			if token, err = cfg.tokenExtractor(r); err != nil {
+				cfg.errorHandler(w, r, err)
+				return
+			}
+		}
+
+		result, err := cfg.verify(r, verifier, token)
+		if err != nil {
+			cfg.errorHandler(w, r, err)
+			return
+		}
+
+		creds, err := issuer.IssueCredentials(r.Context(), &CredentialRequest{
+			Token:    token,
+			Result:   result,
+			Target:   req.Target,
+			Duration: time.Duration(req.DurationSeconds) * time.Second,
+		})
+		if err != nil {
+			if ErrorCodeOf(err) != "" {
+				cfg.errorHandler(w, r, err)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(creds)
+	})
+}
+
+// decodeExchangeRequest reads the optional JSON body of an exchange request
+func decodeExchangeRequest(r *http.Request) (*ExchangeRequest, error) {
+	req := &ExchangeRequest{}
+
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxExchangeRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid exchange request: %v", err)
+	}
+
+	if req.DurationSeconds < 0 {
+		return nil, fmt.Errorf("invalid exchange request: duration_seconds must not be negative")
+	}
+	return req, nil
+}
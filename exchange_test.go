@@ -0,0 +1,172 @@
+package ghaauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestExchangeHandler(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithPolicy(&Policy{
+			Rules: []Rule{{
+				Name:       "allow-myorg",
+				Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+				Effect:     EffectAllow,
+			}},
+			DefaultDeny: true,
+		}),
+		WithAudience("https://api.example.com"),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	validToken, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	deniedClaims := testutil.DefaultClaims()
+	deniedClaims.RepositoryOwner = "otherorg"
+	deniedClaims.Repository = "otherorg/repo"
+	deniedToken, err := gen.GenerateToken(deniedClaims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	var got *CredentialRequest
+	issuer := CredentialIssuerFunc(func(_ context.Context, req *CredentialRequest) (*Credentials, error) {
+		got = req
+		switch req.Target {
+		case "forbidden":
+			return nil, fmt.Errorf("%w: no role for %s", ErrAccessDenied, req.Result.Claims.Repository)
+		case "broken":
+			return nil, errors.New("sts unavailable")
+		}
+		return &Credentials{
+			Type:      "test",
+			Values:    map[string]string{"secret": "s3cr3t"},
+			ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		}, nil
+	})
+	handler := ExchangeHandler(verifier, issuer)
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		body          string
+		wantStatus    int
+		wantTarget    string
+		wantDuration  time.Duration
+	}{
+		{
+			name:       "token in body",
+			body:       fmt.Sprintf(`{"token": %q, "target": "deploy", "duration_seconds": 900}`, validToken),
+			wantStatus: http.StatusOK,
+			wantTarget: "deploy", wantDuration: 15 * time.Minute,
+		},
+		{
+			name:          "bearer token without body",
+			authorization: "Bearer " + validToken,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:       "missing token",
+			body:       `{"target": "deploy"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "denied by policy",
+			authorization: "Bearer " + deniedToken,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "denied by issuer",
+			authorization: "Bearer " + validToken,
+			body:          `{"target": "forbidden"}`,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "issuer failure",
+			authorization: "Bearer " + validToken,
+			body:          `{"target": "broken"}`,
+			wantStatus:    http.StatusBadGateway,
+		},
+		{
+			name:          "unknown field",
+			authorization: "Bearer " + validToken,
+			body:          `{"role": "deploy"}`,
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "negative duration",
+			authorization: "Bearer " + validToken,
+			body:          `{"duration_seconds": -1}`,
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "wrong method",
+			method:        http.MethodGet,
+			authorization: "Bearer " + validToken,
+			wantStatus:    http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/exchange", strings.NewReader(tt.body))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got.Token != validToken || got.Result.Claims.Repository != "myorg/myrepo" {
+				t.Errorf("issuer got token %q for %+v", got.Token, got.Result.Claims)
+			}
+			if got.Target != tt.wantTarget || got.Duration != tt.wantDuration {
+				t.Errorf("issuer got target %q, duration %v; want %q, %v", got.Target, got.Duration, tt.wantTarget, tt.wantDuration)
+			}
+
+			var creds Credentials
+			if err := json.NewDecoder(rec.Body).Decode(&creds); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if creds.Type != "test" || creds.Values["secret"] != "s3cr3t" || rec.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("response = %+v, headers = %v", creds, rec.Header())
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Package fiberghaauth provides Fiber middleware for verifying GitHub Actions
+// OIDC tokens with ghaauth.
+package fiberghaauth
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// resultKey is the fiber.Ctx locals key for the verification result
+const resultKey = "ghaauth.result"
+
+// Option configures the middleware
+type Option func(*config)
+
+// config holds the middleware settings
+type config struct {
+	errorHandler func(*fiber.Ctx, error) error
+}
+
+// WithErrorHandler sets how verification failures are written to the client
+func WithErrorHandler(handler func(*fiber.Ctx, error) error) Option {
+	return func(c *config) {
+		c.errorHandler = handler
+	}
+}
+
+// Middleware returns a fiber.Handler that verifies the bearer token and
+// its DPoP proof, if any, and stores the VerificationResult in the request
+// locals and, for ghaauth.FromContext, in the user context
+func Middleware(verifier ghaauth.TokenVerifier, opts ...Option) fiber.Handler {
+	cfg := &config{
+		errorHandler: defaultErrorHandler,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(c *fiber.Ctx) error {
+		token, err := ghaauth.ParseBearerToken(c.Get(fiber.HeaderAuthorization))
+		if err != nil {
+			return cfg.errorHandler(c, err)
+		}
+
+		dpopOpts, err := dpopProof(c)
+		if err != nil {
+			return cfg.errorHandler(c, err)
+		}
+
+		result, err := verifier.VerifyWith(c.UserContext(), token, dpopOpts...)
+		if err != nil {
+			return cfg.errorHandler(c, err)
+		}
+
+		c.Locals(resultKey, result)
+		c.SetUserContext(ghaauth.NewContext(c.UserContext(), result))
+		return c.Next()
+	}
+}
+
+// dpopProof returns the option verifying the request's DPoP proof, if any,
+// like ghaauth.WithDPoPRequest does for net/http requests
+func dpopProof(c *fiber.Ctx) ([]ghaauth.VerifyOption, error) {
+	proofs := c.Request().Header.PeekAll(ghaauth.DPoPHeader)
+	switch len(proofs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return []ghaauth.VerifyOption{ghaauth.WithDPoPProof(string(proofs[0]), c.Method(), "https://"+c.Hostname()+c.Path())}, nil
+	default:
+		return nil, ghaauth.NewValidationError(ghaauth.ErrInvalidDPoPProof, "more than one DPoP proof")
+	}
+}
+
+// ResultFromContext returns the VerificationResult stored by Middleware
+func ResultFromContext(c *fiber.Ctx) (*ghaauth.VerificationResult, bool) {
+	result, ok := c.Locals(resultKey).(*ghaauth.VerificationResult)
+	return result, ok
+}
+
+// ClaimsFromContext returns the verified claims stored by Middleware
+func ClaimsFromContext(c *fiber.Ctx) (*ghaauth.GitHubActionsClaims, bool) {
+	result, ok := ResultFromContext(c)
+	if !ok {
+		return nil, false
+	}
+	return result.Claims, true
+}
+
+// defaultErrorHandler responds with the status from ghaauth.HTTPStatus
+func defaultErrorHandler(c *fiber.Ctx, err error) error {
+	status := ghaauth.HTTPStatus(err)
+	if status == http.StatusUnauthorized {
+		c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+	}
+	return c.Status(status).JSON(fiber.Map{"error": http.StatusText(status)})
+}
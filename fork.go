@@ -0,0 +1,70 @@
+package ghaauth
+
+import "strings"
+
+// pullRequestEvents are the events whose tokens are issued for a pull request
+var pullRequestEvents = map[string]bool{
+	"pull_request":                true,
+	"pull_request_target":         true,
+	"pull_request_review":         true,
+	"pull_request_review_comment": true,
+}
+
+// IsPullRequest reports whether the token was issued for a pull request
+// event, or for a pull request merge ref
+func (c *GitHubActionsClaims) IsPullRequest() bool {
+	return pullRequestEvents[c.EventName] || c.HeadRef != "" || strings.HasPrefix(c.Ref, "refs/pull/")
+}
+
+// HeadRepositoryClaim is the Extra claim naming the head repository of a
+// pull request, "owner/name", for issuers or custom claims that carry it.
+// GitHub's tokens do not; a GitHubEnricher sets
+// GitHubActionsClaims.HeadRepository instead.
+const HeadRepositoryClaim = "head_repository"
+
+// headRepository returns the head repository of a pull request token, or
+// "" if it is not known
+func (c *GitHubActionsClaims) headRepository() string {
+	if c.HeadRepository != "" {
+		return c.HeadRepository
+	}
+	head, _ := c.ExtraString(HeadRepositoryClaim)
+	return head
+}
+
+// IsFork reports whether the token was issued for a pull request whose
+// head repository is known and differs from the repository. The head
+// repository is looked up by a GitHubEnricher, or read from the
+// HeadRepositoryClaim Extra claim; without either, IsFork is false.
+func (c *GitHubActionsClaims) IsFork() bool {
+	head := c.headRepository()
+	return c.IsPullRequest() && head != "" && !strings.EqualFold(head, c.Repository)
+}
+
+// IsPullRequestFromFork reports whether the token may have been issued for
+// code from a fork. Pull request tokens whose head repository is known are
+// from a fork if IsFork is true. GitHub's tokens name the base repository
+// in both repository and repository_owner and do not identify the head
+// repository, so without a GitHubEnricher or the HeadRepositoryClaim every
+// other pull request token is treated as possibly from a fork.
+func (c *GitHubActionsClaims) IsPullRequestFromFork() bool {
+	if c.headRepository() != "" {
+		return c.IsFork()
+	}
+	return c.IsPullRequest()
+}
+
+// forkResult is the evaluation result when DenyForkPullRequests applies
+func forkResult() *EvaluationResult {
+	return &EvaluationResult{
+		Allowed: false,
+		Reason:  "pull requests from forks are denied",
+
+		precondition: "deny_fork_pull_requests",
+	}
+}
+
+// deniesFork reports whether DenyForkPullRequests rejects the claims
+func (p *Policy) deniesFork(claims *GitHubActionsClaims) bool {
+	return p.DenyForkPullRequests && claims.IsPullRequestFromFork()
+}
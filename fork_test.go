@@ -0,0 +1,129 @@
+package ghaauth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGitHubActionsClaims_IsPullRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims GitHubActionsClaims
+		want   bool
+	}{
+		{name: "push", claims: GitHubActionsClaims{EventName: "push", Ref: "refs/heads/main"}, want: false},
+		{name: "pull_request", claims: GitHubActionsClaims{EventName: "pull_request", Ref: "refs/pull/7/merge", HeadRef: "feature"}, want: true},
+		{name: "pull_request_target", claims: GitHubActionsClaims{EventName: "pull_request_target", Ref: "refs/heads/main", HeadRef: "patch-1"}, want: true},
+		{name: "head_ref without pull request event", claims: GitHubActionsClaims{EventName: "workflow_dispatch", HeadRef: "feature"}, want: true},
+		{name: "pull request merge ref", claims: GitHubActionsClaims{EventName: "merge_group", Ref: "refs/pull/7/merge"}, want: true},
+		{name: "workflow_dispatch", claims: GitHubActionsClaims{EventName: "workflow_dispatch", Ref: "refs/heads/main"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.claims.IsPullRequest(); got != tt.want {
+				t.Errorf("IsPullRequest() = %v, want %v", got, tt.want)
+			}
+			if got := tt.claims.IsPullRequestFromFork(); got != tt.want {
+				t.Errorf("IsPullRequestFromFork() = %v, want %v", got, tt.want)
+			}
+			if tt.claims.IsFork() {
+				t.Error("IsFork() = true without a head repository")
+			}
+		})
+	}
+}
+
+func TestGitHubActionsClaims_IsFork(t *testing.T) {
+	pullRequest := func(head string, extra map[string]any) GitHubActionsClaims {
+		return GitHubActionsClaims{
+			Repository:     "myorg/api",
+			EventName:      "pull_request",
+			Ref:            "refs/pull/7/merge",
+			HeadRef:        "feature",
+			HeadRepository: head,
+			Extra:          extra,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		claims       GitHubActionsClaims
+		wantFork     bool
+		wantFromFork bool
+	}{
+		{name: "enriched fork", claims: pullRequest("someone/api", nil), wantFork: true, wantFromFork: true},
+		{name: "enriched same repository", claims: pullRequest("myorg/api", nil)},
+		{name: "same repository in another case", claims: pullRequest("MyOrg/API", nil)},
+		{name: "head repository claim", claims: pullRequest("", map[string]any{HeadRepositoryClaim: "someone/api"}), wantFork: true, wantFromFork: true},
+		{name: "unknown head repository", claims: pullRequest("", nil), wantFromFork: true},
+		{name: "push", claims: GitHubActionsClaims{Repository: "myorg/api", EventName: "push", HeadRepository: "someone/api"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.claims.IsFork(); got != tt.wantFork {
+				t.Errorf("IsFork() = %v, want %v", got, tt.wantFork)
+			}
+			if got := tt.claims.IsPullRequestFromFork(); got != tt.wantFromFork {
+				t.Errorf("IsPullRequestFromFork() = %v, want %v", got, tt.wantFromFork)
+			}
+		})
+	}
+}
+
+func TestPolicy_DenyForkPullRequests(t *testing.T) {
+	policy := &Policy{
+		Rules: []Rule{
+			{
+				Name:       "allow-org",
+				Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+				Effect:     EffectAllow,
+			},
+		},
+		DefaultDeny:          true,
+		DenyForkPullRequests: true,
+	}
+
+	tests := []struct {
+		name        string
+		claims      *GitHubActionsClaims
+		wantAllowed bool
+	}{
+		{
+			name:        "push is evaluated by the rules",
+			claims:      &GitHubActionsClaims{RepositoryOwner: "myorg", EventName: "push", Ref: "refs/heads/main"},
+			wantAllowed: true,
+		},
+		{
+			name: "pull_request_target is denied before the rules",
+			claims: &GitHubActionsClaims{
+				RepositoryOwner: "myorg",
+				EventName:       "pull_request_target",
+				Ref:             "refs/heads/main",
+				HeadRef:         "patch-1",
+			},
+			wantAllowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, result := range map[string]*EvaluationResult{
+				"Policy":         policy.Evaluate(tt.claims),
+				"CompiledPolicy": policy.Compile().Evaluate(tt.claims),
+			} {
+				if result.Allowed != tt.wantAllowed {
+					t.Errorf("%s.Evaluate() allowed = %v, want %v (%s)", name, result.Allowed, tt.wantAllowed, result.Reason)
+				}
+			}
+
+			if !tt.wantAllowed {
+				info := policy.explainDenial(tt.claims, time.Now(), policy.Evaluate(tt.claims), DenialDetailRule)
+				if len(info.Conditions) != 1 || info.Conditions[0] != "deny_fork_pull_requests" {
+					t.Errorf("explainDenial() conditions = %v, want [deny_fork_pull_requests]", info.Conditions)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package ghaauth
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// ForwardAuthHandler returns an http.Handler for the forward authentication
+// of reverse proxies such as Traefik (forwardAuth), Caddy (forward_auth)
+// and nginx (auth_request), so that any upstream can be gated without
+// code changes. It verifies the forwarded request's token like Middleware,
+// whose options apply here too, and answers 200 with the caller in the
+// X-GHA-* headers (HeaderRepository, HeaderRef, ...), or those of
+// WithIdentityHeaders, for the proxy to copy upstream; failures are
+// written by the error handler, by default 401 or 403.
+//
+// The X-Forwarded-Method, -Host and -Uri headers replace the request's
+// method, host and path before verification, so that HostAudience, policy
+// selectors and DPoP proofs see the original request: the handler must
+// only be reachable by the proxy.
+func ForwardAuthHandler(verifier TokenVerifier, opts ...MiddlewareOption) http.Handler {
+	cfg := newMiddlewareConfig(opts)
+	prefix := cfg.identityHeaders
+	if prefix == "" {
+		prefix = DefaultIdentityHeaderPrefix
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = forwardedRequest(r)
+
+		token, err := cfg.tokenExtractor(r)
+		if err != nil {
+			cfg.errorHandler(w, r, err)
+			return
+		}
+
+		result, err := cfg.verify(r, verifier, token)
+		if err != nil {
+			cfg.errorHandler(w, r, err)
+			return
+		}
+
+		setIdentityHeaders(w.Header(), prefix, result)
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// forwardedRequest returns the request as described by the X-Forwarded
+// headers of a forward authentication proxy
+func forwardedRequest(r *http.Request) *http.Request {
+	method := r.Header.Get("X-Forwarded-Method")
+	host := r.Header.Get("X-Forwarded-Host")
+	uri := r.Header.Get("X-Forwarded-Uri")
+	if method == "" && host == "" && uri == "" {
+		return r
+	}
+
+	forwarded := r.Clone(r.Context())
+	if method != "" {
+		forwarded.Method = method
+	}
+	if host != "" {
+		forwarded.Host = host
+	}
+	if uri != "" {
+		if u, err := url.ParseRequestURI(uri); err == nil {
+			forwarded.URL.Path = u.Path
+			forwarded.URL.RawPath = u.RawPath
+			forwarded.URL.RawQuery = u.RawQuery
+		}
+	}
+	return forwarded
+}
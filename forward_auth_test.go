@@ -0,0 +1,126 @@
+package ghaauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestForwardAuthHandler(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithPolicy(&Policy{
+			Rules:       []Rule{{Name: "allow-myorg", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}},
+			DefaultDeny: true,
+		}),
+		WithJWKSURL(server.JWKSURL()),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	newToken := func(owner, audience string) string {
+		t.Helper()
+		claims := testutil.DefaultClaims()
+		claims.RepositoryOwner = owner
+		claims.Repository = owner + "/myrepo"
+		claims.Environment = "production"
+		claims.Audience = []string{audience}
+		token, err := gen.GenerateToken(claims.ToJWT())
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		return token
+	}
+
+	handler := ForwardAuthHandler(verifier, WithAudienceFunc(HostAudience))
+	forward := func(token, host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://gha-auth:8080/verify", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if host != "" {
+			req.Header.Set("X-Forwarded-Method", http.MethodPost)
+			req.Header.Set("X-Forwarded-Host", host)
+			req.Header.Set("X-Forwarded-Uri", "/deploy?env=production")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		rec := forward(newToken("myorg", "https://api.example.com"), "api.example.com")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body)
+		}
+		want := map[string]string{
+			HeaderRepository:  "myorg/myrepo",
+			HeaderRef:         "refs/heads/main",
+			HeaderEnvironment: "production",
+			HeaderMatchedRule: "allow-myorg",
+		}
+		for header, value := range want {
+			if got := rec.Header().Get(header); got != value {
+				t.Errorf("%s = %q, want %q", header, got, value)
+			}
+		}
+		if rec.Header().Get(HeaderIdentity) == "" || rec.Header().Get(HeaderWorkflow) == "" {
+			t.Errorf("headers = %v, want identity and workflow", rec.Header())
+		}
+	})
+
+	t.Run("audience of the forwarded host", func(t *testing.T) {
+		rec := forward(newToken("myorg", "https://api.example.com"), "other.example.com")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401 for another host's token", rec.Code)
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		rec := forward(newToken("otherorg", "https://api.example.com"), "api.example.com")
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", rec.Code)
+		}
+		if got := rec.Header().Get(HeaderRepository); got != "" {
+			t.Errorf("%s = %q on a denied request", HeaderRepository, got)
+		}
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		rec := forward("", "api.example.com")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", rec.Code)
+		}
+	})
+}
+
+func TestForwardedRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://gha-auth/verify", nil)
+	if got := forwardedRequest(req); got != req {
+		t.Error("forwardedRequest() copied a request without X-Forwarded headers")
+	}
+
+	req.Header.Set("X-Forwarded-Method", http.MethodDelete)
+	req.Header.Set("X-Forwarded-Host", "api.example.com")
+	req.Header.Set("X-Forwarded-Uri", "/repos/a%2Fb?force=1")
+	got := forwardedRequest(req)
+	if got.Method != http.MethodDelete || got.Host != "api.example.com" {
+		t.Errorf("request = %s %s, want DELETE api.example.com", got.Method, got.Host)
+	}
+	if got.URL.Path != "/repos/a/b" || got.URL.EscapedPath() != "/repos/a%2Fb" || got.URL.RawQuery != "force=1" {
+		t.Errorf("URL = %s, want /repos/a%%2Fb?force=1", got.URL)
+	}
+	if req.Method != http.MethodGet || req.URL.Path != "/verify" {
+		t.Error("forwardedRequest() modified the original request")
+	}
+}
@@ -0,0 +1,136 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// fulcioOID returns the OID of a Fulcio certificate extension
+func fulcioOID(n int) asn1.ObjectIdentifier {
+	return asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, n}
+}
+
+// fulcioExtensions maps the Fulcio extensions to the claims they carry.
+// The extensions 1 to 6 are deprecated and hold raw strings; later ones
+// hold DER-encoded UTF8Strings and take precedence. Entries are applied
+// in order, so the legacy repository is overwritten by its successor.
+// URI values are reduced to their path, e.g. "myorg/myrepo".
+var fulcioExtensions = []struct {
+	oid    int
+	legacy int
+	uri    bool
+	set    func(c *GitHubActionsClaims, value string)
+}{
+	{0, 5, false, func(c *GitHubActionsClaims, v string) { c.Repository = v }},
+	{8, 1, false, func(c *GitHubActionsClaims, v string) { c.Issuer = v }},
+	{9, 0, true, func(c *GitHubActionsClaims, v string) { c.JobWorkflowRef = v }},
+	{10, 0, false, func(c *GitHubActionsClaims, v string) { c.JobWorkflowSHA = v }},
+	{11, 0, false, func(c *GitHubActionsClaims, v string) { c.RunnerEnvironment = v }},
+	{12, 0, true, func(c *GitHubActionsClaims, v string) { c.Repository = v }},
+	{13, 3, false, func(c *GitHubActionsClaims, v string) { c.SHA = v }},
+	{14, 6, false, func(c *GitHubActionsClaims, v string) { c.Ref = v }},
+	{15, 0, false, func(c *GitHubActionsClaims, v string) { c.RepositoryID = v }},
+	{16, 0, true, func(c *GitHubActionsClaims, v string) { c.RepositoryOwner = v }},
+	{17, 0, false, func(c *GitHubActionsClaims, v string) { c.RepositoryOwnerID = v }},
+	{18, 0, true, func(c *GitHubActionsClaims, v string) { c.WorkflowRef = v }},
+	{19, 0, false, func(c *GitHubActionsClaims, v string) { c.WorkflowSHA = v }},
+	{20, 2, false, func(c *GitHubActionsClaims, v string) { c.EventName = v }},
+	{21, 0, true, func(c *GitHubActionsClaims, v string) {
+		// .../actions/runs/<run_id>/attempts/<run_attempt>
+		_, run, _ := strings.Cut(v, "/actions/runs/")
+		c.RunID, c.RunAttempt, _ = strings.Cut(run, "/attempts/")
+	}},
+	{22, 0, false, func(c *GitHubActionsClaims, v string) { c.RepositoryVisibility = v }},
+	{0, 4, false, func(c *GitHubActionsClaims, v string) { c.Workflow = v }},
+}
+
+// ClaimsFromFulcioCertificate reads the GitHub Actions identity from the
+// extensions of a Fulcio-issued code signing certificate. Certificates
+// carry no actor, environment, run number or head and base refs, so those
+// claims are empty and policy conditions on them do not match.
+func ClaimsFromFulcioCertificate(cert *x509.Certificate) (*GitHubActionsClaims, error) {
+	values := make(map[string][]byte, len(cert.Extensions))
+	for _, ext := range cert.Extensions {
+		values[ext.Id.String()] = ext.Value
+	}
+
+	claims := &GitHubActionsClaims{}
+	for _, ext := range fulcioExtensions {
+		var value string
+		if raw, ok := values[fulcioOID(ext.oid).String()]; ok && ext.oid != 0 {
+			if rest, err := asn1.UnmarshalWithParams(raw, &value, "utf8"); err != nil || len(rest) > 0 {
+				return nil, NewValidationError(ErrInvalidToken, fmt.Sprintf("malformed certificate extension %s", fulcioOID(ext.oid)))
+			}
+		} else if raw, ok := values[fulcioOID(ext.legacy).String()]; ok && ext.legacy != 0 {
+			value = string(raw)
+		} else {
+			continue
+		}
+
+		if ext.uri {
+			u, err := url.Parse(value)
+			if err != nil || u.Host == "" {
+				return nil, NewValidationError(ErrInvalidToken, fmt.Sprintf("certificate extension %s has an invalid URI %q", fulcioOID(ext.oid), value))
+			}
+			value = strings.TrimPrefix(u.Path, "/")
+		}
+		ext.set(claims, value)
+	}
+
+	if claims.Issuer == "" {
+		return nil, NewValidationError(ErrInvalidToken, "certificate has no issuer extension")
+	}
+	if claims.Repository == "" || claims.Ref == "" || claims.EventName == "" {
+		return nil, NewValidationError(ErrInvalidToken, "certificate does not describe a GitHub Actions workflow run")
+	}
+
+	if claims.RepositoryOwner == "" {
+		claims.RepositoryOwner, _, _ = strings.Cut(claims.Repository, "/")
+	}
+	switch {
+	case strings.HasPrefix(claims.Ref, "refs/heads/"):
+		claims.RefType = "branch"
+	case strings.HasPrefix(claims.Ref, "refs/tags/"):
+		claims.RefType = "tag"
+	}
+
+	return claims, nil
+}
+
+// VerifyCertificate evaluates the GitHub Actions identity in a Fulcio
+// certificate against the same trusted issuers, workflow pins, runner
+// restrictions and policy as tokens, so artifact verification services
+// can share their rules with OIDC authentication. It does not check the
+// certificate itself: verify its chain to the Fulcio root and its
+// signing time, e.g. with sigstore-go, before calling it. Token-only
+// checks such as the audience, token age and required claims do not apply.
+func (v *Verifier) VerifyCertificate(ctx context.Context, cert *x509.Certificate, opts ...VerifyOption) (*VerificationResult, error) {
+	var cfg verifyConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	claims, err := ClaimsFromFulcioCertificate(cert)
+	if err != nil {
+		v.logFailure(ctx, nil, err)
+		return nil, err
+	}
+
+	if _, ok := v.issuers[claims.Issuer]; !ok {
+		err := newClaimError(ErrInvalidIssuer, fmt.Sprintf("untrusted issuer %q", claims.Issuer), map[string]any{"iss": claims.Issuer})
+		v.logFailure(ctx, claims, err)
+		return nil, err
+	}
+
+	result, err := v.authorize(ctx, claims, cfg)
+	v.notifyDecision(ctx, claims, result, err)
+	if err != nil {
+		v.logFailure(ctx, claims, err)
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,200 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newFulcioCertificate creates a self-signed certificate with the given
+// Fulcio extensions, as UTF8Strings unless legacy
+func newFulcioCertificate(t *testing.T, extensions map[int]string, legacy bool) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(10 * time.Minute),
+	}
+	if uri, ok := extensions[9]; ok {
+		san, _ := url.Parse(uri)
+		template.URIs = []*url.URL{san}
+	}
+	for oid, value := range extensions {
+		raw := []byte(value)
+		if !legacy {
+			if raw, err = asn1.MarshalWithParams(value, "utf8"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: fulcioOID(oid), Value: raw})
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// defaultFulcioExtensions describes a push to main of myorg/myrepo
+func defaultFulcioExtensions() map[int]string {
+	return map[int]string{
+		8:  DefaultIssuer,
+		9:  "https://github.com/myorg/myrepo/.github/workflows/release.yml@refs/heads/main",
+		10: "abc123",
+		11: "github-hosted",
+		12: "https://github.com/myorg/myrepo",
+		13: "abc123",
+		14: "refs/heads/main",
+		15: "67890",
+		16: "https://github.com/myorg",
+		17: "12345",
+		18: "https://github.com/myorg/myrepo/.github/workflows/release.yml@refs/heads/main",
+		19: "abc123",
+		20: "push",
+		21: "https://github.com/myorg/myrepo/actions/runs/1234567890/attempts/2",
+		22: "private",
+	}
+}
+
+func TestClaimsFromFulcioCertificate(t *testing.T) {
+	claims, err := ClaimsFromFulcioCertificate(newFulcioCertificate(t, defaultFulcioExtensions(), false))
+	if err != nil {
+		t.Fatalf("ClaimsFromFulcioCertificate() error = %v", err)
+	}
+
+	want := GitHubActionsClaims{
+		Repository:           "myorg/myrepo",
+		RepositoryOwner:      "myorg",
+		RepositoryOwnerID:    "12345",
+		RepositoryVisibility: "private",
+		RepositoryID:         "67890",
+		Ref:                  "refs/heads/main",
+		RefType:              "branch",
+		SHA:                  "abc123",
+		WorkflowRef:          "myorg/myrepo/.github/workflows/release.yml@refs/heads/main",
+		WorkflowSHA:          "abc123",
+		JobWorkflowRef:       "myorg/myrepo/.github/workflows/release.yml@refs/heads/main",
+		JobWorkflowSHA:       "abc123",
+		EventName:            "push",
+		RunID:                "1234567890",
+		RunAttempt:           "2",
+		RunnerEnvironment:    "github-hosted",
+	}
+	want.Issuer = DefaultIssuer
+
+	if !reflect.DeepEqual(*claims, want) {
+		t.Errorf("ClaimsFromFulcioCertificate() = %+v, want %+v", *claims, want)
+	}
+}
+
+func TestClaimsFromFulcioCertificate_Legacy(t *testing.T) {
+	cert := newFulcioCertificate(t, map[int]string{
+		1: DefaultIssuer,
+		2: "push",
+		3: "abc123",
+		4: "Release",
+		5: "myorg/myrepo",
+		6: "refs/tags/v1.0.0",
+	}, true)
+
+	claims, err := ClaimsFromFulcioCertificate(cert)
+	if err != nil {
+		t.Fatalf("ClaimsFromFulcioCertificate() error = %v", err)
+	}
+
+	if claims.Issuer != DefaultIssuer || claims.Repository != "myorg/myrepo" || claims.RepositoryOwner != "myorg" ||
+		claims.Ref != "refs/tags/v1.0.0" || claims.RefType != "tag" || claims.Workflow != "Release" || claims.EventName != "push" {
+		t.Errorf("ClaimsFromFulcioCertificate() = %+v", claims)
+	}
+}
+
+func TestClaimsFromFulcioCertificate_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(map[int]string)
+	}{
+		{name: "no issuer", modify: func(e map[int]string) { delete(e, 8) }},
+		{name: "no repository", modify: func(e map[int]string) { delete(e, 12) }},
+		{name: "invalid URI", modify: func(e map[int]string) { e[12] = "myorg/myrepo" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extensions := defaultFulcioExtensions()
+			tt.modify(extensions)
+
+			_, err := ClaimsFromFulcioCertificate(newFulcioCertificate(t, extensions, false))
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ClaimsFromFulcioCertificate() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifier_VerifyCertificate(t *testing.T) {
+	policy := &Policy{
+		Rules: []Rule{{
+			Name:       "release-from-main",
+			Conditions: Conditions{Repository: []string{"myorg/*"}, Ref: []string{"refs/heads/main"}},
+			Effect:     EffectAllow,
+		}},
+		DefaultDeny: true,
+	}
+	verifier, err := New(WithPolicy(policy), WithAudience("https://api.example.com"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(map[int]string)
+		wantErr error
+	}{
+		{name: "allowed", modify: func(map[int]string) {}},
+		{name: "denied by policy", modify: func(e map[int]string) { e[14] = "refs/heads/feature" }, wantErr: ErrAccessDenied},
+		{name: "untrusted issuer", modify: func(e map[int]string) { e[8] = "https://accounts.google.com" }, wantErr: ErrInvalidIssuer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extensions := defaultFulcioExtensions()
+			tt.modify(extensions)
+
+			result, err := verifier.VerifyCertificate(context.Background(), newFulcioCertificate(t, extensions, false))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyCertificate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyCertificate() error = %v", err)
+			}
+			if result.PolicyResult.MatchedRule != "release-from-main" || result.Identity.Repo != "myrepo" {
+				t.Errorf("VerifyCertificate() = %+v", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+// Package ghaauthtest provides test doubles for services that embed a
+// ghaauth verifier: a token generator signing GitHub Actions OIDC tokens
+// with a throwaway key, a JWKS server publishing that key, claim fixtures
+// for common workflow runs and canned policy documents.
+//
+// A Provider bundles the generator and the server:
+//
+//	provider := ghaauthtest.NewProvider(t)
+//	verifier, err := ghaauth.New(
+//		ghaauth.WithJWKSURL(provider.JWKSURL()),
+//		ghaauth.WithAudience("https://api.example.com"),
+//	)
+//	...
+//	req.Header.Set("Authorization", "Bearer "+provider.Token(ghaauthtest.DefaultClaims()))
+package ghaauthtest
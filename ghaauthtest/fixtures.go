@@ -0,0 +1,51 @@
+package ghaauthtest
+
+// The fixtures are claims of common workflow runs of myorg/myrepo for the
+// audience https://api.example.com, issued now. Adjust them with the
+// TokenClaims With methods, e.g.
+//
+//	ghaauthtest.EnvironmentDeployClaims().WithEnvironment("staging").WithActor("octocat")
+
+// DefaultPushClaims returns the claims of a push to main; they are the
+// same as DefaultClaims
+func DefaultPushClaims() *TokenClaims {
+	return DefaultClaims()
+}
+
+// PullRequestFromForkClaims returns the claims of a pull_request run for
+// pull request 1, opened from a fork's patch-1 branch into main by an
+// outside contributor. GitHub's tokens do not name the head repository,
+// so they look like those of any pull request.
+func PullRequestFromForkClaims() *TokenClaims {
+	claims := DefaultClaims().WithEvent("pull_request").WithRef("refs/pull/1/merge").WithActor("outside-contributor")
+	claims.HeadRef = "patch-1"
+	claims.BaseRef = "main"
+	claims.RepositoryVisibility = "public"
+	return claims
+}
+
+// TagReleaseClaims returns the claims of a release run for the tag v1.0.0
+func TagReleaseClaims() *TokenClaims {
+	return DefaultClaims().WithEvent("release").WithRef("refs/tags/v1.0.0")
+}
+
+// EnvironmentDeployClaims returns the claims of a push to main deploying
+// to the production environment
+func EnvironmentDeployClaims() *TokenClaims {
+	return DefaultClaims().WithEnvironment("production")
+}
+
+// ReusableWorkflowClaims returns the claims of a push to main whose job
+// runs the reusable workflow
+// myorg/shared-workflows/.github/workflows/deploy.yml@refs/heads/main
+func ReusableWorkflowClaims() *TokenClaims {
+	claims := DefaultClaims().WithJobWorkflowRef("myorg/shared-workflows/.github/workflows/deploy.yml@refs/heads/main")
+	claims.JobWorkflowSHA = "fed654cba321"
+	return claims
+}
+
+// SelfHostedRunnerClaims returns the claims of a push to main running on
+// a self-hosted runner
+func SelfHostedRunnerClaims() *TokenClaims {
+	return DefaultClaims().WithRunnerEnvironment("self-hosted")
+}
@@ -0,0 +1,271 @@
+package ghaauthtest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+	"github.com/dev-shimada/gha-auth/ghaauthtest"
+)
+
+func TestProvider(t *testing.T) {
+	provider := ghaauthtest.NewProvider(t)
+
+	verifier, err := ghaauth.New(
+		ghaauth.WithJWKSURL(provider.JWKSURL()),
+		ghaauth.WithAudience("https://api.example.com"),
+		ghaauth.WithPolicy(ghaauthtest.AllowMainBranchPolicy("myorg/myrepo")),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		claims *ghaauthtest.TokenClaims
+		want   error
+	}{
+		{name: "main branch", claims: ghaauthtest.DefaultClaims()},
+		{name: "environment", claims: ghaauthtest.EnvironmentDeployClaims()},
+		{name: "reusable workflow", claims: ghaauthtest.ReusableWorkflowClaims()},
+		{name: "pull request", claims: ghaauthtest.PullRequestFromForkClaims(), want: ghaauth.ErrAccessDenied},
+		{name: "tag", claims: ghaauthtest.TagReleaseClaims(), want: ghaauth.ErrAccessDenied},
+		{name: "self-hosted runner", claims: ghaauthtest.SelfHostedRunnerClaims()},
+		{name: "other repository", claims: ghaauthtest.DefaultPushClaims().WithRepository("myorg/api"), want: ghaauth.ErrAccessDenied},
+		{name: "expired", claims: ghaauthtest.DefaultPushClaims().WithExpiry(-time.Minute), want: ghaauth.ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), provider.Token(tt.claims))
+			if tt.want == nil && err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCannedPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *ghaauth.Policy
+		allow  []*ghaauthtest.TokenClaims
+		deny   []*ghaauthtest.TokenClaims
+	}{
+		{
+			name:   "owner",
+			policy: ghaauthtest.AllowOwnerPolicy("myorg"),
+			allow:  []*ghaauthtest.TokenClaims{ghaauthtest.DefaultClaims(), ghaauthtest.PullRequestFromForkClaims()},
+		},
+		{
+			name:   "main branch",
+			policy: ghaauthtest.AllowMainBranchPolicy("myorg/myrepo"),
+			allow:  []*ghaauthtest.TokenClaims{ghaauthtest.DefaultClaims()},
+			deny:   []*ghaauthtest.TokenClaims{ghaauthtest.TagReleaseClaims()},
+		},
+		{
+			name:   "environment",
+			policy: ghaauthtest.AllowEnvironmentPolicy("myorg/myrepo", "production"),
+			allow:  []*ghaauthtest.TokenClaims{ghaauthtest.EnvironmentDeployClaims()},
+			deny:   []*ghaauthtest.TokenClaims{ghaauthtest.EnvironmentDeployClaims().WithEnvironment("staging"), ghaauthtest.DefaultClaims()},
+		},
+		{
+			name:   "deny all",
+			policy: ghaauthtest.DenyAllPolicy(),
+			deny:   []*ghaauthtest.TokenClaims{ghaauthtest.DefaultClaims()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			for want, fixtures := range map[bool][]*ghaauthtest.TokenClaims{true: tt.allow, false: tt.deny} {
+				for _, fixture := range fixtures {
+					claims := ghaauthtest.Result(fixture).Claims
+					if got := tt.policy.Evaluate(claims).Allowed; got != want {
+						t.Errorf("Evaluate(%s@%s) allowed = %v, want %v", fixture.Repository, fixture.Ref, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStaticVerifier(t *testing.T) {
+	denied := ghaauth.NewValidationError(ghaauth.ErrAccessDenied, "no rule matched")
+	verifier := ghaauthtest.NewStaticVerifier().
+		Allow("main", ghaauthtest.Result(ghaauthtest.DefaultClaims())).
+		Reject("fork", denied)
+
+	var got ghaauth.Identity
+	handler := ghaauth.Middleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, _ := ghaauth.FromContext(r.Context())
+		got = result.Identity
+	}))
+
+	tests := []struct {
+		token      string
+		wantStatus int
+	}{
+		{token: "main", wantStatus: http.StatusOK},
+		{token: "fork", wantStatus: http.StatusForbidden},
+		{token: "unknown", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if got.String() != "myorg/myrepo@refs/heads/main#CI" {
+		t.Errorf("Identity = %q, want myorg/myrepo@refs/heads/main#CI", got)
+	}
+	if calls := verifier.Calls(); !slices.Equal(calls, []string{"main", "fork", "unknown"}) {
+		t.Errorf("Calls() = %v", calls)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	tests := []struct {
+		name        string
+		claims      *ghaauthtest.TokenClaims
+		wantSubject string
+		wantRefType string
+	}{
+		{name: "push", claims: ghaauthtest.DefaultPushClaims(), wantSubject: "repo:myorg/myrepo:ref:refs/heads/main", wantRefType: "branch"},
+		{name: "fork pull request", claims: ghaauthtest.PullRequestFromForkClaims(), wantSubject: "repo:myorg/myrepo:pull_request"},
+		{name: "tag release", claims: ghaauthtest.TagReleaseClaims(), wantSubject: "repo:myorg/myrepo:ref:refs/tags/v1.0.0", wantRefType: "tag"},
+		{name: "environment", claims: ghaauthtest.EnvironmentDeployClaims(), wantSubject: "repo:myorg/myrepo:environment:production", wantRefType: "branch"},
+		{
+			name:        "overrides",
+			claims:      ghaauthtest.EnvironmentDeployClaims().WithRepository("otherorg/api").WithEnvironment("").WithRef("refs/heads/dev"),
+			wantSubject: "repo:otherorg/api:ref:refs/heads/dev",
+			wantRefType: "branch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := ghaauthtest.Result(tt.claims).Claims
+			if claims.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", claims.Subject, tt.wantSubject)
+			}
+			if claims.RefType != tt.wantRefType {
+				t.Errorf("RefType = %q, want %q", claims.RefType, tt.wantRefType)
+			}
+		})
+	}
+}
+
+func TestJWKSServer(t *testing.T) {
+	t.Run("rotation", func(t *testing.T) {
+		provider := ghaauthtest.NewProvider(t)
+		verifier, err := ghaauth.New(
+			ghaauth.WithJWKSURL(provider.JWKSURL()),
+			ghaauth.WithJWKSMinRefreshInterval(0),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		token := provider.Token(ghaauthtest.DefaultClaims())
+		for range 2 {
+			if _, err := verifier.Verify(context.Background(), token); err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+		}
+		if got := provider.Server().Fetches(); got != 1 {
+			t.Errorf("Fetches() = %d before rotation, want 1", got)
+		}
+
+		provider.Rotate()
+		if _, err := verifier.Verify(context.Background(), provider.Token(ghaauthtest.DefaultClaims())); err != nil {
+			t.Fatalf("Verify() error = %v after rotation", err)
+		}
+		if got := provider.Server().Fetches(); got != 2 {
+			t.Errorf("Fetches() = %d after rotation, want 2", got)
+		}
+		if got := provider.Server().KeyIDs(); !slices.Equal(got, []string{"test-key-2"}) {
+			t.Errorf("KeyIDs() = %v, want [test-key-2]", got)
+		}
+	})
+
+	t.Run("transient failures", func(t *testing.T) {
+		provider := ghaauthtest.NewProvider(t)
+		provider.Server().FailNext(2, http.StatusServiceUnavailable)
+		verifier, err := ghaauth.New(
+			ghaauth.WithJWKSURL(provider.JWKSURL()),
+			ghaauth.WithJWKSRetry(ghaauth.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if _, err := verifier.Verify(context.Background(), provider.Token(ghaauthtest.DefaultClaims())); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if got := provider.Server().Fetches(); got != 3 {
+			t.Errorf("Fetches() = %d, want 3", got)
+		}
+	})
+
+	t.Run("slow responses", func(t *testing.T) {
+		provider := ghaauthtest.NewProvider(t)
+		provider.Server().SetDelay(time.Second)
+		verifier, err := ghaauth.New(
+			ghaauth.WithJWKSURL(provider.JWKSURL()),
+			ghaauth.WithHTTPClient(&http.Client{Timeout: 20 * time.Millisecond}),
+			ghaauth.WithJWKSRetry(ghaauth.RetryPolicy{MaxAttempts: 1}),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		_, err = verifier.Verify(context.Background(), provider.Token(ghaauthtest.DefaultClaims()))
+		if !errors.Is(err, ghaauth.ErrJWKSFetch) {
+			t.Errorf("Verify() error = %v, want %v", err, ghaauth.ErrJWKSFetch)
+		}
+	})
+
+	t.Run("outage", func(t *testing.T) {
+		provider := ghaauthtest.NewProvider(t)
+		provider.Server().SetStatus(http.StatusInternalServerError)
+		verifier, err := ghaauth.New(
+			ghaauth.WithJWKSURL(provider.JWKSURL()),
+			ghaauth.WithJWKSRetry(ghaauth.RetryPolicy{MaxAttempts: 1}),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		token := provider.Token(ghaauthtest.DefaultClaims())
+		if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, ghaauth.ErrJWKSFetch) {
+			t.Errorf("Verify() error = %v, want %v", err, ghaauth.ErrJWKSFetch)
+		}
+
+		provider.Server().SetStatus(0)
+		if _, err := verifier.Verify(context.Background(), token); err != nil {
+			t.Errorf("Verify() error = %v after recovery", err)
+		}
+	})
+}
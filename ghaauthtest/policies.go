@@ -0,0 +1,57 @@
+package ghaauthtest
+
+import ghaauth "github.com/dev-shimada/gha-auth"
+
+// The canned policies are deliberately small starting points for tests,
+// not recommendations. Each call returns a new policy that may be modified.
+
+// AllowOwnerPolicy allows the tokens of an owner's repositories and denies
+// all others
+func AllowOwnerPolicy(owner string) *ghaauth.Policy {
+	return &ghaauth.Policy{
+		Rules: []ghaauth.Rule{{
+			Name:       "allow-" + owner,
+			Conditions: ghaauth.Conditions{RepositoryOwner: []string{owner}},
+			Effect:     ghaauth.EffectAllow,
+		}},
+		DefaultDeny: true,
+	}
+}
+
+// AllowMainBranchPolicy allows the tokens of runs on the main branch of a
+// repository and denies all others
+func AllowMainBranchPolicy(repository string) *ghaauth.Policy {
+	return &ghaauth.Policy{
+		Rules: []ghaauth.Rule{{
+			Name:       "allow-main",
+			Conditions: ghaauth.Conditions{Repository: []string{repository}, Ref: []string{"refs/heads/main"}},
+			Effect:     ghaauth.EffectAllow,
+		}},
+		DefaultDeny: true,
+	}
+}
+
+// AllowEnvironmentPolicy allows the tokens of runs deploying to an
+// environment of a repository and denies all others
+func AllowEnvironmentPolicy(repository, environment string) *ghaauth.Policy {
+	return &ghaauth.Policy{
+		Rules: []ghaauth.Rule{{
+			Name:       "allow-" + environment,
+			Conditions: ghaauth.Conditions{Repository: []string{repository}, Environment: []string{environment}},
+			Effect:     ghaauth.EffectAllow,
+		}},
+		DefaultDeny: true,
+	}
+}
+
+// DenyAllPolicy denies every token
+func DenyAllPolicy() *ghaauth.Policy {
+	return &ghaauth.Policy{
+		Rules: []ghaauth.Rule{{
+			Name:       "deny-all",
+			Conditions: ghaauth.Conditions{Repository: []string{"**"}},
+			Effect:     ghaauth.EffectDeny,
+		}},
+		DefaultDeny: true,
+	}
+}
@@ -0,0 +1,69 @@
+package ghaauthtest
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Provider is a fake GitHub Actions OIDC provider: a TokenGenerator whose
+// key is published by a JWKSServer
+type Provider struct {
+	*TokenGenerator
+
+	server    *JWKSServer
+	tb        testing.TB
+	rotations int
+}
+
+// NewProvider starts a provider that is shut down when the test ends
+func NewProvider(tb testing.TB) *Provider {
+	tb.Helper()
+
+	gen, err := NewTokenGenerator()
+	if err != nil {
+		tb.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	tb.Cleanup(server.Close)
+
+	return &Provider{TokenGenerator: gen, server: server, tb: tb}
+}
+
+// JWKSURL returns the URL of the provider's JWKS endpoint, for
+// ghaauth.WithJWKSURL
+func (p *Provider) JWKSURL() string {
+	return p.server.JWKSURL()
+}
+
+// Server returns the provider's JWKS server, e.g. to make it fail
+func (p *Provider) Server() *JWKSServer {
+	return p.server
+}
+
+// Rotate replaces the provider's key with a new one: later tokens are
+// signed with it, and the server publishes only the new key
+func (p *Provider) Rotate() {
+	p.tb.Helper()
+
+	p.rotations++
+	gen, err := NewTokenGeneratorWithKeyID(fmt.Sprintf("test-key-%d", p.rotations+1))
+	if err != nil {
+		p.tb.Fatalf("failed to create token generator: %v", err)
+	}
+
+	p.TokenGenerator = gen
+	p.server.Rotate(gen.PublicKey(), gen.KeyID())
+}
+
+// Token returns a token with the given claims, failing the test if it
+// cannot be signed
+func (p *Provider) Token(claims *TokenClaims) string {
+	p.tb.Helper()
+
+	token, err := p.GenerateToken(claims.ToJWT())
+	if err != nil {
+		p.tb.Fatalf("failed to generate token: %v", err)
+	}
+	return token
+}
@@ -0,0 +1,102 @@
+package ghaauthtest
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// StaticVerifier is a ghaauth.TokenVerifier returning configured results
+// per token string, for testing handlers without real tokens or a JWKS
+// server. Tokens without a configured result fail with
+// ghaauth.ErrInvalidToken. VerifyOptions are ignored. A StaticVerifier is
+// safe for concurrent use.
+type StaticVerifier struct {
+	mu      sync.Mutex
+	results map[string]*ghaauth.VerificationResult
+	errs    map[string]error
+	calls   []string
+}
+
+var _ ghaauth.TokenVerifier = (*StaticVerifier)(nil)
+
+// NewStaticVerifier creates a verifier that accepts no tokens yet
+func NewStaticVerifier() *StaticVerifier {
+	return &StaticVerifier{
+		results: make(map[string]*ghaauth.VerificationResult),
+		errs:    make(map[string]error),
+	}
+}
+
+// Allow makes the verifier accept token with the given result, e.g.
+// Result(DefaultClaims())
+func (s *StaticVerifier) Allow(token string, result *ghaauth.VerificationResult) *StaticVerifier {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.errs, token)
+	s.results[token] = result
+	return s
+}
+
+// Reject makes the verifier fail token with err, e.g.
+// ghaauth.NewValidationError(ghaauth.ErrAccessDenied, "no rule matched")
+func (s *StaticVerifier) Reject(token string, err error) *StaticVerifier {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.results, token)
+	s.errs[token] = err
+	return s
+}
+
+// Verify returns the result or error configured for token
+func (s *StaticVerifier) Verify(ctx context.Context, token string) (*ghaauth.VerificationResult, error) {
+	return s.VerifyWith(ctx, token)
+}
+
+// VerifyWith returns the result or error configured for token, ignoring
+// opts
+func (s *StaticVerifier) VerifyWith(_ context.Context, token string, _ ...ghaauth.VerifyOption) (*ghaauth.VerificationResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, token)
+	if err, ok := s.errs[token]; ok {
+		return nil, err
+	}
+	if result, ok := s.results[token]; ok {
+		return result, nil
+	}
+	return nil, ghaauth.NewValidationError(ghaauth.ErrInvalidToken, "unknown token")
+}
+
+// Calls returns the tokens verified so far, in order
+func (s *StaticVerifier) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.calls...)
+}
+
+// Result returns the verification result of a token with the given claims,
+// allowed without a matched rule
+func Result(claims *TokenClaims) *ghaauth.VerificationResult {
+	// TokenClaims and GitHubActionsClaims share the JWT claim names
+	data, err := json.Marshal(claims.ToJWT())
+	if err != nil {
+		panic(err)
+	}
+	var ghClaims ghaauth.GitHubActionsClaims
+	if err := json.Unmarshal(data, &ghClaims); err != nil {
+		panic(err)
+	}
+
+	return &ghaauth.VerificationResult{
+		Claims:       &ghClaims,
+		PolicyResult: &ghaauth.EvaluationResult{Allowed: true},
+		Identity:     ghClaims.Identity(),
+	}
+}
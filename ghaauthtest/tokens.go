@@ -0,0 +1,55 @@
+package ghaauthtest
+
+import (
+	"crypto/rsa"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+// TokenGenerator signs tokens with a throwaway RSA key. GenerateToken signs
+// claims with RS256, GenerateTokenWithMethod with another RSA method, and
+// PublicKey and KeyID describe the key.
+type TokenGenerator = testutil.TokenGenerator
+
+// TokenClaims are the claims of a test token. The With methods, e.g.
+// WithRepository and WithRef, adjust them, and ToJWT converts them for
+// TokenGenerator.GenerateToken, omitting empty fields.
+type TokenClaims = testutil.TokenClaims
+
+// JWKSServer is an httptest server publishing RSA keys at
+// /.well-known/jwks and /.well-known/jwks.json. AddKey, RemoveKey and
+// Rotate change the published keys; FailNext, SetStatus, SetDelay and
+// SetCacheControl change its responses; Fetches counts its requests.
+type JWKSServer = testutil.JWKSServer
+
+// DPoPKey is a workflow-held P-256 key; Proof creates DPoP proofs with it
+type DPoPKey = testutil.DPoPKey
+
+// NewTokenGenerator creates a token generator with a random 2048-bit key
+func NewTokenGenerator() (*TokenGenerator, error) {
+	return testutil.NewTokenGenerator()
+}
+
+// NewTokenGeneratorWithKeyID creates a token generator with a random
+// 2048-bit key and the given key ID, e.g. for the next key of a rotation
+func NewTokenGeneratorWithKeyID(keyID string) (*TokenGenerator, error) {
+	return testutil.NewTokenGeneratorWithKeyID(keyID)
+}
+
+// NewJWKSServer starts a server publishing publicKey under keyID. Close it
+// when done.
+func NewJWKSServer(publicKey *rsa.PublicKey, keyID string) *JWKSServer {
+	return testutil.NewJWKSServer(publicKey, keyID)
+}
+
+// NewDPoPKey creates a DPoP key
+func NewDPoPKey() (*DPoPKey, error) {
+	return testutil.NewDPoPKey()
+}
+
+// DefaultClaims returns the claims of a push to main of myorg/myrepo for
+// the audience https://api.example.com, issued now and valid for five
+// minutes
+func DefaultClaims() *TokenClaims {
+	return testutil.DefaultClaims()
+}
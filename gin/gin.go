@@ -0,0 +1,89 @@
+// Package ginghaauth provides Gin middleware for verifying GitHub Actions
+// OIDC tokens with ghaauth.
+package ginghaauth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// resultKey is the gin.Context key for the verification result
+const resultKey = "ghaauth.result"
+
+// Option configures the middleware
+type Option func(*config)
+
+// config holds the middleware settings
+type config struct {
+	errorHandler func(*gin.Context, error)
+}
+
+// WithErrorHandler sets how verification failures are handled. The handler
+// is responsible for aborting the request.
+func WithErrorHandler(handler func(*gin.Context, error)) Option {
+	return func(c *config) {
+		c.errorHandler = handler
+	}
+}
+
+// Middleware returns a gin.HandlerFunc that verifies the bearer token and
+// its DPoP proof, if any, and stores the VerificationResult in the
+// gin.Context and, for ghaauth.FromContext, in the request context
+func Middleware(verifier ghaauth.TokenVerifier, opts ...Option) gin.HandlerFunc {
+	cfg := &config{
+		errorHandler: defaultErrorHandler,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(c *gin.Context) {
+		token, err := ghaauth.ParseBearerToken(c.GetHeader("Authorization"))
+		if err != nil {
+			cfg.errorHandler(c, err)
+			return
+		}
+
+		result, err := verifier.VerifyWith(c.Request.Context(), token, ghaauth.WithDPoPRequest(c.Request))
+		if err != nil {
+			cfg.errorHandler(c, err)
+			return
+		}
+
+		c.Set(resultKey, result)
+		c.Request = c.Request.WithContext(ghaauth.NewContext(c.Request.Context(), result))
+		c.Next()
+	}
+}
+
+// ResultFromContext returns the VerificationResult stored by Middleware
+func ResultFromContext(c *gin.Context) (*ghaauth.VerificationResult, bool) {
+	value, ok := c.Get(resultKey)
+	if !ok {
+		return nil, false
+	}
+	result, ok := value.(*ghaauth.VerificationResult)
+	return result, ok
+}
+
+// ClaimsFromContext returns the verified claims stored by Middleware
+func ClaimsFromContext(c *gin.Context) (*ghaauth.GitHubActionsClaims, bool) {
+	result, ok := ResultFromContext(c)
+	if !ok {
+		return nil, false
+	}
+	return result.Claims, true
+}
+
+// defaultErrorHandler aborts with the status from ghaauth.HTTPStatus
+func defaultErrorHandler(c *gin.Context, err error) {
+	status := ghaauth.HTTPStatus(err)
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", "Bearer")
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": http.StatusText(status)})
+}
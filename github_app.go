@@ -0,0 +1,296 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultAppRefreshInterval is how long a GitHubAppRepositories uses the
+// repositories it listed before listing them again
+const DefaultAppRefreshInterval = 5 * time.Minute
+
+// GitHubAppRepositories is the set of repositories a GitHub App is
+// installed on, across all of its installations. Added to a verifier with
+// WithGitHubAppRepositories, it only accepts tokens from those
+// repositories, so that installing the app on a repository onboards it.
+//
+// The set is listed on first use and again once it is older than the
+// refresh interval, during a verification. If listing fails, the previous
+// set is kept; verifications fail with ErrGitHubAPI until a first listing
+// succeeds. Tokens of other CI providers, mapped by a ClaimMapper, are
+// denied: their repository IDs are not GitHub's.
+type GitHubAppRepositories struct {
+	appID           string
+	key             *rsa.PrivateKey
+	apiURL          string
+	httpClient      *http.Client
+	refreshInterval time.Duration
+	clock           Clock
+
+	refreshMu sync.Mutex // serializes listings
+
+	mu        sync.RWMutex
+	repos     map[string]struct{} // repository IDs
+	refreshed time.Time
+}
+
+// AppOption configures a GitHubAppRepositories
+type AppOption func(*GitHubAppRepositories)
+
+// NewGitHubAppRepositories creates the repository set of the GitHub App
+// with the given ID, authenticating with its private key. The app needs
+// read access to repository metadata.
+func NewGitHubAppRepositories(appID string, privateKey *rsa.PrivateKey, opts ...AppOption) *GitHubAppRepositories {
+	a := &GitHubAppRepositories{
+		appID:           appID,
+		key:             privateKey,
+		apiURL:          DefaultGitHubAPIURL,
+		httpClient:      newHTTPClient(),
+		refreshInterval: DefaultAppRefreshInterval,
+		clock:           DefaultClock{},
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// WithAppAPIURL sets the API URL, e.g. https://ghes.example.com/api/v3
+// for GitHub Enterprise Server
+func WithAppAPIURL(apiURL string) AppOption {
+	return func(a *GitHubAppRepositories) {
+		a.apiURL = strings.TrimSuffix(apiURL, "/")
+	}
+}
+
+// WithAppHTTPClient sets the HTTP client for API requests
+func WithAppHTTPClient(client *http.Client) AppOption {
+	return func(a *GitHubAppRepositories) {
+		a.httpClient = client
+	}
+}
+
+// WithAppRefreshInterval sets how often the repositories are listed again
+func WithAppRefreshInterval(interval time.Duration) AppOption {
+	return func(a *GitHubAppRepositories) {
+		a.refreshInterval = interval
+	}
+}
+
+// WithGitHubAppRepositories only accepts tokens from repositories the
+// GitHub App is installed on. It runs as a ClaimValidator, in the order
+// added, and denies other repositories with ErrAccessDenied.
+func WithGitHubAppRepositories(repos *GitHubAppRepositories) Option {
+	return WithClaimValidator(repos.Check)
+}
+
+// Check denies claims from repositories the app is not installed on,
+// listing the repositories first if they are missing or stale. Repositories
+// are identified by the repository_id claim, so renames do not matter.
+func (a *GitHubAppRepositories) Check(ctx context.Context, claims *GitHubActionsClaims) error {
+	if claims.Mapped() {
+		return newClaimError(ErrAccessDenied, "GitHub App repositories only apply to GitHub Actions tokens",
+			map[string]any{"iss": claims.Issuer})
+	}
+
+	if err := a.refreshIfStale(ctx); err != nil {
+		return err
+	}
+
+	if !a.Contains(claims.RepositoryID) {
+		return newClaimError(ErrAccessDenied, "GitHub App is not installed on the repository",
+			map[string]any{"repository": claims.Repository})
+	}
+	return nil
+}
+
+// Contains reports whether the app is installed on the repository with the
+// given ID, as of the last listing
+func (a *GitHubAppRepositories) Contains(repositoryID string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	_, ok := a.repos[repositoryID]
+	return ok
+}
+
+// Refresh lists the repositories of every installation of the app now,
+// e.g. at startup to fail fast
+func (a *GitHubAppRepositories) Refresh(ctx context.Context) error {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	return a.refresh(ctx)
+}
+
+// refreshIfStale refreshes the set if it was never listed or is older than
+// the refresh interval. A failed refresh of a stale set is ignored.
+func (a *GitHubAppRepositories) refreshIfStale(ctx context.Context) error {
+	if a.fresh() {
+		return nil
+	}
+
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	// Another verification may have refreshed the set meanwhile
+	if a.fresh() {
+		return nil
+	}
+
+	err := a.refresh(ctx)
+	a.mu.RLock()
+	listed := a.repos != nil
+	a.mu.RUnlock()
+	if err != nil && !listed {
+		return err
+	}
+	return nil
+}
+
+// fresh reports whether the set is listed and within the refresh interval
+func (a *GitHubAppRepositories) fresh() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.repos != nil && a.clock.Now().Sub(a.refreshed) < a.refreshInterval
+}
+
+// refresh lists the repositories of every installation
+func (a *GitHubAppRepositories) refresh(ctx context.Context) error {
+	appToken, err := a.appToken()
+	if err != nil {
+		return NewValidationError(ErrGitHubAPI, "failed to sign app JWT: "+err.Error())
+	}
+
+	var installations []struct {
+		ID int64 `json:"id"`
+	}
+	if err := a.list(ctx, a.apiURL+"/app/installations?per_page=100", appToken, func(page []byte) error {
+		var items []struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.Unmarshal(page, &items); err != nil {
+			return err
+		}
+		installations = append(installations, items...)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	repos := make(map[string]struct{})
+	for _, installation := range installations {
+		token, err := a.installationToken(ctx, installation.ID, appToken)
+		if err != nil {
+			return err
+		}
+
+		if err := a.list(ctx, a.apiURL+"/installation/repositories?per_page=100", token, func(page []byte) error {
+			var body struct {
+				Repositories []struct {
+					ID int64 `json:"id"`
+				} `json:"repositories"`
+			}
+			if err := json.Unmarshal(page, &body); err != nil {
+				return err
+			}
+			for _, repo := range body.Repositories {
+				repos[strconv.FormatInt(repo.ID, 10)] = struct{}{}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.repos = repos
+	a.refreshed = a.clock.Now()
+	return nil
+}
+
+// appToken signs the short-lived JWT that authenticates as the app. It is
+// backdated to allow for clock drift, as GitHub recommends.
+func (a *GitHubAppRepositories) appToken() (string, error) {
+	now := a.clock.Now()
+	claims := jwt.RegisteredClaims{
+		Issuer:    a.appID,
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(a.key)
+}
+
+// installationToken creates an access token for an installation
+func (a *GitHubAppRepositories) installationToken(ctx context.Context, installationID int64, appToken string) (string, error) {
+	endpoint := fmt.Sprintf("%s/app/installations/%d/access_tokens", a.apiURL, installationID)
+	resp, err := githubRequest(ctx, a.httpClient, http.MethodPost, endpoint, appToken)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", NewValidationError(ErrGitHubAPI, fmt.Sprintf("installation %d access token: HTTP %d", installationID, resp.StatusCode))
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", NewValidationError(ErrGitHubAPI, err.Error())
+	}
+	return body.Token, nil
+}
+
+// list fetches every page of a paginated API endpoint
+func (a *GitHubAppRepositories) list(ctx context.Context, endpoint, token string, page func([]byte) error) error {
+	for endpoint != "" {
+		resp, err := githubRequest(ctx, a.httpClient, http.MethodGet, endpoint, token)
+		if err != nil {
+			return err
+		}
+
+		var body json.RawMessage
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return NewValidationError(ErrGitHubAPI, fmt.Sprintf("HTTP %d", resp.StatusCode))
+		}
+		if err == nil {
+			err = page(body)
+		}
+		if err != nil {
+			return NewValidationError(ErrGitHubAPI, err.Error())
+		}
+
+		endpoint = nextPage(resp.Header.Get("Link"))
+	}
+	return nil
+}
+
+// nextLinkPattern finds the next page in a Link header
+var nextLinkPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPage returns the URL of the next page from a Link header, or ""
+func nextPage(link string) string {
+	if m := nextLinkPattern.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// githubAppAPI is a mock GitHub REST API for an app with two
+// installations, the second of which lists its repositories on two pages
+type githubAppAPI struct {
+	server *httptest.Server
+	repos  atomic.Value // repository IDs of the second installation, e.g. "67890"
+	status atomic.Int32
+}
+
+func newGitHubAppAPI(t *testing.T, key *rsa.PrivateKey) *githubAppAPI {
+	t.Helper()
+
+	api := &githubAppAPI{}
+	api.repos.Store("67890")
+
+	appAuth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			token, err := jwt.ParseWithClaims(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &jwt.RegisteredClaims{},
+				func(*jwt.Token) (any, error) { return &key.PublicKey, nil },
+				jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer("12345"))
+			if err != nil || !token.Valid {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /app/installations", appAuth(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[{"id": 1}, {"id": 2}]`))
+	}))
+	mux.HandleFunc("POST /app/installations/{id}/access_tokens", appAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"token": "installation-%s"}`, r.PathValue("id"))
+	}))
+	mux.HandleFunc("GET /installation/repositories", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") == "Bearer installation-1":
+			_, _ = w.Write([]byte(`{"repositories": [{"id": 11111}]}`))
+		case r.Header.Get("Authorization") != "Bearer installation-2":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case r.URL.Query().Get("page") == "2":
+			_, _ = fmt.Fprintf(w, `{"repositories": [{"id": %s}]}`, api.repos.Load())
+		default:
+			w.Header().Set("Link", fmt.Sprintf(`<%s/installation/repositories?page=2>; rel="next"`, api.server.URL))
+			_, _ = w.Write([]byte(`{"repositories": [{"id": 22222}]}`))
+		}
+	})
+	api.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := api.status.Load(); status != 0 {
+			http.Error(w, http.StatusText(int(status)), int(status))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+func TestGitHubAppRepositories(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	ctx := context.Background()
+	claims := func(id string) *GitHubActionsClaims {
+		return &GitHubActionsClaims{Repository: "myorg/myrepo", RepositoryID: id}
+	}
+
+	t.Run("installed repositories", func(t *testing.T) {
+		api := newGitHubAppAPI(t, key)
+		repos := NewGitHubAppRepositories("12345", key, WithAppAPIURL(api.server.URL))
+
+		for _, id := range []string{"11111", "22222", "67890"} {
+			if err := repos.Check(ctx, claims(id)); err != nil {
+				t.Errorf("Check(%s) error = %v", id, err)
+			}
+		}
+		if err := repos.Check(ctx, claims("99999")); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("Check() error = %v, want ErrAccessDenied", err)
+		}
+	})
+
+	t.Run("refresh after the interval", func(t *testing.T) {
+		api := newGitHubAppAPI(t, key)
+		clock := &manualClock{now: time.Now()}
+		repos := NewGitHubAppRepositories("12345", key, WithAppAPIURL(api.server.URL), WithAppRefreshInterval(time.Minute))
+		repos.clock = clock
+
+		if err := repos.Refresh(ctx); err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+
+		// Onboarded repositories are picked up once the set is stale
+		api.repos.Store("99999")
+		if err := repos.Check(ctx, claims("99999")); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("Check() error = %v before refresh, want ErrAccessDenied", err)
+		}
+		clock.now = clock.now.Add(2 * time.Minute)
+		if err := repos.Check(ctx, claims("99999")); err != nil {
+			t.Errorf("Check() error = %v after refresh", err)
+		}
+		if repos.Contains("67890") {
+			t.Error("Contains() = true for a repository the app was removed from")
+		}
+
+		// A failed refresh keeps the previous set
+		api.status.Store(http.StatusBadGateway)
+		clock.now = clock.now.Add(2 * time.Minute)
+		if err := repos.Check(ctx, claims("99999")); err != nil {
+			t.Errorf("Check() error = %v with the API down", err)
+		}
+		if err := repos.Refresh(ctx); !errors.Is(err, ErrGitHubAPI) {
+			t.Errorf("Refresh() error = %v, want ErrGitHubAPI", err)
+		}
+	})
+
+	t.Run("fails closed before the first listing", func(t *testing.T) {
+		api := newGitHubAppAPI(t, key)
+		api.status.Store(http.StatusBadGateway)
+		repos := NewGitHubAppRepositories("12345", key, WithAppAPIURL(api.server.URL))
+
+		if err := repos.Check(ctx, claims("67890")); !errors.Is(err, ErrGitHubAPI) {
+			t.Errorf("Check() error = %v, want ErrGitHubAPI", err)
+		}
+	})
+
+	t.Run("wrong app key", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		api := newGitHubAppAPI(t, key)
+		repos := NewGitHubAppRepositories("12345", other, WithAppAPIURL(api.server.URL))
+
+		if err := repos.Refresh(ctx); !errors.Is(err, ErrGitHubAPI) {
+			t.Errorf("Refresh() error = %v, want ErrGitHubAPI", err)
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package ghaauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultGitHubAPIURL is the GitHub REST API of github.com
+	DefaultGitHubAPIURL = "https://api.github.com"
+
+	// DefaultEnrichmentCacheDuration is how long a GitHubEnricher caches
+	// what it looked up about a repository
+	DefaultEnrichmentCacheDuration = 5 * time.Minute
+)
+
+// GitHubEnricher cross-checks verified claims with the GitHub REST API:
+// the repository must exist with the ID and visibility the token claims.
+// It also looks up the repository's topics and, optionally, its custom
+// properties for the repository_topic and custom_properties policy
+// conditions, and the head repository of pull request refs for IsFork.
+// Add it to a verifier with WithGitHubEnricher.
+//
+// Lookups are cached per repository. Verifications fail closed with
+// ErrGitHubAPI when the API cannot be reached.
+type GitHubEnricher struct {
+	apiURL        string
+	token         string
+	httpClient    *http.Client
+	cacheDuration time.Duration
+	properties    bool
+	clock         Clock
+
+	mu        sync.Mutex
+	cache     map[string]*repositoryInfo
+	nextPrune time.Time
+}
+
+// EnricherOption configures a GitHubEnricher
+type EnricherOption func(*GitHubEnricher)
+
+// repositoryInfo is what a GitHubEnricher knows about a repository
+type repositoryInfo struct {
+	ID         int64    `json:"id"`
+	Visibility string   `json:"visibility"`
+	Topics     []string `json:"topics"`
+
+	properties map[string][]string
+	expiry     time.Time
+}
+
+// NewGitHubEnricher creates an enricher that authenticates to the GitHub
+// API with token, e.g. a GitHub App installation token or a fine-grained
+// personal access token with read access to the repositories' metadata.
+// Repositories the token cannot read are reported as not found.
+func NewGitHubEnricher(token string, opts ...EnricherOption) *GitHubEnricher {
+	e := &GitHubEnricher{
+		apiURL:        DefaultGitHubAPIURL,
+		token:         token,
+		httpClient:    newHTTPClient(),
+		cacheDuration: DefaultEnrichmentCacheDuration,
+		clock:         DefaultClock{},
+		cache:         make(map[string]*repositoryInfo),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// WithEnricherAPIURL sets the API URL, e.g.
+// https://ghes.example.com/api/v3 for GitHub Enterprise Server
+func WithEnricherAPIURL(apiURL string) EnricherOption {
+	return func(e *GitHubEnricher) {
+		e.apiURL = strings.TrimSuffix(apiURL, "/")
+	}
+}
+
+// WithEnricherHTTPClient sets the HTTP client for API requests
+func WithEnricherHTTPClient(client *http.Client) EnricherOption {
+	return func(e *GitHubEnricher) {
+		e.httpClient = client
+	}
+}
+
+// WithEnricherCacheDuration sets how long lookups are cached; 0 disables
+// the cache
+func WithEnricherCacheDuration(duration time.Duration) EnricherOption {
+	return func(e *GitHubEnricher) {
+		e.cacheDuration = duration
+	}
+}
+
+// WithCustomProperties also looks up the repository's custom properties,
+// which takes a second request per repository
+func WithCustomProperties() EnricherOption {
+	return func(e *GitHubEnricher) {
+		e.properties = true
+	}
+}
+
+// WithGitHubEnricher cross-checks the claims of every token with the
+// GitHub API and sets their RepositoryTopics and RepositoryProperties
+// before the policy is evaluated. It runs as a ClaimValidator, in the
+// order added.
+func WithGitHubEnricher(enricher *GitHubEnricher) Option {
+	return WithClaimValidator(enricher.Enrich)
+}
+
+// Enrich checks the claims against the repository on GitHub and sets
+// their RepositoryTopics and RepositoryProperties, and for refs of pull
+// requests (refs/pull/<number>/merge) their HeadRepository, which takes
+// one more uncached request. It fails with ErrAccessDenied if the
+// repository or pull request does not exist or the repository differs
+// from the claims, and with ErrGitHubAPI if the API cannot be reached.
+func (e *GitHubEnricher) Enrich(ctx context.Context, claims *GitHubActionsClaims) error {
+	info, err := e.repository(ctx, claims.Repository)
+	if err != nil {
+		return err
+	}
+
+	if claims.RepositoryID != "" && strconv.FormatInt(info.ID, 10) != claims.RepositoryID {
+		return newClaimError(ErrAccessDenied, fmt.Sprintf("repository ID on GitHub is %d", info.ID),
+			map[string]any{"repository_id": claims.RepositoryID})
+	}
+	if claims.RepositoryVisibility != "" && info.Visibility != claims.RepositoryVisibility {
+		return newClaimError(ErrAccessDenied, fmt.Sprintf("repository visibility on GitHub is %s", info.Visibility),
+			map[string]any{"repository_visibility": claims.RepositoryVisibility})
+	}
+
+	claims.RepositoryTopics = slices.Clone(info.Topics)
+	claims.RepositoryProperties = maps.Clone(info.properties)
+
+	if number, ok := pullRequestNumber(claims.Ref); ok {
+		var pull struct {
+			Head struct {
+				Repo *struct {
+					FullName string `json:"full_name"`
+				} `json:"repo"`
+			} `json:"head"`
+		}
+		owner, name, _ := strings.Cut(claims.Repository, "/")
+		path := "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name) + "/pulls/" + number
+		if err := e.get(ctx, path, &pull, "pull request not found on GitHub"); err != nil {
+			return err
+		}
+		// The head repository is null once a fork is deleted
+		if pull.Head.Repo != nil {
+			claims.HeadRepository = pull.Head.Repo.FullName
+		}
+	}
+	return nil
+}
+
+// pullRequestNumber returns the pull request number of a ref such as
+// refs/pull/7/merge
+func pullRequestNumber(ref string) (string, bool) {
+	rest, ok := strings.CutPrefix(ref, "refs/pull/")
+	if !ok {
+		return "", false
+	}
+	number, _, _ := strings.Cut(rest, "/")
+	if _, err := strconv.ParseUint(number, 10, 64); err != nil {
+		return "", false
+	}
+	return number, true
+}
+
+// repository returns the cached or freshly looked up repository
+func (e *GitHubEnricher) repository(ctx context.Context, repository string) (*repositoryInfo, error) {
+	owner, name, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || name == "" {
+		return nil, newClaimError(ErrInvalidToken, "repository claim is not owner/name", map[string]any{"repository": repository})
+	}
+
+	now := e.clock.Now()
+	e.mu.Lock()
+	info, ok := e.cache[repository]
+	e.mu.Unlock()
+	if ok && now.Before(info.expiry) {
+		return info, nil
+	}
+
+	info = &repositoryInfo{}
+	path := "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name)
+	if err := e.get(ctx, path, info, "repository not found on GitHub"); err != nil {
+		return nil, err
+	}
+	if e.properties {
+		var values []struct {
+			Name  string `json:"property_name"`
+			Value any    `json:"value"`
+		}
+		if err := e.get(ctx, path+"/properties/values", &values, "repository not found on GitHub"); err != nil {
+			return nil, err
+		}
+		info.properties = make(map[string][]string, len(values))
+		for _, v := range values {
+			switch value := v.Value.(type) {
+			case string:
+				info.properties[v.Name] = []string{value}
+			case []any:
+				for _, item := range value {
+					if s, ok := item.(string); ok {
+						info.properties[v.Name] = append(info.properties[v.Name], s)
+					}
+				}
+			}
+		}
+	}
+
+	if e.cacheDuration > 0 {
+		info.expiry = now.Add(e.cacheDuration)
+		e.store(repository, info, now)
+	}
+	return info, nil
+}
+
+// store caches a lookup, dropping expired ones from time to time
+func (e *GitHubEnricher) store(repository string, info *repositoryInfo, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if now.After(e.nextPrune) {
+		for repo, cached := range e.cache {
+			if !now.Before(cached.expiry) {
+				delete(e.cache, repo)
+			}
+		}
+		e.nextPrune = now.Add(e.cacheDuration)
+	}
+	e.cache[repository] = info
+}
+
+// get decodes the JSON response of an API request into v, denying access
+// with notFound if there is nothing at path
+func (e *GitHubEnricher) get(ctx context.Context, path string, v any, notFound string) error {
+	resp, err := githubRequest(ctx, e.httpClient, http.MethodGet, e.apiURL+path, e.token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return NewValidationError(ErrAccessDenied, notFound)
+	case resp.StatusCode != http.StatusOK:
+		return NewValidationError(ErrGitHubAPI, fmt.Sprintf("HTTP %d", resp.StatusCode))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return NewValidationError(ErrGitHubAPI, err.Error())
+	}
+	return nil
+}
+
+// githubRequest sends a GitHub REST API request authenticated with token,
+// if any. Transport failures are returned as ErrGitHubAPI.
+func githubRequest(ctx context.Context, client *http.Client, method, endpoint, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, NewValidationError(ErrGitHubAPI, err.Error())
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, NewValidationError(ErrGitHubAPI, err.Error())
+	}
+	return resp, nil
+}
@@ -0,0 +1,314 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+// githubAPI is a mock GitHub REST API serving myorg/myrepo
+type githubAPI struct {
+	server   *httptest.Server
+	requests atomic.Int32
+	status   atomic.Int32
+}
+
+func newGitHubAPI(t *testing.T) *githubAPI {
+	t.Helper()
+
+	api := &githubAPI{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/myorg/myrepo", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 67890, "full_name": "myorg/myrepo", "visibility": "private", "topics": ["deployable", "go"]}`))
+	})
+	mux.HandleFunc("GET /repos/myorg/myrepo/properties/values", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[
+			{"property_name": "team", "value": "platform"},
+			{"property_name": "regions", "value": ["eu", "us"]},
+			{"property_name": "tier", "value": null}
+		]`))
+	})
+	mux.HandleFunc("GET /repos/myorg/myrepo/pulls/7", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"number": 7, "head": {"repo": {"full_name": "someone/myrepo"}}}`))
+	})
+	mux.HandleFunc("GET /repos/myorg/myrepo/pulls/8", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"number": 8, "head": {"repo": {"full_name": "myorg/myrepo"}}}`))
+	})
+	api.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if status := api.status.Load(); status != 0 {
+			http.Error(w, http.StatusText(int(status)), int(status))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+func TestGitHubEnricher_Enrich(t *testing.T) {
+	api := newGitHubAPI(t)
+
+	tests := []struct {
+		name           string
+		claims         GitHubActionsClaims
+		status         int
+		wantErr        error
+		wantTopics     []string
+		wantProperties map[string][]string
+	}{
+		{
+			name:           "matching repository",
+			claims:         GitHubActionsClaims{Repository: "myorg/myrepo", RepositoryID: "67890", RepositoryVisibility: "private"},
+			wantTopics:     []string{"deployable", "go"},
+			wantProperties: map[string][]string{"team": {"platform"}, "regions": {"eu", "us"}},
+		},
+		{
+			name:    "unknown repository",
+			claims:  GitHubActionsClaims{Repository: "myorg/other", RepositoryID: "67890"},
+			wantErr: ErrAccessDenied,
+		},
+		{
+			name:    "repository ID mismatch",
+			claims:  GitHubActionsClaims{Repository: "myorg/myrepo", RepositoryID: "11111"},
+			wantErr: ErrAccessDenied,
+		},
+		{
+			name:    "visibility mismatch",
+			claims:  GitHubActionsClaims{Repository: "myorg/myrepo", RepositoryID: "67890", RepositoryVisibility: "public"},
+			wantErr: ErrAccessDenied,
+		},
+		{
+			name:    "API unavailable",
+			claims:  GitHubActionsClaims{Repository: "myorg/myrepo", RepositoryID: "67890"},
+			status:  http.StatusBadGateway,
+			wantErr: ErrGitHubAPI,
+		},
+		{
+			name:    "malformed repository claim",
+			claims:  GitHubActionsClaims{Repository: "myrepo"},
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api.status.Store(int32(tt.status))
+			enricher := NewGitHubEnricher("test-token",
+				WithEnricherAPIURL(api.server.URL+"/"),
+				WithCustomProperties(),
+			)
+
+			claims := tt.claims
+			err := enricher.Enrich(context.Background(), &claims)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Enrich() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Enrich() error = %v", err)
+			}
+			if !reflect.DeepEqual(claims.RepositoryTopics, tt.wantTopics) {
+				t.Errorf("RepositoryTopics = %v, want %v", claims.RepositoryTopics, tt.wantTopics)
+			}
+			if !reflect.DeepEqual(claims.RepositoryProperties, tt.wantProperties) {
+				t.Errorf("RepositoryProperties = %v, want %v", claims.RepositoryProperties, tt.wantProperties)
+			}
+		})
+	}
+}
+
+func TestGitHubEnricher_HeadRepository(t *testing.T) {
+	api := newGitHubAPI(t)
+	enricher := NewGitHubEnricher("test-token", WithEnricherAPIURL(api.server.URL))
+
+	tests := []struct {
+		name         string
+		ref          string
+		wantHead     string
+		wantFork     bool
+		wantFromFork bool
+		wantErr      error
+	}{
+		{name: "fork", ref: "refs/pull/7/merge", wantHead: "someone/myrepo", wantFork: true, wantFromFork: true},
+		{name: "same repository", ref: "refs/pull/8/merge", wantHead: "myorg/myrepo"},
+		{name: "unknown pull request", ref: "refs/pull/9/merge", wantErr: ErrAccessDenied},
+		{name: "pull_request_target on a branch", ref: "refs/heads/main", wantFromFork: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &GitHubActionsClaims{Repository: "myorg/myrepo", Ref: tt.ref, EventName: "pull_request_target"}
+			err := enricher.Enrich(context.Background(), claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Enrich() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if claims.HeadRepository != tt.wantHead {
+				t.Errorf("HeadRepository = %q, want %q", claims.HeadRepository, tt.wantHead)
+			}
+			if claims.IsFork() != tt.wantFork || claims.IsPullRequestFromFork() != tt.wantFromFork {
+				t.Errorf("IsFork() = %v, IsPullRequestFromFork() = %v, want %v, %v",
+					claims.IsFork(), claims.IsPullRequestFromFork(), tt.wantFork, tt.wantFromFork)
+			}
+		})
+	}
+}
+
+func TestWithGitHubEnricher(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		conditions Conditions
+		wantErr    error
+	}{
+		{name: "topic matches", conditions: Conditions{RepositoryTopic: []string{"deploy*"}}},
+		{name: "topic does not match", conditions: Conditions{RepositoryTopic: []string{"archived"}}, wantErr: ErrAccessDenied},
+		{name: "property matches", conditions: Conditions{CustomProperties: map[string][]string{"team": {"platform"}}}},
+		{name: "multi-select property matches", conditions: Conditions{CustomProperties: map[string][]string{"regions": {"us"}}}},
+		{name: "property does not match", conditions: Conditions{CustomProperties: map[string][]string{"team": {"infra"}}}, wantErr: ErrAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newGitHubAPI(t)
+			verifier, err := New(
+				WithJWKSURL(server.JWKSURL()),
+				WithPolicy(&Policy{
+					Rules:       []Rule{{Name: "allow-tagged", Conditions: tt.conditions, Effect: EffectAllow}},
+					DefaultDeny: true,
+				}),
+				WithGitHubEnricher(NewGitHubEnricher("test-token",
+					WithEnricherAPIURL(api.server.URL),
+					WithCustomProperties(),
+				)),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			for range 2 {
+				_, err = verifier.Verify(context.Background(), token)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+					}
+				} else if err != nil {
+					t.Errorf("Verify() error = %v", err)
+				}
+			}
+
+			// The second verification is served from the cache
+			if got := api.requests.Load(); got != 2 {
+				t.Errorf("API requests = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestListConditions(t *testing.T) {
+	claims := &GitHubActionsClaims{
+		Repository:           "myorg/myrepo",
+		RepositoryTopics:     []string{"deployable"},
+		RepositoryProperties: map[string][]string{"team": {"platform"}, "regions": {"eu", "us"}},
+	}
+
+	tests := []struct {
+		name       string
+		conditions Conditions
+		want       bool
+	}{
+		{name: "topic", conditions: Conditions{RepositoryTopic: []string{"deployable"}}, want: true},
+		{name: "any topic pattern", conditions: Conditions{RepositoryTopic: []string{"archived", "deploy*"}}, want: true},
+		{name: "missing topic", conditions: Conditions{RepositoryTopic: []string{"archived"}}, want: false},
+		{name: "property", conditions: Conditions{CustomProperties: map[string][]string{"team": {"plat*"}}}, want: true},
+		{name: "any property value", conditions: Conditions{CustomProperties: map[string][]string{"regions": {"us"}}}, want: true},
+		{name: "missing property", conditions: Conditions{CustomProperties: map[string][]string{"owner": {"platform"}}}, want: false},
+		{name: "every property must match", conditions: Conditions{CustomProperties: map[string][]string{"team": {"platform"}, "regions": {"ap"}}}, want: false},
+		{name: "topic and property", conditions: Conditions{RepositoryTopic: []string{"deployable"}, CustomProperties: map[string][]string{"team": {"infra"}}}, want: false},
+		{name: "with other conditions", conditions: Conditions{Repository: []string{"myorg/*"}, RepositoryTopic: []string{"**"}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &Policy{Rules: []Rule{{Conditions: tt.conditions, Effect: EffectAllow}}, DefaultDeny: true}
+			if err := policy.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if got := policy.Evaluate(claims).Allowed; got != tt.want {
+				t.Errorf("Evaluate().Allowed = %v, want %v", got, tt.want)
+			}
+			if got := policy.Compile().Evaluate(claims).Allowed; got != tt.want {
+				t.Errorf("compiled Evaluate().Allowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	unenriched := &GitHubActionsClaims{Repository: "myorg/myrepo"}
+	policy := &Policy{Rules: []Rule{{Conditions: Conditions{RepositoryTopic: []string{"**"}}, Effect: EffectAllow}}, DefaultDeny: true}
+	if policy.Evaluate(unenriched).Allowed {
+		t.Error("topic condition matched claims without topics")
+	}
+}
+
+func TestCustomProperties_Policy(t *testing.T) {
+	policy, err := ParsePolicyYAML([]byte(`
+default_deny: true
+condition_sets:
+  platform:
+    custom_properties:
+      team: [platform]
+rules:
+  - name: deploy-prod
+    use: [platform]
+    conditions:
+      custom_properties:
+        team: [sre]
+        tier: [prod*]
+    effect: allow
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	// The rule's patterns replace those of the set for the same property
+	want := map[string][]string{"team": {"sre"}, "tier": {"prod*"}}
+	if got := policy.Rules[0].Conditions.CustomProperties; !reflect.DeepEqual(got, want) {
+		t.Errorf("CustomProperties = %v, want %v", got, want)
+	}
+
+	invalid := &Policy{Rules: []Rule{{Conditions: Conditions{CustomProperties: map[string][]string{"team": nil}}, Effect: EffectAllow}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Validate() error = nil for a property without patterns")
+	}
+
+	if errs := ValidateDocument([]byte(`{"rules": [{"conditions": {"custom_properties": {"team": "platform"}}, "effect": "allow"}]}`)); len(errs) == 0 {
+		t.Error("ValidateDocument() accepted a property pattern that is not a list")
+	}
+}
@@ -2,4 +2,10 @@ module github.com/dev-shimada/gha-auth
 
 go 1.25.6
 
-require github.com/golang-jwt/jwt/v5 v5.3.1
+require (
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/golang-jwt/jwt/v5 v5.3.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.13.0 // indirect
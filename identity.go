@@ -0,0 +1,66 @@
+package ghaauth
+
+import "strings"
+
+// Identity is the caller distilled from the claims, for keying rate limits,
+// quotas and audit entries
+type Identity struct {
+	// Org is the repository owner (e.g., "myorg")
+	Org string
+
+	// Repo is the repository name without the owner (e.g., "myrepo")
+	Repo string
+
+	// Ref is the git reference (e.g., "refs/heads/main")
+	Ref string
+
+	// Workflow is the workflow name (e.g., "Deploy")
+	Workflow string
+
+	// Environment is the deployment environment, if any
+	Environment string
+
+	// RunID identifies the workflow run
+	RunID string
+
+	// Issuer is the issuer of tokens mapped from another CI provider, empty
+	// for GitHub Actions tokens. Other providers' projects can have the
+	// same names as GitHub repositories, so it keeps their identities apart.
+	Issuer string
+}
+
+// Identity returns the caller identity of the claims
+func (c *GitHubActionsClaims) Identity() Identity {
+	org := c.RepositoryOwner
+	repo := c.Repository
+	if owner, name, ok := strings.Cut(c.Repository, "/"); ok {
+		repo = name
+		if org == "" {
+			org = owner
+		}
+	}
+
+	identity := Identity{
+		Org:         org,
+		Repo:        repo,
+		Ref:         c.Ref,
+		Workflow:    c.Workflow,
+		Environment: c.Environment,
+		RunID:       c.RunID,
+	}
+	if c.mapped {
+		identity.Issuer = c.Issuer
+	}
+	return identity
+}
+
+// String returns the canonical form "org/repo@ref#workflow", prefixed
+// with "<issuer>#" for other CI providers, which is stable across runs:
+// Environment and RunID are not part of it
+func (i Identity) String() string {
+	s := i.Org + "/" + i.Repo + "@" + i.Ref + "#" + i.Workflow
+	if i.Issuer != "" {
+		s = i.Issuer + "#" + s
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package ghaauth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultIdentityHeaderPrefix is the prefix of the identity headers set by
+// ForwardAuthHandler and WithIdentityHeaders("")
+const DefaultIdentityHeaderPrefix = "X-GHA-"
+
+// Identity headers with the default prefix
+const (
+	HeaderIdentity    = DefaultIdentityHeaderPrefix + "Identity"
+	HeaderRepository  = DefaultIdentityHeaderPrefix + "Repository"
+	HeaderRef         = DefaultIdentityHeaderPrefix + "Ref"
+	HeaderWorkflow    = DefaultIdentityHeaderPrefix + "Workflow"
+	HeaderActor       = DefaultIdentityHeaderPrefix + "Actor"
+	HeaderEnvironment = DefaultIdentityHeaderPrefix + "Environment"
+	HeaderRunID       = DefaultIdentityHeaderPrefix + "Run-ID"
+	HeaderMatchedRule = DefaultIdentityHeaderPrefix + "Matched-Rule"
+	HeaderIssuer      = DefaultIdentityHeaderPrefix + "Issuer"
+)
+
+// WithIdentityHeaders makes Middleware describe the verified caller in
+// request headers, for downstream services that only read headers: the
+// identity, issuer, repository, ref, workflow, actor, run ID, environment
+// and matched rule, named with prefix as in HeaderRepository. Tokens of
+// other CI providers, mapped by a ClaimMapper, can name the same
+// repositories as GitHub's, so services accepting them should check the
+// issuer header too; their identity header starts with the issuer. The
+// prefix should end with a hyphen, e.g. "X-Auth-"; it is "X-GHA-" when
+// empty.
+// Headers with the prefix sent by the client are removed, so they cannot
+// be spoofed. With ForwardAuthHandler, it sets the prefix of the response
+// headers.
+func WithIdentityHeaders(prefix string) MiddlewareOption {
+	if prefix == "" {
+		prefix = DefaultIdentityHeaderPrefix
+	}
+	return func(c *middlewareConfig) {
+		c.identityHeaders = prefix
+	}
+}
+
+// setIdentityHeaders describes the verified caller in the headers named
+// with prefix, replacing any headers with that prefix
+func setIdentityHeaders(h http.Header, prefix string, result *VerificationResult) {
+	canonical := http.CanonicalHeaderKey(prefix)
+	for name := range h {
+		if strings.HasPrefix(name, canonical) {
+			delete(h, name)
+		}
+	}
+
+	claims := result.Claims
+	h.Set(prefix+"Identity", result.Identity.String())
+	h.Set(prefix+"Issuer", claims.Issuer)
+	h.Set(prefix+"Repository", claims.Repository)
+	h.Set(prefix+"Ref", claims.Ref)
+	h.Set(prefix+"Workflow", claims.Workflow)
+	h.Set(prefix+"Actor", claims.Actor)
+	h.Set(prefix+"Run-ID", claims.RunID)
+	if claims.Environment != "" {
+		h.Set(prefix+"Environment", claims.Environment)
+	}
+	if result.PolicyResult != nil && result.PolicyResult.MatchedRule != "" {
+		h.Set(prefix+"Matched-Rule", result.PolicyResult.MatchedRule)
+	}
+}
@@ -0,0 +1,104 @@
+package ghaauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestWithIdentityHeaders(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithPolicy(&Policy{
+			Rules:       []Rule{{Name: "allow-myorg", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}},
+			DefaultDeny: true,
+		}),
+		WithAudience("https://api.example.com"),
+		WithJWKSURL(server.JWKSURL()),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		header string
+	}{
+		{name: "default prefix", prefix: "", header: HeaderRepository},
+		{name: "custom prefix", prefix: "X-Auth-", header: "X-Auth-Repository"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var downstream http.Header
+			handler := Middleware(verifier, WithIdentityHeaders(tt.prefix))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				downstream = r.Header
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/deploy", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			spoofed := tt.header[:len(tt.header)-len("Repository")] + "Environment"
+			req.Header.Set(spoofed, "production")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body)
+			}
+			if got := downstream.Get(tt.header); got != "myorg/myrepo" {
+				t.Errorf("%s = %q, want myorg/myrepo", tt.header, got)
+			}
+			if got := downstream.Get(spoofed); got != "" {
+				t.Errorf("%s = %q, want the client's header removed", spoofed, got)
+			}
+			if req.Header.Get(spoofed) != "production" {
+				t.Error("the original request's headers were modified")
+			}
+			if got := rec.Header().Get(tt.header); got != "" {
+				t.Errorf("response %s = %q, want only request headers", tt.header, got)
+			}
+		})
+	}
+
+	t.Run("forward auth", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/verify", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		ForwardAuthHandler(verifier, WithIdentityHeaders("X-Auth-")).ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("X-Auth-Matched-Rule"); got != "allow-myorg" {
+			t.Errorf("X-Auth-Matched-Rule = %q, want allow-myorg", got)
+		}
+		if got := rec.Header().Get(HeaderRepository); got != "" {
+			t.Errorf("%s = %q with a custom prefix", HeaderRepository, got)
+		}
+	})
+
+	t.Run("without option", func(t *testing.T) {
+		var downstream http.Header
+		handler := Middleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			downstream = r.Header
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/deploy", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if got := downstream.Get(HeaderRepository); got != "" {
+			t.Errorf("%s = %q without WithIdentityHeaders", HeaderRepository, got)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package ghaauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestGitHubActionsClaims_Identity(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     GitHubActionsClaims
+		want       Identity
+		wantString string
+	}{
+		{
+			name: "full claims",
+			claims: GitHubActionsClaims{
+				Repository:      "myorg/myrepo",
+				RepositoryOwner: "myorg",
+				Ref:             "refs/heads/main",
+				Workflow:        "Deploy",
+				Environment:     "production",
+				RunID:           "123",
+			},
+			want: Identity{
+				Org:         "myorg",
+				Repo:        "myrepo",
+				Ref:         "refs/heads/main",
+				Workflow:    "Deploy",
+				Environment: "production",
+				RunID:       "123",
+			},
+			wantString: "myorg/myrepo@refs/heads/main#Deploy",
+		},
+		{
+			name:       "owner taken from repository",
+			claims:     GitHubActionsClaims{Repository: "myorg/myrepo", Ref: "refs/tags/v1", Workflow: "Release"},
+			want:       Identity{Org: "myorg", Repo: "myrepo", Ref: "refs/tags/v1", Workflow: "Release"},
+			wantString: "myorg/myrepo@refs/tags/v1#Release",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.claims.Identity()
+			if got != tt.want {
+				t.Errorf("Identity() = %+v, want %+v", got, tt.want)
+			}
+			if s := got.String(); s != tt.wantString {
+				t.Errorf("String() = %q, want %q", s, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestVerificationResult_Identity(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(WithJWKSURL(server.URL() + "/.well-known/jwks"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	result, err := verifier.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if got := result.Identity.String(); got != "myorg/myrepo@refs/heads/main#CI" {
+		t.Errorf("Identity = %q, want myorg/myrepo@refs/heads/main#CI", got)
+	}
+}
@@ -0,0 +1,57 @@
+package ghaauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// WorkflowInputs maps the inputs of a workflow_dispatch run to their
+// values. Tokens only carry the inputs claim under some configurations;
+// without it, inputs conditions never match. Boolean and number inputs are
+// kept in their JSON form, e.g. "true" and "3".
+type WorkflowInputs map[string]string
+
+// UnmarshalJSON decodes an inputs object, accepting values of any JSON
+// type; null values are left out
+func (in *WorkflowInputs) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*in = nil
+		return nil
+	}
+
+	inputs := make(WorkflowInputs, len(raw))
+	for name, value := range raw {
+		switch {
+		case bytes.Equal(value, []byte("null")):
+			continue
+		case len(value) > 0 && value[0] == '"':
+			var s string
+			if err := json.Unmarshal(value, &s); err != nil {
+				return err
+			}
+			inputs[name] = s
+		default:
+			inputs[name] = strings.TrimSpace(string(value))
+		}
+	}
+	*in = inputs
+	return nil
+}
+
+// inputsMismatch reports whether an inputs condition is not satisfied:
+// every listed input must be present with a value matching one of its
+// patterns
+func inputsMismatch(cond map[string][]string, inputs WorkflowInputs) bool {
+	for name, patterns := range cond {
+		value, ok := inputs[name]
+		if !ok || !MatchAny(patterns, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"maps"
+	"testing"
+)
+
+func TestWorkflowInputs_UnmarshalJSON(t *testing.T) {
+	var claims GitHubActionsClaims
+	data := `{"repository":"myorg/myrepo","event_name":"workflow_dispatch","inputs":{"target":"staging","dry_run":true,"replicas":3,"notes":null}}`
+	if err := json.Unmarshal([]byte(data), &claims); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := WorkflowInputs{"target": "staging", "dry_run": "true", "replicas": "3"}
+	if !maps.Equal(claims.Inputs, want) {
+		t.Errorf("Inputs = %v, want %v", claims.Inputs, want)
+	}
+	if claims.Extra != nil {
+		t.Errorf("Extra = %v, want inputs decoded into their field", claims.Extra)
+	}
+	if got := claims.ToMap()["inputs"]; got != `{"dry_run":"true","replicas":"3","target":"staging"}` {
+		t.Errorf("ToMap()[inputs] = %s", got)
+	}
+
+	if err := json.Unmarshal([]byte(`{"inputs":"target=staging"}`), &claims); err == nil {
+		t.Error("Unmarshal() error = nil for inputs that are not an object")
+	}
+}
+
+func TestPolicy_EvaluateInputs(t *testing.T) {
+	policy, err := ParsePolicyYAML([]byte(`
+default_deny: true
+rules:
+  - name: deploy-staging
+    conditions:
+      repository: [myorg/myrepo]
+      event_name: [workflow_dispatch]
+      inputs:
+        target: [staging, "qa-*"]
+        dry_run: ["false"]
+    effect: allow
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		inputs WorkflowInputs
+		want   bool
+	}{
+		{name: "matching inputs", inputs: WorkflowInputs{"target": "staging", "dry_run": "false"}, want: true},
+		{name: "pattern", inputs: WorkflowInputs{"target": "qa-2", "dry_run": "false", "extra": "x"}, want: true},
+		{name: "other target", inputs: WorkflowInputs{"target": "production", "dry_run": "false"}},
+		{name: "missing input", inputs: WorkflowInputs{"target": "staging"}},
+		{name: "no inputs claim"},
+	}
+
+	compiled := policy.Compile()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &GitHubActionsClaims{Repository: "myorg/myrepo", EventName: "workflow_dispatch", Inputs: tt.inputs}
+			if got := policy.Evaluate(claims).Allowed; got != tt.want {
+				t.Errorf("Evaluate().Allowed = %v, want %v", got, tt.want)
+			}
+			if got := compiled.Evaluate(claims).Allowed; got != tt.want {
+				t.Errorf("CompiledPolicy.Evaluate().Allowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	policy.Rules[0].Conditions.Inputs["target"] = nil
+	if err := policy.Validate(); err == nil {
+		t.Error("Validate() error = nil for an input without patterns")
+	}
+}
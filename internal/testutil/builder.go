@@ -0,0 +1,104 @@
+package testutil
+
+import (
+	"strings"
+	"time"
+)
+
+// The With methods modify the claims in place and return them, so that
+// fixtures can be adjusted in one expression. Methods changing the
+// repository, ref, event or environment also update the subject to the
+// format GitHub uses.
+
+// WithRepository sets the repository and its owner, e.g. "myorg/api"
+func (tc *TokenClaims) WithRepository(repository string) *TokenClaims {
+	tc.Repository = repository
+	if owner, _, ok := strings.Cut(repository, "/"); ok {
+		tc.RepositoryOwner = owner
+	}
+	return tc.withSubject()
+}
+
+// WithRef sets the ref and its ref type, e.g. "refs/heads/develop"
+func (tc *TokenClaims) WithRef(ref string) *TokenClaims {
+	tc.Ref = ref
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		tc.RefType = "branch"
+	case strings.HasPrefix(ref, "refs/tags/"):
+		tc.RefType = "tag"
+	default:
+		tc.RefType = ""
+	}
+	return tc.withSubject()
+}
+
+// WithEvent sets the event name, e.g. "workflow_dispatch"
+func (tc *TokenClaims) WithEvent(eventName string) *TokenClaims {
+	tc.EventName = eventName
+	return tc.withSubject()
+}
+
+// WithEnvironment sets the deployment environment, or clears it
+func (tc *TokenClaims) WithEnvironment(environment string) *TokenClaims {
+	tc.Environment = environment
+	return tc.withSubject()
+}
+
+// WithActor sets the actor and triggering actor
+func (tc *TokenClaims) WithActor(actor string) *TokenClaims {
+	tc.Actor = actor
+	tc.TriggeringActor = actor
+	return tc
+}
+
+// WithJobWorkflowRef sets the reusable workflow the job runs, e.g.
+// "myorg/shared/.github/workflows/deploy.yml@refs/heads/main"
+func (tc *TokenClaims) WithJobWorkflowRef(jobWorkflowRef string) *TokenClaims {
+	tc.JobWorkflowRef = jobWorkflowRef
+	return tc
+}
+
+// WithRunnerEnvironment sets the runner environment, "github-hosted" or
+// "self-hosted"
+func (tc *TokenClaims) WithRunnerEnvironment(runnerEnvironment string) *TokenClaims {
+	tc.RunnerEnvironment = runnerEnvironment
+	return tc
+}
+
+// WithAudience sets the audience
+func (tc *TokenClaims) WithAudience(audience ...string) *TokenClaims {
+	tc.Audience = audience
+	return tc
+}
+
+// WithExpiry makes the token expire d from now; a negative d makes it
+// already expired. The issue time moves back if needed to precede expiry.
+func (tc *TokenClaims) WithExpiry(d time.Duration) *TokenClaims {
+	tc.ExpiresAt = time.Now().Add(d)
+	if !tc.IssuedAt.Before(tc.ExpiresAt) {
+		tc.IssuedAt = tc.ExpiresAt.Add(-5 * time.Minute)
+		tc.NotBefore = tc.IssuedAt
+	}
+	return tc
+}
+
+// WithSubject sets the subject, e.g. to a customized format
+func (tc *TokenClaims) WithSubject(subject string) *TokenClaims {
+	tc.Subject = subject
+	return tc
+}
+
+// withSubject derives the subject from the other claims like GitHub's
+// default subject format
+func (tc *TokenClaims) withSubject() *TokenClaims {
+	switch {
+	case tc.Environment != "":
+		tc.Subject = "repo:" + tc.Repository + ":environment:" + tc.Environment
+	case tc.EventName == "pull_request" || tc.EventName == "pull_request_target":
+		tc.Subject = "repo:" + tc.Repository + ":pull_request"
+	default:
+		tc.Subject = "repo:" + tc.Repository + ":ref:" + tc.Ref
+	}
+	return tc
+}
@@ -0,0 +1,67 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DPoPKey is a workflow-held P-256 key for creating DPoP proofs
+type DPoPKey struct {
+	privateKey *ecdsa.PrivateKey
+}
+
+// NewDPoPKey creates a new DPoP key
+func NewDPoPKey() (*DPoPKey, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ECDSA key: %w", err)
+	}
+	return &DPoPKey{privateKey: privateKey}, nil
+}
+
+// JWK returns the public key as the members of a JWK
+func (k *DPoPKey) JWK() map[string]any {
+	size := (k.privateKey.Curve.Params().BitSize + 7) / 8
+	x := make([]byte, size)
+	y := make([]byte, size)
+	k.privateKey.X.FillBytes(x)
+	k.privateKey.Y.FillBytes(y)
+
+	return map[string]any{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+// Proof creates a DPoP proof for a request, bound to token when it is not
+// empty. Claims in extra are added to or replace the standard ones.
+func (k *DPoPKey) Proof(method, url, token string, extra jwt.MapClaims) (string, error) {
+	claims := jwt.MapClaims{
+		"jti": rand.Text(),
+		"htm": method,
+		"htu": url,
+		"iat": time.Now().Unix(),
+	}
+	if token != "" {
+		sum := sha256.Sum256([]byte(token))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+
+	proof := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	proof.Header["typ"] = "dpop+jwt"
+	proof.Header["jwk"] = k.JWK()
+
+	return proof.SignedString(k.privateKey)
+}
@@ -7,20 +7,37 @@ import (
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"sync"
+	"time"
 )
 
-// JWKSServer is a mock JWKS endpoint server for testing
+// JWKSServer is a mock JWKS endpoint server for testing. Its keys can be
+// added, removed and rotated while it runs, and it can be made to fail or
+// respond slowly, to test caching, rotation handling and retries. It is
+// safe for concurrent use.
 type JWKSServer struct {
-	server    *httptest.Server
-	publicKey *rsa.PublicKey
+	server *httptest.Server
+
+	mu           sync.Mutex
+	keys         []publishedKey
+	failures     []int
+	status       int
+	delay        time.Duration
+	cacheControl string
+	fetches      int
+}
+
+// publishedKey is a key served by a JWKSServer
+type publishedKey struct {
 	keyID     string
+	publicKey *rsa.PublicKey
 }
 
-// NewJWKSServer creates a new mock JWKS server
+// NewJWKSServer creates a new mock JWKS server publishing a single key
 func NewJWKSServer(publicKey *rsa.PublicKey, keyID string) *JWKSServer {
 	s := &JWKSServer{
-		publicKey: publicKey,
-		keyID:     keyID,
+		keys: []publishedKey{{keyID: keyID, publicKey: publicKey}},
 	}
 
 	s.server = httptest.NewServer(http.HandlerFunc(s.handler))
@@ -32,11 +49,101 @@ func (s *JWKSServer) URL() string {
 	return s.server.URL
 }
 
+// JWKSURL returns the URL of the JWKS endpoint, for ghaauth.WithJWKSURL
+func (s *JWKSServer) JWKSURL() string {
+	return s.server.URL + "/.well-known/jwks"
+}
+
 // Close shuts down the server
 func (s *JWKSServer) Close() {
 	s.server.Close()
 }
 
+// AddKey publishes another key, replacing any key with the same ID, e.g.
+// to announce the next key ahead of a rotation
+func (s *JWKSServer) AddKey(publicKey *rsa.PublicKey, keyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = slices.DeleteFunc(s.keys, func(k publishedKey) bool { return k.keyID == keyID })
+	s.keys = append(s.keys, publishedKey{keyID: keyID, publicKey: publicKey})
+}
+
+// RemoveKey stops publishing a key, e.g. to retire it after a rotation
+func (s *JWKSServer) RemoveKey(keyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = slices.DeleteFunc(s.keys, func(k publishedKey) bool { return k.keyID == keyID })
+}
+
+// Rotate replaces all published keys with a single new key at once,
+// without the overlap a well-behaved issuer would allow
+func (s *JWKSServer) Rotate(publicKey *rsa.PublicKey, keyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = []publishedKey{{keyID: keyID, publicKey: publicKey}}
+}
+
+// KeyIDs returns the IDs of the published keys
+func (s *JWKSServer) KeyIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, len(s.keys))
+	for i, k := range s.keys {
+		ids[i] = k.keyID
+	}
+	return ids
+}
+
+// FailNext makes the next n requests fail with the given HTTP status, e.g.
+// http.StatusServiceUnavailable, before the server recovers
+func (s *JWKSServer) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for range n {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// SetStatus makes every request fail with the given HTTP status until it
+// is reset with 0 or http.StatusOK
+func (s *JWKSServer) SetStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status = status
+}
+
+// SetDelay delays every response, e.g. to exceed a client timeout
+func (s *JWKSServer) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delay = delay
+}
+
+// SetCacheControl sets the Cache-Control header of successful responses,
+// e.g. "max-age=60"
+func (s *JWKSServer) SetCacheControl(value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cacheControl = value
+}
+
+// Fetches returns the number of requests to the JWKS endpoint so far,
+// including failed ones
+func (s *JWKSServer) Fetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.fetches
+}
+
 // handler serves the JWKS endpoint
 func (s *JWKSServer) handler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/.well-known/jwks.json" && r.URL.Path != "/.well-known/jwks" {
@@ -44,8 +151,35 @@ func (s *JWKSServer) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.mu.Lock()
+	s.fetches++
+	status := s.status
+	if len(s.failures) > 0 {
+		status = s.failures[0]
+		s.failures = s.failures[1:]
+	}
+	delay := s.delay
+	cacheControl := s.cacheControl
 	jwks := s.buildJWKS()
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if status != 0 && status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
 	if err := json.NewEncoder(w).Encode(jwks); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -53,19 +187,20 @@ func (s *JWKSServer) handler(w http.ResponseWriter, r *http.Request) {
 
 // buildJWKS constructs the JWKS response
 func (s *JWKSServer) buildJWKS() map[string]interface{} {
-	n := s.publicKey.N.Bytes()
-	e := big.NewInt(int64(s.publicKey.E)).Bytes()
-
-	return map[string]interface{}{
-		"keys": []map[string]interface{}{
-			{
-				"kty": "RSA",
-				"kid": s.keyID,
-				"use": "sig",
-				"alg": "RS256",
-				"n":   base64.RawURLEncoding.EncodeToString(n),
-				"e":   base64.RawURLEncoding.EncodeToString(e),
-			},
-		},
+	keys := make([]map[string]interface{}, 0, len(s.keys))
+	for _, k := range s.keys {
+		n := k.publicKey.N.Bytes()
+		e := big.NewInt(int64(k.publicKey.E)).Bytes()
+
+		keys = append(keys, map[string]interface{}{
+			"kty": "RSA",
+			"kid": k.keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(n),
+			"e":   base64.RawURLEncoding.EncodeToString(e),
+		})
 	}
+
+	return map[string]interface{}{"keys": keys}
 }
@@ -17,6 +17,12 @@ type TokenGenerator struct {
 
 // NewTokenGenerator creates a new token generator with a random RSA key pair
 func NewTokenGenerator() (*TokenGenerator, error) {
+	return NewTokenGeneratorWithKeyID("test-key-1")
+}
+
+// NewTokenGeneratorWithKeyID creates a new token generator with a random
+// RSA key pair and the given key ID, e.g. for the next key of a rotation
+func NewTokenGeneratorWithKeyID(keyID string) (*TokenGenerator, error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		return nil, err
@@ -25,7 +31,7 @@ func NewTokenGenerator() (*TokenGenerator, error) {
 	return &TokenGenerator{
 		privateKey: privateKey,
 		publicKey:  &privateKey.PublicKey,
-		keyID:      "test-key-1",
+		keyID:      keyID,
 	}, nil
 }
 
@@ -41,7 +47,13 @@ func (g *TokenGenerator) KeyID() string {
 
 // GenerateToken creates a signed JWT token with the given claims
 func (g *TokenGenerator) GenerateToken(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	return g.GenerateTokenWithMethod(jwt.SigningMethodRS256, claims)
+}
+
+// GenerateTokenWithMethod creates a JWT token signed with the given RSA
+// signing method, e.g. jwt.SigningMethodRS384
+func (g *TokenGenerator) GenerateTokenWithMethod(method jwt.SigningMethod, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(method, claims)
 	token.Header["kid"] = g.keyID
 
 	return token.SignedString(g.privateKey)
@@ -49,68 +61,70 @@ func (g *TokenGenerator) GenerateToken(claims jwt.Claims) (string, error) {
 
 // TokenClaims is a helper for building test token claims
 type TokenClaims struct {
-	Issuer              string
-	Subject             string
-	Audience            []string
-	ExpiresAt           time.Time
-	IssuedAt            time.Time
-	NotBefore           time.Time
-	Repository          string
-	RepositoryOwner     string
-	RepositoryOwnerID   string
+	Issuer               string
+	Subject              string
+	Audience             []string
+	ExpiresAt            time.Time
+	IssuedAt             time.Time
+	NotBefore            time.Time
+	Repository           string
+	RepositoryOwner      string
+	RepositoryOwnerID    string
 	RepositoryVisibility string
-	RepositoryID        string
-	Ref                 string
-	RefType             string
-	SHA                 string
-	Workflow            string
-	WorkflowRef         string
-	WorkflowSHA         string
-	JobWorkflowRef      string
-	JobWorkflowSHA      string
-	EventName           string
-	RunID               string
-	RunNumber           string
-	RunAttempt          string
-	RunnerEnvironment   string
-	Actor               string
-	ActorID             string
-	TriggeringActor     string
-	Environment         string
-	EnterpriseID        string
-	EnterpriseSlug      string
+	RepositoryID         string
+	Ref                  string
+	RefType              string
+	SHA                  string
+	HeadRef              string
+	BaseRef              string
+	Workflow             string
+	WorkflowRef          string
+	WorkflowSHA          string
+	JobWorkflowRef       string
+	JobWorkflowSHA       string
+	EventName            string
+	RunID                string
+	RunNumber            string
+	RunAttempt           string
+	RunnerEnvironment    string
+	Actor                string
+	ActorID              string
+	TriggeringActor      string
+	Environment          string
+	EnterpriseID         string
+	EnterpriseSlug       string
 }
 
 // DefaultClaims returns a set of valid default claims for testing
 func DefaultClaims() *TokenClaims {
 	now := time.Now()
 	return &TokenClaims{
-		Issuer:              "https://token.actions.githubusercontent.com",
-		Subject:             "repo:myorg/myrepo:ref:refs/heads/main",
-		Audience:            []string{"https://api.example.com"},
-		ExpiresAt:           now.Add(5 * time.Minute),
-		IssuedAt:            now,
-		NotBefore:           now,
-		Repository:          "myorg/myrepo",
-		RepositoryOwner:     "myorg",
-		RepositoryOwnerID:   "12345",
+		Issuer:               "https://token.actions.githubusercontent.com",
+		Subject:              "repo:myorg/myrepo:ref:refs/heads/main",
+		Audience:             []string{"https://api.example.com"},
+		ExpiresAt:            now.Add(5 * time.Minute),
+		IssuedAt:             now,
+		NotBefore:            now,
+		Repository:           "myorg/myrepo",
+		RepositoryOwner:      "myorg",
+		RepositoryOwnerID:    "12345",
 		RepositoryVisibility: "private",
-		RepositoryID:        "67890",
-		Ref:                 "refs/heads/main",
-		RefType:             "branch",
-		SHA:                 "abc123def456",
-		Workflow:            "CI",
-		WorkflowRef:         "myorg/myrepo/.github/workflows/ci.yml@refs/heads/main",
-		WorkflowSHA:         "abc123def456",
-		JobWorkflowRef:      "myorg/myrepo/.github/workflows/ci.yml@refs/heads/main",
-		JobWorkflowSHA:      "abc123def456",
-		EventName:           "push",
-		RunID:               "123456789",
-		RunNumber:           "42",
-		RunAttempt:          "1",
-		RunnerEnvironment:   "github-hosted",
-		Actor:               "johndoe",
-		ActorID:             "11111",
+		RepositoryID:         "67890",
+		Ref:                  "refs/heads/main",
+		RefType:              "branch",
+		SHA:                  "abc123def456",
+		Workflow:             "CI",
+		WorkflowRef:          "myorg/myrepo/.github/workflows/ci.yml@refs/heads/main",
+		WorkflowSHA:          "abc123def456",
+		JobWorkflowRef:       "myorg/myrepo/.github/workflows/ci.yml@refs/heads/main",
+		JobWorkflowSHA:       "abc123def456",
+		EventName:            "push",
+		RunID:                "123456789",
+		RunNumber:            "42",
+		RunAttempt:           "1",
+		RunnerEnvironment:    "github-hosted",
+		Actor:                "johndoe",
+		ActorID:              "11111",
 	}
 }
 
@@ -162,6 +176,12 @@ func (tc *TokenClaims) ToJWT() jwt.MapClaims {
 	if tc.SHA != "" {
 		claims["sha"] = tc.SHA
 	}
+	if tc.HeadRef != "" {
+		claims["head_ref"] = tc.HeadRef
+	}
+	if tc.BaseRef != "" {
+		claims["base_ref"] = tc.BaseRef
+	}
 	if tc.Workflow != "" {
 		claims["workflow"] = tc.Workflow
 	}
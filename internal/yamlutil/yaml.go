@@ -0,0 +1,86 @@
+// Package yamlutil converts YAML documents to JSON so that they can be
+// decoded with the JSON tags used throughout ghaauth.
+package yamlutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ToJSON converts a YAML document to its JSON equivalent
+func ToJSON(data []byte) ([]byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	normalized, err := normalize(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(normalized)
+}
+
+// IsYAMLFile reports whether the path has a YAML extension
+func IsYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// normalize converts YAML maps with non-string keys into JSON-compatible maps
+func normalize(value any) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			normalized, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = normalized
+		}
+		return v, nil
+
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported non-string key %v", key)
+			}
+			normalized, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			out[name] = normalized
+		}
+		return out, nil
+
+	case []any:
+		for i, item := range v {
+			normalized, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = normalized
+		}
+		return v, nil
+
+	default:
+		return v, nil
+	}
+}
+
+// FromJSON converts a JSON document to YAML. Object keys are emitted in
+// sorted order.
+func FromJSON(data []byte) ([]byte, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
@@ -0,0 +1,87 @@
+package yamlutil
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToJSON(t *testing.T) {
+	data := []byte(`
+rules:
+  - name: allow-myorg
+    conditions:
+      repository_owner: [myorg]
+    effect: allow
+default_deny: true
+`)
+
+	out, err := ToJSON(data)
+	if err != nil {
+		t.Fatalf("ToJSON() error = %v", err)
+	}
+
+	var doc struct {
+		Rules []struct {
+			Name string `json:"name"`
+		} `json:"rules"`
+		DefaultDeny bool `json:"default_deny"`
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if len(doc.Rules) != 1 || doc.Rules[0].Name != "allow-myorg" || !doc.DefaultDeny {
+		t.Errorf("ToJSON() = %s", out)
+	}
+}
+
+func TestToJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "invalid YAML", data: "rules: [\n"},
+		{name: "non-string key", data: "1: one\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ToJSON([]byte(tt.data)); err == nil {
+				t.Error("ToJSON() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestIsYAMLFile(t *testing.T) {
+	tests := map[string]bool{
+		"policy.yaml": true,
+		"policy.yml":  true,
+		"policy.json": false,
+		"yaml":        false,
+		"dir/fix.yml": true,
+		"POLICY.YAML": true,
+	}
+
+	for path, want := range tests {
+		if got := IsYAMLFile(path); got != want {
+			t.Errorf("IsYAMLFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	out, err := FromJSON([]byte(`{"rules": [{"name": "allow-myorg"}], "default_deny": true}`))
+	if err != nil {
+		t.Fatalf("FromJSON() error = %v", err)
+	}
+
+	want := "default_deny: true\nrules:\n    - name: allow-myorg\n"
+	if string(out) != want {
+		t.Errorf("FromJSON() = %q, want %q", out, want)
+	}
+
+	if _, err := FromJSON([]byte(`{`)); err == nil {
+		t.Error("FromJSON() error = nil for malformed JSON")
+	}
+}
@@ -0,0 +1,148 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// maxIntrospectionRequestSize limits the size of introspection request
+// bodies
+const maxIntrospectionRequestSize = 64 << 10
+
+// IntrospectionResponse is the JSON body of an introspection response. It
+// carries the RFC 7662 members for GitHub Actions tokens plus the
+// normalized claims and the policy decision.
+type IntrospectionResponse struct {
+	// Active reports whether the token verified and the policy allowed it
+	Active bool `json:"active"`
+
+	// Code is the error code of an inactive token, e.g. "token_expired"
+	// or "policy_denied"
+	Code ErrorCode `json:"code,omitempty"`
+
+	// Registered claims of an active token
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	JTI       string   `json:"jti,omitempty"`
+
+	// Identity is the caller identity of an active token
+	Identity string `json:"identity,omitempty"`
+
+	// Claims are the normalized claims of an active token, as mapped for
+	// the issuer
+	Claims *GitHubActionsClaims `json:"claims,omitempty"`
+
+	// Policy is the policy decision, for active tokens and policy denials
+	Policy *IntrospectionPolicy `json:"policy,omitempty"`
+}
+
+// IntrospectionPolicy is the policy decision in an IntrospectionResponse
+type IntrospectionPolicy struct {
+	Allowed bool `json:"allowed"`
+
+	// MatchedRule is the name of the deciding rule of an allowed token
+	MatchedRule string `json:"matched_rule,omitempty"`
+
+	// Reason explains the decision; for denials it is the message chosen
+	// by the verifier's DenialDetailLevel
+	Reason string `json:"reason,omitempty"`
+
+	// Version is the Metadata.Version of the deciding policy
+	Version string `json:"version,omitempty"`
+}
+
+// IntrospectionHandler returns an http.Handler answering RFC 7662 style
+// introspection requests, so that services in other languages can
+// delegate token verification to one sidecar. Requests are POSTed as
+// application/x-www-form-urlencoded with a "token" parameter; the token is
+// verified and its policy evaluated like in Middleware, whose audience,
+// nonce and policy selection options apply here too. Invalid and denied
+// tokens are answered with "active": false and their error code, while
+// failures to reach the JWKS endpoint or the GitHub API are answered with
+// 503 Service Unavailable so that callers don't mistake them for a
+// verdict. As RFC 7662 requires, the endpoint itself must be protected,
+// e.g. by a network policy or authenticating middleware.
+func IntrospectionHandler(verifier TokenVerifier, opts ...MiddlewareOption) http.Handler {
+	cfg := newMiddlewareConfig(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxIntrospectionRequestSize)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid introspection request", http.StatusBadRequest)
+			return
+		}
+		token := r.PostForm.Get("token")
+		if token == "" {
+			http.Error(w, "invalid introspection request: token is required", http.StatusBadRequest)
+			return
+		}
+
+		result, err := cfg.verify(r, verifier, token)
+		if err != nil && introspectionUnavailable(err) {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(newIntrospectionResponse(result, err))
+	})
+}
+
+// introspectionUnavailable reports whether a verification failed for a
+// reason other than the token itself
+func introspectionUnavailable(err error) bool {
+	switch ErrorCodeOf(err) {
+	case "", CodeJWKSUnavailable, CodeGitHubAPIUnavailable:
+		return true
+	}
+	return false
+}
+
+// newIntrospectionResponse describes a verification result or error
+func newIntrospectionResponse(result *VerificationResult, err error) *IntrospectionResponse {
+	if err != nil {
+		resp := &IntrospectionResponse{Code: ErrorCodeOf(err)}
+
+		var valErr *ValidationError
+		if errors.As(err, &valErr) && valErr.Denial != nil {
+			resp.Policy = &IntrospectionPolicy{Reason: valErr.Denial.Message, Version: valErr.Denial.PolicyVersion}
+		}
+		return resp
+	}
+
+	claims := result.Claims
+	resp := &IntrospectionResponse{
+		Active:   true,
+		Issuer:   claims.Issuer,
+		Subject:  claims.Subject,
+		Audience: claims.Audience,
+		JTI:      claims.ID,
+		Identity: result.Identity.String(),
+		Claims:   claims,
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		resp.NotBefore = claims.NotBefore.Unix()
+	}
+	if pr := result.PolicyResult; pr != nil {
+		resp.Policy = &IntrospectionPolicy{Allowed: pr.Allowed, MatchedRule: pr.MatchedRule, Reason: pr.Reason, Version: pr.PolicyVersion}
+	}
+	return resp
+}
@@ -0,0 +1,132 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestIntrospectionHandler(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithPolicy(&Policy{
+			Metadata:    &PolicyMetadata{Version: "v3"},
+			Rules:       []Rule{{Name: "allow-myorg", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}},
+			DefaultDeny: true,
+		}),
+		WithAudience("https://api.example.com"),
+		WithJWKSURL(server.JWKSURL()),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	validToken, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	deniedClaims := testutil.DefaultClaims()
+	deniedClaims.RepositoryOwner = "otherorg"
+	deniedClaims.Repository = "otherorg/repo"
+	deniedToken, err := gen.GenerateToken(deniedClaims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	expiredClaims := testutil.DefaultClaims().ToJWT()
+	expiredClaims["iat"] = time.Now().Add(-time.Hour).Unix()
+	expiredClaims["nbf"] = time.Now().Add(-time.Hour).Unix()
+	expiredClaims["exp"] = time.Now().Add(-time.Minute).Unix()
+	expiredToken, err := gen.GenerateToken(expiredClaims)
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	handler := IntrospectionHandler(verifier)
+	introspect := func(t *testing.T, method, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/introspect", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	decode := func(t *testing.T, rec *httptest.ResponseRecorder) IntrospectionResponse {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body)
+		}
+		var resp IntrospectionResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("active token", func(t *testing.T) {
+		resp := decode(t, introspect(t, http.MethodPost, url.Values{"token": {validToken}, "token_type_hint": {"access_token"}}.Encode()))
+		if !resp.Active || resp.Code != "" {
+			t.Fatalf("response = %+v, want active", resp)
+		}
+		if resp.Claims == nil || resp.Claims.Repository != "myorg/myrepo" || resp.Identity == "" || resp.ExpiresAt == 0 {
+			t.Errorf("response = %+v, want claims of myorg/myrepo", resp)
+		}
+		if resp.Policy == nil || !resp.Policy.Allowed || resp.Policy.MatchedRule != "allow-myorg" || resp.Policy.Version != "v3" {
+			t.Errorf("Policy = %+v, want allowed by allow-myorg of v3", resp.Policy)
+		}
+	})
+
+	t.Run("denied token", func(t *testing.T) {
+		resp := decode(t, introspect(t, http.MethodPost, "token="+deniedToken))
+		if resp.Active || resp.Code != CodePolicyDenied || resp.Claims != nil {
+			t.Fatalf("response = %+v, want inactive policy denial without claims", resp)
+		}
+		if resp.Policy == nil || resp.Policy.Allowed || resp.Policy.Version != "v3" {
+			t.Errorf("Policy = %+v, want denial of v3", resp.Policy)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		resp := decode(t, introspect(t, http.MethodPost, "token="+expiredToken))
+		if resp.Active || resp.Code != CodeTokenExpired || resp.Policy != nil {
+			t.Errorf("response = %+v, want inactive expired token", resp)
+		}
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		if rec := introspect(t, http.MethodGet, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET status = %d, want 405", rec.Code)
+		}
+		if rec := introspect(t, http.MethodPost, "token_type_hint=access_token"); rec.Code != http.StatusBadRequest {
+			t.Errorf("status without token = %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("JWKS unavailable", func(t *testing.T) {
+		unavailable, err := New(WithJWKSURL("http://127.0.0.1:1/jwks"))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader("token="+validToken))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		IntrospectionHandler(unavailable).ServeHTTP(rec, req)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want 503", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultIssuer is the issuer of GitHub.com Actions OIDC tokens
+const DefaultIssuer = "https://token.actions.githubusercontent.com"
+
+// Issuer configures a trusted token issuer, such as GitHub.com or a GitHub
+// Enterprise Server instance
+type Issuer struct {
+	// URL is the expected iss claim (e.g., "https://ghes.example.com/_services/token")
+	URL string
+
+	// JWKSURL is where the issuer publishes its signing keys
+	// Defaults to URL + "/.well-known/jwks"
+	JWKSURL string
+
+	// Policy applies to tokens from this issuer
+	// If nil, the Verifier's policy is used. Issuers with a ClaimMapper
+	// require a policy of their own.
+	Policy *Policy
+
+	// StaticKeys are pinned signing keys by key ID
+	// When set, the JWKS endpoint is only used if FetchUnknownKeys is true
+	StaticKeys map[string]*rsa.PublicKey
+
+	// FetchUnknownKeys fetches the JWKS when a key ID is not in StaticKeys
+	FetchUnknownKeys bool
+
+	// KeyThumbprints pins the RFC 7638 thumbprints of keys accepted from
+	// the JWKS endpoint
+	KeyThumbprints []string
+
+	// ClaimMapper converts the tokens of another CI provider, such as
+	// MapGitLabClaims. If nil, tokens carry GitHub Actions claims. Mapped
+	// tokens can name the same repositories as GitHub's, so they are only
+	// authorized by Policy, never by the Verifier's policy.
+	ClaimMapper ClaimMapper
+}
+
+// trustedIssuer is a configured issuer with its own key fetcher
+type trustedIssuer struct {
+	Issuer
+	fetcher  *JWKSFetcher
+	compiled *CompiledPolicy // nil when the verifier's policy applies
+}
+
+// WithIssuer adds a trusted issuer. It can be given multiple times; tokens
+// are matched to an issuer by their iss claim. When no issuer is configured,
+// only GitHub.com tokens are accepted.
+func WithIssuer(issuer Issuer) Option {
+	return func(v *Verifier) {
+		v.issuerConfigs = append(v.issuerConfigs, issuer)
+	}
+}
+
+// buildIssuers validates the issuer configuration and creates one JWKS
+// fetcher per issuer
+func (v *Verifier) buildIssuers() error {
+	configs := v.issuerConfigs
+	if len(configs) == 0 {
+		configs = []Issuer{{
+			URL:              DefaultIssuer,
+			JWKSURL:          v.jwksURL,
+			StaticKeys:       v.staticKeys,
+			FetchUnknownKeys: v.staticKeyFallback,
+			KeyThumbprints:   v.keyThumbprints,
+		}}
+	} else if v.staticKeys != nil {
+		return fmt.Errorf("WithStaticKeys cannot be combined with WithIssuer; set Issuer.StaticKeys instead")
+	} else if v.keyThumbprints != nil {
+		return fmt.Errorf("WithKeyThumbprints cannot be combined with WithIssuer; set Issuer.KeyThumbprints instead")
+	}
+
+	v.issuers = make(map[string]*trustedIssuer, len(configs))
+	for _, cfg := range configs {
+		if cfg.URL == "" {
+			return fmt.Errorf("issuer URL is required")
+		}
+		if _, ok := v.issuers[cfg.URL]; ok {
+			return fmt.Errorf("issuer %q configured more than once", cfg.URL)
+		}
+
+		if cfg.ClaimMapper != nil && cfg.Policy == nil {
+			return fmt.Errorf("issuer %q maps another CI provider's claims and requires its own Policy", cfg.URL)
+		}
+		if cfg.Policy != nil {
+			if err := cfg.Policy.Validate(); err != nil {
+				return err
+			}
+			if err := v.checkStrict(cfg.Policy); err != nil {
+				return err
+			}
+		}
+
+		if cfg.JWKSURL == "" {
+			cfg.JWKSURL = strings.TrimSuffix(cfg.URL, "/") + "/.well-known/jwks"
+		}
+
+		var fetcher *JWKSFetcher
+		if v.fetchers != nil && cfg.StaticKeys == nil && cfg.KeyThumbprints == nil {
+			fetcher = v.fetchers.get(cfg.JWKSURL, func() *JWKSFetcher { return v.newFetcher(cfg) })
+		} else {
+			fetcher = v.newFetcher(cfg)
+		}
+
+		issuer := &trustedIssuer{Issuer: cfg, fetcher: fetcher}
+		if cfg.Policy != nil {
+			issuer.compiled = cfg.Policy.Compile(v.compileOpts...)
+		}
+		v.issuers[cfg.URL] = issuer
+	}
+
+	return nil
+}
+
+// newFetcher creates the JWKS fetcher for an issuer
+func (v *Verifier) newFetcher(cfg Issuer) *JWKSFetcher {
+	fetcher := NewJWKSFetcher(cfg.JWKSURL, v.jwksCacheDuration)
+	if v.httpClient != nil {
+		fetcher.httpClient = v.httpClient
+	}
+	if v.keyCache != nil {
+		fetcher.keyCache = v.keyCache
+	}
+	fetcher.retry = v.jwksRetry
+	fetcher.minRefreshInterval = v.jwksMinRefresh
+	fetcher.breaker = newCircuitBreaker(v.breakerThreshold, v.breakerCooldown)
+	fetcher.pinned = thumbprintSet(cfg.KeyThumbprints)
+	fetcher.logger = v.logger
+	fetcher.allowedAlgs = v.allowedAlgs
+	if cfg.StaticKeys != nil {
+		fetcher.staticKeys = cfg.StaticKeys
+		fetcher.fetchUnknownKeys = cfg.FetchUnknownKeys
+	}
+	return fetcher
+}
+
+// Keyfunc returns a jwt.Keyfunc resolving the signing keys of the
+// verifier's trusted issuers, for callers that parse tokens themselves
+// (echo-jwt, a custom jwt.Parser, ...) but want the verifier's key caching,
+// static keys and thumbprint pinning. Tokens from untrusted issuers are
+// rejected; the audience, the remaining claims and the policy are not
+// checked, so prefer Verify where possible.
+func (v *Verifier) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return v.keyfunc(ctx)
+}
+
+// keyfunc returns a jwt.Keyfunc that selects the JWKS fetcher based on the
+// token's iss claim
+func (v *Verifier) keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		// Shared fetchers may have been created with other algorithms
+		if err := checkAlgorithm(token, v.allowedAlgs); err != nil {
+			return nil, err
+		}
+
+		iss, err := token.Claims.GetIssuer()
+		if err != nil {
+			return nil, NewValidationError(ErrInvalidToken, err.Error())
+		}
+
+		issuer, ok := v.issuers[iss]
+		if !ok {
+			return nil, newClaimError(ErrInvalidIssuer, fmt.Sprintf("untrusted issuer %q", iss), map[string]any{"iss": iss})
+		}
+
+		return issuer.fetcher.Keyfunc(ctx)(token)
+	}
+}
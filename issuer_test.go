@@ -0,0 +1,244 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifier_MultipleIssuers(t *testing.T) {
+	githubGen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	githubServer := testutil.NewJWKSServer(githubGen.PublicKey(), githubGen.KeyID())
+	defer githubServer.Close()
+
+	ghesGen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	ghesServer := testutil.NewJWKSServer(ghesGen.PublicKey(), ghesGen.KeyID())
+	defer ghesServer.Close()
+
+	const ghesIssuer = "https://ghes.example.com/_services/token"
+
+	verifier, err := New(
+		WithIssuer(Issuer{
+			URL:     DefaultIssuer,
+			JWKSURL: githubServer.URL() + "/.well-known/jwks",
+		}),
+		WithIssuer(Issuer{
+			URL:     ghesIssuer,
+			JWKSURL: ghesServer.URL() + "/.well-known/jwks",
+			Policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-internal",
+						Conditions: Conditions{RepositoryOwner: []string{"internal"}},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+		}),
+		WithPolicy(&Policy{
+			Rules: []Rule{
+				{
+					Name:       "allow-myorg",
+					Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+					Effect:     EffectAllow,
+				},
+			},
+			DefaultDeny: true,
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx := context.Background()
+
+	// token builds a token for the given issuer and owner
+	token := func(gen *testutil.TokenGenerator, issuer, owner string) string {
+		t.Helper()
+		claims := testutil.DefaultClaims()
+		claims.Issuer = issuer
+		claims.RepositoryOwner = owner
+		claims.Repository = owner + "/repo"
+		tokenString, err := gen.GenerateToken(claims.ToJWT())
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		return tokenString
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantRule string
+		wantErr  error
+	}{
+		{
+			name:     "github.com token uses verifier policy",
+			token:    token(githubGen, DefaultIssuer, "myorg"),
+			wantRule: "allow-myorg",
+		},
+		{
+			name:     "GHES token uses issuer policy",
+			token:    token(ghesGen, ghesIssuer, "internal"),
+			wantRule: "allow-internal",
+		},
+		{
+			name:    "GHES token denied by issuer policy",
+			token:   token(ghesGen, ghesIssuer, "myorg"),
+			wantErr: ErrAccessDenied,
+		},
+		{
+			name:    "token signed with another issuer's key",
+			token:   token(githubGen, ghesIssuer, "internal"),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "untrusted issuer",
+			token:   token(githubGen, "https://evil.example.com", "myorg"),
+			wantErr: ErrInvalidIssuer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := verifier.Verify(ctx, tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if result.PolicyResult.MatchedRule != tt.wantRule {
+				t.Errorf("MatchedRule = %q, want %q", result.PolicyResult.MatchedRule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestVerifier_Keyfunc(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(WithJWKSURL(server.URL() + "/.well-known/jwks"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		issuer   string
+		wantCode ErrorCode
+	}{
+		{
+			name:   "trusted issuer",
+			issuer: DefaultIssuer,
+		},
+		{
+			name:     "untrusted issuer",
+			issuer:   "https://evil.example.com",
+			wantCode: CodeInvalidIssuer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testutil.DefaultClaims()
+			claims.Issuer = tt.issuer
+			token, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"}))
+			parsed, err := parser.Parse(token, verifier.Keyfunc(context.Background()))
+			if tt.wantCode != "" {
+				if code := ErrorCodeOf(err); code != tt.wantCode {
+					t.Errorf("Parse() error code = %q, want %q (error: %v)", code, tt.wantCode, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !parsed.Valid {
+				t.Error("Parse() token is not valid")
+			}
+		})
+	}
+}
+
+func TestWithIssuer_Configuration(t *testing.T) {
+	t.Run("default JWKS URL", func(t *testing.T) {
+		verifier, err := New(WithIssuer(Issuer{URL: "https://ghes.example.com/_services/token/"}))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		issuer := verifier.issuers["https://ghes.example.com/_services/token/"]
+		want := "https://ghes.example.com/_services/token/.well-known/jwks"
+		if issuer.fetcher.url != want {
+			t.Errorf("JWKS URL = %q, want %q", issuer.fetcher.url, want)
+		}
+	})
+
+	t.Run("only configured issuers are trusted", func(t *testing.T) {
+		verifier, err := New(WithIssuer(Issuer{URL: "https://ghes.example.com/_services/token"}))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if _, ok := verifier.issuers[DefaultIssuer]; ok {
+			t.Error("GitHub.com issuer should not be trusted when issuers are configured")
+		}
+	})
+
+	tests := []struct {
+		name    string
+		issuers []Issuer
+	}{
+		{
+			name:    "empty URL",
+			issuers: []Issuer{{}},
+		},
+		{
+			name:    "duplicate issuer",
+			issuers: []Issuer{{URL: DefaultIssuer}, {URL: DefaultIssuer}},
+		},
+		{
+			name:    "invalid issuer policy",
+			issuers: []Issuer{{URL: DefaultIssuer, Policy: &Policy{}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			for _, issuer := range tt.issuers {
+				opts = append(opts, WithIssuer(issuer))
+			}
+
+			if _, err := New(opts...); err == nil {
+				t.Error("New() error = nil, want error")
+			}
+		})
+	}
+}
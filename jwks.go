@@ -5,9 +5,13 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math/big"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +24,14 @@ const (
 
 	// DefaultCacheDuration is how long to cache JWKS
 	DefaultCacheDuration = 1 * time.Hour
+
+	// MaxCacheDuration caps the max-age of a JWKS response, so that a
+	// misconfigured endpoint cannot pin keys for days
+	MaxCacheDuration = 24 * time.Hour
+
+	// DefaultMinRefreshInterval is how old cached keys must be before a
+	// token with an unknown key ID triggers a refresh
+	DefaultMinRefreshInterval = 30 * time.Second
 )
 
 // JWK represents a JSON Web Key
@@ -37,19 +49,100 @@ type JWKS struct {
 	Keys []JWK `json:"keys"`
 }
 
-// JWKSFetcher fetches and caches JWKS
+// JWKSFetcher fetches and caches JWKS. It can be used on its own with any
+// JWT library: GetKey returns the RSA key for a key ID, fetching the JWKS
+// only when the key is not cached, and Keyfunc adapts it to
+// github.com/golang-jwt/jwt. A fetcher is safe for concurrent use.
 type JWKSFetcher struct {
 	url           string
 	httpClient    *http.Client
 	cacheDuration time.Duration
+	keyCache      KeyCache
+
+	// staticKeys are pinned keys checked before the cache; the endpoint is
+	// only contacted for other key IDs if fetchUnknownKeys is set
+	staticKeys       map[string]*rsa.PublicKey
+	fetchUnknownKeys bool
+
+	// pinned holds the accepted thumbprints of fetched keys, if any
+	pinned map[string]struct{}
 
-	mu    sync.RWMutex
-	cache map[string]*rsa.PublicKey
+	// minRefreshInterval is how old cached keys must be before an unknown
+	// key ID triggers a refresh
+	minRefreshInterval time.Duration
+
+	retry       RetryPolicy
+	breaker     *circuitBreaker
+	logger      *slog.Logger
+	allowedAlgs []string
+
+	mu       sync.RWMutex
 	cachedAt time.Time
+	last     *KeySet // most recent fetch, for conditional requests
+	lastErr  error   // outcome of the most recent refresh
+
+	flightMu sync.Mutex
+	flight   *refreshCall // refresh in progress, if any
+}
+
+// refreshCall is a refresh shared by the callers needing one at the same
+// time
+type refreshCall struct {
+	done      chan struct{}
+	keys      *KeySet
+	err       error
+	abandoned bool // the caller running the refresh gave up
+}
+
+// FetcherOption configures a JWKSFetcher
+type FetcherOption func(*JWKSFetcher)
+
+// WithFetcherHTTPClient sets the HTTP client used to fetch the JWKS
+func WithFetcherHTTPClient(client *http.Client) FetcherOption {
+	return func(f *JWKSFetcher) {
+		f.httpClient = client
+	}
+}
+
+// WithFetcherKeyCache sets where fetched keys are cached, e.g. a shared
+// KeyCache (see WithKeyCache)
+func WithFetcherKeyCache(cache KeyCache) FetcherOption {
+	return func(f *JWKSFetcher) {
+		f.keyCache = cache
+	}
 }
 
-// NewJWKSFetcher creates a new JWKS fetcher
-func NewJWKSFetcher(url string, cacheDuration time.Duration) *JWKSFetcher {
+// WithFetcherRetry sets how failed JWKS requests are retried (see
+// WithJWKSRetry)
+func WithFetcherRetry(policy RetryPolicy) FetcherOption {
+	return func(f *JWKSFetcher) {
+		f.retry = policy
+	}
+}
+
+// WithFetcherMinRefreshInterval sets how old cached keys must be before a
+// token with an unknown key ID triggers a refresh, so that tokens with
+// made-up key IDs cannot cause a request each (default
+// DefaultMinRefreshInterval)
+func WithFetcherMinRefreshInterval(interval time.Duration) FetcherOption {
+	return func(f *JWKSFetcher) {
+		f.minRefreshInterval = interval
+	}
+}
+
+// WithFetcherLogger sets the logger for JWKS refreshes (see WithLogger)
+func WithFetcherLogger(logger *slog.Logger) FetcherOption {
+	return func(f *JWKSFetcher) {
+		if logger == nil {
+			logger = discardLogger
+		}
+		f.logger = logger
+	}
+}
+
+// NewJWKSFetcher creates a new JWKS fetcher. An empty url fetches GitHub's
+// keys and a zero cacheDuration caches them for DefaultCacheDuration.
+func NewJWKSFetcher(url string, cacheDuration time.Duration, opts ...FetcherOption) *JWKSFetcher {
 	if url == "" {
 		url = DefaultJWKSURL
 	}
@@ -57,65 +150,322 @@ func NewJWKSFetcher(url string, cacheDuration time.Duration) *JWKSFetcher {
 		cacheDuration = DefaultCacheDuration
 	}
 
-	return &JWKSFetcher{
-		url:           url,
-		httpClient:    &http.Client{Timeout: 10 * time.Second},
-		cacheDuration: cacheDuration,
-		cache:         make(map[string]*rsa.PublicKey),
+	f := &JWKSFetcher{
+		url:                url,
+		httpClient:         newHTTPClient(),
+		cacheDuration:      cacheDuration,
+		keyCache:           NewMemoryKeyCache(),
+		minRefreshInterval: DefaultMinRefreshInterval,
+		retry:              DefaultRetryPolicy,
+		logger:             discardLogger,
+		allowedAlgs:        []string{DefaultAlgorithm},
 	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
 // GetKey returns the public key for the given key ID
 func (f *JWKSFetcher) GetKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
-	// Check cache first
-	f.mu.RLock()
-	if key, ok := f.cache[kid]; ok && time.Since(f.cachedAt) < f.cacheDuration {
-		f.mu.RUnlock()
-		return key, nil
+	if f.staticKeys != nil {
+		if key, ok := f.staticKeys[kid]; ok {
+			return key, nil
+		}
+		if !f.fetchUnknownKeys {
+			return nil, NewValidationError(ErrKeyNotFound, fmt.Sprintf("key ID %q not found in static keys", kid))
+		}
+	}
+
+	// Check cache first. A cache error is treated like a miss so that a
+	// failing shared cache does not block verification.
+	missedAt := time.Now()
+	if keys, err := f.keyCache.Get(ctx, f.url); err == nil && keys != nil {
+		if key, ok := keys.Keys[kid]; ok {
+			return key, f.checkPinned(kid, key)
+		}
+		// Keys only just fetched, possibly by another instance sharing
+		// the cache, are current
+		if time.Since(keys.FetchedAt) < f.minRefreshInterval {
+			return nil, NewValidationError(ErrKeyNotFound, fmt.Sprintf("key ID %q not found in JWKS", kid))
+		}
+	}
+
+	if f.LastRefresh().IsZero() {
+		f.logger.DebugContext(ctx, "fetching jwks", slog.String("url", f.url))
+	} else {
+		f.logger.DebugContext(ctx, "jwks cache expired or key not cached", slog.String("url", f.url), slog.String("kid", kid))
 	}
-	f.mu.RUnlock()
 
 	// Fetch JWKS
-	if err := f.refresh(ctx); err != nil {
+	keys, err := f.sharedRefresh(ctx, missedAt)
+	if err != nil {
 		return nil, err
 	}
 
-	// Try cache again
-	f.mu.RLock()
-	key, ok := f.cache[kid]
-	f.mu.RUnlock()
-
+	key, ok := keys.Keys[kid]
 	if !ok {
 		return nil, NewValidationError(ErrKeyNotFound, fmt.Sprintf("key ID %q not found in JWKS", kid))
 	}
 
+	if err := f.checkPinned(kid, key); err != nil {
+		return nil, err
+	}
+
 	return key, nil
 }
 
-// refresh fetches the JWKS and updates the cache
-func (f *JWKSFetcher) refresh(ctx context.Context) error {
+// sharedRefresh refreshes the keys once for all concurrent callers, so that
+// a cold start or a burst of cache misses costs a single request; keys
+// refreshed after since are returned without another. Callers stop waiting
+// when their context is done, and refresh themselves if the caller running
+// the shared refresh gave up.
+func (f *JWKSFetcher) sharedRefresh(ctx context.Context, since time.Time) (*KeySet, error) {
+	for {
+		f.mu.RLock()
+		last, cachedAt := f.last, f.cachedAt
+		f.mu.RUnlock()
+		if last != nil && cachedAt.After(since) {
+			return last, nil
+		}
+
+		f.flightMu.Lock()
+		call := f.flight
+		if call == nil {
+			call = &refreshCall{done: make(chan struct{})}
+			f.flight = call
+			f.flightMu.Unlock()
+			return f.runRefresh(ctx, call)
+		}
+		f.flightMu.Unlock()
+
+		select {
+		case <-call.done:
+			if call.abandoned && ctx.Err() == nil {
+				continue
+			}
+			return call.keys, call.err
+		case <-ctx.Done():
+			return nil, NewValidationError(ErrJWKSFetch, ctx.Err().Error())
+		}
+	}
+}
+
+// runRefresh performs the refresh of call and hands its outcome to the
+// callers waiting for it
+func (f *JWKSFetcher) runRefresh(ctx context.Context, call *refreshCall) (*KeySet, error) {
+	defer func() {
+		f.flightMu.Lock()
+		f.flight = nil
+		f.flightMu.Unlock()
+		close(call.done)
+	}()
+
+	call.keys, call.err = f.refresh(ctx)
+	call.abandoned = call.err != nil && ctx.Err() != nil
+	return call.keys, call.err
+}
+
+// refresh fetches the JWKS, retrying transient failures, and updates the cache
+func (f *JWKSFetcher) refresh(ctx context.Context) (*KeySet, error) {
+	if !f.breaker.allow() {
+		return nil, NewValidationError(ErrJWKSFetch, "circuit breaker open after repeated failures")
+	}
+
+	f.mu.RLock()
+	last := f.last
+	f.mu.RUnlock()
+
+	var etag string
+	if last != nil {
+		etag = last.ETag
+	}
+
+	resp, err := f.fetchWithRetry(ctx, etag)
+
+	// A caller giving up, e.g. a client disconnecting, says nothing about
+	// the endpoint's health; a deadline passing does
+	if err == nil || !errors.Is(ctx.Err(), context.Canceled) {
+		f.breaker.record(err)
+	} else {
+		f.breaker.release()
+	}
+	if err != nil {
+		f.mu.Lock()
+		f.lastErr = err
+		f.mu.Unlock()
+		f.logger.WarnContext(ctx, "jwks refresh failed", slog.String("url", f.url), slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	keys := &KeySet{
+		FetchedAt: time.Now(),
+		ETag:      resp.etag,
+	}
+	if resp.notModified {
+		// The previous keys are still current
+		keys.Keys = last.Keys
+		if keys.ETag == "" {
+			keys.ETag = last.ETag
+		}
+	} else {
+		keys.Keys = keysFromJWKS(resp.jwks)
+	}
+
+	// Honor the server's caching hints. Keys that must be revalidated are
+	// not cached, so that the next use sends a conditional request.
+	ttl := f.cacheDuration
+	switch {
+	case resp.revalidate:
+		ttl = 0
+	case resp.maxAge > 0:
+		ttl = min(resp.maxAge, MaxCacheDuration)
+	}
+
+	// Update cache. Failing to store the keys only costs another fetch.
+	if ttl > 0 {
+		_ = f.keyCache.Set(ctx, f.url, keys, ttl)
+	}
+
+	f.mu.Lock()
+	f.cachedAt = keys.FetchedAt
+	f.last = keys
+	f.lastErr = nil
+	f.mu.Unlock()
+
+	if resp.notModified {
+		f.logger.DebugContext(ctx, "jwks not modified", slog.String("url", f.url), slog.Duration("ttl", ttl))
+	} else {
+		f.logger.InfoContext(ctx, "jwks refreshed", slog.String("url", f.url), slog.Int("keys", len(keys.Keys)), slog.Duration("ttl", ttl))
+	}
+
+	return keys, nil
+}
+
+// Prime fetches the keys eagerly, e.g. at startup, so the first request
+// does not pay for the fetch. It is a no-op when only static keys are used.
+func (f *JWKSFetcher) Prime(ctx context.Context) error {
+	if f.staticKeys != nil && !f.fetchUnknownKeys {
+		return nil
+	}
+
+	_, err := f.sharedRefresh(ctx, time.Now())
+	return err
+}
+
+// Healthy reports whether keys are available: static keys are configured,
+// or a refresh has succeeded and the most recent one did not fail
+func (f *JWKSFetcher) Healthy() bool {
+	if f.staticKeys != nil {
+		return true
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.last != nil && f.lastErr == nil
+}
+
+// LastRefresh returns when the keys were last fetched successfully, or the
+// zero time if they never were
+func (f *JWKSFetcher) LastRefresh() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.cachedAt
+}
+
+// fetchResult is the outcome of a successful JWKS request
+type fetchResult struct {
+	jwks        JWKS
+	notModified bool
+	etag        string
+	maxAge      time.Duration
+	revalidate  bool
+}
+
+// fetchWithRetry fetches the JWKS according to the retry policy
+func (f *JWKSFetcher) fetchWithRetry(ctx context.Context, etag string) (*fetchResult, error) {
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		resp, retry, err := f.fetch(ctx, etag)
+		if err == nil || !retry || attempt >= f.retry.MaxAttempts {
+			return resp, err
+		}
+
+		wait := f.retry.backoff(attempt - 1)
+		if f.retry.MaxElapsed > 0 && time.Since(start)+wait > f.retry.MaxElapsed {
+			return nil, err
+		}
+		if sleepErr := sleepContext(ctx, wait); sleepErr != nil {
+			return nil, err
+		}
+	}
+}
+
+// fetch performs a single JWKS request, conditional on etag if set, and
+// reports whether a failure is worth retrying
+func (f *JWKSFetcher) fetch(ctx context.Context, etag string) (*fetchResult, bool, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", f.url, nil)
 	if err != nil {
-		return NewValidationError(ErrJWKSFetch, err.Error())
+		return nil, false, NewValidationError(ErrJWKSFetch, err.Error())
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
 	}
 
 	resp, err := f.httpClient.Do(req)
 	if err != nil {
-		return NewValidationError(ErrJWKSFetch, err.Error())
+		return nil, ctx.Err() == nil, NewValidationError(ErrJWKSFetch, err.Error())
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return NewValidationError(ErrJWKSFetch, fmt.Sprintf("HTTP %d", resp.StatusCode))
+	result := &fetchResult{etag: resp.Header.Get("ETag")}
+	result.maxAge, result.revalidate = parseMaxAge(resp.Header.Get("Cache-Control"))
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && etag != "":
+		result.notModified = true
+		return result, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, retryable(resp.StatusCode), NewValidationError(ErrJWKSFetch, fmt.Sprintf("HTTP %d", resp.StatusCode))
 	}
 
-	var jwks JWKS
-	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
-		return NewValidationError(ErrJWKSFetch, err.Error())
+	if err := json.NewDecoder(resp.Body).Decode(&result.jwks); err != nil {
+		return nil, false, NewValidationError(ErrJWKSFetch, err.Error())
 	}
 
-	// Convert JWKs to RSA public keys
-	newCache := make(map[string]*rsa.PublicKey)
+	return result, false, nil
+}
+
+// parseMaxAge returns the max-age directive of a Cache-Control header, or 0
+// if it is absent, and whether the response must be revalidated before it
+// is reused: with no-cache, no-store or a max-age of 0
+func parseMaxAge(header string) (time.Duration, bool) {
+	var maxAge time.Duration
+	var revalidate bool
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			revalidate = true
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || seconds < 0 {
+				continue
+			}
+			maxAge = time.Duration(seconds) * time.Second
+			revalidate = revalidate || seconds == 0
+		}
+	}
+	if revalidate {
+		return 0, true
+	}
+	return maxAge, false
+}
+
+// keysFromJWKS converts the RSA keys of a JWKS to public keys
+func keysFromJWKS(jwks JWKS) map[string]*rsa.PublicKey {
+	keys := make(map[string]*rsa.PublicKey)
 	for _, jwk := range jwks.Keys {
 		if jwk.Kty != "RSA" {
 			continue
@@ -127,19 +477,17 @@ func (f *JWKSFetcher) refresh(ctx context.Context) error {
 			continue
 		}
 
-		newCache[jwk.Kid] = key
+		keys[jwk.Kid] = key
 	}
-
-	// Update cache
-	f.mu.Lock()
-	f.cache = newCache
-	f.cachedAt = time.Now()
-	f.mu.Unlock()
-
-	return nil
+	return keys
 }
 
-// jwkToPublicKey converts a JWK to an RSA public key
+// minRSAKeyBits is the smallest RSA modulus accepted from a JWK
+const minRSAKeyBits = 2048
+
+// jwkToPublicKey converts a JWK to an RSA public key. Moduli shorter than
+// 2048 bits and exponents outside what crypto/rsa verifies with are
+// rejected.
 func jwkToPublicKey(jwk JWK) (*rsa.PublicKey, error) {
 	// Decode N (modulus) - base64url without padding
 	nBytes, err := base64.RawURLEncoding.DecodeString(jwk.N)
@@ -157,6 +505,13 @@ func jwkToPublicKey(jwk JWK) (*rsa.PublicKey, error) {
 	n := new(big.Int).SetBytes(nBytes)
 	e := new(big.Int).SetBytes(eBytes)
 
+	if n.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("modulus of %d bits is shorter than %d", n.BitLen(), minRSAKeyBits)
+	}
+	if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+
 	// Create RSA public key
 	return &rsa.PublicKey{
 		N: n,
@@ -164,12 +519,16 @@ func jwkToPublicKey(jwk JWK) (*rsa.PublicKey, error) {
 	}, nil
 }
 
-// Keyfunc returns a jwt.Keyfunc for use with jwt.Parse
+// Keyfunc returns a jwt.Keyfunc for use with jwt.Parse or a jwt.Parser,
+// e.g. as the KeyFunc of echo-jwt. It accepts RS256 tokens with a kid
+// header (see WithFetcherAllowedAlgorithms) and fetches keys with ctx;
+// long-lived configurations can pass context.Background(). Only the
+// signature key is resolved: checking the claims is up to the caller.
 func (f *JWKSFetcher) Keyfunc(ctx context.Context) jwt.Keyfunc {
 	return func(token *jwt.Token) (interface{}, error) {
 		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, NewValidationError(ErrInvalidSignature, fmt.Sprintf("unexpected signing method: %v", token.Header["alg"]))
+		if err := checkAlgorithm(token, f.allowedAlgs); err != nil {
+			return nil, err
 		}
 
 		// Get key ID from header
@@ -0,0 +1,159 @@
+package ghaauth
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures retries of failed JWKS fetches. Network errors,
+// HTTP 429 and 5xx responses are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts; 1 or less disables retries
+	MaxAttempts int
+
+	// InitialBackoff is the upper bound of the first wait between attempts
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the exponentially growing wait between attempts
+	MaxBackoff time.Duration
+
+	// MaxElapsed stops retrying once this much time has passed since the
+	// first attempt (0 means no limit beyond the context)
+	MaxElapsed time.Duration
+}
+
+// DefaultRetryPolicy is used when no retry policy is configured
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	MaxElapsed:     5 * time.Second,
+}
+
+// backoff returns a random wait before the given retry (0-based) using
+// exponential backoff with full jitter
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	limit := p.InitialBackoff
+	for i := 0; i < retry && limit < p.MaxBackoff; i++ {
+		limit *= 2
+	}
+	if p.MaxBackoff > 0 && limit > p.MaxBackoff {
+		limit = p.MaxBackoff
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit + 1)
+}
+
+// retryable reports whether a response status is worth retrying
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WithJWKSRetry sets the retry policy for JWKS fetches
+func WithJWKSRetry(policy RetryPolicy) Option {
+	return func(v *Verifier) {
+		v.jwksRetry = policy
+	}
+}
+
+// WithJWKSCircuitBreaker stops contacting the JWKS endpoint for cooldown
+// after threshold consecutive failed refreshes, failing fast instead. After
+// the cooldown a single refresh is let through to probe the endpoint.
+func WithJWKSCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(v *Verifier) {
+		v.breakerThreshold = threshold
+		v.breakerCooldown = cooldown
+	}
+}
+
+// circuitBreaker tracks consecutive refresh failures
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// newCircuitBreaker returns nil (disabled) when threshold is not positive
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a refresh may contact the endpoint
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	// Open: fail fast until the cooldown has passed, then let one probe through
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// release ends a probe without counting its outcome, e.g. when the caller
+// gave up, so that the next refresh may probe again
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// record updates the breaker with the outcome of a refresh
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
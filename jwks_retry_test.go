@@ -0,0 +1,293 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+// flakyJWKSServer fails the first failures requests with status, then serves the JWKS
+func flakyJWKSServer(t *testing.T, gen *testutil.TokenGenerator, failures int, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	jwks, err := json.Marshal(&KeySet{Keys: map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()}})
+	if err != nil {
+		t.Fatalf("failed to encode JWKS: %v", err)
+	}
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+var fastRetry = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+}
+
+func TestJWKSFetcher_Retry(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		failures  int
+		status    int
+		retry     RetryPolicy
+		wantErr   bool
+		wantCalls int32
+	}{
+		{
+			name:      "recovers from transient 503",
+			failures:  2,
+			status:    http.StatusServiceUnavailable,
+			retry:     fastRetry,
+			wantCalls: 3,
+		},
+		{
+			name:      "retries 429",
+			failures:  1,
+			status:    http.StatusTooManyRequests,
+			retry:     fastRetry,
+			wantCalls: 2,
+		},
+		{
+			name:      "gives up after max attempts",
+			failures:  5,
+			status:    http.StatusBadGateway,
+			retry:     fastRetry,
+			wantErr:   true,
+			wantCalls: 3,
+		},
+		{
+			name:      "does not retry 404",
+			failures:  5,
+			status:    http.StatusNotFound,
+			retry:     fastRetry,
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:      "single attempt disables retries",
+			failures:  1,
+			status:    http.StatusServiceUnavailable,
+			retry:     RetryPolicy{MaxAttempts: 1},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:     "max elapsed stops retrying",
+			failures: 5,
+			status:   http.StatusServiceUnavailable,
+			retry: RetryPolicy{
+				MaxAttempts:    10,
+				InitialBackoff: time.Hour,
+				MaxBackoff:     time.Hour,
+				MaxElapsed:     time.Nanosecond,
+			},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := flakyJWKSServer(t, gen, tt.failures, tt.status)
+
+			fetcher := NewJWKSFetcher(server.URL, time.Hour)
+			fetcher.retry = tt.retry
+
+			_, err := fetcher.GetKey(context.Background(), gen.KeyID())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrJWKSFetch) {
+				t.Errorf("GetKey() error = %v, want ErrJWKSFetch", err)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestJWKSFetcher_CircuitBreaker(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server, calls := flakyJWKSServer(t, gen, 2, http.StatusServiceUnavailable)
+
+	fetcher := NewJWKSFetcher(server.URL, time.Hour)
+	fetcher.retry = RetryPolicy{MaxAttempts: 1}
+	fetcher.breaker = newCircuitBreaker(2, 50*time.Millisecond)
+
+	ctx := context.Background()
+
+	// Two failures open the breaker
+	for i := 0; i < 2; i++ {
+		if _, err := fetcher.GetKey(ctx, gen.KeyID()); err == nil {
+			t.Fatal("GetKey() expected error while endpoint fails")
+		}
+	}
+
+	// While open, requests fail fast without reaching the server
+	if _, err := fetcher.GetKey(ctx, gen.KeyID()); !errors.Is(err, ErrJWKSFetch) {
+		t.Fatalf("GetKey() error = %v, want ErrJWKSFetch", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("server calls = %d, want 2 while breaker is open", got)
+	}
+
+	// After the cooldown a probe is let through and closes the breaker
+	time.Sleep(60 * time.Millisecond)
+	if _, err := fetcher.GetKey(ctx, gen.KeyID()); err != nil {
+		t.Fatalf("GetKey() after cooldown error = %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server calls = %d, want 3", got)
+	}
+}
+
+func TestJWKSFetcher_CircuitBreakerCanceledProbe(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server, calls := flakyJWKSServer(t, gen, 2, http.StatusServiceUnavailable)
+
+	fetcher := NewJWKSFetcher(server.URL, time.Hour)
+	fetcher.retry = RetryPolicy{MaxAttempts: 1}
+	fetcher.breaker = newCircuitBreaker(2, 50*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if _, err := fetcher.GetKey(context.Background(), gen.KeyID()); err == nil {
+			t.Fatal("GetKey() expected error while endpoint fails")
+		}
+	}
+
+	// The probe after the cooldown is abandoned by its caller
+	time.Sleep(60 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fetcher.GetKey(ctx, gen.KeyID()); err == nil {
+		t.Fatal("GetKey() expected error with a canceled context")
+	}
+
+	// The next refresh may probe again instead of failing fast forever
+	if _, err := fetcher.GetKey(context.Background(), gen.KeyID()); err != nil {
+		t.Fatalf("GetKey() after a canceled probe error = %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server calls = %d, want 3", got)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+
+	tests := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{retry: 0, max: 10 * time.Millisecond},
+		{retry: 1, max: 20 * time.Millisecond},
+		{retry: 2, max: 40 * time.Millisecond},
+		{retry: 10, max: 40 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := p.backoff(tt.retry); got < 0 || got > tt.max {
+				t.Errorf("backoff(%d) = %v, want within [0, %v]", tt.retry, got, tt.max)
+			}
+		}
+	}
+}
+
+func TestWithJWKSRetry(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server, _ := flakyJWKSServer(t, gen, 1, http.StatusServiceUnavailable)
+
+	v, err := New(
+		WithJWKSURL(server.URL),
+		WithJWKSRetry(fastRetry),
+		WithJWKSCircuitBreaker(5, time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Errorf("Verify() error = %v, want success after retry", err)
+	}
+}
+
+func TestJWKSFetcher_CanceledFetch(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	fetcher := NewJWKSFetcher(server.JWKSURL(), time.Hour)
+	fetcher.retry = RetryPolicy{MaxAttempts: 1}
+	fetcher.breaker = newCircuitBreaker(1, time.Hour)
+
+	// A canceled request does not count against the endpoint
+	server.SetDelay(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := fetcher.GetKey(ctx, gen.KeyID()); err == nil {
+		t.Fatal("GetKey() error = nil, want error for a canceled request")
+	}
+
+	server.SetDelay(0)
+	if _, err := fetcher.GetKey(context.Background(), gen.KeyID()); err != nil {
+		t.Errorf("GetKey() error = %v after a canceled request, want breaker closed", err)
+	}
+
+	// A request timing out does
+	server.SetDelay(time.Second)
+	fetcher.keyCache = NewMemoryKeyCache()
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := fetcher.GetKey(ctx, gen.KeyID()); err == nil {
+		t.Fatal("GetKey() error = nil, want error for a timed out request")
+	}
+	if _, err := fetcher.GetKey(context.Background(), gen.KeyID()); !errors.Is(err, ErrJWKSFetch) {
+		t.Errorf("GetKey() error = %v after a timeout, want breaker open", err)
+	}
+}
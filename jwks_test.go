@@ -2,7 +2,14 @@ package ghaauth
 
 import (
 	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -210,4 +217,333 @@ func TestNewJWKSFetcher(t *testing.T) {
 			t.Errorf("cacheDuration = %v, want %v", fetcher.cacheDuration, customDuration)
 		}
 	})
+
+	t.Run("options", func(t *testing.T) {
+		client := &http.Client{}
+		cache := NewMemoryKeyCache()
+		retry := RetryPolicy{MaxAttempts: 1}
+
+		fetcher := NewJWKSFetcher("", 0,
+			WithFetcherHTTPClient(client),
+			WithFetcherKeyCache(cache),
+			WithFetcherRetry(retry),
+			WithFetcherLogger(nil),
+			WithFetcherAllowedAlgorithms("RS256", "RS512"),
+		)
+
+		if fetcher.httpClient != client {
+			t.Error("httpClient was not set")
+		}
+		if fetcher.keyCache != cache {
+			t.Error("keyCache was not set")
+		}
+		if fetcher.retry != retry {
+			t.Errorf("retry = %+v, want %+v", fetcher.retry, retry)
+		}
+		if fetcher.logger != discardLogger {
+			t.Error("nil logger should discard logs")
+		}
+		if len(fetcher.allowedAlgs) != 2 {
+			t.Errorf("allowedAlgs = %v, want RS256 and RS512", fetcher.allowedAlgs)
+		}
+	})
+}
+
+func TestJWKSFetcher_ConditionalRequest(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	jwks, err := json.Marshal(&KeySet{Keys: map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()}})
+	if err != nil {
+		t.Fatalf("failed to encode JWKS: %v", err)
+	}
+
+	var full, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "public, max-age=1")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	cache := NewMemoryKeyCache()
+	fetcher := NewJWKSFetcher(server.URL, time.Hour)
+	fetcher.keyCache = cache
+
+	ctx := context.Background()
+
+	if _, err := fetcher.GetKey(ctx, gen.KeyID()); err != nil {
+		t.Fatalf("GetKey() error = %v", err)
+	}
+
+	// max-age overrides the configured hour
+	cache.mu.RLock()
+	expiresAt := cache.entries[server.URL].expiresAt
+	cache.mu.RUnlock()
+	if ttl := time.Until(expiresAt); ttl > time.Second {
+		t.Errorf("cache TTL = %v, want at most max-age of 1s", ttl)
+	}
+
+	// Once the cached keys expire, the fetcher revalidates with If-None-Match
+	time.Sleep(1100 * time.Millisecond)
+	key, err := fetcher.GetKey(ctx, gen.KeyID())
+	if err != nil {
+		t.Fatalf("GetKey() after expiry error = %v", err)
+	}
+	if key.N.Cmp(gen.PublicKey().N) != 0 {
+		t.Error("returned key doesn't match expected key after 304")
+	}
+
+	if full != 1 || notModified != 1 {
+		t.Errorf("full responses = %d, 304 responses = %d, want 1 and 1", full, notModified)
+	}
+}
+
+func TestJWKSFetcher_CacheControl(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	jwks, err := json.Marshal(&KeySet{Keys: map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()}})
+	if err != nil {
+		t.Fatalf("failed to encode JWKS: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		cacheControl string
+		wantTTL      time.Duration // 0 if the keys must not be cached
+		wantRequests int
+	}{
+		{name: "no-cache revalidates every use", cacheControl: "no-cache", wantRequests: 2},
+		{name: "no-store revalidates every use", cacheControl: "public, no-store", wantRequests: 2},
+		{name: "max-age=0 revalidates every use", cacheControl: "max-age=0", wantRequests: 2},
+		{name: "max-age is capped", cacheControl: "max-age=31536000", wantTTL: MaxCacheDuration, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var full, notModified int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				full++
+				_, _ = w.Write(jwks)
+			}))
+			defer server.Close()
+
+			cache := NewMemoryKeyCache()
+			fetcher := NewJWKSFetcher(server.URL, time.Hour, WithFetcherKeyCache(cache))
+
+			for range 2 {
+				if _, err := fetcher.GetKey(context.Background(), gen.KeyID()); err != nil {
+					t.Fatalf("GetKey() error = %v", err)
+				}
+			}
+
+			if full != 1 || full+notModified != tt.wantRequests {
+				t.Errorf("full responses = %d, 304 responses = %d, want %d requests with one full response",
+					full, notModified, tt.wantRequests)
+			}
+
+			cache.mu.RLock()
+			entry, ok := cache.entries[server.URL]
+			cache.mu.RUnlock()
+			switch {
+			case tt.wantTTL == 0 && ok:
+				t.Errorf("keys cached until %v, want not cached", entry.expiresAt)
+			case tt.wantTTL > 0 && (!ok || time.Until(entry.expiresAt) > tt.wantTTL):
+				t.Errorf("cache entry = %+v, want a TTL of at most %v", entry, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestJWKSFetcher_CoalescedRefresh(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	jwks, err := json.Marshal(&KeySet{Keys: map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()}})
+	if err != nil {
+		t.Fatalf("failed to encode JWKS: %v", err)
+	}
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	fetcher := NewJWKSFetcher(server.URL, time.Hour)
+	ctx := context.Background()
+
+	t.Run("concurrent cache misses share one request", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := fetcher.GetKey(ctx, gen.KeyID()); err != nil {
+					errs <- err
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Errorf("GetKey() error = %v", err)
+		}
+		if got := requests.Load(); got != 1 {
+			t.Errorf("JWKS requests = %d, want 1", got)
+		}
+	})
+
+	t.Run("unknown key IDs do not refresh fresh keys", func(t *testing.T) {
+		for _, kid := range []string{"made-up-1", "made-up-2", "made-up-3"} {
+			if _, err := fetcher.GetKey(ctx, kid); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("GetKey(%q) error = %v, want ErrKeyNotFound", kid, err)
+			}
+		}
+		if got := requests.Load(); got != 1 {
+			t.Errorf("JWKS requests = %d, want 1", got)
+		}
+	})
+
+	t.Run("unknown key IDs refresh older keys", func(t *testing.T) {
+		fetcher.minRefreshInterval = 0
+		if _, err := fetcher.GetKey(ctx, "made-up-4"); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("GetKey() error = %v, want ErrKeyNotFound", err)
+		}
+		if got := requests.Load(); got != 2 {
+			t.Errorf("JWKS requests = %d, want 2", got)
+		}
+	})
+}
+
+func TestParseMaxAge(t *testing.T) {
+	tests := []struct {
+		header         string
+		want           time.Duration
+		wantRevalidate bool
+	}{
+		{header: "", want: 0},
+		{header: "public, max-age=300", want: 300 * time.Second},
+		{header: "Max-Age=60", want: time.Minute},
+		{header: "max-age=invalid", want: 0},
+		{header: "max-age=0", wantRevalidate: true},
+		{header: "no-store, max-age=300", wantRevalidate: true},
+		{header: "max-age=300, no-cache", wantRevalidate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, revalidate := parseMaxAge(tt.header)
+			if got != tt.want || revalidate != tt.wantRevalidate {
+				t.Errorf("parseMaxAge(%q) = %v, %v, want %v, %v", tt.header, got, revalidate, tt.want, tt.wantRevalidate)
+			}
+		})
+	}
+}
+
+func TestJWKSFetcher_Prime(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	ctx := context.Background()
+
+	t.Run("prime fetches keys and becomes healthy", func(t *testing.T) {
+		fetcher := NewJWKSFetcher(server.URL()+"/.well-known/jwks", time.Hour)
+
+		if fetcher.Healthy() {
+			t.Error("Healthy() = true before any fetch")
+		}
+		if !fetcher.LastRefresh().IsZero() {
+			t.Error("LastRefresh() should be zero before any fetch")
+		}
+
+		if err := fetcher.Prime(ctx); err != nil {
+			t.Fatalf("Prime() error = %v", err)
+		}
+
+		if !fetcher.Healthy() {
+			t.Error("Healthy() = false after Prime")
+		}
+		if fetcher.LastRefresh().IsZero() {
+			t.Error("LastRefresh() is zero after Prime")
+		}
+	})
+
+	t.Run("failed prime is unhealthy", func(t *testing.T) {
+		fetcher := NewJWKSFetcher(server.URL()+"/missing", time.Hour)
+		fetcher.retry = RetryPolicy{MaxAttempts: 1}
+
+		if err := fetcher.Prime(ctx); !errors.Is(err, ErrJWKSFetch) {
+			t.Fatalf("Prime() error = %v, want ErrJWKSFetch", err)
+		}
+		if fetcher.Healthy() {
+			t.Error("Healthy() = true after failed Prime")
+		}
+	})
+
+	t.Run("static keys need no fetch", func(t *testing.T) {
+		fetcher := NewJWKSFetcher(server.URL()+"/missing", time.Hour)
+		fetcher.staticKeys = map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()}
+
+		if err := fetcher.Prime(ctx); err != nil {
+			t.Fatalf("Prime() error = %v", err)
+		}
+		if !fetcher.Healthy() {
+			t.Error("Healthy() = false with static keys")
+		}
+	})
+}
+
+func FuzzJWKToPublicKey(f *testing.F) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		f.Fatalf("failed to create token generator: %v", err)
+	}
+	f.Add(base64.RawURLEncoding.EncodeToString(gen.PublicKey().N.Bytes()), "AQAB")
+	f.Add("sXch", "AQAB")
+	f.Add("", "")
+	f.Add("AA", "AQ")
+	f.Add("AQAB", "__________8")
+
+	f.Fuzz(func(t *testing.T, n, e string) {
+		key, err := jwkToPublicKey(JWK{Kty: "RSA", N: n, E: e})
+		if err != nil {
+			return
+		}
+		if key.N.BitLen() < minRSAKeyBits {
+			t.Errorf("accepted a %d-bit modulus", key.N.BitLen())
+		}
+		if key.E < 2 {
+			t.Errorf("accepted exponent %d", key.E)
+		}
+	})
 }
@@ -0,0 +1,210 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeySet is a set of signing keys fetched from a JWKS endpoint
+type KeySet struct {
+	// Keys maps key IDs to public keys
+	Keys map[string]*rsa.PublicKey
+
+	// FetchedAt is when the keys were fetched from the endpoint
+	FetchedAt time.Time
+
+	// ETag is the entity tag returned by the endpoint, used to revalidate
+	// the keys with a conditional request
+	ETag string
+}
+
+// keySetJSON is the serialized form of a KeySet
+type keySetJSON struct {
+	Keys      []JWK     `json:"keys"`
+	FetchedAt time.Time `json:"fetched_at"`
+	ETag      string    `json:"etag,omitempty"`
+}
+
+// MarshalJSON encodes the key set as a JWKS document with its fetch time,
+// so that KeyCache implementations can store it as bytes
+func (s *KeySet) MarshalJSON() ([]byte, error) {
+	doc := keySetJSON{
+		Keys:      make([]JWK, 0, len(s.Keys)),
+		FetchedAt: s.FetchedAt,
+		ETag:      s.ETag,
+	}
+
+	for kid, key := range s.Keys {
+		doc.Keys = append(doc.Keys, JWK{
+			Kid: kid,
+			Kty: "RSA",
+			Alg: "RS256",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+
+	// Stable output regardless of map order
+	sort.Slice(doc.Keys, func(i, j int) bool { return doc.Keys[i].Kid < doc.Keys[j].Kid })
+
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON decodes a key set produced by MarshalJSON
+func (s *KeySet) UnmarshalJSON(data []byte) error {
+	var doc keySetJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	s.Keys = keysFromJWKS(JWKS{Keys: doc.Keys})
+	s.FetchedAt = doc.FetchedAt
+	s.ETag = doc.ETag
+	return nil
+}
+
+// KeyCache stores key sets by JWKS URL. Implementations must be safe for
+// concurrent use; a shared implementation (e.g. Redis) lets several
+// instances of a service reuse one fetch.
+type KeyCache interface {
+	// Get returns the cached key set for the URL, or nil if none is cached
+	// or it has expired
+	Get(ctx context.Context, url string) (*KeySet, error)
+
+	// Set stores the key set for the URL for the given duration
+	Set(ctx context.Context, url string, keys *KeySet, ttl time.Duration) error
+}
+
+// MemoryKeyCache is the default in-process KeyCache
+type MemoryKeyCache struct {
+	mu      sync.RWMutex
+	entries map[string]memoryKeyCacheEntry
+}
+
+// memoryKeyCacheEntry is a cached key set with its expiry
+type memoryKeyCacheEntry struct {
+	keys      *KeySet
+	expiresAt time.Time
+}
+
+// NewMemoryKeyCache creates an empty in-memory key cache
+func NewMemoryKeyCache() *MemoryKeyCache {
+	return &MemoryKeyCache{
+		entries: make(map[string]memoryKeyCacheEntry),
+	}
+}
+
+// Get returns the cached key set for the URL if it has not expired
+func (c *MemoryKeyCache) Get(_ context.Context, url string) (*KeySet, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[url]
+	c.mu.RUnlock()
+
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil, nil
+	}
+	return entry.keys, nil
+}
+
+// Set stores the key set for the URL
+func (c *MemoryKeyCache) Set(_ context.Context, url string, keys *KeySet, ttl time.Duration) error {
+	c.mu.Lock()
+	c.entries[url] = memoryKeyCacheEntry{
+		keys:      keys,
+		expiresAt: time.Now().Add(ttl),
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// FileKeyCache is a KeyCache storing key sets as files in a directory, so
+// that they survive process restarts, e.g. across invocations sharing a
+// serverless execution environment, or are shared by the processes of a
+// host. Each JWKS URL is one file, replaced atomically.
+type FileKeyCache struct {
+	dir string
+}
+
+// fileKeyCacheEntry is the content of a FileKeyCache file
+type fileKeyCacheEntry struct {
+	Keys      *KeySet   `json:"key_set"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewFileKeyCache creates a key cache in dir, which is created when the
+// first key set is stored
+func NewFileKeyCache(dir string) *FileKeyCache {
+	return &FileKeyCache{dir: dir}
+}
+
+// path returns the file of a JWKS URL
+func (c *FileKeyCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Get returns the cached key set for the URL if it has not expired
+func (c *FileKeyCache) Get(_ context.Context, url string) (*KeySet, error) {
+	data, err := os.ReadFile(c.path(url))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry fileKeyCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	if entry.Keys == nil || !time.Now().Before(entry.ExpiresAt) {
+		return nil, nil
+	}
+	return entry.Keys, nil
+}
+
+// Set stores the key set for the URL
+func (c *FileKeyCache) Set(_ context.Context, url string, keys *KeySet, ttl time.Duration) error {
+	data, err := json.Marshal(fileKeyCacheEntry{Keys: keys, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".jwks-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(url))
+}
+
+// WithKeyCache sets the cache used for fetched signing keys. Defaults to an
+// in-memory cache.
+func WithKeyCache(cache KeyCache) Option {
+	return func(v *Verifier) {
+		v.keyCache = cache
+	}
+}
@@ -0,0 +1,178 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+// countingTransport counts requests passed to the default transport
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestMemoryKeyCache(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	ctx := context.Background()
+	cache := NewMemoryKeyCache()
+
+	keys, err := cache.Get(ctx, "https://example.com/jwks")
+	if err != nil || keys != nil {
+		t.Fatalf("Get() on empty cache = %v, %v, want nil, nil", keys, err)
+	}
+
+	set := &KeySet{
+		Keys:      map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()},
+		FetchedAt: time.Now(),
+	}
+	if err := cache.Set(ctx, "https://example.com/jwks", set, 50*time.Millisecond); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	keys, err = cache.Get(ctx, "https://example.com/jwks")
+	if err != nil || keys != set {
+		t.Fatalf("Get() = %v, %v, want stored key set", keys, err)
+	}
+
+	if keys, _ := cache.Get(ctx, "https://other.example.com/jwks"); keys != nil {
+		t.Error("Get() returned keys for a different URL")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if keys, _ := cache.Get(ctx, "https://example.com/jwks"); keys != nil {
+		t.Error("Get() returned expired keys")
+	}
+}
+
+func TestFileKeyCache(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "jwks")
+	cache := NewFileKeyCache(dir)
+
+	keys, err := cache.Get(ctx, "https://example.com/jwks")
+	if err != nil || keys != nil {
+		t.Fatalf("Get() on empty cache = %v, %v, want nil, nil", keys, err)
+	}
+
+	set := &KeySet{
+		Keys:      map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()},
+		FetchedAt: time.Now(),
+		ETag:      `"v1"`,
+	}
+	if err := cache.Set(ctx, "https://example.com/jwks", set, 100*time.Millisecond); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// Another instance, e.g. the next process, reads the stored keys
+	keys, err = NewFileKeyCache(dir).Get(ctx, "https://example.com/jwks")
+	if err != nil || keys == nil {
+		t.Fatalf("Get() = %v, %v, want stored key set", keys, err)
+	}
+	if key := keys.Keys[gen.KeyID()]; key == nil || !key.Equal(gen.PublicKey()) || keys.ETag != `"v1"` {
+		t.Errorf("Get() = %+v, want the stored key and ETag", keys)
+	}
+
+	if keys, _ := cache.Get(ctx, "https://other.example.com/jwks"); keys != nil {
+		t.Error("Get() returned keys for a different URL")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if keys, _ := cache.Get(ctx, "https://example.com/jwks"); keys != nil {
+		t.Error("Get() returned expired keys")
+	}
+}
+
+func TestKeySet_JSON(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	set := &KeySet{
+		Keys:      map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()},
+		FetchedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var decoded KeySet
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if !decoded.FetchedAt.Equal(set.FetchedAt) {
+		t.Errorf("FetchedAt = %v, want %v", decoded.FetchedAt, set.FetchedAt)
+	}
+
+	key, ok := decoded.Keys[gen.KeyID()]
+	if !ok {
+		t.Fatalf("decoded keys = %v, want %q", decoded.Keys, gen.KeyID())
+	}
+	if !key.Equal(gen.PublicKey()) {
+		t.Error("decoded key does not match original")
+	}
+}
+
+func TestWithKeyCache_Shared(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	tokenString, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	// Two verifiers stand in for two instances of a service sharing a cache
+	cache := NewMemoryKeyCache()
+	transport := &countingTransport{}
+
+	for i := 0; i < 2; i++ {
+		verifier, err := New(
+			WithJWKSURL(server.URL()+"/.well-known/jwks"),
+			WithHTTPClient(&http.Client{Transport: transport}),
+			WithKeyCache(cache),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if _, err := verifier.Verify(context.Background(), tokenString); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+	}
+
+	if got := transport.requests.Load(); got != 1 {
+		t.Errorf("JWKS requests = %d, want 1", got)
+	}
+}
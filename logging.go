@@ -0,0 +1,76 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// discardLogger is the default logger, which drops everything
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// WithLogger sets the logger for internal diagnostics: JWKS refreshes and
+// cache expiry, and verification failures at debug level. Tokens are never
+// logged, and only the claims in loggedClaims are included. Logging is off
+// by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(v *Verifier) {
+		if logger == nil {
+			logger = discardLogger
+		}
+		v.logger = logger
+	}
+}
+
+// loggedClaims are the claims safe to include in logs. Personal data such
+// as the actor is left out.
+var loggedClaims = []string{
+	"iss",
+	"repository",
+	"ref",
+	"workflow_ref",
+	"job_workflow_ref",
+	"event_name",
+	"environment",
+	"runner_environment",
+}
+
+// claimsAttr returns the loggable claims as a group
+func claimsAttr(claims *GitHubActionsClaims) slog.Attr {
+	var attrs []any
+	for _, name := range loggedClaims {
+		if value, ok := claimValue(claims, name); ok {
+			attrs = append(attrs, slog.String(name, value))
+		}
+	}
+	return slog.Group("claims", attrs...)
+}
+
+// logFailure logs a failed verification at debug level
+func (v *Verifier) logFailure(ctx context.Context, claims *GitHubActionsClaims, err error) {
+	if !v.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := []any{
+		slog.String("code", string(ErrorCodeOf(err))),
+		slog.String("error", err.Error()),
+	}
+	if version := deniedPolicyVersion(err); version != "" {
+		attrs = append(attrs, slog.String("policy_version", version))
+	}
+	if claims != nil {
+		attrs = append(attrs, claimsAttr(claims))
+	}
+	v.logger.DebugContext(ctx, "token verification failed", attrs...)
+}
+
+// deniedPolicyVersion returns the version of the policy that denied a
+// token, if err is a policy denial
+func deniedPolicyVersion(err error) string {
+	var valErr *ValidationError
+	if errors.As(err, &valErr) && valErr.Denial != nil {
+		return valErr.Denial.PolicyVersion
+	}
+	return ""
+}
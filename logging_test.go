@@ -0,0 +1,74 @@
+package ghaauth
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestWithLogger(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	verifier, err := New(
+		WithPolicy(&Policy{
+			Rules:       []Rule{{Name: "allow-other", Conditions: Conditions{RepositoryOwner: []string{"otherorg"}}, Effect: EffectAllow}},
+			DefaultDeny: true,
+		}),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithLogger(logger),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	claims := testutil.DefaultClaims()
+	claims.Actor = "secret-actor"
+	token, err := gen.GenerateToken(claims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	if _, err := verifier.Verify(context.Background(), token); err == nil {
+		t.Fatal("Verify() error = nil, want policy denial")
+	}
+
+	logs := buf.String()
+	for _, want := range []string{
+		`msg="jwks refreshed"`,
+		`msg="token verification failed"`,
+		"code=policy_denied",
+		"claims.repository=myorg/myrepo",
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs do not contain %q:\n%s", want, logs)
+		}
+	}
+	for _, secret := range []string{token, "secret-actor"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("logs contain %q:\n%s", secret, logs)
+		}
+	}
+}
+
+func TestWithLogger_Nil(t *testing.T) {
+	verifier, err := New(WithLogger(nil))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Must not panic
+	_, _ = verifier.Verify(context.Background(), "not-a-token")
+}
@@ -0,0 +1,77 @@
+package ghaauth
+
+import (
+	"container/list"
+	"sync"
+)
+
+// matchCache is a bounded LRU cache of pattern match results, shared by the
+// wildcard patterns of a CompiledPolicy. It is safe for concurrent use.
+type matchCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[matchKey]*list.Element
+	order   *list.List // most recently used first
+}
+
+// matchKey identifies a match of a value against a pattern
+type matchKey struct {
+	pattern string
+	value   string
+}
+
+// matchEntry is a cached match result
+type matchEntry struct {
+	key     matchKey
+	matched bool
+}
+
+// newMatchCache creates a cache holding up to size results
+func newMatchCache(size int) *matchCache {
+	return &matchCache{
+		size:    size,
+		entries: make(map[matchKey]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// match returns the cached result of matching value against pattern, or
+// computes it with fn and caches it. fn runs without the lock held.
+func (c *matchCache) match(pattern, value string, fn func() bool) bool {
+	key := matchKey{pattern: pattern, value: value}
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		matched := elem.Value.(*matchEntry).matched
+		c.mu.Unlock()
+		return matched
+	}
+	c.mu.Unlock()
+
+	matched := fn()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		// Another goroutine cached it meanwhile
+		return matched
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*matchEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(&matchEntry{key: key, matched: matched})
+	return matched
+}
+
+// len returns the number of cached results
+func (c *matchCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
@@ -0,0 +1,59 @@
+package ghaauth
+
+import "testing"
+
+func TestMatchCache(t *testing.T) {
+	cache := newMatchCache(2)
+
+	calls := 0
+	match := func(pattern, value string) bool {
+		return cache.match(pattern, value, func() bool {
+			calls++
+			return Match(pattern, value)
+		})
+	}
+
+	if !match("myorg/*", "myorg/app") {
+		t.Fatal("match() = false, want true")
+	}
+	if !match("myorg/*", "myorg/app") || calls != 1 {
+		t.Errorf("calls = %d after a repeated match, want 1", calls)
+	}
+
+	// A third pair evicts the least recently used one
+	match("myorg/*", "other/app")
+	match("refs/**", "refs/heads/main")
+	if cache.len() != 2 {
+		t.Errorf("len() = %d, want 2", cache.len())
+	}
+
+	calls = 0
+	match("refs/**", "refs/heads/main")
+	if calls != 0 {
+		t.Error("recently used result was evicted")
+	}
+	if !match("myorg/*", "myorg/app") || calls != 1 {
+		t.Errorf("calls = %d, want evicted result to be recomputed", calls)
+	}
+}
+
+func TestWithPolicyMatchCache(t *testing.T) {
+	policy := &Policy{
+		Rules:       []Rule{{Conditions: Conditions{Ref: []string{"refs/heads/**/release-*"}}, Effect: EffectAllow}},
+		DefaultDeny: true,
+	}
+	v, err := New(WithPolicy(policy), WithPolicyMatchCache(8))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	compiled := v.compiledPolicy(policy)
+	for range 2 {
+		if !compiled.Evaluate(&GitHubActionsClaims{Ref: "refs/heads/team/release-1"}).Allowed {
+			t.Error("Evaluate() denied a matching ref")
+		}
+	}
+	if cache := compiled.rules[0].conditions[0].patterns.patterns[0].cache; cache == nil || cache.len() != 1 {
+		t.Error("policy patterns are not cached")
+	}
+}
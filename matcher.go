@@ -1,116 +1,630 @@
 package ghaauth
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
+// RegexPrefix marks a pattern as a regular expression, e.g.
+// `re:refs/tags/v\d+\.\d+\.\d+`. The expression is anchored to match the
+// whole value.
+const RegexPrefix = "re:"
+
 // Match checks if a value matches a pattern with wildcard support
 // Supported wildcards:
 //   - '*' matches any sequence of characters except '/'
 //   - '**' matches any sequence of characters including '/'
+//   - '?' matches any single character except '/'
+//   - '[a-z]' matches one character in the class ('[!a-z]' or '[^a-z]'
+//     negates it); classes never match '/'
+//   - '{main,develop}' matches any of the alternatives, which may nest
+//   - '\' escapes the next character
+//
+// Braces are expanded first, then the expanded patterns are matched
+// segment by segment. For compatibility with patterns written before these
+// were supported, a pattern always matches a value equal to it and '[' is
+// also tried as a literal, so "*[bot]" still matches "dependabot[bot]".
+//
+// Patterns starting with RegexPrefix are matched as regular expressions;
+// an invalid expression matches nothing.
 func Match(pattern, value string) bool {
+	if expr, ok := strings.CutPrefix(pattern, RegexPrefix); ok {
+		re, err := cachedRegexp(expr)
+		return err == nil && re.MatchString(value)
+	}
+
+	if pattern == value {
+		return true
+	}
+
+	if strings.IndexByte(pattern, '{') >= 0 {
+		for _, expanded := range expandBraces(pattern) {
+			if matchInternal(expanded, value) {
+				return true
+			}
+		}
+		return false
+	}
+
 	return matchInternal(pattern, value)
 }
 
-// matchInternal is the recursive pattern matching implementation
-func matchInternal(pattern, value string) bool {
-	// Split pattern into segments
-	pi := 0
-	vi := 0
+// patternMeta are the characters with special meaning in glob patterns
+const patternMeta = `*?[{\`
 
-	for {
-		// Both exhausted - match
-		if pi >= len(pattern) && vi >= len(value) {
-			return true
-		}
+// maxBraceExpansions bounds the number of patterns a pattern's braces may
+// expand to, which otherwise grows exponentially with the number of groups
+const maxBraceExpansions = 1024
 
-		// Pattern exhausted but value remains - no match
-		if pi >= len(pattern) {
-			return false
-		}
+// expandBraces expands {a,b} alternations into the list of patterns they
+// stand for. Braces without a top-level comma, or unbalanced ones, are
+// kept literally. Patterns expanding to more than maxBraceExpansions
+// patterns expand to none, so that they only match values equal to them;
+// ValidatePattern rejects them.
+func expandBraces(pattern string) []string {
+	expanded, ok := expandBracesLimit(pattern)
+	if !ok {
+		return nil
+	}
+	return expanded
+}
 
-		// Check for ** (matches any sequence including /)
-		if pi+1 < len(pattern) && pattern[pi:pi+2] == "**" {
-			// Skip the **
-			pi += 2
+// expandBracesLimit expands braces like expandBraces, reporting false if
+// there would be more than maxBraceExpansions patterns
+func expandBracesLimit(pattern string) ([]string, bool) {
+	open, depth := -1, 0
+	var commas []int
 
-			// If ** is at the end, match everything
-			if pi >= len(pattern) {
-				return true
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				open = i
+				commas = commas[:0]
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if len(commas) == 0 {
+				// Literal braces, keep looking for a group
+				continue
 			}
 
-			// Skip optional separator after **
-			if pi < len(pattern) && pattern[pi] == '/' {
-				pi++
+			prefix := pattern[:open]
+			suffixes, ok := expandBracesLimit(pattern[i+1:])
+			if !ok {
+				return nil, false
+			}
+			var out []string
+			start := open + 1
+			for _, end := range append(commas, i) {
+				alts, ok := expandBracesLimit(pattern[start:end])
+				if !ok || len(out)+len(alts)*len(suffixes) > maxBraceExpansions {
+					return nil, false
+				}
+				for _, alt := range alts {
+					for _, suffix := range suffixes {
+						out = append(out, prefix+alt+suffix)
+					}
+				}
+				start = end + 1
 			}
+			return out, true
+		}
+	}
+
+	return []string{pattern}, true
+}
+
+// matchClass matches c against the character class at the start of
+// pattern. It returns the class length, or ok false if the class is not
+// terminated and '[' should be taken literally.
+func matchClass(pattern string, c byte) (matched bool, width int, ok bool) {
+	i := 1
+	negate := i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^')
+	if negate {
+		i++
+	}
+
+	first := true
+	for i < len(pattern) {
+		ch := pattern[i]
+		if ch == ']' && !first {
+			// Classes never match '/'
+			return matched != negate && c != '/', i + 1, true
+		}
+		first = false
+
+		if ch == '\\' && i+1 < len(pattern) {
+			i++
+			ch = pattern[i]
+		}
+
+		lo, hi := ch, ch
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+		i++
+	}
+
+	return false, 0, false
+}
 
-			// Try matching the rest of pattern at each position in value
-			for i := vi; i <= len(value); i++ {
-				if matchInternal(pattern[pi:], value[i:]) {
-					return true
+// globRegexp converts a pattern to an anchored RE2 expression that matches
+// the same ASCII values as Match, for systems that only support regular
+// expressions
+func globRegexp(pattern string) string {
+	if expr, ok := strings.CutPrefix(pattern, RegexPrefix); ok {
+		return `^(?:` + expr + `)$`
+	}
+
+	// A pattern always matches a value equal to it
+	alts := []string{regexp.QuoteMeta(pattern)}
+	if strings.ContainsAny(pattern, patternMeta) {
+		for _, expanded := range expandBraces(pattern) {
+			alts = append(alts, globBody(expanded))
+		}
+	}
+
+	return `^(?:` + strings.Join(alts, "|") + `)$`
+}
+
+// globBody converts a brace-free glob pattern, mirroring matchInternal
+func globBody(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				// The separator after ** is optional
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
 				}
+				b.WriteString(`(?s:.*)`)
+				continue
+			}
+			b.WriteString(`[^/]*`)
+		case '?':
+			b.WriteString(`[^/]`)
+		case '[':
+			if class, width, ok := classRegexp(pattern[i:]); ok {
+				// The class, or a literal '[' followed by the rest
+				b.WriteString(`(?:` + class + globBody(pattern[i+width:]) + `|\[` + globBody(pattern[i+1:]) + `)`)
+				return b.String()
+			}
+			b.WriteString(`\[`)
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
 			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			end := i + 1
+			for end < len(pattern) && strings.IndexByte(`*?[\\`, pattern[end]) < 0 {
+				end++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i:end]))
+			i = end - 1
+		}
+	}
+	return b.String()
+}
+
+// classRegexp converts the character class at the start of pattern to an
+// RE2 class matching the same characters. Non-ASCII characters only match
+// negated classes.
+func classRegexp(pattern string) (class string, width int, ok bool) {
+	var b strings.Builder
+	b.WriteByte('[')
+	for c := 0; c < 0x80; c++ {
+		matched, w, valid := matchClass(pattern, byte(c))
+		if !valid {
+			return "", 0, false
+		}
+		width = w
+		if matched {
+			fmt.Fprintf(&b, `\x{%x}`, c)
+		}
+	}
+
+	negated := pattern[1] == '!' || pattern[1] == '^'
+	if negated {
+		b.WriteString(`\x{80}-\x{10ffff}`)
+	}
+	if b.Len() == 1 {
+		// Nothing matches
+		return `[^\x{0}-\x{10ffff}]`, width, true
+	}
+
+	b.WriteByte(']')
+	return b.String(), width, true
+}
+
+// regexpCache holds compiled regex patterns by expression
+var regexpCache sync.Map
+
+// cachedRegexp compiles an anchored regex pattern once
+func cachedRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := compileRegexp(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Store(expr, re)
+	return re, nil
+}
+
+// compileRegexp compiles expr anchored to match the whole value
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + expr + `)$`)
+}
+
+// ValidatePattern reports an error if the pattern is an invalid regular
+// expression, or a glob pattern that is not valid UTF-8 or whose braces
+// expand to more than 1024 patterns
+func ValidatePattern(pattern string) error {
+	if expr, ok := strings.CutPrefix(pattern, RegexPrefix); ok {
+		_, err := compileRegexp(expr)
+		return err
+	}
+	if !utf8.ValidString(pattern) {
+		return fmt.Errorf("pattern is not valid UTF-8")
+	}
+	if _, ok := expandBracesLimit(pattern); !ok {
+		return fmt.Errorf("braces expand to more than %d patterns", maxBraceExpansions)
+	}
+	return nil
+}
+
+// matchInternal matches a brace-free pattern against a value without
+// recursion or backtracking. Like the two-pointer matcher of
+// path/filepath.Match it walks the value once, but instead of a single
+// pattern position and the last '*' to backtrack to, it advances every
+// pattern position still alive at the same time, which also covers '**'
+// and the literal fallback of '['. A pattern of p bytes matches a value of
+// v bytes in O(p*v) time and O(p) space, whatever its wildcards.
+func matchInternal(pattern, value string) bool {
+	// Most values are told apart by the literal text the pattern starts with
+	start := literalRun(pattern)
+	if !strings.HasPrefix(value, pattern[:start]) {
+		return false
+	}
+
+	// Most patterns are short enough for their state to stay on the stack
+	n := len(pattern) + 1
+	var small [3 * 32]int
+	buf := small[:]
+	if 3*n > len(buf) {
+		buf = make([]int, 3*n)
+	}
+
+	m := globMatcher{
+		pattern: pattern,
+		live:    [2][]int{buf[:n], buf[n : 2*n]},
+		marks:   buf[2*n : 3*n],
+	}
+
+	m.gen = start
+	m.add(start)
+	for vi := start; vi < len(value); {
+		switch m.count[m.side] {
+		case 0:
 			return false
+		case 1:
+			// A single position before literal text, as between the
+			// wildcards of most patterns, compares the text at once
+			pi := m.live[m.side][0]
+			if run := literalRun(pattern[pi:]); run > 0 {
+				if !strings.HasPrefix(value[vi:], pattern[pi:pi+run]) {
+					return false
+				}
+				vi += run
+				m.count[m.side], m.gen = 0, vi
+				m.add(pi + run)
+				continue
+			}
+		case 2:
+			// A trailing '*' or '**' matches the rest of the value, up to
+			// any '/' for '*'
+			pi := m.live[m.side][0]
+			if pi < len(pattern) && pattern[pi] == '*' && m.starEnd(pi) == len(pattern) {
+				return pi+1 < len(pattern) || strings.IndexByte(value[vi:], '/') < 0
+			}
+		}
+		m.step(value[vi], vi+1)
+		vi++
+	}
+
+	return m.marks[len(pattern)] == len(value)+1
+}
+
+// literalRun returns the length of the literal text at the start of
+// pattern
+func literalRun(pattern string) int {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[', '\\':
+			return i
+		}
+	}
+	return len(pattern)
+}
+
+// globMatcher holds the live pattern positions of one matchInternal call
+type globMatcher struct {
+	pattern string
+
+	// live holds the pattern positions alive before and after the current
+	// value byte, and count their numbers; side selects the list of
+	// positions after it
+	live  [2][]int
+	count [2]int
+	side  int
+
+	// marks records for each pattern position the step in which it was
+	// last made alive, plus one, so that positions are added once per
+	// step without clearing a set
+	marks []int
+	gen   int
+}
+
+// add makes pattern position pi alive after the current step, along with
+// the positions reached by matching any '*' or '**' there with nothing
+func (m *globMatcher) add(pi int) {
+	for m.marks[pi] != m.gen+1 {
+		m.marks[pi] = m.gen + 1
+		m.live[m.side][m.count[m.side]] = pi
+		m.count[m.side]++
+
+		if pi >= len(m.pattern) || m.pattern[pi] != '*' {
+			return
 		}
+		pi = m.starEnd(pi)
+	}
+}
 
-		// Check for * (matches any sequence except /)
-		if pi < len(pattern) && pattern[pi] == '*' {
+// starEnd returns the pattern position after the '*' or '**' at pi. The
+// separator after '**' is optional, so it is skipped as well.
+func (m *globMatcher) starEnd(pi int) int {
+	if pi+1 < len(m.pattern) && m.pattern[pi+1] == '*' {
+		pi += 2
+		if pi < len(m.pattern) && m.pattern[pi] == '/' {
 			pi++
+		}
+		return pi
+	}
+	return pi + 1
+}
 
-			// Find what comes after the *
-			nextSlash := strings.IndexByte(pattern[pi:], '/')
-			var suffix string
-			if nextSlash >= 0 {
-				suffix = pattern[pi : pi+nextSlash]
-			} else {
-				suffix = pattern[pi:]
-			}
+// step consumes the value byte c, moving every live pattern position that
+// accepts it. gen numbers the steps from one.
+func (m *globMatcher) step(c byte, gen int) {
+	pattern := m.pattern
+	cur := m.live[m.side][:m.count[m.side]]
+	m.side ^= 1
+	m.count[m.side] = 0
+	m.gen = gen
 
-			// Find the next / in value (since * doesn't cross /)
-			valueSlash := strings.IndexByte(value[vi:], '/')
-			searchEnd := len(value)
-			if valueSlash >= 0 {
-				searchEnd = vi + valueSlash
-			}
+	for _, pi := range cur {
+		if pi >= len(pattern) {
+			continue
+		}
 
-			// Try matching suffix at each position before the /
-			if suffix == "" {
-				// No suffix after *, so match up to next /
-				if valueSlash >= 0 {
-					if matchInternal(pattern[pi:], value[vi+valueSlash:]) {
-						return true
-					}
-				} else {
-					// No / in value, so match rest
-					return matchInternal(pattern[pi:], "")
+		switch pattern[pi] {
+		case '*':
+			// '**' matches any character, '*' any but '/'
+			if c != '/' || (pi+1 < len(pattern) && pattern[pi+1] == '*') {
+				m.add(pi)
+			}
+		case '?':
+			// Any single character except /
+			if c != '/' {
+				m.add(pi + 1)
+			}
+		case '[':
+			// The class, and a literal '[' so that patterns written
+			// before classes existed keep matching
+			if matched, width, ok := matchClass(pattern[pi:], c); ok && matched {
+				m.add(pi + width)
+			}
+			if c == '[' {
+				m.add(pi + 1)
+			}
+		case '\\':
+			// Escaped character is compared literally
+			if pi+1 < len(pattern) {
+				if pattern[pi+1] == c {
+					m.add(pi + 2)
 				}
-				return false
+			} else if c == '\\' {
+				m.add(pi + 1)
 			}
+		default:
+			if pattern[pi] == c {
+				m.add(pi + 1)
+			}
+		}
+	}
+}
+
+// patternKind classifies a pattern by the cheapest way to match it
+type patternKind int
+
+const (
+	// patternGeneral needs the full recursive matcher
+	patternGeneral patternKind = iota
+
+	// patternAny is "**", which matches everything
+	patternAny
+
+	// patternPrefix is a literal followed by "**"
+	patternPrefix
+
+	// patternSegmentPrefix is a literal followed by "*", matching values
+	// with no '/' after the literal
+	patternSegmentPrefix
+
+	// patternRegexp is a regular expression
+	patternRegexp
+)
+
+// compiledPattern is a wildcard pattern reduced to a prefix check where
+// possible, with the same semantics as Match
+type compiledPattern struct {
+	kind    patternKind
+	pattern string // the full pattern, the literal prefix or the expression
+	re      *regexp.Regexp
+	cache   *matchCache // results of general and regexp patterns, if any
+}
+
+// compilePattern classifies a regex pattern or a brace-free glob pattern
+// containing metacharacters
+func compilePattern(pattern string) compiledPattern {
+	if expr, ok := strings.CutPrefix(pattern, RegexPrefix); ok {
+		// An invalid expression leaves re nil and matches nothing, as in Match
+		re, _ := cachedRegexp(expr)
+		return compiledPattern{kind: patternRegexp, pattern: pattern, re: re}
+	}
+
+	meta := strings.IndexAny(pattern, patternMeta)
+	literal, rest := pattern[:meta], pattern[meta:]
+
+	switch rest {
+	case "**":
+		if literal == "" {
+			return compiledPattern{kind: patternAny}
+		}
+		return compiledPattern{kind: patternPrefix, pattern: literal}
+	case "*":
+		return compiledPattern{kind: patternSegmentPrefix, pattern: literal}
+	}
+
+	return compiledPattern{kind: patternGeneral, pattern: pattern}
+}
 
-			// Try to find suffix in value before next /
-			for i := vi; i <= searchEnd; i++ {
-				if matchInternal(pattern[pi:], value[i:]) {
-					return true
+// match reports whether value matches the pattern
+func (c compiledPattern) match(value string) bool {
+	switch c.kind {
+	case patternAny:
+		return true
+	case patternPrefix:
+		return strings.HasPrefix(value, c.pattern)
+	case patternSegmentPrefix:
+		return strings.HasPrefix(value, c.pattern) && strings.IndexByte(value[len(c.pattern):], '/') < 0
+	case patternRegexp:
+		if c.re == nil {
+			return false
+		}
+		if c.cache != nil {
+			return c.cache.match(c.pattern, value, func() bool { return c.re.MatchString(value) })
+		}
+		return c.re.MatchString(value)
+	}
+	if c.cache != nil {
+		return c.cache.match(c.pattern, value, func() bool { return matchInternal(c.pattern, value) })
+	}
+	return matchInternal(c.pattern, value)
+}
+
+// exactSetThreshold is the number of literal patterns above which a map
+// lookup beats comparing each string
+const exactSetThreshold = 8
+
+// patternSet is a compiled list of patterns: literals are compared directly
+// (or looked up in a set when there are many), wildcard patterns are tried
+// in order
+type patternSet struct {
+	literals []string
+	exact    map[string]struct{}
+	patterns []compiledPattern
+}
+
+// compilePatterns compiles a list of patterns for MatchAny-style matching
+func compilePatterns(patterns []string) patternSet {
+	var set patternSet
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, RegexPrefix) {
+			set.patterns = append(set.patterns, compilePattern(pattern))
+			continue
+		}
+
+		// Every glob matches a value equal to it
+		set.literals = append(set.literals, pattern)
+		if strings.ContainsAny(pattern, patternMeta) {
+			for _, expanded := range expandBraces(pattern) {
+				if strings.ContainsAny(expanded, patternMeta) {
+					set.patterns = append(set.patterns, compilePattern(expanded))
+				} else {
+					set.literals = append(set.literals, expanded)
 				}
 			}
-			return false
 		}
+	}
 
-		// Value exhausted but pattern remains
-		if vi >= len(value) {
-			// Only match if rest of pattern is wildcards
-			rest := pattern[pi:]
-			return rest == "*" || rest == "**" || rest == ""
+	if len(set.literals) > exactSetThreshold {
+		set.exact = make(map[string]struct{}, len(set.literals))
+		for _, literal := range set.literals {
+			set.exact[literal] = struct{}{}
 		}
+		set.literals = nil
+	}
 
-		// Normal character comparison
-		if pattern[pi] != value[vi] {
-			return false
+	return set
+}
+
+// match reports whether value matches any pattern in the set
+func (s *patternSet) match(value string) bool {
+	if s.exact != nil {
+		if _, ok := s.exact[value]; ok {
+			return true
 		}
+	}
+	for _, literal := range s.literals {
+		if literal == value {
+			return true
+		}
+	}
+	for _, p := range s.patterns {
+		if p.match(value) {
+			return true
+		}
+	}
+	return false
+}
 
-		pi++
-		vi++
+// withCache makes the set's general and regexp patterns memoize their
+// results in cache
+func (s patternSet) withCache(cache *matchCache) patternSet {
+	for i := range s.patterns {
+		switch s.patterns[i].kind {
+		case patternGeneral, patternRegexp:
+			s.patterns[i].cache = cache
+		}
 	}
+	return s
 }
 
 // MatchAny checks if a value matches any of the provided patterns
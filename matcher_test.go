@@ -1,7 +1,13 @@
 package ghaauth
 
 import (
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestMatch(t *testing.T) {
@@ -184,6 +190,182 @@ func TestMatch(t *testing.T) {
 			value:   "myorg/myrepo/.github/workflows/ci.yml",
 			want:    true,
 		},
+
+		// Single character (?)
+		{
+			name:    "question mark matches one character",
+			pattern: "refs/tags/v?",
+			value:   "refs/tags/v1",
+			want:    true,
+		},
+		{
+			name:    "question mark requires a character",
+			pattern: "refs/tags/v?",
+			value:   "refs/tags/v",
+			want:    false,
+		},
+		{
+			name:    "question mark does not match slash",
+			pattern: "a?b",
+			value:   "a/b",
+			want:    false,
+		},
+
+		// Character classes ([...])
+		{
+			name:    "character range",
+			pattern: "refs/tags/v[0-9].*",
+			value:   "refs/tags/v2.0",
+			want:    true,
+		},
+		{
+			name:    "character range mismatch",
+			pattern: "refs/tags/v[0-9].*",
+			value:   "refs/tags/vx.0",
+			want:    false,
+		},
+		{
+			name:    "character set",
+			pattern: "env-[abc]",
+			value:   "env-b",
+			want:    true,
+		},
+		{
+			name:    "negated class with bang",
+			pattern: "env-[!abc]",
+			value:   "env-b",
+			want:    false,
+		},
+		{
+			name:    "negated class with caret",
+			pattern: "env-[^abc]",
+			value:   "env-d",
+			want:    true,
+		},
+		{
+			name:    "class never matches slash",
+			pattern: "a[!x]b",
+			value:   "a/b",
+			want:    false,
+		},
+		{
+			name:    "leading bracket is literal in class",
+			pattern: "x[]a]",
+			value:   "x]",
+			want:    true,
+		},
+		{
+			name:    "unterminated class is literal",
+			pattern: "x[ab",
+			value:   "x[ab",
+			want:    true,
+		},
+		{
+			name:    "literal value with brackets matches itself",
+			pattern: "dependabot[bot]",
+			value:   "dependabot[bot]",
+			want:    true,
+		},
+		{
+			name:    "bracket falls back to literal",
+			pattern: "*[bot]",
+			value:   "dependabot[bot]",
+			want:    true,
+		},
+		{
+			name:    "escaped brackets",
+			pattern: `*\[bot\]`,
+			value:   "renovate[bot]",
+			want:    true,
+		},
+
+		// Alternation ({a,b})
+		{
+			name:    "brace alternation first",
+			pattern: "refs/heads/{main,develop}",
+			value:   "refs/heads/main",
+			want:    true,
+		},
+		{
+			name:    "brace alternation second",
+			pattern: "refs/heads/{main,develop}",
+			value:   "refs/heads/develop",
+			want:    true,
+		},
+		{
+			name:    "brace alternation mismatch",
+			pattern: "refs/heads/{main,develop}",
+			value:   "refs/heads/feature",
+			want:    false,
+		},
+		{
+			name:    "brace alternation with wildcard",
+			pattern: "refs/heads/release-{1,2}.*",
+			value:   "refs/heads/release-2.5",
+			want:    true,
+		},
+		{
+			name:    "brace alternation with wildcard mismatch",
+			pattern: "refs/heads/release-{1,2}.*",
+			value:   "refs/heads/release-3.0",
+			want:    false,
+		},
+		{
+			name:    "nested braces",
+			pattern: "refs/{heads/{main,dev},tags/v*}",
+			value:   "refs/tags/v1",
+			want:    true,
+		},
+		{
+			name:    "empty alternative",
+			pattern: "ci{,-nightly}",
+			value:   "ci",
+			want:    true,
+		},
+		{
+			name:    "braces without comma are literal",
+			pattern: "a{b}c",
+			value:   "a{b}c",
+			want:    true,
+		},
+		{
+			name:    "multiple brace groups",
+			pattern: "{dev,prod}-{us,eu}",
+			value:   "prod-eu",
+			want:    true,
+		},
+
+		// Regular expressions (re:)
+		{
+			name:    "regex semver tag",
+			pattern: `re:^refs/tags/v\d+\.\d+\.\d+$`,
+			value:   "refs/tags/v1.2.3",
+			want:    true,
+		},
+		{
+			name:    "regex semver tag - prerelease rejected",
+			pattern: `re:^refs/tags/v\d+\.\d+\.\d+$`,
+			value:   "refs/tags/v1.2.3-rc1",
+			want:    false,
+		},
+		{
+			name:    "regex is anchored implicitly",
+			pattern: `re:main`,
+			value:   "refs/heads/main",
+			want:    false,
+		},
+		{
+			name:    "regex alternation",
+			pattern: `re:refs/heads/(main|release/.+)`,
+			value:   "refs/heads/release/2024.1",
+			want:    true,
+		},
+		{
+			name:    "invalid regex matches nothing",
+			pattern: `re:(unclosed`,
+			value:   "(unclosed",
+			want:    false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -244,3 +426,223 @@ func TestMatchAny(t *testing.T) {
 		})
 	}
 }
+
+func TestValidatePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{pattern: "myorg/*", wantErr: false},
+		{pattern: "re:refs/tags/v[0-9]+", wantErr: false},
+		{pattern: "re:(unclosed", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if err := ValidatePattern(tt.pattern); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePattern() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "main", want: []string{"main"}},
+		{pattern: "{main,develop}", want: []string{"main", "develop"}},
+		{pattern: "{a,b}-{1,2}", want: []string{"a-1", "a-2", "b-1", "b-2"}},
+		{pattern: "x{a,{b,c}}y", want: []string{"xay", "xby", "xcy"}},
+		{pattern: "{solo}", want: []string{"{solo}"}},
+		{pattern: "{unclosed,x", want: []string{"{unclosed,x"}},
+		{pattern: `\{a,b}`, want: []string{`\{a,b}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got := expandBraces(tt.pattern)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	patterns := []string{
+		"myorg/*", "myorg/**", "refs/heads/**/fix", "*.yml", "v?.*", "**",
+		"refs/{heads,tags}/*", "[!a]*", "*[bot]", "[a-c]/x", `a\*b`, "a[", "a[]b",
+		"re:^myorg/(api|web)$", "a.b+c",
+	}
+	values := []string{
+		"", "myorg", "myorg/api", "myorg/api/x", "refs/heads/fix", "refs/heads/a/b/fix",
+		"refs/tags/v1", "ci.yml", "v1.0", "b", "a/x", "b/x", "dependabot[bot]",
+		"dependabott", "a*b", "a[", "a[]b", "axb", "a.b+c", "aab+c",
+	}
+
+	for _, pattern := range patterns {
+		re := regexp.MustCompile(globRegexp(pattern))
+		for _, value := range values {
+			if got, want := re.MatchString(value), Match(pattern, value); got != want {
+				t.Errorf("globRegexp(%q) = %s matches %q = %v, Match() = %v", pattern, re, value, got, want)
+			}
+		}
+	}
+}
+
+func TestGlobRegexp_Random(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	patternChars := []string{"a", "b", "/", "*", "**", "?", "[", "]", "!", "-", "{", ",", "}", `\`}
+	valueChars := []string{"a", "b", "/", "[", "]", "*"}
+
+	random := func(chars []string, n int) string {
+		var b strings.Builder
+		for range rng.IntN(n) {
+			b.WriteString(chars[rng.IntN(len(chars))])
+		}
+		return b.String()
+	}
+
+	for range 2000 {
+		pattern := random(patternChars, 7)
+		re, err := regexp.Compile(globRegexp(pattern))
+		if err != nil {
+			t.Fatalf("globRegexp(%q) is invalid: %v", pattern, err)
+		}
+		for range 20 {
+			value := random(valueChars, 6)
+			if got, want := re.MatchString(value), Match(pattern, value); got != want {
+				t.Fatalf("globRegexp(%q) = %s matches %q = %v, Match() = %v", pattern, re, value, got, want)
+			}
+		}
+	}
+}
+
+func TestMatch_WorstCase(t *testing.T) {
+	value := strings.Repeat("a", 200)
+
+	// A backtracking matcher takes exponential time on these
+	patterns := []string{
+		strings.Repeat("**a", 15) + "b",
+		strings.Repeat("*a", 15) + "b",
+		strings.Repeat("[a]", 30) + "b",
+	}
+	for _, pattern := range patterns {
+		if Match(pattern, value) {
+			t.Errorf("Match(%q, %q) = true, want false", pattern, value)
+		}
+	}
+
+	// Brace groups would expand to 2^20 patterns
+	bomb := strings.Repeat("{a,b}", 20)
+	if Match(bomb, strings.Repeat("a", 20)) {
+		t.Errorf("Match(%q) = true for a pattern with too many expansions", bomb)
+	}
+	if !Match(bomb, bomb) {
+		t.Errorf("Match(%q, %q) = false, want true for an equal value", bomb, bomb)
+	}
+	if err := ValidatePattern(bomb); err == nil {
+		t.Errorf("ValidatePattern(%q) error = nil, want error", bomb)
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		pattern string
+		value   string
+	}{
+		{name: "literal", pattern: "refs/heads/main", value: "refs/heads/main"},
+		{name: "segment", pattern: "myorg/*", value: "myorg/api-service"},
+		{name: "double star", pattern: "refs/heads/**/fix-*", value: "refs/heads/team/feature/fix-login"},
+		{name: "class", pattern: "refs/tags/v[0-9].[0-9]*", value: "refs/tags/v1.2.3"},
+		{name: "bot", pattern: "*[bot]", value: "dependabot[bot]"},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				Match(bm.pattern, bm.value)
+			}
+		})
+	}
+}
+
+// BenchmarkMatch_Pathological shows the time growing linearly with the
+// value on patterns that make backtracking matchers exponential
+func BenchmarkMatch_Pathological(b *testing.B) {
+	patterns := map[string]string{
+		"stars":        strings.Repeat("*a", 16) + "b",
+		"double stars": strings.Repeat("**a", 16) + "b",
+		"classes":      strings.Repeat("*[a]", 16) + "b",
+	}
+
+	for name, pattern := range patterns {
+		for _, n := range []int{64, 256, 1024} {
+			value := strings.Repeat("a", n)
+			b.Run(fmt.Sprintf("%s/%d", name, n), func(b *testing.B) {
+				for b.Loop() {
+					if Match(pattern, value) {
+						b.Fatal("unexpected match")
+					}
+				}
+			})
+		}
+	}
+}
+
+func FuzzMatch(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"myorg/*", "myorg/api"},
+		{"refs/heads/**/fix", "refs/heads/a/b/fix"},
+		{"refs/{heads,tags}/*", "refs/tags/v1"},
+		{"*[bot]", "dependabot[bot]"},
+		{"[!a-c]?", "dx"},
+		{`a\*b`, "a*b"},
+		{"re:^myorg/(api|web)$", "myorg/web"},
+		{"{a,{b,c}}**", "c/d"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, pattern, value string) {
+		got := Match(pattern, value)
+
+		if strings.HasPrefix(pattern, RegexPrefix) {
+			return
+		}
+		if !Match(pattern, pattern) {
+			t.Errorf("Match(%q, %q) = false for an equal value", pattern, pattern)
+		}
+
+		set := compilePatterns([]string{pattern})
+		if set.match(value) != got {
+			t.Errorf("compiled %q matches %q = %v, Match() = %v", pattern, value, !got, got)
+		}
+
+		// globRegexp grows with every character class, so only short valid
+		// patterns are compared. Match compares bytes and RE2 runes, which
+		// only agree on ASCII values.
+		if len(pattern) <= 16 && ValidatePattern(pattern) == nil && isASCII(value) {
+			re, err := regexp.Compile(globRegexp(pattern))
+			if err != nil {
+				t.Fatalf("globRegexp(%q) is invalid: %v", pattern, err)
+			}
+			if re.MatchString(value) != got {
+				t.Errorf("globRegexp(%q) matches %q = %v, Match() = %v", pattern, value, !got, got)
+			}
+		}
+	})
+}
+
+// isASCII reports whether s contains only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
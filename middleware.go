@@ -0,0 +1,211 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MiddlewareOption configures the HTTP middleware
+type MiddlewareOption func(*middlewareConfig)
+
+// middlewareConfig holds the HTTP middleware settings
+type middlewareConfig struct {
+	tokenExtractor func(*http.Request) (string, error)
+	errorHandler   func(http.ResponseWriter, *http.Request, error)
+	audienceFunc   func(*http.Request) string
+	nonceFunc      func(*http.Request) string
+	policySelector func(*http.Request) *Policy
+
+	// identityHeaders is the prefix of the identity headers, if set
+	identityHeaders string
+
+	// compiledPolicies caches the selected policies by pointer
+	compiledPolicies sync.Map
+}
+
+// WithTokenExtractor sets how the token is read from the request. By default
+// it is taken from the "Authorization: Bearer" header.
+func WithTokenExtractor(extractor func(*http.Request) (string, error)) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.tokenExtractor = extractor
+	}
+}
+
+// WithErrorHandler sets how verification failures are written to the client
+func WithErrorHandler(handler func(http.ResponseWriter, *http.Request, error)) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.errorHandler = handler
+	}
+}
+
+// WithAudienceFunc derives the expected audience from each request, so
+// that a gateway serving several hosts only accepts tokens minted for the
+// endpoint being called. It overrides the verifier's WithAudience. Requests
+// for which it returns "" are rejected with ErrInvalidAudience.
+func WithAudienceFunc(fn func(*http.Request) string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.audienceFunc = fn
+	}
+}
+
+// WithPolicySelector chooses the policy for each request, e.g. a stricter
+// one for admin routes, in place of the verifier's and issuer's policies.
+// Returning nil uses the verifier's policy. Each policy is validated and
+// compiled on first use, so the selector should return long-lived policies
+// that are not modified afterwards; requests selecting an invalid policy
+// are rejected with its PolicyError.
+func WithPolicySelector(selector func(*http.Request) *Policy) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.policySelector = selector
+	}
+}
+
+// HostAudience is an audience function for WithAudienceFunc that expects
+// the https URL of the requested host, e.g. "https://api.example.com"
+func HostAudience(r *http.Request) string {
+	if r.Host == "" {
+		return ""
+	}
+	return "https://" + r.Host
+}
+
+// Middleware returns net/http middleware that verifies the request's token
+// and stores the VerificationResult in the request context. It can be used
+// directly with net/http and chi.
+func Middleware(verifier TokenVerifier, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := cfg.tokenExtractor(r)
+			if err != nil {
+				cfg.errorHandler(w, r, err)
+				return
+			}
+
+			result, err := cfg.verify(r, verifier, token)
+			if err != nil {
+				cfg.errorHandler(w, r, err)
+				return
+			}
+
+			r = r.WithContext(NewContext(r.Context(), result))
+			if cfg.identityHeaders != "" {
+				r.Header = r.Header.Clone()
+				setIdentityHeaders(r.Header, cfg.identityHeaders, result)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newMiddlewareConfig applies opts to the default settings
+func newMiddlewareConfig(opts []MiddlewareOption) *middlewareConfig {
+	cfg := &middlewareConfig{
+		tokenExtractor: func(r *http.Request) (string, error) {
+			return ParseBearerToken(r.Header.Get("Authorization"))
+		},
+		errorHandler: DefaultErrorHandler,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// verify verifies a request's token with the audience and policy chosen
+// for the request and its DPoP proof, if any
+func (cfg *middlewareConfig) verify(r *http.Request, verifier TokenVerifier, token string) (*VerificationResult, error) {
+	verifyOpts := []VerifyOption{WithDPoPRequest(r)}
+	if cfg.audienceFunc != nil {
+		audience := cfg.audienceFunc(r)
+		if audience == "" {
+			return nil, NewValidationError(ErrInvalidAudience, "no audience for request")
+		}
+		verifyOpts = append(verifyOpts, WithExpectedAudience(audience))
+	}
+
+	if cfg.nonceFunc != nil {
+		nonce := cfg.nonceFunc(r)
+		if nonce == "" {
+			return nil, NewValidationError(ErrNonceMismatch, "no nonce for request")
+		}
+		verifyOpts = append(verifyOpts, WithNonce(nonce))
+	}
+
+	if cfg.policySelector != nil {
+		if policy := cfg.policySelector(r); policy != nil {
+			compiled, err := compilePolicyOnce(&cfg.compiledPolicies, policy)
+			if err != nil {
+				return nil, err
+			}
+			verifyOpts = append(verifyOpts, WithPolicyOverride(compiled))
+		}
+	}
+
+	return verifier.VerifyWith(r.Context(), token, verifyOpts...)
+}
+
+// compilePolicyOnce validates and compiles a policy, caching the result
+func compilePolicyOnce(cache *sync.Map, policy *Policy) (*CompiledPolicy, error) {
+	if compiled, ok := cache.Load(policy); ok {
+		return compiled.(*CompiledPolicy), nil
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	compiled, _ := cache.LoadOrStore(policy, policy.Compile())
+	return compiled.(*CompiledPolicy), nil
+}
+
+// ResultFromContext returns the VerificationResult stored by Middleware
+//
+// Deprecated: Use FromContext.
+func ResultFromContext(ctx context.Context) (*VerificationResult, bool) {
+	return FromContext(ctx)
+}
+
+// ParseBearerToken extracts the token from an Authorization header value
+func ParseBearerToken(authorization string) (string, error) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrMissingToken
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", ErrMissingToken
+	}
+
+	return token, nil
+}
+
+// HTTPStatus maps a verification error to an HTTP status code
+func HTTPStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+// DefaultErrorHandler writes the status from HTTPStatus without exposing
+// the underlying error to the client
+func DefaultErrorHandler(w http.ResponseWriter, _ *http.Request, err error) {
+	status := HTTPStatus(err)
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,322 @@
+package ghaauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	policy := &Policy{
+		Rules: []Rule{
+			{
+				Name:       "allow-myorg",
+				Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+				Effect:     EffectAllow,
+			},
+		},
+		DefaultDeny: true,
+	}
+
+	verifier, err := New(
+		WithPolicy(policy),
+		WithAudience("https://api.example.com"),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	validToken, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	deniedClaims := testutil.DefaultClaims()
+	deniedClaims.RepositoryOwner = "otherorg"
+	deniedClaims.Repository = "otherorg/repo"
+	deniedToken, err := gen.GenerateToken(deniedClaims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	var gotRepository string
+	handler := Middleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, ok := FromContext(r.Context())
+		if !ok {
+			t.Error("FromContext() ok = false")
+			return
+		}
+		gotRepository = result.Claims.Repository
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{
+			name:          "valid token",
+			authorization: "Bearer " + validToken,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "missing token",
+			authorization: "",
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "malformed token",
+			authorization: "Bearer not-a-jwt",
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "denied by policy",
+			authorization: "Bearer " + deniedToken,
+			wantStatus:    http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRepository = ""
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && gotRepository != "myorg/myrepo" {
+				t.Errorf("repository = %q, want %q", gotRepository, "myorg/myrepo")
+			}
+		})
+	}
+
+	t.Run("custom extractor and error handler", func(t *testing.T) {
+		var handledErr error
+		handler := Middleware(verifier,
+			WithTokenExtractor(func(r *http.Request) (string, error) {
+				return r.Header.Get("X-GHA-Token"), nil
+			}),
+			WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				handledErr = err
+				w.WriteHeader(http.StatusTeapot)
+			}),
+		)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-GHA-Token", deniedToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusTeapot {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusTeapot)
+		}
+		if !errors.Is(handledErr, ErrAccessDenied) {
+			t.Errorf("handled error = %v, want ErrAccessDenied", handledErr)
+		}
+	})
+}
+
+func TestParseBearerToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		want          string
+		wantErr       bool
+	}{
+		{name: "bearer token", authorization: "Bearer abc.def.ghi", want: "abc.def.ghi"},
+		{name: "case insensitive scheme", authorization: "bearer abc", want: "abc"},
+		{name: "empty header", authorization: "", wantErr: true},
+		{name: "basic scheme", authorization: "Basic dXNlcjpwYXNz", wantErr: true},
+		{name: "scheme only", authorization: "Bearer ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBearerToken(tt.authorization)
+			if tt.wantErr {
+				if !errors.Is(err, ErrMissingToken) {
+					t.Errorf("ParseBearerToken() error = %v, want ErrMissingToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBearerToken() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBearerToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: nil, want: http.StatusOK},
+		{err: NewValidationError(ErrAccessDenied, "rule: deny"), want: http.StatusForbidden},
+		{err: NewValidationError(ErrTokenExpired, ""), want: http.StatusUnauthorized},
+		{err: ErrMissingToken, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		if got := HTTPStatus(tt.err); got != tt.want {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestMiddleware_AudienceFunc(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	// The verifier's own audience is overridden per request
+	verifier, err := New(
+		WithAudience("https://other.example.com"),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// DefaultClaims are minted for https://api.example.com
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	handler := Middleware(verifier, WithAudienceFunc(HostAudience))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		host       string
+		wantStatus int
+	}{
+		{name: "token minted for host", host: "api.example.com", wantStatus: http.StatusOK},
+		{name: "token minted for another host", host: "other.example.com", wantStatus: http.StatusUnauthorized},
+		{name: "no host", host: "", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/deploy", nil)
+			req.Host = tt.host
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMiddleware_PolicySelector(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithAudience("https://api.example.com"),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithPolicy(&Policy{DefaultDeny: true, Rules: []Rule{{Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}}}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	admin := &Policy{DefaultDeny: true, Rules: []Rule{{Conditions: Conditions{Environment: []string{"production"}}, Effect: EffectAllow}}}
+	invalid := &Policy{Rules: []Rule{{Effect: EffectAllow}}}
+
+	selector := func(r *http.Request) *Policy {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/admin/"):
+			return admin
+		case strings.HasPrefix(r.URL.Path, "/broken/"):
+			return invalid
+		}
+		return nil
+	}
+
+	var errs []error
+	handler := Middleware(verifier,
+		WithPolicySelector(selector),
+		WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			errs = append(errs, err)
+			DefaultErrorHandler(w, r, err)
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name        string
+		path        string
+		environment string
+		wantStatus  int
+		wantErr     bool
+	}{
+		{name: "read route uses the verifier's policy", path: "/read/x", wantStatus: http.StatusOK},
+		{name: "admin route without environment", path: "/admin/x", wantStatus: http.StatusForbidden},
+		{name: "admin route with production", path: "/admin/x", environment: "production", wantStatus: http.StatusOK},
+		{name: "admin route with production again", path: "/admin/y", environment: "production", wantStatus: http.StatusOK},
+		{name: "invalid policy", path: "/broken/x", wantStatus: http.StatusUnauthorized, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs = nil
+			claims := testutil.DefaultClaims()
+			claims.Environment = tt.environment
+			token, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantErr {
+				var policyErr *PolicyError
+				if len(errs) != 1 || !errors.As(errs[0], &policyErr) {
+					t.Errorf("errors = %v, want a PolicyError", errs)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package ghaauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// NonceSeparator separates the audience from the nonce in the audience of
+// a nonce-bound token
+const NonceSeparator = "#"
+
+// NonceAudience returns the audience a workflow requests its token for to
+// bind it to nonce, e.g. "https://exchange.example.com#3f2a..."
+//
+// GitHub Actions tokens have no nonce claim, but the audience is chosen by
+// the workflow (core.getIDToken(audience) or the audience parameter of
+// ACTIONS_ID_TOKEN_REQUEST_URL), so the nonce is carried as its suffix.
+func NonceAudience(audience, nonce string) string {
+	return audience + NonceSeparator + nonce
+}
+
+// HashNonce returns the hex-encoded SHA-256 hash of value, for binding a
+// token to a secret sent along with it without revealing the secret to
+// whoever else sees the token
+func HashNonce(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithNonce requires the token's audience to be NonceAudience of the
+// expected audience and nonce, so that a token minted for one exchange
+// request cannot be forwarded to another. An expected audience must be
+// set. Tokens bound to another nonce, or to none, are rejected with
+// ErrNonceMismatch.
+func WithNonce(nonce string) VerifyOption {
+	return func(c *verifyConfig) {
+		c.nonce = nonce
+	}
+}
+
+// WithNonceFunc derives the nonce each request's token must be bound to
+// (see WithNonce), e.g. with HeaderNonce or from state the server issued
+// earlier. Requests for which it returns "" are rejected with
+// ErrNonceMismatch.
+func WithNonceFunc(fn func(*http.Request) string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.nonceFunc = fn
+	}
+}
+
+// HeaderNonce returns a nonce function for WithNonceFunc that expects the
+// HashNonce of a request header. The workflow generates a random secret,
+// requests its token for NonceAudience(audience, HashNonce(secret)) and
+// sends the secret in the header; a third party the token is shown to
+// cannot present it without the secret.
+func HeaderNonce(header string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		value := r.Header.Get(header)
+		if value == "" {
+			return ""
+		}
+		return HashNonce(value)
+	}
+}
+
+// checkNonce checks that the token's audience binds it to nonce
+func checkNonce(claims *GitHubActionsClaims, audience, nonce string) error {
+	if audience == "" {
+		return NewValidationError(ErrNonceMismatch, "nonce binding requires an expected audience")
+	}
+
+	aud, _ := claims.GetAudience()
+	want := NonceAudience(audience, nonce)
+	for _, a := range aud {
+		if subtle.ConstantTimeCompare([]byte(a), []byte(want)) == 1 {
+			return nil
+		}
+	}
+
+	// Tokens for the right audience but another nonce are told apart from
+	// tokens minted for another service
+	for _, a := range aud {
+		if a == audience || strings.HasPrefix(a, audience+NonceSeparator) {
+			return newClaimError(ErrNonceMismatch, "token is not bound to the request's nonce", map[string]any{"aud": []string(aud)})
+		}
+	}
+	return newClaimError(ErrInvalidAudience, "audience mismatch", map[string]any{"aud": []string(aud)})
+}
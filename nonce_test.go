@@ -0,0 +1,156 @@
+package ghaauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestVerifier_WithNonce(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	const audience = "https://exchange.example.com"
+	verifier, err := New(
+		WithAudience(audience),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	unbound, err := New(WithJWKSURL(server.URL() + "/.well-known/jwks"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		audience []string
+		nonce    string
+		wantCode ErrorCode
+	}{
+		{
+			name:     "bound to nonce",
+			verifier: verifier,
+			audience: []string{NonceAudience(audience, "abc123")},
+			nonce:    "abc123",
+		},
+		{
+			name:     "bound to another nonce",
+			verifier: verifier,
+			audience: []string{NonceAudience(audience, "other")},
+			nonce:    "abc123",
+			wantCode: CodeNonceMismatch,
+		},
+		{
+			name:     "not bound",
+			verifier: verifier,
+			audience: []string{audience},
+			nonce:    "abc123",
+			wantCode: CodeNonceMismatch,
+		},
+		{
+			name:     "another service",
+			verifier: verifier,
+			audience: []string{NonceAudience("https://other.example.com", "abc123")},
+			nonce:    "abc123",
+			wantCode: CodeAudienceMismatch,
+		},
+		{
+			name:     "bound token without nonce",
+			verifier: verifier,
+			audience: []string{NonceAudience(audience, "abc123")},
+			wantCode: CodeAudienceMismatch,
+		},
+		{
+			name:     "no expected audience",
+			verifier: unbound,
+			audience: []string{NonceAudience(audience, "abc123")},
+			nonce:    "abc123",
+			wantCode: CodeNonceMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testutil.DefaultClaims()
+			claims.Audience = tt.audience
+			token, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			var opts []VerifyOption
+			if tt.nonce != "" {
+				opts = append(opts, WithNonce(tt.nonce))
+			}
+			_, err = tt.verifier.VerifyWith(context.Background(), token, opts...)
+			if code := ErrorCodeOf(err); code != tt.wantCode {
+				t.Errorf("VerifyWith() error code = %q, want %q (error: %v)", code, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestMiddleware_NonceFunc(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithAudience("https://api.example.com"),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	claims := testutil.DefaultClaims()
+	claims.Audience = []string{NonceAudience("https://api.example.com", HashNonce("s3cret"))}
+	token, err := gen.GenerateToken(claims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	handler := Middleware(verifier, WithNonceFunc(HeaderNonce("X-Exchange-Nonce")))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		secret     string
+		wantStatus int
+	}{
+		{name: "secret sent", secret: "s3cret", wantStatus: http.StatusOK},
+		{name: "wrong secret", secret: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "no secret", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/exchange", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			if tt.secret != "" {
+				req.Header.Set("X-Exchange-Nonce", tt.secret)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
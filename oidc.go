@@ -0,0 +1,89 @@
+package ghaauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCKeySet verifies the signature of a compact JWT and returns its
+// payload. It has the method set of go-oidc's oidc.KeySet, so that an
+// oidc.RemoteKeySet can be passed to WithOIDCKeySet and Verifier.OIDCKeySet
+// to oidc.NewVerifier without either package importing the other.
+type OIDCKeySet interface {
+	VerifySignature(ctx context.Context, jwt string) ([]byte, error)
+}
+
+// WithOIDCKeySet verifies token signatures with keySet, e.g. an
+// oidc.RemoteKeySet already used elsewhere in the service, instead of
+// fetching the issuers' JWKS. Tokens must still come from a trusted
+// issuer, and the claims and policy are checked as usual.
+func WithOIDCKeySet(keySet OIDCKeySet) Option {
+	return func(v *Verifier) {
+		v.keySet = keySet
+	}
+}
+
+// OIDCKeySet returns the verifier's key handling as an OIDCKeySet, to plug
+// it into go-oidc based middleware without a second JWKS cache:
+//
+//	idTokenVerifier := oidc.NewVerifier(ghaauth.DefaultIssuer, verifier.OIDCKeySet(), &oidc.Config{ClientID: audience})
+//
+// Only the signature and the issuer are checked; go-oidc checks the
+// claims it knows about, and the policy is not evaluated.
+func (v *Verifier) OIDCKeySet() OIDCKeySet {
+	return verifierKeySet{v}
+}
+
+// verifierKeySet adapts a Verifier to OIDCKeySet
+type verifierKeySet struct {
+	v *Verifier
+}
+
+// VerifySignature implements OIDCKeySet
+func (ks verifierKeySet) VerifySignature(ctx context.Context, token string) ([]byte, error) {
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	if _, err := parser.Parse(token, ks.v.keyfunc(ctx)); err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(token, ".")
+	return parser.DecodeSegment(parts[1])
+}
+
+// parseWithKeySet parses the token into claims after WithOIDCKeySet verified
+// its signature, and validates the registered claims like
+// jwt.ParseWithClaims does
+func (v *Verifier) parseWithKeySet(ctx context.Context, tokenString string, claims *tokenClaims) (*jwt.Token, error) {
+	payload, err := v.keySet.VerifySignature(ctx, tokenString)
+	if err != nil {
+		return nil, NewValidationError(ErrInvalidSignature, err.Error())
+	}
+
+	// Use the verified payload, not the one decoded by ParseUnverified
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAlgorithm(token, v.allowedAlgs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+
+	if _, ok := v.issuers[claims.Issuer]; !ok {
+		return nil, newClaimError(ErrInvalidIssuer, fmt.Sprintf("untrusted issuer %q", claims.Issuer), map[string]any{"iss": claims.Issuer})
+	}
+
+	if err := jwt.NewValidator(v.jwtParserOptions()...).Validate(claims); err != nil {
+		return nil, err
+	}
+
+	token.Claims = claims
+	token.Valid = true
+	return token, nil
+}
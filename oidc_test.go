@@ -0,0 +1,158 @@
+package ghaauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+// stubKeySet is an OIDCKeySet that counts its calls
+type stubKeySet struct {
+	next  OIDCKeySet
+	calls int
+}
+
+func (s *stubKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	s.calls++
+	if s.next == nil {
+		return nil, errors.New("signature mismatch")
+	}
+	return s.next.VerifySignature(ctx, jwt)
+}
+
+func TestVerifier_OIDCKeySet(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(WithJWKSURL(server.URL() + "/.well-known/jwks"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	payload, err := verifier.OIDCKeySet().VerifySignature(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifySignature() error = %v", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if claims["repository"] != "myorg/myrepo" {
+		t.Errorf("payload repository = %v, want myorg/myrepo", claims["repository"])
+	}
+
+	other, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	forged, err := other.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	if _, err := verifier.OIDCKeySet().VerifySignature(context.Background(), forged); err == nil {
+		t.Error("VerifySignature() error = nil for a token signed with another key")
+	}
+}
+
+func TestWithOIDCKeySet(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	// The key set of one verifier stands in for go-oidc's RemoteKeySet
+	remote, err := New(WithJWKSURL(server.URL() + "/.well-known/jwks"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		keySet   *stubKeySet
+		mutate   func(*testutil.TokenClaims)
+		wantCode ErrorCode
+	}{
+		{
+			name:   "valid token",
+			keySet: &stubKeySet{next: remote.OIDCKeySet()},
+		},
+		{
+			name:     "invalid signature",
+			keySet:   &stubKeySet{},
+			wantCode: CodeInvalidSignature,
+		},
+		{
+			name:     "expired token",
+			keySet:   &stubKeySet{next: remote.OIDCKeySet()},
+			mutate:   func(c *testutil.TokenClaims) { c.ExpiresAt = time.Now().Add(-time.Minute) },
+			wantCode: CodeTokenExpired,
+		},
+		{
+			name:     "policy still applies",
+			keySet:   &stubKeySet{next: remote.OIDCKeySet()},
+			mutate:   func(c *testutil.TokenClaims) { c.RepositoryOwner = "otherorg" },
+			wantCode: CodePolicyDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := New(
+				WithOIDCKeySet(tt.keySet),
+				WithJWKSURL("http://127.0.0.1:0/unused"),
+				WithPolicy(&Policy{
+					Rules:       []Rule{{Name: "allow-myorg", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}},
+					DefaultDeny: true,
+				}),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			claims := testutil.DefaultClaims()
+			if tt.mutate != nil {
+				tt.mutate(claims)
+			}
+			token, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			result, err := verifier.Verify(context.Background(), token)
+			if tt.keySet.calls != 1 {
+				t.Errorf("VerifySignature() called %d times, want 1", tt.keySet.calls)
+			}
+			if tt.wantCode != "" {
+				if code := ErrorCodeOf(err); code != tt.wantCode {
+					t.Errorf("Verify() error code = %q, want %q (error: %v)", code, tt.wantCode, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if result.Token.KeyID != gen.KeyID() {
+				t.Errorf("Token.KeyID = %q, want %q", result.Token.KeyID, gen.KeyID())
+			}
+			if !verifier.Healthy() {
+				t.Error("Healthy() = false, want true with a key set")
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package ghaauth
 import (
 	"net/http"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // Option is a functional option for configuring the Verifier
@@ -11,7 +13,45 @@ type Option func(*Verifier)
 // WithPolicy sets the policy to use for access control
 func WithPolicy(policy *Policy) Option {
 	return func(v *Verifier) {
-		v.policy = policy
+		v.policy.Store(policy)
+	}
+}
+
+// WithPolicyProvider sets a provider that supplies the policy for each
+// verification, e.g. a FilePolicyProvider that reloads on change
+func WithPolicyProvider(provider PolicyProvider) Option {
+	return func(v *Verifier) {
+		v.policyProvider = provider
+	}
+}
+
+// WithPolicyMatchCache memoizes the results of the wildcard and regular
+// expression patterns of the verifier's policies in LRU caches of up to
+// size entries each (see WithMatchCache). The cache of a policy is dropped
+// when a PolicyProvider replaces the policy.
+func WithPolicyMatchCache(size int) Option {
+	return func(v *Verifier) {
+		v.compileOpts = append(v.compileOpts, WithMatchCache(size))
+	}
+}
+
+// WithStrictPolicies refuses policies that allow tokens matching no rule,
+// so that a forgotten DefaultDeny cannot open access. New and UpdatePolicy
+// reject such policies, and verifications whose policy comes from a
+// PolicyProvider or WithPolicyOverride, or that have no policy at all, are
+// denied. The shadow policy is exempt, as it never decides access.
+func WithStrictPolicies() Option {
+	return func(v *Verifier) {
+		v.strictPolicies = true
+	}
+}
+
+// WithRequirePolicy makes New fail unless a policy is configured with
+// WithPolicy or WithPolicyProvider, or every trusted issuer has its own,
+// instead of allowing every verified token
+func WithRequirePolicy() Option {
+	return func(v *Verifier) {
+		v.requirePolicy = true
 	}
 }
 
@@ -29,20 +69,146 @@ func WithJWKSURL(url string) Option {
 	}
 }
 
-// WithJWKSCacheDuration sets how long to cache JWKS
+// WithJWKSCacheDuration sets how long to cache JWKS when the endpoint sends
+// no Cache-Control max-age
 func WithJWKSCacheDuration(duration time.Duration) Option {
 	return func(v *Verifier) {
 		v.jwksCacheDuration = duration
 	}
 }
 
-// WithHTTPClient sets a custom HTTP client for JWKS fetching
+// WithJWKSMinRefreshInterval sets how old cached keys must be before a
+// token with an unknown key ID triggers a JWKS refresh (default
+// DefaultMinRefreshInterval). Tests rotating keys can set it to 0.
+func WithJWKSMinRefreshInterval(interval time.Duration) Option {
+	return func(v *Verifier) {
+		v.jwksMinRefresh = interval
+	}
+}
+
+// WithHTTPClient sets a custom HTTP client for JWKS fetching. Its
+// transport defaults to http.DefaultTransport, which honors the proxy
+// environment variables; see WithTransport, WithProxy and
+// WithClientCertificate to configure it.
 func WithHTTPClient(client *http.Client) Option {
 	return func(v *Verifier) {
 		v.httpClient = client
 	}
 }
 
+// DefaultVerifyTimeout bounds each verification unless WithVerifyTimeout
+// says otherwise
+const DefaultVerifyTimeout = 5 * time.Second
+
+// WithVerifyTimeout bounds the time a verification may take, including
+// fetching keys from the JWKS endpoint and retrying, so that a hung
+// endpoint cannot stall request handling. A shorter deadline or a
+// cancellation of the context passed to Verify still applies. A timeout of
+// 0 disables the bound.
+func WithVerifyTimeout(timeout time.Duration) Option {
+	return func(v *Verifier) {
+		v.verifyTimeout = timeout
+	}
+}
+
+// WithMaxTokenAge rejects tokens issued longer ago than maxAge, even if
+// they have not expired, limiting the replay window independently of the
+// token lifetime chosen by GitHub. Tokens without an iat claim are rejected.
+func WithMaxTokenAge(maxAge time.Duration) Option {
+	return func(v *Verifier) {
+		v.maxTokenAge = maxAge
+	}
+}
+
+// DefaultMaxTokenLifetime is the longest lifetime (exp - iat) accepted
+// unless WithMaxTokenLifetime says otherwise. GitHub issues tokens valid
+// for a few minutes, so a longer lifetime suggests a token from elsewhere.
+const DefaultMaxTokenLifetime = 15 * time.Minute
+
+// WithMaxTokenLifetime rejects tokens whose exp is more than maxLifetime
+// after their iat, replacing DefaultMaxTokenLifetime; 0 disables the
+// check, e.g. for CI providers issuing hour-long tokens. Tokens without
+// iat or exp are not checked.
+func WithMaxTokenLifetime(maxLifetime time.Duration) Option {
+	return func(v *Verifier) {
+		v.maxTokenLifetime = maxLifetime
+	}
+}
+
+// WithRequiredClaims makes verification fail when any of the named claims
+// is absent or empty, e.g. to only accept environment-scoped tokens with
+// WithRequiredClaims("environment"). Custom claims in Extra can be named too.
+func WithRequiredClaims(names ...string) Option {
+	return func(v *Verifier) {
+		v.requiredClaims = append(v.requiredClaims, names...)
+	}
+}
+
+// WithClaimRequirements replaces DefaultRequiredClaims(), the claims every
+// GitHub token must carry, with names, e.g. to accept tokens of events that
+// omit the actor. Without names no claim is required. WithRequiredClaims
+// adds to the requirements either way.
+func WithClaimRequirements(names ...string) Option {
+	return func(v *Verifier) {
+		v.claimRequirements = append([]string(nil), names...)
+	}
+}
+
+// WithClaimConsistency makes verification fail for tokens whose claims
+// disagree with each other (see GitHubActionsClaims.ValidateConsistency),
+// e.g. a repository outside repository_owner or a sub naming another ref.
+// It applies to GitHub tokens, not to those of claim mappers.
+func WithClaimConsistency() Option {
+	return func(v *Verifier) {
+		v.claimConsistency = true
+	}
+}
+
+// WithParserOptions passes options to the jwt.Parser that parses tokens,
+// e.g. jwt.WithLeeway for clock skew or jwt.WithJSONNumber. They are
+// applied after the verifier's own, so jwt.WithTimeFunc overrides
+// WithClock; jwt.WithValidMethods can only narrow WithAllowedAlgorithms.
+// The audience is checked by the verifier (see WithAudience) regardless
+// of jwt.WithAudience. With WithOIDCKeySet, only the options for
+// validating the claims apply.
+func WithParserOptions(opts ...jwt.ParserOption) Option {
+	return func(v *Verifier) {
+		v.parserOptions = append(v.parserOptions, opts...)
+	}
+}
+
+// VerifyOption overrides a verifier setting for a single VerifyWith call
+type VerifyOption func(*verifyConfig)
+
+// verifyConfig holds the settings of a single verification
+type verifyConfig struct {
+	audience         string
+	audienceTemplate *audienceTemplate
+	nonce            string
+	policy           *CompiledPolicy
+	dpop             *dpopProof
+	dpopErr          error
+}
+
+// WithExpectedAudience overrides the audience set with WithAudience or
+// WithAudienceTemplate
+func WithExpectedAudience(audience string) VerifyOption {
+	return func(c *verifyConfig) {
+		c.audience = audience
+		c.audienceTemplate = nil
+	}
+}
+
+// WithPolicyOverride evaluates the token against policy instead of the
+// verifier's and the issuer's policies. Tokens of other CI providers,
+// mapped by a ClaimMapper, must pass their issuer's policy as well. Compile
+// the policy once and reuse it across calls.
+func WithPolicyOverride(policy *CompiledPolicy) VerifyOption {
+	return func(c *verifyConfig) {
+		c.policy = policy
+	}
+}
+
 // WithClock sets a custom clock for time-based validation (mainly for testing)
 func WithClock(clock Clock) Option {
 	return func(v *Verifier) {
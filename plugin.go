@@ -0,0 +1,68 @@
+package ghaauth
+
+import "sync"
+
+// ConditionPlugin implements custom condition logic for the plugin
+// condition of policy rules. It reports whether the claims satisfy the
+// condition. The wasm package loads plugins from WebAssembly modules, so
+// that custom logic can be shipped without rebuilding the service.
+type ConditionPlugin func(claims *GitHubActionsClaims) (bool, error)
+
+// conditionPlugins holds the plugins registered by name
+var conditionPlugins = struct {
+	sync.RWMutex
+	plugins map[string]ConditionPlugin
+}{plugins: make(map[string]ConditionPlugin)}
+
+// RegisterConditionPlugin makes a plugin available to the plugin condition
+// of every policy under name, replacing any plugin registered before.
+// Plugins may be called concurrently. Policies can reference a plugin
+// before it is registered; until then the condition is treated as failed.
+func RegisterConditionPlugin(name string, plugin ConditionPlugin) {
+	conditionPlugins.Lock()
+	defer conditionPlugins.Unlock()
+
+	conditionPlugins.plugins[name] = plugin
+}
+
+// UnregisterConditionPlugin removes the plugin registered under name
+func UnregisterConditionPlugin(name string) {
+	conditionPlugins.Lock()
+	defer conditionPlugins.Unlock()
+
+	delete(conditionPlugins.plugins, name)
+}
+
+// lookupConditionPlugin returns the plugin registered under name
+func lookupConditionPlugin(name string) (ConditionPlugin, bool) {
+	conditionPlugins.RLock()
+	defer conditionPlugins.RUnlock()
+
+	plugin, ok := conditionPlugins.plugins[name]
+	return plugin, ok
+}
+
+// pluginMismatch returns "plugin" if a plugin of the rule rejects the
+// claims, or "" if all accept them. A plugin that is not registered or
+// returns an error fails closed: it never lets an allow rule match, and
+// always lets a deny rule match.
+func pluginMismatch(rule Rule, claims *GitHubActionsClaims) string {
+	for _, name := range rule.Conditions.Plugin {
+		plugin, ok := lookupConditionPlugin(name)
+		if !ok {
+			if rule.Effect == EffectDeny {
+				continue
+			}
+			return "plugin"
+		}
+
+		matched, err := plugin(claims)
+		if err != nil {
+			matched = rule.Effect == EffectDeny
+		}
+		if !matched {
+			return "plugin"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package ghaauth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConditionPlugin(t *testing.T) {
+	RegisterConditionPlugin("test-even-run", func(claims *GitHubActionsClaims) (bool, error) {
+		return strings.HasSuffix(claims.RunID, "0") || strings.HasSuffix(claims.RunID, "2"), nil
+	})
+	RegisterConditionPlugin("test-failing", func(*GitHubActionsClaims) (bool, error) {
+		return false, errors.New("plugin crashed")
+	})
+	defer UnregisterConditionPlugin("test-even-run")
+	defer UnregisterConditionPlugin("test-failing")
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		runID   string
+		allowed bool
+	}{
+		{name: "plugin accepts", rule: Rule{Conditions: Conditions{Repository: []string{"myorg/*"}, Plugin: []string{"test-even-run"}}, Effect: EffectAllow}, runID: "12", allowed: true},
+		{name: "plugin rejects", rule: Rule{Conditions: Conditions{Repository: []string{"myorg/*"}, Plugin: []string{"test-even-run"}}, Effect: EffectAllow}, runID: "13", allowed: false},
+		{name: "failing plugin does not allow", rule: Rule{Conditions: Conditions{Plugin: []string{"test-failing"}}, Effect: EffectAllow}, runID: "12", allowed: false},
+		{name: "failing plugin denies", rule: Rule{Conditions: Conditions{Plugin: []string{"test-failing"}}, Effect: EffectDeny}, runID: "12", allowed: false},
+		{name: "unregistered plugin does not allow", rule: Rule{Conditions: Conditions{Plugin: []string{"test-missing"}}, Effect: EffectAllow}, runID: "12", allowed: false},
+		{name: "unregistered plugin denies", rule: Rule{Conditions: Conditions{Plugin: []string{"test-missing"}}, Effect: EffectDeny}, runID: "12", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &Policy{Rules: []Rule{tt.rule, {Conditions: Conditions{Repository: []string{"**"}}, Effect: EffectAllow}}}
+			if tt.rule.Effect == EffectAllow {
+				policy.Rules = policy.Rules[:1]
+				policy.DefaultDeny = true
+			}
+			if err := policy.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			claims := &GitHubActionsClaims{Repository: "myorg/myrepo", RunID: tt.runID}
+			if got := policy.Evaluate(claims).Allowed; got != tt.allowed {
+				t.Errorf("Evaluate().Allowed = %v, want %v", got, tt.allowed)
+			}
+			if got := policy.Compile().Evaluate(claims).Allowed; got != tt.allowed {
+				t.Errorf("compiled Evaluate().Allowed = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+
+	invalid := &Policy{Rules: []Rule{{Conditions: Conditions{Plugin: []string{""}}, Effect: EffectAllow}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Validate() error = nil for an empty plugin name")
+	}
+
+	policy := &Policy{Rules: []Rule{{Conditions: Conditions{Repository: []string{"myorg/*"}, Plugin: []string{"test-even-run"}}, Effect: EffectAllow}}}
+	if _, _, err := policy.ExportAWSTrustPolicy(AWSExportOptions{}); err == nil {
+		t.Error("ExportAWSTrustPolicy() error = nil for a plugin condition")
+	}
+}
@@ -1,5 +1,13 @@
 package ghaauth
 
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
 // Effect represents the effect of a policy rule
 type Effect string
 
@@ -11,6 +19,34 @@ const (
 	EffectDeny Effect = "deny"
 )
 
+// EvaluationMode selects how matching rules are combined into a decision
+type EvaluationMode string
+
+const (
+	// EvaluationFirstMatch lets the first matching rule decide (default)
+	EvaluationFirstMatch EvaluationMode = "first-match"
+
+	// EvaluationDenyOverrides denies if any matching rule denies, and
+	// otherwise allows if any matching rule allows
+	EvaluationDenyOverrides EvaluationMode = "deny-overrides"
+
+	// EvaluationAllowOverrides allows if any matching rule allows, and
+	// otherwise denies if any matching rule denies
+	EvaluationAllowOverrides EvaluationMode = "allow-overrides"
+)
+
+// PolicyMode states what happens to tokens that match no rule
+type PolicyMode string
+
+const (
+	// PolicyModeDefaultDeny denies tokens that match no rule
+	PolicyModeDefaultDeny PolicyMode = "enforce-default-deny"
+
+	// PolicyModeDefaultAllow allows tokens that match no rule. It is
+	// refused by WithStrictPolicies.
+	PolicyModeDefaultAllow PolicyMode = "default-allow"
+)
+
 // Conditions defines the conditions that must be met for a rule to match
 type Conditions struct {
 	// Repository patterns (e.g., "myorg/*", "myorg/myrepo")
@@ -28,9 +64,25 @@ type Conditions struct {
 	// RefType values (e.g., "branch", "tag")
 	RefType []string `json:"ref_type,omitempty"`
 
+	// HeadRef patterns for the source branch of a pull request (e.g., "feature/*")
+	HeadRef []string `json:"head_ref,omitempty"`
+
+	// BaseRef patterns for the target branch of a pull request (e.g., "main")
+	BaseRef []string `json:"base_ref,omitempty"`
+
 	// Workflow patterns (e.g., "CI", "Deploy*")
 	Workflow []string `json:"workflow,omitempty"`
 
+	// WorkflowRef patterns (e.g., "myorg/myrepo/.github/workflows/deploy.yml@refs/heads/main")
+	WorkflowRef []string `json:"workflow_ref,omitempty"`
+
+	// JobWorkflowRef patterns for the reusable workflow that ran the job
+	// (e.g., "myorg/workflows/.github/workflows/deploy.yml@refs/tags/v*")
+	JobWorkflowRef []string `json:"job_workflow_ref,omitempty"`
+
+	// JobWorkflowSHA values for the commit of the reusable workflow
+	JobWorkflowSHA []string `json:"job_workflow_sha,omitempty"`
+
 	// EventName values (e.g., "push", "pull_request", "workflow_dispatch")
 	EventName []string `json:"event_name,omitempty"`
 
@@ -39,6 +91,89 @@ type Conditions struct {
 
 	// Environment patterns (e.g., "production", "staging")
 	Environment []string `json:"environment,omitempty"`
+
+	// RunnerEnvironment values ("github-hosted" or "self-hosted")
+	RunnerEnvironment []string `json:"runner_environment,omitempty"`
+
+	// RepositoryTopic patterns, of which any repository topic must match
+	// one (e.g., "deployable"); requires a GitHubEnricher
+	RepositoryTopic []string `json:"repository_topic,omitempty"`
+
+	// CustomProperties maps repository custom property names to patterns,
+	// one of which a value of the property must match (e.g., "team":
+	// ["platform"]); every listed property must match. Requires a
+	// GitHubEnricher with WithCustomProperties.
+	CustomProperties map[string][]string `json:"custom_properties,omitempty"`
+
+	// Inputs maps workflow_dispatch input names to patterns (e.g., "target":
+	// ["staging"]); every listed input must be in the token's inputs claim
+	// with a value matching one of its patterns
+	Inputs map[string][]string `json:"inputs,omitempty"`
+
+	// Plugin names registered condition plugins, all of which must accept
+	// the claims (see RegisterConditionPlugin)
+	Plugin []string `json:"plugin,omitempty"`
+
+	// RunAttemptMin and RunAttemptMax bound run_attempt (0 means unbounded);
+	// RunAttemptMax 1 rejects re-runs
+	RunAttemptMin int `json:"run_attempt_min,omitempty"`
+	RunAttemptMax int `json:"run_attempt_max,omitempty"`
+
+	// RunNumberMin and RunNumberMax bound run_number (0 means unbounded)
+	RunNumberMin int `json:"run_number_min,omitempty"`
+	RunNumberMax int `json:"run_number_max,omitempty"`
+}
+
+// validateBounds checks that numeric bounds are non-negative and ordered
+func validateBounds(cond Conditions) error {
+	for _, b := range []struct {
+		name     string
+		min, max int
+	}{
+		{"run_attempt", cond.RunAttemptMin, cond.RunAttemptMax},
+		{"run_number", cond.RunNumberMin, cond.RunNumberMax},
+	} {
+		if b.min < 0 || b.max < 0 {
+			return fmt.Errorf("%s bounds must not be negative", b.name)
+		}
+		if b.max != 0 && b.min > b.max {
+			return fmt.Errorf("%s_min must not exceed %s_max", b.name, b.name)
+		}
+	}
+	return nil
+}
+
+// numericMismatch returns the name of the first numeric bound the claims
+// do not satisfy, or "" if all are satisfied. A missing or non-numeric
+// claim fails any bound.
+func numericMismatch(cond Conditions, claims *GitHubActionsClaims) string {
+	bounds := []struct {
+		name     string
+		min, max int
+		claim    string
+	}{
+		{"run_attempt", cond.RunAttemptMin, cond.RunAttemptMax, claims.RunAttempt},
+		{"run_number", cond.RunNumberMin, cond.RunNumberMax, claims.RunNumber},
+	}
+
+	for _, b := range bounds {
+		if b.min == 0 && b.max == 0 {
+			continue
+		}
+
+		n, err := strconv.Atoi(b.claim)
+		if err != nil {
+			return b.name
+		}
+		if b.min != 0 && n < b.min {
+			return b.name + "_min"
+		}
+		if b.max != 0 && n > b.max {
+			return b.name + "_max"
+		}
+	}
+
+	return ""
 }
 
 // Rule represents a single policy rule
@@ -51,16 +186,102 @@ type Rule struct {
 
 	// Effect specifies whether to allow or deny when conditions match
 	Effect Effect `json:"effect"`
+
+	// Priority orders rules before evaluation; higher priorities are
+	// evaluated first and rules with equal priority keep their order
+	Priority int `json:"priority,omitempty"`
+
+	// Use names condition sets from Policy.ConditionSets to merge into
+	// Conditions; conditions the rule gives replace the sets' (see
+	// ExpandConditionSets)
+	Use []string `json:"use,omitempty"`
+
+	// ValidFrom and ValidUntil limit the rule to a time window, e.g. a
+	// break-glass allow rule that expires or a deploy freeze deny rule.
+	// Outside the window the rule matches no token. The window includes
+	// ValidFrom and excludes ValidUntil.
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+
+	// Tags label the rule, e.g. with the services or uses it applies to,
+	// so that a shared policy can be sliced with Filter or WithPolicyTags
+	Tags []string `json:"tags,omitempty"`
+}
+
+// ActiveAt reports whether t is within the rule's ValidFrom and ValidUntil
+// window
+func (r Rule) ActiveAt(t time.Time) bool {
+	return r.inactive(t) == ""
+}
+
+// inactive returns "valid_from" or "valid_until" if t is before or after
+// the rule's window, or "" if the rule is active
+func (r Rule) inactive(t time.Time) string {
+	switch {
+	case r.ValidFrom != nil && t.Before(*r.ValidFrom):
+		return "valid_from"
+	case r.ValidUntil != nil && !t.Before(*r.ValidUntil):
+		return "valid_until"
+	}
+	return ""
+}
+
+// hasWindow reports whether the rule is limited to a time window
+func (r Rule) hasWindow() bool {
+	return r.ValidFrom != nil || r.ValidUntil != nil
+}
+
+// PolicyMetadata describes a revision of a policy document. Its Version is
+// reported in every EvaluationResult, denial and decision, so that audits
+// can tie a decision to the policy revision that made it.
+type PolicyMetadata struct {
+	// Version identifies the revision, e.g. a release tag or commit SHA
+	Version string `json:"version,omitempty"`
+
+	// Description summarizes the policy or the revision
+	Description string `json:"description,omitempty"`
+
+	// Owner is the team or person responsible for the policy
+	Owner string `json:"owner,omitempty"`
+
+	// UpdatedAt is when the revision was made
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
 
 // Policy defines the access control policy
 type Policy struct {
+	// Metadata describes the policy revision
+	Metadata *PolicyMetadata `json:"metadata,omitempty"`
+
 	// Rules to evaluate in order
 	Rules []Rule `json:"rules"`
 
 	// DefaultDeny specifies whether to deny access if no rules match
 	// If false, unmatched requests are allowed (not recommended)
 	DefaultDeny bool `json:"default_deny"`
+
+	// Mode states what happens to tokens that match no rule, overriding
+	// DefaultDeny. Setting it makes the choice explicit, so that a
+	// forgotten DefaultDeny cannot silently allow everything.
+	Mode PolicyMode `json:"mode,omitempty"`
+
+	// EvaluationMode selects how matching rules are combined
+	// Defaults to EvaluationFirstMatch
+	EvaluationMode EvaluationMode `json:"evaluation_mode,omitempty"`
+
+	// ConditionSets are named conditions that rules can reference with Use
+	ConditionSets map[string]Conditions `json:"condition_sets,omitempty"`
+
+	// DenyForkPullRequests denies tokens that may come from a fork pull
+	// request (see GitHubActionsClaims.IsPullRequestFromFork) before any
+	// rule is evaluated
+	DenyForkPullRequests bool `json:"deny_fork_pull_requests,omitempty"`
+
+	// RequireEnvironmentScopedToken denies tokens that are not
+	// environment-scoped (see GitHubActionsClaims.IsEnvironmentScoped)
+	// before any rule is evaluated, so that only jobs that passed their
+	// environment's protection rules, where configured, are allowed
+	RequireEnvironmentScopedToken bool `json:"require_environment_scoped_token,omitempty"`
 }
 
 // EvaluationResult contains the result of policy evaluation
@@ -73,10 +294,34 @@ type EvaluationResult struct {
 
 	// Reason provides additional context about the decision
 	Reason string
+
+	// PolicyVersion is the Metadata.Version of the evaluated policy
+	PolicyVersion string
+
+	// decidedBy is the index of the deciding rule plus one, 0 if none
+	decidedBy int
+
+	// precondition is the setting that denied the claims before any rule
+	// was evaluated, e.g. "deny_fork_pull_requests"
+	precondition string
 }
 
-// Evaluate evaluates the policy against the given claims
+// Evaluate evaluates the policy against the given claims at the current
+// time
 func (p *Policy) Evaluate(claims *GitHubActionsClaims) *EvaluationResult {
+	return p.EvaluateAt(claims, time.Now())
+}
+
+// EvaluateAt evaluates the policy against the given claims as of now,
+// which decides the rules whose ValidFrom and ValidUntil window is active
+func (p *Policy) EvaluateAt(claims *GitHubActionsClaims, now time.Time) *EvaluationResult {
+	result := p.evaluate(claims, now)
+	result.PolicyVersion = p.Version()
+	return result
+}
+
+// evaluate is EvaluateAt without the policy version
+func (p *Policy) evaluate(claims *GitHubActionsClaims, now time.Time) *EvaluationResult {
 	if p == nil {
 		return &EvaluationResult{
 			Allowed: true,
@@ -84,26 +329,136 @@ func (p *Policy) Evaluate(claims *GitHubActionsClaims) *EvaluationResult {
 		}
 	}
 
-	// Evaluate each rule in order
-	for _, rule := range p.Rules {
-		if p.matchesRule(rule, claims) {
-			allowed := rule.Effect == EffectAllow
+	if p.deniesFork(claims) {
+		return forkResult()
+	}
+	if p.deniesUnscoped(claims) {
+		return environmentScopeResult()
+	}
 
-			reason := "default"
-			if rule.Name != "" {
-				reason = "rule: " + rule.Name
-			}
+	i := p.decide(p.ruleOrder(), func(i int) bool {
+		return p.matchesRule(p.Rules[i], claims, now)
+	})
+	if i < 0 {
+		return p.defaultResult()
+	}
 
-			return &EvaluationResult{
-				Allowed:     allowed,
-				MatchedRule: rule.Name,
-				Reason:      reason,
-			}
+	return ruleResult(p.Rules[i], i)
+}
+
+// EvaluateAll returns every rule matching the claims at the current time,
+// in evaluation order, for tooling that needs more than the deciding rule,
+// e.g. to find overlapping rules or aggregate the grants of all matching
+// rules. Unlike Evaluate, it ignores the evaluation mode, the default
+// decision, DenyForkPullRequests and RequireEnvironmentScopedToken, so a
+// token may match rules that Evaluate would never reach.
+func (p *Policy) EvaluateAll(claims *GitHubActionsClaims) []Rule {
+	return p.EvaluateAllAt(claims, time.Now())
+}
+
+// EvaluateAllAt is EvaluateAll as of now (see EvaluateAt)
+func (p *Policy) EvaluateAllAt(claims *GitHubActionsClaims, now time.Time) []Rule {
+	if p == nil {
+		return nil
+	}
+
+	var matched []Rule
+	for _, i := range p.ruleOrder() {
+		if p.matchesRule(p.Rules[i], claims, now) {
+			matched = append(matched, p.Rules[i])
 		}
 	}
+	return matched
+}
+
+// ruleOrder returns the rule indexes in evaluation order: by descending
+// priority, keeping the declared order for equal priorities
+func (p *Policy) ruleOrder() []int {
+	order := make([]int, len(p.Rules))
+	for i := range order {
+		order[i] = i
+	}
 
-	// No rule matched - apply default
-	if p.DefaultDeny {
+	sort.SliceStable(order, func(a, b int) bool {
+		return p.Rules[order[a]].Priority > p.Rules[order[b]].Priority
+	})
+	return order
+}
+
+// decide returns the index of the rule that decides the evaluation
+// according to the evaluation mode, or -1 if no rule matches
+func (p *Policy) decide(order []int, matches func(i int) bool) int {
+	var overriding Effect
+	switch p.EvaluationMode {
+	case EvaluationDenyOverrides:
+		overriding = EffectDeny
+	case EvaluationAllowOverrides:
+		overriding = EffectAllow
+	}
+
+	first := -1
+	for _, i := range order {
+		if !matches(i) {
+			continue
+		}
+		if overriding == "" || p.Rules[i].Effect == overriding {
+			return i
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+
+	return first
+}
+
+// ruleResult is the evaluation result when the rule at index i decides
+func ruleResult(rule Rule, i int) *EvaluationResult {
+	return ruleResultWithReason(rule, i, ruleReason(rule))
+}
+
+// ruleResultWithReason is ruleResult with the reason computed in advance
+func ruleResultWithReason(rule Rule, i int, reason string) *EvaluationResult {
+	return &EvaluationResult{
+		Allowed:     rule.Effect == EffectAllow,
+		MatchedRule: rule.Name,
+		Reason:      reason,
+		decidedBy:   i + 1,
+	}
+}
+
+// ruleReason is the reason given when a rule matches
+func ruleReason(rule Rule) string {
+	if rule.Name == "" {
+		return "default"
+	}
+	return "rule: " + rule.Name
+}
+
+// Version returns the policy's Metadata.Version, or "" if it has none
+func (p *Policy) Version() string {
+	if p == nil || p.Metadata == nil {
+		return ""
+	}
+	return p.Metadata.Version
+}
+
+// DeniesByDefault reports whether tokens that match no rule are denied:
+// by Mode if set, and otherwise by DefaultDeny. A nil policy allows
+// everything.
+func (p *Policy) DeniesByDefault() bool {
+	if p == nil {
+		return false
+	}
+	if p.Mode != "" {
+		return p.Mode == PolicyModeDefaultDeny
+	}
+	return p.DefaultDeny
+}
+
+// defaultResult is the evaluation result when no rule matches
+func (p *Policy) defaultResult() *EvaluationResult {
+	if p.DeniesByDefault() {
 		return &EvaluationResult{
 			Allowed: false,
 			Reason:  "default deny policy",
@@ -116,55 +471,105 @@ func (p *Policy) Evaluate(claims *GitHubActionsClaims) *EvaluationResult {
 	}
 }
 
-// matchesRule checks if claims match all conditions in a rule
-func (p *Policy) matchesRule(rule Rule, claims *GitHubActionsClaims) bool {
+// matchesRule checks if the rule is active at now and claims match all of
+// its conditions
+func (p *Policy) matchesRule(rule Rule, claims *GitHubActionsClaims, now time.Time) bool {
+	return rule.inactive(now) == "" && p.mismatch(rule, claims) == ""
+}
+
+// mismatch returns the name of the first condition of the rule that the
+// claims do not satisfy, or "" if all conditions match
+func (p *Policy) mismatch(rule Rule, claims *GitHubActionsClaims) string {
 	cond := rule.Conditions
 
 	// All specified conditions must match
 	if len(cond.Repository) > 0 && !MatchAny(cond.Repository, claims.Repository) {
-		return false
+		return "repository"
 	}
 
 	if len(cond.RepositoryOwner) > 0 && !MatchAny(cond.RepositoryOwner, claims.RepositoryOwner) {
-		return false
+		return "repository_owner"
 	}
 
 	if len(cond.RepositoryVisibility) > 0 && !MatchAny(cond.RepositoryVisibility, claims.RepositoryVisibility) {
-		return false
+		return "repository_visibility"
 	}
 
 	if len(cond.Ref) > 0 && !MatchAny(cond.Ref, claims.Ref) {
-		return false
+		return "ref"
 	}
 
 	if len(cond.RefType) > 0 && !MatchAny(cond.RefType, claims.RefType) {
-		return false
+		return "ref_type"
+	}
+
+	if len(cond.HeadRef) > 0 {
+		// HeadRef is only present for pull request events
+		if claims.HeadRef == "" || !MatchAny(cond.HeadRef, claims.HeadRef) {
+			return "head_ref"
+		}
+	}
+
+	if len(cond.BaseRef) > 0 {
+		// BaseRef is only present for pull request events
+		if claims.BaseRef == "" || !MatchAny(cond.BaseRef, claims.BaseRef) {
+			return "base_ref"
+		}
 	}
 
 	if len(cond.Workflow) > 0 && !MatchAny(cond.Workflow, claims.Workflow) {
-		return false
+		return "workflow"
+	}
+
+	if len(cond.WorkflowRef) > 0 && !MatchAny(cond.WorkflowRef, claims.WorkflowRef) {
+		return "workflow_ref"
+	}
+
+	if len(cond.JobWorkflowRef) > 0 && !MatchAny(cond.JobWorkflowRef, claims.JobWorkflowRef) {
+		return "job_workflow_ref"
+	}
+
+	if len(cond.JobWorkflowSHA) > 0 && !MatchAny(cond.JobWorkflowSHA, claims.JobWorkflowSHA) {
+		return "job_workflow_sha"
 	}
 
 	if len(cond.EventName) > 0 && !MatchAny(cond.EventName, claims.EventName) {
-		return false
+		return "event_name"
 	}
 
 	if len(cond.Actor) > 0 && !MatchAny(cond.Actor, claims.Actor) {
-		return false
+		return "actor"
 	}
 
 	if len(cond.Environment) > 0 {
 		// Environment is optional in claims, so empty matches nothing
 		if claims.Environment == "" {
-			return false
+			return "environment"
 		}
 		if !MatchAny(cond.Environment, claims.Environment) {
-			return false
+			return "environment"
 		}
 	}
 
+	if len(cond.RunnerEnvironment) > 0 && !MatchAny(cond.RunnerEnvironment, claims.RunnerEnvironment) {
+		return "runner_environment"
+	}
+
+	if name := numericMismatch(cond, claims); name != "" {
+		return name
+	}
+
+	if name := listMismatch(cond, claims); name != "" {
+		return name
+	}
+
+	// Plugins are the most expensive, so they run last
+	if name := pluginMismatch(rule, claims); name != "" {
+		return name
+	}
+
 	// All conditions matched
-	return true
+	return ""
 }
 
 // Validate checks if the policy is valid
@@ -177,27 +582,98 @@ func (p *Policy) Validate() error {
 		return NewPolicyError("", "policy must have at least one rule")
 	}
 
+	switch p.EvaluationMode {
+	case "", EvaluationFirstMatch, EvaluationDenyOverrides, EvaluationAllowOverrides:
+	default:
+		return NewPolicyError("", fmt.Sprintf("unknown evaluation mode %q", p.EvaluationMode))
+	}
+
+	switch p.Mode {
+	case "", PolicyModeDefaultDeny:
+	case PolicyModeDefaultAllow:
+		if p.DefaultDeny {
+			return NewPolicyError("", "mode default-allow contradicts default_deny")
+		}
+	default:
+		return NewPolicyError("", fmt.Sprintf("unknown policy mode %q", p.Mode))
+	}
+
 	for i, rule := range p.Rules {
 		if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
 			return NewPolicyError(rule.Name, "effect must be 'allow' or 'deny'")
 		}
 
+		if len(rule.Use) > 0 {
+			return NewPolicyError(rule.Name, "condition sets must be expanded with ExpandConditionSets")
+		}
+
+		if slices.Contains(rule.Tags, "") {
+			return NewPolicyError(rule.Name, "tags must not be empty")
+		}
+
 		// Check that at least one condition is specified
 		if len(rule.Conditions.Repository) == 0 &&
 			len(rule.Conditions.RepositoryOwner) == 0 &&
 			len(rule.Conditions.RepositoryVisibility) == 0 &&
 			len(rule.Conditions.Ref) == 0 &&
 			len(rule.Conditions.RefType) == 0 &&
+			len(rule.Conditions.HeadRef) == 0 &&
+			len(rule.Conditions.BaseRef) == 0 &&
 			len(rule.Conditions.Workflow) == 0 &&
+			len(rule.Conditions.WorkflowRef) == 0 &&
+			len(rule.Conditions.JobWorkflowRef) == 0 &&
+			len(rule.Conditions.JobWorkflowSHA) == 0 &&
 			len(rule.Conditions.EventName) == 0 &&
 			len(rule.Conditions.Actor) == 0 &&
-			len(rule.Conditions.Environment) == 0 {
+			len(rule.Conditions.Environment) == 0 &&
+			len(rule.Conditions.RunnerEnvironment) == 0 &&
+			len(rule.Conditions.RepositoryTopic) == 0 &&
+			len(rule.Conditions.CustomProperties) == 0 &&
+			len(rule.Conditions.Inputs) == 0 &&
+			len(rule.Conditions.Plugin) == 0 &&
+			rule.Conditions.RunAttemptMin == 0 &&
+			rule.Conditions.RunAttemptMax == 0 &&
+			rule.Conditions.RunNumberMin == 0 &&
+			rule.Conditions.RunNumberMax == 0 {
 			ruleName := rule.Name
 			if ruleName == "" {
 				ruleName = string(rune(i))
 			}
 			return NewPolicyError(ruleName, "rule must have at least one condition")
 		}
+
+		if err := validateBounds(rule.Conditions); err != nil {
+			return NewPolicyError(rule.Name, err.Error())
+		}
+
+		if rule.ValidFrom != nil && rule.ValidUntil != nil && !rule.ValidFrom.Before(*rule.ValidUntil) {
+			return NewPolicyError(rule.Name, "valid_from must be before valid_until")
+		}
+
+		for name, patterns := range rule.Conditions.CustomProperties {
+			if name == "" || len(patterns) == 0 {
+				return NewPolicyError(rule.Name, "custom_properties need a property name and at least one pattern")
+			}
+		}
+
+		for name, patterns := range rule.Conditions.Inputs {
+			if name == "" || len(patterns) == 0 {
+				return NewPolicyError(rule.Name, "inputs need an input name and at least one pattern")
+			}
+		}
+
+		if slices.Contains(rule.Conditions.Plugin, "") {
+			return NewPolicyError(rule.Name, "plugin names must not be empty")
+		}
+
+		// Patterns, including regular expressions, must compile
+		for _, patterns := range conditionPatterns(&rule.Conditions) {
+			for _, pattern := range patterns {
+				if err := ValidatePattern(pattern); err != nil {
+					return NewPolicyError(rule.Name, fmt.Sprintf("invalid pattern %q: %v", pattern, err))
+				}
+			}
+		}
 	}
 
 	return nil
@@ -0,0 +1,377 @@
+package ghaauth
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// FindingKind classifies a Finding of Policy.Analyze
+type FindingKind string
+
+const (
+	// FindingShadowedRule is a rule that never decides an evaluation
+	// because another rule matching every token it matches is evaluated
+	// first or overrides it
+	FindingShadowedRule FindingKind = "shadowed-rule"
+
+	// FindingConflictingRules is a rule with the same conditions as a rule
+	// of the opposite effect, only one of which ever takes effect
+	FindingConflictingRules FindingKind = "conflicting-rules"
+
+	// FindingContradictoryConditions is a rule whose conditions can never
+	// all be satisfied by the same token
+	FindingContradictoryConditions FindingKind = "contradictory-conditions"
+
+	// FindingBroadPattern is an allow rule with a pattern matching any
+	// value of its claim, e.g. repository "**"
+	FindingBroadPattern FindingKind = "broad-pattern"
+
+	// FindingOwnerOnly is a rule constraining only repository_owner in a
+	// policy that allows unmatched tokens
+	FindingOwnerOnly FindingKind = "owner-only"
+
+	// FindingUnconstrainedRef is an allow rule constraining neither the
+	// ref nor the environment, so that any branch, tag or pull request of
+	// the matched repositories is allowed
+	FindingUnconstrainedRef FindingKind = "unconstrained-ref"
+)
+
+// Severity ranks findings
+type Severity string
+
+const (
+	// SeverityError marks rules that do not work as written
+	SeverityError Severity = "error"
+
+	// SeverityWarning marks rules that work but are broader than they
+	// should be
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem found by Policy.Analyze
+type Finding struct {
+	// Kind classifies the problem
+	Kind FindingKind
+
+	// Severity ranks the problem
+	Severity Severity
+
+	// Rule is the rule the finding is about, by name or position
+	Rule string
+
+	// Related is the other rule involved, if any
+	Related string
+
+	// Message describes the problem
+	Message string
+}
+
+// String formats the finding for lint output
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", f.Severity, f.Rule, f.Message, f.Kind)
+}
+
+// Analyze statically checks a valid policy for rules that can never take
+// effect: rules shadowed by a broader rule evaluated first, rules
+// conflicting with an identical rule of the opposite effect, and rules
+// with contradictory conditions. These are reported as errors. The
+// analysis is conservative, so a policy without findings may still
+// contain such rules, e.g. when regular expressions are involved.
+//
+// Rules that are broader than they likely should be, such as allow rules
+// with wildcard-only patterns or without ref or environment constraints,
+// are reported as warnings. Findings are in rule order.
+func (p *Policy) Analyze() []Finding {
+	if p == nil {
+		return nil
+	}
+
+	order := p.ruleOrder()
+	position := make([]int, len(order))
+	for pos, i := range order {
+		position[i] = pos
+	}
+
+	// Rules that never match hide nothing
+	contradictions := make([]string, len(p.Rules))
+	for i, rule := range p.Rules {
+		contradictions[i] = contradiction(rule.Conditions)
+	}
+
+	var findings []Finding
+	for _, i := range order {
+		rule := p.Rules[i]
+		label := ruleLabel(rule, i)
+
+		if contradictions[i] != "" {
+			findings = append(findings, Finding{
+				Kind:     FindingContradictoryConditions,
+				Severity: SeverityError,
+				Rule:     label,
+				Message:  "conditions can never match: " + contradictions[i],
+			})
+			continue
+		}
+
+		for _, j := range order {
+			if i == j || contradictions[j] != "" || !p.hides(j, i, position) {
+				continue
+			}
+
+			other := p.Rules[j]
+			finding := Finding{Severity: SeverityError, Rule: label, Related: ruleLabel(other, j)}
+			if other.Effect != rule.Effect && reflect.DeepEqual(other.Conditions, rule.Conditions) {
+				finding.Kind = FindingConflictingRules
+				finding.Message = fmt.Sprintf("%s rule has the same conditions as %s rule %q and never takes effect",
+					rule.Effect, other.Effect, finding.Related)
+			} else {
+				finding.Kind = FindingShadowedRule
+				finding.Message = fmt.Sprintf("rule %q matches every token this rule matches and takes precedence",
+					finding.Related)
+			}
+			findings = append(findings, finding)
+			break
+		}
+
+		findings = append(findings, p.warnings(rule, label)...)
+	}
+
+	return findings
+}
+
+// broadPatterns are patterns matching any value of the claim, beyond "**"
+var broadPatterns = map[string][]string{
+	"repository":       {"*/*", "*/**"},
+	"repository_owner": {"*"},
+}
+
+// warnings returns the findings about a rule that is broader than it
+// likely should be
+func (p *Policy) warnings(rule Rule, label string) []Finding {
+	var findings []Finding
+	warn := func(kind FindingKind, format string, args ...any) {
+		findings = append(findings, Finding{
+			Kind:     kind,
+			Severity: SeverityWarning,
+			Rule:     label,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if rule.Effect == EffectAllow {
+		for _, cc := range conditionClaims {
+			for _, pattern := range cc.patterns(&rule.Conditions) {
+				if pattern == "**" || pattern == RegexPrefix+".*" || slices.Contains(broadPatterns[cc.name], pattern) {
+					warn(FindingBroadPattern, "%s pattern %q matches any %s", cc.name, pattern, cc.name)
+				}
+			}
+		}
+	}
+
+	if !p.DeniesByDefault() && onlyOwner(rule.Conditions) {
+		warn(FindingOwnerOnly, "rule only checks repository_owner and the policy allows tokens of other owners by default")
+	}
+
+	if rule.Effect == EffectAllow && len(rule.Conditions.Ref) == 0 && len(rule.Conditions.Environment) == 0 {
+		warn(FindingUnconstrainedRef, "allow rule constrains neither ref nor environment, so any branch, tag or pull request is allowed")
+	}
+
+	return findings
+}
+
+// onlyOwner reports whether repository_owner is the only condition
+func onlyOwner(cond Conditions) bool {
+	if len(cond.RepositoryOwner) == 0 || hasBounds(cond) || hasLists(cond) || len(cond.Plugin) > 0 {
+		return false
+	}
+	for _, cc := range conditionClaims {
+		if cc.name != "repository_owner" && len(cc.patterns(&cond)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hides reports whether rule j decides every evaluation rule i matches,
+// so that rule i never takes effect
+func (p *Policy) hides(j, i int, position []int) bool {
+	hider, rule := p.Rules[j], p.Rules[i]
+	if !covers(hider.Conditions, rule.Conditions) || !windowCovers(hider, rule) {
+		return false
+	}
+
+	var overriding Effect
+	switch p.EvaluationMode {
+	case EvaluationDenyOverrides:
+		overriding = EffectDeny
+	case EvaluationAllowOverrides:
+		overriding = EffectAllow
+	}
+
+	if overriding == "" || hider.Effect == rule.Effect {
+		// The first matching rule decides among rules of the same weight
+		return position[j] < position[i]
+	}
+	return hider.Effect == overriding
+}
+
+// windowCovers reports whether rule a is active whenever rule b is
+func windowCovers(a, b Rule) bool {
+	if a.ValidFrom != nil && (b.ValidFrom == nil || b.ValidFrom.Before(*a.ValidFrom)) {
+		return false
+	}
+	if a.ValidUntil != nil && (b.ValidUntil == nil || b.ValidUntil.After(*a.ValidUntil)) {
+		return false
+	}
+	return true
+}
+
+// covers reports whether every token matching b also matches a
+func covers(a, b Conditions) bool {
+	for _, cc := range conditionClaims {
+		if !patternsCover(cc.patterns(&a), cc.patterns(&b)) {
+			return false
+		}
+	}
+	for _, cl := range conditionLists {
+		if !patternsCover(cl.patterns(&a), cl.patterns(&b)) {
+			return false
+		}
+	}
+	for name, outer := range a.CustomProperties {
+		if !patternsCover(outer, b.CustomProperties[name]) {
+			return false
+		}
+	}
+	for name, outer := range a.Inputs {
+		if !patternsCover(outer, b.Inputs[name]) {
+			return false
+		}
+	}
+	for _, plugin := range a.Plugin {
+		if !slices.Contains(b.Plugin, plugin) {
+			return false
+		}
+	}
+
+	return boundCovers(a.RunAttemptMin, a.RunAttemptMax, b.RunAttemptMin, b.RunAttemptMax) &&
+		boundCovers(a.RunNumberMin, a.RunNumberMax, b.RunNumberMin, b.RunNumberMax)
+}
+
+// patternsCover reports whether every value matching one of the inner
+// patterns matches one of the outer ones; no outer patterns match anything
+func patternsCover(outer, inner []string) bool {
+	if len(outer) == 0 {
+		return true
+	}
+	if len(inner) == 0 {
+		return false
+	}
+	for _, pattern := range inner {
+		if !slices.ContainsFunc(outer, func(o string) bool { return patternCovers(o, pattern) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// patternCovers reports whether every value matching inner also matches
+// outer. Only cases that are easy to prove are recognized.
+func patternCovers(outer, inner string) bool {
+	if outer == inner || outer == "**" {
+		return true
+	}
+	if strings.HasPrefix(outer, RegexPrefix) || strings.HasPrefix(inner, RegexPrefix) {
+		return false
+	}
+
+	// A literal is covered by any pattern matching it
+	if !strings.ContainsAny(inner, patternMeta) {
+		return Match(outer, inner)
+	}
+
+	// Every value matching a glob starts with its literal prefix
+	if prefix, ok := strings.CutSuffix(outer, "**"); ok && !strings.ContainsAny(prefix, patternMeta) {
+		return strings.HasPrefix(literalPrefix(inner), prefix)
+	}
+	return false
+}
+
+// literalPrefix returns the part of a glob pattern before its first
+// metacharacter, which every matching value starts with
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, patternMeta); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// boundCovers reports whether the bounds [aMin, aMax] contain [bMin, bMax],
+// where 0 means unbounded
+func boundCovers(aMin, aMax, bMin, bMax int) bool {
+	minOK := aMin == 0 || (bMin != 0 && bMin >= aMin)
+	maxOK := aMax == 0 || (bMax != 0 && bMax <= aMax)
+	return minOK && maxOK
+}
+
+// contradiction returns why the conditions can never all match, or "" if
+// no contradiction is found
+func contradiction(cond Conditions) string {
+	// Refs must agree with the ref type
+	for _, rt := range []struct{ refType, prefix string }{
+		{"branch", "refs/tags/"},
+		{"tag", "refs/heads/"},
+	} {
+		if len(cond.RefType) > 0 && len(cond.Ref) > 0 &&
+			allLiteral(cond.RefType, func(v string) bool { return v == rt.refType }) &&
+			allPrefixed(cond.Ref, rt.prefix) {
+			return fmt.Sprintf("ref_type %s never has a ref under %s", rt.refType, rt.prefix)
+		}
+	}
+
+	// Repositories must belong to the owner
+	if len(cond.Repository) > 0 && len(cond.RepositoryOwner) > 0 {
+		owners := make([]string, 0, len(cond.Repository))
+		for _, pattern := range cond.Repository {
+			owner, _, found := strings.Cut(literalPrefix(pattern), "/")
+			if !found || strings.HasPrefix(pattern, RegexPrefix) {
+				return ""
+			}
+			owners = append(owners, owner)
+		}
+		if allLiteral(cond.RepositoryOwner, func(v string) bool { return !slices.Contains(owners, v) }) {
+			return "repository never belongs to repository_owner"
+		}
+	}
+
+	// Pull request refs are only present for pull request events
+	if (len(cond.HeadRef) > 0 || len(cond.BaseRef) > 0) && len(cond.EventName) > 0 &&
+		allLiteral(cond.EventName, func(v string) bool { return !pullRequestEvents[v] }) {
+		return "head_ref and base_ref are only present for pull request events"
+	}
+
+	return ""
+}
+
+// allLiteral reports whether every pattern is a literal for which ok holds
+func allLiteral(patterns []string, ok func(string) bool) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, RegexPrefix) || strings.ContainsAny(pattern, patternMeta) || !ok(pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// allPrefixed reports whether every value matching any of the glob
+// patterns starts with prefix
+func allPrefixed(patterns []string, prefix string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, RegexPrefix) || !strings.HasPrefix(literalPrefix(pattern), prefix) {
+			return false
+		}
+	}
+	return true
+}
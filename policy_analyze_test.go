@@ -0,0 +1,260 @@
+package ghaauth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPolicyAnalyze(t *testing.T) {
+	freezeStart := time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC)
+	freezeEnd := time.Date(2027, 1, 4, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		policy *Policy
+		want   []Finding
+	}{
+		{
+			name: "no findings",
+			policy: &Policy{
+				Rules: []Rule{
+					{Name: "deny-forks", Conditions: Conditions{HeadRef: []string{"**"}}, Effect: EffectDeny},
+					{Name: "allow-main", Conditions: Conditions{Repository: []string{"myorg/*"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow},
+					{Name: "allow-other", Conditions: Conditions{Repository: []string{"otherorg/api"}, Environment: []string{"production"}}, Effect: EffectAllow},
+				},
+				DefaultDeny: true,
+			},
+		},
+		{
+			name: "broader rule first",
+			policy: &Policy{
+				Rules: []Rule{
+					{Name: "allow-myorg", Conditions: Conditions{Repository: []string{"myorg/**"}, Ref: []string{"refs/heads/**"}}, Effect: EffectAllow},
+					{Name: "deny-legacy", Conditions: Conditions{Repository: []string{"myorg/legacy-*"}, Ref: []string{"refs/heads/*"}}, Effect: EffectDeny},
+				},
+			},
+			want: []Finding{{
+				Kind:     FindingShadowedRule,
+				Severity: SeverityError,
+				Rule:     "deny-legacy",
+				Related:  "allow-myorg",
+				Message:  `rule "allow-myorg" matches every token this rule matches and takes precedence`,
+			}},
+		},
+		{
+			name: "custom properties",
+			policy: &Policy{
+				Rules: []Rule{
+					{Name: "deny-sandbox", Conditions: Conditions{Ref: []string{"refs/heads/main"}, CustomProperties: map[string][]string{"tier": {"sandbox"}}}, Effect: EffectDeny},
+					{Name: "allow-platform", Conditions: Conditions{Ref: []string{"refs/heads/main"}, CustomProperties: map[string][]string{"team": {"platform"}}}, Effect: EffectAllow},
+					{Name: "allow-platform-prod", Conditions: Conditions{Ref: []string{"refs/heads/main"}, CustomProperties: map[string][]string{"team": {"platform"}, "tier": {"prod"}}}, Effect: EffectAllow},
+				},
+				DefaultDeny: true,
+			},
+			want: []Finding{{
+				Kind:     FindingShadowedRule,
+				Severity: SeverityError,
+				Rule:     "allow-platform-prod",
+				Related:  "allow-platform",
+				Message:  `rule "allow-platform" matches every token this rule matches and takes precedence`,
+			}},
+		},
+		{
+			name: "time-boxed rule",
+			policy: &Policy{
+				Rules: []Rule{
+					{Name: "deny-freeze", Conditions: Conditions{Repository: []string{"myorg/*"}, Ref: []string{"refs/heads/main"}}, Effect: EffectDeny, ValidFrom: &freezeStart, ValidUntil: &freezeEnd},
+					{Name: "allow-myorg", Conditions: Conditions{Repository: []string{"myorg/*"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow},
+					{Name: "allow-hotfix", Conditions: Conditions{Repository: []string{"myorg/api"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow, ValidFrom: &freezeStart, ValidUntil: &freezeEnd},
+				},
+				DefaultDeny: true,
+			},
+			want: []Finding{{
+				Kind:     FindingShadowedRule,
+				Severity: SeverityError,
+				Rule:     "allow-hotfix",
+				Related:  "deny-freeze",
+				Message:  `rule "deny-freeze" matches every token this rule matches and takes precedence`,
+			}},
+		},
+		{
+			name: "priority reorders rules",
+			policy: &Policy{
+				Rules: []Rule{
+					{Name: "allow-main", Conditions: Conditions{Ref: []string{"refs/heads/main"}}, Effect: EffectAllow},
+					{Name: "allow-branches", Conditions: Conditions{Ref: []string{"refs/heads/*"}}, Effect: EffectAllow, Priority: 10},
+				},
+			},
+			want: []Finding{{
+				Kind:     FindingShadowedRule,
+				Severity: SeverityError,
+				Rule:     "allow-main",
+				Related:  "allow-branches",
+				Message:  `rule "allow-branches" matches every token this rule matches and takes precedence`,
+			}},
+		},
+		{
+			name: "deny after identical allow",
+			policy: &Policy{
+				Rules: []Rule{
+					{Name: "allow-prod", Conditions: Conditions{Environment: []string{"production"}}, Effect: EffectAllow},
+					{Name: "deny-prod", Conditions: Conditions{Environment: []string{"production"}}, Effect: EffectDeny},
+				},
+			},
+			want: []Finding{{
+				Kind:     FindingConflictingRules,
+				Severity: SeverityError,
+				Rule:     "deny-prod",
+				Related:  "allow-prod",
+				Message:  `deny rule has the same conditions as allow rule "allow-prod" and never takes effect`,
+			}},
+		},
+		{
+			name: "deny overrides",
+			policy: &Policy{
+				Rules: []Rule{
+					{Name: "allow-prod", Conditions: Conditions{Environment: []string{"production"}}, Effect: EffectAllow},
+					{Name: "deny-all-envs", Conditions: Conditions{Environment: []string{"**"}}, Effect: EffectDeny},
+				},
+				EvaluationMode: EvaluationDenyOverrides,
+			},
+			want: []Finding{{
+				Kind:     FindingShadowedRule,
+				Severity: SeverityError,
+				Rule:     "allow-prod",
+				Related:  "deny-all-envs",
+				Message:  `rule "deny-all-envs" matches every token this rule matches and takes precedence`,
+			}},
+		},
+		{
+			name: "narrower bounds",
+			policy: &Policy{
+				Rules: []Rule{
+					{Conditions: Conditions{RunAttemptMax: 3}, Effect: EffectDeny},
+					{Conditions: Conditions{RunAttemptMin: 2, RunAttemptMax: 2}, Effect: EffectDeny},
+					{Conditions: Conditions{RunAttemptMin: 2}, Effect: EffectDeny},
+				},
+			},
+			want: []Finding{{
+				Kind:     FindingShadowedRule,
+				Severity: SeverityError,
+				Rule:     "rule 2",
+				Related:  "rule 1",
+				Message:  `rule "rule 1" matches every token this rule matches and takes precedence`,
+			}},
+		},
+		{
+			name: "regular expressions are not compared",
+			policy: &Policy{
+				Rules: []Rule{
+					{Conditions: Conditions{Ref: []string{`re:refs/tags/v\d+`}}, Effect: EffectAllow},
+					{Conditions: Conditions{Ref: []string{"refs/tags/v1*"}}, Effect: EffectAllow},
+				},
+			},
+		},
+		{
+			name: "contradictory conditions",
+			policy: &Policy{
+				Rules: []Rule{
+					{Name: "tags", Conditions: Conditions{RefType: []string{"tag"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow},
+					{Name: "owner", Conditions: Conditions{Repository: []string{"myorg/*"}, RepositoryOwner: []string{"otherorg"}}, Effect: EffectAllow},
+					{Name: "head-ref", Conditions: Conditions{EventName: []string{"push"}, HeadRef: []string{"feature/*"}}, Effect: EffectAllow},
+					{Name: "after-contradiction", Conditions: Conditions{RefType: []string{"tag"}, Ref: []string{"refs/heads/main"}, Actor: []string{"octocat"}}, Effect: EffectAllow},
+				},
+			},
+			want: []Finding{
+				{Kind: FindingContradictoryConditions, Severity: SeverityError, Rule: "tags", Message: "conditions can never match: ref_type tag never has a ref under refs/heads/"},
+				{Kind: FindingContradictoryConditions, Severity: SeverityError, Rule: "owner", Message: "conditions can never match: repository never belongs to repository_owner"},
+				{Kind: FindingContradictoryConditions, Severity: SeverityError, Rule: "head-ref", Message: "conditions can never match: head_ref and base_ref are only present for pull request events"},
+				{Kind: FindingContradictoryConditions, Severity: SeverityError, Rule: "after-contradiction", Message: "conditions can never match: ref_type tag never has a ref under refs/heads/"},
+			},
+		},
+		{
+			name: "nil policy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Analyze(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Analyze() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyAnalyze_Warnings(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		want   []FindingKind
+	}{
+		{
+			name: "hardened policy",
+			policy: &Policy{
+				Rules: []Rule{
+					{Conditions: Conditions{Repository: []string{"myorg/api"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow},
+					{Conditions: Conditions{Repository: []string{"myorg/*"}, Environment: []string{"production"}}, Effect: EffectAllow},
+				},
+				DefaultDeny: true,
+			},
+		},
+		{
+			name: "wildcard repository",
+			policy: &Policy{
+				Rules:       []Rule{{Conditions: Conditions{Repository: []string{"**"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow}},
+				DefaultDeny: true,
+			},
+			want: []FindingKind{FindingBroadPattern},
+		},
+		{
+			name: "wildcard owner and ref",
+			policy: &Policy{
+				Rules:       []Rule{{Conditions: Conditions{RepositoryOwner: []string{"*"}, Ref: []string{"re:.*"}}, Effect: EffectAllow}},
+				DefaultDeny: true,
+			},
+			want: []FindingKind{FindingBroadPattern, FindingBroadPattern},
+		},
+		{
+			name: "broad deny rules are fine",
+			policy: &Policy{
+				Rules: []Rule{
+					{Conditions: Conditions{HeadRef: []string{"**"}}, Effect: EffectDeny},
+					{Conditions: Conditions{Repository: []string{"myorg/api"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow},
+				},
+				DefaultDeny: true,
+			},
+		},
+		{
+			name: "owner only with default allow",
+			policy: &Policy{
+				Rules: []Rule{{Conditions: Conditions{RepositoryOwner: []string{"otherorg"}}, Effect: EffectDeny}},
+			},
+			want: []FindingKind{FindingOwnerOnly},
+		},
+		{
+			name: "owner only with default deny",
+			policy: &Policy{
+				Rules:       []Rule{{Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}},
+				DefaultDeny: true,
+			},
+			want: []FindingKind{FindingUnconstrainedRef},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []FindingKind
+			for _, finding := range tt.policy.Analyze() {
+				if finding.Severity != SeverityWarning {
+					t.Errorf("finding %v has severity %q, want warning", finding, finding.Severity)
+				}
+				got = append(got, finding.Kind)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Analyze() kinds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultAWSAudience is the audience AWS expects in GitHub Actions tokens
+const DefaultAWSAudience = "sts.amazonaws.com"
+
+// awsTrustPolicySizeQuota is the default IAM quota for trust policy length
+const awsTrustPolicySizeQuota = 2048
+
+// AWSExportOptions configures ExportAWSTrustPolicy
+type AWSExportOptions struct {
+	// ProviderARN is the ARN of the IAM OIDC identity provider for the
+	// issuer. Defaults to a placeholder with ACCOUNT_ID for the account.
+	ProviderARN string
+
+	// Audience is the expected aud claim. Defaults to DefaultAWSAudience.
+	Audience string
+}
+
+// AWSTrustPolicy is an IAM role trust policy document
+type AWSTrustPolicy struct {
+	Version   string         `json:"Version"`
+	Statement []AWSStatement `json:"Statement"`
+}
+
+// AWSStatement is a statement of an IAM role trust policy
+type AWSStatement struct {
+	Sid       string                         `json:"Sid,omitempty"`
+	Effect    string                         `json:"Effect"`
+	Principal map[string]string              `json:"Principal"`
+	Action    string                         `json:"Action"`
+	Condition map[string]map[string][]string `json:"Condition"`
+}
+
+// ExportAWSTrustPolicy converts the policy to an IAM role trust policy for
+// AWS's GitHub Actions OIDC provider. IAM can only match the sub and aud
+// claims, so each rule becomes a statement matching the subjects it
+// allows or denies, and rules with conditions the subject does not carry
+// are rejected. The returned warnings describe where the trust policy is
+// broader or stricter than the policy.
+func (p *Policy) ExportAWSTrustPolicy(opts AWSExportOptions) (*AWSTrustPolicy, []string, error) {
+	if p == nil {
+		return nil, nil, NewPolicyError("", "no policy to export")
+	}
+	if p.DenyForkPullRequests {
+		return nil, nil, NewPolicyError("", "deny_fork_pull_requests cannot be expressed in an AWS trust policy")
+	}
+	if p.RequireEnvironmentScopedToken {
+		return nil, nil, NewPolicyError("", "require_environment_scoped_token cannot be expressed in an AWS trust policy")
+	}
+
+	if opts.ProviderARN == "" {
+		opts.ProviderARN = "arn:aws:iam::ACCOUNT_ID:oidc-provider/" + strings.TrimPrefix(DefaultIssuer, "https://")
+	}
+	if opts.Audience == "" {
+		opts.Audience = DefaultAWSAudience
+	}
+
+	// Condition keys are prefixed with the provider's issuer host
+	host := strings.TrimPrefix(DefaultIssuer, "https://")
+	if _, provider, ok := strings.Cut(opts.ProviderARN, ":oidc-provider/"); ok {
+		host = provider
+	}
+
+	var warnings []string
+	var broadened, refOnly, allows, denies bool
+	doc := &AWSTrustPolicy{Version: "2012-10-17"}
+	sids := make(map[string]bool)
+
+	for n, i := range p.ruleOrder() {
+		rule := p.Rules[i]
+		if rule.hasWindow() {
+			return nil, nil, NewPolicyError(rule.Name, "valid_from and valid_until cannot be expressed in an AWS trust policy")
+		}
+		subjects, wild, err := awsSubjects(rule.Conditions)
+		if err != nil {
+			return nil, nil, NewPolicyError(rule.Name, err.Error())
+		}
+		broadened = broadened || wild
+		refOnly = refOnly || len(rule.Conditions.Ref) > 0 || len(rule.Conditions.RefType) > 0
+
+		sid := awsSid(rule.Name, n)
+		if sids[sid] {
+			sid = fmt.Sprintf("%s%d", sid, n+1)
+		}
+		sids[sid] = true
+
+		stmt := AWSStatement{
+			Sid:       sid,
+			Principal: map[string]string{"Federated": opts.ProviderARN},
+			Action:    "sts:AssumeRoleWithWebIdentity",
+			Condition: map[string]map[string][]string{},
+		}
+
+		operator := "StringEquals"
+		if slices.ContainsFunc(subjects, func(s string) bool { return strings.ContainsAny(s, "*?") }) {
+			operator = "StringLike"
+		}
+		stmt.Condition[operator] = map[string][]string{host + ":sub": subjects}
+
+		if rule.Effect == EffectAllow {
+			allows = true
+			stmt.Effect = "Allow"
+			if stmt.Condition["StringEquals"] == nil {
+				stmt.Condition["StringEquals"] = map[string][]string{}
+			}
+			stmt.Condition["StringEquals"][host+":aud"] = []string{opts.Audience}
+		} else {
+			// Without an audience condition the deny applies more widely
+			denies = true
+			stmt.Effect = "Deny"
+		}
+
+		doc.Statement = append(doc.Statement, stmt)
+	}
+
+	if !allows {
+		return nil, nil, NewPolicyError("", "policy has no allow rules to export")
+	}
+
+	if broadened {
+		warnings = append(warnings, "IAM wildcards also match '/' and ':', so '*' and '?' patterns match more subjects than in the policy")
+	}
+	if refOnly {
+		warnings = append(warnings, "jobs that use an environment or run for a pull request have no ref in their subject, so ref and ref_type rules do not match them")
+	}
+	if denies && p.EvaluationMode != EvaluationDenyOverrides {
+		warnings = append(warnings, "IAM lets any matching deny statement override allow statements, regardless of rule order")
+	}
+	if !p.DeniesByDefault() {
+		warnings = append(warnings, "IAM denies tokens that match no statement, although the policy allows them")
+	}
+	if data, err := json.Marshal(doc); err == nil && len(data) > awsTrustPolicySizeQuota {
+		warnings = append(warnings, fmt.Sprintf("the trust policy is %d characters long, more than the default IAM quota of %d", len(data), awsTrustPolicySizeQuota))
+	}
+
+	return doc, warnings, nil
+}
+
+// awsSubjects returns the sub claim patterns matching the conditions, and
+// whether they match more subjects than the conditions do
+func awsSubjects(cond Conditions) ([]string, bool, error) {
+	for _, cc := range conditionClaims {
+		switch cc.name {
+		case "repository", "repository_owner", "ref", "ref_type", "environment", "event_name":
+			continue
+		}
+		if len(cc.patterns(&cond)) > 0 {
+			return nil, false, fmt.Errorf("%s conditions cannot be expressed in an AWS trust policy", cc.name)
+		}
+	}
+	if hasBounds(cond) {
+		return nil, false, fmt.Errorf("run_attempt and run_number bounds cannot be expressed in an AWS trust policy")
+	}
+	if hasLists(cond) {
+		return nil, false, fmt.Errorf("repository_topic, custom_properties and inputs conditions cannot be expressed in an AWS trust policy")
+	}
+	if len(cond.Plugin) > 0 {
+		return nil, false, fmt.Errorf("plugin conditions cannot be expressed in an AWS trust policy")
+	}
+
+	var repos []string
+	var broadened bool
+	switch {
+	case len(cond.Repository) > 0 && len(cond.RepositoryOwner) > 0:
+		return nil, false, fmt.Errorf("repository and repository_owner conditions cannot be combined in an AWS trust policy")
+	case len(cond.Repository) > 0:
+		for _, pattern := range cond.Repository {
+			converted, wild, err := iamPatterns(pattern)
+			if err != nil {
+				return nil, false, err
+			}
+			repos = append(repos, converted...)
+			broadened = broadened || wild
+		}
+	case len(cond.RepositoryOwner) > 0:
+		for _, pattern := range cond.RepositoryOwner {
+			converted, wild, err := iamPatterns(pattern)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, owner := range converted {
+				repos = append(repos, owner+"/*")
+			}
+			broadened = broadened || wild
+		}
+	default:
+		repos = []string{"*"}
+	}
+
+	contexts, wild, err := awsSubjectContexts(cond)
+	if err != nil {
+		return nil, false, err
+	}
+	broadened = broadened || wild
+
+	var subjects []string
+	for _, repo := range repos {
+		for _, tail := range contexts {
+			subjects = append(subjects, "repo:"+repo+":"+tail)
+		}
+	}
+	return subjects, broadened, nil
+}
+
+// awsSubjectContexts returns the patterns for the part of the sub claim
+// after the repository
+func awsSubjectContexts(cond Conditions) ([]string, bool, error) {
+	var prefix string
+	var patterns []string
+
+	switch {
+	case len(cond.Environment) > 0:
+		if len(cond.Ref) > 0 || len(cond.RefType) > 0 || len(cond.EventName) > 0 {
+			return nil, false, fmt.Errorf("environment conditions cannot be combined with ref, ref_type or event_name in an AWS trust policy")
+		}
+		prefix, patterns = "environment:", cond.Environment
+
+	case len(cond.EventName) > 0:
+		if len(cond.Ref) > 0 || len(cond.RefType) > 0 || slices.ContainsFunc(cond.EventName, func(e string) bool { return e != "pull_request" }) {
+			return nil, false, fmt.Errorf("only event_name pull_request without ref conditions can be expressed in an AWS trust policy")
+		}
+		return []string{"pull_request"}, false, nil
+
+	case len(cond.Ref) > 0:
+		var refPrefixes []string
+		for _, refType := range cond.RefType {
+			refPrefix, ok := refTypePrefixes[refType]
+			if !ok {
+				return nil, false, fmt.Errorf("ref_type %q cannot be expressed in an AWS trust policy", refType)
+			}
+			refPrefixes = append(refPrefixes, refPrefix)
+		}
+		for _, ref := range cond.Ref {
+			if len(refPrefixes) > 0 && !slices.ContainsFunc(refPrefixes, func(p string) bool { return strings.HasPrefix(ref, p) }) {
+				return nil, false, fmt.Errorf("ref %q does not imply the ref_type condition, which cannot be expressed in an AWS trust policy", ref)
+			}
+		}
+		prefix, patterns = "ref:", cond.Ref
+
+	case len(cond.RefType) > 0:
+		var contexts []string
+		for _, refType := range cond.RefType {
+			refPrefix, ok := refTypePrefixes[refType]
+			if !ok {
+				return nil, false, fmt.Errorf("ref_type %q cannot be expressed in an AWS trust policy", refType)
+			}
+			contexts = append(contexts, "ref:"+refPrefix+"*")
+		}
+		return contexts, false, nil
+
+	default:
+		return []string{"*"}, false, nil
+	}
+
+	var contexts []string
+	var broadened bool
+	for _, pattern := range patterns {
+		converted, wild, err := iamPatterns(pattern)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, c := range converted {
+			contexts = append(contexts, prefix+c)
+		}
+		broadened = broadened || wild
+	}
+	return contexts, broadened, nil
+}
+
+// refTypePrefixes maps ref types to the prefix of their refs
+var refTypePrefixes = map[string]string{
+	"branch": "refs/heads/",
+	"tag":    "refs/tags/",
+}
+
+// iamPatterns converts a pattern to IAM StringLike patterns, expanding
+// braces. IAM's '*' and '?' also match '/', so broadened reports whether
+// the patterns match more values than the original.
+func iamPatterns(pattern string) (patterns []string, broadened bool, err error) {
+	if strings.HasPrefix(pattern, RegexPrefix) {
+		return nil, false, fmt.Errorf("regular expression %q cannot be expressed in an AWS trust policy", pattern)
+	}
+
+	for _, expanded := range expandBraces(pattern) {
+		var b strings.Builder
+		for i := 0; i < len(expanded); i++ {
+			switch c := expanded[i]; c {
+			case '*':
+				if i+1 < len(expanded) && expanded[i+1] == '*' {
+					// ** matches anything, including the optional separator
+					i++
+					if i+1 < len(expanded) && expanded[i+1] == '/' {
+						i++
+					}
+				} else {
+					broadened = true
+				}
+				b.WriteByte('*')
+			case '?':
+				broadened = true
+				b.WriteByte('?')
+			case '[':
+				if _, _, ok := matchClass(expanded[i:], 0); ok {
+					return nil, false, fmt.Errorf("character class in %q cannot be expressed in an AWS trust policy", pattern)
+				}
+				b.WriteByte('[')
+			case '\\':
+				if i+1 < len(expanded) {
+					i++
+				}
+				if expanded[i] == '*' || expanded[i] == '?' {
+					return nil, false, fmt.Errorf("escaped %q in %q cannot be expressed in an AWS trust policy", expanded[i], pattern)
+				}
+				writeIAMLiteral(&b, expanded[i])
+			default:
+				writeIAMLiteral(&b, c)
+			}
+		}
+		patterns = append(patterns, b.String())
+	}
+
+	return patterns, broadened, nil
+}
+
+// writeIAMLiteral writes a literal character, escaping '$', which starts
+// IAM policy variables
+func writeIAMLiteral(b *strings.Builder, c byte) {
+	if c == '$' {
+		b.WriteString("${$}")
+		return
+	}
+	b.WriteByte(c)
+}
+
+// awsSid derives a statement ID from the rule name, which IAM restricts
+// to letters and digits
+func awsSid(name string, index int) string {
+	sid := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, name)
+	if sid == "" {
+		sid = fmt.Sprintf("Rule%d", index+1)
+	}
+	return sid
+}
@@ -0,0 +1,183 @@
+package ghaauth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_ExportAWSTrustPolicy(t *testing.T) {
+	const sub = "token.actions.githubusercontent.com:sub"
+
+	allow := func(cond Conditions) Rule {
+		return Rule{Name: "allow", Conditions: cond, Effect: EffectAllow}
+	}
+
+	tests := []struct {
+		name         string
+		policy       *Policy
+		wantSubjects []string
+		wantOperator string
+		wantWarning  string
+		wantErr      string
+	}{
+		{
+			name:         "repository and branch",
+			policy:       &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Repository: []string{"myorg/api"}, Ref: []string{"refs/heads/main"}})}},
+			wantSubjects: []string{"repo:myorg/api:ref:refs/heads/main"},
+			wantOperator: "StringEquals",
+			wantWarning:  "no ref in their subject",
+		},
+		{
+			name:         "owner and environments",
+			policy:       &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{RepositoryOwner: []string{"myorg"}, Environment: []string{"{staging,production}"}})}},
+			wantSubjects: []string{"repo:myorg/*:environment:staging", "repo:myorg/*:environment:production"},
+			wantOperator: "StringLike",
+		},
+		{
+			name:         "double wildcard and ref type",
+			policy:       &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Repository: []string{"myorg/**"}, RefType: []string{"tag"}})}},
+			wantSubjects: []string{"repo:myorg/*:ref:refs/tags/*"},
+			wantOperator: "StringLike",
+		},
+		{
+			name:         "single wildcard is broadened",
+			policy:       &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Repository: []string{"myorg/api-*"}, EventName: []string{"pull_request"}})}},
+			wantSubjects: []string{"repo:myorg/api-*:pull_request"},
+			wantOperator: "StringLike",
+			wantWarning:  "IAM wildcards also match",
+		},
+		{
+			name:         "dollar sign is escaped",
+			policy:       &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Repository: []string{"myorg/${x}"}})}},
+			wantSubjects: []string{"repo:myorg/${$}{x}:*"},
+			wantOperator: "StringLike",
+		},
+		{
+			name:        "default allow",
+			policy:      &Policy{Rules: []Rule{allow(Conditions{Repository: []string{"myorg/api"}})}},
+			wantWarning: "IAM denies tokens that match no statement",
+		},
+		{
+			name:    "unsupported claim",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Actor: []string{"johndoe"}})}},
+			wantErr: "actor conditions cannot be expressed",
+		},
+		{
+			name:    "regular expression",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Repository: []string{"re:^myorg/.*$"}})}},
+			wantErr: "regular expression",
+		},
+		{
+			name:    "character class",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Repository: []string{"myorg/[ab]pi"}})}},
+			wantErr: "character class",
+		},
+		{
+			name:    "environment with ref",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Environment: []string{"prod"}, Ref: []string{"refs/heads/main"}})}},
+			wantErr: "cannot be combined",
+		},
+		{
+			name:    "ref outside ref type",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Ref: []string{"refs/heads/main"}, RefType: []string{"tag"}})}},
+			wantErr: "does not imply the ref_type",
+		},
+		{
+			name:    "numeric bounds",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Repository: []string{"myorg/api"}, RunAttemptMax: 1})}},
+			wantErr: "bounds cannot be expressed",
+		},
+		{
+			name:    "repository topics",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{allow(Conditions{Repository: []string{"myorg/api"}, RepositoryTopic: []string{"deployable"}})}},
+			wantErr: "repository_topic, custom_properties and inputs conditions cannot be expressed",
+		},
+		{
+			name:    "fork pull requests",
+			policy:  &Policy{DefaultDeny: true, DenyForkPullRequests: true, Rules: []Rule{allow(Conditions{Repository: []string{"myorg/api"}})}},
+			wantErr: "deny_fork_pull_requests",
+		},
+		{
+			name:    "no allow rules",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{{Conditions: Conditions{Repository: []string{"myorg/api"}}, Effect: EffectDeny}}},
+			wantErr: "no allow rules",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, warnings, err := tt.policy.ExportAWSTrustPolicy(AWSExportOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ExportAWSTrustPolicy() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExportAWSTrustPolicy() error = %v", err)
+			}
+
+			stmt := doc.Statement[0]
+			if stmt.Effect != "Allow" || stmt.Action != "sts:AssumeRoleWithWebIdentity" {
+				t.Errorf("statement = %+v, want an allow statement", stmt)
+			}
+			if aud := stmt.Condition["StringEquals"]["token.actions.githubusercontent.com:aud"]; !reflect.DeepEqual(aud, []string{DefaultAWSAudience}) {
+				t.Errorf("aud condition = %v, want %s", aud, DefaultAWSAudience)
+			}
+			if tt.wantSubjects != nil {
+				if got := stmt.Condition[tt.wantOperator][sub]; !reflect.DeepEqual(got, tt.wantSubjects) {
+					t.Errorf("%s sub = %v, want %v", tt.wantOperator, got, tt.wantSubjects)
+				}
+			}
+			if tt.wantWarning != "" && !strings.Contains(strings.Join(warnings, "\n"), tt.wantWarning) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestPolicy_ExportAWSTrustPolicy_Options(t *testing.T) {
+	policy := &Policy{
+		DefaultDeny:    true,
+		EvaluationMode: EvaluationDenyOverrides,
+		Rules: []Rule{
+			{Name: "deny-legacy", Conditions: Conditions{Repository: []string{"myorg/legacy"}}, Effect: EffectDeny},
+			{Name: "allow-org", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow},
+			{Name: "allow-org", Conditions: Conditions{RepositoryOwner: []string{"partner"}}, Effect: EffectAllow},
+		},
+	}
+
+	doc, warnings, err := policy.ExportAWSTrustPolicy(AWSExportOptions{
+		ProviderARN: "arn:aws:iam::123456789012:oidc-provider/ghe.example.com/_services/token",
+		Audience:    "https://api.example.com",
+	})
+	if err != nil {
+		t.Fatalf("ExportAWSTrustPolicy() error = %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %q, want none", warnings)
+	}
+
+	var sids []string
+	for _, stmt := range doc.Statement {
+		sids = append(sids, stmt.Sid)
+		if stmt.Principal["Federated"] != "arn:aws:iam::123456789012:oidc-provider/ghe.example.com/_services/token" {
+			t.Errorf("Principal = %v", stmt.Principal)
+		}
+	}
+	if want := []string{"denylegacy", "alloworg", "alloworg3"}; !reflect.DeepEqual(sids, want) {
+		t.Errorf("Sids = %v, want %v", sids, want)
+	}
+
+	deny := doc.Statement[0]
+	if deny.Effect != "Deny" || deny.Condition["StringLike"]["ghe.example.com/_services/token:sub"][0] != "repo:myorg/legacy:*" {
+		t.Errorf("deny statement = %+v", deny)
+	}
+	if _, ok := deny.Condition["StringEquals"]["ghe.example.com/_services/token:aud"]; ok {
+		t.Error("deny statement has an audience condition")
+	}
+	if aud := doc.Statement[1].Condition["StringEquals"]["ghe.example.com/_services/token:aud"]; aud[0] != "https://api.example.com" {
+		t.Errorf("aud = %v, want https://api.example.com", aud)
+	}
+}
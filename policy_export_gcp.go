@@ -0,0 +1,275 @@
+package ghaauth
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// gcpAttributeConditionLimit is the maximum length of a Workload Identity
+// attribute condition
+const gcpAttributeConditionLimit = 4096
+
+// ExportGCPAttributeCondition converts the policy to a CEL attribute
+// condition for a GCP Workload Identity pool provider. The condition reads
+// the token's claims from assertion, so it needs no attribute mapping.
+// Patterns become RE2 expressions with the same semantics; a claim that
+// cannot be evaluated, such as a non-numeric run_attempt, makes GCP reject
+// the token. The returned warnings describe limits the condition exceeds.
+func (p *Policy) ExportGCPAttributeCondition() (string, []string, error) {
+	if p == nil {
+		return "", nil, NewPolicyError("", "no policy to export")
+	}
+
+	order := p.ruleOrder()
+	rules := make([]string, len(p.Rules))
+	for _, i := range order {
+		if p.Rules[i].hasWindow() {
+			return "", nil, NewPolicyError(p.Rules[i].Name, "valid_from and valid_until cannot be expressed in a CEL condition")
+		}
+		expr, err := celRule(p.Rules[i].Conditions)
+		if err != nil {
+			return "", nil, NewPolicyError(p.Rules[i].Name, err.Error())
+		}
+		rules[i] = expr
+	}
+
+	expr := p.celDecision(order, rules)
+	if p.DenyForkPullRequests {
+		expr = celAnd("!"+celFork(), expr)
+	}
+	if p.RequireEnvironmentScopedToken {
+		expr = celAnd(celEnvironmentScoped, expr)
+	}
+
+	var warnings []string
+	if len(expr) > gcpAttributeConditionLimit {
+		warnings = append(warnings, fmt.Sprintf("the condition is %d characters long, more than the limit of %d", len(expr), gcpAttributeConditionLimit))
+	}
+
+	return expr, warnings, nil
+}
+
+// celDecision combines the rule expressions according to the evaluation
+// mode. First-match policies whose deny rules all come before (or after)
+// their allow rules are combined like deny-overrides (or allow-overrides)
+// policies, which gives the same decisions with a flatter expression.
+func (p *Policy) celDecision(order []int, rules []string) string {
+	var allows, denies []string
+	var effects []Effect
+	for _, i := range order {
+		if p.Rules[i].Effect == EffectAllow {
+			allows = append(allows, rules[i])
+		} else {
+			denies = append(denies, rules[i])
+		}
+		if len(effects) == 0 || effects[len(effects)-1] != p.Rules[i].Effect {
+			effects = append(effects, p.Rules[i].Effect)
+		}
+	}
+
+	mode := p.EvaluationMode
+	if mode == "" || mode == EvaluationFirstMatch {
+		switch {
+		case len(effects) <= 1 || len(effects) == 2 && effects[0] == EffectDeny:
+			mode = EvaluationDenyOverrides
+		case len(effects) == 2:
+			mode = EvaluationAllowOverrides
+		}
+	}
+
+	allowed, denied := celOr(allows...), celOr(denies...)
+	switch mode {
+	case EvaluationDenyOverrides:
+		if p.DeniesByDefault() {
+			return celAnd(celNot(denied), allowed)
+		}
+		return celNot(denied)
+
+	case EvaluationAllowOverrides:
+		if p.DeniesByDefault() {
+			return allowed
+		}
+		return celOr(allowed, celNot(denied))
+	}
+
+	// The first matching rule decides
+	expr := strconv.FormatBool(!p.DeniesByDefault())
+	for k := len(order) - 1; k >= 0; k-- {
+		i := order[k]
+		expr = fmt.Sprintf("%s ? %t : %s", celParen(rules[i]), p.Rules[i].Effect == EffectAllow, celParen(expr))
+	}
+	return expr
+}
+
+// celRule returns the expression matching all conditions of a rule
+func celRule(cond Conditions) (string, error) {
+	if hasLists(cond) {
+		return "", fmt.Errorf("repository_topic, custom_properties and inputs conditions cannot be expressed in a CEL condition")
+	}
+	if len(cond.Plugin) > 0 {
+		return "", fmt.Errorf("plugin conditions cannot be expressed in a CEL condition")
+	}
+
+	var terms []string
+	for _, cc := range conditionClaims {
+		patterns := cc.patterns(&cond)
+		if len(patterns) == 0 {
+			continue
+		}
+
+		claim := "assertion." + cc.name
+		term := celPatterns(claim, patterns)
+		if cc.optional {
+			// An empty optional claim never matches
+			term = fmt.Sprintf("has(%s) && %s != \"\" && %s", claim, claim, celParen(term))
+		}
+		terms = append(terms, term)
+	}
+
+	for _, b := range []struct {
+		name     string
+		min, max int
+	}{
+		{"run_attempt", cond.RunAttemptMin, cond.RunAttemptMax},
+		{"run_number", cond.RunNumberMin, cond.RunNumberMax},
+	} {
+		if b.min != 0 {
+			terms = append(terms, fmt.Sprintf("int(assertion.%s) >= %d", b.name, b.min))
+		}
+		if b.max != 0 {
+			terms = append(terms, fmt.Sprintf("int(assertion.%s) <= %d", b.name, b.max))
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", fmt.Errorf("rule has no conditions")
+	}
+	return celAnd(terms...), nil
+}
+
+// celPatterns returns the expression matching a claim against patterns,
+// comparing literal patterns directly
+func celPatterns(claim string, patterns []string) string {
+	var literals, expressions []string
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, RegexPrefix) && !strings.ContainsAny(pattern, patternMeta) {
+			literals = append(literals, strconv.Quote(pattern))
+		} else {
+			expressions = append(expressions, globRegexp(pattern))
+		}
+	}
+
+	var terms []string
+	switch len(literals) {
+	case 0:
+	case 1:
+		terms = append(terms, claim+" == "+literals[0])
+	default:
+		terms = append(terms, claim+" in ["+strings.Join(literals, ", ")+"]")
+	}
+	if len(expressions) > 0 {
+		terms = append(terms, claim+".matches("+strconv.Quote(strings.Join(expressions, "|"))+")")
+	}
+
+	return celOr(terms...)
+}
+
+// celFork returns the expression for IsPullRequestFromFork
+func celFork() string {
+	events := make([]string, 0, len(pullRequestEvents))
+	for event := range pullRequestEvents {
+		events = append(events, strconv.Quote(event))
+	}
+	slices.Sort(events)
+
+	return fmt.Sprintf(`(assertion.event_name in [%s] || has(assertion.head_ref) && assertion.head_ref != "" || assertion.ref.startsWith("refs/pull/"))`,
+		strings.Join(events, ", "))
+}
+
+// celEnvironmentScoped matches environment-scoped tokens, like
+// GitHubActionsClaims.IsEnvironmentScoped
+const celEnvironmentScoped = `(has(assertion.environment) && assertion.environment != "" && assertion.sub == "repo:" + assertion.repository + ":environment:" + assertion.environment)`
+
+// celOr joins expressions with ||; no expressions are false
+func celOr(exprs ...string) string {
+	return celJoin(" || ", "false", "true", exprs)
+}
+
+// celAnd joins expressions with &&; no expressions are true
+func celAnd(exprs ...string) string {
+	return celJoin(" && ", "true", "false", exprs)
+}
+
+// celJoin joins expressions with an operator, leaving out identity
+// operands and short-circuiting on absorbing ones
+func celJoin(op, identity, absorbing string, exprs []string) string {
+	var operands []string
+	for _, expr := range exprs {
+		switch expr {
+		case identity:
+			continue
+		case absorbing:
+			return absorbing
+		}
+		operands = append(operands, expr)
+	}
+
+	switch len(operands) {
+	case 0:
+		return identity
+	case 1:
+		return operands[0]
+	}
+
+	for i, expr := range operands {
+		operands[i] = celParen(expr)
+	}
+	return strings.Join(operands, op)
+}
+
+// celNot negates an expression
+func celNot(expr string) string {
+	switch expr {
+	case "false":
+		return "true"
+	case "true":
+		return "false"
+	}
+	if celTopLevel(expr, " ") {
+		expr = "(" + expr + ")"
+	}
+	return "!" + expr
+}
+
+// celParen parenthesizes an expression with logical or conditional
+// operators, which bind less tightly than && and ||
+func celParen(expr string) string {
+	if celTopLevel(expr, "|&?") {
+		return "(" + expr + ")"
+	}
+	return expr
+}
+
+// celTopLevel reports whether the expression contains any of chars outside
+// of parentheses, brackets and strings
+func celTopLevel(expr, chars string) bool {
+	depth, quoted := 0, false
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth == 0 && strings.IndexByte(chars, c) >= 0:
+			return true
+		}
+	}
+	return false
+}
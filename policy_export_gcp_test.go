@@ -0,0 +1,86 @@
+package ghaauth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicy_ExportGCPAttributeCondition(t *testing.T) {
+	allowMain := Rule{Name: "main", Conditions: Conditions{Repository: []string{"myorg/api", "myorg/web"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow}
+	allowProd := Rule{Name: "prod", Conditions: Conditions{RepositoryOwner: []string{"myorg"}, Environment: []string{"prod*"}}, Effect: EffectAllow}
+	denyBots := Rule{Name: "bots", Conditions: Conditions{Actor: []string{"dependabot[bot]"}, RunAttemptMin: 2}, Effect: EffectDeny}
+
+	tests := []struct {
+		name   string
+		policy *Policy
+		want   string
+	}{
+		{
+			name:   "allow rules",
+			policy: &Policy{DefaultDeny: true, Rules: []Rule{allowMain, allowProd}},
+			want: `(assertion.repository in ["myorg/api", "myorg/web"] && assertion.ref == "refs/heads/main") || ` +
+				`(assertion.repository_owner == "myorg" && (has(assertion.environment) && assertion.environment != "" && assertion.environment.matches("^(?:prod\\*|prod[^/]*)$")))`,
+		},
+		{
+			name:   "deny before allow",
+			policy: &Policy{DefaultDeny: true, Rules: []Rule{denyBots, allowMain}},
+			want: `!(assertion.actor.matches("^(?:dependabot\\[bot\\]|dependabot(?:[\\x{62}\\x{6f}\\x{74}]|\\[bot\\]))$") && int(assertion.run_attempt) >= 2) && ` +
+				`(assertion.repository in ["myorg/api", "myorg/web"] && assertion.ref == "refs/heads/main")`,
+		},
+		{
+			name:   "first match with interleaved effects",
+			policy: &Policy{DefaultDeny: true, Rules: []Rule{allowProd, denyBots, allowMain}},
+			want: `(assertion.repository_owner == "myorg" && (has(assertion.environment) && assertion.environment != "" && assertion.environment.matches("^(?:prod\\*|prod[^/]*)$"))) ? true : ` +
+				`((assertion.actor.matches("^(?:dependabot\\[bot\\]|dependabot(?:[\\x{62}\\x{6f}\\x{74}]|\\[bot\\]))$") && int(assertion.run_attempt) >= 2) ? false : ` +
+				`((assertion.repository in ["myorg/api", "myorg/web"] && assertion.ref == "refs/heads/main") ? true : false))`,
+		},
+		{
+			name:   "priority orders rules",
+			policy: &Policy{DefaultDeny: true, Rules: []Rule{allowMain, {Conditions: denyBots.Conditions, Effect: EffectDeny, Priority: 1}}},
+			want: `!(assertion.actor.matches("^(?:dependabot\\[bot\\]|dependabot(?:[\\x{62}\\x{6f}\\x{74}]|\\[bot\\]))$") && int(assertion.run_attempt) >= 2) && ` +
+				`(assertion.repository in ["myorg/api", "myorg/web"] && assertion.ref == "refs/heads/main")`,
+		},
+		{
+			name:   "allow overrides with default allow",
+			policy: &Policy{EvaluationMode: EvaluationAllowOverrides, Rules: []Rule{{Conditions: Conditions{Repository: []string{"re:^myorg/.+$"}}, Effect: EffectDeny}}},
+			want:   `!assertion.repository.matches("^(?:^myorg/.+$)$")`,
+		},
+		{
+			name:   "fork pull requests",
+			policy: &Policy{DefaultDeny: true, DenyForkPullRequests: true, Rules: []Rule{{Conditions: Conditions{RefType: []string{"branch"}}, Effect: EffectAllow}}},
+			want: `!(assertion.event_name in ["pull_request", "pull_request_review", "pull_request_review_comment", "pull_request_target"] || ` +
+				`has(assertion.head_ref) && assertion.head_ref != "" || assertion.ref.startsWith("refs/pull/")) && assertion.ref_type == "branch"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings, err := tt.policy.ExportGCPAttributeCondition()
+			if err != nil {
+				t.Fatalf("ExportGCPAttributeCondition() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExportGCPAttributeCondition() =\n%s\nwant\n%s", got, tt.want)
+			}
+			if len(warnings) != 0 {
+				t.Errorf("warnings = %q, want none", warnings)
+			}
+		})
+	}
+}
+
+func TestPolicy_ExportGCPAttributeCondition_Limit(t *testing.T) {
+	repos := make([]string, 500)
+	for i := range repos {
+		repos[i] = "myorg/repository-with-a-long-name"
+	}
+	policy := &Policy{DefaultDeny: true, Rules: []Rule{{Conditions: Conditions{Repository: repos}, Effect: EffectAllow}}}
+
+	_, warnings, err := policy.ExportGCPAttributeCondition()
+	if err != nil {
+		t.Fatalf("ExportGCPAttributeCondition() error = %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "more than the limit") {
+		t.Errorf("warnings = %q, want a length warning", warnings)
+	}
+}
@@ -0,0 +1,205 @@
+package ghaauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// VaultExportOptions configures ExportVaultRoles
+type VaultExportOptions struct {
+	// Audience is the expected aud claim, bound with bound_audiences
+	Audience string
+
+	// UserClaim is the claim Vault names entity aliases after. Defaults to
+	// "repository".
+	UserClaim string
+}
+
+// VaultRole is a role definition for Vault's jwt auth method, as written
+// to auth/jwt/role/<name>
+type VaultRole struct {
+	RoleType        string              `json:"role_type"`
+	UserClaim       string              `json:"user_claim"`
+	BoundAudiences  []string            `json:"bound_audiences"`
+	BoundClaimsType string              `json:"bound_claims_type"`
+	BoundClaims     map[string][]string `json:"bound_claims"`
+}
+
+// ExportVaultRoles converts the policy to roles for Vault's jwt auth
+// method, one per allow rule and named after it. Vault has no deny rules
+// and matches claims with globs whose only wildcard is '*', so policies
+// using anything else are rejected with the errors from ValidateVault.
+// The returned warnings describe where the roles are broader or stricter
+// than the policy.
+func (p *Policy) ExportVaultRoles(opts VaultExportOptions) (map[string]*VaultRole, []string, error) {
+	if err := p.ValidateVault(); err != nil {
+		return nil, nil, err
+	}
+	if opts.Audience == "" {
+		return nil, nil, fmt.Errorf("an audience is required for Vault roles")
+	}
+	if opts.UserClaim == "" {
+		opts.UserClaim = "repository"
+	}
+
+	var warnings []string
+	var broadened bool
+	roles := make(map[string]*VaultRole, len(p.Rules))
+
+	for n, i := range p.ruleOrder() {
+		rule := p.Rules[i]
+		role := &VaultRole{
+			RoleType:        "jwt",
+			UserClaim:       opts.UserClaim,
+			BoundAudiences:  []string{opts.Audience},
+			BoundClaimsType: "string",
+			BoundClaims:     make(map[string][]string),
+		}
+
+		for _, cc := range conditionClaims {
+			for _, pattern := range cc.patterns(&rule.Conditions) {
+				globs, wild, _ := vaultGlobs(pattern)
+				for _, glob := range globs {
+					if strings.Contains(glob, "*") {
+						role.BoundClaimsType = "glob"
+					}
+				}
+				role.BoundClaims[cc.name] = append(role.BoundClaims[cc.name], globs...)
+				broadened = broadened || wild
+			}
+		}
+
+		name := vaultRoleName(rule.Name, n)
+		if roles[name] != nil {
+			name = fmt.Sprintf("%s-%d", name, n+1)
+		}
+		roles[name] = role
+	}
+
+	if broadened {
+		warnings = append(warnings, "Vault's '*' also matches '/', so '*' patterns match more values than in the policy")
+	}
+	if !p.DeniesByDefault() {
+		warnings = append(warnings, "Vault denies tokens that match no role, although the policy allows them")
+	}
+
+	return roles, warnings, nil
+}
+
+// ValidateVault checks that the policy can be expressed as Vault jwt auth
+// roles, returning all problems found
+func (p *Policy) ValidateVault() error {
+	if p == nil {
+		return NewPolicyError("", "no policy to export")
+	}
+
+	var errs []error
+	if p.DenyForkPullRequests {
+		errs = append(errs, NewPolicyError("", "deny_fork_pull_requests cannot be expressed in Vault roles"))
+	}
+	if p.RequireEnvironmentScopedToken {
+		errs = append(errs, NewPolicyError("", "require_environment_scoped_token cannot be expressed in Vault roles"))
+	}
+
+	allows := false
+	for _, rule := range p.Rules {
+		if rule.Effect != EffectAllow {
+			errs = append(errs, NewPolicyError(rule.Name, "deny rules cannot be expressed in Vault roles"))
+			continue
+		}
+		allows = true
+
+		if hasBounds(rule.Conditions) {
+			errs = append(errs, NewPolicyError(rule.Name, "run_attempt and run_number bounds cannot be expressed in Vault roles"))
+		}
+		if hasLists(rule.Conditions) {
+			errs = append(errs, NewPolicyError(rule.Name, "repository_topic, custom_properties and inputs conditions cannot be expressed in Vault roles"))
+		}
+		if len(rule.Conditions.Plugin) > 0 {
+			errs = append(errs, NewPolicyError(rule.Name, "plugin conditions cannot be expressed in Vault roles"))
+		}
+		if rule.hasWindow() {
+			errs = append(errs, NewPolicyError(rule.Name, "valid_from and valid_until cannot be expressed in Vault roles"))
+		}
+		for _, cc := range conditionClaims {
+			for _, pattern := range cc.patterns(&rule.Conditions) {
+				if _, _, err := vaultGlobs(pattern); err != nil {
+					errs = append(errs, NewPolicyError(rule.Name, err.Error()))
+				}
+			}
+		}
+	}
+
+	if !allows {
+		errs = append(errs, NewPolicyError("", "policy has no allow rules to export"))
+	}
+	return errors.Join(errs...)
+}
+
+// vaultGlobs converts a pattern to Vault glob patterns, expanding braces.
+// Vault's '*' also matches '/', so broadened reports whether the globs
+// match more values than the original.
+func vaultGlobs(pattern string) (globs []string, broadened bool, err error) {
+	if strings.HasPrefix(pattern, RegexPrefix) {
+		return nil, false, fmt.Errorf("regular expression %q cannot be expressed in Vault roles", pattern)
+	}
+
+	for _, expanded := range expandBraces(pattern) {
+		var b strings.Builder
+		for i := 0; i < len(expanded); i++ {
+			switch c := expanded[i]; c {
+			case '*':
+				if i+1 < len(expanded) && expanded[i+1] == '*' {
+					// ** matches anything, including the optional separator
+					i++
+					if i+1 < len(expanded) && expanded[i+1] == '/' {
+						i++
+					}
+				} else {
+					broadened = true
+				}
+				b.WriteByte('*')
+			case '?':
+				return nil, false, fmt.Errorf("'?' in %q cannot be expressed in Vault roles", pattern)
+			case '[':
+				if _, _, ok := matchClass(expanded[i:], 0); ok {
+					return nil, false, fmt.Errorf("character class in %q cannot be expressed in Vault roles", pattern)
+				}
+				b.WriteByte('[')
+			case '\\':
+				if i+1 < len(expanded) {
+					i++
+				}
+				if expanded[i] == '*' {
+					// Vault globs have no escapes
+					return nil, false, fmt.Errorf("escaped '*' in %q cannot be expressed in Vault roles", pattern)
+				}
+				b.WriteByte(expanded[i])
+			default:
+				b.WriteByte(c)
+			}
+		}
+		globs = append(globs, b.String())
+	}
+
+	return globs, broadened, nil
+}
+
+// vaultRoleName derives a role name from the rule name, keeping the
+// characters Vault allows in role paths
+func vaultRoleName(name string, index int) string {
+	role := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		case r == ' ' || r == '/':
+			return '-'
+		}
+		return -1
+	}, name)
+	if role == "" {
+		role = fmt.Sprintf("rule-%d", index+1)
+	}
+	return role
+}
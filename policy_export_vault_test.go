@@ -0,0 +1,171 @@
+package ghaauth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_ExportVaultRoles(t *testing.T) {
+	policy := &Policy{
+		DefaultDeny: true,
+		Rules: []Rule{
+			{
+				Name:       "deploy prod",
+				Conditions: Conditions{Repository: []string{"myorg/api"}, Environment: []string{"{staging,production}"}},
+				Effect:     EffectAllow,
+			},
+			{
+				Name:       "ci",
+				Conditions: Conditions{RepositoryOwner: []string{"myorg"}, Ref: []string{"refs/heads/**"}},
+				Effect:     EffectAllow,
+			},
+		},
+	}
+
+	roles, warnings, err := policy.ExportVaultRoles(VaultExportOptions{Audience: "https://vault.example.com"})
+	if err != nil {
+		t.Fatalf("ExportVaultRoles() error = %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none", warnings)
+	}
+
+	want := map[string]*VaultRole{
+		"deploy-prod": {
+			RoleType:        "jwt",
+			UserClaim:       "repository",
+			BoundAudiences:  []string{"https://vault.example.com"},
+			BoundClaimsType: "string",
+			BoundClaims: map[string][]string{
+				"repository":  {"myorg/api"},
+				"environment": {"staging", "production"},
+			},
+		},
+		"ci": {
+			RoleType:        "jwt",
+			UserClaim:       "repository",
+			BoundAudiences:  []string{"https://vault.example.com"},
+			BoundClaimsType: "glob",
+			BoundClaims: map[string][]string{
+				"repository_owner": {"myorg"},
+				"ref":              {"refs/heads/*"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(roles, want) {
+		t.Errorf("ExportVaultRoles() = %+v, want %+v", roles, want)
+	}
+}
+
+func TestPolicy_ExportVaultRolesWarnings(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      *Policy
+		opts        VaultExportOptions
+		wantWarning string
+		wantErr     string
+	}{
+		{
+			name:        "single wildcard is broadened",
+			policy:      &Policy{DefaultDeny: true, Rules: []Rule{{Name: "api", Conditions: Conditions{Repository: []string{"myorg/api-*"}}, Effect: EffectAllow}}},
+			opts:        VaultExportOptions{Audience: "vault"},
+			wantWarning: "Vault's '*' also matches '/'",
+		},
+		{
+			name:        "default allow",
+			policy:      &Policy{Rules: []Rule{{Name: "api", Conditions: Conditions{Repository: []string{"myorg/api"}}, Effect: EffectAllow}}},
+			opts:        VaultExportOptions{Audience: "vault"},
+			wantWarning: "Vault denies tokens that match no role",
+		},
+		{
+			name:    "missing audience",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{{Name: "api", Conditions: Conditions{Repository: []string{"myorg/api"}}, Effect: EffectAllow}}},
+			wantErr: "an audience is required",
+		},
+		{
+			name:    "invalid policy",
+			policy:  &Policy{DefaultDeny: true, Rules: []Rule{{Name: "api", Conditions: Conditions{Repository: []string{"myorg/ap?"}}, Effect: EffectAllow}}},
+			opts:    VaultExportOptions{Audience: "vault"},
+			wantErr: "'?' in",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, warnings, err := tt.policy.ExportVaultRoles(tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ExportVaultRoles() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExportVaultRoles() error = %v", err)
+			}
+			if !strings.Contains(strings.Join(warnings, "\n"), tt.wantWarning) {
+				t.Errorf("warnings = %v, want %q", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestPolicy_ValidateVault(t *testing.T) {
+	allow := func(cond Conditions) Rule {
+		return Rule{Name: "allow", Conditions: cond, Effect: EffectAllow}
+	}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		wantErrs []string
+	}{
+		{
+			name:   "expressible",
+			policy: &Policy{Rules: []Rule{allow(Conditions{Repository: []string{"myorg/**"}, Actor: []string{"{alice,bob}"}})}},
+		},
+		{
+			name: "deny rule and fork pull requests",
+			policy: &Policy{DenyForkPullRequests: true, Rules: []Rule{
+				allow(Conditions{Repository: []string{"myorg/api"}}),
+				{Name: "no-prs", Conditions: Conditions{EventName: []string{"pull_request"}}, Effect: EffectDeny},
+			}},
+			wantErrs: []string{"deny_fork_pull_requests", "deny rules"},
+		},
+		{
+			name:     "unsupported patterns",
+			policy:   &Policy{Rules: []Rule{allow(Conditions{Repository: []string{"re:^myorg/.*$", "myorg/[ab]pi", `myorg/\*`}})}},
+			wantErrs: []string{"regular expression", "character class", "escaped '*'"},
+		},
+		{
+			name:     "bounds",
+			policy:   &Policy{Rules: []Rule{allow(Conditions{Repository: []string{"myorg/api"}, RunAttemptMax: 1})}},
+			wantErrs: []string{"run_attempt and run_number bounds"},
+		},
+		{
+			name:     "no allow rules",
+			policy:   &Policy{Rules: []Rule{{Name: "deny", Conditions: Conditions{Actor: []string{"bot"}}, Effect: EffectDeny}}},
+			wantErrs: []string{"no allow rules"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.ValidateVault()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("ValidateVault() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ValidateVault() error = nil, want %v", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("ValidateVault() error = %v, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package ghaauth
+
+import "slices"
+
+// Filter returns a copy of the policy keeping only the rules tagged with
+// any of tags, plus the untagged rules, which apply to every slice, e.g.
+// an organization-wide deny. It lets one authored policy be enforced per
+// service ("deploy", "artifact-read"). The policy's other settings are
+// kept; without tags, Filter returns the policy itself.
+func (p *Policy) Filter(tags ...string) *Policy {
+	if p == nil || len(tags) == 0 {
+		return p
+	}
+
+	filtered := *p
+	filtered.Rules = make([]Rule, 0, len(p.Rules))
+	for _, rule := range p.Rules {
+		if len(rule.Tags) == 0 || slices.ContainsFunc(rule.Tags, func(tag string) bool { return slices.Contains(tags, tag) }) {
+			filtered.Rules = append(filtered.Rules, rule)
+		}
+	}
+	return &filtered
+}
+
+// WithRuleTags compiles only the rules kept by Policy.Filter(tags...);
+// CompiledPolicy.Policy returns the filtered policy
+func WithRuleTags(tags ...string) CompileOption {
+	return func(c *compileConfig) {
+		c.tags = append(c.tags, tags...)
+	}
+}
+
+// WithPolicyTags enforces only the rules of the verifier's policies that
+// are tagged with any of tags, plus the untagged ones (see Policy.Filter).
+// It applies to the policies of WithPolicy, WithPolicyProvider, WithIssuer
+// and WithShadowPolicy, but not to per-call WithPolicyOverride policies.
+func WithPolicyTags(tags ...string) Option {
+	return func(v *Verifier) {
+		v.compileOpts = append(v.compileOpts, WithRuleTags(tags...))
+	}
+}
@@ -0,0 +1,130 @@
+package ghaauth
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+const taggedPolicy = `
+metadata:
+  version: "7"
+default_deny: true
+rules:
+  - name: deny-forks
+    conditions:
+      repository: ["myorg/*-fork"]
+    effect: deny
+  - name: deploy
+    conditions:
+      repository: [myorg/myrepo]
+      ref: [refs/heads/main]
+    effect: allow
+    tags: [deploy]
+  - name: artifact-read
+    conditions:
+      repository_owner: [myorg]
+    effect: allow
+    tags: [artifact-read, ci]
+`
+
+func TestPolicy_Filter(t *testing.T) {
+	policy, err := ParsePolicyYAML([]byte(taggedPolicy))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	ruleNames := func(p *Policy) []string {
+		var names []string
+		for _, rule := range p.Rules {
+			names = append(names, rule.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{name: "one tag", tags: []string{"deploy"}, want: []string{"deny-forks", "deploy"}},
+		{name: "any tag", tags: []string{"ci", "deploy"}, want: []string{"deny-forks", "deploy", "artifact-read"}},
+		{name: "unknown tag", tags: []string{"release"}, want: []string{"deny-forks"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered := policy.Filter(tt.tags...)
+			if got := ruleNames(filtered); !slices.Equal(got, tt.want) {
+				t.Errorf("Filter(%q) rules = %q, want %q", tt.tags, got, tt.want)
+			}
+			if !filtered.DefaultDeny || filtered.Version() != "7" {
+				t.Error("Filter() dropped the policy settings")
+			}
+		})
+	}
+
+	if got := policy.Filter(); got != policy {
+		t.Error("Filter() without tags copied the policy")
+	}
+	if len(policy.Rules) != 3 {
+		t.Errorf("Filter() modified the policy: %d rules", len(policy.Rules))
+	}
+
+	compiled := policy.Compile(WithRuleTags("deploy"))
+	if got := ruleNames(compiled.Policy()); !slices.Equal(got, []string{"deny-forks", "deploy"}) {
+		t.Errorf("Compile(WithRuleTags) rules = %q", got)
+	}
+	claims := &GitHubActionsClaims{Repository: "myorg/other", RepositoryOwner: "myorg", Ref: "refs/heads/main"}
+	if result := compiled.Evaluate(claims); result.Allowed {
+		t.Errorf("Evaluate() = %+v, want artifact-read filtered out", result)
+	}
+
+	policy.Rules[0].Tags = []string{""}
+	if err := policy.Validate(); err == nil {
+		t.Error("Validate() error = nil with an empty tag")
+	}
+}
+
+func TestWithPolicyTags(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	policy, err := ParsePolicyYAML([]byte(taggedPolicy))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	claims := testutil.DefaultClaims()
+	claims.Ref = "refs/heads/feature"
+	token, err := gen.GenerateToken(claims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	for tag, wantAllowed := range map[string]bool{"deploy": false, "artifact-read": true} {
+		t.Run(tag, func(t *testing.T) {
+			verifier, err := New(
+				WithPolicy(policy),
+				WithPolicyTags(tag),
+				WithAudience("https://api.example.com"),
+				WithJWKSURL(server.JWKSURL()),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), token)
+			if allowed := err == nil; allowed != wantAllowed {
+				t.Errorf("Verify() error = %v, want allowed = %v", err, wantAllowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AWSImport is a policy converted from an IAM role trust policy
+type AWSImport struct {
+	// Policy has a rule for each subject pattern of the trust policy's
+	// statements, evaluated with EvaluationDenyOverrides like IAM
+	Policy *Policy
+
+	// Audiences are the aud values the trust policy accepts; configure
+	// them with WithAudience
+	Audiences []string
+
+	// Warnings describe statements that were skipped or converted with
+	// different semantics
+	Warnings []string
+}
+
+// awsStrings is an IAM value that may be a string or a list of strings
+type awsStrings []string
+
+// UnmarshalJSON accepts a string or a list of strings
+func (s *awsStrings) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = awsStrings{one}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("expected a string or a list of strings")
+	}
+	*s = many
+	return nil
+}
+
+// awsImportStatement is a trust policy statement as found in the wild
+type awsImportStatement struct {
+	Sid       string                           `json:"Sid"`
+	Effect    string                           `json:"Effect"`
+	Principal json.RawMessage                  `json:"Principal"`
+	Action    awsStrings                       `json:"Action"`
+	Condition map[string]map[string]awsStrings `json:"Condition"`
+}
+
+// awsStatements is a statement list, which IAM also allows as a single
+// statement
+type awsStatements []awsImportStatement
+
+// UnmarshalJSON accepts a statement or a list of statements
+func (s *awsStatements) UnmarshalJSON(data []byte) error {
+	var one awsImportStatement
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = awsStatements{one}
+		return nil
+	}
+
+	var many []awsImportStatement
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
+
+// ImportAWSTrustPolicy converts an IAM role trust policy for AWS's GitHub
+// Actions OIDC provider to a Policy. Statements for other principals or
+// actions are skipped with a warning, while conditions the policy cannot
+// express, such as other condition keys or operators, are errors.
+func ImportAWSTrustPolicy(data []byte) (*AWSImport, error) {
+	var doc struct {
+		Statement awsStatements `json:"Statement"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, NewPolicyError("", fmt.Sprintf("failed to parse trust policy: %v", err))
+	}
+
+	result := &AWSImport{
+		Policy: &Policy{DefaultDeny: true, EvaluationMode: EvaluationDenyOverrides},
+	}
+
+	for n, stmt := range doc.Statement {
+		name := stmt.Sid
+		if name == "" {
+			name = fmt.Sprintf("statement-%d", n+1)
+		}
+
+		host, ok := awsFederatedHost(stmt.Principal)
+		if !ok || !slices.ContainsFunc(stmt.Action, awsWebIdentityAction) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: skipped, it does not apply to web identity federation", name))
+			continue
+		}
+
+		effect := EffectAllow
+		switch stmt.Effect {
+		case "Allow":
+		case "Deny":
+			effect = EffectDeny
+		default:
+			return nil, NewPolicyError(name, fmt.Sprintf("unknown effect %q", stmt.Effect))
+		}
+
+		subjects, audiences, err := awsStatementConditions(stmt.Condition, host)
+		if err != nil {
+			return nil, NewPolicyError(name, err.Error())
+		}
+
+		if effect == EffectAllow {
+			if audiences == nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s: accepts any audience", name))
+			}
+			for _, aud := range audiences {
+				if !slices.Contains(result.Audiences, aud) {
+					result.Audiences = append(result.Audiences, aud)
+				}
+			}
+		}
+		if subjects == nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: has no sub condition and applies to every repository", name))
+			subjects = []string{"*"}
+		}
+
+		for k, subject := range subjects {
+			cond, err := awsSubjectConditions(subject)
+			if err != nil {
+				return nil, NewPolicyError(name, err.Error())
+			}
+
+			rule := Rule{Name: name, Conditions: cond, Effect: effect}
+			if len(subjects) > 1 {
+				rule.Name = name + "-" + strconv.Itoa(k+1)
+			}
+			result.Policy.Rules = append(result.Policy.Rules, rule)
+		}
+	}
+
+	if err := result.Policy.Validate(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// awsFederatedHost returns the issuer host of the OIDC provider a
+// statement's principal federates with
+func awsFederatedHost(principal json.RawMessage) (string, bool) {
+	var p struct {
+		Federated awsStrings `json:"Federated"`
+	}
+	if json.Unmarshal(principal, &p) != nil {
+		return "", false
+	}
+
+	for _, arn := range p.Federated {
+		if _, host, ok := strings.Cut(arn, ":oidc-provider/"); ok {
+			return host, true
+		}
+	}
+	return "", false
+}
+
+// awsWebIdentityAction reports whether an action pattern covers
+// sts:AssumeRoleWithWebIdentity
+func awsWebIdentityAction(action string) bool {
+	return Match(strings.ReplaceAll(strings.ToLower(action), "*", "**"), "sts:assumerolewithwebidentity")
+}
+
+// awsStatementConditions returns the sub patterns and aud values of a
+// statement's conditions, as IAM StringLike patterns. They are nil if
+// the statement has no condition on the key.
+func awsStatementConditions(conditions map[string]map[string]awsStrings, host string) (subjects, audiences []string, err error) {
+	for operator, keys := range conditions {
+		like := false
+		switch strings.TrimPrefix(operator, "ForAnyValue:") {
+		case "StringEquals":
+		case "StringLike":
+			like = true
+		default:
+			return nil, nil, fmt.Errorf("condition operator %s cannot be imported", operator)
+		}
+
+		for key, values := range keys {
+			patterns := make([]string, len(values))
+			for i, value := range values {
+				if !like {
+					// Literal values only need IAM's escapes for wildcards
+					value = strings.NewReplacer("$", "${$}", "*", "${*}", "?", "${?}").Replace(value)
+				}
+				patterns[i] = value
+			}
+
+			switch key {
+			case host + ":sub":
+				if subjects != nil {
+					return nil, nil, fmt.Errorf("multiple sub conditions cannot be imported")
+				}
+				subjects = patterns
+			case host + ":aud":
+				if audiences != nil {
+					return nil, nil, fmt.Errorf("multiple aud conditions cannot be imported")
+				}
+				for _, aud := range patterns {
+					glob, err := iamGlob(aud)
+					literal, ok := globLiteral(glob)
+					if err != nil || !ok {
+						return nil, nil, fmt.Errorf("aud pattern %q cannot be imported, audiences must be literal", aud)
+					}
+					audiences = append(audiences, literal)
+				}
+			default:
+				return nil, nil, fmt.Errorf("condition key %s cannot be imported", key)
+			}
+		}
+	}
+
+	return subjects, audiences, nil
+}
+
+// awsSubjectConditions converts a sub pattern in GitHub's default format
+// to rule conditions
+func awsSubjectConditions(subject string) (Conditions, error) {
+	if subject == "*" {
+		return Conditions{Repository: []string{"**"}}, nil
+	}
+
+	rest, ok := strings.CutPrefix(subject, "repo:")
+	if !ok {
+		return Conditions{}, fmt.Errorf("sub pattern %q is not in the default subject format", subject)
+	}
+
+	repo, tail, found := strings.Cut(rest, ":")
+	if !found && !strings.HasSuffix(repo, "*") {
+		return Conditions{}, fmt.Errorf("sub pattern %q matches no subject", subject)
+	}
+
+	repoPattern, err := iamGlob(repo)
+	if err != nil {
+		return Conditions{}, err
+	}
+	cond := Conditions{Repository: []string{repoPattern}}
+
+	switch {
+	case tail == "" || tail == "*":
+		// Any ref, environment or pull request
+
+	case tail == "pull_request":
+		cond.EventName = []string{"pull_request"}
+
+	case strings.HasPrefix(tail, "ref:"):
+		ref, err := iamGlob(strings.TrimPrefix(tail, "ref:"))
+		if err != nil {
+			return Conditions{}, err
+		}
+		cond.Ref = []string{ref}
+
+	case strings.HasPrefix(tail, "environment:"):
+		env, err := iamGlob(strings.TrimPrefix(tail, "environment:"))
+		if err != nil {
+			return Conditions{}, err
+		}
+		cond.Environment = []string{env}
+
+	default:
+		return Conditions{}, fmt.Errorf("sub pattern %q is not in the default subject format", subject)
+	}
+
+	return cond, nil
+}
+
+// iamGlob converts an IAM StringLike pattern to a glob pattern. IAM's '*'
+// matches across '/', so it becomes "**"; '?' does not match '/' in the
+// glob, which GitHub's subject values only contain in refs.
+func iamGlob(pattern string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString("**")
+		case '?':
+			b.WriteByte('?')
+		case '$':
+			end := strings.IndexByte(pattern[i:], '}')
+			variable := ""
+			if strings.HasPrefix(pattern[i:], "${") && end > 0 {
+				variable = pattern[i+2 : i+end]
+			}
+			if len(variable) != 1 || !strings.Contains("$*?", variable) {
+				return "", fmt.Errorf("policy variables in %q cannot be imported", pattern)
+			}
+			b.WriteString(globEscape(variable))
+			i += end
+		default:
+			b.WriteString(globEscape(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// globEscape escapes the glob metacharacters in a literal
+func globEscape(literal string) string {
+	var b strings.Builder
+	for i := 0; i < len(literal); i++ {
+		if strings.IndexByte(patternMeta, literal[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(literal[i])
+	}
+	return b.String()
+}
+
+// globLiteral returns the value a glob pattern without wildcards matches
+func globLiteral(glob string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+		case '*', '?', '[', '{':
+			return "", false
+		}
+		if i < len(glob) {
+			b.WriteByte(glob[i])
+		}
+	}
+	return b.String(), true
+}
@@ -0,0 +1,181 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testAWSTrustPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "Deploy",
+      "Effect": "Allow",
+      "Principal": {"Federated": "arn:aws:iam::123456789012:oidc-provider/token.actions.githubusercontent.com"},
+      "Action": "sts:AssumeRoleWithWebIdentity",
+      "Condition": {
+        "StringEquals": {"token.actions.githubusercontent.com:aud": "sts.amazonaws.com"},
+        "StringLike": {
+          "token.actions.githubusercontent.com:sub": [
+            "repo:myorg/api:ref:refs/heads/*",
+            "repo:myorg/web:environment:production",
+            "repo:myorg/docs:pull_request"
+          ]
+        }
+      }
+    },
+    {
+      "Effect": "Deny",
+      "Principal": {"Federated": ["arn:aws:iam::123456789012:oidc-provider/token.actions.githubusercontent.com"]},
+      "Action": ["sts:*"],
+      "Condition": {"StringEquals": {"token.actions.githubusercontent.com:sub": "repo:myorg/api:ref:refs/heads/experimental"}}
+    },
+    {
+      "Effect": "Allow",
+      "Principal": {"Service": "ec2.amazonaws.com"},
+      "Action": "sts:AssumeRole"
+    }
+  ]
+}`
+
+func TestImportAWSTrustPolicy(t *testing.T) {
+	imported, err := ImportAWSTrustPolicy([]byte(testAWSTrustPolicy))
+	if err != nil {
+		t.Fatalf("ImportAWSTrustPolicy() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(imported.Audiences, []string{"sts.amazonaws.com"}) {
+		t.Errorf("Audiences = %v, want [sts.amazonaws.com]", imported.Audiences)
+	}
+	if len(imported.Warnings) != 1 || !strings.Contains(imported.Warnings[0], "statement-3: skipped") {
+		t.Errorf("Warnings = %q, want the EC2 statement skipped", imported.Warnings)
+	}
+
+	policy := imported.Policy
+	if !policy.DefaultDeny || policy.EvaluationMode != EvaluationDenyOverrides {
+		t.Errorf("policy = %+v, want default deny with deny-overrides", policy)
+	}
+
+	want := []Rule{
+		{Name: "Deploy-1", Conditions: Conditions{Repository: []string{"myorg/api"}, Ref: []string{"refs/heads/**"}}, Effect: EffectAllow},
+		{Name: "Deploy-2", Conditions: Conditions{Repository: []string{"myorg/web"}, Environment: []string{"production"}}, Effect: EffectAllow},
+		{Name: "Deploy-3", Conditions: Conditions{Repository: []string{"myorg/docs"}, EventName: []string{"pull_request"}}, Effect: EffectAllow},
+		{Name: "statement-2", Conditions: Conditions{Repository: []string{"myorg/api"}, Ref: []string{"refs/heads/experimental"}}, Effect: EffectDeny},
+	}
+	if !reflect.DeepEqual(policy.Rules, want) {
+		got, _ := json.MarshalIndent(policy.Rules, "", "  ")
+		t.Errorf("Rules = %s", got)
+	}
+
+	tests := []struct {
+		name   string
+		claims GitHubActionsClaims
+		want   bool
+	}{
+		{name: "branch", claims: GitHubActionsClaims{Repository: "myorg/api", Ref: "refs/heads/feature/x"}, want: true},
+		{name: "denied branch", claims: GitHubActionsClaims{Repository: "myorg/api", Ref: "refs/heads/experimental"}, want: false},
+		{name: "environment", claims: GitHubActionsClaims{Repository: "myorg/web", Environment: "production"}, want: true},
+		{name: "pull request", claims: GitHubActionsClaims{Repository: "myorg/docs", EventName: "pull_request"}, want: true},
+		{name: "other repository", claims: GitHubActionsClaims{Repository: "myorg/other", Ref: "refs/heads/main"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Evaluate(&tt.claims).Allowed; got != tt.want {
+				t.Errorf("Evaluate() allowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportAWSTrustPolicy_Errors(t *testing.T) {
+	statement := func(condition string) string {
+		return `{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+			"Principal": {"Federated": "arn:aws:iam::1:oidc-provider/token.actions.githubusercontent.com"},
+			"Condition": ` + condition + `}}`
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "malformed JSON", data: `{"Statement": [`, wantErr: "failed to parse"},
+		{name: "unsupported operator", data: statement(`{"StringNotLike": {"token.actions.githubusercontent.com:sub": "repo:x/y:*"}}`), wantErr: "operator StringNotLike"},
+		{name: "unsupported key", data: statement(`{"StringEquals": {"token.actions.githubusercontent.com:actor": "johndoe"}}`), wantErr: "condition key"},
+		{name: "custom subject format", data: statement(`{"StringLike": {"token.actions.githubusercontent.com:sub": "repo:myorg/api:job_workflow_ref:*"}}`), wantErr: "default subject format"},
+		{name: "policy variable", data: statement(`{"StringLike": {"token.actions.githubusercontent.com:sub": "repo:${aws:username}/*"}}`), wantErr: "policy variables"},
+		{name: "wildcard audience", data: statement(`{"StringLike": {"token.actions.githubusercontent.com:aud": "sts.*"}}`), wantErr: "audiences must be literal"},
+		{name: "no statements", data: `{"Statement": []}`, wantErr: "at least one rule"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ImportAWSTrustPolicy([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ImportAWSTrustPolicy() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImportAWSTrustPolicy_Literals(t *testing.T) {
+	data := `{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRoleWithWebIdentity",
+		"Principal": {"Federated": "arn:aws:iam::1:oidc-provider/token.actions.githubusercontent.com"},
+		"Condition": {"StringEquals": {"token.actions.githubusercontent.com:sub": "repo:myorg/api:environment:prod*"}}}}`
+
+	imported, err := ImportAWSTrustPolicy([]byte(data))
+	if err != nil {
+		t.Fatalf("ImportAWSTrustPolicy() error = %v", err)
+	}
+	if len(imported.Warnings) != 1 || !strings.Contains(imported.Warnings[0], "any audience") {
+		t.Errorf("Warnings = %q, want an audience warning", imported.Warnings)
+	}
+
+	env := imported.Policy.Rules[0].Conditions.Environment
+	if !reflect.DeepEqual(env, []string{`prod\*`}) {
+		t.Errorf("Environment = %q, want an escaped literal", env)
+	}
+	if !Match(env[0], "prod*") || Match(env[0], "production") {
+		t.Errorf("pattern %q does not match the literal only", env[0])
+	}
+}
+
+func TestImportAWSTrustPolicy_RoundTrip(t *testing.T) {
+	policy := &Policy{
+		DefaultDeny:    true,
+		EvaluationMode: EvaluationDenyOverrides,
+		Rules: []Rule{
+			{Name: "tags", Conditions: Conditions{RepositoryOwner: []string{"myorg"}, RefType: []string{"tag"}}, Effect: EffectAllow},
+			{Name: "prod", Conditions: Conditions{Repository: []string{"myorg/api"}, Environment: []string{"production"}}, Effect: EffectAllow},
+			{Name: "legacy", Conditions: Conditions{Repository: []string{"myorg/legacy"}}, Effect: EffectDeny},
+		},
+	}
+
+	doc, _, err := policy.ExportAWSTrustPolicy(AWSExportOptions{})
+	if err != nil {
+		t.Fatalf("ExportAWSTrustPolicy() error = %v", err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportAWSTrustPolicy(data)
+	if err != nil {
+		t.Fatalf("ImportAWSTrustPolicy() error = %v", err)
+	}
+
+	claims := []GitHubActionsClaims{
+		{Repository: "myorg/api", RepositoryOwner: "myorg", Ref: "refs/tags/v1", RefType: "tag"},
+		{Repository: "myorg/api", RepositoryOwner: "myorg", Ref: "refs/heads/main", RefType: "branch"},
+		{Repository: "myorg/api", RepositoryOwner: "myorg", Environment: "production"},
+		{Repository: "myorg/legacy", RepositoryOwner: "myorg", Ref: "refs/tags/v1", RefType: "tag"},
+		{Repository: "other/api", RepositoryOwner: "other", Ref: "refs/tags/v1", RefType: "tag"},
+	}
+	for _, c := range claims {
+		if got, want := imported.Policy.Evaluate(&c).Allowed, policy.Evaluate(&c).Allowed; got != want {
+			t.Errorf("claims %+v: imported policy allowed = %v, original = %v", c, got, want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ghaauth
+
+import "regexp"
+
+// NewPolicyFromClaims returns a default-deny starter policy with a single
+// rule pinned to the repository, ref, workflow and environment of the given
+// claims. It is meant as a tight starting point that can be widened by hand.
+// Values are escaped so that they only match themselves, and empty claims
+// get no condition; claims without any of them give a policy that fails
+// Validate.
+func NewPolicyFromClaims(claims *GitHubActionsClaims) *Policy {
+	var cond Conditions
+	if pattern, ok := exactPattern(claims.Repository); ok {
+		cond.Repository = []string{pattern}
+	}
+	if pattern, ok := exactPattern(claims.Ref); ok {
+		cond.Ref = []string{pattern}
+	}
+	if pattern, ok := exactPattern(claims.WorkflowRef); ok {
+		cond.WorkflowRef = []string{pattern}
+	}
+	if pattern, ok := exactPattern(claims.Environment); ok {
+		cond.Environment = []string{pattern}
+	}
+
+	return &Policy{
+		Rules: []Rule{
+			{
+				Name:       "allow-" + claims.Repository,
+				Conditions: cond,
+				Effect:     EffectAllow,
+			},
+		},
+		DefaultDeny: true,
+	}
+}
+
+// exactPattern returns a pattern matching only value, a regular expression
+// for values that would read as one. Empty values have none.
+func exactPattern(value string) (string, bool) {
+	if pattern, ok := literalPattern(value); ok {
+		return pattern, true
+	}
+	if value == "" {
+		return "", false
+	}
+	return RegexPrefix + regexp.QuoteMeta(value), true
+}
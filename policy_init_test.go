@@ -0,0 +1,97 @@
+package ghaauth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewPolicyFromClaims(t *testing.T) {
+	claims := &GitHubActionsClaims{
+		Repository:      "myorg/myrepo",
+		RepositoryOwner: "myorg",
+		Ref:             "refs/heads/main",
+		Workflow:        "Deploy",
+		WorkflowRef:     "myorg/myrepo/.github/workflows/deploy.yml@refs/heads/main",
+		EventName:       "push",
+		Actor:           "johndoe",
+		Environment:     "production",
+	}
+
+	policy := NewPolicyFromClaims(claims)
+
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !policy.DefaultDeny {
+		t.Error("DefaultDeny = false, want true")
+	}
+	if len(policy.Rules) != 1 {
+		t.Fatalf("len(Rules) = %d, want 1", len(policy.Rules))
+	}
+
+	rule := policy.Rules[0]
+	want := Conditions{
+		Repository:  []string{"myorg/myrepo"},
+		Ref:         []string{"refs/heads/main"},
+		WorkflowRef: []string{"myorg/myrepo/.github/workflows/deploy.yml@refs/heads/main"},
+		Environment: []string{"production"},
+	}
+	if !reflect.DeepEqual(rule.Conditions, want) {
+		t.Errorf("Conditions = %+v, want %+v", rule.Conditions, want)
+	}
+
+	// The generated policy allows the claims it was generated from
+	if result := policy.Evaluate(claims); !result.Allowed {
+		t.Errorf("Evaluate() denied source claims: %s", result.Reason)
+	}
+
+	// ...but not a different branch
+	other := *claims
+	other.Ref = "refs/heads/feature"
+	if result := policy.Evaluate(&other); result.Allowed {
+		t.Error("Evaluate() allowed a different ref")
+	}
+}
+
+func TestNewPolicyFromClaims_OptionalClaims(t *testing.T) {
+	policy := NewPolicyFromClaims(&GitHubActionsClaims{
+		Repository: "myorg/myrepo",
+		Ref:        "refs/heads/main",
+	})
+
+	cond := policy.Rules[0].Conditions
+	if cond.WorkflowRef != nil || cond.Environment != nil {
+		t.Errorf("Conditions = %+v, want no workflow_ref or environment", cond)
+	}
+}
+
+func TestNewPolicyFromClaims_Escaping(t *testing.T) {
+	claims := &GitHubActionsClaims{
+		Repository:  "myorg/myrepo",
+		Ref:         "refs/heads/feature/[wip]*",
+		WorkflowRef: "re:odd/name",
+		Environment: "prod {eu}",
+	}
+	policy := NewPolicyFromClaims(claims)
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if result := policy.Evaluate(claims); !result.Allowed {
+		t.Errorf("Evaluate() denied source claims: %s", result.Reason)
+	}
+
+	for _, other := range []GitHubActionsClaims{
+		{Repository: "myorg/myrepo", Ref: "refs/heads/feature/w-anything", WorkflowRef: claims.WorkflowRef, Environment: claims.Environment},
+		{Repository: "myorg/myrepo", Ref: claims.Ref, WorkflowRef: "re:oddxname", Environment: claims.Environment},
+		{Repository: "myorg/myrepo", Ref: claims.Ref, WorkflowRef: claims.WorkflowRef, Environment: "prod eu"},
+	} {
+		if result := policy.Evaluate(&other); result.Allowed {
+			t.Errorf("Evaluate() allowed %+v", other)
+		}
+	}
+
+	// Without any claim the rule has no condition and the policy is invalid
+	if err := NewPolicyFromClaims(&GitHubActionsClaims{}).Validate(); err == nil {
+		t.Error("Validate() error = nil for a policy from empty claims")
+	}
+}
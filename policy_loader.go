@@ -0,0 +1,119 @@
+package ghaauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dev-shimada/gha-auth/internal/yamlutil"
+)
+
+// ParsePolicy decodes a JSON policy document, expands its condition sets
+// and validates it. Documents that do not conform to PolicySchema, e.g.
+// with a misspelled condition, are rejected with the ValidateDocument
+// problems.
+func ParsePolicy(data []byte) (*Policy, error) {
+	if problems := ValidateDocument(data); len(problems) > 0 {
+		reasons := make([]string, len(problems))
+		for i, problem := range problems {
+			reasons[i] = problem.Error()
+		}
+		return nil, NewPolicyError("", "invalid policy document: "+strings.Join(reasons, "; "))
+	}
+
+	var policy Policy
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&policy); err != nil {
+		return nil, NewPolicyError("", fmt.Sprintf("failed to decode policy: %v", err))
+	}
+
+	if err := policy.ExpandConditionSets(); err != nil {
+		return nil, err
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// ParsePolicyYAML decodes a YAML policy document and validates it. The YAML
+// keys are the same as the JSON field names.
+func ParsePolicyYAML(data []byte) (*Policy, error) {
+	jsonData, err := yamlutil.ToJSON(data)
+	if err != nil {
+		return nil, NewPolicyError("", fmt.Sprintf("failed to decode policy: %v", err))
+	}
+
+	return ParsePolicy(jsonData)
+}
+
+// LoadPolicyFile reads and parses a policy document from disk. Files with a
+// .yaml or .yml extension are parsed as YAML, everything else as JSON.
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	return parsePolicyFile(path, data)
+}
+
+// parsePolicyFile parses the contents of a policy file as YAML or JSON
+// according to its extension
+func parsePolicyFile(path string, data []byte) (*Policy, error) {
+	if yamlutil.IsYAMLFile(path) {
+		return ParsePolicyYAML(data)
+	}
+	return ParsePolicy(data)
+}
+
+// LoadPolicyDir loads every JSON and YAML policy file in a directory and
+// merges them in file name order, so that each team can own its own file.
+// Each file must be a valid policy on its own; see Policy.Merge for how
+// conflicts are handled.
+func LoadPolicyDir(dir string) (*Policy, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if yamlutil.IsYAMLFile(entry.Name()) || strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return nil, NewPolicyError("", fmt.Sprintf("no policy files in %s", dir))
+	}
+
+	policies := make([]*Policy, 0, len(names))
+	for _, name := range names {
+		policy, err := LoadPolicyFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		policies = append(policies, policy)
+	}
+
+	merged, err := policies[0].Merge(policies[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,184 @@
+package ghaauth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicyJSON = `{
+	"rules": [
+		{
+			"name": "allow-myorg",
+			"conditions": {"repository_owner": ["myorg"]},
+			"effect": "allow"
+		}
+	],
+	"default_deny": true
+}`
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "valid policy",
+			data: testPolicyJSON,
+		},
+		{
+			name:    "malformed JSON",
+			data:    `{"rules": [`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid policy",
+			data:    `{"rules": []}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParsePolicy([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ParsePolicy() error = nil, want error")
+				}
+				var policyErr *PolicyError
+				if !errors.As(err, &policyErr) {
+					t.Errorf("ParsePolicy() error = %T, want *PolicyError", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParsePolicy() error = %v", err)
+			}
+			if len(policy.Rules) != 1 || policy.Rules[0].Name != "allow-myorg" {
+				t.Errorf("ParsePolicy() rules = %+v", policy.Rules)
+			}
+			if !policy.DefaultDeny {
+				t.Error("ParsePolicy() DefaultDeny = false, want true")
+			}
+		})
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(testPolicyJSON), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+
+	policy, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatalf("LoadPolicyFile() error = %v", err)
+	}
+	if len(policy.Rules) != 1 {
+		t.Errorf("len(Rules) = %d, want 1", len(policy.Rules))
+	}
+
+	yamlPath := filepath.Join(t.TempDir(), "policy.yaml")
+	yamlPolicy := `
+rules:
+  - name: allow-myorg
+    conditions:
+      repository_owner: [myorg]
+    effect: allow
+default_deny: true
+`
+	if err := os.WriteFile(yamlPath, []byte(yamlPolicy), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+
+	policy, err = LoadPolicyFile(yamlPath)
+	if err != nil {
+		t.Fatalf("LoadPolicyFile() YAML error = %v", err)
+	}
+	if len(policy.Rules) != 1 || !policy.DefaultDeny {
+		t.Errorf("LoadPolicyFile() YAML policy = %+v", policy)
+	}
+
+	if _, err := LoadPolicyFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadPolicyFile() error = nil for missing file")
+	}
+}
+
+func TestLoadPolicyDir(t *testing.T) {
+	writeFiles := func(t *testing.T, files map[string]string) string {
+		t.Helper()
+		dir := t.TempDir()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+				t.Fatalf("failed to write %s: %v", name, err)
+			}
+		}
+		return dir
+	}
+
+	teamA := `
+rules:
+  - name: team-a-deploy
+    conditions:
+      repository: [myorg/a-*]
+    effect: allow
+default_deny: true
+`
+	teamB := `{"rules": [{"name": "team-b-deploy", "conditions": {"repository": ["myorg/b-*"]}, "effect": "allow"}]}`
+
+	t.Run("merges files in name order", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{
+			"20-team-b.json": teamB,
+			"10-team-a.yaml": teamA,
+			"README.md":      "not a policy",
+			".hidden.json":   "{",
+		})
+
+		policy, err := LoadPolicyDir(dir)
+		if err != nil {
+			t.Fatalf("LoadPolicyDir() error = %v", err)
+		}
+
+		if len(policy.Rules) != 2 || policy.Rules[0].Name != "team-a-deploy" || policy.Rules[1].Name != "team-b-deploy" {
+			t.Errorf("Rules = %+v, want team-a-deploy then team-b-deploy", policy.Rules)
+		}
+		if !policy.DefaultDeny {
+			t.Error("DefaultDeny = false, want true when any file denies by default")
+		}
+	})
+
+	t.Run("duplicate rule names conflict", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{
+			"a.yaml": teamA,
+			"b.yaml": teamA,
+		})
+
+		_, err := LoadPolicyDir(dir)
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) || policyErr.Rule != "team-a-deploy" {
+			t.Errorf("LoadPolicyDir() error = %v, want conflict on team-a-deploy", err)
+		}
+	})
+
+	t.Run("invalid file is named", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{
+			"a.yaml":   teamA,
+			"bad.json": `{"rules": []}`,
+		})
+
+		_, err := LoadPolicyDir(dir)
+		if err == nil || !strings.Contains(err.Error(), "bad.json") {
+			t.Errorf("LoadPolicyDir() error = %v, want error naming bad.json", err)
+		}
+	})
+
+	t.Run("empty directory", func(t *testing.T) {
+		if _, err := LoadPolicyDir(t.TempDir()); err == nil {
+			t.Error("LoadPolicyDir() error = nil for empty directory")
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package ghaauth
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Merge combines the policy with others into a new policy. Rules keep
+// their order, with the receiver's rules first. The result denies by
+// default, and denies fork pull requests, if any input does. Rule names
+// must be unique across all inputs, inputs that set an evaluation mode must
+// agree on it, and condition sets with the same name must be identical.
+// The metadata is that of the first input with metadata, with the versions
+// of all inputs joined by "+" and the latest UpdatedAt.
+func (p *Policy) Merge(others ...*Policy) (*Policy, error) {
+	merged := &Policy{}
+	owners := make(map[string]int)
+
+	for i, policy := range append([]*Policy{p}, others...) {
+		if policy == nil {
+			continue
+		}
+
+		mergeMetadata(merged, policy.Metadata)
+
+		if policy.DeniesByDefault() {
+			merged.DefaultDeny = true
+		}
+		if policy.DenyForkPullRequests {
+			merged.DenyForkPullRequests = true
+		}
+		if policy.RequireEnvironmentScopedToken {
+			merged.RequireEnvironmentScopedToken = true
+		}
+
+		if policy.EvaluationMode != "" {
+			if merged.EvaluationMode != "" && merged.EvaluationMode != policy.EvaluationMode {
+				return nil, NewPolicyError("", fmt.Sprintf("conflicting evaluation modes %q and %q", merged.EvaluationMode, policy.EvaluationMode))
+			}
+			merged.EvaluationMode = policy.EvaluationMode
+		}
+
+		for name, set := range policy.ConditionSets {
+			if existing, ok := merged.ConditionSets[name]; ok && !reflect.DeepEqual(existing, set) {
+				return nil, NewPolicyError("", fmt.Sprintf("condition set %q is defined differently by more than one policy", name))
+			}
+			if merged.ConditionSets == nil {
+				merged.ConditionSets = make(map[string]Conditions)
+			}
+			merged.ConditionSets[name] = set
+		}
+
+		for _, rule := range policy.Rules {
+			if rule.Name != "" {
+				if owner, ok := owners[rule.Name]; ok && owner != i {
+					return nil, NewPolicyError(rule.Name, "rule name is defined by more than one policy")
+				}
+				owners[rule.Name] = i
+			}
+			merged.Rules = append(merged.Rules, rule)
+		}
+	}
+
+	return merged, nil
+}
+
+// mergeMetadata merges the metadata of an input into the merged policy
+func mergeMetadata(merged *Policy, metadata *PolicyMetadata) {
+	if metadata == nil {
+		return
+	}
+	if merged.Metadata == nil {
+		copied := *metadata
+		merged.Metadata = &copied
+		return
+	}
+
+	switch {
+	case metadata.Version == "":
+	case merged.Metadata.Version == "":
+		merged.Metadata.Version = metadata.Version
+	default:
+		merged.Metadata.Version += "+" + metadata.Version
+	}
+	if metadata.UpdatedAt != nil && (merged.Metadata.UpdatedAt == nil || metadata.UpdatedAt.After(*merged.Metadata.UpdatedAt)) {
+		merged.Metadata.UpdatedAt = metadata.UpdatedAt
+	}
+}
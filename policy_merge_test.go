@@ -0,0 +1,148 @@
+package ghaauth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Merge(t *testing.T) {
+	allowA := Rule{Name: "allow-a", Conditions: Conditions{Repository: []string{"myorg/a"}}, Effect: EffectAllow}
+	allowB := Rule{Name: "allow-b", Conditions: Conditions{Repository: []string{"myorg/b"}}, Effect: EffectAllow}
+	unnamed := Rule{Conditions: Conditions{Actor: []string{"bot"}}, Effect: EffectDeny}
+
+	tests := []struct {
+		name            string
+		base            *Policy
+		others          []*Policy
+		wantRules       []string
+		wantDefaultDeny bool
+		wantDenyForks   bool
+		wantMode        EvaluationMode
+		wantConflict    string
+	}{
+		{
+			name:            "concatenates rules in order",
+			base:            &Policy{Rules: []Rule{allowA}},
+			others:          []*Policy{{Rules: []Rule{unnamed, allowB}, DefaultDeny: true}},
+			wantRules:       []string{"allow-a", "", "allow-b"},
+			wantDefaultDeny: true,
+		},
+		{
+			name:          "any policy can deny fork pull requests",
+			base:          &Policy{Rules: []Rule{allowA}},
+			others:        []*Policy{{Rules: []Rule{allowB}, DenyForkPullRequests: true}},
+			wantRules:     []string{"allow-a", "allow-b"},
+			wantDenyForks: true,
+		},
+		{
+			name:      "nil policies are skipped",
+			base:      nil,
+			others:    []*Policy{nil, {Rules: []Rule{allowB}}},
+			wantRules: []string{"allow-b"},
+		},
+		{
+			name:      "unnamed rules never conflict",
+			base:      &Policy{Rules: []Rule{unnamed}},
+			others:    []*Policy{{Rules: []Rule{unnamed}}},
+			wantRules: []string{"", ""},
+		},
+		{
+			name:      "matching evaluation modes",
+			base:      &Policy{Rules: []Rule{allowA}, EvaluationMode: EvaluationDenyOverrides},
+			others:    []*Policy{{Rules: []Rule{allowB}}, {Rules: []Rule{unnamed}, EvaluationMode: EvaluationDenyOverrides}},
+			wantRules: []string{"allow-a", "allow-b", ""},
+			wantMode:  EvaluationDenyOverrides,
+		},
+		{
+			name:         "duplicate rule name",
+			base:         &Policy{Rules: []Rule{allowA}},
+			others:       []*Policy{{Rules: []Rule{allowA}}},
+			wantConflict: "allow-a",
+		},
+		{
+			name:         "conflicting condition sets",
+			base:         &Policy{Rules: []Rule{allowA}, ConditionSets: map[string]Conditions{"prod": {Ref: []string{"refs/heads/main"}}}},
+			others:       []*Policy{{Rules: []Rule{allowB}, ConditionSets: map[string]Conditions{"prod": {Ref: []string{"refs/heads/master"}}}}},
+			wantConflict: "prod",
+		},
+		{
+			name:         "conflicting evaluation modes",
+			base:         &Policy{Rules: []Rule{allowA}, EvaluationMode: EvaluationDenyOverrides},
+			others:       []*Policy{{Rules: []Rule{allowB}, EvaluationMode: EvaluationAllowOverrides}},
+			wantConflict: "evaluation mode",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := tt.base.Merge(tt.others...)
+
+			if tt.wantConflict != "" {
+				var policyErr *PolicyError
+				if !errors.As(err, &policyErr) || !strings.Contains(err.Error(), tt.wantConflict) {
+					t.Fatalf("Merge() error = %v, want PolicyError mentioning %q", err, tt.wantConflict)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge() error = %v", err)
+			}
+
+			var names []string
+			for _, rule := range merged.Rules {
+				names = append(names, rule.Name)
+			}
+			if len(names) != len(tt.wantRules) {
+				t.Fatalf("rules = %q, want %q", names, tt.wantRules)
+			}
+			for i := range names {
+				if names[i] != tt.wantRules[i] {
+					t.Errorf("rules = %q, want %q", names, tt.wantRules)
+					break
+				}
+			}
+
+			if merged.DefaultDeny != tt.wantDefaultDeny {
+				t.Errorf("DefaultDeny = %v, want %v", merged.DefaultDeny, tt.wantDefaultDeny)
+			}
+			if merged.DenyForkPullRequests != tt.wantDenyForks {
+				t.Errorf("DenyForkPullRequests = %v, want %v", merged.DenyForkPullRequests, tt.wantDenyForks)
+			}
+			if merged.EvaluationMode != tt.wantMode {
+				t.Errorf("EvaluationMode = %q, want %q", merged.EvaluationMode, tt.wantMode)
+			}
+		})
+	}
+
+	t.Run("inputs are not modified", func(t *testing.T) {
+		base := &Policy{Rules: []Rule{allowA}}
+		if _, err := base.Merge(&Policy{Rules: []Rule{allowB}}); err != nil {
+			t.Fatalf("Merge() error = %v", err)
+		}
+		if len(base.Rules) != 1 {
+			t.Errorf("base rules = %d, want 1", len(base.Rules))
+		}
+	})
+	t.Run("metadata", func(t *testing.T) {
+		older := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+		newer := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+		base := &Policy{Metadata: &PolicyMetadata{Version: "base-3", Owner: "platform", UpdatedAt: &older}, Rules: []Rule{allowA}}
+		team := &Policy{Metadata: &PolicyMetadata{Version: "team-7", Owner: "team", UpdatedAt: &newer}, Rules: []Rule{allowB}}
+
+		merged, err := base.Merge(&Policy{Rules: []Rule{unnamed}}, team)
+		if err != nil {
+			t.Fatalf("Merge() error = %v", err)
+		}
+		if got := merged.Version(); got != "base-3+team-7" {
+			t.Errorf("Version() = %q, want base-3+team-7", got)
+		}
+		if merged.Metadata.Owner != "platform" || !merged.Metadata.UpdatedAt.Equal(newer) {
+			t.Errorf("Metadata = %+v, want base owner and latest update", merged.Metadata)
+		}
+		if base.Metadata.Version != "base-3" {
+			t.Errorf("base version = %q, want it unmodified", base.Metadata.Version)
+		}
+	})
+}
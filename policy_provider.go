@@ -0,0 +1,192 @@
+package ghaauth
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// PolicyProvider supplies the policy used for each verification
+type PolicyProvider interface {
+	// Policy returns the currently active policy
+	Policy() *Policy
+}
+
+// FilePolicyOption configures a FilePolicyProvider
+type FilePolicyOption func(*FilePolicyProvider)
+
+// WithReloadErrorHandler sets a callback invoked when a changed policy file
+// cannot be loaded. The previously active policy stays in effect.
+func WithReloadErrorHandler(handler func(error)) FilePolicyOption {
+	return func(p *FilePolicyProvider) {
+		p.onError = handler
+	}
+}
+
+// WithReloadLogger sets the logger for policy reloads: successful reloads
+// are logged at info level, failures at warn level
+func WithReloadLogger(logger *slog.Logger) FilePolicyOption {
+	return func(p *FilePolicyProvider) {
+		if logger == nil {
+			logger = discardLogger
+		}
+		p.logger = logger
+	}
+}
+
+// WithPolicySignature only loads the policy file if its detached
+// signature verifies (see LoadSignedPolicyFile). Changes to either file
+// trigger a reload; a policy whose signature does not verify is reported
+// like any other reload failure and the previous policy stays in effect.
+func WithPolicySignature(verify PolicySignatureVerifier) FilePolicyOption {
+	return func(p *FilePolicyProvider) {
+		p.verify = verify
+	}
+}
+
+// FilePolicyProvider loads a policy from a file and reloads it whenever the
+// file changes
+type FilePolicyProvider struct {
+	path    string
+	verify  PolicySignatureVerifier
+	onError func(error)
+	logger  *slog.Logger
+
+	policy  atomic.Pointer[Policy]
+	watcher *fsnotify.Watcher
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewFilePolicyProvider loads the policy file and starts watching it for
+// changes. Call Close to stop watching.
+func NewFilePolicyProvider(path string, opts ...FilePolicyOption) (*FilePolicyProvider, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve policy file path: %w", err)
+	}
+
+	p := &FilePolicyProvider{
+		path:   absPath,
+		logger: discardLogger,
+		done:   make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	policy, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	p.policy.Store(policy)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create policy file watcher: %w", err)
+	}
+
+	// Watch the directory rather than the file so that editors and
+	// ConfigMap updates that replace the file are picked up as well
+	if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("failed to watch policy file: %w", err)
+	}
+	p.watcher = watcher
+
+	go p.watch()
+
+	return p, nil
+}
+
+// Policy returns the most recently loaded policy
+func (p *FilePolicyProvider) Policy() *Policy {
+	return p.policy.Load()
+}
+
+// Reload reads the policy file and swaps in the new policy if it is valid
+func (p *FilePolicyProvider) Reload() error {
+	policy, err := p.load()
+	if err != nil {
+		return err
+	}
+
+	p.policy.Store(policy)
+	p.logger.Info("policy reloaded", slog.String("path", p.path), slog.Int("rules", len(policy.Rules)))
+	return nil
+}
+
+// load reads the policy file, checking its signature if required
+func (p *FilePolicyProvider) load() (*Policy, error) {
+	if p.verify != nil {
+		return LoadSignedPolicyFile(p.path, p.verify)
+	}
+	return LoadPolicyFile(p.path)
+}
+
+// Close stops watching the policy file
+func (p *FilePolicyProvider) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		err = p.watcher.Close()
+		<-p.done
+	})
+	return err
+}
+
+// watch reloads the policy on relevant file system events
+func (p *FilePolicyProvider) watch() {
+	defer close(p.done)
+
+	for {
+		select {
+		case event, ok := <-p.watcher.Events:
+			if !ok {
+				return
+			}
+			if !p.affectsPolicy(event) {
+				continue
+			}
+			if err := p.Reload(); err != nil {
+				p.reportError(err)
+			}
+
+		case err, ok := <-p.watcher.Errors:
+			if !ok {
+				return
+			}
+			p.reportError(err)
+		}
+	}
+}
+
+// affectsPolicy reports whether an event may have changed the policy file
+// or its signature
+func (p *FilePolicyProvider) affectsPolicy(event fsnotify.Event) bool {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+		return false
+	}
+
+	name := filepath.Clean(event.Name)
+	if p.verify != nil && name == p.path+PolicySignatureSuffix {
+		return true
+	}
+
+	// Kubernetes ConfigMap volumes swap a "..data" symlink instead of
+	// writing the file itself
+	return name == p.path || filepath.Base(name) == "..data"
+}
+
+// reportError logs reload errors and forwards them to the configured handler
+func (p *FilePolicyProvider) reportError(err error) {
+	p.logger.Warn("policy reload failed", slog.String("path", p.path), slog.String("error", err.Error()))
+	if p.onError != nil {
+		p.onError(err)
+	}
+}
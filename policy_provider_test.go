@@ -0,0 +1,123 @@
+package ghaauth
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it returns true or the timeout expires
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestFilePolicyProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(testPolicyJSON), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+
+	var reloadErrors atomic.Int32
+	provider, err := NewFilePolicyProvider(path, WithReloadErrorHandler(func(error) {
+		reloadErrors.Add(1)
+	}))
+	if err != nil {
+		t.Fatalf("NewFilePolicyProvider() error = %v", err)
+	}
+	defer func() { _ = provider.Close() }()
+
+	if got := provider.Policy().Rules[0].Name; got != "allow-myorg" {
+		t.Fatalf("initial rule = %q, want %q", got, "allow-myorg")
+	}
+
+	t.Run("reloads on change", func(t *testing.T) {
+		updated := strings.ReplaceAll(testPolicyJSON, "allow-myorg", "allow-updated")
+		if err := os.WriteFile(path, []byte(updated), 0o600); err != nil {
+			t.Fatalf("failed to update policy file: %v", err)
+		}
+
+		ok := waitFor(t, 2*time.Second, func() bool {
+			return provider.Policy().Rules[0].Name == "allow-updated"
+		})
+		if !ok {
+			t.Errorf("policy was not reloaded, rule = %q", provider.Policy().Rules[0].Name)
+		}
+	})
+
+	t.Run("keeps previous policy on invalid change", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte(`{"rules": []}`), 0o600); err != nil {
+			t.Fatalf("failed to update policy file: %v", err)
+		}
+
+		if !waitFor(t, 2*time.Second, func() bool { return reloadErrors.Load() > 0 }) {
+			t.Fatal("reload error handler was not called")
+		}
+		if got := provider.Policy().Rules[0].Name; got != "allow-updated" {
+			t.Errorf("rule = %q, want previous policy to stay active", got)
+		}
+	})
+}
+
+func TestNewFilePolicyProvider_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`not json`), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+
+	if _, err := NewFilePolicyProvider(path); err == nil {
+		t.Error("NewFilePolicyProvider() error = nil, want error")
+	}
+}
+
+func TestFilePolicyProvider_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(testPolicyJSON), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+
+	provider, err := NewFilePolicyProvider(path)
+	if err != nil {
+		t.Fatalf("NewFilePolicyProvider() error = %v", err)
+	}
+
+	if err := provider.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if err := provider.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestFilePolicyProvider_ReloadLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(testPolicyJSON), 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	provider, err := NewFilePolicyProvider(path, WithReloadLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	if err != nil {
+		t.Fatalf("NewFilePolicyProvider() error = %v", err)
+	}
+	defer func() { _ = provider.Close() }()
+
+	if err := provider.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), `msg="policy reloaded"`) {
+		t.Errorf("logs = %q, want policy reloaded", buf.String())
+	}
+}
@@ -0,0 +1,264 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultRecommendMaxValues is the most distinct values Policy.Recommend
+// narrows a wildcard pattern to
+const DefaultRecommendMaxValues = 5
+
+// DecisionRecord is a verification decision as written by WithDecisionLog
+// and read by Policy.Recommend
+type DecisionRecord struct {
+	// Time is when the decision was made
+	Time time.Time `json:"time"`
+
+	// Allowed reports whether the token passed verification
+	Allowed bool `json:"allowed"`
+
+	// Claims are the verified claims
+	Claims *GitHubActionsClaims `json:"claims"`
+}
+
+// ReadDecisionRecords reads the JSON Lines written by WithDecisionLog
+func ReadDecisionRecords(r io.Reader) ([]DecisionRecord, error) {
+	var records []DecisionRecord
+	dec := json.NewDecoder(r)
+	for {
+		var record DecisionRecord
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("decision record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// RecommendOptions configures Policy.Recommend
+type RecommendOptions struct {
+	// MaxValues is the most distinct values a wildcard or regular
+	// expression pattern is narrowed to; patterns matching more are kept.
+	// Defaults to DefaultRecommendMaxValues.
+	MaxValues int
+}
+
+// Recommendation is a change proposed by Policy.Recommend
+type Recommendation struct {
+	// Rule is the rule to change, by name or position, empty for the
+	// whole policy
+	Rule string
+
+	// Condition is the condition to change, empty for the whole rule
+	Condition string
+
+	// Message describes the change
+	Message string
+}
+
+// String formats the recommendation for the CLI
+func (r Recommendation) String() string {
+	switch {
+	case r.Rule == "":
+		return r.Message
+	case r.Condition == "":
+		return fmt.Sprintf("%s: %s", r.Rule, r.Message)
+	default:
+		return fmt.Sprintf("%s: %s: %s", r.Rule, r.Condition, r.Message)
+	}
+}
+
+// Recommend proposes a tightened copy of the policy that still allows
+// every allowed decision of records, in the spirit of an access analyzer.
+// Each record is re-evaluated to find the allow rule that decided it.
+// Allow rules that decided no record are removed; patterns of their
+// claim conditions that matched no recorded value, e.g. unused event
+// types, are removed; and wildcard or regular expression patterns that
+// matched few distinct values are narrowed to those values.
+//
+// Deny rules, settings and the enriched, input, numeric and plugin
+// conditions are kept as they are. The result is only as good as the
+// records: rules for rare events, like yearly releases, are removed if
+// the records do not cover them, so review the recommendations before
+// applying them. The first recommendation states the period the records
+// cover.
+func (p *Policy) Recommend(records []DecisionRecord, opts RecommendOptions) (*Policy, []Recommendation) {
+	if p == nil {
+		return nil, nil
+	}
+	if opts.MaxValues <= 0 {
+		opts.MaxValues = DefaultRecommendMaxValues
+	}
+
+	order := p.ruleOrder()
+	decided := make([][]*GitHubActionsClaims, len(p.Rules))
+	total := 0
+	var first, last time.Time
+	for _, record := range records {
+		claims := record.Claims
+		if !record.Allowed || claims == nil || p.deniesFork(claims) || p.deniesUnscoped(claims) {
+			continue
+		}
+		now := record.Time
+		if now.IsZero() {
+			now = time.Now()
+		}
+		i := p.decide(order, func(i int) bool {
+			return p.matchesRule(p.Rules[i], claims, now)
+		})
+		if i >= 0 && p.Rules[i].Effect == EffectAllow {
+			decided[i] = append(decided[i], claims)
+			total++
+			if first.IsZero() || now.Before(first) {
+				first = now
+			}
+			if now.After(last) {
+				last = now
+			}
+		}
+	}
+
+	tightened := *p
+	if total == 0 {
+		return &tightened, []Recommendation{{Message: "no recorded decision was allowed by a rule; nothing to recommend"}}
+	}
+
+	// The records only cover part of the traffic, so say which part
+	recommendations := []Recommendation{{Message: fmt.Sprintf(
+		"based on %d allowed decisions recorded from %s to %s; rules and patterns only used outside this period or by unrecorded decisions are reported as unused",
+		total, first.Format(time.RFC3339), last.Format(time.RFC3339))}}
+	tightened.Rules = make([]Rule, 0, len(p.Rules))
+	for i, rule := range p.Rules {
+		label := ruleLabel(rule, i)
+		if rule.Effect != EffectAllow {
+			tightened.Rules = append(tightened.Rules, rule)
+			continue
+		}
+		if len(decided[i]) == 0 {
+			recommendations = append(recommendations, Recommendation{Rule: label, Message: "allowed no recorded decision; remove the rule"})
+			continue
+		}
+
+		for _, cc := range conditionClaims {
+			patterns := cc.patterns(&rule.Conditions)
+			if len(patterns) == 0 {
+				continue
+			}
+			values := make([]string, 0, len(decided[i]))
+			for _, claims := range decided[i] {
+				values = append(values, cc.claim(claims))
+			}
+
+			narrowed, messages := narrowPatterns(patterns, values, opts.MaxValues)
+			for _, message := range messages {
+				recommendations = append(recommendations, Recommendation{Rule: label, Condition: cc.name, Message: message})
+			}
+			if len(messages) > 0 {
+				setConditionPatterns(&rule.Conditions, cc.name, narrowed)
+			}
+		}
+		tightened.Rules = append(tightened.Rules, rule)
+	}
+	return &tightened, recommendations
+}
+
+// narrowPatterns removes the patterns no value matches and replaces the
+// wildcard and regular expression patterns matching at most maxValues
+// distinct values with those values. It returns the new patterns and a
+// message per change.
+func narrowPatterns(patterns, values []string, maxValues int) ([]string, []string) {
+	var narrowed, messages []string
+	add := func(patterns ...string) {
+		for _, pattern := range patterns {
+			if !slices.Contains(narrowed, pattern) {
+				narrowed = append(narrowed, pattern)
+			}
+		}
+	}
+
+	for _, pattern := range patterns {
+		var matched []string
+		for _, value := range values {
+			if Match(pattern, value) && !slices.Contains(matched, value) {
+				matched = append(matched, value)
+			}
+		}
+		slices.Sort(matched)
+
+		switch {
+		case len(matched) == 0:
+			messages = append(messages, fmt.Sprintf("pattern %q matched no recorded token; remove it", pattern))
+		case isLiteralPattern(pattern) || len(matched) > maxValues:
+			add(pattern)
+		default:
+			literals := make([]string, 0, len(matched))
+			for _, value := range matched {
+				literal, ok := literalPattern(value)
+				if !ok {
+					break
+				}
+				literals = append(literals, literal)
+			}
+			if len(literals) < len(matched) {
+				add(pattern)
+				continue
+			}
+			add(literals...)
+			messages = append(messages, fmt.Sprintf("pattern %q only matched %s; narrow it to them", pattern, quoteList(literals)))
+		}
+	}
+	return narrowed, messages
+}
+
+// isLiteralPattern reports whether a pattern only matches the value equal
+// to it
+func isLiteralPattern(pattern string) bool {
+	return !strings.HasPrefix(pattern, RegexPrefix) && !strings.ContainsAny(pattern, patternMeta)
+}
+
+// literalPattern returns a pattern matching only value, escaping its
+// metacharacters. Empty values and values that read as regular
+// expressions have none.
+func literalPattern(value string) (string, bool) {
+	if value == "" || strings.HasPrefix(value, RegexPrefix) {
+		return "", false
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if strings.IndexByte(patternMeta, value[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String(), true
+}
+
+// quoteList formats values as a comma-separated list of quoted strings
+func quoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// setConditionPatterns replaces the patterns of the named claim condition
+func setConditionPatterns(cond *Conditions, name string, patterns []string) {
+	fields := reflect.ValueOf(cond).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		tag, _, _ := strings.Cut(fields.Type().Field(i).Tag.Get("json"), ",")
+		if tag == name {
+			fields.Field(i).Set(reflect.ValueOf(patterns))
+			return
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package ghaauth
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+const recommendPolicy = `
+default_deny: true
+rules:
+  - name: deny-forks
+    conditions:
+      repository: ["myorg/*-fork"]
+    effect: deny
+  - name: deploy
+    conditions:
+      repository: ["myorg/*"]
+      ref: ["refs/heads/**"]
+      event_name: [push, workflow_dispatch, schedule]
+    effect: allow
+  - name: releases
+    conditions:
+      repository: [myorg/api]
+      ref: ["refs/tags/*"]
+    effect: allow
+`
+
+func TestPolicy_Recommend(t *testing.T) {
+	policy, err := ParsePolicyYAML([]byte(recommendPolicy))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	record := func(allowed bool, repository, ref, event string) DecisionRecord {
+		return DecisionRecord{
+			Time:    time.Now(),
+			Allowed: allowed,
+			Claims:  &GitHubActionsClaims{Repository: repository, Ref: ref, EventName: event},
+		}
+	}
+	records := []DecisionRecord{
+		record(true, "myorg/api", "refs/heads/main", "push"),
+		record(true, "myorg/web", "refs/heads/main", "push"),
+		record(true, "myorg/api", "refs/heads/main", "workflow_dispatch"),
+		record(false, "myorg/other", "refs/heads/dev", "schedule"),
+	}
+
+	tightened, recommendations := policy.Recommend(records, RecommendOptions{})
+
+	var names []string
+	for _, rule := range tightened.Rules {
+		names = append(names, rule.Name)
+	}
+	if !slices.Equal(names, []string{"deny-forks", "deploy"}) {
+		t.Fatalf("rules = %q, want the unused releases rule removed", names)
+	}
+
+	deploy := tightened.Rules[1].Conditions
+	if !slices.Equal(deploy.Repository, []string{"myorg/api", "myorg/web"}) {
+		t.Errorf("repository = %q, want the recorded repositories", deploy.Repository)
+	}
+	if !slices.Equal(deploy.Ref, []string{"refs/heads/main"}) {
+		t.Errorf("ref = %q, want the recorded ref", deploy.Ref)
+	}
+	if !slices.Equal(deploy.EventName, []string{"push", "workflow_dispatch"}) {
+		t.Errorf("event_name = %q, want schedule removed", deploy.EventName)
+	}
+	if !slices.Equal(tightened.Rules[0].Conditions.Repository, []string{"myorg/*-fork"}) {
+		t.Errorf("deny rule = %q, want it unchanged", tightened.Rules[0].Conditions.Repository)
+	}
+	if !slices.Equal(policy.Rules[1].Conditions.Repository, []string{"myorg/*"}) || len(policy.Rules) != 3 {
+		t.Error("Recommend() modified the policy")
+	}
+	if err := tightened.Validate(); err != nil {
+		t.Errorf("Validate() error = %v for the tightened policy", err)
+	}
+	for _, r := range records[:3] {
+		if !tightened.Evaluate(r.Claims).Allowed {
+			t.Errorf("tightened policy denies recorded %+v", r.Claims)
+		}
+	}
+
+	if len(recommendations) != 5 {
+		t.Errorf("recommendations = %q, want 5", recommendations)
+	}
+	if got := recommendations[0].String(); !strings.HasPrefix(got, "based on 3 allowed decisions recorded from ") {
+		t.Errorf("first recommendation = %q, want the records' coverage", got)
+	}
+	if got := recommendations[len(recommendations)-1].String(); got != "releases: allowed no recorded decision; remove the rule" {
+		t.Errorf("last recommendation = %q", got)
+	}
+
+	// Patterns matching more values than MaxValues are kept
+	tightened, _ = policy.Recommend(records, RecommendOptions{MaxValues: 1})
+	if !slices.Equal(tightened.Rules[1].Conditions.Repository, []string{"myorg/*"}) {
+		t.Errorf("repository = %q, want the pattern kept", tightened.Rules[1].Conditions.Repository)
+	}
+
+	// Without allowed records nothing is removed
+	tightened, recommendations = policy.Recommend(records[3:], RecommendOptions{})
+	if len(tightened.Rules) != 3 || len(recommendations) != 1 || !strings.Contains(recommendations[0].String(), "nothing to recommend") {
+		t.Errorf("Recommend() = %d rules, %q, want the policy unchanged", len(tightened.Rules), recommendations)
+	}
+}
+
+func TestLiteralPattern(t *testing.T) {
+	for _, value := range []string{"refs/heads/main", "Deploy *", "dependabot[bot]", "a{b,c}", `back\slash`} {
+		pattern, ok := literalPattern(value)
+		if !ok || !Match(pattern, value) {
+			t.Errorf("literalPattern(%q) = %q, want a pattern matching it", value, pattern)
+		}
+		if value != pattern && Match(pattern, value+"x") {
+			t.Errorf("literalPattern(%q) = %q matches other values", value, pattern)
+		}
+	}
+	if _, ok := literalPattern("re:.*"); ok {
+		t.Error("literalPattern() ok for a value read as a regular expression")
+	}
+}
+
+func TestWithDecisionLog(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	var buf bytes.Buffer
+	verifier, err := New(
+		WithJWKSURL(server.JWKSURL()),
+		WithPolicy(&Policy{
+			Rules:       []Rule{{Conditions: Conditions{Repository: []string{"myorg/myrepo"}}, Effect: EffectAllow}},
+			DefaultDeny: true,
+		}),
+		WithDecisionLog(&buf),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Records are written before Verify returns
+	for _, repository := range []string{"myorg/myrepo", "otherorg/unknown"} {
+		claims := testutil.DefaultClaims().WithRepository(repository).ToJWT()
+		claims["custom"] = "x"
+		token, err := gen.GenerateToken(claims)
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		_, _ = verifier.Verify(context.Background(), token)
+	}
+
+	records, err := ReadDecisionRecords(&buf)
+	if err != nil {
+		t.Fatalf("ReadDecisionRecords() error = %v", err)
+	}
+	if len(records) != 2 || !records[0].Allowed || records[1].Allowed {
+		t.Fatalf("records = %+v, want one allowed and one denied", records)
+	}
+	if records[0].Claims.Repository != "myorg/myrepo" || records[0].Claims.Extra["custom"] != "x" {
+		t.Errorf("claims = %+v, want them round-tripped", records[0].Claims)
+	}
+
+	if _, err := ReadDecisionRecords(strings.NewReader("{\"allowed\": true}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "decision record 2") {
+		t.Errorf("ReadDecisionRecords() error = %v, want the bad record named", err)
+	}
+}
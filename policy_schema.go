@@ -0,0 +1,226 @@
+package ghaauth
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// policySchema is the JSON Schema of policy documents
+//
+//go:embed policy.schema.json
+var policySchema []byte
+
+// PolicySchema returns the JSON Schema (draft 2020-12) of policy
+// documents, e.g. for editor completion of policy files
+func PolicySchema() []byte {
+	return bytes.Clone(policySchema)
+}
+
+// DocumentError is a problem found in a policy document
+type DocumentError struct {
+	// Pointer is the RFC 6901 JSON pointer of the offending value, e.g.
+	// "/rules/0/conditions/respository"
+	Pointer string
+
+	// Message describes the problem
+	Message string
+}
+
+// Error implements the error interface
+func (e *DocumentError) Error() string {
+	if e.Pointer == "" {
+		return e.Message
+	}
+	return e.Pointer + ": " + e.Message
+}
+
+// schemaNode is the subset of JSON Schema used by policy.schema.json
+type schemaNode struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Enum                 []string               `json:"enum"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	Required             []string               `json:"required"`
+	Minimum              *float64               `json:"minimum"`
+	Defs                 map[string]*schemaNode `json:"$defs"`
+}
+
+// policySchemaRoot is the parsed policySchema
+var policySchemaRoot = func() *schemaNode {
+	var root schemaNode
+	if err := json.Unmarshal(policySchema, &root); err != nil {
+		panic("ghaauth: invalid policy schema: " + err.Error())
+	}
+	return &root
+}()
+
+// ValidateDocument checks a JSON policy document against PolicySchema and
+// returns every problem found, such as unknown or misspelled fields and
+// values of the wrong type, in a stable order. It returns nil for valid
+// documents; whether the policy makes sense is checked by Policy.Validate.
+func ValidateDocument(data []byte) []*DocumentError {
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return []*DocumentError{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	var errs []*DocumentError
+	policySchemaRoot.validate(doc, "", &errs)
+	return errs
+}
+
+// validate appends the problems of value, found at pointer, to errs
+func (n *schemaNode) validate(value any, pointer string, errs *[]*DocumentError) {
+	if n.Ref != "" {
+		name := strings.TrimPrefix(n.Ref, "#/$defs/")
+		policySchemaRoot.Defs[name].validate(value, pointer, errs)
+		return
+	}
+
+	report := func(format string, args ...any) {
+		*errs = append(*errs, &DocumentError{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if n.Enum != nil {
+		if s, ok := value.(string); !ok || !slices.Contains(n.Enum, s) {
+			report("must be one of %s, got %s", strings.Join(n.Enum, ", "), jsonTypeValue(value))
+		}
+		return
+	}
+
+	if got := jsonType(value); got != n.Type && !(n.Type == "integer" && got == "number") {
+		report("expected %s, got %s", n.Type, jsonTypeValue(value))
+		return
+	}
+
+	switch n.Type {
+	case "integer":
+		f, _ := value.(json.Number).Float64()
+		if f != math.Trunc(f) {
+			report("expected integer, got %s", value)
+		} else if n.Minimum != nil && f < *n.Minimum {
+			report("must be at least %v", *n.Minimum)
+		}
+
+	case "array":
+		for i, item := range value.([]any) {
+			n.Items.validate(item, fmt.Sprintf("%s/%d", pointer, i), errs)
+		}
+
+	case "object":
+		object := value.(map[string]any)
+		for _, name := range n.Required {
+			if _, ok := object[name]; !ok {
+				report("missing required field %q", name)
+			}
+		}
+
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var additional *schemaNode
+		closed := string(n.AdditionalProperties) == "false"
+		if len(n.AdditionalProperties) > 0 && !closed {
+			_ = json.Unmarshal(n.AdditionalProperties, &additional)
+		}
+
+		for _, name := range names {
+			child := pointer + "/" + escapePointer(name)
+			switch property, ok := n.Properties[name]; {
+			case ok:
+				property.validate(object[name], child, errs)
+			case additional != nil:
+				additional.validate(object[name], child, errs)
+			case closed:
+				msg := fmt.Sprintf("unknown field %q", name)
+				if suggestion := closestName(name, n.Properties); suggestion != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				*errs = append(*errs, &DocumentError{Pointer: child, Message: msg})
+			}
+		}
+	}
+}
+
+// jsonType returns the JSON Schema type of a decoded value
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// jsonTypeValue describes a decoded value for error messages
+func jsonTypeValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+	return jsonType(value)
+}
+
+// escapePointer escapes a JSON pointer reference token
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// closestName returns the property name within edit distance 2 of name,
+// for suggestions on misspelled fields
+func closestName(name string, properties map[string]*schemaNode) string {
+	best, bestDistance := "", 3
+	for candidate := range properties {
+		if d := editDistance(name, candidate); d < bestDistance || d == bestDistance && candidate < best {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,151 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestValidateDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "valid policy",
+			data: testPolicyJSON,
+		},
+		{
+			name: "condition sets and priorities",
+			data: `{
+				"rules": [{"effect": "allow", "use": ["main"], "priority": 10, "conditions": {"run_attempt_max": 2}}],
+				"condition_sets": {"main": {"ref": ["refs/heads/main"]}},
+				"evaluation_mode": "deny-overrides"
+			}`,
+		},
+		{
+			name: "misspelled condition",
+			data: `{"rules": [{"effect": "allow", "conditions": {"respository": ["myorg/*"]}}]}`,
+			want: []string{`/rules/0/conditions/respository: unknown field "respository" (did you mean "repository"?)`},
+		},
+		{
+			name: "unknown top-level field",
+			data: `{"rules": [{"effect": "allow"}], "default_deny": true, "fallback": "deny"}`,
+			want: []string{`/fallback: unknown field "fallback"`},
+		},
+		{
+			name: "wrong types",
+			data: `{"rules": [{"effect": "allow", "conditions": {"ref": "refs/heads/main", "run_attempt_min": 1.5}}], "default_deny": "yes"}`,
+			want: []string{
+				`/rules/0/conditions/ref: expected array, got "refs/heads/main"`,
+				`/rules/0/conditions/run_attempt_min: expected integer, got 1.5`,
+				`/default_deny: expected boolean, got "yes"`,
+			},
+		},
+		{
+			name: "invalid enum",
+			data: `{"rules": [{"effect": "permit"}], "evaluation_mode": "last-match"}`,
+			want: []string{
+				`/evaluation_mode: must be one of first-match, deny-overrides, allow-overrides, got "last-match"`,
+				`/rules/0/effect: must be one of allow, deny, got "permit"`,
+			},
+		},
+		{
+			name: "missing required fields",
+			data: `{"rules": [{"conditions": {}}]}`,
+			want: []string{`/rules/0: missing required field "effect"`},
+		},
+		{
+			name: "negative minimum",
+			data: `{"rules": [{"effect": "allow", "conditions": {"run_number_min": -1}}]}`,
+			want: []string{`/rules/0/conditions/run_number_min: must be at least 0`},
+		},
+		{
+			name: "condition set with unknown field",
+			data: `{"rules": [{"effect": "allow"}], "condition_sets": {"a/b": {"actors": ["octocat"]}}}`,
+			want: []string{`/condition_sets/a~1b/actors: unknown field "actors" (did you mean "actor"?)`},
+		},
+		{
+			name: "not an object",
+			data: `[]`,
+			want: []string{`expected object, got array`},
+		},
+		{
+			name: "malformed JSON",
+			data: `{"rules": [`,
+			want: []string{`invalid JSON: unexpected EOF`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, problem := range ValidateDocument([]byte(tt.data)) {
+				got = append(got, problem.Error())
+			}
+			sort.Strings(got)
+			want := slices.Clone(tt.want)
+			sort.Strings(want)
+
+			if !slices.Equal(got, want) {
+				t.Errorf("ValidateDocument() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestPolicySchemaFields keeps policy.schema.json in sync with the JSON
+// fields of the policy types
+func TestPolicySchemaFields(t *testing.T) {
+	var schema schemaNode
+	if err := json.Unmarshal(PolicySchema(), &schema); err != nil {
+		t.Fatalf("PolicySchema() is not valid JSON: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		node *schemaNode
+		typ  reflect.Type
+	}{
+		{name: "policy", node: &schema, typ: reflect.TypeOf(Policy{})},
+		{name: "rule", node: schema.Defs["rule"], typ: reflect.TypeOf(Rule{})},
+		{name: "conditions", node: schema.Defs["conditions"], typ: reflect.TypeOf(Conditions{})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for i := 0; i < tt.typ.NumField(); i++ {
+				name, _, _ := strings.Cut(tt.typ.Field(i).Tag.Get("json"), ",")
+				if name != "" && name != "-" {
+					fields = append(fields, name)
+				}
+			}
+			sort.Strings(fields)
+
+			var properties []string
+			for name := range tt.node.Properties {
+				properties = append(properties, name)
+			}
+			sort.Strings(properties)
+
+			if !slices.Equal(properties, fields) {
+				t.Errorf("schema properties = %v, want %v", properties, fields)
+			}
+		})
+	}
+}
+
+func TestParsePolicyRejectsUnknownFields(t *testing.T) {
+	_, err := ParsePolicy([]byte(`{"rules": [{"effect": "allow", "conditions": {"respository": ["myorg/*"]}}]}`))
+	if err == nil {
+		t.Fatal("ParsePolicy() error = nil, want error")
+	}
+	if !strings.Contains(err.Error(), `did you mean "repository"?`) {
+		t.Errorf("ParsePolicy() error = %v, want a suggestion", err)
+	}
+}
@@ -0,0 +1,121 @@
+package ghaauth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// PolicySignatureSuffix is appended to a policy file's path to find its
+// detached signature, as written by cosign sign-blob
+const PolicySignatureSuffix = ".sig"
+
+// ErrPolicySignature is returned when a signed policy's signature is
+// missing or does not verify
+var ErrPolicySignature = errors.New("invalid policy signature")
+
+// PolicySignatureVerifier checks a detached signature of a policy
+// document, returning an error unless it was made by a trusted key.
+// Signatures are passed base64-decoded if they were encoded.
+type PolicySignatureVerifier func(document, signature []byte) error
+
+// Ed25519PolicyVerifier returns a PolicySignatureVerifier accepting plain
+// Ed25519 signatures of the document by any of the keys, e.g. made with
+// "openssl pkeyutl -sign -rawin"
+func Ed25519PolicyVerifier(keys ...ed25519.PublicKey) PolicySignatureVerifier {
+	return func(document, signature []byte) error {
+		for _, key := range keys {
+			if ed25519.Verify(key, document, signature) {
+				return nil
+			}
+		}
+		return fmt.Errorf("signature does not match any of %d Ed25519 keys", len(keys))
+	}
+}
+
+// PublicKeyPolicyVerifier returns a PolicySignatureVerifier for a PEM
+// encoded public key: an ECDSA key, as created by "cosign generate-key-pair"
+// and used with "cosign sign-blob --key", or an Ed25519 key. ECDSA
+// signatures are over the SHA-256 digest of the document for P-256 keys,
+// and SHA-384 and SHA-512 for P-384 and P-521 keys.
+func PublicKeyPolicyVerifier(pemData []byte) (PolicySignatureVerifier, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return Ed25519PolicyVerifier(key), nil
+
+	case *ecdsa.PublicKey:
+		return func(document, signature []byte) error {
+			var digest []byte
+			switch key.Curve.Params().BitSize {
+			case 384:
+				sum := sha512.Sum384(document)
+				digest = sum[:]
+			case 521:
+				sum := sha512.Sum512(document)
+				digest = sum[:]
+			default:
+				sum := sha256.Sum256(document)
+				digest = sum[:]
+			}
+			if !ecdsa.VerifyASN1(key, digest, signature) {
+				return fmt.Errorf("signature does not match the ECDSA key")
+			}
+			return nil
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T: must be ECDSA or Ed25519", key)
+	}
+}
+
+// LoadSignedPolicyFile is LoadPolicyFile for a policy with a detached
+// signature in the file next to it, e.g. policy.yaml.sig for
+// policy.yaml. Policies without a signature, or with one the verifier
+// rejects, fail with ErrPolicySignature before they are parsed.
+func LoadSignedPolicyFile(path string, verify PolicySignatureVerifier) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	signature, err := os.ReadFile(path + PolicySignatureSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPolicySignature, err)
+	}
+
+	if err := verify(data, decodeSignature(signature)); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrPolicySignature, path, err)
+	}
+
+	return parsePolicyFile(path, data)
+}
+
+// decodeSignature returns a base64 encoded signature decoded, as cosign
+// writes them, and any other signature as it is
+func decodeSignature(signature []byte) []byte {
+	trimmed := bytes.TrimSpace(signature)
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(trimmed)))
+	n, err := base64.StdEncoding.Decode(decoded, trimmed)
+	if err != nil {
+		return signature
+	}
+	return decoded[:n]
+}
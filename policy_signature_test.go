@@ -0,0 +1,227 @@
+package ghaauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// publicKeyPEM encodes a public key as a PKIX PEM block
+func publicKeyPEM(t *testing.T, key any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// writeSignedPolicy writes a policy file and its signature
+func writeSignedPolicy(t *testing.T, path, policy string, signature []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+PolicySignatureSuffix, signature, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSignedPolicyFile(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte(testPolicyJSON))
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	edSig := ed25519.Sign(edKey, []byte(testPolicyJSON))
+
+	cosign, err := PublicKeyPolicyVerifier(publicKeyPEM(t, &ecKey.PublicKey))
+	if err != nil {
+		t.Fatalf("PublicKeyPolicyVerifier() error = %v", err)
+	}
+	edPEM, err := PublicKeyPolicyVerifier(publicKeyPEM(t, edPub))
+	if err != nil {
+		t.Fatalf("PublicKeyPolicyVerifier() error = %v", err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		verify    PolicySignatureVerifier
+		policy    string
+		signature []byte
+		wantErr   bool
+	}{
+		{name: "raw Ed25519 signature", verify: Ed25519PolicyVerifier(otherPub, edPub), signature: edSig},
+		{name: "base64 Ed25519 signature", verify: edPEM, signature: []byte(base64.StdEncoding.EncodeToString(edSig) + "\n")},
+		{name: "cosign ECDSA signature", verify: cosign, signature: []byte(base64.StdEncoding.EncodeToString(ecSig))},
+		{name: "untrusted key", verify: Ed25519PolicyVerifier(otherPub), signature: edSig, wantErr: true},
+		{name: "tampered policy", verify: cosign, policy: strings.ReplaceAll(testPolicyJSON, "myorg", "evilorg"), signature: []byte(base64.StdEncoding.EncodeToString(ecSig)), wantErr: true},
+		{name: "missing signature", verify: cosign, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			policy := tt.policy
+			if policy == "" {
+				policy = testPolicyJSON
+			}
+			if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if tt.signature != nil {
+				if err := os.WriteFile(path+PolicySignatureSuffix, tt.signature, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			loaded, err := LoadSignedPolicyFile(path, tt.verify)
+			if tt.wantErr {
+				if !errors.Is(err, ErrPolicySignature) {
+					t.Errorf("LoadSignedPolicyFile() error = %v, want ErrPolicySignature", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSignedPolicyFile() error = %v", err)
+			}
+			if loaded.Rules[0].Name != "allow-myorg" {
+				t.Errorf("rule = %q, want allow-myorg", loaded.Rules[0].Name)
+			}
+		})
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range [][]byte{[]byte("not PEM"), publicKeyPEM(t, &rsaKey.PublicKey)} {
+		if _, err := PublicKeyPolicyVerifier(key); err == nil {
+			t.Errorf("PublicKeyPolicyVerifier(%.20q) error = nil, want error", key)
+		}
+	}
+}
+
+func TestFilePolicyProvider_Signature(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writeSignedPolicy(t, path, testPolicyJSON, ed25519.Sign(key, []byte(testPolicyJSON)))
+
+	var reloadErrors atomic.Int32
+	provider, err := NewFilePolicyProvider(path,
+		WithPolicySignature(Ed25519PolicyVerifier(pub)),
+		WithReloadErrorHandler(func(err error) {
+			if errors.Is(err, ErrPolicySignature) {
+				reloadErrors.Add(1)
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewFilePolicyProvider() error = %v", err)
+	}
+	defer func() { _ = provider.Close() }()
+
+	// An unsigned change is refused
+	tampered := strings.ReplaceAll(testPolicyJSON, "allow-myorg", "allow-tampered")
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(t, 2*time.Second, func() bool { return reloadErrors.Load() > 0 }) {
+		t.Fatal("unsigned policy change was not reported")
+	}
+	if got := provider.Policy().Rules[0].Name; got != "allow-myorg" {
+		t.Errorf("rule = %q, want previous policy to stay active", got)
+	}
+
+	// Signing it afterwards applies it
+	if err := os.WriteFile(path+PolicySignatureSuffix, ed25519.Sign(key, []byte(tampered)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(t, 2*time.Second, func() bool { return provider.Policy().Rules[0].Name == "allow-tampered" }) {
+		t.Errorf("signed policy was not reloaded, rule = %q", provider.Policy().Rules[0].Name)
+	}
+
+	unsigned := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(unsigned, []byte(testPolicyJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFilePolicyProvider(unsigned, WithPolicySignature(Ed25519PolicyVerifier(pub))); !errors.Is(err, ErrPolicySignature) {
+		t.Errorf("NewFilePolicyProvider() error = %v, want ErrPolicySignature", err)
+	}
+}
+
+func TestConfig_PolicySignatureKey(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "policy.pub")
+	if err := os.WriteFile(keyFile, publicKeyPEM(t, pub), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signed := filepath.Join(dir, "signed.json")
+	writeSignedPolicy(t, signed, testPolicyJSON, ed25519.Sign(key, []byte(testPolicyJSON)))
+	unsigned := filepath.Join(dir, "unsigned.json")
+	if err := os.WriteFile(unsigned, []byte(testPolicyJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&Config{PolicyFile: signed, PolicySignatureKey: keyFile}).Options(); err != nil {
+		t.Errorf("Options() error = %v for a signed policy", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  *Config
+	}{
+		{name: "unsigned policy file", cfg: &Config{PolicyFile: unsigned, PolicySignatureKey: keyFile}},
+		{name: "unsigned issuer policy file", cfg: &Config{PolicyFile: signed, PolicySignatureKey: keyFile, Issuers: []IssuerConfig{{URL: DefaultIssuer, PolicyFile: unsigned}}}},
+		{name: "inline policy", cfg: &Config{Policy: &Policy{Rules: []Rule{{Conditions: Conditions{Repository: []string{"myorg/*"}}, Effect: EffectAllow}}}, PolicySignatureKey: keyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.cfg.Options(); !errors.Is(err, ErrPolicySignature) {
+				t.Errorf("Options() error = %v, want ErrPolicySignature", err)
+			}
+		})
+	}
+
+	if _, err := (&Config{PolicyFile: signed, PolicySignatureKey: filepath.Join(dir, "missing.pub")}).Options(); err == nil {
+		t.Error("Options() error = nil for a missing key file")
+	}
+}
@@ -1,7 +1,10 @@
 package ghaauth
 
 import (
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -249,6 +252,374 @@ func TestPolicy_Evaluate(t *testing.T) {
 			wantAllowed:  true,
 			wantRuleName: "allow-private-repos",
 		},
+		{
+			name: "base_ref condition allows pull request targeting main",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name: "allow-prs-to-main",
+						Conditions: Conditions{
+							EventName: []string{"pull_request"},
+							BaseRef:   []string{"main"},
+						},
+						Effect: EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims: &GitHubActionsClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer: "https://token.actions.githubusercontent.com",
+				},
+				Repository:      "myorg/myrepo",
+				RepositoryOwner: "myorg",
+				Ref:             "refs/pull/1/merge",
+				Workflow:        "CI",
+				EventName:       "pull_request",
+				Actor:           "johndoe",
+				HeadRef:         "feature/login",
+				BaseRef:         "main",
+			},
+			wantAllowed:  true,
+			wantRuleName: "allow-prs-to-main",
+		},
+		{
+			name: "head_ref deny rule blocks matching branch",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name: "deny-dependabot-branches",
+						Conditions: Conditions{
+							HeadRef: []string{"dependabot/**"},
+						},
+						Effect: EffectDeny,
+					},
+					{
+						Name: "allow-org",
+						Conditions: Conditions{
+							RepositoryOwner: []string{"myorg"},
+						},
+						Effect: EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims: &GitHubActionsClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer: "https://token.actions.githubusercontent.com",
+				},
+				Repository:      "myorg/myrepo",
+				RepositoryOwner: "myorg",
+				Ref:             "refs/pull/2/merge",
+				Workflow:        "CI",
+				EventName:       "pull_request",
+				Actor:           "dependabot[bot]",
+				HeadRef:         "dependabot/go_modules/golang.org/x/net",
+				BaseRef:         "main",
+			},
+			wantAllowed:  false,
+			wantRuleName: "deny-dependabot-branches",
+		},
+		{
+			name: "workflow_ref condition pins workflow file",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name: "allow-deploy-workflow",
+						Conditions: Conditions{
+							WorkflowRef: []string{"myorg/myrepo/.github/workflows/deploy.yml@refs/heads/main"},
+						},
+						Effect: EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims:      baseClaims, // no WorkflowRef set
+			wantAllowed: false,
+		},
+		{
+			name: "base_ref condition with empty base_ref denies",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name: "allow-prs-to-main",
+						Conditions: Conditions{
+							BaseRef: []string{"main"},
+						},
+						Effect: EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims:      baseClaims, // push event, no BaseRef set
+			wantAllowed: false,
+		},
+		{
+			name: "run_attempt_max rejects re-runs",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-first-attempt",
+						Conditions: Conditions{Repository: []string{"myorg/myrepo"}, RunAttemptMax: 1},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims: &GitHubActionsClaims{
+				Repository: "myorg/myrepo",
+				RunAttempt: "2",
+			},
+			wantAllowed: false,
+		},
+		{
+			name: "run_attempt_max allows first attempt",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-first-attempt",
+						Conditions: Conditions{Repository: []string{"myorg/myrepo"}, RunAttemptMax: 1},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims: &GitHubActionsClaims{
+				Repository: "myorg/myrepo",
+				RunAttempt: "1",
+			},
+			wantAllowed:  true,
+			wantRuleName: "allow-first-attempt",
+		},
+		{
+			name: "run_number range",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-recent-runs",
+						Conditions: Conditions{RunNumberMin: 100, RunNumberMax: 200},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims:       &GitHubActionsClaims{RunNumber: "150"},
+			wantAllowed:  true,
+			wantRuleName: "allow-recent-runs",
+		},
+		{
+			name: "run_number below minimum",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-recent-runs",
+						Conditions: Conditions{RunNumberMin: 100},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims:      &GitHubActionsClaims{RunNumber: "99"},
+			wantAllowed: false,
+		},
+		{
+			name: "job_workflow_ref pinned to tag allows",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-deploy-workflow",
+						Conditions: Conditions{JobWorkflowRef: []string{"myorg/workflows/.github/workflows/deploy.yml@refs/tags/v*"}},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims: &GitHubActionsClaims{
+				Repository:     "myorg/myrepo",
+				JobWorkflowRef: "myorg/workflows/.github/workflows/deploy.yml@refs/tags/v1.2.0",
+			},
+			wantAllowed:  true,
+			wantRuleName: "allow-deploy-workflow",
+		},
+		{
+			name: "job_workflow_ref on a branch denies",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-deploy-workflow",
+						Conditions: Conditions{JobWorkflowRef: []string{"myorg/workflows/.github/workflows/deploy.yml@refs/tags/v*"}},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims: &GitHubActionsClaims{
+				Repository:     "myorg/myrepo",
+				JobWorkflowRef: "myorg/workflows/.github/workflows/deploy.yml@refs/heads/main",
+			},
+			wantAllowed: false,
+		},
+		{
+			name: "job_workflow_sha mismatch denies",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-pinned-sha",
+						Conditions: Conditions{JobWorkflowSHA: []string{"0123456789abcdef0123456789abcdef01234567"}},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims: &GitHubActionsClaims{
+				Repository:     "myorg/myrepo",
+				JobWorkflowSHA: "fedcba9876543210fedcba9876543210fedcba98",
+			},
+			wantAllowed: false,
+		},
+		{
+			name: "runner_environment excludes self-hosted runners",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-github-hosted",
+						Conditions: Conditions{RunnerEnvironment: []string{RunnerGitHubHosted}},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims: &GitHubActionsClaims{
+				Repository:        "myorg/myrepo",
+				RunnerEnvironment: RunnerSelfHosted,
+			},
+			wantAllowed: false,
+		},
+		{
+			name: "missing run_attempt fails bound",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-first-attempt",
+						Conditions: Conditions{RunAttemptMax: 1},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims:      baseClaims, // no RunAttempt set
+			wantAllowed: false,
+		},
+		{
+			name: "priority evaluates higher rules first",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-org",
+						Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+						Effect:     EffectAllow,
+					},
+					{
+						Name:       "deny-actor",
+						Conditions: Conditions{Actor: []string{"johndoe"}},
+						Effect:     EffectDeny,
+						Priority:   10,
+					},
+				},
+				DefaultDeny: true,
+			},
+			claims:       baseClaims,
+			wantAllowed:  false,
+			wantRuleName: "deny-actor",
+		},
+		{
+			name: "deny-overrides prefers a later deny",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-org",
+						Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+						Effect:     EffectAllow,
+					},
+					{
+						Name:       "deny-actor",
+						Conditions: Conditions{Actor: []string{"johndoe"}},
+						Effect:     EffectDeny,
+					},
+				},
+				DefaultDeny:    true,
+				EvaluationMode: EvaluationDenyOverrides,
+			},
+			claims:       baseClaims,
+			wantAllowed:  false,
+			wantRuleName: "deny-actor",
+		},
+		{
+			name: "deny-overrides allows when no deny matches",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "allow-org",
+						Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+						Effect:     EffectAllow,
+					},
+					{
+						Name:       "deny-other-actor",
+						Conditions: Conditions{Actor: []string{"mallory"}},
+						Effect:     EffectDeny,
+					},
+				},
+				DefaultDeny:    true,
+				EvaluationMode: EvaluationDenyOverrides,
+			},
+			claims:       baseClaims,
+			wantAllowed:  true,
+			wantRuleName: "allow-org",
+		},
+		{
+			name: "allow-overrides prefers a later allow",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "deny-org",
+						Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+						Effect:     EffectDeny,
+					},
+					{
+						Name:       "allow-main",
+						Conditions: Conditions{Ref: []string{"refs/heads/main"}},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny:    false,
+				EvaluationMode: EvaluationAllowOverrides,
+			},
+			claims:       baseClaims,
+			wantAllowed:  true,
+			wantRuleName: "allow-main",
+		},
+		{
+			name: "allow-overrides denies when only deny matches",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Name:       "deny-org",
+						Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+						Effect:     EffectDeny,
+					},
+					{
+						Name:       "allow-develop",
+						Conditions: Conditions{Ref: []string{"refs/heads/develop"}},
+						Effect:     EffectAllow,
+					},
+				},
+				DefaultDeny:    false,
+				EvaluationMode: EvaluationAllowOverrides,
+			},
+			claims:       baseClaims,
+			wantAllowed:  false,
+			wantRuleName: "deny-org",
+		},
 	}
 
 	for _, tt := range tests {
@@ -277,6 +648,31 @@ func TestPolicy_Validate(t *testing.T) {
 			policy:  nil,
 			wantErr: false,
 		},
+		{
+			name: "explicit default deny mode",
+			policy: &Policy{
+				Rules: []Rule{{Conditions: Conditions{Repository: []string{"myorg/*"}}, Effect: EffectAllow}},
+				Mode:  PolicyModeDefaultDeny,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown mode",
+			policy: &Policy{
+				Rules: []Rule{{Conditions: Conditions{Repository: []string{"myorg/*"}}, Effect: EffectAllow}},
+				Mode:  PolicyMode("deny"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "default allow mode contradicts default deny",
+			policy: &Policy{
+				Rules:       []Rule{{Conditions: Conditions{Repository: []string{"myorg/*"}}, Effect: EffectAllow}},
+				DefaultDeny: true,
+				Mode:        PolicyModeDefaultAllow,
+			},
+			wantErr: true,
+		},
 		{
 			name: "valid policy",
 			policy: &Policy{
@@ -328,6 +724,85 @@ func TestPolicy_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid regex condition",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Conditions: Conditions{
+							Ref: []string{`re:refs/tags/v\d+\.\d+\.\d+`},
+						},
+						Effect: EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid regex condition",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Conditions: Conditions{
+							Ref: []string{"re:refs/tags/v(\\d+"},
+						},
+						Effect: EffectAllow,
+					},
+				},
+				DefaultDeny: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "numeric bound is a condition",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Conditions: Conditions{RunAttemptMax: 1},
+						Effect:     EffectDeny,
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative bound",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Conditions: Conditions{RunNumberMin: -1},
+						Effect:     EffectAllow,
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "min exceeds max",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Conditions: Conditions{RunAttemptMin: 3, RunAttemptMax: 2},
+						Effect:     EffectAllow,
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown evaluation mode",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Conditions: Conditions{Repository: []string{"myorg/*"}},
+						Effect:     EffectAllow,
+					},
+				},
+				EvaluationMode: EvaluationMode("most-specific"),
+			},
+			wantErr: true,
+		},
 		{
 			name: "multiple valid conditions",
 			policy: &Policy{
@@ -357,3 +832,258 @@ func TestPolicy_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestPolicy_Validate_PatternErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "re:[", want: "missing closing ]"},
+		{pattern: strings.Repeat("{a,b}", 11), want: "braces expand to more than"},
+		{pattern: "myorg/\xff", want: "not valid UTF-8"},
+	}
+
+	for _, tt := range tests {
+		policy := &Policy{Rules: []Rule{{Name: "r", Conditions: Conditions{Repository: []string{tt.pattern}}, Effect: EffectAllow}}}
+		err := policy.Validate()
+		if err == nil || !strings.Contains(err.Error(), "invalid pattern") || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate(%q) error = %v, want %q", tt.pattern, err, tt.want)
+		}
+	}
+}
+
+func TestPolicy_DeniesByDefault(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		want   bool
+	}{
+		{name: "nil policy", policy: nil, want: false},
+		{name: "zero policy", policy: &Policy{}, want: false},
+		{name: "default deny", policy: &Policy{DefaultDeny: true}, want: true},
+		{name: "enforce default deny mode", policy: &Policy{Mode: PolicyModeDefaultDeny}, want: true},
+		{name: "default allow mode", policy: &Policy{Mode: PolicyModeDefaultAllow}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.DeniesByDefault(); got != tt.want {
+				t.Errorf("DeniesByDefault() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	claims := &GitHubActionsClaims{RepositoryOwner: "otherorg"}
+	policy := &Policy{
+		Rules: []Rule{{Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}},
+		Mode:  PolicyModeDefaultDeny,
+	}
+	if result := policy.Evaluate(claims); result.Allowed {
+		t.Errorf("Evaluate().Allowed = true with mode %s", policy.Mode)
+	}
+	if result := policy.Compile().Evaluate(claims); result.Allowed {
+		t.Errorf("compiled Evaluate().Allowed = true with mode %s", policy.Mode)
+	}
+}
+
+func TestRule_ValidityWindow(t *testing.T) {
+	policy, err := ParsePolicyYAML([]byte(`
+default_deny: true
+rules:
+  - name: deploy-freeze
+    conditions:
+      environment: [production]
+    effect: deny
+    valid_from: 2026-12-20T00:00:00Z
+    valid_until: 2027-01-04T00:00:00Z
+  - name: break-glass
+    conditions:
+      repository: [myorg/legacy]
+    effect: allow
+    valid_until: "2026-12-01T12:00:00Z"
+  - name: allow-myorg
+    conditions:
+      repository: [myorg/api]
+    effect: allow
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	api := &GitHubActionsClaims{Repository: "myorg/api", Environment: "production"}
+	legacy := &GitHubActionsClaims{Repository: "myorg/legacy"}
+	at := func(s string) time.Time {
+		t.Helper()
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	tests := []struct {
+		name     string
+		claims   *GitHubActionsClaims
+		now      string
+		wantRule string
+	}{
+		{name: "before freeze", claims: api, now: "2026-12-19T23:59:59Z", wantRule: "allow-myorg"},
+		{name: "freeze starts", claims: api, now: "2026-12-20T00:00:00Z", wantRule: "deploy-freeze"},
+		{name: "freeze ends", claims: api, now: "2027-01-04T00:00:00Z", wantRule: "allow-myorg"},
+		{name: "break-glass active", claims: legacy, now: "2026-12-01T11:59:59Z", wantRule: "break-glass"},
+		{name: "break-glass expired", claims: legacy, now: "2026-12-01T12:00:00Z", wantRule: ""},
+	}
+
+	compiled := policy.Compile()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.EvaluateAt(tt.claims, at(tt.now)).MatchedRule; got != tt.wantRule {
+				t.Errorf("EvaluateAt().MatchedRule = %q, want %q", got, tt.wantRule)
+			}
+			if got := compiled.EvaluateAt(tt.claims, at(tt.now)).MatchedRule; got != tt.wantRule {
+				t.Errorf("compiled EvaluateAt().MatchedRule = %q, want %q", got, tt.wantRule)
+			}
+		})
+	}
+
+	from, until := at("2026-12-02T00:00:00Z"), at("2026-12-01T00:00:00Z")
+	invalid := &Policy{Rules: []Rule{{Conditions: Conditions{Repository: []string{"myorg/*"}}, Effect: EffectAllow, ValidFrom: &from, ValidUntil: &until}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Validate() error = nil for valid_from after valid_until")
+	}
+
+	if _, err := ParsePolicy([]byte(`{"rules": [{"conditions": {"repository": ["myorg/*"]}, "effect": "allow", "valid_until": "tomorrow"}]}`)); err == nil {
+		t.Error("ParsePolicy() error = nil for a malformed valid_until")
+	}
+	if _, _, err := policy.ExportAWSTrustPolicy(AWSExportOptions{}); err == nil {
+		t.Error("ExportAWSTrustPolicy() error = nil for a rule with a validity window")
+	}
+}
+
+func TestPolicy_Metadata(t *testing.T) {
+	policy, err := ParsePolicyYAML([]byte(`
+metadata:
+  version: "2026.10.1"
+  description: Production deploy policy
+  owner: platform-security
+  updated_at: 2026-10-01T09:00:00Z
+default_deny: true
+rules:
+  - name: allow-myorg
+    conditions:
+      repository: [myorg/*]
+    effect: allow
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+	if policy.Metadata == nil || policy.Metadata.Owner != "platform-security" || policy.Metadata.UpdatedAt == nil {
+		t.Fatalf("Metadata = %+v", policy.Metadata)
+	}
+
+	allowed := &GitHubActionsClaims{Repository: "myorg/api"}
+	denied := &GitHubActionsClaims{Repository: "otherorg/api"}
+	for name, evaluate := range map[string]func(*GitHubActionsClaims) *EvaluationResult{
+		"policy":   policy.Evaluate,
+		"compiled": policy.Compile().Evaluate,
+	} {
+		for _, claims := range []*GitHubActionsClaims{allowed, denied} {
+			if got := evaluate(claims).PolicyVersion; got != "2026.10.1" {
+				t.Errorf("%s Evaluate(%s).PolicyVersion = %q, want 2026.10.1", name, claims.Repository, got)
+			}
+		}
+	}
+
+	if info := policy.explainDenial(denied, time.Now(), policy.Evaluate(denied), DenialDetailRule); info.PolicyVersion != "2026.10.1" {
+		t.Errorf("explainDenial().PolicyVersion = %q, want 2026.10.1", info.PolicyVersion)
+	}
+
+	if got := (&Policy{}).Version(); got != "" {
+		t.Errorf("Version() = %q without metadata, want empty", got)
+	}
+	if _, err := ParsePolicy([]byte(`{"metadata": {"revision": "1"}, "rules": []}`)); err == nil {
+		t.Error("ParsePolicy() error = nil for unknown metadata field")
+	}
+}
+
+func TestPolicy_EvaluateAll(t *testing.T) {
+	policy, err := ParsePolicyYAML([]byte(`
+default_deny: true
+evaluation_mode: deny-overrides
+rules:
+  - name: allow-myorg
+    conditions:
+      repository_owner: [myorg]
+    effect: allow
+  - name: deny-forks-of-api
+    conditions:
+      repository: [myorg/api]
+      ref: ["refs/pull/**"]
+    effect: deny
+  - name: allow-api
+    conditions:
+      repository: [myorg/api]
+    effect: allow
+    priority: 10
+  - name: expired
+    conditions:
+      repository_owner: [myorg]
+    effect: allow
+    valid_until: 2020-01-01T00:00:00Z
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	names := func(rules []Rule) []string {
+		var names []string
+		for _, rule := range rules {
+			names = append(names, rule.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name   string
+		claims *GitHubActionsClaims
+		want   []string
+	}{
+		{
+			name:   "priority order",
+			claims: &GitHubActionsClaims{Repository: "myorg/api", RepositoryOwner: "myorg", Ref: "refs/heads/main"},
+			want:   []string{"allow-api", "allow-myorg"},
+		},
+		{
+			name:   "allow and deny",
+			claims: &GitHubActionsClaims{Repository: "myorg/api", RepositoryOwner: "myorg", Ref: "refs/pull/1/merge"},
+			want:   []string{"allow-api", "allow-myorg", "deny-forks-of-api"},
+		},
+		{
+			name:   "no match",
+			claims: &GitHubActionsClaims{Repository: "otherorg/api", RepositoryOwner: "otherorg"},
+			want:   nil,
+		},
+	}
+
+	compiled := policy.Compile()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(policy.EvaluateAll(tt.claims)); !slices.Equal(got, tt.want) {
+				t.Errorf("EvaluateAll() = %q, want %q", got, tt.want)
+			}
+			if got := names(compiled.EvaluateAll(tt.claims)); !slices.Equal(got, tt.want) {
+				t.Errorf("CompiledPolicy.EvaluateAll() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Evaluate keeps its single deciding rule
+	result := policy.Evaluate(tests[1].claims)
+	if result.Allowed || result.MatchedRule != "deny-forks-of-api" {
+		t.Errorf("Evaluate() = %+v, want denied by deny-forks-of-api", result)
+	}
+
+	if got := (*Policy)(nil).EvaluateAll(tests[0].claims); got != nil {
+		t.Errorf("nil policy EvaluateAll() = %v, want nil", got)
+	}
+}
@@ -0,0 +1,194 @@
+// Package policytest runs table-driven tests of ghaauth policies against
+// claim fixtures, so that policy files can be unit tested like code.
+package policytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+	"github.com/dev-shimada/gha-auth/internal/yamlutil"
+)
+
+// Case is a claims fixture with its expected decision
+type Case struct {
+	// Name describes the case
+	Name string `json:"name"`
+
+	// Claims to evaluate the policy against
+	Claims ghaauth.GitHubActionsClaims `json:"claims"`
+
+	// Expect is the expected effect, EffectAllow or EffectDeny
+	Expect ghaauth.Effect `json:"expect"`
+
+	// Rule is the expected matched rule name (optional)
+	Rule string `json:"rule,omitempty"`
+
+	// Time is when the policy is evaluated, for rules with a ValidFrom or
+	// ValidUntil window; defaults to the current time
+	Time *time.Time `json:"time,omitempty"`
+}
+
+// Failure describes how a case's decision differed from the expectation
+type Failure struct {
+	// Case is the failing case
+	Case Case
+
+	// Got is the effect the policy produced
+	Got ghaauth.Effect
+
+	// GotRule is the rule that matched, if any
+	GotRule string
+
+	// Reason is the policy's explanation of the decision
+	Reason string
+
+	// Message summarizes the mismatch
+	Message string
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("%s: %s", f.Case.Name, f.Message)
+}
+
+// Result is the outcome of running a single case
+type Result struct {
+	// Case that was run
+	Case Case
+
+	// Decision is the policy evaluation result
+	Decision *ghaauth.EvaluationResult
+
+	// Failure is nil when the case passed
+	Failure *Failure
+}
+
+// Passed reports whether the case matched its expectation
+func (r Result) Passed() bool {
+	return r.Failure == nil
+}
+
+// Run evaluates every case against the policy
+func Run(policy *ghaauth.Policy, cases []Case) []Result {
+	results := make([]Result, 0, len(cases))
+	for i, c := range cases {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+		}
+		results = append(results, Check(policy, c))
+	}
+	return results
+}
+
+// Check evaluates a single case against the policy
+func Check(policy *ghaauth.Policy, c Case) Result {
+	now := time.Now()
+	if c.Time != nil {
+		now = *c.Time
+	}
+	decision := policy.EvaluateAt(&c.Claims, now)
+	result := Result{Case: c, Decision: decision}
+
+	got := ghaauth.EffectDeny
+	if decision.Allowed {
+		got = ghaauth.EffectAllow
+	}
+
+	fail := func(format string, args ...any) Result {
+		result.Failure = &Failure{
+			Case:    c,
+			Got:     got,
+			GotRule: decision.MatchedRule,
+			Reason:  decision.Reason,
+			Message: fmt.Sprintf(format, args...),
+		}
+		return result
+	}
+
+	switch {
+	case c.Expect != ghaauth.EffectAllow && c.Expect != ghaauth.EffectDeny:
+		return fail("expect must be %q or %q", ghaauth.EffectAllow, ghaauth.EffectDeny)
+	case got != c.Expect:
+		return fail("got %s (%s), want %s", got, decision.Reason, c.Expect)
+	case c.Rule != "" && decision.MatchedRule != c.Rule:
+		return fail("matched rule %q, want %q", decision.MatchedRule, c.Rule)
+	}
+
+	return result
+}
+
+// Failures returns the failures from a set of results
+func Failures(results []Result) []*Failure {
+	var failures []*Failure
+	for _, r := range results {
+		if r.Failure != nil {
+			failures = append(failures, r.Failure)
+		}
+	}
+	return failures
+}
+
+// Assert runs every case as a subtest and reports failures through t
+func Assert(t *testing.T, policy *ghaauth.Policy, cases []Case) {
+	t.Helper()
+	for _, r := range Run(policy, cases) {
+		t.Run(r.Case.Name, func(t *testing.T) {
+			if r.Failure != nil {
+				t.Error(r.Failure.Message)
+			}
+		})
+	}
+}
+
+// fixtureFile is the on-disk format for cases
+type fixtureFile struct {
+	Cases []Case `json:"cases"`
+}
+
+// ParseCases decodes cases from a JSON document of the form
+// {"cases": [...]}
+func ParseCases(data []byte) ([]Case, error) {
+	var fixtures fixtureFile
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("failed to decode cases: %w", err)
+	}
+	return fixtures.Cases, nil
+}
+
+// LoadCases reads cases from a JSON or YAML file
+func LoadCases(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cases: %w", err)
+	}
+
+	if yamlutil.IsYAMLFile(path) {
+		if data, err = yamlutil.ToJSON(data); err != nil {
+			return nil, fmt.Errorf("failed to decode cases: %w", err)
+		}
+	}
+
+	return ParseCases(data)
+}
+
+// AssertFiles loads a policy and case file and runs Assert, so that policy
+// tests can live next to the policy documents they cover
+func AssertFiles(t *testing.T, policyPath string, casePaths ...string) {
+	t.Helper()
+
+	policy, err := ghaauth.LoadPolicyFile(policyPath)
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+
+	for _, path := range casePaths {
+		cases, err := LoadCases(path)
+		if err != nil {
+			t.Fatalf("failed to load %s: %v", path, err)
+		}
+		Assert(t, policy, cases)
+	}
+}
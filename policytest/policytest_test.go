@@ -0,0 +1,149 @@
+package policytest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+func TestAssertFiles(t *testing.T) {
+	AssertFiles(t, "testdata/policy.yaml", "testdata/cases.yaml")
+}
+
+func TestRun(t *testing.T) {
+	policy := &ghaauth.Policy{
+		Rules: []ghaauth.Rule{
+			{
+				Name:       "allow-myorg",
+				Conditions: ghaauth.Conditions{RepositoryOwner: []string{"myorg"}},
+				Effect:     ghaauth.EffectAllow,
+			},
+		},
+		DefaultDeny: true,
+	}
+
+	cases := []Case{
+		{
+			Name:   "allowed",
+			Claims: ghaauth.GitHubActionsClaims{RepositoryOwner: "myorg"},
+			Expect: ghaauth.EffectAllow,
+			Rule:   "allow-myorg",
+		},
+		{
+			Name:   "wrong decision",
+			Claims: ghaauth.GitHubActionsClaims{RepositoryOwner: "otherorg"},
+			Expect: ghaauth.EffectAllow,
+		},
+		{
+			Name:   "wrong rule",
+			Claims: ghaauth.GitHubActionsClaims{RepositoryOwner: "myorg"},
+			Expect: ghaauth.EffectAllow,
+			Rule:   "allow-everything",
+		},
+		{
+			Name:   "invalid expectation",
+			Claims: ghaauth.GitHubActionsClaims{RepositoryOwner: "myorg"},
+			Expect: "maybe",
+		},
+		{
+			Claims: ghaauth.GitHubActionsClaims{RepositoryOwner: "otherorg"},
+			Expect: ghaauth.EffectDeny,
+		},
+	}
+
+	results := Run(policy, cases)
+	if len(results) != len(cases) {
+		t.Fatalf("len(results) = %d, want %d", len(results), len(cases))
+	}
+
+	wantPassed := []bool{true, false, false, false, true}
+	for i, r := range results {
+		if r.Passed() != wantPassed[i] {
+			t.Errorf("results[%d].Passed() = %v, want %v (%v)", i, r.Passed(), wantPassed[i], r.Failure)
+		}
+	}
+
+	if results[4].Case.Name != "case 5" {
+		t.Errorf("unnamed case name = %q, want %q", results[4].Case.Name, "case 5")
+	}
+
+	failures := Failures(results)
+	if len(failures) != 3 {
+		t.Fatalf("len(Failures()) = %d, want 3", len(failures))
+	}
+
+	decision := failures[0]
+	if decision.Got != ghaauth.EffectDeny || decision.Reason != "default deny policy" {
+		t.Errorf("failure = %+v, want deny by default", decision)
+	}
+
+	rule := failures[1]
+	if rule.GotRule != "allow-myorg" || !strings.Contains(rule.Message, "allow-everything") {
+		t.Errorf("failure = %+v, want rule mismatch", rule)
+	}
+
+	var err error = failures[2]
+	var failure *Failure
+	if !errors.As(err, &failure) || !strings.HasPrefix(err.Error(), "invalid expectation: ") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestParseCases(t *testing.T) {
+	cases, err := ParseCases([]byte(`{"cases": [{"name": "a", "claims": {"repository": "myorg/myrepo"}, "expect": "allow"}]}`))
+	if err != nil {
+		t.Fatalf("ParseCases() error = %v", err)
+	}
+	if len(cases) != 1 || cases[0].Claims.Repository != "myorg/myrepo" {
+		t.Errorf("ParseCases() = %+v", cases)
+	}
+
+	if _, err := ParseCases([]byte(`{"cases": [`)); err == nil {
+		t.Error("ParseCases() error = nil for malformed JSON")
+	}
+}
+
+func TestLoadCases(t *testing.T) {
+	cases, err := LoadCases("testdata/cases.yaml")
+	if err != nil {
+		t.Fatalf("LoadCases() error = %v", err)
+	}
+	if len(cases) != 3 {
+		t.Errorf("len(cases) = %d, want 3", len(cases))
+	}
+
+	if _, err := LoadCases("testdata/missing.yaml"); err == nil {
+		t.Error("LoadCases() error = nil for missing file")
+	}
+}
+
+func TestCheck_Time(t *testing.T) {
+	policy, err := ghaauth.ParsePolicyYAML([]byte(`
+default_deny: true
+rules:
+  - name: break-glass
+    conditions:
+      repository: [myorg/legacy]
+    effect: allow
+    valid_until: 2026-12-01T00:00:00Z
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	cases, err := ParseCases([]byte(`{"cases": [
+		{"name": "active", "claims": {"repository": "myorg/legacy"}, "expect": "allow", "time": "2026-11-30T00:00:00Z"},
+		{"name": "expired", "claims": {"repository": "myorg/legacy"}, "expect": "deny", "time": "2026-12-01T00:00:00Z"}
+	]}`))
+	if err != nil {
+		t.Fatalf("ParseCases() error = %v", err)
+	}
+
+	for _, r := range Run(policy, cases) {
+		if !r.Passed() {
+			t.Error(r.Failure)
+		}
+	}
+}
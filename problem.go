@@ -0,0 +1,60 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object describing a verification
+// failure, extended with the error code and offending claims
+type Problem struct {
+	Type   string         `json:"type"`
+	Title  string         `json:"title"`
+	Status int            `json:"status"`
+	Detail string         `json:"detail,omitempty"`
+	Code   ErrorCode      `json:"code,omitempty"`
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+// NewProblem describes err as problem details. The detail and claims are
+// only included for failures caused by the token itself; upstream errors
+// such as JWKS fetch and GitHub API failures are not exposed.
+func NewProblem(err error) *Problem {
+	status := HTTPStatus(err)
+	p := &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   ErrorCodeOf(err),
+	}
+
+	var valErr *ValidationError
+	if errors.As(err, &valErr) && p.Code != CodeJWKSUnavailable && p.Code != CodeGitHubAPIUnavailable {
+		p.Detail = valErr.Reason
+		p.Claims = valErr.Claims
+	}
+
+	return p
+}
+
+// WriteProblem writes err as an application/problem+json response
+func WriteProblem(w http.ResponseWriter, err error) {
+	p := NewProblem(err)
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	if p.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// ProblemErrorHandler is a Middleware error handler that responds with
+// problem details; use it with WithErrorHandler
+func ProblemErrorHandler(w http.ResponseWriter, _ *http.Request, err error) {
+	WriteProblem(w, err)
+}
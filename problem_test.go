@@ -0,0 +1,92 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNewProblem(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Problem
+	}{
+		{
+			name: "audience mismatch with claims",
+			err:  newClaimError(ErrInvalidAudience, "audience mismatch", map[string]any{"aud": []string{"sts.amazonaws.com"}}),
+			want: Problem{
+				Type:   "about:blank",
+				Title:  "Unauthorized",
+				Status: http.StatusUnauthorized,
+				Detail: "audience mismatch",
+				Code:   CodeAudienceMismatch,
+				Claims: map[string]any{"aud": []string{"sts.amazonaws.com"}},
+			},
+		},
+		{
+			name: "policy denial",
+			err:  NewValidationError(ErrAccessDenied, "no matching rule"),
+			want: Problem{
+				Type:   "about:blank",
+				Title:  "Forbidden",
+				Status: http.StatusForbidden,
+				Detail: "no matching rule",
+				Code:   CodePolicyDenied,
+			},
+		},
+		{
+			name: "jwks failure hides detail",
+			err:  NewValidationError(ErrJWKSFetch, "dial tcp 10.0.0.1:443: connection refused"),
+			want: Problem{
+				Type:   "about:blank",
+				Title:  "Unauthorized",
+				Status: http.StatusUnauthorized,
+				Code:   CodeJWKSUnavailable,
+			},
+		},
+		{
+			name: "foreign error",
+			err:  errors.New("boom"),
+			want: Problem{
+				Type:   "about:blank",
+				Title:  "Unauthorized",
+				Status: http.StatusUnauthorized,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewProblem(tt.err); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("NewProblem() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteProblem(rec, NewValidationError(ErrTokenExpired, "token has expired"))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if got := rec.Header().Get("Content-Type"); got != ProblemContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ProblemContentType)
+	}
+	if got := rec.Header().Get("WWW-Authenticate"); got != "Bearer" {
+		t.Errorf("WWW-Authenticate = %q, want Bearer", got)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if body["code"] != "token_expired" || body["status"] != float64(401) {
+		t.Errorf("body = %v, want code token_expired and status 401", body)
+	}
+}
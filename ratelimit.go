@@ -0,0 +1,109 @@
+package ghaauth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimiter throttles callers after the policy has allowed them.
+// Implementations must be safe for concurrent use and should return errors
+// wrapping ErrRateLimited, which HTTPStatus maps to 429.
+type RateLimiter interface {
+	// Allow returns nil if the identity may proceed
+	Allow(ctx context.Context, identity Identity) error
+}
+
+// WithRateLimiter sets a rate limiter consulted for every token the policy
+// allows
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(v *Verifier) {
+		v.rateLimiter = limiter
+	}
+}
+
+// maxIdleBuckets is the number of buckets above which full, idle buckets
+// are dropped
+const maxIdleBuckets = 10000
+
+// TokenBucketLimiter is an in-memory RateLimiter with one token bucket per
+// key. Each bucket holds up to burst tokens and refills at rate tokens per
+// second.
+type TokenBucketLimiter struct {
+	rate  float64
+	burst float64
+	key   func(Identity) string
+	clock Clock
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket is the state of one key
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter creates a limiter allowing rate requests per second
+// with bursts of up to burst requests per key. The key defaults to the
+// canonical Identity string; use e.g. func(i Identity) string { return
+// i.Org + "/" + i.Repo } to limit whole repositories.
+func NewTokenBucketLimiter(rate float64, burst int, key func(Identity) string) *TokenBucketLimiter {
+	if key == nil {
+		key = Identity.String
+	}
+
+	return &TokenBucketLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		key:     key,
+		clock:   DefaultClock{},
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow takes a token from the identity's bucket
+func (l *TokenBucketLimiter) Allow(_ context.Context, identity Identity) error {
+	key := l.key(identity)
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.prune(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	l.refill(b, now)
+	if b.tokens < 1 {
+		return NewValidationError(ErrRateLimited, fmt.Sprintf("too many requests from %s", key))
+	}
+	b.tokens--
+	return nil
+}
+
+// refill adds the tokens accumulated since the bucket was last used
+func (l *TokenBucketLimiter) refill(b *tokenBucket, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+}
+
+// prune drops buckets that have refilled completely, as they are in the
+// same state as a new bucket
+func (l *TokenBucketLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+// manualClock is a Clock that only moves when advanced
+type manualClock struct {
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.now
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	limiter := NewTokenBucketLimiter(1, 2, nil)
+	limiter.clock = clock
+
+	ctx := context.Background()
+	noisy := Identity{Org: "myorg", Repo: "noisy", Ref: "refs/heads/main", Workflow: "CI"}
+	quiet := Identity{Org: "myorg", Repo: "quiet", Ref: "refs/heads/main", Workflow: "CI"}
+
+	steps := []struct {
+		name     string
+		advance  time.Duration
+		identity Identity
+		wantErr  bool
+	}{
+		{name: "first request", identity: noisy},
+		{name: "burst", identity: noisy},
+		{name: "bucket empty", identity: noisy, wantErr: true},
+		{name: "other identity has its own bucket", identity: quiet},
+		{name: "half a token refilled", advance: 500 * time.Millisecond, identity: noisy, wantErr: true},
+		{name: "one token refilled", advance: 500 * time.Millisecond, identity: noisy},
+		{name: "refill is capped at burst", advance: time.Hour, identity: noisy},
+		{name: "second token after long idle", identity: noisy},
+		{name: "empty again", identity: noisy, wantErr: true},
+	}
+
+	for _, step := range steps {
+		clock.now = clock.now.Add(step.advance)
+		err := limiter.Allow(ctx, step.identity)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: Allow() error = %v, wantErr %v", step.name, err, step.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("%s: Allow() error = %v, want ErrRateLimited", step.name, err)
+		}
+	}
+}
+
+func TestTokenBucketLimiter_Prune(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	limiter := NewTokenBucketLimiter(1, 1, func(i Identity) string { return i.RunID })
+	limiter.clock = clock
+
+	for i := 0; i < maxIdleBuckets; i++ {
+		_ = limiter.Allow(context.Background(), Identity{RunID: time.Duration(i).String()})
+	}
+
+	// All buckets have refilled by now and are dropped for the new key
+	clock.now = clock.now.Add(time.Second)
+	_ = limiter.Allow(context.Background(), Identity{RunID: "new"})
+	if got := len(limiter.buckets); got != 1 {
+		t.Errorf("buckets = %d after prune, want 1", got)
+	}
+}
+
+func TestWithRateLimiter(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithRateLimiter(NewTokenBucketLimiter(0.001, 1, nil)),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Fatalf("first Verify() error = %v", err)
+	}
+
+	_, err = verifier.Verify(context.Background(), token)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("second Verify() error = %v, want ErrRateLimited", err)
+	}
+	if code := ErrorCodeOf(err); code != CodeRateLimited {
+		t.Errorf("ErrorCodeOf() = %q, want %q", code, CodeRateLimited)
+	}
+	if status := HTTPStatus(err); status != http.StatusTooManyRequests {
+		t.Errorf("HTTPStatus() = %d, want 429", status)
+	}
+}
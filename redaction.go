@@ -0,0 +1,109 @@
+package ghaauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"reflect"
+)
+
+// RedactionAction is how a claim is treated by Redact
+type RedactionAction int
+
+const (
+	// RedactKeep leaves the claim as is
+	RedactKeep RedactionAction = iota
+
+	// RedactRemove drops the claim
+	RedactRemove
+
+	// RedactHash replaces the claim with a hash, so that records about the
+	// same value can still be correlated
+	RedactHash
+)
+
+// RedactionPolicy selects which claims Redact removes or hashes
+type RedactionPolicy struct {
+	// Claims maps claim names, including Extra ones, to their action.
+	// Claims not listed are kept.
+	Claims map[string]RedactionAction
+
+	// HashKey keys the hash with HMAC-SHA256. Without a key, hashes of
+	// guessable values such as user names can be reversed by trying them.
+	HashKey []byte
+}
+
+// DefaultRedactionPolicy hashes the claims identifying the actor and the
+// enterprise
+var DefaultRedactionPolicy = RedactionPolicy{
+	Claims: map[string]RedactionAction{
+		"actor":            RedactHash,
+		"actor_id":         RedactHash,
+		"triggering_actor": RedactHash,
+		"enterprise_id":    RedactHash,
+		"enterprise_slug":  RedactHash,
+	},
+}
+
+// Redacted returns a copy of the claims redacted with DefaultRedactionPolicy
+func (c *GitHubActionsClaims) Redacted() *GitHubActionsClaims {
+	return c.Redact(DefaultRedactionPolicy)
+}
+
+// Redact returns a copy of the claims with the policy applied. Claims that
+// are not strings are removed rather than hashed.
+func (c *GitHubActionsClaims) Redact(policy RedactionPolicy) *GitHubActionsClaims {
+	redacted := *c
+	redacted.Extra = maps.Clone(c.Extra)
+	fields := reflect.ValueOf(&redacted).Elem()
+
+	for name, action := range policy.Claims {
+		if action == RedactKeep {
+			continue
+		}
+
+		if index, ok := claimFields[name]; ok {
+			field := fields.FieldByIndex(index)
+			if action == RedactHash && field.Kind() == reflect.String && field.String() != "" {
+				field.SetString(policy.hash(field.String()))
+			} else {
+				field.SetZero()
+			}
+			continue
+		}
+
+		value, ok := redacted.Extra[name]
+		if !ok {
+			continue
+		}
+		if s, isString := value.(string); action == RedactHash && isString {
+			redacted.Extra[name] = policy.hash(s)
+		} else {
+			delete(redacted.Extra, name)
+		}
+	}
+
+	return &redacted
+}
+
+// MarshalSafe encodes the claims redacted with DefaultRedactionPolicy, for
+// audit logs
+func (c *GitHubActionsClaims) MarshalSafe() ([]byte, error) {
+	return json.Marshal(c.Redacted())
+}
+
+// hash returns the hex encoded, truncated SHA-256 (or HMAC-SHA256) of value
+func (p RedactionPolicy) hash(value string) string {
+	var sum []byte
+	if len(p.HashKey) > 0 {
+		mac := hmac.New(sha256.New, p.HashKey)
+		mac.Write([]byte(value))
+		sum = mac.Sum(nil)
+	} else {
+		digest := sha256.Sum256([]byte(value))
+		sum = digest[:]
+	}
+	return "sha256:" + hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,124 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestGitHubActionsClaims_Redact(t *testing.T) {
+	claims := &GitHubActionsClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience: jwt.ClaimStrings{"https://api.example.com"},
+		},
+		Repository:     "myorg/myrepo",
+		Actor:          "johndoe",
+		ActorID:        "11111",
+		EnterpriseSlug: "acme",
+		Extra: map[string]any{
+			"custom_email": "john@example.com",
+			"custom_teams": []any{"a", "b"},
+			"custom_team":  "platform",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		policy RedactionPolicy
+		check  func(t *testing.T, redacted *GitHubActionsClaims)
+	}{
+		{
+			name:   "default policy hashes actor and enterprise",
+			policy: DefaultRedactionPolicy,
+			check: func(t *testing.T, redacted *GitHubActionsClaims) {
+				if redacted.Actor == "johndoe" || !strings.HasPrefix(redacted.Actor, "sha256:") {
+					t.Errorf("Actor = %q, want hash", redacted.Actor)
+				}
+				if redacted.ActorID == "11111" || redacted.EnterpriseSlug == "acme" {
+					t.Errorf("ActorID = %q, EnterpriseSlug = %q, want hashes", redacted.ActorID, redacted.EnterpriseSlug)
+				}
+				if redacted.Repository != "myorg/myrepo" {
+					t.Errorf("Repository = %q, want it kept", redacted.Repository)
+				}
+				if redacted.TriggeringActor != "" || redacted.EnterpriseID != "" {
+					t.Errorf("empty claims were filled in")
+				}
+			},
+		},
+		{
+			name: "remove and hash Extra claims",
+			policy: RedactionPolicy{Claims: map[string]RedactionAction{
+				"custom_email": RedactRemove,
+				"custom_teams": RedactHash,
+				"custom_team":  RedactHash,
+				"aud":          RedactHash,
+			}},
+			check: func(t *testing.T, redacted *GitHubActionsClaims) {
+				if _, ok := redacted.Extra["custom_email"]; ok {
+					t.Error("custom_email was kept")
+				}
+				if _, ok := redacted.Extra["custom_teams"]; ok {
+					t.Error("non-string custom_teams was kept, want it removed")
+				}
+				if team, _ := redacted.ExtraString("custom_team"); !strings.HasPrefix(team, "sha256:") {
+					t.Errorf("custom_team = %q, want hash", team)
+				}
+				if redacted.Audience != nil {
+					t.Errorf("Audience = %v, want it removed", redacted.Audience)
+				}
+				if redacted.Actor != "johndoe" {
+					t.Errorf("Actor = %q, want it kept", redacted.Actor)
+				}
+			},
+		},
+		{
+			name: "keyed hash differs from plain hash",
+			policy: RedactionPolicy{
+				Claims:  map[string]RedactionAction{"actor": RedactHash},
+				HashKey: []byte("secret"),
+			},
+			check: func(t *testing.T, redacted *GitHubActionsClaims) {
+				if plain := claims.Redacted().Actor; redacted.Actor == plain {
+					t.Errorf("keyed hash %q equals unkeyed hash", redacted.Actor)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, claims.Redact(tt.policy))
+
+			// The original claims are not modified
+			if claims.Actor != "johndoe" || claims.Extra["custom_email"] != "john@example.com" || len(claims.Audience) != 1 {
+				t.Fatalf("Redact() modified the original claims: %+v", claims)
+			}
+		})
+	}
+
+	if a, b := claims.Redacted().Actor, claims.Redacted().Actor; a != b {
+		t.Errorf("hashes are not stable: %q != %q", a, b)
+	}
+}
+
+func TestGitHubActionsClaims_MarshalSafe(t *testing.T) {
+	claims := &GitHubActionsClaims{Repository: "myorg/myrepo", Actor: "johndoe"}
+
+	data, err := claims.MarshalSafe()
+	if err != nil {
+		t.Fatalf("MarshalSafe() error = %v", err)
+	}
+	if strings.Contains(string(data), "johndoe") {
+		t.Errorf("MarshalSafe() = %s, contains the actor", data)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("MarshalSafe() produced invalid JSON: %v", err)
+	}
+	if decoded["repository"] != "myorg/myrepo" {
+		t.Errorf("repository = %v, want myorg/myrepo", decoded["repository"])
+	}
+}
@@ -0,0 +1,23 @@
+module github.com/dev-shimada/gha-auth/redis
+
+go 1.25.6
+
+// The replace only applies when building inside this repository; users of
+// the module get the required release of gha-auth.
+replace github.com/dev-shimada/gha-auth => ../
+
+require (
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/dev-shimada/gha-auth v0.1.0
+	github.com/redis/go-redis/v9 v9.22.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/fsnotify/fsnotify v1.10.1 // indirect
+	github.com/golang-jwt/jwt/v5 v5.3.1 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,76 @@
+// Package redisghaauth provides a Redis-backed ghaauth.KeyCache so that
+// horizontally scaled services share one JWKS cache.
+package redisghaauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// DefaultKeyPrefix is prepended to the JWKS URL to form the Redis key
+const DefaultKeyPrefix = "ghaauth:jwks:"
+
+// Option configures the KeyCache
+type Option func(*KeyCache)
+
+// WithKeyPrefix sets the prefix for Redis keys
+func WithKeyPrefix(prefix string) Option {
+	return func(c *KeyCache) {
+		c.prefix = prefix
+	}
+}
+
+// KeyCache stores ghaauth key sets in Redis
+type KeyCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// Ensure KeyCache implements ghaauth.KeyCache
+var _ ghaauth.KeyCache = (*KeyCache)(nil)
+
+// NewKeyCache creates a KeyCache using the given client
+func NewKeyCache(client redis.UniversalClient, opts ...Option) *KeyCache {
+	c := &KeyCache{
+		client: client,
+		prefix: DefaultKeyPrefix,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Get returns the cached key set for the URL, or nil if none is cached
+func (c *KeyCache) Get(ctx context.Context, url string) (*ghaauth.KeySet, error) {
+	data, err := c.client.Get(ctx, c.prefix+url).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys ghaauth.KeySet
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// Set stores the key set for the URL with the given expiry
+func (c *KeyCache) Set(ctx context.Context, url string, keys *ghaauth.KeySet, ttl time.Duration) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, c.prefix+url, data, ttl).Err()
+}
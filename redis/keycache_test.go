@@ -0,0 +1,102 @@
+package redisghaauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+	"github.com/dev-shimada/gha-auth/ghaauthtest"
+)
+
+func TestKeyCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer func() { _ = client.Close() }()
+
+	gen, err := ghaauthtest.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	ctx := context.Background()
+	cache := NewKeyCache(client, WithKeyPrefix("test:"))
+	url := "https://token.actions.githubusercontent.com/.well-known/jwks"
+
+	keys, err := cache.Get(ctx, url)
+	if err != nil || keys != nil {
+		t.Fatalf("Get() on empty cache = %v, %v, want nil, nil", keys, err)
+	}
+
+	set := &ghaauth.KeySet{
+		Keys:      map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()},
+		FetchedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if err := cache.Set(ctx, url, set, time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if !server.Exists("test:" + url) {
+		t.Fatal("key set not stored under prefixed key")
+	}
+	if ttl := server.TTL("test:" + url); ttl != time.Minute {
+		t.Errorf("TTL = %v, want %v", ttl, time.Minute)
+	}
+
+	keys, err = cache.Get(ctx, url)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !keys.FetchedAt.Equal(set.FetchedAt) {
+		t.Errorf("FetchedAt = %v, want %v", keys.FetchedAt, set.FetchedAt)
+	}
+	if key := keys.Keys[gen.KeyID()]; key == nil || !key.Equal(gen.PublicKey()) {
+		t.Error("cached key does not match original")
+	}
+
+	server.FastForward(2 * time.Minute)
+
+	if keys, _ := cache.Get(ctx, url); keys != nil {
+		t.Error("Get() returned expired keys")
+	}
+}
+
+func TestKeyCache_WithVerifier(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer func() { _ = client.Close() }()
+
+	gen, err := ghaauthtest.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	jwksServer := ghaauthtest.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer jwksServer.Close()
+
+	jwksURL := jwksServer.URL() + "/.well-known/jwks"
+	verifier, err := ghaauth.New(
+		ghaauth.WithJWKSURL(jwksURL),
+		ghaauth.WithKeyCache(NewKeyCache(client)),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tokenString, err := gen.GenerateToken(ghaauthtest.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	if _, err := verifier.Verify(context.Background(), tokenString); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	if !server.Exists(DefaultKeyPrefix + jwksURL) {
+		t.Error("verifier did not store fetched keys in Redis")
+	}
+}
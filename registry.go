@@ -0,0 +1,154 @@
+package ghaauth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// fetcherPool shares JWKS fetchers by URL between the verifiers of a
+// Registry, so that each JWKS is fetched and cached once
+type fetcherPool struct {
+	mu       sync.Mutex
+	fetchers map[string]*JWKSFetcher
+}
+
+// get returns the fetcher for url, creating it with newFetcher if needed
+func (p *fetcherPool) get(url string, newFetcher func() *JWKSFetcher) *JWKSFetcher {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fetcher, ok := p.fetchers[url]
+	if !ok {
+		fetcher = newFetcher()
+		p.fetchers[url] = fetcher
+	}
+	return fetcher
+}
+
+// Registry manages named verifiers, such as one per tenant of a SaaS
+// backend with its own audience and policy. Verifiers share JWKS fetchers,
+// except for issuers with static keys or pinned thumbprints.
+type Registry struct {
+	base     []Option
+	fetchers *fetcherPool
+
+	mu         sync.RWMutex
+	verifiers  map[string]*Verifier
+	byAudience map[string]string
+}
+
+// NewRegistry creates a registry whose verifiers are built with opts
+// followed by their own options. Fetcher settings such as WithHTTPClient
+// and WithJWKSCacheDuration belong here: a shared fetcher keeps the
+// settings of the verifier that created it.
+func NewRegistry(opts ...Option) *Registry {
+	return &Registry{
+		base:       opts,
+		fetchers:   &fetcherPool{fetchers: make(map[string]*JWKSFetcher)},
+		verifiers:  make(map[string]*Verifier),
+		byAudience: make(map[string]string),
+	}
+}
+
+// Register creates the verifier for a tenant. Tenant names and audiences
+// must be unique within the registry.
+func (r *Registry) Register(tenant string, opts ...Option) (*Verifier, error) {
+	opts = append(slices.Clip(r.base), opts...)
+	opts = append(opts, func(v *Verifier) { v.fetchers = r.fetchers })
+
+	v, err := New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q: %w", tenant, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.verifiers[tenant]; ok {
+		return nil, fmt.Errorf("tenant %q is already registered", tenant)
+	}
+	if other, ok := r.byAudience[v.audience]; ok && v.audience != "" {
+		return nil, fmt.Errorf("tenant %q: audience %q is already used by tenant %q", tenant, v.audience, other)
+	}
+
+	r.verifiers[tenant] = v
+	if v.audience != "" {
+		r.byAudience[v.audience] = tenant
+	}
+	return v, nil
+}
+
+// Remove unregisters a tenant
+func (r *Registry) Remove(tenant string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.verifiers[tenant]; ok {
+		delete(r.byAudience, v.audience)
+		delete(r.verifiers, tenant)
+	}
+}
+
+// Lookup returns the verifier of a tenant
+func (r *Registry) Lookup(tenant string) (*Verifier, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.verifiers[tenant]
+	return v, ok
+}
+
+// LookupAudience returns the tenant and verifier expecting an audience
+func (r *Registry) LookupAudience(audience string) (string, *Verifier, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenant, ok := r.byAudience[audience]
+	if !ok {
+		return "", nil, false
+	}
+	return tenant, r.verifiers[tenant], true
+}
+
+// Tenants returns the registered tenant names in sorted order
+func (r *Registry) Tenants() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenants := make([]string, 0, len(r.verifiers))
+	for tenant := range r.verifiers {
+		tenants = append(tenants, tenant)
+	}
+	slices.Sort(tenants)
+	return tenants
+}
+
+// Verify verifies a token with the verifier of a tenant
+func (r *Registry) Verify(ctx context.Context, tenant, tokenString string) (*VerificationResult, error) {
+	v, ok := r.Lookup(tenant)
+	if !ok {
+		return nil, NewValidationError(ErrUnknownTenant, fmt.Sprintf("no verifier for tenant %q", tenant))
+	}
+	return v.Verify(ctx, tokenString)
+}
+
+// VerifyAudience verifies a token with the verifier expecting one of its
+// audiences, for backends that tell tenants apart by audience alone. The
+// audience is read before the signature is checked, but only selects the
+// verifier, which then checks the token in full.
+func (r *Registry) VerifyAudience(ctx context.Context, tokenString string) (string, *VerificationResult, error) {
+	claims, err := ParseUnverified(tokenString)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, aud := range claims.Audience {
+		if tenant, v, ok := r.LookupAudience(aud); ok {
+			result, err := v.Verify(ctx, tokenString)
+			return tenant, result, err
+		}
+	}
+	return "", nil, newClaimError(ErrUnknownTenant, "no verifier for the token's audience", map[string]any{"aud": []string(claims.Audience)})
+}
@@ -0,0 +1,139 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestRegistry(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	registry := NewRegistry(WithJWKSURL(server.URL() + "/.well-known/jwks"))
+
+	acme, err := registry.Register("acme",
+		WithAudience("https://acme.example.com"),
+		WithPolicy(&Policy{DefaultDeny: true, Rules: []Rule{{Conditions: Conditions{RepositoryOwner: []string{"acme"}}, Effect: EffectAllow}}}),
+	)
+	if err != nil {
+		t.Fatalf("Register(acme) error = %v", err)
+	}
+	globex, err := registry.Register("globex", WithAudience("https://globex.example.com"))
+	if err != nil {
+		t.Fatalf("Register(globex) error = %v", err)
+	}
+	pinned, err := registry.Register("pinned", WithAudience("https://pinned.example.com"), WithKeyThumbprints(Thumbprint(gen.PublicKey())))
+	if err != nil {
+		t.Fatalf("Register(pinned) error = %v", err)
+	}
+
+	if acme.issuers[DefaultIssuer].fetcher != globex.issuers[DefaultIssuer].fetcher {
+		t.Error("verifiers with the same JWKS URL do not share a fetcher")
+	}
+	if pinned.issuers[DefaultIssuer].fetcher == acme.issuers[DefaultIssuer].fetcher {
+		t.Error("verifier with pinned thumbprints shares a fetcher")
+	}
+
+	if got := registry.Tenants(); !reflect.DeepEqual(got, []string{"acme", "globex", "pinned"}) {
+		t.Errorf("Tenants() = %v", got)
+	}
+
+	token := func(owner, audience string) string {
+		claims := testutil.DefaultClaims()
+		claims.RepositoryOwner = owner
+		claims.Repository = owner + "/repo"
+		claims.Audience = []string{audience}
+		tokenString, err := gen.GenerateToken(claims.ToJWT())
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		return tokenString
+	}
+
+	tests := []struct {
+		name       string
+		tenant     string
+		token      string
+		wantErr    error
+		wantTenant string
+	}{
+		{name: "allowed by tenant policy", tenant: "acme", token: token("acme", "https://acme.example.com"), wantTenant: "acme"},
+		{name: "denied by tenant policy", tenant: "acme", token: token("other", "https://acme.example.com"), wantErr: ErrAccessDenied},
+		{name: "other tenant's audience", tenant: "globex", token: token("acme", "https://acme.example.com"), wantErr: ErrInvalidAudience, wantTenant: "acme"},
+		{name: "unknown tenant", tenant: "initech", token: token("acme", "https://initech.example.com"), wantErr: ErrUnknownTenant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := registry.Verify(context.Background(), tt.tenant, tt.token)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("by audience", func(t *testing.T) {
+		tenant, result, err := registry.VerifyAudience(context.Background(), token("acme", "https://acme.example.com"))
+		if err != nil {
+			t.Fatalf("VerifyAudience() error = %v", err)
+		}
+		if tenant != "acme" || result.Claims.RepositoryOwner != "acme" {
+			t.Errorf("VerifyAudience() = %q, %+v", tenant, result.Claims)
+		}
+
+		if _, _, err := registry.VerifyAudience(context.Background(), token("acme", "https://initech.example.com")); !errors.Is(err, ErrUnknownTenant) {
+			t.Errorf("VerifyAudience() error = %v, want ErrUnknownTenant", err)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		registry.Remove("globex")
+		if _, ok := registry.Lookup("globex"); ok {
+			t.Error("Lookup() found a removed tenant")
+		}
+		if _, _, ok := registry.LookupAudience("https://globex.example.com"); ok {
+			t.Error("LookupAudience() found a removed tenant's audience")
+		}
+	})
+}
+
+func TestRegistry_RegisterErrors(t *testing.T) {
+	registry := NewRegistry()
+	if _, err := registry.Register("acme", WithAudience("https://acme.example.com")); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tenant string
+		opts   []Option
+	}{
+		{name: "duplicate tenant", tenant: "acme", opts: []Option{WithAudience("https://other.example.com")}},
+		{name: "duplicate audience", tenant: "globex", opts: []Option{WithAudience("https://acme.example.com")}},
+		{name: "invalid options", tenant: "initech", opts: []Option{WithRunnerEnvironments("on-prem")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := registry.Register(tt.tenant, tt.opts...); err == nil {
+				t.Fatal("Register() error = nil, want error")
+			}
+		})
+	}
+
+	if got := registry.Tenants(); !reflect.DeepEqual(got, []string{"acme"}) {
+		t.Errorf("Tenants() = %v, want [acme]", got)
+	}
+}
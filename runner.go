@@ -0,0 +1,45 @@
+package ghaauth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Runner environments reported in the runner_environment claim
+const (
+	// RunnerGitHubHosted is a runner managed by GitHub
+	RunnerGitHubHosted = "github-hosted"
+
+	// RunnerSelfHosted is a runner managed by the repository owner
+	RunnerSelfHosted = "self-hosted"
+)
+
+// WithRunnerEnvironments only accepts tokens minted on the given runner
+// environments, e.g. WithRunnerEnvironments(RunnerGitHubHosted) refuses
+// tokens from self-hosted runners. Tokens without a runner_environment
+// claim are rejected.
+func WithRunnerEnvironments(envs ...string) Option {
+	return func(v *Verifier) {
+		for _, env := range envs {
+			if env != RunnerGitHubHosted && env != RunnerSelfHosted {
+				v.optionErrs = append(v.optionErrs, fmt.Errorf("unknown runner environment %q: must be %q or %q",
+					env, RunnerGitHubHosted, RunnerSelfHosted))
+			}
+		}
+		v.runnerEnvs = append(v.runnerEnvs, envs...)
+	}
+}
+
+// checkRunnerEnvironment enforces WithRunnerEnvironments
+func (v *Verifier) checkRunnerEnvironment(claims *GitHubActionsClaims) error {
+	if len(v.runnerEnvs) == 0 {
+		return nil
+	}
+
+	if !slices.Contains(v.runnerEnvs, claims.RunnerEnvironment) {
+		return newClaimError(ErrAccessDenied, "runner environment is not allowed",
+			map[string]any{"runner_environment": claims.RunnerEnvironment})
+	}
+
+	return nil
+}
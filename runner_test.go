@@ -0,0 +1,63 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestWithRunnerEnvironments(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithRunnerEnvironments(RunnerGitHubHosted),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		runner  string
+		wantErr bool
+	}{
+		{name: "github-hosted runner", runner: RunnerGitHubHosted},
+		{name: "self-hosted runner", runner: RunnerSelfHosted, wantErr: true},
+		{name: "missing runner_environment", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testutil.DefaultClaims()
+			claims.RunnerEnvironment = tt.runner
+
+			tokenString, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tokenString)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrAccessDenied) {
+				t.Errorf("Verify() error = %v, want ErrAccessDenied", err)
+			}
+		})
+	}
+}
+
+func TestWithRunnerEnvironments_Unknown(t *testing.T) {
+	if _, err := New(WithRunnerEnvironments("github_hosted")); err == nil {
+		t.Fatal("New() expected error for unknown runner environment")
+	}
+}
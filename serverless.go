@@ -0,0 +1,140 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Defaults of NewLazy, tuned for the short invocations of serverless
+// functions
+const (
+	// ServerlessHTTPTimeout bounds JWKS requests
+	ServerlessHTTPTimeout = 2 * time.Second
+
+	// ServerlessVerifyTimeout bounds each verification
+	ServerlessVerifyTimeout = 3 * time.Second
+)
+
+// ServerlessRetryPolicy retries a failed JWKS request once, quickly
+var ServerlessRetryPolicy = RetryPolicy{
+	MaxAttempts:    2,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     200 * time.Millisecond,
+	MaxElapsed:     time.Second,
+}
+
+// JWKSEnv is the environment variable from which NewLazy seeds the key
+// cache with a JWKS document, e.g. GitHub's JWKS set in the function's
+// configuration at deploy time, so that cold starts make no JWKS request
+const JWKSEnv = "GHA_AUTH_JWKS"
+
+// LazyVerifier is a Verifier built on first use, for serverless functions
+// (AWS Lambda, Cloud Functions, ...) where unused work delays cold starts.
+// It starts no goroutines of its own. A LazyVerifier is safe for
+// concurrent use.
+type LazyVerifier struct {
+	opts []Option
+
+	once     sync.Once
+	verifier *Verifier
+	err      error
+}
+
+var _ TokenVerifier = (*LazyVerifier)(nil)
+
+// NewLazy returns a verifier that applies opts and, if JWKSEnv is set,
+// seeds the key cache on first use rather than at construction, so it can
+// be a package-level variable of a function. Its defaults suit short
+// invocations: ServerlessHTTPTimeout, ServerlessVerifyTimeout and
+// ServerlessRetryPolicy, which opts may override. Configuration errors are
+// returned by Warm and every verification.
+func NewLazy(opts ...Option) *LazyVerifier {
+	defaults := []Option{
+		WithHTTPClient(&http.Client{Timeout: ServerlessHTTPTimeout}),
+		WithVerifyTimeout(ServerlessVerifyTimeout),
+		WithJWKSRetry(ServerlessRetryPolicy),
+	}
+	return &LazyVerifier{opts: append(defaults, opts...)}
+}
+
+// Verifier returns the underlying Verifier, building it on first call
+func (l *LazyVerifier) Verifier() (*Verifier, error) {
+	l.once.Do(func() {
+		l.verifier, l.err = New(l.opts...)
+		if l.err == nil {
+			l.err = l.verifier.seedKeysFromEnv()
+		}
+		if l.err != nil {
+			l.verifier = nil
+		}
+	})
+	return l.verifier, l.err
+}
+
+// Warm builds the verifier and fetches the signing keys that are not
+// cached yet. Call it during the function's initialization phase, which
+// AWS Lambda runs with boosted CPU before the first request: afterwards,
+// verifications make no network calls until the keys expire.
+func (l *LazyVerifier) Warm(ctx context.Context) error {
+	v, err := l.Verifier()
+	if err != nil {
+		return err
+	}
+	return v.warmKeys(ctx)
+}
+
+// Verify builds the verifier if needed and verifies the token
+func (l *LazyVerifier) Verify(ctx context.Context, tokenString string) (*VerificationResult, error) {
+	return l.VerifyWith(ctx, tokenString)
+}
+
+// VerifyWith builds the verifier if needed and verifies the token with
+// per-call overrides
+func (l *LazyVerifier) VerifyWith(ctx context.Context, tokenString string, opts ...VerifyOption) (*VerificationResult, error) {
+	v, err := l.Verifier()
+	if err != nil {
+		return nil, err
+	}
+	return v.VerifyWith(ctx, tokenString, opts...)
+}
+
+// seedKeysFromEnv stores the keys of the JWKSEnv document in the key cache
+// of the default JWKS URL, unless keys are cached already
+func (v *Verifier) seedKeysFromEnv() error {
+	data := os.Getenv(JWKSEnv)
+	if data == "" {
+		return nil
+	}
+	keys, err := ParseJWKS([]byte(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", JWKSEnv, err)
+	}
+
+	ctx := context.Background()
+	if cached, err := v.keyCache.Get(ctx, v.jwksURL); err == nil && cached != nil {
+		return nil
+	}
+	return v.keyCache.Set(ctx, v.jwksURL, &KeySet{Keys: keys, FetchedAt: time.Now()}, v.jwksCacheDuration)
+}
+
+// warmKeys primes the fetchers of issuers whose keys are not cached
+func (v *Verifier) warmKeys(ctx context.Context) error {
+	if v.keySet != nil {
+		return nil
+	}
+	var errs []error
+	for url, issuer := range v.issuers {
+		if keys, err := issuer.fetcher.keyCache.Get(ctx, issuer.fetcher.url); err == nil && keys != nil {
+			continue
+		}
+		if err := issuer.fetcher.Prime(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("issuer %q: %w", url, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package ghaauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestNewLazy(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		lazy := NewLazy(WithAudience("https://api.example.com"), WithJWKSURL(server.JWKSURL()))
+		v, err := lazy.Verifier()
+		if err != nil {
+			t.Fatalf("Verifier() error = %v", err)
+		}
+		if v.httpClient.Timeout != ServerlessHTTPTimeout || v.verifyTimeout != ServerlessVerifyTimeout || v.jwksRetry != ServerlessRetryPolicy {
+			t.Errorf("defaults = %v, %v, %+v, want serverless defaults", v.httpClient.Timeout, v.verifyTimeout, v.jwksRetry)
+		}
+		if again, _ := lazy.Verifier(); again != v {
+			t.Error("Verifier() built a second verifier")
+		}
+
+		custom, err := NewLazy(WithVerifyTimeout(time.Second)).Verifier()
+		if err != nil || custom.verifyTimeout != time.Second {
+			t.Errorf("verify timeout = %v, want options to override the defaults", custom.verifyTimeout)
+		}
+	})
+
+	t.Run("warm", func(t *testing.T) {
+		lazy := NewLazy(WithAudience("https://api.example.com"), WithJWKSURL(server.JWKSURL()))
+		before := server.Fetches()
+		if err := lazy.Warm(context.Background()); err != nil {
+			t.Fatalf("Warm() error = %v", err)
+		}
+		if server.Fetches() != before+1 {
+			t.Errorf("fetches = %d, want the keys fetched once by Warm", server.Fetches()-before)
+		}
+		if err := lazy.Warm(context.Background()); err != nil {
+			t.Fatalf("second Warm() error = %v", err)
+		}
+		if _, err := lazy.Verify(context.Background(), token); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if server.Fetches() != before+1 {
+			t.Errorf("fetches = %d, want none after Warm", server.Fetches()-before)
+		}
+	})
+
+	t.Run("keys from environment", func(t *testing.T) {
+		jwks, _ := json.Marshal(JWKS{Keys: []JWK{{
+			Kid: gen.KeyID(), Kty: "RSA", Alg: "RS256", Use: "sig",
+			N: base64.RawURLEncoding.EncodeToString(gen.PublicKey().N.Bytes()),
+			E: "AQAB",
+		}}})
+		t.Setenv(JWKSEnv, string(jwks))
+
+		server.SetStatus(http.StatusServiceUnavailable)
+		defer server.SetStatus(http.StatusOK)
+
+		lazy := NewLazy(WithAudience("https://api.example.com"), WithJWKSURL(server.JWKSURL()))
+		before := server.Fetches()
+		if err := lazy.Warm(context.Background()); err != nil {
+			t.Fatalf("Warm() error = %v", err)
+		}
+		if _, err := lazy.Verify(context.Background(), token); err != nil {
+			t.Fatalf("Verify() error = %v with keys from %s", err, JWKSEnv)
+		}
+		if server.Fetches() != before {
+			t.Errorf("fetches = %d, want none", server.Fetches()-before)
+		}
+	})
+
+	t.Run("configuration errors", func(t *testing.T) {
+		lazy := NewLazy(WithPolicy(&Policy{Rules: []Rule{{Effect: "maybe"}}}))
+		if err := lazy.Warm(context.Background()); err == nil {
+			t.Error("Warm() error = nil with an invalid policy")
+		}
+		if _, err := lazy.Verify(context.Background(), token); err == nil {
+			t.Error("Verify() error = nil with an invalid policy")
+		}
+
+		t.Setenv(JWKSEnv, "not json")
+		if _, err := NewLazy().Verifier(); err == nil {
+			t.Errorf("Verifier() error = nil with an invalid %s", JWKSEnv)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package ghaauth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithShadowPolicy evaluates every verified token against a candidate
+// policy alongside the active one, to trial a tighter policy in production
+// before enforcing it. The shadow decision never affects the outcome;
+// tokens it would decide differently are logged at info level to the
+// logger set with WithLogger.
+func WithShadowPolicy(policy *Policy) Option {
+	return func(v *Verifier) {
+		v.shadowPolicy = policy
+	}
+}
+
+// evaluateShadow evaluates the shadow policy, if any, at now and logs the tokens
+// for which it diverges from the active decision
+func (v *Verifier) evaluateShadow(ctx context.Context, claims *GitHubActionsClaims, now time.Time, active *EvaluationResult) {
+	if v.shadowCompiled == nil {
+		return
+	}
+
+	shadow := v.shadowCompiled.EvaluateAt(claims, now)
+	if shadow.Allowed == active.Allowed && shadow.MatchedRule == active.MatchedRule {
+		return
+	}
+
+	v.logger.InfoContext(ctx, "shadow policy decision differs",
+		slog.Group("active",
+			slog.Bool("allowed", active.Allowed),
+			slog.String("rule", active.MatchedRule),
+			slog.String("policy_version", active.PolicyVersion),
+		),
+		slog.Group("shadow",
+			slog.Bool("allowed", shadow.Allowed),
+			slog.String("rule", shadow.MatchedRule),
+			slog.String("reason", shadow.Reason),
+			slog.String("policy_version", shadow.PolicyVersion),
+		),
+		claimsAttr(claims),
+	)
+}
@@ -0,0 +1,98 @@
+package ghaauth
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestWithShadowPolicy(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	active := &Policy{
+		Rules:       []Rule{{Name: "allow-myorg", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}},
+		DefaultDeny: true,
+	}
+
+	tests := []struct {
+		name     string
+		shadow   *Policy
+		wantLogs []string
+	}{
+		{
+			name: "same decision",
+			shadow: &Policy{
+				Rules:       []Rule{{Name: "allow-myorg", Conditions: Conditions{Repository: []string{"myorg/*"}}, Effect: EffectAllow}},
+				DefaultDeny: true,
+			},
+		},
+		{
+			name: "stricter shadow policy",
+			shadow: &Policy{
+				Rules:       []Rule{{Name: "allow-main", Conditions: Conditions{Ref: []string{"refs/heads/release"}}, Effect: EffectAllow}},
+				DefaultDeny: true,
+			},
+			wantLogs: []string{
+				`msg="shadow policy decision differs"`,
+				"active.allowed=true active.rule=allow-myorg",
+				"shadow.allowed=false",
+				"claims.repository=myorg/myrepo",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			verifier, err := New(
+				WithPolicy(active),
+				WithShadowPolicy(tt.shadow),
+				WithJWKSURL(server.URL()+"/.well-known/jwks"),
+				WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			result, err := verifier.Verify(context.Background(), token)
+			if err != nil {
+				t.Fatalf("Verify() error = %v, the shadow policy must not affect the outcome", err)
+			}
+			if result.PolicyResult.MatchedRule != "allow-myorg" {
+				t.Errorf("MatchedRule = %q, want allow-myorg", result.PolicyResult.MatchedRule)
+			}
+
+			logs := buf.String()
+			if len(tt.wantLogs) == 0 && strings.Contains(logs, "shadow policy") {
+				t.Errorf("logs = %q, want no shadow divergence", logs)
+			}
+			for _, want := range tt.wantLogs {
+				if !strings.Contains(logs, want) {
+					t.Errorf("logs do not contain %q:\n%s", want, logs)
+				}
+			}
+		})
+	}
+}
+
+func TestWithShadowPolicy_Invalid(t *testing.T) {
+	_, err := New(WithShadowPolicy(&Policy{}))
+	if err == nil {
+		t.Fatal("New() error = nil, want invalid shadow policy error")
+	}
+}
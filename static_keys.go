@@ -0,0 +1,57 @@
+package ghaauth
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// WithStaticKeys sets the signing keys of the default issuer by key ID, so
+// tokens can be verified without any network call. Unknown key IDs are
+// rejected unless WithStaticKeyFallback is also given.
+func WithStaticKeys(keys map[string]*rsa.PublicKey) Option {
+	return func(v *Verifier) {
+		if v.staticKeys == nil {
+			v.staticKeys = make(map[string]*rsa.PublicKey, len(keys))
+		}
+		for kid, key := range keys {
+			v.staticKeys[kid] = key
+		}
+	}
+}
+
+// WithJWKSJSON is like WithStaticKeys but takes a JWKS document, e.g. a
+// copy of GitHub's JWKS shipped with the deployment
+func WithJWKSJSON(data []byte) Option {
+	return func(v *Verifier) {
+		keys, err := ParseJWKS(data)
+		if err != nil {
+			v.optionErrs = append(v.optionErrs, err)
+			return
+		}
+		WithStaticKeys(keys)(v)
+	}
+}
+
+// WithStaticKeyFallback fetches the JWKS from the network when a token's key
+// ID is not among the static keys
+func WithStaticKeyFallback() Option {
+	return func(v *Verifier) {
+		v.staticKeyFallback = true
+	}
+}
+
+// ParseJWKS decodes a JWKS document into RSA public keys by key ID
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var jwks JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := keysFromJWKS(jwks)
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable RSA keys")
+	}
+	return keys, nil
+}
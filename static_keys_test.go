@@ -0,0 +1,216 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestWithStaticKeys(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	tokenString, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	jwksJSON, err := json.Marshal(&KeySet{Keys: map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()}})
+	if err != nil {
+		t.Fatalf("failed to encode JWKS: %v", err)
+	}
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		wantErr      error
+		wantRequests int32
+	}{
+		{
+			name:         "static keys verify without network",
+			opts:         []Option{WithStaticKeys(map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()})},
+			wantRequests: 0,
+		},
+		{
+			name:         "JWKS JSON verifies without network",
+			opts:         []Option{WithJWKSJSON(jwksJSON)},
+			wantRequests: 0,
+		},
+		{
+			name:         "unknown key ID is rejected without fallback",
+			opts:         []Option{WithStaticKeys(map[string]*rsa.PublicKey{"other-key": gen.PublicKey()})},
+			wantErr:      ErrKeyNotFound,
+			wantRequests: 0,
+		},
+		{
+			name: "unknown key ID is fetched with fallback",
+			opts: []Option{
+				WithStaticKeys(map[string]*rsa.PublicKey{"other-key": gen.PublicKey()}),
+				WithStaticKeyFallback(),
+			},
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &countingTransport{}
+			opts := append([]Option{
+				WithJWKSURL(server.URL() + "/.well-known/jwks"),
+				WithHTTPClient(&http.Client{Transport: transport}),
+			}, tt.opts...)
+
+			verifier, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = verifier.Verify(ctx, tokenString)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+
+			if got := transport.requests.Load(); got != tt.wantRequests {
+				t.Errorf("JWKS requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestStaticKeys_Configuration(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	t.Run("invalid JWKS JSON", func(t *testing.T) {
+		if _, err := New(WithJWKSJSON([]byte(`{"keys": [`))); err == nil {
+			t.Error("New() error = nil, want error")
+		}
+	})
+
+	t.Run("static keys with explicit issuers", func(t *testing.T) {
+		_, err := New(
+			WithIssuer(Issuer{URL: DefaultIssuer}),
+			WithStaticKeys(map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()}),
+		)
+		if err == nil {
+			t.Error("New() error = nil, want error")
+		}
+	})
+
+	t.Run("issuer static keys", func(t *testing.T) {
+		verifier, err := New(WithIssuer(Issuer{
+			URL:        DefaultIssuer,
+			JWKSURL:    "http://127.0.0.1:0/unreachable",
+			StaticKeys: map[string]*rsa.PublicKey{gen.KeyID(): gen.PublicKey()},
+		}))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		tokenString, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+
+		if _, err := verifier.Verify(context.Background(), tokenString); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+	})
+}
+
+func TestParseJWKS(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	n := base64.RawURLEncoding.EncodeToString(gen.PublicKey().N.Bytes())
+
+	tests := []struct {
+		name     string
+		data     string
+		wantKeys int
+		wantErr  bool
+	}{
+		{
+			name:     "RSA key",
+			data:     `{"keys": [{"kid": "k1", "kty": "RSA", "n": "` + n + `", "e": "AQAB"}]}`,
+			wantKeys: 1,
+		},
+		{
+			name:    "short modulus",
+			data:    `{"keys": [{"kid": "k1", "kty": "RSA", "n": "sXch", "e": "AQAB"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no RSA keys",
+			data:    `{"keys": [{"kid": "k1", "kty": "EC"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed JSON",
+			data:    `{"keys"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseJWKS([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ParseJWKS() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseJWKS() error = %v", err)
+			}
+			if len(keys) != tt.wantKeys {
+				t.Errorf("len(keys) = %d, want %d", len(keys), tt.wantKeys)
+			}
+		})
+	}
+}
+
+func FuzzParseJWKS(f *testing.F) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		f.Fatalf("failed to create token generator: %v", err)
+	}
+	n := base64.RawURLEncoding.EncodeToString(gen.PublicKey().N.Bytes())
+	f.Add([]byte(`{"keys": [{"kid": "k1", "kty": "RSA", "n": "` + n + `", "e": "AQAB"}]}`))
+	f.Add([]byte(`{"keys": [{"kid": "k1", "kty": "EC"}]}`))
+	f.Add([]byte(`{"keys": [{"kty": "RSA", "n": null, "e": 65537}]}`))
+	f.Add([]byte(`{"keys"`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		keys, err := ParseJWKS(data)
+		if err != nil {
+			return
+		}
+		for kid, key := range keys {
+			if key == nil || key.N.BitLen() < minRSAKeyBits {
+				t.Errorf("key %q is not a usable RSA key", kid)
+			}
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package ghaauth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Subject is the structured form of the sub claim GitHub issues by default
+type Subject struct {
+	// Repository is the full repository name (e.g., "myorg/myrepo")
+	Repository string
+
+	// RefType is "branch" or "tag" for ref subjects, empty otherwise
+	RefType string
+
+	// Ref is the full git reference for ref subjects (e.g., "refs/heads/main")
+	Ref string
+
+	// Environment is the deployment environment for environment subjects
+	Environment string
+
+	// PullRequest is set for pull request subjects
+	PullRequest bool
+}
+
+// ParseSubject parses a sub claim in one of GitHub's default formats:
+//
+//	repo:ORG/REPO:ref:refs/heads/BRANCH
+//	repo:ORG/REPO:ref:refs/tags/TAG
+//	repo:ORG/REPO:environment:NAME
+//	repo:ORG/REPO:pull_request
+//
+// Customized subject templates are not supported.
+func ParseSubject(sub string) (*Subject, error) {
+	rest, ok := strings.CutPrefix(sub, "repo:")
+	if !ok {
+		return nil, fmt.Errorf("invalid subject %q: must start with repo:", sub)
+	}
+
+	repo, tail, ok := strings.Cut(rest, ":")
+	if !ok || repo == "" || strings.Count(repo, "/") != 1 {
+		return nil, fmt.Errorf("invalid subject %q: missing repository", sub)
+	}
+
+	s := &Subject{Repository: repo}
+	kind, value, _ := strings.Cut(tail, ":")
+	switch kind {
+	case "ref":
+		switch {
+		case strings.HasPrefix(value, "refs/heads/"):
+			s.RefType = "branch"
+		case strings.HasPrefix(value, "refs/tags/"):
+			s.RefType = "tag"
+		default:
+			return nil, fmt.Errorf("invalid subject %q: unsupported ref %q", sub, value)
+		}
+		s.Ref = value
+	case "environment":
+		if value == "" {
+			return nil, fmt.Errorf("invalid subject %q: missing environment", sub)
+		}
+		s.Environment = value
+	case "pull_request":
+		if value != "" {
+			return nil, fmt.Errorf("invalid subject %q: unexpected value after pull_request", sub)
+		}
+		s.PullRequest = true
+	default:
+		return nil, fmt.Errorf("invalid subject %q: unsupported context %q", sub, kind)
+	}
+
+	return s, nil
+}
+
+// String formats the subject as a sub claim; ParseSubject(s.String())
+// returns an equal Subject
+func (s *Subject) String() string {
+	prefix := "repo:" + s.Repository + ":"
+	switch {
+	case s.Environment != "":
+		return prefix + "environment:" + s.Environment
+	case s.PullRequest:
+		return prefix + "pull_request"
+	default:
+		return prefix + "ref:" + s.Ref
+	}
+}
@@ -0,0 +1,66 @@
+package ghaauth
+
+import (
+	"testing"
+)
+
+func TestParseSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		sub     string
+		want    Subject
+		wantErr bool
+	}{
+		{
+			name: "branch",
+			sub:  "repo:myorg/myrepo:ref:refs/heads/main",
+			want: Subject{Repository: "myorg/myrepo", RefType: "branch", Ref: "refs/heads/main"},
+		},
+		{
+			name: "nested branch",
+			sub:  "repo:myorg/myrepo:ref:refs/heads/release/1.x",
+			want: Subject{Repository: "myorg/myrepo", RefType: "branch", Ref: "refs/heads/release/1.x"},
+		},
+		{
+			name: "tag",
+			sub:  "repo:myorg/myrepo:ref:refs/tags/v1.2.0",
+			want: Subject{Repository: "myorg/myrepo", RefType: "tag", Ref: "refs/tags/v1.2.0"},
+		},
+		{
+			name: "environment",
+			sub:  "repo:myorg/myrepo:environment:production",
+			want: Subject{Repository: "myorg/myrepo", Environment: "production"},
+		},
+		{
+			name: "pull request",
+			sub:  "repo:myorg/myrepo:pull_request",
+			want: Subject{Repository: "myorg/myrepo", PullRequest: true},
+		},
+		{name: "missing prefix", sub: "myorg/myrepo:ref:refs/heads/main", wantErr: true},
+		{name: "missing repository", sub: "repo::ref:refs/heads/main", wantErr: true},
+		{name: "repository without owner", sub: "repo:myrepo:pull_request", wantErr: true},
+		{name: "pull request ref", sub: "repo:myorg/myrepo:ref:refs/pull/1/merge", wantErr: true},
+		{name: "empty environment", sub: "repo:myorg/myrepo:environment:", wantErr: true},
+		{name: "custom template", sub: "repo:myorg/myrepo:job_workflow_ref:myorg/w/.github/workflows/d.yml@refs/heads/main", wantErr: true},
+		{name: "pull request with value", sub: "repo:myorg/myrepo:pull_request:1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSubject(tt.sub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSubject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if *got != tt.want {
+				t.Errorf("ParseSubject() = %+v, want %+v", *got, tt.want)
+			}
+			if s := got.String(); s != tt.sub {
+				t.Errorf("String() = %q, want %q", s, tt.sub)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestThumbprint(t *testing.T) {
+	// Example key from RFC 7638 section 3.1
+	jwk := JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+
+	key, err := jwkToPublicKey(jwk)
+	if err != nil {
+		t.Fatalf("jwkToPublicKey() error = %v", err)
+	}
+
+	want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+	if got := Thumbprint(key); got != want {
+		t.Errorf("Thumbprint() = %q, want %q", got, want)
+	}
+}
+
+func TestWithKeyThumbprints(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	other, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	tokenString, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		thumbprints []string
+		wantErr     error
+	}{
+		{
+			name:        "pinned key verifies",
+			thumbprints: []string{Thumbprint(other.PublicKey()), Thumbprint(gen.PublicKey())},
+		},
+		{
+			name:        "unpinned key is rejected",
+			thumbprints: []string{Thumbprint(other.PublicKey())},
+			wantErr:     ErrUntrustedKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := New(
+				WithJWKSURL(server.URL()+"/.well-known/jwks"),
+				WithKeyThumbprints(tt.thumbprints...),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			// Verify twice to cover both the fetch and the cache path
+			for i := 0; i < 2; i++ {
+				_, err = verifier.Verify(context.Background(), tokenString)
+				if tt.wantErr == nil && err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+
+	t.Run("combined with WithIssuer", func(t *testing.T) {
+		_, err := New(
+			WithIssuer(Issuer{URL: DefaultIssuer}),
+			WithKeyThumbprints(Thumbprint(gen.PublicKey())),
+		)
+		if err == nil {
+			t.Error("New() error = nil, want error")
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package ghaauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenInfo describes a verified token, so that downstream systems can run
+// additional checks without parsing it again
+type TokenInfo struct {
+	// Raw is the compact serialized token
+	Raw string
+
+	// KeyID is the kid header, identifying the signing key
+	KeyID string
+
+	// Algorithm is the alg header (e.g., "RS256")
+	Algorithm string
+
+	// Payload is the decoded JSON payload as signed by the issuer
+	Payload []byte
+
+	// ExpiresAt is the exp claim
+	ExpiresAt time.Time
+}
+
+// Hash returns the SHA-256 of the raw token, e.g. to bind the token into
+// an artifact signature
+func (t TokenInfo) Hash() [sha256.Size]byte {
+	return sha256.Sum256([]byte(t.Raw))
+}
+
+// newTokenInfo describes a token verified by jwt
+func newTokenInfo(token *jwt.Token, claims *GitHubActionsClaims) TokenInfo {
+	info := TokenInfo{Raw: token.Raw}
+	info.KeyID, _ = token.Header["kid"].(string)
+	info.Algorithm, _ = token.Header["alg"].(string)
+
+	// The token was parsed successfully, so the payload segment decodes
+	if parts := strings.Split(token.Raw, "."); len(parts) == 3 {
+		info.Payload, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	}
+
+	if claims.ExpiresAt != nil {
+		info.ExpiresAt = claims.ExpiresAt.Time
+	}
+
+	return info
+}
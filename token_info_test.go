@@ -0,0 +1,62 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestVerificationResult_Token(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(WithJWKSURL(server.URL() + "/.well-known/jwks"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	claims := testutil.DefaultClaims()
+	tokenString, err := gen.GenerateToken(claims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	result, err := verifier.Verify(context.Background(), tokenString)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	info := result.Token
+	if info.Raw != tokenString {
+		t.Errorf("Raw = %q, want the token", info.Raw)
+	}
+	if info.KeyID != gen.KeyID() {
+		t.Errorf("KeyID = %q, want %q", info.KeyID, gen.KeyID())
+	}
+	if info.Algorithm != "RS256" {
+		t.Errorf("Algorithm = %q, want RS256", info.Algorithm)
+	}
+	if !info.ExpiresAt.Equal(claims.ExpiresAt.Truncate(time.Second)) {
+		t.Errorf("ExpiresAt = %v, want %v", info.ExpiresAt, claims.ExpiresAt)
+	}
+	if info.Hash() != sha256.Sum256([]byte(tokenString)) {
+		t.Error("Hash() is not the SHA-256 of the token")
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(info.Payload, &payload); err != nil {
+		t.Fatalf("Payload is not JSON: %v", err)
+	}
+	if payload["repository"] != claims.Repository {
+		t.Errorf("Payload repository = %v, want %q", payload["repository"], claims.Repository)
+	}
+}
@@ -0,0 +1,173 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// maxTokenReviewSize limits the size of TokenReview request bodies
+const maxTokenReviewSize = 64 << 10
+
+// TokenReviewAPIVersion is the API version of the TokenReview objects
+// exchanged with the Kubernetes API server
+const TokenReviewAPIVersion = "authentication.k8s.io/v1"
+
+// TokenReview is the Kubernetes TokenReview object, as sent and received
+// by an authentication webhook. Only the fields used by webhooks are
+// declared, so that no Kubernetes modules are needed.
+type TokenReview struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Spec       TokenReviewSpec   `json:"spec"`
+	Status     TokenReviewStatus `json:"status"`
+}
+
+// TokenReviewSpec is the token to authenticate
+type TokenReviewSpec struct {
+	Token string `json:"token"`
+
+	// Audiences the API server accepts; empty means the webhook's own
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+// TokenReviewStatus is the result of a token review
+type TokenReviewStatus struct {
+	Authenticated bool            `json:"authenticated"`
+	User          TokenReviewUser `json:"user,omitzero"`
+	Audiences     []string        `json:"audiences,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// TokenReviewUser is the Kubernetes user a token authenticates as
+type TokenReviewUser struct {
+	Username string              `json:"username,omitempty"`
+	UID      string              `json:"uid,omitempty"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+// TokenReviewOption configures TokenReviewHandler
+type TokenReviewOption func(*tokenReviewConfig)
+
+// tokenReviewConfig holds the TokenReviewHandler settings
+type tokenReviewConfig struct {
+	user func(*VerificationResult) TokenReviewUser
+}
+
+// WithTokenReviewUser sets how verified tokens are mapped to Kubernetes
+// users. The default is DefaultTokenReviewUser.
+func WithTokenReviewUser(user func(*VerificationResult) TokenReviewUser) TokenReviewOption {
+	return func(c *tokenReviewConfig) {
+		c.user = user
+	}
+}
+
+// DefaultTokenReviewUser maps a token to the user "github:" + sub, e.g.
+// "github:repo:myorg/myrepo:ref:refs/heads/main", in the groups
+// "github:org:<owner>", "github:repo:<owner>/<repo>" and, for jobs with an
+// environment, "github:environment:<owner>/<repo>:<environment>". The ref,
+// workflow and run are passed as extra attributes. Tokens of other CI
+// providers, mapped by a ClaimMapper, use "<issuer>#" instead of "github:",
+// e.g. "https://gitlab.com#org:mygroup", so that they cannot be bound to
+// the roles of GitHub repositories with the same names.
+func DefaultTokenReviewUser(result *VerificationResult) TokenReviewUser {
+	claims := result.Claims
+	prefix := "github:"
+	if claims.Mapped() {
+		prefix = claims.Issuer + "#"
+	}
+	user := TokenReviewUser{
+		Username: prefix + claims.Subject,
+		Groups: []string{
+			prefix + "org:" + result.Identity.Org,
+			prefix + "repo:" + claims.Repository,
+		},
+		Extra: map[string][]string{
+			"gha-auth.github.com/ref":      {claims.Ref},
+			"gha-auth.github.com/workflow": {claims.Workflow},
+			"gha-auth.github.com/run-id":   {claims.RunID},
+		},
+	}
+	if claims.Environment != "" {
+		user.Groups = append(user.Groups, prefix+"environment:"+claims.Repository+":"+claims.Environment)
+	}
+	return user
+}
+
+// TokenReviewHandler returns an http.Handler implementing the Kubernetes
+// webhook token authentication contract, so that clusters can authenticate
+// GitHub Actions workflows, e.g. with --authentication-token-webhook-config-file.
+// Tokens are verified and their policy evaluated like in Verify; tokens
+// that fail are reported as unauthenticated. When the API server names
+// audiences, the token must be for one of them, and it is verified with
+// that audience instead of the verifier's. Failures to reach the JWKS
+// endpoint or the GitHub API are answered with 503 Service Unavailable.
+func TokenReviewHandler(verifier TokenVerifier, opts ...TokenReviewOption) http.Handler {
+	cfg := &tokenReviewConfig{user: DefaultTokenReviewUser}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var review TokenReview
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxTokenReviewSize)).Decode(&review); err != nil ||
+			review.Kind != "TokenReview" || review.Spec.Token == "" {
+			http.Error(w, "invalid TokenReview", http.StatusBadRequest)
+			return
+		}
+
+		result, audience, err := reviewToken(r, verifier, review.Spec)
+		if err != nil && introspectionUnavailable(err) {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		response := TokenReview{APIVersion: review.APIVersion, Kind: "TokenReview"}
+		if response.APIVersion == "" {
+			response.APIVersion = TokenReviewAPIVersion
+		}
+		if err != nil {
+			response.Status.Error = err.Error()
+		} else {
+			response.Status.Authenticated = true
+			response.Status.User = cfg.user(result)
+			if audience != "" {
+				response.Status.Audiences = []string{audience}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	})
+}
+
+// reviewToken verifies the token of a review, with the first of the
+// requested audiences that the token was issued for
+func reviewToken(r *http.Request, verifier TokenVerifier, spec TokenReviewSpec) (*VerificationResult, string, error) {
+	if len(spec.Audiences) == 0 {
+		result, err := verifier.Verify(r.Context(), spec.Token)
+		return result, "", err
+	}
+
+	// The audience is only used to pick the one to verify against; the
+	// verifier checks it again on the verified claims
+	claims, err := ParseUnverified(spec.Token)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, audience := range spec.Audiences {
+		if slices.Contains(claims.Audience, audience) {
+			result, err := verifier.VerifyWith(r.Context(), spec.Token, WithExpectedAudience(audience))
+			return result, audience, err
+		}
+	}
+	return nil, "", NewValidationError(ErrInvalidAudience, "token is not issued for any of the requested audiences")
+}
@@ -0,0 +1,138 @@
+package ghaauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestTokenReviewHandler(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithPolicy(&Policy{
+			Rules:       []Rule{{Name: "allow-myorg", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}},
+			DefaultDeny: true,
+		}),
+		WithAudience("https://kubernetes.example.com"),
+		WithJWKSURL(server.JWKSURL()),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	newToken := func(owner string, audiences ...string) string {
+		t.Helper()
+		claims := testutil.DefaultClaims()
+		claims.RepositoryOwner = owner
+		claims.Repository = owner + "/myrepo"
+		claims.Environment = "production"
+		claims.Audience = audiences
+		token, err := gen.GenerateToken(claims.ToJWT())
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+		return token
+	}
+
+	handler := TokenReviewHandler(verifier)
+	review := func(t *testing.T, spec TokenReviewSpec) TokenReviewStatus {
+		t.Helper()
+		body, _ := json.Marshal(TokenReview{APIVersion: TokenReviewAPIVersion, Kind: "TokenReview", Spec: spec})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tokenreview", strings.NewReader(string(body))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body)
+		}
+		var resp TokenReview
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.APIVersion != TokenReviewAPIVersion || resp.Kind != "TokenReview" {
+			t.Errorf("response type = %s %s", resp.APIVersion, resp.Kind)
+		}
+		return resp.Status
+	}
+
+	t.Run("authenticated", func(t *testing.T) {
+		status := review(t, TokenReviewSpec{Token: newToken("myorg", "https://kubernetes.example.com")})
+		if !status.Authenticated || status.Error != "" {
+			t.Fatalf("status = %+v, want authenticated", status)
+		}
+		if !strings.HasPrefix(status.User.Username, "github:repo:myorg/myrepo") {
+			t.Errorf("Username = %q", status.User.Username)
+		}
+		for _, group := range []string{"github:org:myorg", "github:repo:myorg/myrepo", "github:environment:myorg/myrepo:production"} {
+			if !slices.Contains(status.User.Groups, group) {
+				t.Errorf("Groups = %q, want %q", status.User.Groups, group)
+			}
+		}
+		if got := status.User.Extra["gha-auth.github.com/ref"]; len(got) != 1 || got[0] != "refs/heads/main" {
+			t.Errorf("Extra = %v", status.User.Extra)
+		}
+	})
+
+	t.Run("requested audiences", func(t *testing.T) {
+		status := review(t, TokenReviewSpec{
+			Token:     newToken("myorg", "https://cluster-b.example.com"),
+			Audiences: []string{"https://cluster-a.example.com", "https://cluster-b.example.com"},
+		})
+		if !status.Authenticated || !slices.Equal(status.Audiences, []string{"https://cluster-b.example.com"}) {
+			t.Errorf("status = %+v, want authenticated for cluster-b", status)
+		}
+
+		status = review(t, TokenReviewSpec{Token: newToken("myorg", "https://other.example.com"), Audiences: []string{"https://cluster-a.example.com"}})
+		if status.Authenticated {
+			t.Error("token for another audience authenticated")
+		}
+	})
+
+	t.Run("denied by policy", func(t *testing.T) {
+		status := review(t, TokenReviewSpec{Token: newToken("otherorg", "https://kubernetes.example.com")})
+		if status.Authenticated || status.Error == "" || status.User.Username != "" {
+			t.Errorf("status = %+v, want unauthenticated with an error", status)
+		}
+	})
+
+	t.Run("custom user", func(t *testing.T) {
+		custom := TokenReviewHandler(verifier, WithTokenReviewUser(func(result *VerificationResult) TokenReviewUser {
+			return TokenReviewUser{Username: "ci:" + result.Claims.Repository}
+		}))
+		body, _ := json.Marshal(TokenReview{Kind: "TokenReview", Spec: TokenReviewSpec{Token: newToken("myorg", "https://kubernetes.example.com")}})
+		rec := httptest.NewRecorder()
+		custom.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tokenreview", strings.NewReader(string(body))))
+		var resp TokenReview
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Status.User.Username != "ci:myorg/myrepo" {
+			t.Errorf("response = %s, want user ci:myorg/myrepo", rec.Body)
+		}
+		if resp.APIVersion != TokenReviewAPIVersion {
+			t.Errorf("APIVersion = %q, want %q", resp.APIVersion, TokenReviewAPIVersion)
+		}
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		for _, body := range []string{`not json`, `{"kind": "TokenReview", "spec": {}}`, `{"kind": "SubjectAccessReview", "spec": {"token": "x"}}`} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tokenreview", strings.NewReader(body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d for %s, want 400", rec.Code, body)
+			}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tokenreview", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET status = %d, want 405", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package ghaauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestWithTransport(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	var requests atomic.Int32
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	verifier, err := New(WithJWKSURL(server.JWKSURL()), WithTransport(transport))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if verifier.httpClient.Timeout != DefaultHTTPTimeout {
+		t.Errorf("HTTP timeout = %v, want %v", verifier.httpClient.Timeout, DefaultHTTPTimeout)
+	}
+
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("transport requests = %d, want 1", requests.Load())
+	}
+
+	t.Run("fetcher", func(t *testing.T) {
+		requests.Store(0)
+		fetcher := NewJWKSFetcher(server.JWKSURL(), time.Hour, WithFetcherTransport(transport))
+		if _, err := fetcher.GetKey(context.Background(), gen.KeyID()); err != nil {
+			t.Fatalf("GetKey() error = %v", err)
+		}
+		if requests.Load() != 1 {
+			t.Errorf("transport requests = %d, want 1", requests.Load())
+		}
+	})
+
+	t.Run("client certificate needs an http.Transport", func(t *testing.T) {
+		_, err := New(WithTransport(transport), WithClientCertificate(tls.Certificate{}))
+		if err == nil {
+			t.Error("New() error = nil, want error")
+		}
+	})
+}
+
+func TestWithProxy(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	// A forward proxy requiring basic authentication
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:secret")) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxied.Add(1)
+
+		resp, err := http.Get(r.URL.String())
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		name    string
+		proxy   string
+		wantErr bool
+	}{
+		{name: "authenticated", proxy: "http://user:secret@" + proxy.Listener.Addr().String()},
+		{name: "wrong credentials", proxy: "http://user:guess@" + proxy.Listener.Addr().String(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxied.Store(0)
+			verifier, err := New(
+				WithJWKSURL(server.JWKSURL()),
+				WithProxy(tt.proxy),
+				WithJWKSRetry(RetryPolicy{MaxAttempts: 1}),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && proxied.Load() != 1 {
+				t.Errorf("proxied requests = %d, want 1", proxied.Load())
+			}
+		})
+	}
+
+	t.Run("invalid URL", func(t *testing.T) {
+		if _, err := New(WithProxy("proxy.internal:3128")); err == nil {
+			t.Error("New() error = nil, want error")
+		}
+	})
+}
+
+func TestWithClientCertificate(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	jwks := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer jwks.Close()
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	// A TLS endpoint requiring a client certificate, relaying the JWKS
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := http.Get(jwks.JWKSURL())
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	cert := selfSignedCertificate(t)
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "with certificate", opts: []Option{WithClientCertificate(cert)}},
+		{name: "without certificate", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{
+				WithJWKSURL(server.URL + "/.well-known/jwks"),
+				// Trusts the test server's certificate
+				WithTransport(server.Client().Transport),
+				WithJWKSRetry(RetryPolicy{MaxAttempts: 1}),
+			}, tt.opts...)
+			verifier, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// selfSignedCertificate creates a TLS client certificate
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gha-auth test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -2,8 +2,13 @@ package ghaauth
 
 import (
 	"context"
+	"crypto/rsa"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,17 +21,83 @@ type VerificationResult struct {
 
 	// PolicyResult from policy evaluation
 	PolicyResult *EvaluationResult
+
+	// Identity is the caller distilled from the claims
+	Identity Identity
+
+	// Token describes the verified token itself
+	Token TokenInfo
+
+	// DPoPThumbprint is the RFC 7638 thumbprint of the key a DPoP proof
+	// was signed with, if one was verified (see WithDPoP)
+	DPoPThumbprint string
+}
+
+// TokenVerifier verifies tokens. *Verifier implements it; Middleware, the
+// HTTP handlers and the framework adapters accept any implementation, e.g.
+// ghaauthtest.StaticVerifier in handler tests.
+type TokenVerifier interface {
+	Verify(ctx context.Context, tokenString string) (*VerificationResult, error)
+	VerifyWith(ctx context.Context, tokenString string, opts ...VerifyOption) (*VerificationResult, error)
 }
 
+var _ TokenVerifier = (*Verifier)(nil)
+
 // Verifier verifies GitHub Actions OIDC tokens
 type Verifier struct {
-	policy             *Policy
-	audience           string
-	jwksURL            string
-	jwksCacheDuration  time.Duration
-	httpClient         *http.Client
-	clock              Clock
-	jwksFetcher        *JWKSFetcher
+	policy            atomic.Pointer[Policy]
+	policyProvider    PolicyProvider
+	compiled          atomic.Pointer[CompiledPolicy]
+	shadowPolicy      *Policy
+	shadowCompiled    *CompiledPolicy
+	compileOpts       []CompileOption
+	strictPolicies    bool
+	requirePolicy     bool
+	audience          string
+	audienceTemplate  *audienceTemplate
+	jwksURL           string
+	jwksCacheDuration time.Duration
+	httpClient        *http.Client
+	transportCfg      transportConfig
+	clock             Clock
+	maxTokenAge       time.Duration
+	maxTokenLifetime  time.Duration
+	verifyTimeout     time.Duration
+	requiredClaims    []string
+	claimRequirements []string
+	claimConsistency  bool
+	claimValidators   []ClaimValidator
+	denylist          *Denylist
+	decisionHooks     []decisionHook
+	hookSlots         chan struct{} // bounds running hook notifications
+	decisionLog       *decisionLog
+	seenIdentities    *identitySet
+	trustedWorkflows  []string
+	runnerEnvs        []string
+	keyCache          KeyCache
+	staticKeys        map[string]*rsa.PublicKey
+	staticKeyFallback bool
+	keyThumbprints    []string
+	denialDetail      DenialDetailLevel
+	jwksRetry         RetryPolicy
+	jwksMinRefresh    time.Duration
+	breakerThreshold  int
+	breakerCooldown   time.Duration
+	issuerConfigs     []Issuer
+	issuers           map[string]*trustedIssuer
+	batchConcurrency  int
+	logger            *slog.Logger
+	rateLimiter       RateLimiter
+	keySet            OIDCKeySet
+	parserOptions     []jwt.ParserOption
+	parser            *jwt.Parser // reused across tokens, built by New
+	allowedAlgs       []string
+	dpopRequired      bool
+	dpopReplay        replayCache
+	fetchers          *fetcherPool // shared with other verifiers of a Registry
+
+	// optionErrs collects errors from options that can fail
+	optionErrs []error
 }
 
 // New creates a new Verifier with the given options
@@ -34,8 +105,17 @@ func New(opts ...Option) (*Verifier, error) {
 	v := &Verifier{
 		jwksURL:           DefaultJWKSURL,
 		jwksCacheDuration: DefaultCacheDuration,
-		httpClient:        &http.Client{Timeout: 10 * time.Second},
+		httpClient:        newHTTPClient(),
 		clock:             DefaultClock{},
+		keyCache:          NewMemoryKeyCache(),
+		jwksRetry:         DefaultRetryPolicy,
+		jwksMinRefresh:    DefaultMinRefreshInterval,
+		denialDetail:      DenialDetailRule,
+		logger:            discardLogger,
+		allowedAlgs:       []string{DefaultAlgorithm},
+		maxTokenLifetime:  DefaultMaxTokenLifetime,
+		verifyTimeout:     DefaultVerifyTimeout,
+		claimRequirements: DefaultRequiredClaims(),
 	}
 
 	// Apply options
@@ -43,17 +123,52 @@ func New(opts ...Option) (*Verifier, error) {
 		opt(v)
 	}
 
+	if err := errors.Join(v.optionErrs...); err != nil {
+		return nil, err
+	}
+	if v.audience != "" && v.audienceTemplate != nil {
+		return nil, fmt.Errorf("WithAudience and WithAudienceTemplate are mutually exclusive")
+	}
+	client, err := v.transportCfg.apply(v.httpClient)
+	if err != nil {
+		return nil, err
+	}
+	v.httpClient = client
+	v.parser = jwt.NewParser(v.jwtParserOptions()...)
+
+	policy := v.policy.Load()
+	if policy != nil && v.policyProvider != nil {
+		return nil, NewPolicyError("", "WithPolicy and WithPolicyProvider are mutually exclusive")
+	}
+
 	// Validate policy if provided
-	if v.policy != nil {
-		if err := v.policy.Validate(); err != nil {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return nil, err
+		}
+		if err := v.checkStrict(policy); err != nil {
 			return nil, err
 		}
 	}
 
-	// Create JWKS fetcher
-	v.jwksFetcher = NewJWKSFetcher(v.jwksURL, v.jwksCacheDuration)
-	if v.httpClient != nil {
-		v.jwksFetcher.httpClient = v.httpClient
+	if v.shadowPolicy != nil {
+		if err := v.shadowPolicy.Validate(); err != nil {
+			return nil, err
+		}
+		v.shadowCompiled = v.shadowPolicy.Compile(v.compileOpts...)
+	}
+
+	// Create a JWKS fetcher per trusted issuer
+	if err := v.buildIssuers(); err != nil {
+		return nil, err
+	}
+
+	if v.requirePolicy && policy == nil && v.policyProvider == nil {
+		for url, issuer := range v.issuers {
+			if issuer.compiled == nil {
+				return nil, NewPolicyError("", fmt.Sprintf("no policy configured for issuer %q", url))
+			}
+		}
 	}
 
 	return v, nil
@@ -61,66 +176,351 @@ func New(opts ...Option) (*Verifier, error) {
 
 // Verify verifies a GitHub Actions OIDC token and evaluates it against the policy
 func (v *Verifier) Verify(ctx context.Context, tokenString string) (*VerificationResult, error) {
-	// Parse and verify the token
-	claims, err := v.parseToken(ctx, tokenString)
+	return v.VerifyWith(ctx, tokenString)
+}
+
+// VerifyWith is Verify with per-call overrides of the verifier's settings,
+// e.g. the expected audience of a multi-host gateway
+func (v *Verifier) VerifyWith(ctx context.Context, tokenString string, opts ...VerifyOption) (*VerificationResult, error) {
+	if v.verifyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.verifyTimeout)
+		defer cancel()
+	}
+
+	cfg := verifyConfig{audience: v.audience, audienceTemplate: v.audienceTemplate}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	claims, token, err := v.parseToken(ctx, tokenString)
 	if err != nil {
+		v.logFailure(ctx, nil, err)
 		return nil, err
 	}
 
-	// Validate claims structure
-	if err := claims.Validate(); err != nil {
+	thumbprint, err := v.checkDPoP(cfg, tokenString)
+	if err != nil {
+		v.logFailure(ctx, claims, err)
+		v.notifyDecision(ctx, claims, nil, err)
 		return nil, err
 	}
 
-	// Verify audience if configured
-	if v.audience != "" {
-		valid := false
-		if aud, err := claims.GetAudience(); err == nil {
-			for _, a := range aud {
-				if a == v.audience {
-					valid = true
-					break
-				}
+	result, err := v.verifyClaims(ctx, claims, cfg)
+	v.notifyDecision(ctx, claims, result, err)
+	if err != nil {
+		v.logFailure(ctx, claims, err)
+		return nil, err
+	}
+
+	result.Token = newTokenInfo(token, claims)
+	result.DPoPThumbprint = thumbprint
+	return result, nil
+}
+
+// verifyClaims checks the claims of a token with a valid signature and
+// evaluates them against the policy
+func (v *Verifier) verifyClaims(ctx context.Context, claims *GitHubActionsClaims, cfg verifyConfig) (*VerificationResult, error) {
+	if err := v.checkTokenAge(claims); err != nil {
+		return nil, err
+	}
+
+	if err := v.checkTokenLifetime(claims); err != nil {
+		return nil, err
+	}
+
+	// Validate claims structure (the issuer was checked when selecting the
+	// key, and claim mappers check the claims they need)
+	if v.issuers[claims.Issuer].ClaimMapper == nil {
+		if err := claims.ValidateRequired(v.claimRequirements...); err != nil {
+			return nil, err
+		}
+		if v.claimConsistency {
+			if err := claims.ValidateConsistency(); err != nil {
+				return nil, err
 			}
 		}
-		if !valid {
-			return nil, NewValidationError(ErrInvalidAudience, "audience mismatch")
+	}
+	for _, name := range v.requiredClaims {
+		if !claims.HasClaim(name) {
+			return nil, NewValidationError(ErrInvalidToken, name+" claim is required")
+		}
+	}
+
+	// Verify audience if configured
+	audience := cfg.audience
+	if cfg.audienceTemplate != nil {
+		rendered, err := cfg.audienceTemplate.render(claims)
+		if err != nil {
+			return nil, err
+		}
+		audience = rendered
+	}
+	if cfg.nonce != "" {
+		if err := checkNonce(claims, audience, cfg.nonce); err != nil {
+			return nil, err
+		}
+	} else if audience != "" {
+		aud, _ := claims.GetAudience()
+		if !slices.Contains(aud, audience) {
+			return nil, newClaimError(ErrInvalidAudience, "audience mismatch", map[string]any{"aud": []string(aud)})
+		}
+	}
+
+	return v.authorize(ctx, claims, cfg)
+}
+
+// authorize applies the denylist, workflow, runner, custom and policy checks
+// and the rate limit to verified claims
+func (v *Verifier) authorize(ctx context.Context, claims *GitHubActionsClaims, cfg verifyConfig) (*VerificationResult, error) {
+	if v.denylist != nil {
+		if err := v.denylist.check(ctx, claims); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := v.checkTrustedWorkflow(claims); err != nil {
+		return nil, err
+	}
+
+	if err := v.checkRunnerEnvironment(claims); err != nil {
+		return nil, err
+	}
+
+	if err := v.runClaimValidators(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	// Evaluate the call's policy, falling back to the issuer's and then the
+	// verifier's policy
+	issuer := v.issuers[claims.Issuer]
+	compiled := cfg.policy
+	if compiled == nil {
+		compiled = issuer.compiled
+	}
+	if compiled == nil {
+		compiled = v.compiledPolicy(v.currentPolicy())
+	}
+
+	if v.strictPolicies && !compiled.Policy().DeniesByDefault() {
+		return nil, NewValidationError(ErrAccessDenied, "default-allow policy refused")
+	}
+
+	now := v.clock.Now()
+
+	// Mapped tokens always pass their issuer's own policy too, so that a
+	// policy written for GitHub repositories does not admit another
+	// provider's projects of the same name
+	if claims.Mapped() && compiled != issuer.compiled {
+		if result := issuer.compiled.EvaluateAt(claims, now); !result.Allowed {
+			return nil, v.denialError(issuer.compiled.Policy(), claims, now, result)
 		}
 	}
 
-	// Evaluate policy
-	policyResult := v.policy.Evaluate(claims)
+	policyResult := compiled.EvaluateAt(claims, now)
+	v.evaluateShadow(ctx, claims, now, policyResult)
 	if !policyResult.Allowed {
-		return nil, NewValidationError(ErrAccessDenied, policyResult.Reason)
+		return nil, v.denialError(compiled.Policy(), claims, now, policyResult)
+	}
+
+	identity := claims.Identity()
+	if v.rateLimiter != nil {
+		if err := v.rateLimiter.Allow(ctx, identity); err != nil {
+			return nil, err
+		}
 	}
 
 	return &VerificationResult{
 		Claims:       claims,
 		PolicyResult: policyResult,
+		Identity:     identity,
 	}, nil
 }
 
+// UpdatePolicy validates the given policy and atomically replaces the
+// current one. Verifications already in progress finish with the policy
+// they started with; the JWKS cache is kept.
+func (v *Verifier) UpdatePolicy(policy *Policy) error {
+	if v.policyProvider != nil {
+		return NewPolicyError("", "policy is managed by a PolicyProvider")
+	}
+
+	if policy == nil {
+		return NewPolicyError("", "policy must not be nil")
+	}
+
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	if err := v.checkStrict(policy); err != nil {
+		return err
+	}
+
+	v.policy.Store(policy)
+	return nil
+}
+
+// Prime fetches the signing keys of every trusted issuer, so that a
+// service can fail fast at startup instead of on the first request. Keys
+// of a WithOIDCKeySet key set are managed by the key set.
+func (v *Verifier) Prime(ctx context.Context) error {
+	if v.keySet != nil {
+		return nil
+	}
+
+	var errs []error
+	for url, issuer := range v.issuers {
+		if err := issuer.fetcher.Prime(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("issuer %q: %w", url, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Healthy reports whether signing keys are available for every trusted
+// issuer; it is suitable for readiness probes after Prime
+func (v *Verifier) Healthy() bool {
+	if v.keySet != nil {
+		return true
+	}
+
+	for _, issuer := range v.issuers {
+		if !issuer.fetcher.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// checkStrict enforces WithStrictPolicies on a configured policy
+func (v *Verifier) checkStrict(policy *Policy) error {
+	if v.strictPolicies && !policy.DeniesByDefault() {
+		return NewPolicyError("", "default-allow policies are refused by WithStrictPolicies")
+	}
+	return nil
+}
+
+// currentPolicy returns the policy to evaluate for this verification
+func (v *Verifier) currentPolicy() *Policy {
+	if v.policyProvider != nil {
+		return v.policyProvider.Policy()
+	}
+	return v.policy.Load()
+}
+
+// compiledPolicy returns the compiled form of policy, compiling it only
+// when the policy has changed since the last call
+func (v *Verifier) compiledPolicy(policy *Policy) *CompiledPolicy {
+	if cached := v.compiled.Load(); cached != nil && cached.source == policy {
+		return cached
+	}
+
+	compiled := policy.Compile(v.compileOpts...)
+	v.compiled.Store(compiled)
+	return compiled
+}
+
+// checkTokenAge enforces WithMaxTokenAge
+func (v *Verifier) checkTokenAge(claims *GitHubActionsClaims) error {
+	if v.maxTokenAge <= 0 {
+		return nil
+	}
+
+	if claims.IssuedAt == nil {
+		return NewValidationError(ErrInvalidToken, "iat claim is required to check the token age")
+	}
+
+	age := v.clock.Now().Sub(claims.IssuedAt.Time)
+	if age > v.maxTokenAge {
+		return newClaimError(ErrTokenExpired,
+			fmt.Sprintf("token issued %s ago exceeds the maximum age of %s", age.Round(time.Second), v.maxTokenAge),
+			map[string]any{"iat": claims.IssuedAt.Unix()})
+	}
+
+	return nil
+}
+
+// checkTokenLifetime enforces WithMaxTokenLifetime
+func (v *Verifier) checkTokenLifetime(claims *GitHubActionsClaims) error {
+	if v.maxTokenLifetime <= 0 || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time)
+	if lifetime > v.maxTokenLifetime {
+		return newClaimError(ErrInvalidToken,
+			fmt.Sprintf("token lifetime of %s exceeds the maximum of %s", lifetime.Round(time.Second), v.maxTokenLifetime),
+			map[string]any{"iat": claims.IssuedAt.Unix(), "exp": claims.ExpiresAt.Unix()})
+	}
+
+	return nil
+}
+
+// tokenClaims is used while parsing so that jwt does not call
+// GitHubActionsClaims.Validate, whose issuer check only accepts GitHub.com.
+// Issuers are checked against the configured ones in keyfunc instead.
+type tokenClaims GitHubActionsClaims
+
+func (c *tokenClaims) UnmarshalJSON(data []byte) error {
+	return (*GitHubActionsClaims)(c).UnmarshalJSON(data)
+}
+
+// jwtParserOptions returns the options of the jwt.Parser for tokens
+func (v *Verifier) jwtParserOptions() []jwt.ParserOption {
+	return append([]jwt.ParserOption{jwt.WithTimeFunc(v.clock.Now), jwt.WithValidMethods(v.allowedAlgs)}, v.parserOptions...)
+}
+
 // parseToken parses and verifies the JWT token
-func (v *Verifier) parseToken(ctx context.Context, tokenString string) (*GitHubActionsClaims, error) {
-	var claims GitHubActionsClaims
+func (v *Verifier) parseToken(ctx context.Context, tokenString string) (*GitHubActionsClaims, *jwt.Token, error) {
+	var claims tokenClaims
 
-	token, err := jwt.ParseWithClaims(tokenString, &claims, v.jwksFetcher.Keyfunc(ctx))
+	var token *jwt.Token
+	var err error
+	if v.keySet != nil {
+		token, err = v.parseWithKeySet(ctx, tokenString, &claims)
+	} else {
+		token, err = v.parser.ParseWithClaims(tokenString, &claims, v.keyfunc(ctx))
+	}
 	if err != nil {
+		// Keep errors raised while selecting the key (untrusted issuer,
+		// unknown key, JWKS fetch failures)
+		var valErr *ValidationError
+		if errors.As(err, &valErr) {
+			return nil, nil, valErr
+		}
+
 		// Check for specific JWT errors
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, NewValidationError(ErrTokenExpired, "token has expired")
+			var offending map[string]any
+			if claims.ExpiresAt != nil {
+				offending = map[string]any{"exp": claims.ExpiresAt.Unix()}
+			}
+			return nil, nil, newClaimError(ErrTokenExpired, "token has expired", offending)
 		}
 		if errors.Is(err, jwt.ErrTokenNotValidYet) {
-			return nil, NewValidationError(ErrInvalidToken, "token not valid yet")
+			return nil, nil, NewValidationError(ErrInvalidToken, "token not valid yet")
 		}
-		return nil, NewValidationError(ErrInvalidToken, err.Error())
+		return nil, nil, NewValidationError(ErrInvalidToken, err.Error())
 	}
 
 	if !token.Valid {
-		return nil, ErrInvalidToken
+		return nil, nil, ErrInvalidToken
+	}
+
+	if mapper := v.issuers[claims.Issuer].ClaimMapper; mapper != nil {
+		mapped, err := mapper((*GitHubActionsClaims)(&claims))
+		if err != nil {
+			return nil, nil, err
+		}
+		mapped.RegisteredClaims = claims.RegisteredClaims
+		mapped.mapped = true
+		if mapped.Extra == nil {
+			mapped.Extra = claims.Extra
+		}
+		return mapped, token, nil
 	}
 
-	return &claims, nil
+	return (*GitHubActionsClaims)(&claims), token, nil
 }
 
 // VerifyToken is a convenience function that creates a one-time verifier
@@ -3,10 +3,13 @@ package ghaauth
 import (
 	"context"
 	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/dev-shimada/gha-auth/internal/testutil"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestVerifier_Verify(t *testing.T) {
@@ -162,6 +165,17 @@ func TestVerifier_Verify(t *testing.T) {
 		if !errors.Is(err, ErrInvalidAudience) {
 			t.Errorf("Verify() error = %v, want ErrInvalidAudience", err)
 		}
+
+		var valErr *ValidationError
+		if !errors.As(err, &valErr) {
+			t.Fatalf("Verify() error = %T, want *ValidationError", err)
+		}
+		if valErr.Code != CodeAudienceMismatch {
+			t.Errorf("Code = %q, want %q", valErr.Code, CodeAudienceMismatch)
+		}
+		if _, ok := valErr.Claims["aud"]; !ok {
+			t.Errorf("Claims = %v, want offending aud", valErr.Claims)
+		}
 	})
 
 	t.Run("invalid issuer", func(t *testing.T) {
@@ -220,6 +234,66 @@ func TestVerifier_Verify(t *testing.T) {
 			t.Error("expected no policy to allow access")
 		}
 	})
+
+	t.Run("policy from provider", func(t *testing.T) {
+		provider := staticPolicyProvider{policy: &Policy{
+			Rules: []Rule{
+				{
+					Name: "allow-other-org",
+					Conditions: Conditions{
+						RepositoryOwner: []string{"otherorg"},
+					},
+					Effect: EffectAllow,
+				},
+			},
+			DefaultDeny: true,
+		}}
+
+		verifier, err := New(
+			WithPolicyProvider(provider),
+			WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		claims := testutil.DefaultClaims()
+		tokenString, err := gen.GenerateToken(claims.ToJWT())
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+
+		_, err = verifier.Verify(ctx, tokenString)
+		if !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("Verify() error = %v, want ErrAccessDenied", err)
+		}
+	})
+
+	t.Run("unknown claims are preserved", func(t *testing.T) {
+		verifier, err := New(
+			WithAudience("https://api.example.com"),
+			WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		claims := testutil.DefaultClaims().ToJWT()
+		claims["custom_team"] = "platform"
+		tokenString, err := gen.GenerateToken(claims)
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+
+		result, err := verifier.Verify(ctx, tokenString)
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+
+		if got := result.Claims.Extra["custom_team"]; got != "platform" {
+			t.Errorf("Claims.Extra[custom_team] = %v, want platform", got)
+		}
+	})
 }
 
 func TestNew(t *testing.T) {
@@ -261,7 +335,7 @@ func TestNew(t *testing.T) {
 			t.Fatalf("New() error = %v", err)
 		}
 
-		if verifier.policy != policy {
+		if verifier.policy.Load() != policy {
 			t.Error("policy not set correctly")
 		}
 
@@ -289,6 +363,25 @@ func TestNew(t *testing.T) {
 			t.Fatal("New() expected error for invalid policy")
 		}
 	})
+
+	t.Run("policy and provider are mutually exclusive", func(t *testing.T) {
+		_, err := New(
+			WithPolicy(&Policy{}),
+			WithPolicyProvider(staticPolicyProvider{}),
+		)
+		if err == nil {
+			t.Fatal("New() expected error for policy and provider")
+		}
+	})
+}
+
+// staticPolicyProvider is a PolicyProvider returning a fixed policy
+type staticPolicyProvider struct {
+	policy *Policy
+}
+
+func (p staticPolicyProvider) Policy() *Policy {
+	return p.policy
 }
 
 func TestVerifyToken(t *testing.T) {
@@ -324,3 +417,833 @@ func TestVerifyToken(t *testing.T) {
 		}
 	})
 }
+
+func TestVerifier_UpdatePolicy(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	ctx := context.Background()
+
+	allowMyorg := &Policy{
+		Rules: []Rule{
+			{
+				Name:       "allow-myorg",
+				Conditions: Conditions{RepositoryOwner: []string{"myorg"}},
+				Effect:     EffectAllow,
+			},
+		},
+		DefaultDeny: true,
+	}
+	allowOtherOrg := &Policy{
+		Rules: []Rule{
+			{
+				Name:       "allow-other-org",
+				Conditions: Conditions{RepositoryOwner: []string{"otherorg"}},
+				Effect:     EffectAllow,
+			},
+		},
+		DefaultDeny: true,
+	}
+
+	tokenString, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	t.Run("swaps policy", func(t *testing.T) {
+		verifier, err := New(
+			WithPolicy(allowMyorg),
+			WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if _, err := verifier.Verify(ctx, tokenString); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+
+		if err := verifier.UpdatePolicy(allowOtherOrg); err != nil {
+			t.Fatalf("UpdatePolicy() error = %v", err)
+		}
+
+		if _, err := verifier.Verify(ctx, tokenString); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("Verify() error = %v, want ErrAccessDenied", err)
+		}
+	})
+
+	t.Run("rejects invalid policy", func(t *testing.T) {
+		verifier, err := New(WithPolicy(allowMyorg))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if err := verifier.UpdatePolicy(&Policy{}); err == nil {
+			t.Error("UpdatePolicy() expected error for invalid policy")
+		}
+		if err := verifier.UpdatePolicy(nil); err == nil {
+			t.Error("UpdatePolicy() expected error for nil policy")
+		}
+
+		if verifier.currentPolicy() != allowMyorg {
+			t.Error("previous policy should remain active after rejected update")
+		}
+	})
+
+	t.Run("rejects update when provider is configured", func(t *testing.T) {
+		verifier, err := New(WithPolicyProvider(staticPolicyProvider{policy: allowMyorg}))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if err := verifier.UpdatePolicy(allowOtherOrg); err == nil {
+			t.Error("UpdatePolicy() expected error with PolicyProvider")
+		}
+	})
+
+	t.Run("concurrent updates and verifications", func(t *testing.T) {
+		verifier, err := New(
+			WithPolicy(allowMyorg),
+			WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				_ = verifier.UpdatePolicy(allowOtherOrg)
+				_ = verifier.UpdatePolicy(allowMyorg)
+			}()
+			go func() {
+				defer wg.Done()
+				_, _ = verifier.Verify(ctx, tokenString)
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestVerifier_Prime(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	ctx := context.Background()
+
+	t.Run("all issuers primed", func(t *testing.T) {
+		verifier, err := New(
+			WithIssuer(Issuer{URL: DefaultIssuer, JWKSURL: server.URL() + "/.well-known/jwks"}),
+			WithIssuer(Issuer{URL: "https://ghes.example.com/_services/token", JWKSURL: server.URL() + "/.well-known/jwks.json"}),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if verifier.Healthy() {
+			t.Error("Healthy() = true before Prime")
+		}
+		if err := verifier.Prime(ctx); err != nil {
+			t.Fatalf("Prime() error = %v", err)
+		}
+		if !verifier.Healthy() {
+			t.Error("Healthy() = false after Prime")
+		}
+	})
+
+	t.Run("failing issuer", func(t *testing.T) {
+		verifier, err := New(
+			WithIssuer(Issuer{URL: DefaultIssuer, JWKSURL: server.URL() + "/.well-known/jwks"}),
+			WithIssuer(Issuer{URL: "https://ghes.example.com/_services/token", JWKSURL: server.URL() + "/missing"}),
+			WithJWKSRetry(RetryPolicy{MaxAttempts: 1}),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		err = verifier.Prime(ctx)
+		if !errors.Is(err, ErrJWKSFetch) {
+			t.Fatalf("Prime() error = %v, want ErrJWKSFetch", err)
+		}
+		if !strings.Contains(err.Error(), "ghes.example.com") {
+			t.Errorf("Prime() error = %v, want failing issuer named", err)
+		}
+		if verifier.Healthy() {
+			t.Error("Healthy() = true with a failing issuer")
+		}
+	})
+}
+
+// fixedClock is a Clock that always returns the same time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestWithMaxTokenAge(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		clock    Clock
+		wantErr  error
+	}{
+		{
+			name:     "fresh token",
+			issuedAt: now.Add(-time.Minute),
+		},
+		{
+			name:     "token older than max age",
+			issuedAt: now.Add(-10 * time.Minute),
+			wantErr:  ErrTokenExpired,
+		},
+		{
+			name:     "token without iat",
+			issuedAt: time.Time{},
+			wantErr:  ErrInvalidToken,
+		},
+		{
+			name:     "age is measured with the verifier clock",
+			issuedAt: now.Add(-time.Minute),
+			clock:    fixedClock(now.Add(6 * time.Minute)),
+			wantErr:  ErrTokenExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testutil.DefaultClaims()
+			claims.IssuedAt = tt.issuedAt
+			claims.NotBefore = time.Time{}
+			claims.ExpiresAt = now.Add(time.Hour)
+
+			tokenString, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			opts := []Option{
+				WithJWKSURL(server.URL() + "/.well-known/jwks"),
+				WithMaxTokenAge(5 * time.Minute),
+				WithMaxTokenLifetime(0), // tokens are valid for an hour
+			}
+			if tt.clock != nil {
+				opts = append(opts, WithClock(tt.clock))
+			}
+
+			verifier, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tokenString)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithMaxTokenLifetime(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		issuedAt  time.Time
+		expiresAt time.Time
+		wantErr   bool
+	}{
+		{
+			name:      "GitHub-like lifetime",
+			issuedAt:  now,
+			expiresAt: now.Add(5 * time.Minute),
+		},
+		{
+			name:      "24h lifetime rejected by default",
+			issuedAt:  now,
+			expiresAt: now.Add(24 * time.Hour),
+			wantErr:   true,
+		},
+		{
+			name:      "configured maximum",
+			opts:      []Option{WithMaxTokenLifetime(2 * time.Minute)},
+			issuedAt:  now,
+			expiresAt: now.Add(5 * time.Minute),
+			wantErr:   true,
+		},
+		{
+			name:      "check disabled",
+			opts:      []Option{WithMaxTokenLifetime(0)},
+			issuedAt:  now,
+			expiresAt: now.Add(24 * time.Hour),
+		},
+		{
+			name:      "token without iat",
+			expiresAt: now.Add(24 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testutil.DefaultClaims()
+			claims.IssuedAt = tt.issuedAt
+			claims.NotBefore = time.Time{}
+			claims.ExpiresAt = tt.expiresAt
+
+			tokenString, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			verifier, err := New(append([]Option{WithJWKSURL(server.URL() + "/.well-known/jwks")}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tokenString)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && (!errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), "lifetime")) {
+				t.Errorf("Verify() error = %v, want ErrInvalidToken about the lifetime", err)
+			}
+		})
+	}
+}
+
+func TestWithRequiredClaims(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithRequiredClaims("environment", "job_workflow_ref"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		environment string
+		wantErr     bool
+	}{
+		{name: "environment-scoped token", environment: "production"},
+		{name: "token without environment", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testutil.DefaultClaims()
+			claims.Environment = tt.environment
+
+			tokenString, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tokenString)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && (!errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), "environment")) {
+				t.Errorf("Verify() error = %v, want ErrInvalidToken naming environment", err)
+			}
+		})
+	}
+}
+
+func TestWithClaimRequirements(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	claims := testutil.DefaultClaims()
+	claims.Actor = ""
+	tokenString, err := gen.GenerateToken(claims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr string
+	}{
+		{name: "default requirements", wantErr: "actor claim is required"},
+		{name: "without actor", opts: []Option{WithClaimRequirements("repository", "ref")}},
+		{name: "no requirements", opts: []Option{WithClaimRequirements()}},
+		{
+			name:    "required claims still apply",
+			opts:    []Option{WithClaimRequirements(), WithRequiredClaims("actor")},
+			wantErr: "actor claim is required",
+		},
+		{
+			name:    "custom requirements",
+			opts:    []Option{WithClaimRequirements("environment")},
+			wantErr: "environment claim is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := New(append([]Option{WithJWKSURL(server.JWKSURL())}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tokenString)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Verify() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	parsed, err := ParseUnverified(tokenString)
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	if err := parsed.Validate(); err == nil || !strings.Contains(err.Error(), "actor") {
+		t.Errorf("Validate() error = %v, want the default requirements", err)
+	}
+
+	// The defaults cannot be changed through the returned slice
+	DefaultRequiredClaims()[5] = "repository"
+	if err := parsed.Validate(); err == nil || !strings.Contains(err.Error(), "actor") {
+		t.Errorf("Validate() error = %v after modifying DefaultRequiredClaims()", err)
+	}
+}
+
+func TestWithClaimConsistency(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	claims := testutil.DefaultClaims()
+	claims.Subject = "repo:myorg/myrepo:ref:refs/heads/release"
+	tokenString, err := gen.GenerateToken(claims.ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	lenient, err := New(WithJWKSURL(server.JWKSURL()))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := lenient.Verify(context.Background(), tokenString); err != nil {
+		t.Errorf("Verify() error = %v without WithClaimConsistency", err)
+	}
+
+	strict, err := New(WithJWKSURL(server.JWKSURL()), WithClaimConsistency())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	_, err = strict.Verify(context.Background(), tokenString)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || !errors.Is(err, ErrInvalidToken) || verr.Claims["sub"] != claims.Subject {
+		t.Errorf("Verify() error = %v, want ErrInvalidToken with the sub claim", err)
+	}
+
+	consistent, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	if _, err := strict.Verify(context.Background(), consistent); err != nil {
+		t.Errorf("Verify() error = %v for consistent claims", err)
+	}
+}
+
+func TestWithParserOptions(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		opts     []jwt.ParserOption
+		wantCode ErrorCode
+	}{
+		{
+			name:     "expired token without leeway",
+			wantCode: CodeTokenExpired,
+		},
+		{
+			name: "leeway accepts clock skew",
+			opts: []jwt.ParserOption{jwt.WithLeeway(time.Minute)},
+		},
+		{
+			name:     "valid methods",
+			opts:     []jwt.ParserOption{jwt.WithLeeway(time.Minute), jwt.WithValidMethods([]string{"RS512"})},
+			wantCode: CodeInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := New(
+				WithJWKSURL(server.URL()+"/.well-known/jwks"),
+				WithParserOptions(tt.opts...),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			claims := testutil.DefaultClaims()
+			claims.ExpiresAt = time.Now().Add(-10 * time.Second)
+			tokenString, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tokenString)
+			if code := ErrorCodeOf(err); code != tt.wantCode {
+				t.Errorf("Verify() error code = %q, want %q (error: %v)", code, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestVerifier_VerifyWith(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithAudience("https://other.example.com"),
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, ErrInvalidAudience) {
+		t.Errorf("Verify() error = %v, want ErrInvalidAudience", err)
+	}
+	if _, err := verifier.VerifyWith(context.Background(), token, WithExpectedAudience("https://api.example.com")); err != nil {
+		t.Errorf("VerifyWith() error = %v", err)
+	}
+
+	deny := (&Policy{DefaultDeny: true, Rules: []Rule{{Conditions: Conditions{RepositoryOwner: []string{"otherorg"}}, Effect: EffectAllow}}}).Compile()
+	_, err = verifier.VerifyWith(context.Background(), token, WithExpectedAudience("https://api.example.com"), WithPolicyOverride(deny))
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("VerifyWith() with policy override error = %v, want ErrAccessDenied", err)
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		b.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		b.Fatalf("failed to generate token: %v", err)
+	}
+
+	verifier, err := New(
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithAudience(testutil.DefaultClaims().Audience[0]),
+		WithPolicy(&Policy{
+			Rules: []Rule{
+				{Name: "deny-bots", Conditions: Conditions{Actor: []string{"*[bot]"}}, Effect: EffectDeny},
+				{Name: "allow-main", Conditions: Conditions{Repository: []string{"myorg/*"}, Ref: []string{"refs/heads/main"}}, Effect: EffectAllow},
+			},
+			DefaultDeny: true,
+		}),
+	)
+	if err != nil {
+		b.Fatalf("New() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := verifier.Verify(ctx, token); err != nil {
+		b.Fatalf("Verify() error = %v", err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := verifier.Verify(ctx, token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWithVerifyTimeout(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+	server.SetDelay(5 * time.Second)
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		deadline time.Duration
+	}{
+		{name: "verify timeout", timeout: 50 * time.Millisecond},
+		{name: "shorter caller deadline", timeout: time.Minute, deadline: 50 * time.Millisecond},
+		{name: "caller deadline without timeout", deadline: 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := New(WithJWKSURL(server.JWKSURL()), WithVerifyTimeout(tt.timeout))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			ctx := context.Background()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				defer cancel()
+			}
+
+			start := time.Now()
+			_, err = verifier.Verify(ctx, token)
+			if !errors.Is(err, ErrJWKSFetch) {
+				t.Errorf("Verify() error = %v, want ErrJWKSFetch", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Verify() took %v against a hung JWKS endpoint", elapsed)
+			}
+		})
+	}
+}
+
+func TestWithStrictPolicies(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	rules := []Rule{{Name: "allow-myorg", Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}}
+	denying := &Policy{Rules: rules, Mode: PolicyModeDefaultDeny}
+	allowing := &Policy{Rules: rules}
+
+	t.Run("New", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			opts    []Option
+			wantErr bool
+		}{
+			{name: "default deny policy", opts: []Option{WithPolicy(denying)}},
+			{name: "default allow policy", opts: []Option{WithPolicy(allowing)}, wantErr: true},
+			{name: "explicit default allow policy", opts: []Option{WithPolicy(&Policy{Rules: rules, Mode: PolicyModeDefaultAllow})}, wantErr: true},
+			{name: "default allow issuer policy", opts: []Option{WithIssuer(Issuer{URL: DefaultIssuer, Policy: allowing})}, wantErr: true},
+			{name: "default allow shadow policy", opts: []Option{WithPolicy(denying), WithShadowPolicy(allowing)}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := New(append(tt.opts, WithStrictPolicies())...)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("UpdatePolicy", func(t *testing.T) {
+		verifier, err := New(WithPolicy(denying), WithStrictPolicies())
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if err := verifier.UpdatePolicy(allowing); err == nil {
+			t.Error("UpdatePolicy() error = nil, want error")
+		}
+		if verifier.currentPolicy() != denying {
+			t.Error("previous policy should remain active after rejected update")
+		}
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			opts    []Option
+			verify  []VerifyOption
+			wantErr bool
+		}{
+			{name: "default deny policy", opts: []Option{WithPolicy(denying)}},
+			{name: "no policy", wantErr: true},
+			{name: "default allow provider policy", opts: []Option{WithPolicyProvider(staticPolicyProvider{policy: allowing})}, wantErr: true},
+			{name: "default allow override", opts: []Option{WithPolicy(denying)}, verify: []VerifyOption{WithPolicyOverride(allowing.Compile())}, wantErr: true},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				verifier, err := New(append(tt.opts, WithJWKSURL(server.JWKSURL()), WithStrictPolicies())...)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+
+				_, err = verifier.VerifyWith(context.Background(), token, tt.verify...)
+				if tt.wantErr {
+					if !errors.Is(err, ErrAccessDenied) {
+						t.Errorf("Verify() error = %v, want ErrAccessDenied", err)
+					}
+				} else if err != nil {
+					t.Errorf("Verify() error = %v", err)
+				}
+			})
+		}
+	})
+}
+
+func TestWithRequirePolicy(t *testing.T) {
+	policy := &Policy{
+		Rules:       []Rule{{Conditions: Conditions{RepositoryOwner: []string{"myorg"}}, Effect: EffectAllow}},
+		DefaultDeny: true,
+	}
+	gitlab := Issuer{URL: "https://gitlab.example.com", Policy: policy}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "policy", opts: []Option{WithPolicy(policy)}},
+		{name: "policy provider", opts: []Option{WithPolicyProvider(staticPolicyProvider{policy: policy})}},
+		{name: "issuer policies", opts: []Option{WithIssuer(Issuer{URL: DefaultIssuer, Policy: policy}), WithIssuer(gitlab)}},
+		{name: "no policy", wantErr: true},
+		{name: "issuer without policy", opts: []Option{WithIssuer(Issuer{URL: DefaultIssuer}), WithIssuer(gitlab)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(append(tt.opts, WithRequirePolicy())...)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("New() error = %v", err)
+				}
+				return
+			}
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Errorf("New() error = %v, want *PolicyError", err)
+			}
+		})
+	}
+}
+
+func TestVerifier_RuleValidityWindow(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	token, err := gen.GenerateToken(testutil.DefaultClaims().ToJWT())
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	// Rule windows follow the verifier's clock
+	clock := &manualClock{now: time.Now()}
+	expiry := clock.now.Add(time.Minute)
+	verifier, err := New(
+		WithJWKSURL(server.JWKSURL()),
+		WithClock(clock),
+		WithPolicy(&Policy{
+			Rules:       []Rule{{Name: "break-glass", Conditions: Conditions{Repository: []string{"myorg/myrepo"}}, Effect: EffectAllow, ValidUntil: &expiry}},
+			DefaultDeny: true,
+		}),
+		WithDenialDetailLevel(DenialDetailFull),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	_, err = verifier.Verify(context.Background(), token)
+	if !errors.Is(err, ErrAccessDenied) || !strings.Contains(err.Error(), "break-glass: valid_until") {
+		t.Errorf("Verify() error = %v, want denial by the expired rule", err)
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/dev-shimada/gha-auth/wasm
+
+go 1.25.6
+
+// The replace only applies when building inside this repository; users of
+// the module get the required release of gha-auth.
+replace github.com/dev-shimada/gha-auth => ../
+
+require (
+	github.com/dev-shimada/gha-auth v0.1.0
+	github.com/tetratelabs/wazero v1.9.0
+)
+
+require (
+	github.com/fsnotify/fsnotify v1.10.1 // indirect
+	github.com/golang-jwt/jwt/v5 v5.3.1 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
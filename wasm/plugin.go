@@ -0,0 +1,206 @@
+// Package wasmghaauth runs ghaauth condition plugins compiled to
+// WebAssembly with wazero, so that organizations can ship custom policy
+// logic without forking the library or rebuilding the service.
+//
+// A plugin module must export:
+//
+//	memory                           the module's linear memory
+//	alloc(size i32) -> i32           returns a buffer of size bytes
+//	evaluate(ptr i32, len i32) -> i32
+//
+// evaluate is called with the token claims encoded as JSON in a buffer
+// from alloc, and returns 1 if the condition is satisfied and 0 if it is
+// not. Any other result, a trap or a timeout is an error, which fails the
+// condition closed. Modules built for WASI (e.g. with TinyGo or Rust's
+// wasm32-wasip1 target) may use it, but get no file system, network,
+// environment or clock access.
+package wasmghaauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// DefaultTimeout bounds a single evaluation
+const DefaultTimeout = 100 * time.Millisecond
+
+// DefaultMemoryLimitPages limits a module's memory to 16 MiB
+const DefaultMemoryLimitPages = 256
+
+// Option configures a Plugin
+type Option func(*Plugin)
+
+// WithTimeout sets how long a single evaluation may run
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Plugin) {
+		p.timeout = timeout
+	}
+}
+
+// WithMemoryLimitPages sets the maximum memory of the module in 64 KiB
+// pages
+func WithMemoryLimitPages(pages uint32) Option {
+	return func(p *Plugin) {
+		p.memoryPages = pages
+	}
+}
+
+// Plugin is a condition plugin backed by a WebAssembly module. Each
+// evaluation runs in a fresh instance, so evaluations are isolated from
+// each other and may run concurrently.
+type Plugin struct {
+	timeout     time.Duration
+	memoryPages uint32
+
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+}
+
+// Load compiles a plugin module and checks that it implements the ABI.
+// Call Close to release it.
+func Load(ctx context.Context, wasm []byte, opts ...Option) (*Plugin, error) {
+	p := &Plugin{
+		timeout:     DefaultTimeout,
+		memoryPages: DefaultMemoryLimitPages,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(p.memoryPages))
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.runtime); err != nil {
+		_ = p.runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to instantiate WASI: %w", err)
+	}
+
+	module, err := p.runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		_ = p.runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to compile plugin module: %w", err)
+	}
+	p.module = module
+
+	if err := checkExports(module); err != nil {
+		_ = p.runtime.Close(ctx)
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// LoadFile loads a plugin module from a .wasm file
+func LoadFile(ctx context.Context, path string, opts ...Option) (*Plugin, error) {
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin module: %w", err)
+	}
+	return Load(ctx, wasm, opts...)
+}
+
+// Register loads a plugin module from a .wasm file and registers it with
+// ghaauth.RegisterConditionPlugin under name, for rules with
+// "plugin: [name]". Call Close once the plugin is unregistered.
+func Register(ctx context.Context, name, path string, opts ...Option) (*Plugin, error) {
+	p, err := LoadFile(ctx, path, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ghaauth.RegisterConditionPlugin(name, p.Evaluate)
+	return p, nil
+}
+
+// checkExports verifies that the module exports the functions and memory
+// of the ABI
+func checkExports(module wazero.CompiledModule) error {
+	if _, ok := module.ExportedMemories()["memory"]; !ok {
+		return fmt.Errorf("plugin module does not export memory")
+	}
+
+	functions := module.ExportedFunctions()
+	for name, params := range map[string]int{"alloc": 1, "evaluate": 2} {
+		fn, ok := functions[name]
+		if !ok {
+			return fmt.Errorf("plugin module does not export %s", name)
+		}
+		if !allI32(fn.ParamTypes(), params) || !allI32(fn.ResultTypes(), 1) {
+			return fmt.Errorf("plugin function %s has the wrong signature", name)
+		}
+	}
+	return nil
+}
+
+// allI32 reports whether there are n types, all of them i32
+func allI32(types []api.ValueType, n int) bool {
+	if len(types) != n {
+		return false
+	}
+	for _, t := range types {
+		if t != api.ValueTypeI32 {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate runs the module's evaluate function on the claims. It is a
+// ghaauth.ConditionPlugin.
+func (p *Plugin) Evaluate(claims *ghaauth.GitHubActionsClaims) (bool, error) {
+	input, err := json.Marshal(claims)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode claims: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	// An empty name lets the module be instantiated any number of times
+	instance, err := p.runtime.InstantiateModule(ctx, p.module, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return false, fmt.Errorf("failed to instantiate plugin module: %w", err)
+	}
+	defer func() { _ = instance.Close(ctx) }()
+
+	results, err := instance.ExportedFunction("alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return false, fmt.Errorf("plugin alloc failed: %w", err)
+	}
+	ptr := uint32(results[0])
+	if !instance.Memory().Write(ptr, input) {
+		return false, fmt.Errorf("plugin alloc returned an invalid buffer")
+	}
+
+	results, err = instance.ExportedFunction("evaluate").Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return false, fmt.Errorf("plugin evaluate failed: %w", err)
+	}
+
+	switch result := uint32(results[0]); result {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("plugin evaluate returned %d, want 0 or 1", result)
+	}
+}
+
+// Close releases the module
+func (p *Plugin) Close(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
@@ -0,0 +1,152 @@
+package wasmghaauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ghaauth "github.com/dev-shimada/gha-auth"
+)
+
+// pluginModule assembles a module implementing the plugin ABI whose
+// evaluate function has the given body (locals and instructions). alloc
+// always returns offset 1024 of a one page memory.
+func pluginModule(evaluate []byte) []byte {
+	section := func(id byte, content ...byte) []byte {
+		return append([]byte{id, byte(len(content))}, content...)
+	}
+
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	// (i32) -> i32 and (i32, i32) -> i32
+	module = append(module, section(1, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f)...)
+	module = append(module, section(3, 0x02, 0x00, 0x01)...)
+	module = append(module, section(5, 0x01, 0x00, 0x01)...)
+
+	exports := []byte{0x03}
+	exports = append(exports, 0x06)
+	exports = append(exports, "memory"...)
+	exports = append(exports, 0x02, 0x00)
+	exports = append(exports, 0x05)
+	exports = append(exports, "alloc"...)
+	exports = append(exports, 0x00, 0x00)
+	exports = append(exports, 0x08)
+	exports = append(exports, "evaluate"...)
+	exports = append(exports, 0x00, 0x01)
+	module = append(module, section(7, exports...)...)
+
+	alloc := []byte{0x00, 0x41, 0x80, 0x08, 0x0b} // i32.const 1024
+	code := []byte{0x02, byte(len(alloc))}
+	code = append(code, alloc...)
+	code = append(code, byte(len(evaluate)))
+	code = append(code, evaluate...)
+	return append(module, section(10, code...)...)
+}
+
+var (
+	// evaluateLong accepts claims longer than 1000 bytes
+	evaluateLong = []byte{0x00, 0x20, 0x01, 0x41, 0xe8, 0x07, 0x4b, 0x0b}
+
+	// evaluateInvalid returns 7
+	evaluateInvalid = []byte{0x00, 0x41, 0x07, 0x0b}
+
+	// evaluateLoop never returns
+	evaluateLoop = []byte{0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x41, 0x00, 0x0b}
+)
+
+func TestPlugin_Evaluate(t *testing.T) {
+	ctx := context.Background()
+
+	plugin, err := Load(ctx, pluginModule(evaluateLong))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	defer func() { _ = plugin.Close(ctx) }()
+
+	short := &ghaauth.GitHubActionsClaims{Repository: "myorg/myrepo"}
+	long := &ghaauth.GitHubActionsClaims{Repository: "myorg/myrepo", Workflow: strings.Repeat("x", 1000)}
+
+	if got, err := plugin.Evaluate(short); err != nil || got {
+		t.Errorf("Evaluate(short) = %v, %v, want false", got, err)
+	}
+	if got, err := plugin.Evaluate(long); err != nil || !got {
+		t.Errorf("Evaluate(long) = %v, %v, want true", got, err)
+	}
+
+	invalid, err := Load(ctx, pluginModule(evaluateInvalid))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	defer func() { _ = invalid.Close(ctx) }()
+	if _, err := invalid.Evaluate(short); err == nil {
+		t.Error("Evaluate() error = nil for an invalid result")
+	}
+
+	loop, err := Load(ctx, pluginModule(evaluateLoop), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	defer func() { _ = loop.Close(ctx) }()
+	if _, err := loop.Evaluate(short); err == nil {
+		t.Error("Evaluate() error = nil for a plugin that does not return")
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	ctx := context.Background()
+
+	// Drop the export section's evaluate entry by renaming it
+	renamed := pluginModule(evaluateLong)
+	copy(renamed[strings.Index(string(renamed), "evaluate"):], "evaluatf")
+
+	for name, wasm := range map[string][]byte{
+		"not a module":     []byte("not wasm"),
+		"missing evaluate": renamed,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if p, err := Load(ctx, wasm); err == nil {
+				_ = p.Close(ctx)
+				t.Error("Load() error = nil")
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "long.wasm")
+	if err := os.WriteFile(path, pluginModule(evaluateLong), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin, err := Register(ctx, "long-claims", path)
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	defer func() { _ = plugin.Close(ctx) }()
+	defer ghaauth.UnregisterConditionPlugin("long-claims")
+
+	policy, err := ghaauth.ParsePolicyYAML([]byte(`
+default_deny: true
+rules:
+  - name: long-claims
+    conditions:
+      repository: [myorg/*]
+      plugin: [long-claims]
+    effect: allow
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicyYAML() error = %v", err)
+	}
+
+	claims := &ghaauth.GitHubActionsClaims{Repository: "myorg/myrepo"}
+	if policy.Evaluate(claims).Allowed {
+		t.Error("Evaluate().Allowed = true for claims the plugin rejects")
+	}
+	claims.Workflow = strings.Repeat("x", 1000)
+	if !policy.Evaluate(claims).Allowed {
+		t.Error("Evaluate().Allowed = false for claims the plugin accepts")
+	}
+}
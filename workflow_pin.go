@@ -0,0 +1,56 @@
+package ghaauth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithTrustedWorkflows only accepts tokens whose job_workflow_ref matches
+// one of the patterns, regardless of the policy. Pin the reusable
+// workflows allowed to request tokens to a tag or commit, e.g.
+// "myorg/workflows/.github/workflows/deploy.yml@refs/tags/v*".
+func WithTrustedWorkflows(patterns ...string) Option {
+	return func(v *Verifier) {
+		for _, pattern := range patterns {
+			if err := ValidatePattern(pattern); err != nil {
+				v.optionErrs = append(v.optionErrs, fmt.Errorf("invalid trusted workflow %q: %w", pattern, err))
+			}
+		}
+		v.trustedWorkflows = append(v.trustedWorkflows, patterns...)
+	}
+}
+
+// checkTrustedWorkflow enforces WithTrustedWorkflows
+func (v *Verifier) checkTrustedWorkflow(claims *GitHubActionsClaims) error {
+	if len(v.trustedWorkflows) == 0 {
+		return nil
+	}
+
+	if claims.JobWorkflowRef == "" || !MatchAny(v.trustedWorkflows, claims.JobWorkflowRef) {
+		return newClaimError(ErrAccessDenied, "job_workflow_ref is not a trusted workflow",
+			map[string]any{"job_workflow_ref": claims.JobWorkflowRef})
+	}
+
+	return nil
+}
+
+// JobWorkflowSHAMatches reports whether the reusable workflow that ran the
+// job was built from the expected commit. Both must be full commit SHAs;
+// case is ignored, abbreviated SHAs never match.
+func (c *GitHubActionsClaims) JobWorkflowSHAMatches(expected string) bool {
+	return isCommitSHA(expected) && strings.EqualFold(c.JobWorkflowSHA, expected)
+}
+
+// isCommitSHA reports whether s is a full SHA-1 or SHA-256 commit hash
+func isCommitSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20 // lower case
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
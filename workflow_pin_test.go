@@ -0,0 +1,117 @@
+package ghaauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dev-shimada/gha-auth/internal/testutil"
+)
+
+func TestWithTrustedWorkflows(t *testing.T) {
+	gen, err := testutil.NewTokenGenerator()
+	if err != nil {
+		t.Fatalf("failed to create token generator: %v", err)
+	}
+
+	server := testutil.NewJWKSServer(gen.PublicKey(), gen.KeyID())
+	defer server.Close()
+
+	verifier, err := New(
+		WithJWKSURL(server.URL()+"/.well-known/jwks"),
+		WithTrustedWorkflows(
+			"myorg/workflows/.github/workflows/deploy.yml@refs/tags/v*",
+			"myorg/workflows/.github/workflows/deploy.yml@0123456789abcdef0123456789abcdef01234567",
+		),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		jobWorkflowRef string
+		wantErr        bool
+	}{
+		{
+			name:           "pinned to tag",
+			jobWorkflowRef: "myorg/workflows/.github/workflows/deploy.yml@refs/tags/v1.4.0",
+		},
+		{
+			name:           "pinned to commit",
+			jobWorkflowRef: "myorg/workflows/.github/workflows/deploy.yml@0123456789abcdef0123456789abcdef01234567",
+		},
+		{
+			name:           "branch ref",
+			jobWorkflowRef: "myorg/workflows/.github/workflows/deploy.yml@refs/heads/main",
+			wantErr:        true,
+		},
+		{
+			name:           "other workflow",
+			jobWorkflowRef: "myorg/myrepo/.github/workflows/ci.yml@refs/tags/v1.4.0",
+			wantErr:        true,
+		},
+		{
+			name:    "missing job_workflow_ref",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testutil.DefaultClaims()
+			claims.JobWorkflowRef = tt.jobWorkflowRef
+
+			tokenString, err := gen.GenerateToken(claims.ToJWT())
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), tokenString)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrAccessDenied) {
+				t.Errorf("Verify() error = %v, want ErrAccessDenied", err)
+			}
+		})
+	}
+}
+
+func TestWithTrustedWorkflows_InvalidPattern(t *testing.T) {
+	_, err := New(WithTrustedWorkflows("re:deploy.yml@(refs/tags/"))
+	if err == nil {
+		t.Fatal("New() expected error for invalid regular expression")
+	}
+}
+
+func TestGitHubActionsClaims_JobWorkflowSHAMatches(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	claims := &GitHubActionsClaims{JobWorkflowSHA: sha}
+
+	tests := []struct {
+		name     string
+		expected string
+		want     bool
+	}{
+		{name: "same commit", expected: sha, want: true},
+		{name: "upper case", expected: "0123456789ABCDEF0123456789ABCDEF01234567", want: true},
+		{name: "other commit", expected: "fedcba9876543210fedcba9876543210fedcba98", want: false},
+		{name: "abbreviated", expected: sha[:7], want: false},
+		{name: "empty", expected: "", want: false},
+		{name: "not hex", expected: "zz23456789abcdef0123456789abcdef01234567", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claims.JobWorkflowSHAMatches(tt.expected); got != tt.want {
+				t.Errorf("JobWorkflowSHAMatches(%q) = %v, want %v", tt.expected, got, tt.want)
+			}
+		})
+	}
+
+	empty := &GitHubActionsClaims{}
+	if empty.JobWorkflowSHAMatches("") {
+		t.Error("JobWorkflowSHAMatches(\"\") on claims without job_workflow_sha = true, want false")
+	}
+}